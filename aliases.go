@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v3"
+)
+
+// privateOrganizationSuffix is the suffix of organizations with private mirrors of public repositories (eg. openshift-priv).
+const privateOrganizationSuffix = "-priv"
+
+// readRepositoryAliases reads the -repo-alias file, mapping repositories the token can't read to accessible mirrors:
+//
+//	aliases:
+//	  https://github.com/openshift-priv/foo: https://github.com/openshift/foo
+func readRepositoryAliases(file string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := parseRepositoryAliases(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return aliases, nil
+}
+
+func parseRepositoryAliases(data []byte) (map[string]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("no aliases defined")
+	}
+	root := document.Content[0]
+	if err := validateKeys(root, []string{"aliases"}, "alias file"); err != nil {
+		return nil, err
+	}
+	aliases := map[string]string{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		node := root.Content[i+1]
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("field \"aliases\" must be a mapping at line %d", node.Line)
+		}
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			from, to := node.Content[j].Value, node.Content[j+1].Value
+			if _, ok := aliases[from]; ok {
+				return nil, fmt.Errorf("duplicate alias of %s at line %d", from, node.Content[j].Line)
+			}
+			if _, _, ok := parseRepositoryOrgName(to); !ok {
+				return nil, fmt.Errorf("alias of %s at line %d is not a Github repository URL: %q", from, node.Content[j+1].Line, to)
+			}
+			aliases[from] = to
+		}
+	}
+	for from := range aliases {
+		if chain, ok := aliasCycle(aliases, from); ok {
+			return nil, fmt.Errorf("aliases form a cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	return aliases, nil
+}
+
+// aliasCycle follows the aliases from the repository and returns the chain when it comes back to a visited repository.
+func aliasCycle(aliases map[string]string, repository string) ([]string, bool) {
+	visited := map[string]bool{repository: true}
+	chain := []string{repository}
+	for next, ok := aliases[repository]; ok; next, ok = aliases[next] {
+		chain = append(chain, next)
+		if visited[next] {
+			return chain, true
+		}
+		visited[next] = true
+	}
+	return nil, false
+}
+
+// repositoryAlternatives returns repositories to try, in order, when the token can't read the repository:
+// the configured aliases (following aliases of aliases) and the repository in the organization without
+// the "-priv" suffix.
+func repositoryAlternatives(repository string, aliases map[string]string) []string {
+	var alternatives []string
+	for next, ok := aliases[repository]; ok; next, ok = aliases[next] {
+		alternatives = append(alternatives, next)
+	}
+	if organization, name, ok := parseRepositoryOrgName(repository); ok && strings.HasSuffix(organization, privateOrganizationSuffix) {
+		public := fmt.Sprintf("https://github.com/%s/%s", strings.TrimSuffix(organization, privateOrganizationSuffix), name)
+		alternative := true
+		for _, a := range alternatives {
+			if a == public {
+				alternative = false
+			}
+		}
+		if alternative {
+			alternatives = append(alternatives, public)
+		}
+	}
+	return alternatives
+}
+
+// processRepositoryOrAlternative processes the repository, or the first alternative the token can read when it
+// can't read the repository. Changes of an alternative keep the repository and record the mirror they come from.
+func processRepositoryOrAlternative(ctx context.Context, client *github.Client, options ProcessOptions, state *runState, repository, organization, name string) ([]Change, error) {
+	changes, err := processRepository(ctx, client, options, state, repository, organization, name)
+	if err == nil || !isNotFound(err) || len(options.GitMirrorDir) > 0 {
+		return changes, err
+	}
+	for _, alternative := range repositoryAlternatives(repository, options.RepositoryAliases) {
+		alternativeOrganization, alternativeName, ok := parseRepositoryOrgName(alternative)
+		if !ok {
+			continue
+		}
+		logVerbose("[%s] not accessible, trying %s", repository, alternative)
+		alternativeChanges, alternativeErr := processRepository(ctx, client, options, state, repository, alternativeOrganization, alternativeName)
+		if alternativeErr != nil && !isTruncated(alternativeErr) {
+			logVerbose("[%s] %s failed: %v", repository, alternative, alternativeErr)
+			continue
+		}
+		logVerbose("[%s] listing commits from %s", repository, alternative)
+		for i := range alternativeChanges {
+			raw := alternativeChanges[i].raw
+			raw.Mirror = alternative
+			alternativeChanges[i] = newChange(raw)
+		}
+		return alternativeChanges, alternativeErr
+	}
+	return nil, err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakePrivateGithub responds with 404 to every openshift-priv request, as Github does for private repositories
+// the token can't read, and serves a commit of openshift/api while openshift/oc does not exist.
+func fakePrivateGithub(t *testing.T) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/repos/openshift-priv/"), strings.HasPrefix(req.URL.Path, "/repos/openshift/oc"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case req.URL.Path == "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case req.URL.Path == "/repos/openshift/api/commits":
+			fmt.Fprintf(w, `[{"sha": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "html_url": "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "commit": {"message": "Bump the API", "committer": {"date": %q}}}]`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestParseRepositoryAliases(t *testing.T) {
+	aliases, err := parseRepositoryAliases([]byte(`aliases:
+  https://github.com/openshift-priv/installer: https://github.com/openshift/installer
+  https://github.com/openshift/installer: https://github.com/openshift/installer-mirror
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 2 {
+		t.Errorf("unexpected aliases %v", aliases)
+	}
+
+	tests := []struct {
+		name, data, expected string
+	}{
+		{name: "cycle", data: "aliases:\n  https://github.com/a/x: https://github.com/b/x\n  https://github.com/b/x: https://github.com/a/x\n", expected: "aliases form a cycle: "},
+		{name: "self", data: "aliases:\n  https://github.com/a/x: https://github.com/a/x\n", expected: "aliases form a cycle: https://github.com/a/x -> https://github.com/a/x"},
+		{name: "duplicate", data: "aliases:\n  https://github.com/a/x: https://github.com/b/x\n  https://github.com/a/x: https://github.com/c/x\n", expected: "duplicate alias of https://github.com/a/x at line 3"},
+		{name: "not a URL", data: "aliases:\n  https://github.com/a/x: b/x\n", expected: `alias of https://github.com/a/x at line 2 is not a Github repository URL: "b/x"`},
+		{name: "unknown field", data: "alias:\n  https://github.com/a/x: https://github.com/b/x\n", expected: `"alias"`},
+		{name: "not a mapping", data: "aliases: [https://github.com/a/x]\n", expected: `field "aliases" must be a mapping at line 1`},
+		{name: "empty", data: "", expected: "no aliases defined"},
+	}
+	for _, test := range tests {
+		if _, err := parseRepositoryAliases([]byte(test.data)); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestRepositoryAlternatives(t *testing.T) {
+	aliases := map[string]string{
+		"https://github.com/openshift-priv/api": "https://github.com/mirrors/api",
+		"https://github.com/mirrors/api":        "https://github.com/openshift/api",
+	}
+	// aliases of aliases are followed, the repository without -priv is not tried twice
+	if alternatives := repositoryAlternatives("https://github.com/openshift-priv/api", aliases); !reflect.DeepEqual(alternatives, []string{"https://github.com/mirrors/api", "https://github.com/openshift/api"}) {
+		t.Errorf("unexpected alternatives %v", alternatives)
+	}
+	if alternatives := repositoryAlternatives("https://github.com/openshift-priv/oc", nil); !reflect.DeepEqual(alternatives, []string{"https://github.com/openshift/oc"}) {
+		t.Errorf("unexpected alternatives %v", alternatives)
+	}
+	if alternatives := repositoryAlternatives("https://github.com/openshift/oc", aliases); len(alternatives) != 0 {
+		t.Errorf("expected no alternatives, got %v", alternatives)
+	}
+}
+
+func TestRepositoryAliasFallback(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "aliases.yaml")
+	if err := ioutil.WriteFile(file, []byte("aliases:\n  https://github.com/openshift-priv/oc: https://github.com/openshift/oc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	query := &queryOptions{since: "1d", branch: "master", repoAliases: file}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	repos := []string{"https://github.com/openshift-priv/api", "https://github.com/openshift-priv/oc"}
+
+	defer func(v bool) { verbose = v }(verbose)
+	verbose = true
+	var result *queryResult
+	output := captureLog(t, func() {
+		var err error
+		result, err = query.collect(context.Background(), fakePrivateGithub(t), &sharedOptions{concurrency: 10, skipTokenCheck: true}, repos, NewCache())
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, expected := range []string{
+		"[https://github.com/openshift-priv/api] not accessible, trying https://github.com/openshift/api",
+		"[https://github.com/openshift-priv/api] listing commits from https://github.com/openshift/api",
+		"[https://github.com/openshift-priv/oc] not accessible, trying https://github.com/openshift/oc",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in:\n%s", expected, output)
+		}
+	}
+
+	// the change keeps the payload repository and records the mirror
+	if len(result.Changes) != 1 {
+		t.Fatalf("expected the change of the mirror, got %+v", result.Changes)
+	}
+	raw := result.Changes[0].raw
+	if raw.Repository != "https://github.com/openshift-priv/api" || raw.Mirror != "https://github.com/openshift/api" || !strings.Contains(result.Changes[0].URL, "(listed from https://github.com/openshift/api)") {
+		t.Errorf("unexpected change %+v", raw)
+	}
+	// no alternative is readable, the error of the repository is reported
+	if len(result.Errors) != 1 || result.Errors[0].Repository != "https://github.com/openshift-priv/oc" || result.Errors[0].Kind != ErrorKindPrivateFork {
+		t.Errorf("expected the private fork error, got %+v", result.Errors)
+	}
+	summary := captureLog(t, func() { printErrorSummary(result.Errors) })
+	if !strings.Contains(summary, "map them to readable mirrors with -repo-alias") {
+		t.Errorf("expected the alias hint, got:\n%s", summary)
+	}
+
+	if err := (&queryOptions{repoAliases: filepath.Join(t.TempDir(), "missing.yaml")}).validate(); err == nil {
+		t.Errorf("expected a missing alias file to fail validation")
+	}
+}
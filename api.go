@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// API request categories, used to attribute the quota consumption to features
+const (
+	categoryCommitList      = "commit-list"
+	categoryCompare         = "compare"
+	categoryRepository      = "repository"
+	categoryPullRequest     = "pr-lookup"
+	categorySearch          = "search"
+	categoryContents        = "contents"
+	categoryTeams           = "teams"
+	categoryBranches        = "branches"
+	categoryComments        = "comments"
+	categoryLastActivity    = "last-activity"
+	categoryOrgRepositories = "org-repos"
+	categoryCommitFiles     = "commit-files"
+	categoryEstimate        = "estimate"
+	categoryModuleVersions  = "module-versions"
+	categoryCommitProbe     = "commit-probe"
+	categoryCommitHistory   = "commit-history"
+	categoryOther           = "other"
+)
+
+// coreCategories are never limited by the API budget, as without them there is nothing to report
+var coreCategories = map[string]bool{
+	categoryCommitList:    true,
+	categoryCommitHistory: true,
+	categoryCompare:       true,
+	categoryRepository:    true,
+}
+
+var errBudgetExhausted = errors.New("API budget exhausted")
+
+type categoryContextKey struct{}
+
+// withCategory attributes requests made with the returned context to the category.
+func withCategory(ctx context.Context, category string) context.Context {
+	return context.WithValue(ctx, categoryContextKey{}, category)
+}
+
+func categoryFromContext(ctx context.Context) string {
+	if category, ok := ctx.Value(categoryContextKey{}).(string); ok {
+		return category
+	}
+	return categoryOther
+}
+
+// isBudgetExhausted reports whether the request was not made because of the API budget.
+func isBudgetExhausted(err error) bool {
+	return errors.Is(err, errBudgetExhausted)
+}
+
+// APIUsage counts the requests made per category. When budget is set, requests in optional
+// categories are refused once the total number of requests reaches it.
+type APIUsage struct {
+	lock sync.Mutex
+
+	budget   int
+	total    int
+	requests map[string]int
+	skipped  map[string]int
+
+	// firstRateLimit and lastRateLimit are the core rate limits of the first and the last response
+	firstRateLimit *RateLimitSnapshot
+	lastRateLimit  *RateLimitSnapshot
+}
+
+func NewAPIUsage(budget int) *APIUsage {
+	return &APIUsage{budget: budget, requests: map[string]int{}, skipped: map[string]int{}}
+}
+
+func (u *APIUsage) allow(category string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.budget > 0 && u.total >= u.budget && !coreCategories[category] {
+		u.skipped[category]++
+		return false
+	}
+	u.total++
+	u.requests[category]++
+	return true
+}
+
+// Requests returns a copy of the per category request counts.
+func (u *APIUsage) Requests() map[string]int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	requests := map[string]int{}
+	for k, v := range u.requests {
+		requests[k] = v
+	}
+	return requests
+}
+
+func (u *APIUsage) recordRateLimit(resp *http.Response) {
+	snapshot := parseRateLimit(resp)
+	if snapshot == nil {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.firstRateLimit == nil {
+		u.firstRateLimit = snapshot
+	}
+	u.lastRateLimit = snapshot
+}
+
+// RateLimits returns the core rate limits of the first and the last response, nil when there was none.
+func (u *APIUsage) RateLimits() (*RateLimitSnapshot, *RateLimitSnapshot) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.firstRateLimit, u.lastRateLimit
+}
+
+// APIUsageRow is a row of the API usage breakdown table.
+type APIUsageRow struct {
+	Category string `header:"Category"`
+	Requests int    `header:"Requests"`
+	Skipped  int    `header:"Skipped"`
+}
+
+func (u *APIUsage) Print(w io.Writer) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	var rows []APIUsageRow
+	for category, requests := range u.requests {
+		rows = append(rows, APIUsageRow{Category: category, Requests: requests, Skipped: u.skipped[category]})
+	}
+	for category, skipped := range u.skipped {
+		if _, ok := u.requests[category]; !ok {
+			rows = append(rows, APIUsageRow{Category: category, Skipped: skipped})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Requests > rows[j].Requests })
+	fmt.Fprintf(w, "\nGithub API requests (%d total):\n", u.total)
+	tableprinter.New(w).Print(rows)
+	if len(u.skipped) > 0 {
+		fmt.Fprintf(w, "The API budget of %d requests was reached, optional columns may be incomplete.\n", u.budget)
+	}
+}
+
+// countingTransport attributes every request to the category from its context.
+type countingTransport struct {
+	base  http.RoundTripper
+	usage *APIUsage
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.usage.allow(categoryFromContext(req.Context())) {
+		return nil, errBudgetExhausted
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.usage.recordRateLimit(resp)
+	}
+	return resp, err
+}
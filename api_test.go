@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTransport responds to every request with an empty JSON object, counting the requests it received.
+type fakeTransport struct {
+	lock     sync.Mutex
+	requests int
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.Lock()
+	t.requests++
+	t.lock.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+// sendRequests sends n requests of each category from as many goroutines, returns the number of the requests
+// refused because of the budget.
+func sendRequests(t *testing.T, client *http.Client, categories []string, n int) int {
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		refused int
+	)
+	for _, category := range categories {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(category string) {
+				defer wg.Done()
+				req, err := http.NewRequestWithContext(withCategory(context.Background(), category), http.MethodGet, "https://api.github.com/", nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp, err := client.Do(req)
+				if errors.Is(err, errBudgetExhausted) {
+					lock.Lock()
+					refused++
+					lock.Unlock()
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}(category)
+		}
+	}
+	wg.Wait()
+	return refused
+}
+
+func TestAPIUsageUnderConcurrency(t *testing.T) {
+	base := &fakeTransport{}
+	usage := NewAPIUsage(0)
+	client := &http.Client{Transport: &countingTransport{base: base, usage: usage}}
+	categories := []string{categoryCommitList, categoryPullRequest, categoryContents, categoryOther}
+	if refused := sendRequests(t, client, categories, 100); refused > 0 {
+		t.Errorf("expected no refused requests without a budget, got %d", refused)
+	}
+	requests := usage.Requests()
+	for _, category := range categories {
+		if requests[category] != 100 {
+			t.Errorf("expected 100 %s requests, got %d", category, requests[category])
+		}
+	}
+	if base.requests != 400 || usage.total != 400 {
+		t.Errorf("expected 400 requests, got %d sent and %d counted", base.requests, usage.total)
+	}
+}
+
+func TestAPIBudget(t *testing.T) {
+	base := &fakeTransport{}
+	usage := NewAPIUsage(50)
+	client := &http.Client{Transport: &countingTransport{base: base, usage: usage}}
+	// the core requests exhaust the budget
+	if refused := sendRequests(t, client, []string{categoryCommitList}, 60); refused > 0 {
+		t.Errorf("expected the core requests over the budget made, got %d refused", refused)
+	}
+	if refused := sendRequests(t, client, []string{categoryPullRequest, categoryContents}, 10); refused != 20 {
+		t.Errorf("expected the 20 optional requests refused, got %d", refused)
+	}
+	if refused := sendRequests(t, client, []string{categoryCompare}, 5); refused > 0 {
+		t.Errorf("expected the core requests over the budget made, got %d refused", refused)
+	}
+	if base.requests != 65 {
+		t.Errorf("expected 65 requests sent, got %d", base.requests)
+	}
+	if usage.skipped[categoryPullRequest] != 10 || usage.skipped[categoryContents] != 10 {
+		t.Errorf("expected the skipped requests counted, got %v", usage.skipped)
+	}
+
+	// the budget is shared: optional requests are made until the total reaches it
+	usage = NewAPIUsage(50)
+	client = &http.Client{Transport: &countingTransport{base: &fakeTransport{}, usage: usage}}
+	if refused := sendRequests(t, client, []string{categoryCommitList}, 30); refused > 0 {
+		t.Errorf("expected no refused core requests, got %d", refused)
+	}
+	if refused := sendRequests(t, client, []string{categoryPullRequest, categoryContents}, 20); refused != 20 {
+		t.Errorf("expected 20 of the 40 optional requests refused, got %d", refused)
+	}
+	if usage.total != 50 {
+		t.Errorf("expected the budget of 50 requests used, got %d", usage.total)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is how long the JWT authenticating as the Github App is valid, Github accepts at most 10 minutes
+	appJWTLifetime = 9 * time.Minute
+	// appTokenRefreshMargin is how long before its expiry an installation token is replaced, so requests in flight
+	// never use an expired one
+	appTokenRefreshMargin = 5 * time.Minute
+	// defaultGithubAPIURL is where installation tokens are exchanged unless -github-api-url is set
+	defaultGithubAPIURL = "https://api.github.com/"
+)
+
+// readAppPrivateKey reads the PEM private key of the Github App (PKCS#1 as downloaded from Github, or PKCS#8).
+func readAppPrivateKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM private key found", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a RSA private key, got %T", file, parsed)
+	}
+	return key, nil
+}
+
+// appJWT returns the JWT authenticating as the Github App, signed with RS256. It is issued a minute in the past
+// to allow for clock drift, as Github recommends.
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appTokenSource exchanges JWTs of the Github App for installation tokens. It is wrapped by oauth2.ReuseTokenSource,
+// which serializes the refreshes of all workers and swaps the token under its lock.
+type appTokenSource struct {
+	client         *http.Client
+	baseURL        *url.URL
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	now            func() time.Time
+}
+
+func newAppTokenSource(apiURL string, appID, installationID int64, key *rsa.PrivateKey) (*appTokenSource, error) {
+	if len(apiURL) == 0 {
+		apiURL = defaultGithubAPIURL
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+	if err != nil || len(baseURL.Host) == 0 {
+		return nil, fmt.Errorf("invalid -github-api-url %q, expected an URL like https://api.github.com/", apiURL)
+	}
+	return &appTokenSource{
+		client:         &http.Client{Timeout: time.Minute},
+		baseURL:        baseURL,
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+// Token exchanges a new JWT for an installation token, it expires appTokenRefreshMargin before Github expires it.
+// Failures wrap errAppTokenRefresh, so they count as authentication failures (see authBreaker).
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.exchange()
+	if err != nil {
+		return nil, fmt.Errorf("%w of installation %d: %v", errAppTokenRefresh, s.installationID, err)
+	}
+	return token, nil
+}
+
+func (s *appTokenSource) exchange() (*oauth2.Token, error) {
+	jwt, err := appJWT(s.appID, s.key, s.now())
+	if err != nil {
+		return nil, err
+	}
+	endpoint := s.baseURL.ResolveReference(&url.URL{Path: fmt.Sprintf("app/installations/%d/access_tokens", s.installationID)})
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if message := strings.TrimSpace(string(body)); len(message) > 0 {
+			return nil, fmt.Errorf("%s responded with %s: %s", endpoint, resp.Status, message)
+		}
+		return nil, fmt.Errorf("%s responded with %s", endpoint, resp.Status)
+	}
+	var installationToken struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&installationToken); err != nil {
+		return nil, fmt.Errorf("unable to decode the installation token: %v", err)
+	}
+	if len(installationToken.Token) == 0 {
+		return nil, fmt.Errorf("%s responded without a token", endpoint)
+	}
+	logVerbose("Github App installation token expires %s", formatTime(installationToken.ExpiresAt))
+	return &oauth2.Token{AccessToken: installationToken.Token, TokenType: "token", Expiry: installationToken.ExpiresAt.Add(-appTokenRefreshMargin)}, nil
+}
+
+// appAuth reports whether the client authenticates as a Github App installation instead of with a token.
+func (o *sharedOptions) appAuth() bool {
+	return o.appID != 0 || o.appInstallationID != 0 || len(o.appPrivateKeyFile) > 0
+}
+
+// appTokenSource returns the refreshed installation tokens of the -app-* flags, the first one is exchanged right
+// away so misconfigured flags fail before any other request.
+func (o *sharedOptions) appTokenSource() (oauth2.TokenSource, error) {
+	if o.appID == 0 || o.appInstallationID == 0 || len(o.appPrivateKeyFile) == 0 {
+		return nil, fmt.Errorf("-app-id, -app-installation-id and -app-private-key-file are required together")
+	}
+	if len(o.token) > 0 {
+		return nil, fmt.Errorf("-token and -app-id are mutually exclusive")
+	}
+	key, err := readAppPrivateKey(o.appPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	source, err := newAppTokenSource(o.apiURL, o.appID, o.appInstallationID, key)
+	if err != nil {
+		return nil, err
+	}
+	token, err := source.Token()
+	if err != nil {
+		return nil, fmt.Errorf(":-( unable to authenticate as Github App %d: %v", o.appID, err)
+	}
+	return oauth2.ReuseTokenSource(token, source), nil
+}
+
+// checkInstallationAccess verifies the installation can read the payload repositories, installation tokens can't
+// look up the authenticated user like checkToken does.
+func checkInstallationAccess(ctx context.Context, client *github.Client, installationID int64, repositories []string) error {
+	organization, name, ok := dominantOrganization(repositories)
+	if !ok {
+		return nil
+	}
+	_, resp, err := client.Repositories.Get(withCategory(ctx, categoryRepository), organization, name)
+	if err == nil {
+		return nil
+	}
+	if resp != nil && resp.Response != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf(":-( Github App installation %d can't read %s/%s, check the repositories the app is installed on in the %s organization", installationID, organization, name, organization)
+	}
+	return fmt.Errorf("unable to verify access to %s/%s: %v", organization, name, err)
+}
+
+// installationRequestLimit returns the hourly core rate limit of the installation, which grows with the number of
+// repositories and users of the organization unlike the fixed limit of tokens.
+func installationRequestLimit(ctx context.Context, client *github.Client) (int, error) {
+	limits, _, err := client.RateLimits(withCategory(ctx, categoryOther))
+	if err != nil {
+		return 0, err
+	}
+	if limits.GetCore() == nil {
+		return 0, fmt.Errorf("Github responded without the core rate limit")
+	}
+	return limits.GetCore().Limit, nil
+}
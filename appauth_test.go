@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeAppPrivateKey writes a new private key of a Github App, in the PKCS#1 PEM Github downloads.
+func writeAppPrivateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "app.pem")
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, file
+}
+
+// verifyAppJWT returns the claims of the JWT after verifying its RS256 signature.
+func verifyAppJWT(jwt string, key *rsa.PublicKey) (map[string]int64, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]int64{}
+	return claims, json.Unmarshal(data, &claims)
+}
+
+// fakeTokenExchange serves installation tokens of installation 42 of app 7 for JWTs signed by the key, the expiry
+// of the nth token is returned by expiry (n starts at 1) and its status by status (201 unless set).
+type fakeTokenExchange struct {
+	*httptest.Server
+	exchanges int32
+	expiry    func(n int) time.Time
+	status    func(n int) int
+}
+
+func newFakeTokenExchange(t *testing.T, key *rsa.PrivateKey) *fakeTokenExchange {
+	f := &fakeTokenExchange{expiry: func(int) time.Time { return time.Now().Add(time.Hour) }}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/app/installations/42/access_tokens" {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		claims, err := verifyAppJWT(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		if err != nil || claims["iss"] != 7 || claims["exp"]-claims["iat"] != int64((appJWTLifetime+time.Minute).Seconds()) {
+			t.Errorf("invalid JWT %v: %v", claims, err)
+		}
+		n := int(atomic.AddInt32(&f.exchanges, 1))
+		if f.status != nil && f.status(n) != http.StatusCreated {
+			w.WriteHeader(f.status(n))
+			fmt.Fprint(w, `{"message": "A JSON web token could not be decoded"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": %q}`, n, f.expiry(n).Format(time.RFC3339))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestReadAppPrivateKey(t *testing.T) {
+	key, file := writeAppPrivateKey(t)
+	if read, err := readAppPrivateKey(file); err != nil || !read.Equal(key) {
+		t.Errorf("expected the PKCS#1 key, got %v", err)
+	}
+
+	dir := t.TempDir()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, test := range map[string]struct {
+		content     []byte
+		expectedErr string
+	}{
+		"pkcs8": {content: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})},
+		"ec":    {content: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ec}), expectedErr: "expected a RSA private key"},
+		"text":  {content: []byte("not a key"), expectedErr: "no PEM private key found"},
+	} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, test.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readAppPrivateKey(file)
+		if len(test.expectedErr) == 0 && err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if len(test.expectedErr) > 0 && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, test.expectedErr, err)
+		}
+	}
+}
+
+func TestAppTokenSourceRefresh(t *testing.T) {
+	key, file := writeAppPrivateKey(t)
+	exchange := newFakeTokenExchange(t, key)
+	// the first token expires within the refresh margin, the next ones in an hour
+	exchange.expiry = func(n int) time.Time {
+		if n == 1 {
+			return time.Now().Add(appTokenRefreshMargin - time.Minute)
+		}
+		return time.Now().Add(time.Hour)
+	}
+	shared := &sharedOptions{appID: 7, appInstallationID: 42, appPrivateKeyFile: file, apiURL: exchange.URL}
+	tokens, err := shared.tokenSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&exchange.exchanges) != 1 {
+		t.Errorf("expected the first token exchanged right away, got %d exchanges", exchange.exchanges)
+	}
+
+	// the workers refresh the token once and all of them use the new one
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		issued = map[string]int{}
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tokens.Token()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			issued[token.AccessToken]++
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&exchange.exchanges) != 2 || issued["ghs_2"] != 20 {
+		t.Errorf("expected a single refresh used by all workers, got %d exchanges and tokens %v", exchange.exchanges, issued)
+	}
+}
+
+func TestAppTokenRefreshFailure(t *testing.T) {
+	key, file := writeAppPrivateKey(t)
+	exchange := newFakeTokenExchange(t, key)
+	exchange.expiry = func(int) time.Time { return time.Now() }
+	exchange.status = func(n int) int {
+		if n == 1 {
+			return http.StatusCreated
+		}
+		return http.StatusUnauthorized
+	}
+	shared := &sharedOptions{appID: 7, appInstallationID: 42, appPrivateKeyFile: file, apiURL: exchange.URL, skipTokenCheck: true}
+	client, err := shared.githubClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the expired token is refreshed before the request, which never reaches Github
+	_, _, err = client.Repositories.Get(withCategory(context.Background(), categoryRepository), "openshift", "api")
+	if !errors.Is(err, errAppTokenRefresh) || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Fatalf("expected the refresh to fail, got %v", err)
+	}
+	if !isAuthFailure(err) || classifyRepositoryError("openshift", err) != ErrorKindUnauthorized {
+		t.Errorf("expected the refresh failure to count as an authentication failure")
+	}
+
+	for name, options := range map[string]*sharedOptions{
+		"without the installation": {appID: 7, appPrivateKeyFile: file},
+		"with a token":             {appID: 7, appInstallationID: 42, appPrivateKeyFile: file, token: "fake-token"},
+	} {
+		if _, err := options.tokenSource(); err == nil {
+			t.Errorf("%s: expected the -app-* flags to be rejected", name)
+		}
+	}
+	exchange.status = func(int) int { return http.StatusNotFound }
+	if _, err := shared.tokenSource(); err == nil || !strings.Contains(err.Error(), "unable to authenticate as Github App 7") {
+		t.Errorf("expected the first exchange to fail, got %v", err)
+	}
+}
+
+func TestCollectAsGithubApp(t *testing.T) {
+	_, file := writeAppPrivateKey(t)
+	scenario := loadScenario(t, "normal")
+	github := newFakeGithub(t, append(scenario.Routes,
+		fakeRoute{Method: http.MethodPost, Path: "/app/installations/42/access_tokens", Status: http.StatusCreated, Body: json.RawMessage(`{"token": "ghs_1", "expires_at": "2099-01-01T00:00:00Z"}`)},
+		fakeRoute{Method: http.MethodGet, Path: "/rate_limit", Body: json.RawMessage(`{"resources": {"core": {"limit": 15000, "remaining": 15000, "reset": 1893456000}}}`)},
+	))
+	defer func(v bool) { verbose = v }(verbose)
+	dir := t.TempDir()
+	output := captureLog(t, func() {
+		if err := run([]string{
+			"collect",
+			"-release-info-file", scenario.writeRelease(t, dir),
+			"-github-api-url", github.URL,
+			"-app-id", "7",
+			"-app-installation-id", "42",
+			"-app-private-key-file", file,
+			"-format", formatJSON,
+			"-output", filepath.Join(dir, "output.json"),
+			"-since", "24h",
+			"-no-ignore",
+			"-v",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if github.countRequests("/app/installations/42/access_tokens") != 1 || github.countRequests("/user") != 0 {
+		t.Errorf("expected a single token exchange and no user lookup, got %v", github.Requests())
+	}
+	if !strings.Contains(output, "more than 15000 Github requests, the rate limit of the installation") {
+		t.Errorf("expected -max-requests to default to the installation limit, got:\n%s", output)
+	}
+}
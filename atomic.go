@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// defaultOutputFileMode is the mode of new output files, existing ones keep their mode unless -output-file-mode is set
+const defaultOutputFileMode os.FileMode = 0644
+
+// fileModeValue is a flag value of octal file permissions (eg. '0640'), zero when not set.
+type fileModeValue os.FileMode
+
+func (m *fileModeValue) String() string {
+	if *m == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#o", os.FileMode(*m))
+}
+
+func (m *fileModeValue) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return fmt.Errorf("invalid file mode %q, expected octal permissions (eg. '0640')", value)
+	}
+	*m = fileModeValue(mode)
+	return nil
+}
+
+// atomicFile is written into a temporary file in the directory of the target, which Close syncs and renames over
+// the target. An interrupted or failed write thus leaves the previous target untouched, the partial output is kept
+// in the temporary file and reported by Close.
+type atomicFile struct {
+	*os.File
+	path string
+	mode os.FileMode
+	// err is the first failed write
+	err error
+}
+
+// createAtomicFile creates the temporary file of the target, mode zero keeps the mode of an existing target. The
+// directory of the target is created when mkdirs is set.
+func createAtomicFile(path string, mode os.FileMode, mkdirs bool) (*atomicFile, error) {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if !mkdirs {
+			return nil, fmt.Errorf("unable to write %s, directory %s does not exist (use -mkdirs to create it)", path, dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if mode == 0 {
+		mode = defaultOutputFileMode
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path, mode: mode}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close replaces the target with the written file, unless a write failed.
+func (f *atomicFile) Close() error {
+	err := f.err
+	if err == nil {
+		err = f.File.Sync()
+	}
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), f.mode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write %s, it was left untouched and the partial output is in %s: %v", f.path, f.Name(), err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data into the file via a temporary file renamed over it.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := createAtomicFile(path, mode, false)
+	if err != nil {
+		return err
+	}
+	// a failed write is reported by Close
+	f.Write(data)
+	return f.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicFileInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := ioutil.WriteFile(path, []byte("previous report"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := createAtomicFile(path, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(`{"changes": [`)); err != nil {
+		t.Fatal(err)
+	}
+	// the write fails half way through the output
+	f.File.Close()
+	if _, err := f.Write([]byte(`{"sha": "553c207"}]}`)); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	err = f.Close()
+	if err == nil || !strings.Contains(err.Error(), "it was left untouched and the partial output is in "+f.Name()) {
+		t.Fatalf("expected the temporary file reported, got %v", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "previous report" {
+		t.Errorf("expected the previous report untouched, got %q: %v", data, err)
+	}
+	if partial, err := ioutil.ReadFile(f.Name()); err != nil || string(partial) != `{"changes": [` {
+		t.Errorf("expected the partial output kept, got %q: %v", partial, err)
+	}
+}
+
+func TestAtomicFileReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if err := ioutil.WriteFile(path, []byte("previous report"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the mode of the replaced file is kept
+	if err := writeFileAtomic(path, []byte("report"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the mode kept, got %v: %v", info, err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "report" {
+		t.Errorf("expected the file replaced, got %q: %v", data, err)
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("expected no temporary file left, got %d files: %v", len(files), err)
+	}
+
+	// the directory is only created with -mkdirs
+	shared := &sharedOptions{output: filepath.Join(dir, "reports", "4.9", "report.json")}
+	if _, err := shared.openOutput(); err == nil || !strings.Contains(err.Error(), "does not exist (use -mkdirs to create it)") {
+		t.Errorf("expected the missing directory to fail, got %v", err)
+	}
+	shared.mkdirs = true
+	if err := shared.outputMode.Set("0640"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := shared.openOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(shared.output); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("expected a new file with -output-file-mode, got %v: %v", info, err)
+	}
+}
+
+func TestFileModeValue(t *testing.T) {
+	var mode fileModeValue
+	if mode.String() != "" {
+		t.Errorf("expected no mode, got %q", mode.String())
+	}
+	for _, value := range []string{"0640", "640"} {
+		if err := mode.Set(value); err != nil || os.FileMode(mode) != 0640 || mode.String() != "0640" {
+			t.Errorf("%s: expected 0640, got %s: %v", value, mode.String(), err)
+		}
+	}
+	for _, value := range []string{"0", "rw-r--r--", "0999", "01777"} {
+		if err := mode.Set(value); err == nil {
+			t.Errorf("%s: expected an invalid mode", value)
+		}
+	}
+}
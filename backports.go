@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// cherryPickRobot is the account that opens the backport pull requests
+const cherryPickRobot = "openshift-cherrypick-robot"
+
+var backportTitleBranch = regexp.MustCompile(`^\[(release-[^\]]+)\]`)
+
+// Backport is a cherry-pick pull request of a change into another branch.
+type Backport struct {
+	Branch string `json:"branch"`
+	Number int    `json:"number"`
+	State  string `json:"state"`
+}
+
+func (b Backport) String() string {
+	return fmt.Sprintf("%s: %s", b.Branch, b.State)
+}
+
+type backportSearchResult struct {
+	Items []struct {
+		Number      int    `json:"number"`
+		Title       string `json:"title"`
+		State       string `json:"state"`
+		PullRequest struct {
+			MergedAt *time.Time `json:"merged_at"`
+		} `json:"pull_request"`
+	} `json:"items"`
+}
+
+// backportFinder searches for cherry-pick pull requests. The search API allows only 30
+// requests per minute (see throttlingTransport), so the results are cached by pull request
+// for the whole run.
+type backportFinder struct {
+	client *github.Client
+
+	lock  sync.Mutex
+	cache map[string][]Backport
+}
+
+func newBackportFinder(client *github.Client) *backportFinder {
+	return &backportFinder{
+		client: client,
+		cache:  map[string][]Backport{},
+	}
+}
+
+func (f *backportFinder) Find(ctx context.Context, organization, name string, number int) ([]Backport, error) {
+	key := fmt.Sprintf("%s/%s#%d", organization, name, number)
+	f.lock.Lock()
+	backports, ok := f.cache[key]
+	f.lock.Unlock()
+	if ok {
+		return backports, nil
+	}
+
+	query := fmt.Sprintf("repo:%s/%s is:pr author:%s in:body \"cherry-pick of #%d\"", organization, name, cherryPickRobot, number)
+	req, err := f.client.NewRequest("GET", "search/issues?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result backportSearchResult
+	if _, err := f.client.Do(withCategory(ctx, categorySearch), req, &result); err != nil {
+		return nil, err
+	}
+	for _, item := range result.Items {
+		match := backportTitleBranch.FindStringSubmatch(item.Title)
+		if match == nil {
+			continue
+		}
+		state := item.State
+		if item.PullRequest.MergedAt != nil {
+			state = "merged"
+		}
+		backports = append(backports, Backport{Branch: match[1], Number: item.Number, State: state})
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.cache[key] = backports
+	return backports, nil
+}
+
+func formatBackports(backports []Backport) string {
+	var r []string
+	for _, b := range backports {
+		r = append(r, b.String())
+	}
+	return strings.Join(r, "\n")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestBackportFinder(t *testing.T) {
+	searches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		searches++
+		if req.URL.Path != "/search/issues" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		if q := req.URL.Query().Get("q"); q != `repo:openshift/api is:pr author:openshift-cherrypick-robot in:body "cherry-pick of #42"` {
+			t.Errorf("unexpected query %q", q)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [
+			{"number": 43, "title": "[release-4.9] Bump the API", "state": "closed", "pull_request": {"merged_at": "2021-08-24T10:00:00Z"}},
+			{"number": 44, "title": "[release-4.8] Bump the API", "state": "open", "pull_request": {}},
+			{"number": 45, "title": "Bump the API", "state": "open", "pull_request": {}}
+		]}`)
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	finder := newBackportFinder(client)
+	for i := 0; i < 2; i++ {
+		backports, err := finder.Find(context.Background(), "openshift", "api", 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Backport{{Branch: "release-4.9", Number: 43, State: "merged"}, {Branch: "release-4.8", Number: 44, State: "open"}}
+		if !reflect.DeepEqual(backports, expected) {
+			t.Errorf("expected %+v, got %+v", expected, backports)
+		}
+	}
+	if searches != 1 {
+		t.Errorf("expected the backports of the pull request cached, got %d searches", searches)
+	}
+}
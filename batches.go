@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// batchMergeWindow is the longest gap between merges of one batch. Tide merges the pull requests of a batch
+// one after another, so pull requests merged by the same account closer to each other are one batch.
+const batchMergeWindow = time.Minute
+
+// assignBatches sets the batch of the changes of a single repository merged by pull requests. The batch ID is
+// the merge commit of the first pull request in the batch, a pull request merged alone is a batch on its own.
+// Squash and rebase merges don't have a merge commit shared by the batch, so only the merge times are compared.
+func assignBatches(raws []RawChange) {
+	type merge struct {
+		number   int
+		at       time.Time
+		by       string
+		commitID string
+	}
+	seen := map[int]bool{}
+	var merges []merge
+	for _, raw := range raws {
+		if raw.PullRequest == 0 || raw.MergedAt == nil || seen[raw.PullRequest] {
+			continue
+		}
+		seen[raw.PullRequest] = true
+		merges = append(merges, merge{number: raw.PullRequest, at: *raw.MergedAt, by: raw.MergedBy, commitID: raw.MergeCommit})
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].at.Before(merges[j].at) })
+
+	batches := map[int]string{}
+	var batch string
+	for i, m := range merges {
+		if i == 0 || m.by != merges[i-1].by || m.at.Sub(merges[i-1].at) > batchMergeWindow {
+			batch = m.commitID
+			if len(batch) == 0 {
+				batch = fmt.Sprintf("#%d", m.number)
+			}
+		}
+		batches[m.number] = batch
+	}
+	for i := range raws {
+		raws[i].BatchID = batches[raws[i].PullRequest]
+	}
+}
+
+// printChangesByBatch prints a table of changes for each batch, from the oldest, followed by changes not merged by pull requests.
+func printChangesByBatch(w io.Writer, changes []Change, wrap MessageWrap, trailers []string) {
+	type batch struct {
+		repository string
+		mergedAt   time.Time
+		pulls      map[int]bool
+		changes    []Change
+	}
+	var (
+		batches   []*batch
+		unbatched []Change
+	)
+	byID := map[string]*batch{}
+	for _, c := range changes {
+		if len(c.raw.BatchID) == 0 {
+			unbatched = append(unbatched, c)
+			continue
+		}
+		key := c.raw.Repository + "@" + c.raw.BatchID
+		b, ok := byID[key]
+		if !ok {
+			b = &batch{repository: c.raw.Repository, pulls: map[int]bool{}}
+			byID[key] = b
+			batches = append(batches, b)
+		}
+		if b.mergedAt.IsZero() || c.raw.MergedAt.Before(b.mergedAt) {
+			b.mergedAt = *c.raw.MergedAt
+		}
+		b.pulls[c.raw.PullRequest] = true
+		b.changes = append(b.changes, c)
+	}
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].mergedAt.Before(batches[j].mergedAt) })
+
+	for i, b := range batches {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(b.pulls) > 1 {
+			fmt.Fprintf(w, "%s merged together at %s: %d PRs\n", repositoryName(b.repository), formatTime(b.mergedAt), len(b.pulls))
+		} else {
+			fmt.Fprintf(w, "%s merged at %s: #%d\n", repositoryName(b.repository), formatTime(b.mergedAt), b.changes[0].raw.PullRequest)
+		}
+		printChanges(w, b.changes, wrap, trailers)
+	}
+	if len(unbatched) > 0 {
+		fmt.Fprintf(w, "\nNot merged by a pull request:\n")
+		printChanges(w, unbatched, wrap, trailers)
+	}
+}
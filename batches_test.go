@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssignBatches(t *testing.T) {
+	at := func(minutes, seconds int) *time.Time {
+		t := time.Date(2021, 8, 20, 14, minutes, seconds, 0, time.UTC)
+		return &t
+	}
+	raws := []RawChange{
+		// a three pull request Tide batch, the second pull request has two commits
+		{SHA: "a1", PullRequest: 101, MergedBy: "openshift-merge-robot", MergedAt: at(2, 0), MergeCommit: "m101"},
+		{SHA: "b1", PullRequest: 102, MergedBy: "openshift-merge-robot", MergedAt: at(2, 10), MergeCommit: "m102"},
+		{SHA: "b2", PullRequest: 102, MergedBy: "openshift-merge-robot", MergedAt: at(2, 10), MergeCommit: "m102"},
+		{SHA: "c1", PullRequest: 103, MergedBy: "openshift-merge-robot", MergedAt: at(2, 40), MergeCommit: "m103"},
+		// merged by a person right after the batch
+		{SHA: "d1", PullRequest: 104, MergedBy: "alice", MergedAt: at(2, 50), MergeCommit: "m104"},
+		// squash merged alone later, without a merge commit
+		{SHA: "e1", PullRequest: 105, MergedBy: "openshift-merge-robot", MergedAt: at(30, 0)},
+		// pushed directly
+		{SHA: "f1"},
+	}
+	assignBatches(raws)
+	var batches []string
+	for _, raw := range raws {
+		batches = append(batches, raw.BatchID)
+	}
+	if expected := []string{"m101", "m101", "m101", "m101", "m104", "#105", ""}; !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, batches)
+	}
+}
+
+func TestPrintChangesByBatch(t *testing.T) {
+	merged := time.Date(2021, 8, 20, 14, 2, 0, 0, time.UTC)
+	var changes []Change
+	for _, repository := range []string{"https://github.com/openshift/api", "https://github.com/openshift/oc"} {
+		for i, pull := range []int{101, 102, 103} {
+			mergedAt := merged.Add(time.Duration(i) * 10 * time.Second)
+			changes = append(changes, newChange(RawChange{Repository: repository, SHA: strings.Repeat("a", 40), Message: "Change", PullRequest: pull, MergedAt: &mergedAt, BatchID: "m101"}))
+		}
+	}
+	single := merged.Add(time.Hour)
+	changes = append(changes,
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: strings.Repeat("b", 40), Message: "Alone", PullRequest: 105, MergedAt: &single, BatchID: "#105"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: strings.Repeat("c", 40), Message: "Pushed"}),
+	)
+
+	var out bytes.Buffer
+	printChangesByBatch(&out, changes, MessageWrap{}, nil)
+	output := out.String()
+	// batches with the same merge commit in different repositories are separate
+	for _, expected := range []string{
+		"openshift/api merged together at 2021-08-20 14:02 UTC: 3 PRs",
+		"openshift/oc merged together at 2021-08-20 14:02 UTC: 3 PRs",
+		"openshift/api merged at 2021-08-20 15:02 UTC: #105",
+		"Not merged by a pull request:",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in:\n%s", expected, output)
+		}
+	}
+	if strings.Index(output, "#105") < strings.Index(output, "openshift/oc merged together") {
+		t.Errorf("expected the batches ordered by merge time:\n%s", output)
+	}
+}
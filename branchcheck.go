@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// branchCheckSample is the number of readable repositories the branch is probed in before the collection.
+const branchCheckSample = 5
+
+// checkBranch fails early when the branch exists in none of the first readable repositories, which is most likely
+// a typo, suggesting the closest release branch of these repositories instead. Repositories the token can't read
+// don't count, other errors skip the check as the collection reports them per repository.
+func checkBranch(ctx context.Context, client *github.Client, repositories []string, branch string) error {
+	ctx = withCategory(ctx, categoryBranches)
+	var probed []string
+	available := map[string]bool{}
+	for _, repository := range repositories {
+		if len(probed) == branchCheckSample {
+			break
+		}
+		organization, name, ok := parseRepositoryOrgName(repository)
+		if !ok {
+			continue
+		}
+		_, _, err := client.Repositories.GetBranch(ctx, organization, name, branch)
+		if err == nil {
+			return nil
+		}
+		if !isNotFound(err) {
+			logVerbose("[%s] unable to check branch %s, skipping the branch check: %v", repository, branch, err)
+			return nil
+		}
+		branches, err := listRepositoryBranches(ctx, client, organization, name)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			logVerbose("[%s] unable to list branches, skipping the branch check: %v", repository, err)
+			return nil
+		}
+		probed = append(probed, repositoryName(repository))
+		for _, b := range branches {
+			if strings.HasPrefix(b, "release-") || b == "master" || b == "main" {
+				available[b] = true
+			}
+		}
+	}
+	if len(probed) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf(":-( branch %q does not exist in %s", branch, strings.Join(probed, ", "))
+	var names []string
+	for b := range available {
+		names = append(names, b)
+	}
+	sort.Slice(names, func(i, j int) bool { return branchVersionLess(names[i], names[j]) })
+	if len(names) > 0 {
+		log.Printf("Release branches of these repositories: %s", strings.Join(names, ", "))
+		closest := closestNames(branch, append([]string{}, names...), 1)
+		message += fmt.Sprintf(", did you mean %q?", closest[0])
+	}
+	return fmt.Errorf("%s (use -no-branch-check to skip this check)", message)
+}
+
+func listRepositoryBranches(ctx context.Context, client *github.Client, organization, name string) ([]string, error) {
+	var branches []string
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Repositories.ListBranches(ctx, organization, name, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, branch := range page {
+			branches = append(branches, branch.GetName())
+		}
+		if resp.NextPage == 0 {
+			return branches, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeBranchesGithub serves repositories with master and release-4.8 to release-4.10 branches, openshift-priv
+// repositories can't be read and openshift/new only has main.
+func fakeBranchesGithub(t *testing.T) (*github.Client, *APIUsage) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/repos/"), "/")
+		switch {
+		case parts[0] == "openshift-priv" || len(parts) < 3 || parts[2] != "branches":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case len(parts) == 3 && parts[1] == "new":
+			fmt.Fprint(w, `[{"name": "main"}]`)
+		case len(parts) == 3:
+			fmt.Fprint(w, `[{"name": "master"}, {"name": "release-4.10"}, {"name": "release-4.8"}, {"name": "release-4.9"}, {"name": "feature-x"}]`)
+		case parts[1] != "new" && (parts[3] == "master" || parts[3] == "release-4.9"):
+			fmt.Fprintf(w, `{"name": %q}`, parts[3])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Branch not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	usage := NewAPIUsage(0)
+	client := github.NewClient(&http.Client{Transport: &countingTransport{base: http.DefaultTransport, usage: usage}})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, usage
+}
+
+func TestCheckBranch(t *testing.T) {
+	repositories := []string{"https://github.com/openshift-priv/api", "https://github.com/openshift/new", "https://github.com/openshift/api", "https://github.com/openshift/oc"}
+	tests := []struct {
+		branch, expected string
+	}{
+		{branch: "release-4.9"},
+		{branch: "relase-4.9", expected: `branch "relase-4.9" does not exist in openshift/new, openshift/api, openshift/oc, did you mean "release-4.9"?`},
+		{branch: "release4.10", expected: `did you mean "release-4.10"?`},
+		{branch: "release-4.8 ", expected: `did you mean "release-4.8"?`},
+		{branch: "mastr", expected: `did you mean "master"?`},
+	}
+	for _, test := range tests {
+		client, usage := fakeBranchesGithub(t)
+		var err error
+		output := captureLog(t, func() { err = checkBranch(context.Background(), client, repositories, test.branch) })
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.branch, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected) || !strings.Contains(err.Error(), "-no-branch-check")):
+			t.Errorf("%s: expected an error containing %q, got %v", test.branch, test.expected, err)
+		case len(test.expected) > 0 && !strings.Contains(output, "Release branches of these repositories: main, master, release-4.8, release-4.9, release-4.10"):
+			t.Errorf("%s: expected the release branches to be listed, got:\n%s", test.branch, output)
+		}
+		// the probe is accounted as branch requests
+		if requests := usage.Requests(); requests[categoryBranches] == 0 || len(requests) != 1 {
+			t.Errorf("%s: expected the requests in the %s category, got %v", test.branch, categoryBranches, requests)
+		}
+	}
+}
+
+func TestCheckBranchSample(t *testing.T) {
+	client, usage := fakeBranchesGithub(t)
+	var repositories []string
+	for i := 0; i < 10; i++ {
+		repositories = append(repositories, fmt.Sprintf("https://github.com/openshift/repository-%d", i))
+	}
+	var err error
+	captureLog(t, func() { err = checkBranch(context.Background(), client, repositories, "release-4.99") })
+	if err == nil || !strings.Contains(err.Error(), "repository-4,") || strings.Contains(err.Error(), "repository-5") {
+		t.Errorf("expected only the first %d repositories to be probed, got %v", branchCheckSample, err)
+	}
+	// a branch lookup and a listing of each probed repository
+	if requests := usage.Requests()[categoryBranches]; requests != 2*branchCheckSample {
+		t.Errorf("expected %d requests, got %d", 2*branchCheckSample, requests)
+	}
+
+	// no readable repository
+	captureLog(t, func() {
+		err = checkBranch(context.Background(), client, []string{"https://github.com/openshift-priv/api"}, "release-4.99")
+	})
+	if err != nil {
+		t.Errorf("expected the check to be skipped, got %v", err)
+	}
+}
+
+func TestNoBranchCheck(t *testing.T) {
+	client, _ := fakeBranchesGithub(t)
+	shared := &sharedOptions{concurrency: 1, skipTokenCheck: true}
+	repos := []string{"https://github.com/openshift/api"}
+	captureLog(t, func() {
+		query := &queryOptions{since: "1d", branch: "relase-4.9"}
+		if _, err := query.collect(context.Background(), client, shared, repos, nil); err == nil || !strings.Contains(err.Error(), `did you mean "release-4.9"?`) {
+			t.Errorf("expected the collection to fail early, got %v", err)
+		}
+		// the collection runs and reports the repository
+		query = &queryOptions{since: "1d", branch: "relase-4.9", noBranchCheck: true}
+		result, err := query.collect(context.Background(), client, shared, repos, nil)
+		if err != nil || len(result.Errors) != 1 {
+			t.Errorf("expected the repository error, got %+v: %v", result, err)
+		}
+	})
+}
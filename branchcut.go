@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+	"github.com/xxjwxc/gowp/workpool"
+)
+
+// BranchCutRepository is the readiness of a repository for a new release branch (see -branch-cut-check).
+type BranchCutRepository struct {
+	Repository string `json:"repository"`
+	// Missing is set when the repository has no release branch yet
+	Missing bool `json:"missing"`
+	// Ahead is the number of commits of the -branch that are not in the release branch
+	Ahead int `json:"ahead"`
+	// Protected is whether the release branch is protected, nil when not checked or not readable (see -check-protection)
+	Protected *bool `json:"protected,omitempty"`
+}
+
+// BranchCutReport is the output of -branch-cut-check.
+type BranchCutReport struct {
+	Payload      string                `json:"payload"`
+	Branch       string                `json:"branch"`
+	Base         string                `json:"base"`
+	Repositories []BranchCutRepository `json:"repositories"`
+	// Missing is the number of repositories without the branch, Ahead the commits of the base missing in all branches
+	Missing int `json:"missing"`
+	Ahead   int `json:"ahead"`
+	// Unprotected and ProtectionUnknown are set with -check-protection
+	Unprotected       int `json:"unprotected,omitempty"`
+	ProtectionUnknown int `json:"protectionUnknown,omitempty"`
+}
+
+// BranchCutRow is a row of the -branch-cut-check table.
+type BranchCutRow struct {
+	Repository string `header:"Repository"`
+	Branch     string `header:"Branch"`
+	Ahead      string `header:"Ahead"`
+	Protected  string `header:"Protected"`
+}
+
+// getBranchCut checks whether the release branch exists (cached, branches are not deleted during the branch cut)
+// and how many commits of the base branch it misses.
+func getBranchCut(ctx context.Context, client *github.Client, cache *Cache, organization, name, branch, base string, checkProtection bool) (BranchCutRepository, error) {
+	var readiness BranchCutRepository
+	if !cache.hasBranch(organization, name, branch) {
+		_, _, err := client.Repositories.GetBranch(withCategory(ctx, categoryBranches), organization, name, branch)
+		if isNotFound(err) {
+			if _, _, repositoryErr := client.Repositories.Get(withCategory(ctx, categoryRepository), organization, name); repositoryErr == nil {
+				readiness.Missing = true
+				return readiness, nil
+			}
+		}
+		if err != nil {
+			return readiness, err
+		}
+		cache.setBranch(organization, name, branch)
+	}
+	comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, branch, base)
+	if err != nil {
+		return readiness, err
+	}
+	readiness.Ahead = comparison.GetAheadBy()
+	if checkProtection {
+		readiness.Protected = getBranchProtected(ctx, client, organization, name, branch)
+	}
+	return readiness, nil
+}
+
+// getBranchProtected reads the protection of the branch, which needs admin read access to the repository: nil when
+// it is not readable.
+func getBranchProtected(ctx context.Context, client *github.Client, organization, name, branch string) *bool {
+	_, _, err := client.Repositories.GetBranchProtection(withCategory(ctx, categoryBranches), organization, name, branch)
+	if err != nil && responseStatus(err) != http.StatusNotFound {
+		logVerbose("[%s/%s] unable to read the protection of %s: %v", organization, name, branch, err)
+		return nil
+	}
+	// Github responds "Branch not protected" with 404 to branches that exist
+	protected := err == nil
+	return &protected
+}
+
+// newBranchCutReport sorts the repositories without the branch first, then by the most commits ahead.
+func newBranchCutReport(payload, branch, base string, repositories []BranchCutRepository, checkProtection bool) BranchCutReport {
+	sort.SliceStable(repositories, func(i, j int) bool {
+		a, b := repositories[i], repositories[j]
+		switch {
+		case a.Missing != b.Missing:
+			return a.Missing
+		case a.Ahead != b.Ahead:
+			return a.Ahead > b.Ahead
+		}
+		return a.Repository < b.Repository
+	})
+	report := BranchCutReport{Payload: payload, Branch: branch, Base: base, Repositories: repositories}
+	for _, r := range repositories {
+		report.Ahead += r.Ahead
+		switch {
+		case r.Missing:
+			report.Missing++
+		case !checkProtection:
+		case r.Protected == nil:
+			report.ProtectionUnknown++
+		case !*r.Protected:
+			report.Unprotected++
+		}
+	}
+	return report
+}
+
+func (r BranchCutReport) rows(checkProtection bool) []BranchCutRow {
+	var rows []BranchCutRow
+	for _, p := range r.Repositories {
+		row := BranchCutRow{Repository: repositoryName(p.Repository), Branch: "exists", Ahead: fmt.Sprintf("%d", p.Ahead)}
+		if p.Missing {
+			row.Branch, row.Ahead = "MISSING", ""
+		}
+		switch {
+		case p.Missing || !checkProtection:
+		case p.Protected == nil:
+			row.Protected = "unknown"
+		case *p.Protected:
+			row.Protected = "yes"
+		default:
+			row.Protected = "NO"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// summary is the totals line, eg. "3 of 120 repositories miss release-4.17, master is 45 commits ahead of it".
+func (r BranchCutReport) summary() string {
+	summary := fmt.Sprintf("%d of %d repositories miss %s, %s is %d commits ahead of it in the %d others", r.Missing, len(r.Repositories), r.Branch, r.Base, r.Ahead, len(r.Repositories)-r.Missing)
+	if r.Unprotected > 0 || r.ProtectionUnknown > 0 {
+		summary += fmt.Sprintf(", %d branches are not protected", r.Unprotected)
+	}
+	if r.ProtectionUnknown > 0 {
+		summary += fmt.Sprintf(" (the protection of %d is unknown)", r.ProtectionUnknown)
+	}
+	return summary
+}
+
+func writeBranchCutReport(w io.Writer, format string, report BranchCutReport, checkProtection bool) error {
+	switch format {
+	case formatTable:
+		tableprinter.New(w).Print(report.rows(checkProtection))
+		fmt.Fprintf(w, "\n%s\n", report.summary())
+		return nil
+	case formatMarkdown:
+		headers := []string{"Repository", "Branch", "Ahead"}
+		if checkProtection {
+			headers = append(headers, "Protected")
+		}
+		var rows [][]string
+		for _, r := range report.rows(checkProtection) {
+			row := []string{r.Repository, r.Branch, r.Ahead}
+			if checkProtection {
+				row = append(row, r.Protected)
+			}
+			rows = append(rows, row)
+		}
+		fmt.Fprintf(w, "## Readiness for %s\n\n", report.Branch)
+		writeMarkdownTable(w, headers, rows)
+		fmt.Fprintf(w, "\n%s\n", report.summary())
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q, -branch-cut-check supports %s, %s and %s", format, formatTable, formatMarkdown, formatJSON)
+	}
+}
+
+// runBranchCut reports which payload repositories miss the new release branch, and how far the -branch is ahead
+// of it in the others.
+func runBranchCut(ctx context.Context, shared *sharedOptions, o *queryOptions, branch string, checkProtection bool) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	processOptions, err := o.processOptions(shared)
+	if err != nil {
+		return err
+	}
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	release, err := o.release()
+	if err != nil {
+		return err
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	repositories, err := o.repositories(shared.sourceAnnotations, cache)
+	if err != nil {
+		return err
+	}
+	repositories = o.ignore.filterRepositories(repositories)
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+	if err := shared.checkToken(ctx, client, repositories); err != nil {
+		return err
+	}
+
+	log.Printf("Checking %s branch of %d repositories ...", branch, len(repositories))
+	var (
+		lock      sync.Mutex
+		readiness []BranchCutRepository
+		errs      []RepositoryError
+	)
+	wp := workpool.New(shared.concurrency)
+	for i := range repositories {
+		repository := repositories[i]
+		wp.Do(func() error {
+			organization, name, ok := parseRepositoryOrgName(repository)
+			if !ok {
+				return nil
+			}
+			r, err := getBranchCut(ctx, client, cache, organization, name, branch, processOptions.BranchName, checkProtection)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.Printf("[%s] %v", repository, err)
+				errs = append(errs, RepositoryError{Repository: repository, Kind: classifyRepositoryError(organization, err), Err: err})
+				return nil
+			}
+			r.Repository = repository
+			readiness = append(readiness, r)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		return err
+	}
+	if err := shared.saveCache(cache); err != nil {
+		return err
+	}
+
+	payload := o.payload
+	if label := newReleaseLabel(o.releaseSource(), release); len(o.releaseSource()) > 0 && len(label.Version) > 0 {
+		payload = label.Version
+	}
+	report := newBranchCutReport(payload, branch, processOptions.BranchName, readiness, checkProtection)
+	if report.ProtectionUnknown > 0 {
+		log.Printf("WARNING: unable to read the protection of %s in %d repositories, it needs a token with admin read access", branch, report.ProtectionUnknown)
+	}
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeBranchCutReport(out, shared.format, report, checkProtection); err != nil {
+		out.Close()
+		return err
+	}
+	printErrorSummary(errs)
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return repositoryErrorsResult(errs)
+}
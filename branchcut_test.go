@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeBranchCutGithub serves openshift/api with a protected release-4.17 branch 4 commits behind master,
+// openshift/oc with an unprotected one up to date, openshift/console with a branch whose protection can't be read
+// and openshift/origin without the branch.
+func fakeBranchCutGithub(t *testing.T) (*fakeGithub, *github.Client) {
+	notFound := json.RawMessage(`{"message": "Not Found"}`)
+	fake := newFakeGithub(t, []fakeRoute{
+		{Method: http.MethodGet, Path: "/repos/openshift/api/branches/release-4.17", Body: json.RawMessage(`{"name": "release-4.17"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/api/compare/release-4.17...master", Body: json.RawMessage(`{"status": "ahead", "ahead_by": 4}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/api/branches/release-4.17/protection", Body: json.RawMessage(`{}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/branches/release-4.17", Body: json.RawMessage(`{"name": "release-4.17"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/compare/release-4.17...master", Body: json.RawMessage(`{"status": "identical", "ahead_by": 0}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/branches/release-4.17/protection", Status: http.StatusNotFound, Body: json.RawMessage(`{"message": "Branch not protected"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/console/branches/release-4.17", Body: json.RawMessage(`{"name": "release-4.17"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/console/compare/release-4.17...master", Body: json.RawMessage(`{"status": "ahead", "ahead_by": 1}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/console/branches/release-4.17/protection", Status: http.StatusForbidden, Body: json.RawMessage(`{"message": "Resource not accessible by integration"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/origin/branches/release-4.17", Status: http.StatusNotFound, Body: notFound},
+		{Method: http.MethodGet, Path: "/repos/openshift/origin", Body: json.RawMessage(`{"name": "origin"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/secret/branches/release-4.17", Status: http.StatusNotFound, Body: notFound},
+		{Method: http.MethodGet, Path: "/repos/openshift/secret", Status: http.StatusNotFound, Body: notFound},
+	})
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(fake.URL + "/")
+	return fake, client
+}
+
+func TestGetBranchCut(t *testing.T) {
+	fake, client := fakeBranchCutGithub(t)
+	cache := NewCache()
+	readiness := map[string]BranchCutRepository{}
+	captureLog(t, func() {
+		for _, name := range []string{"api", "oc", "console", "origin"} {
+			r, err := getBranchCut(context.Background(), client, cache, "openshift", name, "release-4.17", "master", true)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			readiness[name] = r
+		}
+	})
+	if r := readiness["api"]; r.Missing || r.Ahead != 4 || r.Protected == nil || !*r.Protected {
+		t.Errorf("expected a protected branch 4 commits behind, got %+v", r)
+	}
+	if r := readiness["oc"]; r.Protected == nil || *r.Protected {
+		t.Errorf("expected an unprotected branch, got %+v", r)
+	}
+	if r := readiness["console"]; r.Protected != nil || r.Ahead != 1 {
+		t.Errorf("expected an unknown protection, got %+v", r)
+	}
+	if r := readiness["origin"]; !r.Missing {
+		t.Errorf("expected a missing branch, got %+v", r)
+	}
+	// a missing repository is an error, not a missing branch
+	if _, err := getBranchCut(context.Background(), client, cache, "openshift", "secret", "release-4.17", "master", false); err == nil {
+		t.Errorf("expected a missing repository to fail")
+	}
+
+	// existing branches are cached, missing ones are looked up again
+	if _, err := getBranchCut(context.Background(), client, cache, "openshift", "api", "release-4.17", "master", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.countRequests("/repos/openshift/api/branches/release-4.17"); n != 1 {
+		t.Errorf("expected the existing branch cached, got %d requests", n)
+	}
+	if !cache.hasBranch("openshift", "api", "release-4.17") || cache.hasBranch("openshift", "origin", "release-4.17") {
+		t.Errorf("expected only the existing branches cached, got %v", cache.branches)
+	}
+}
+
+func TestBranchCutReport(t *testing.T) {
+	protected, unprotected := true, false
+	report := newBranchCutReport("4.17.0-0.nightly", "release-4.17", "master", []BranchCutRepository{
+		{Repository: "https://github.com/openshift/oc", Protected: &unprotected},
+		{Repository: "https://github.com/openshift/api", Ahead: 4, Protected: &protected},
+		{Repository: "https://github.com/openshift/origin", Missing: true},
+		{Repository: "https://github.com/openshift/console", Ahead: 1},
+	}, true)
+	var order []string
+	for _, r := range report.Repositories {
+		order = append(order, repositoryName(r.Repository))
+	}
+	if strings.Join(order, ",") != "openshift/origin,openshift/api,openshift/console,openshift/oc" {
+		t.Errorf("expected the missing branches first, then the most commits ahead, got %v", order)
+	}
+	expected := "1 of 4 repositories miss release-4.17, master is 5 commits ahead of it in the 3 others, 1 branches are not protected (the protection of 1 is unknown)"
+	if summary := report.summary(); summary != expected {
+		t.Errorf("expected the summary\n%s\ngot\n%s", expected, summary)
+	}
+
+	var out bytes.Buffer
+	if err := writeBranchCutReport(&out, formatMarkdown, report, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"## Readiness for release-4.17", "| openshift/origin | MISSING |  |  |", "| openshift/oc | exists | 0 | NO |", "| openshift/console | exists | 1 | unknown |", expected} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+	out.Reset()
+	if err := writeBranchCutReport(&out, formatJSON, report, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded BranchCutReport
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Missing != 1 || decoded.Ahead != 5 || decoded.Unprotected != 1 || decoded.ProtectionUnknown != 1 || len(decoded.Repositories) != 4 {
+		t.Errorf("expected the full report in JSON, got %+v", decoded)
+	}
+	if err := writeBranchCutReport(&out, formatJUnit, report, true); err == nil || !strings.Contains(err.Error(), "-branch-cut-check supports") {
+		t.Errorf("expected an unsupported format to fail, got %v", err)
+	}
+}
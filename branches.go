@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v3"
+)
+
+// readRepositoryBranches reads the -repo-branches file, listing the branches of repositories (ORG/NAME) building
+// payload images from several branches, they are scanned on all of them instead of -branch:
+//
+//	branches:
+//	  openshift/oc: [release-4.9, master]
+func readRepositoryBranches(file string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var document struct {
+		Branches map[string][]string `yaml:"branches"`
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	branches := map[string][]string{}
+	for repository, names := range document.Branches {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s: no branches listed for %s", file, repository)
+		}
+		branches[repositoryName(strings.TrimSuffix(repository, "/"))] = names
+	}
+	return branches, nil
+}
+
+// branchWorkItem is a repository scanned on a branch.
+type branchWorkItem struct {
+	Repository string
+	Branch     string
+}
+
+// branchWorkItems returns a work item of each repository and branch to scan, the repositories of the overrides are
+// scanned on their branches and the other ones on the branch. Duplicate repositories yield one work item per branch.
+func branchWorkItems(repositories []string, branch string, overrides map[string][]string) []branchWorkItem {
+	var items []branchWorkItem
+	seen := map[branchWorkItem]bool{}
+	for _, repository := range repositories {
+		branches, ok := overrides[repositoryName(repository)]
+		if !ok {
+			branches = []string{branch}
+		}
+		for _, b := range branches {
+			item := branchWorkItem{Repository: repository, Branch: b}
+			if !seen[item] {
+				seen[item] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// workItemBranches groups the repositories of the work items by branch, the branch first.
+func workItemBranches(items []branchWorkItem, branch string) ([]string, map[string][]string) {
+	repositories := map[string][]string{}
+	var branches []string
+	for _, item := range items {
+		if _, ok := repositories[item.Branch]; !ok {
+			branches = append(branches, item.Branch)
+		}
+		repositories[item.Branch] = append(repositories[item.Branch], item.Repository)
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i] == branch && branches[j] != branch
+	})
+	return branches, repositories
+}
+
+// collectBranchWorkItems processes the repositories of each branch of the work items, one branch after the other,
+// onResult is called with the result of each work item. The changes of several branches record their branch and
+// are merged by mergeBranchChanges, with a single branch it is the stream of the repositories.
+func collectBranchWorkItems(ctx context.Context, client *github.Client, options ProcessOptions, items []branchWorkItem, onResult func(RepositoryResult)) ([]Change, []RepositoryError, error) {
+	branches, repositories := workItemBranches(items, options.BranchName)
+	if len(branches) == 1 {
+		options.BranchName = branches[0]
+		stream, err := CollectChangesStream(ctx, client, options, repositories[branches[0]])
+		if err != nil {
+			return nil, nil, err
+		}
+		return stream.collect(onResult)
+	}
+	var (
+		changes []Change
+		errs    []RepositoryError
+	)
+	for i, branch := range branches {
+		branchOptions := options
+		branchOptions.BranchName = branch
+		if i > 0 {
+			// completed repositories are recorded by their URL, only the first branch can be resumed
+			branchOptions.Resume = nil
+		}
+		if options.Compare != nil {
+			branchOptions.Compare = map[string]CompareRange{}
+			for repository, compare := range options.Compare {
+				if compare.Head == options.BranchName {
+					compare.Head = branch
+				}
+				branchOptions.Compare[repository] = compare
+			}
+		}
+		log.Printf("Processing %d repositories for commits in %s branch ...", len(repositories[branch]), branch)
+		stream, err := CollectChangesStream(ctx, client, branchOptions, repositories[branch])
+		if err != nil {
+			return nil, nil, err
+		}
+		branchChanges, branchErrs, err := stream.collect(func(result RepositoryResult) {
+			// the changes are annotated in place, so the collected ones have their branch too
+			for j := range result.Changes {
+				raw := result.Changes[j].raw
+				raw.Branches = []string{branch}
+				result.Changes[j] = newChange(raw)
+			}
+			if onResult != nil {
+				onResult(result)
+			}
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, branchChanges...)
+		for _, e := range branchErrs {
+			e.Err = fmt.Errorf("branch %s: %w", branch, e.Err)
+			errs = append(errs, e)
+		}
+	}
+	changes = mergeBranchChanges(changes)
+	if !options.Stream {
+		sortChanges(changes)
+	}
+	return changes, errs, nil
+}
+
+// mergeBranchChanges. With a single branch it is processRepositories.
+func processBranchWorkItems(ctx context.Context, client *github.Client, options ProcessOptions, items []branchWorkItem) ([]Change, []RepositoryError, error) {
+	branches, repositories := workItemBranches(items, options.BranchName)
+	if len(branches) == 1 {
+		options.BranchName = branches[0]
+		return processRepositories(ctx, client, options, repositories[branches[0]])
+	}
+	var (
+		changes []Change
+		errs    []RepositoryError
+	)
+	for i, branch := range branches {
+		branchOptions := options
+		branchOptions.BranchName = branch
+		if i > 0 {
+			// completed repositories are recorded by their URL, only the first branch can be resumed
+			branchOptions.Resume = nil
+		}
+		if options.Compare != nil {
+			branchOptions.Compare = map[string]CompareRange{}
+			for repository, compare := range options.Compare {
+				if compare.Head == options.BranchName {
+					compare.Head = branch
+				}
+				branchOptions.Compare[repository] = compare
+			}
+		}
+		log.Printf("Processing %d repositories for commits in %s branch ...", len(repositories[branch]), branch)
+		branchChanges, branchErrs, err := processRepositories(ctx, client, branchOptions, repositories[branch])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range branchChanges {
+			raw := c.raw
+			raw.Branches = []string{branch}
+			changes = append(changes, newChange(raw))
+		}
+		for _, e := range branchErrs {
+			e.Err = fmt.Errorf("branch %s: %w", branch, e.Err)
+			errs = append(errs, e)
+		}
+	}
+	changes = mergeBranchChanges(changes)
+	if !options.Stream {
+		sortChanges(changes)
+	}
+	return changes, errs, nil
+}
+
+// mergeBranchChanges shows a commit of a repository found on several branches once, listing all the branches.
+func mergeBranchChanges(changes []Change) []Change {
+	type key struct{ repository, sha string }
+	indexes := map[key]int{}
+	var result []Change
+	for _, c := range changes {
+		k := key{c.raw.Repository, c.raw.SHA}
+		i, ok := indexes[k]
+		if !ok {
+			indexes[k] = len(result)
+			result = append(result, c)
+			continue
+		}
+		raw := result[i].raw
+		raw.Branches = append(append([]string{}, raw.Branches...), c.raw.Branches...)
+		result[i] = newChange(raw)
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRepositoryBranches(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "branches.yaml")
+	if err := ioutil.WriteFile(file, []byte("branches:\n  openshift/oc: [release-4.9, master]\n  https://github.com/openshift/api/: [master]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	branches, err := readRepositoryBranches(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string][]string{"openshift/oc": {"release-4.9", "master"}, "openshift/api": {"master"}}; !reflect.DeepEqual(branches, expected) {
+		t.Errorf("expected %v, got %v", expected, branches)
+	}
+	if err := ioutil.WriteFile(file, []byte("branches:\n  openshift/oc: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRepositoryBranches(file); err == nil || !strings.Contains(err.Error(), "no branches listed for openshift/oc") {
+		t.Errorf("expected a repository without branches to fail, got %v", err)
+	}
+}
+
+func TestBranchWorkItems(t *testing.T) {
+	oc, api := "https://github.com/openshift/oc", "https://github.com/openshift/api"
+	items := branchWorkItems([]string{oc, api, oc}, "master", map[string][]string{"openshift/oc": {"release-4.9", "master"}})
+	expected := []branchWorkItem{{Repository: oc, Branch: "release-4.9"}, {Repository: oc, Branch: "master"}, {Repository: api, Branch: "master"}}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("expected %v, got %v", expected, items)
+	}
+	// the repositories of the default branch are processed first
+	branches, repositories := workItemBranches(items, "master")
+	if !reflect.DeepEqual(branches, []string{"master", "release-4.9"}) || !reflect.DeepEqual(repositories["master"], []string{oc, api}) || !reflect.DeepEqual(repositories["release-4.9"], []string{oc}) {
+		t.Errorf("unexpected branches %v with %v", branches, repositories)
+	}
+}
+
+func TestMergeBranchChanges(t *testing.T) {
+	oc, api := "https://github.com/openshift/oc", "https://github.com/openshift/api"
+	changes := mergeBranchChanges([]Change{
+		newChange(RawChange{Repository: oc, SHA: "a1", Branches: []string{"master"}}),
+		newChange(RawChange{Repository: oc, SHA: "a2", Branches: []string{"master"}}),
+		newChange(RawChange{Repository: oc, SHA: "a1", Branches: []string{"release-4.9"}}),
+		// the same SHA in another repository is another change
+		newChange(RawChange{Repository: api, SHA: "a1", Branches: []string{"release-4.9"}}),
+	})
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(changes))
+	}
+	if changes[0].Branches != "master\nrelease-4.9" || changes[1].Branches != "master" || changes[2].Branches != "release-4.9" {
+		t.Errorf("unexpected branches %q, %q and %q", changes[0].Branches, changes[1].Branches, changes[2].Branches)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "sync"
+
+// defaultAuthFailureLimit is the default number of consecutive repositories failing to authenticate that cancel the run
+const defaultAuthFailureLimit = 5
+
+// authBreaker trips when more than limit repositories in a row fail to authenticate (eg. the token was revoked
+// during the run), so the remaining repositories are not processed in vain.
+type authBreaker struct {
+	limit int
+
+	lock        sync.Mutex
+	consecutive int
+	tripped     bool
+}
+
+// Record records the result of a repository and reports whether it tripped the breaker.
+func (b *authBreaker) Record(err error) bool {
+	if b.limit <= 0 {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !isAuthFailure(err) {
+		b.consecutive = 0
+		return false
+	}
+	b.consecutive++
+	if b.tripped || b.consecutive <= b.limit {
+		return false
+	}
+	b.tripped = true
+	return true
+}
+
+func (b *authBreaker) Tripped() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.tripped
+}
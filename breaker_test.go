@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// githubError returns the error go-github returns for a response with the status and headers.
+func githubError(t *testing.T, status int, header http.Header) error {
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/openshift/api/commits", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return github.CheckResponse(&http.Response{StatusCode: status, Header: header, Request: req, Body: ioutil.NopCloser(strings.NewReader(`{"message": "Forbidden"}`))})
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	reset := fmt.Sprint(time.Now().Add(time.Hour).Unix())
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "unauthorized", err: githubError(t, http.StatusUnauthorized, nil), expected: true},
+		{name: "forbidden", err: githubError(t, http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"4000"}}), expected: true},
+		{name: "wrapped", err: fmt.Errorf("listing commits: %w", githubError(t, http.StatusUnauthorized, nil)), expected: true},
+		{name: "rate limit", err: githubError(t, http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {reset}})},
+		{name: "secondary rate limit", err: githubError(t, http.StatusForbidden, http.Header{"Retry-After": {"60"}})},
+		{name: "not found", err: githubError(t, http.StatusNotFound, nil)},
+		{name: "IP allow list", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden}, Message: "the `openshift-priv` organization has an IP allow list enabled"}},
+		{name: "other", err: errors.New("connection reset")},
+		{name: "nil"},
+	}
+	for _, test := range tests {
+		if failure := isAuthFailure(test.err); failure != test.expected {
+			t.Errorf("%s: expected %v, got %v (%v)", test.name, test.expected, failure, test.err)
+		}
+	}
+}
+
+func TestAuthBreaker(t *testing.T) {
+	unauthorized := githubError(t, http.StatusUnauthorized, nil)
+	breaker := &authBreaker{limit: 2}
+	// a repository processed in between resets the count
+	for i, err := range []error{unauthorized, unauthorized, nil, unauthorized, unauthorized} {
+		if breaker.Record(err) {
+			t.Fatalf("%d: unexpected trip", i)
+		}
+	}
+	if !breaker.Record(unauthorized) || !breaker.Tripped() {
+		t.Errorf("expected the third failure in a row to trip the breaker")
+	}
+	if breaker.Record(unauthorized) {
+		t.Errorf("expected the breaker to trip only once")
+	}
+
+	disabled := &authBreaker{}
+	for i := 0; i < 10; i++ {
+		if disabled.Record(unauthorized) {
+			t.Fatalf("expected a disabled breaker not to trip")
+		}
+	}
+}
+
+// fakeRevokedGithub serves a commit of openshift/api, every other repository responds with the status, headers and
+// message.
+func fakeRevokedGithub(t *testing.T, status int, header http.Header, message string) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/commits":
+			fmt.Fprintf(w, `[{"sha": "a1", "commit": {"message": "Bump the API", "committer": {"date": %q}}}]`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+		default:
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"message": %q}`, message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestAuthFailureLimit(t *testing.T) {
+	repositories := []string{"https://github.com/openshift/api"}
+	for i := 0; i < 6; i++ {
+		repositories = append(repositories, fmt.Sprintf("https://github.com/openshift/repository-%d", i))
+	}
+	options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", AuthFailureLimit: 2}
+	kinds := func(errs []RepositoryError) map[string]int {
+		counts := map[string]int{}
+		for _, e := range errs {
+			counts[e.Kind]++
+		}
+		return counts
+	}
+
+	var changes []Change
+	var errs []RepositoryError
+	output := captureLog(t, func() {
+		var err error
+		if changes, errs, err = processRepositories(context.Background(), fakeRevokedGithub(t, http.StatusUnauthorized, nil, "Bad credentials"), options, repositories); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(changes) != 1 {
+		t.Errorf("expected the changes collected before the breaker tripped, got %+v", changes)
+	}
+	if counts := kinds(errs); counts[ErrorKindUnauthorized] != 3 || counts[ErrorKindCanceled] != 3 {
+		t.Errorf("expected 3 unauthorized and 3 canceled repositories, got %v", counts)
+	}
+	if !strings.Contains(output, "More than 2 repositories in a row failed to authenticate") {
+		t.Errorf("expected the breaker to be logged, got:\n%s", output)
+	}
+	for _, e := range errs {
+		if e.Kind == ErrorKindCanceled && !errors.Is(e, ErrCanceled) {
+			t.Errorf("expected the canceled error to match ErrCanceled, got %v", e)
+		}
+	}
+	var exit *exitError
+	if err := repositoryErrorsResult(errs); !errors.As(err, &exit) || exit.code != exitCodeAuthFailure {
+		t.Errorf("expected the exit code %d, got %v", exitCodeAuthFailure, err)
+	}
+
+	// rate limits are not authentication failures, all repositories are processed
+	reset := fmt.Sprint(time.Now().Add(time.Hour).Unix())
+	captureLog(t, func() {
+		var err error
+		client := fakeRevokedGithub(t, http.StatusForbidden, http.Header{"X-Ratelimit-Limit": {"5000"}, "X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {reset}}, "API rate limit exceeded for 127.0.0.1.")
+		if _, errs, err = processRepositories(context.Background(), client, options, repositories); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if counts := kinds(errs); counts[ErrorKindRateLimited] != 6 || counts[ErrorKindCanceled] != 0 {
+		t.Errorf("expected 6 rate limited repositories, got %v", counts)
+	}
+
+	// 403 of a token without access (eg. SSO enforcement) trips the breaker too
+	captureLog(t, func() {
+		var err error
+		if _, errs, err = processRepositories(context.Background(), fakeRevokedGithub(t, http.StatusForbidden, nil, "Resource protected by organization SAML enforcement"), options, repositories); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if counts := kinds(errs); counts[ErrorKindCanceled] != 3 {
+		t.Errorf("expected 3 canceled repositories, got %v", counts)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Cache keeps payload extraction and Github responses around, so multiple queries
+// executed in one run (eg. jobs) that share repositories don't repeat the requests.
+type Cache struct {
+	lock sync.Mutex
+
+	payloads map[string][]string
+	parents  map[string]*github.Repository
+	commits  map[string]cachedCommits
+
+	codeowners map[string]string
+	orgRepos   map[string]cachedOrgRepositories
+	// goMods are go.mod files at commits, which never change
+	goMods map[string]string
+	// cveSeverities are the severities of CVEs by the Red Hat Security Data API
+	cveSeverities map[string]cachedCVESeverity
+	// revertedCommits are commits fetched by -incident-window, which never change
+	revertedCommits map[string]*github.RepositoryCommit
+
+	// skippedTags are the payload tags skipped without a source repository, by the key of payloads
+	skippedTags map[string][]SkippedTag
+	// branches are the branches known to exist (see -branch-cut-check)
+	branches map[string]bool
+}
+
+type cachedCVESeverity struct {
+	Fetched  time.Time `json:"fetched"`
+	Severity string    `json:"severity"`
+}
+
+type cachedOrgRepositories struct {
+	Fetched      time.Time `json:"fetched"`
+	Repositories []string  `json:"repositories"`
+}
+
+// cachedCommitsTTL limits how long commits persisted in the cache file are reused, as they
+// don't include commits merged after they were fetched.
+const cachedCommitsTTL = 10 * time.Minute
+
+type cachedCommits struct {
+	Since   time.Time                  `json:"since"`
+	Fetched time.Time                  `json:"fetched"`
+	Commits []*github.RepositoryCommit `json:"commits"`
+}
+
+type cacheFile struct {
+	Payloads map[string][]string           `json:"payloads"`
+	Parents  map[string]*github.Repository `json:"parents"`
+	Commits  map[string]cachedCommits      `json:"commits"`
+
+	Codeowners map[string]string                `json:"codeowners"`
+	OrgRepos   map[string]cachedOrgRepositories `json:"orgRepos"`
+	GoMods     map[string]string                `json:"goMods,omitempty"`
+
+	CVESeverities   map[string]cachedCVESeverity        `json:"cveSeverities,omitempty"`
+	RevertedCommits map[string]*github.RepositoryCommit `json:"revertedCommits,omitempty"`
+
+	SkippedTags map[string][]SkippedTag `json:"skippedTags,omitempty"`
+	Branches    map[string]bool         `json:"branches,omitempty"`
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		payloads: map[string][]string{},
+		parents:  map[string]*github.Repository{},
+		commits:  map[string]cachedCommits{},
+
+		codeowners: map[string]string{},
+		orgRepos:   map[string]cachedOrgRepositories{},
+		goMods:     map[string]string{},
+
+		cveSeverities:   map[string]cachedCVESeverity{},
+		revertedCommits: map[string]*github.RepositoryCommit{},
+
+		skippedTags: map[string][]SkippedTag{},
+		branches:    map[string]bool{},
+	}
+}
+
+func (c *Cache) getPayload(payload string) ([]string, []SkippedTag, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	repositories, ok := c.payloads[payload]
+	return repositories, c.skippedTags[payload], ok
+}
+
+func (c *Cache) setPayload(payload string, repositories []string, skipped []SkippedTag) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.payloads[payload] = repositories
+	c.skippedTags[payload] = skipped
+}
+
+func (c *Cache) getParent(organization, name string) (*github.Repository, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	parent, ok := c.parents[organization+"/"+name]
+	return parent, ok
+}
+
+func (c *Cache) setParent(organization, name string, parent *github.Repository) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.parents[organization+"/"+name] = parent
+}
+
+func (c *Cache) getCodeowners(organization, name, branch string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	content, ok := c.codeowners[organization+"/"+name+"@"+branch]
+	return content, ok
+}
+
+func (c *Cache) setCodeowners(organization, name, branch, content string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.codeowners[organization+"/"+name+"@"+branch] = content
+}
+
+func (c *Cache) getGoMod(organization, name, commit string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	content, ok := c.goMods[organization+"/"+name+"@"+commit]
+	return content, ok
+}
+
+func (c *Cache) setGoMod(organization, name, commit, content string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.goMods[organization+"/"+name+"@"+commit] = content
+}
+
+func (c *Cache) getOrgRepositories(query string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.orgRepos[query]
+	if !ok || time.Since(cached.Fetched) > cachedOrgRepositoriesTTL {
+		return nil, false
+	}
+	return cached.Repositories, true
+}
+
+func (c *Cache) setOrgRepositories(query string, repositories []string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.orgRepos[query] = cachedOrgRepositories{Fetched: time.Now(), Repositories: repositories}
+}
+
+// getCommits returns cached commits when the cached window covers the requested one.
+func (c *Cache) getCommits(organization, name, branch string, since time.Time) ([]*github.RepositoryCommit, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.commits[organization+"/"+name+"@"+branch]
+	if !ok || cached.Since.After(since) {
+		return nil, false
+	}
+	var commits []*github.RepositoryCommit
+	for _, commit := range cached.Commits {
+		if commitDate(commit).Before(since) {
+			continue
+		}
+		commits = append(commits, commit)
+	}
+	return commits, true
+}
+
+func (c *Cache) setCommits(organization, name, branch string, since time.Time, commits []*github.RepositoryCommit) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := organization + "/" + name + "@" + branch
+	if cached, ok := c.commits[key]; ok && cached.Since.Before(since) {
+		return
+	}
+	c.commits[key] = cachedCommits{Since: since, Fetched: time.Now(), Commits: commits}
+}
+
+// findCommits returns the cached commits of any branch matching the SHA or its prefix, by repository (ORG/NAME),
+// regardless of their age.
+func (c *Cache) findCommits(sha string) map[string]*github.RepositoryCommit {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	found := map[string]*github.RepositoryCommit{}
+	for key, cached := range c.commits {
+		for _, commit := range cached.Commits {
+			if strings.HasPrefix(commit.GetSHA(), sha) {
+				found[strings.SplitN(key, "@", 2)[0]] = commit
+			}
+		}
+	}
+	return found
+}
+
+func (c *Cache) getCVESeverity(cve string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.cveSeverities[cve]
+	if !ok || time.Since(cached.Fetched) > cachedCVESeverityTTL {
+		return "", false
+	}
+	return cached.Severity, true
+}
+
+func (c *Cache) setCVESeverity(cve, severity string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cveSeverities[cve] = cachedCVESeverity{Fetched: time.Now(), Severity: severity}
+}
+
+func (c *Cache) getRevertedCommit(organization, name, sha string) (*github.RepositoryCommit, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	commit, ok := c.revertedCommits[organization+"/"+name+"@"+sha]
+	return commit, ok
+}
+
+func (c *Cache) setRevertedCommit(organization, name, sha string, commit *github.RepositoryCommit) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.revertedCommits[organization+"/"+name+"@"+sha] = commit
+}
+
+func (c *Cache) hasBranch(organization, name, branch string) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.branches[organization+"/"+name+"@"+branch]
+}
+
+func (c *Cache) setBranch(organization, name, branch string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.branches[organization+"/"+name+"@"+branch] = true
+}
+
+// loadCache reads the cache persisted by Save, a missing file results in an empty cache.
+func loadCache(path string) (*Cache, error) {
+	c := NewCache()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for k, v := range f.Payloads {
+		c.payloads[k] = v
+	}
+	for k, v := range f.Parents {
+		c.parents[k] = v
+	}
+	for k, v := range f.Codeowners {
+		c.codeowners[k] = v
+	}
+	for k, v := range f.OrgRepos {
+		c.orgRepos[k] = v
+	}
+	for k, v := range f.GoMods {
+		c.goMods[k] = v
+	}
+	for k, v := range f.CVESeverities {
+		c.cveSeverities[k] = v
+	}
+	for k, v := range f.RevertedCommits {
+		c.revertedCommits[k] = v
+	}
+	for k, v := range f.SkippedTags {
+		c.skippedTags[k] = v
+	}
+	for k, v := range f.Branches {
+		c.branches[k] = v
+	}
+	for k, v := range f.Commits {
+		if time.Since(v.Fetched) > cachedCommitsTTL {
+			continue
+		}
+		c.commits[k] = v
+	}
+	return c, nil
+}
+
+func (c *Cache) Save(path string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, err := json.Marshal(cacheFile{Payloads: c.payloads, Parents: c.parents, Commits: c.commits, Codeowners: c.codeowners, OrgRepos: c.orgRepos, GoMods: c.goMods, CVESeverities: c.cveSeverities, RevertedCommits: c.revertedCommits, SkippedTags: c.skippedTags, Branches: c.branches})
+	if err != nil {
+		return err
+	}
+	// an interrupted run does not leave a truncated cache behind
+	return writeFileAtomic(path, data, 0)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCacheSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	since := time.Now().Add(-24 * time.Hour)
+	cache := NewCache()
+	cache.setPayload("4.9.0-0.nightly", []string{"https://github.com/openshift/oc"}, []SkippedTag{{Name: "pod", Reason: skippedNoAnnotation}})
+	cache.setCommits("openshift", "oc", "master", since, []*github.RepositoryCommit{{SHA: github.String("553c2077f0edc3d5dc5d17262f6aa498e69d6f8e")}})
+	cache.setCVESeverity("CVE-2023-44487", "Important")
+	if err := cache.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repositories, skipped, ok := loaded.getPayload("4.9.0-0.nightly"); !ok || len(repositories) != 1 || len(skipped) != 1 {
+		t.Errorf("expected the payload in the loaded cache, got %v and skipped tags %v", repositories, skipped)
+	}
+	if _, ok := loaded.getCommits("openshift", "oc", "master", since); !ok {
+		t.Errorf("expected the commits in the loaded cache")
+	}
+	if severity, ok := loaded.getCVESeverity("CVE-2023-44487"); !ok || severity != "Important" {
+		t.Errorf("expected the CVE severity in the loaded cache, got %q", severity)
+	}
+
+	// the commits fetched before the TTL are not reused, they miss the commits merged since
+	var f cacheFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	for key, commits := range f.Commits {
+		commits.Fetched = time.Now().Add(-2 * cachedCommitsTTL)
+		f.Commits[key] = commits
+	}
+	if data, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = loadCache(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.getCommits("openshift", "oc", "master", since); ok {
+		t.Errorf("expected the expired commits dropped")
+	}
+	if _, _, ok := loaded.getPayload("4.9.0-0.nightly"); !ok {
+		t.Errorf("expected the payload kept")
+	}
+
+	// the cache is replaced by a rename, keeping the mode of the existing file and leaving no temporary file
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the mode of the cache kept, got %v: %v", info, err)
+	}
+	if files, err := ioutil.ReadDir(filepath.Dir(path)); err != nil || len(files) != 1 {
+		t.Errorf("expected only the cache, got %d files: %v", len(files), err)
+	}
+
+	// a missing file is an empty cache
+	if _, err := loadCache(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("expected an empty cache for a missing file, got %v", err)
+	}
+}
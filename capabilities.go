@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capability classes of payload repositories
+const (
+	capabilityCore  = "core"
+	capabilityOther = "other"
+	// capabilityPrefix prefixes the names of optional capabilities (eg. "capability:marketplace")
+	capabilityPrefix = "capability:"
+)
+
+// capabilityAnnotation names the optional cluster capabilities (eg. "marketplace", "openshift-samples") an image
+// belongs to, several capabilities are joined by '+' like in the manifests
+const capabilityAnnotation = "capability.openshift.io/name"
+
+// Capabilities returns the optional capabilities the tag image belongs to, from its annotations.
+func (t Tag) Capabilities() []string {
+	var capabilities []string
+	for _, name := range strings.Split(t.Annotations[capabilityAnnotation], "+") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			capabilities = append(capabilities, name)
+		}
+	}
+	return capabilities
+}
+
+// RepositoryCapabilities classifies each source repository by the annotations of its images: "core" when any of
+// them is an operator managed by the cluster version operator outside of optional capabilities,
+// "capability:NAME" (names joined by '+') when its images belong to optional capabilities, "other" otherwise.
+func (r *Release) RepositoryCapabilities(sourceAnnotations []string) map[string]string {
+	core := map[string]bool{}
+	capabilities := map[string]map[string]bool{}
+	for _, t := range r.Refs.Spec.Tags {
+		repository, _, _, ok := t.Source(sourceAnnotations)
+		if !ok {
+			continue
+		}
+		names := t.Capabilities()
+		if len(names) == 0 && t.Annotations[releaseOperatorAnnotation] == "true" {
+			core[repository] = true
+		}
+		if capabilities[repository] == nil {
+			capabilities[repository] = map[string]bool{}
+		}
+		for _, name := range names {
+			capabilities[repository][name] = true
+		}
+	}
+	classes := map[string]string{}
+	for repository, names := range capabilities {
+		switch {
+		case core[repository]:
+			classes[repository] = capabilityCore
+		case len(names) > 0:
+			var sorted []string
+			for name := range names {
+				sorted = append(sorted, name)
+			}
+			sort.Strings(sorted)
+			classes[repository] = capabilityPrefix + strings.Join(sorted, "+")
+		default:
+			classes[repository] = capabilityOther
+		}
+	}
+	return classes
+}
+
+// matchesCapability returns whether the class of a repository matches a -capability value: "core", "other" or
+// the name of a capability (case insensitive, "capability:" prefix optional).
+func matchesCapability(class, capability string) bool {
+	capability = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(capability), capabilityPrefix))
+	if !strings.HasPrefix(class, capabilityPrefix) {
+		return strings.EqualFold(class, capability)
+	}
+	for _, name := range strings.Split(strings.TrimPrefix(class, capabilityPrefix), "+") {
+		if strings.EqualFold(name, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCapabilityRepositories returns repositories whose class matches any of the capabilities, in the order of
+// repositories. A capability matching no repository fails with the capabilities of the payload.
+func filterCapabilityRepositories(repositories []string, classes map[string]string, capabilities []string) ([]string, error) {
+	known := map[string]bool{capabilityCore: true, capabilityOther: true}
+	for _, class := range classes {
+		for _, name := range strings.Split(strings.TrimPrefix(class, capabilityPrefix), "+") {
+			known[name] = true
+		}
+	}
+	for _, capability := range capabilities {
+		matched := false
+		for _, class := range classes {
+			if matchesCapability(class, capability) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			var names []string
+			for name := range known {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("no payload repository matches -capability %q, the payload has: %s", capability, strings.Join(names, ", "))
+		}
+	}
+	var result []string
+	for _, repository := range repositories {
+		class := classes[repository]
+		if len(class) == 0 {
+			class = capabilityOther
+		}
+		for _, capability := range capabilities {
+			if matchesCapability(class, capability) {
+				result = append(result, repository)
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepositoryCapabilities(t *testing.T) {
+	classes := readReleaseFixture(t, "capabilities.json").RepositoryCapabilities(defaultSourceAnnotations)
+	expected := map[string]string{
+		"https://github.com/openshift/cluster-version-operator":        "core",
+		"https://github.com/openshift/cluster-kube-apiserver-operator": "core",
+		"https://github.com/openshift/operator-marketplace":            "capability:marketplace",
+		"https://github.com/openshift/cluster-samples-operator":        "capability:openshift-samples",
+		"https://github.com/openshift/console-operator":                "capability:Console",
+		"https://github.com/openshift/insights-operator":               "capability:Insights",
+		"https://github.com/openshift/cluster-baremetal-operator":      "capability:MachineAPI+baremetal",
+		// repositories of images without the annotations are not dropped
+		"https://github.com/openshift/console": "other",
+		"https://github.com/openshift/oc":      "other",
+		"https://github.com/openshift/origin":  "other",
+	}
+	if !reflect.DeepEqual(classes, expected) {
+		t.Errorf("expected %v, got %v", expected, classes)
+	}
+}
+
+func TestMatchesCapability(t *testing.T) {
+	for _, test := range []struct {
+		class, capability string
+		expected          bool
+	}{
+		{class: "core", capability: "core", expected: true},
+		{class: "core", capability: "Core", expected: true},
+		{class: "other", capability: "core"},
+		{class: "capability:marketplace", capability: "marketplace", expected: true},
+		{class: "capability:marketplace", capability: "capability:marketplace", expected: true},
+		{class: "capability:Console", capability: "console", expected: true},
+		{class: "capability:MachineAPI+baremetal", capability: "baremetal", expected: true},
+		{class: "capability:marketplace", capability: "market"},
+		{class: "capability:marketplace", capability: "other"},
+	} {
+		if matched := matchesCapability(test.class, test.capability); matched != test.expected {
+			t.Errorf("%q of %q: expected %v, got %v", test.capability, test.class, test.expected, matched)
+		}
+	}
+}
+
+func TestFilterCapabilityRepositories(t *testing.T) {
+	release := readReleaseFixture(t, "capabilities.json")
+	repositories, _ := getRepositoriesFromRelease(release, defaultSourceAnnotations)
+	classes := release.RepositoryCapabilities(defaultSourceAnnotations)
+
+	filtered, err := filterCapabilityRepositories(repositories, classes, []string{"core", "marketplace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"https://github.com/openshift/cluster-version-operator", "https://github.com/openshift/cluster-kube-apiserver-operator", "https://github.com/openshift/operator-marketplace"}; !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("expected %v, got %v", expected, filtered)
+	}
+	// unclassified repositories are other
+	if filtered, err := filterCapabilityRepositories([]string{"https://github.com/openshift/api"}, classes, []string{"other"}); err != nil || len(filtered) != 1 {
+		t.Errorf("expected an unclassified repository kept by other, got %v: %v", filtered, err)
+	}
+	if _, err := filterCapabilityRepositories(repositories, classes, []string{"storage"}); err == nil || !strings.Contains(err.Error(), `no payload repository matches -capability "storage", the payload has: Console, Insights, MachineAPI, baremetal, core, marketplace, openshift-samples, other`) {
+		t.Errorf("expected an unknown capability to fail, got %v", err)
+	}
+}
+
+func TestCapabilityQuery(t *testing.T) {
+	o := &queryOptions{releaseInfoFile: filepath.Join("testdata", "release", "capabilities.json"), capabilities: repeatableList{"openshift-samples", "other"}}
+	var repositories []string
+	captureLog(t, func() {
+		var err error
+		if repositories, err = o.repositories(defaultSourceAnnotations, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if expected := []string{"https://github.com/openshift/cluster-samples-operator", "https://github.com/openshift/console", "https://github.com/openshift/oc", "https://github.com/openshift/origin"}; !reflect.DeepEqual(repositories, expected) {
+		t.Errorf("expected %v, got %v", expected, repositories)
+	}
+
+	changes, err := o.annotateCapabilities([]Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/cluster-samples-operator", Message: "Bump the samples"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", Message: "Bump the API"}),
+	}, defaultSourceAnnotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].Capability != "capability:openshift-samples" || changes[0].raw.Capability != changes[0].Capability || len(changes[1].Capability) > 0 {
+		t.Errorf("expected the class of the payload repository only, got %q and %q", changes[0].Capability, changes[1].Capability)
+	}
+	if unchanged, err := (&queryOptions{}).annotateCapabilities(changes[1:], defaultSourceAnnotations); err != nil || len(unchanged[0].Capability) > 0 {
+		t.Errorf("expected the changes not annotated without -show-capability, got %+v: %v", unchanged, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// commitLimit caps the commits listed per repository (-max-commits-per-repo) and in the whole run
+// (-max-total-commits). Once the total is reached no more pages are listed, but every repository still
+// lists its first page and the pages in flight are kept, so no repository is left out entirely.
+type commitLimit struct {
+	perRepository int
+	total         int
+
+	lock   sync.Mutex
+	listed int
+}
+
+// newCommitLimit returns nil when neither limit is set, a nil limit caps nothing.
+func newCommitLimit(perRepository, total int) *commitLimit {
+	if perRepository <= 0 && total <= 0 {
+		return nil
+	}
+	return &commitLimit{perRepository: perRepository, total: total}
+}
+
+func (l *commitLimit) add(commits int) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.listed += commits
+}
+
+// rollback takes back the commits of a listing that is retried, so its pages are not counted twice.
+func (l *commitLimit) rollback(commits int) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.listed -= commits
+}
+
+func (l *commitLimit) exhausted() bool {
+	if l == nil || l.total <= 0 {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.listed >= l.total
+}
+
+// capRepository trims the commits of a repository to the per repository limit, more is set when the listing
+// has more pages. lastPage is the last page according to the Link header of the first page.
+func (l *commitLimit) capRepository(commits []*github.RepositoryCommit, more bool, lastPage int) ([]*github.RepositoryCommit, *truncatedError) {
+	if l == nil || l.perRepository <= 0 || len(commits) < l.perRepository || (len(commits) == l.perRepository && !more) {
+		return commits, nil
+	}
+	return commits[:l.perRepository], newCapTruncation(fmt.Sprintf("-max-commits-per-repo %d reached", l.perRepository), len(commits), l.perRepository, lastPage)
+}
+
+// capListed caps commits listed all at once (from the cache or a git mirror), they count towards the total but
+// are never dropped by it.
+func (l *commitLimit) capListed(commits []*github.RepositoryCommit) ([]*github.RepositoryCommit, error) {
+	l.add(len(commits))
+	if capped, truncated := l.capRepository(commits, false, 0); truncated != nil {
+		return capped, truncated
+	}
+	return commits, nil
+}
+
+// newCapTruncation estimates the skipped commits from the last page, the estimate is at most a page too high
+// as the last page is rarely full.
+func newCapTruncation(reason string, listed, kept, lastPage int) *truncatedError {
+	total := listed
+	if estimate := lastPage * commitsPerPage; estimate > total {
+		total = estimate
+	}
+	return &truncatedError{reason: reason, capped: true, skipped: total - kept}
+}
+
+// skippedCommits returns the estimated number of commits a capped listing skipped, 0 for other errors.
+func skippedCommits(err error) int {
+	var truncated *truncatedError
+	if errors.As(err, &truncated) {
+		return truncated.skipped
+	}
+	return 0
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeCappedGithub serves openshift repositories with the given number of recent commits, in pages of 100 with
+// the Link headers.
+func fakeCappedGithub(t *testing.T, commits map[string]int) *github.Client {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/repos/openshift/"), "/")
+		total, ok := commits[parts[0]]
+		switch {
+		case ok && len(parts) == 1:
+			fmt.Fprintf(w, `{"name": %q, "fork": false}`, parts[0])
+		case ok && len(parts) == 2 && parts[1] == "commits":
+			page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			lastPage := (total + commitsPerPage - 1) / commitsPerPage
+			if page < lastPage {
+				w.Header().Set("Link", fmt.Sprintf(`<%[1]s/repos/openshift/%[2]s/commits?page=%[3]d>; rel="next", <%[1]s/repos/openshift/%[2]s/commits?page=%[4]d>; rel="last"`, server.URL, parts[0], page+1, lastPage))
+			}
+			var listed []string
+			for i := (page - 1) * commitsPerPage; i < total && i < page*commitsPerPage; i++ {
+				listed = append(listed, fmt.Sprintf(`{"sha": "%s%d", "commit": {"message": "Change %d of %s", "committer": {"date": %q}}}`, parts[0], i, i, parts[0], time.Now().Add(-time.Minute).Format(time.RFC3339)))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(listed, ","))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestMaxCommitsPerRepository(t *testing.T) {
+	client := fakeCappedGithub(t, map[string]int{"big": 350, "small": 50})
+	options := ProcessOptions{Concurrency: 2, BranchName: "master", Since: 24 * time.Hour, MaxCommitsPerRepository: 120}
+	for name, collect := range collectEntryPoints {
+		changes, errs, err := collect(context.Background(), client, options, []string{"https://github.com/openshift/big", "https://github.com/openshift/small"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 170 {
+			t.Errorf("%s: expected 120 changes of openshift/big and all 50 of openshift/small, got %d", name, len(changes))
+		}
+		// the skipped commits are estimated from the 4 pages of the Link header
+		if len(errs) != 1 || errs[0].Kind != ErrorKindTruncated || errs[0].Repository != "https://github.com/openshift/big" || skippedCommits(errs[0].Err) != 280 {
+			t.Errorf("%s: expected openshift/big truncated with 280 skipped commits, got %+v", name, errs)
+		}
+	}
+
+	// the repository results of the stream are marked
+	stream, err := CollectChangesStream(context.Background(), client, options, []string{"https://github.com/openshift/big", "https://github.com/openshift/small"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for result := range stream.Results() {
+		if truncated := result.Repository == "https://github.com/openshift/big"; result.Truncated != truncated || truncated && result.SkippedCommits != 280 {
+			t.Errorf("unexpected truncation of %s: %v with %d skipped commits", result.Repository, result.Truncated, result.SkippedCommits)
+		}
+	}
+	if err := stream.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxTotalCommits(t *testing.T) {
+	client := fakeCappedGithub(t, map[string]int{"a": 250, "b": 250})
+	options := ProcessOptions{Concurrency: 1, BranchName: "master", Since: 24 * time.Hour, MaxTotalCommits: 150}
+	changes, errs, err := processRepositories(context.Background(), client, options, []string{"https://github.com/openshift/a", "https://github.com/openshift/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first repository lists two pages before the total is reached, the second one still lists its first page
+	if len(changes) != 300 {
+		t.Errorf("expected 200 changes of openshift/a and 100 of openshift/b, got %d", len(changes))
+	}
+	skipped := map[string]int{}
+	for _, e := range errs {
+		if e.Kind != ErrorKindTruncated || !strings.Contains(e.Err.Error(), "-max-total-commits 150 reached") {
+			t.Errorf("unexpected error %v", e)
+		}
+		skipped[e.Repository] = skippedCommits(e.Err)
+	}
+	if len(skipped) != 2 || skipped["https://github.com/openshift/a"] != 100 || skipped["https://github.com/openshift/b"] != 200 {
+		t.Errorf("expected both repositories truncated, got %v", skipped)
+	}
+}
+
+func TestCommitLimitRetry(t *testing.T) {
+	// the second page fails once, the commits of the failed listing are not counted twice
+	client, requests := fakePaginatedGithub(t, 1)
+	limit := newCommitLimit(0, 1000)
+	commits, err := listAllCommits(context.Background(), client, "openshift", "api", github.CommitsListOptions{SHA: "master"}, nil, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 105 || requests(1) != 2 {
+		t.Fatalf("expected the 105 commits listed again, got %d", len(commits))
+	}
+	if limit.listed != 105 {
+		t.Errorf("expected 105 commits counted towards the total, got %d", limit.listed)
+	}
+
+	// counted twice the first page of the retry would reach the total
+	client, _ = fakePaginatedGithub(t, 1)
+	limit = newCommitLimit(0, 150)
+	commits, err = listAllCommits(context.Background(), client, "openshift", "api", github.CommitsListOptions{SHA: "master"}, nil, limit)
+	if err != nil || len(commits) != 105 || limit.listed != 105 {
+		t.Errorf("expected all 105 commits listed by the retry, got %d commits (%d counted): %v", len(commits), limit.listed, err)
+	}
+}
+
+func TestCapListed(t *testing.T) {
+	commits := make([]*github.RepositoryCommit, 5)
+	var limit *commitLimit
+	if capped, err := limit.capListed(commits); len(capped) != 5 || err != nil {
+		t.Errorf("expected no limit, got %d commits: %v", len(capped), err)
+	}
+	limit = newCommitLimit(3, 4)
+	capped, err := limit.capListed(commits)
+	if len(capped) != 3 || !isTruncated(err) || skippedCommits(err) != 2 {
+		t.Errorf("expected 3 commits with 2 skipped, got %d commits: %v", len(capped), err)
+	}
+	// commits listed all at once count towards the total
+	if !limit.exhausted() {
+		t.Errorf("expected the total reached by the 5 listed commits")
+	}
+}
+
+func TestStrictTruncation(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, maxRepoCommits: 120, strict: strict}
+		if err := query.validate(); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		var result *queryResult
+		captureLog(t, func() {
+			var err error
+			if result, err = query.collect(context.Background(), fakeCappedGithub(t, map[string]int{"big": 350}), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/big"}, NewCache()); err != nil {
+				t.Fatal(err)
+			}
+			if err := query.render(&out, formatJSON, result); err != nil {
+				t.Fatal(err)
+			}
+		})
+		var report jsonReport
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Metadata.SkippedCommits != 280 || len(report.Metadata.Truncated) != 1 {
+			t.Errorf("expected the skipped commits in the metadata, got %+v", report.Metadata)
+		}
+		if failed := result.Failed != nil; failed != strict {
+			t.Errorf("strict %v: unexpected result %v", strict, result.Failed)
+		} else if strict && !strings.Contains(result.Failed.Error(), "about 280 commits were skipped") {
+			t.Errorf("expected the skipped commits in the error, got %v", result.Failed)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// maxCommitFiles is the number of files Github lists for a commit, commits changing more files are incomplete
+const maxCommitFiles = 300
+
+// ChangedFile is a file changed by a commit.
+type ChangedFile struct {
+	Path      string `json:"path"`
+	Status    string `json:"status,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// formatFileCount renders the number of changed files, "≥N" when Github listed only a part of them.
+func formatFileCount(raw RawChange) string {
+	switch {
+	case raw.FilesIncomplete:
+		return fmt.Sprintf("≥%d", len(raw.Files))
+	case len(raw.Files) > 0:
+		return fmt.Sprintf("%d", len(raw.Files))
+	}
+	return ""
+}
+
+// validateFilesFilter reports an invalid -files-filter pattern before any request is made.
+func validateFilesFilter(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid -files-filter pattern %q: %v", pattern, err)
+	}
+	return nil
+}
+
+// filesFilter keeps only changes touching a file matching the pattern (see matchPath), and changes whose files
+// are not known: those that could not be fetched and those whose file list was cut by Github.
+type filesFilter struct {
+	pattern string
+}
+
+func (f filesFilter) Name() string {
+	return "files-filter"
+}
+
+func (f filesFilter) Keep(c Change) (bool, string) {
+	for _, file := range c.raw.Files {
+		if matchPath(f.pattern, file.Path) {
+			return true, ""
+		}
+	}
+	switch {
+	case len(c.raw.Files) == 0:
+		return true, ""
+	case c.raw.FilesIncomplete:
+		// the matching file may be among those Github did not list
+		return true, ""
+	}
+	return false, fmt.Sprintf("touches no file matching %q", f.pattern)
+}
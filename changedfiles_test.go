@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestFilesFilter(t *testing.T) {
+	files := func(paths ...string) []ChangedFile {
+		var changed []ChangedFile
+		for _, p := range paths {
+			changed = append(changed, ChangedFile{Path: p})
+		}
+		return changed
+	}
+	tests := []struct {
+		name       string
+		pattern    string
+		files      []ChangedFile
+		incomplete bool
+		keep       bool
+	}{
+		{name: "matching file", pattern: "pkg/operator/**", files: files("README.md", "pkg/operator/sync/sync.go"), keep: true},
+		{name: "directory itself", pattern: "pkg/operator/**", files: files("pkg/operator"), keep: true},
+		{name: "no matching file", pattern: "pkg/operator/**", files: files("README.md", "pkg/cmd/main.go")},
+		{name: "file name pattern", pattern: "*_types.go", files: files("vendor/github.com/openshift/api/config/v1/types_cluster_version.go", "api/v1/route_types.go"), keep: true},
+		{name: "nested directories", pattern: "pkg/**/*.go", files: files("pkg/a/b/c.go"), keep: true},
+		{name: "nested directories other extension", pattern: "pkg/**/*.go", files: files("pkg/a/b/c.yaml")},
+		{name: "unknown files", pattern: "pkg/operator/**", keep: true},
+		{name: "incomplete files", pattern: "pkg/operator/**", files: files("README.md"), incomplete: true, keep: true},
+	}
+	for _, test := range tests {
+		change := newChange(RawChange{Files: test.files, FilesIncomplete: test.incomplete})
+		if keep, _ := (filesFilter{pattern: test.pattern}).Keep(change); keep != test.keep {
+			t.Errorf("%s: expected %v, got %v", test.name, test.keep, keep)
+		}
+	}
+}
+
+func TestValidateFilesFilter(t *testing.T) {
+	if err := validateFilesFilter("pkg/[a-"); err == nil {
+		t.Errorf("expected an invalid pattern to fail")
+	}
+	if err := validateFilesFilter("pkg/**/*.go"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFilesFilterQuery(t *testing.T) {
+	query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, filesFilter: "vendor/**"}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var result *queryResult
+	captureLog(t, func() {
+		var err error
+		if result, err = query.collect(context.Background(), fakeFilesGithub(t), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api"}, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var out bytes.Buffer
+	if err := query.render(&out, formatJSON, result); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	// the change whose files could not be fetched is kept
+	files := map[string][]ChangedFile{}
+	for _, c := range report.Changes {
+		files[c.SHA] = c.Files
+	}
+	if len(files) != 2 || len(files["a1"]) != 1 || files["a1"][0].Path != "vendor/github.com/openshift/api/config/v1/types.go" || files["c3"] != nil {
+		t.Errorf("expected the vendoring and the unknown changes, got %+v", files)
+	}
+}
+
+func TestIncompleteChangedFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var files []string
+		for i := 0; i < maxCommitFiles; i++ {
+			files = append(files, fmt.Sprintf(`{"filename": "docs/%d.md", "status": "added", "additions": 1}`, i))
+		}
+		fmt.Fprintf(w, `{"sha": "a1", "files": [%s]}`, strings.Join(files, ","))
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	raws := []RawChange{{SHA: "a1"}}
+	newPathClassifier(client, defaultPathClasses, 0).classifyRawChanges(context.Background(), "https://github.com/openshift/api", "openshift", "api", raws)
+	if len(raws[0].Files) != maxCommitFiles || !raws[0].FilesIncomplete || raws[0].Files[0].Status != "added" || raws[0].Files[0].Additions != 1 {
+		t.Fatalf("expected the files marked incomplete, got %d files (incomplete %v)", len(raws[0].Files), raws[0].FilesIncomplete)
+	}
+	// the matching file may be one of those Github did not list
+	change := newChange(raws[0])
+	if keep, _ := (filesFilter{pattern: "pkg/**"}).Keep(change); !keep || change.Files != "≥300" {
+		t.Errorf("expected the change kept with ≥300 files, got %v with %q", keep, change.Files)
+	}
+	if count := formatFileCount(RawChange{Files: raws[0].Files[:2]}); count != "2" {
+		t.Errorf("unexpected count %q", count)
+	}
+}
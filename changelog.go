@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// changelogSHA matches full commit SHAs anywhere in a changelog (eg. in the commit URLs of its entries), so the
+// prose around the entries can be edited by hand
+var changelogSHA = regexp.MustCompile(`\b[0-9a-f]{40}\b`)
+
+// changelogSHAs returns the commits already listed in a changelog.
+func changelogSHAs(content []byte) map[string]bool {
+	shas := map[string]bool{}
+	for _, sha := range changelogSHA.FindAll(content, -1) {
+		shas[string(sha)] = true
+	}
+	return shas
+}
+
+// changelogHeader starts new changelog files.
+func changelogHeader(branch string) string {
+	if len(branch) == 0 {
+		return "# Changelog\n"
+	}
+	return fmt.Sprintf("# Changelog of %s\n", branch)
+}
+
+// changelogSection is a dated section of the changes not listed yet, by repository, empty when there are none.
+func changelogSection(date time.Time, payload string, changes []RawChange, listed map[string]bool) string {
+	repositories := map[string][]RawChange{}
+	for _, c := range changes {
+		if listed[c.SHA] {
+			continue
+		}
+		listed[c.SHA] = true
+		repositories[c.Repository] = append(repositories[c.Repository], c)
+	}
+	if len(repositories) == 0 {
+		return ""
+	}
+	var names []string
+	for repository := range repositories {
+		names = append(names, repository)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n## %s", date.UTC().Format("2006-01-02"))
+	if len(payload) > 0 {
+		fmt.Fprintf(&b, " (%s)", payload)
+	}
+	fmt.Fprintln(&b)
+	for _, repository := range names {
+		fmt.Fprintf(&b, "\n### %s\n\n", repositoryName(repository))
+		for _, c := range repositories[repository] {
+			fmt.Fprintf(&b, "* %s ([%s](%s)", markdownEscaper.Replace(commitSubject(c.Message)), shortSHA(c.SHA), changelogURL(c))
+			if pull, ok := changePullRequest(c); ok && pull > 0 {
+				fmt.Fprintf(&b, ", #%d", pull)
+			}
+			fmt.Fprintln(&b, ")")
+		}
+	}
+	return b.String()
+}
+
+// changelogURL is the link of an entry, it has to contain the full SHA the entry is deduplicated by.
+func changelogURL(c RawChange) string {
+	if strings.Contains(c.URL, c.SHA) {
+		return c.URL
+	}
+	return c.Repository + "/commit/" + c.SHA
+}
+
+// lockChangelog creates the lock file of the changelog, which fails while another run holds it. The returned
+// function removes it.
+func lockChangelog(path string) (func(), error) {
+	lock := path + ".lock"
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("changelog %s is locked by another run, remove %s if no run is in progress", path, lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() { os.Remove(lock) }, nil
+}
+
+// appendChangelog appends a section with the changes not listed in the changelog yet (see -changelog-file), the
+// file is created with a header on first use.
+func appendChangelog(path, branch, payload string, changes []Change, now time.Time, mkdirs bool) error {
+	if mkdirs {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+	unlock, err := lockChangelog(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		content = []byte(changelogHeader(branch))
+	case err != nil:
+		return err
+	}
+	var raw []RawChange
+	for _, c := range changes {
+		raw = append(raw, c.raw)
+	}
+	section := changelogSection(now, payload, raw, changelogSHAs(content))
+	if len(section) == 0 {
+		log.Printf("Changelog %s already lists all %d changes", path, len(changes))
+		return nil
+	}
+	content = append(bytes.TrimRight(content, "\n"), '\n')
+	if err := writeFileAtomic(path, append(content, section...), 0); err != nil {
+		return err
+	}
+	log.Printf("Appended %d changes to changelog %s", strings.Count(section, "\n* "), path)
+	return nil
+}
+
+// rewriteChangelog regenerates the changelog from saved raw outputs (see -changelog-rewrite), a section per run
+// from the oldest one, each with the changes not listed by the previous ones.
+func rewriteChangelog(path string, patterns []string, mkdirs bool) error {
+	var runs []*RawData
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		for _, match := range matches {
+			data, err := readRawData(match)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, data)
+		}
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no saved raw outputs match -changelog-rewrite %s", strings.Join(patterns, ","))
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Metadata.Created.Before(runs[j].Metadata.Created) })
+
+	if mkdirs {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+	unlock, err := lockChangelog(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content := changelogHeader(runs[len(runs)-1].Metadata.Branch)
+	listed := map[string]bool{}
+	for _, run := range runs {
+		var raw []RawChange
+		for _, c := range run.Changes() {
+			raw = append(raw, c.raw)
+		}
+		content += changelogSection(run.Metadata.Created, run.Metadata.Payload, raw, listed)
+	}
+	if err := writeFileAtomic(path, []byte(content), 0); err != nil {
+		return err
+	}
+	log.Printf("Rewrote changelog %s with %d changes of %d saved runs", path, len(listed), len(runs))
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyChangelog copies the changelog fixture into a temporary directory.
+func copyChangelog(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "changelog", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readChangelog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestChangelogSHAs(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "changelog", "hand-edited.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shas := changelogSHAs(data)
+	// the entries are found wherever the hand edits moved their full SHA, entries left with a short SHA are not
+	for _, sha := range []string{"553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "0d6a1c3e5b2f4a7c8d9e0f1a2b3c4d5e6f7a8b9c", "d6cd1e2bd19e03a81132a23b2025920577f84e37"} {
+		if !shas[sha] {
+			t.Errorf("expected %s listed, got %v", sha, shas)
+		}
+	}
+	if len(shas) != 3 {
+		t.Errorf("expected 3 listed changes, got %v", shas)
+	}
+}
+
+func TestAppendChangelog(t *testing.T) {
+	now := time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "d6cd1e2bd19e03a81132a23b2025920577f84e37", Message: "Fix oc login"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", URL: "https://github.com/openshift/oc/commit/762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix oc_logout *again*\n\nBody"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API (#12)"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0", Message: "Add a field", PullRequest: 14}),
+	}
+
+	path := copyChangelog(t, "hand-edited.md")
+	before := readChangelog(t, path)
+	captureLog(t, func() {
+		if err := appendChangelog(path, "release-4.9", "4.9.0-0.nightly-2021-08-18-123456", changes, now, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	content := readChangelog(t, path)
+	if !strings.HasPrefix(content, before) {
+		t.Fatalf("expected the hand edits kept, got:\n%s", content)
+	}
+	expected := `
+## 2021-08-18 (4.9.0-0.nightly-2021-08-18-123456)
+
+### openshift/api
+
+* Add a field ([a1b2c3d](https://github.com/openshift/api/commit/a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0), #14)
+
+### openshift/oc
+
+* Fix oc\_logout \*again\* ([7629413](https://github.com/openshift/oc/commit/762941318ee16e59dabbacb1b4049eec22f0d303))
+`
+	if section := content[len(before):]; section != expected {
+		t.Errorf("expected the section\n%s\ngot\n%s", expected, section)
+	}
+
+	// a second run with the same changes leaves the file alone
+	output := captureLog(t, func() {
+		if err := appendChangelog(path, "release-4.9", "", changes, now.Add(time.Hour), false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if readChangelog(t, path) != content || !strings.Contains(output, "already lists all 4 changes") {
+		t.Errorf("expected the changelog unchanged, got:\n%s", output)
+	}
+
+	// the file is created with a header on first use, its directory only with -mkdirs
+	path = filepath.Join(t.TempDir(), "changelogs", "CHANGELOG.md")
+	if err := appendChangelog(path, "master", "", changes[:1], now, false); err == nil {
+		t.Errorf("expected a missing directory to fail")
+	}
+	captureLog(t, func() {
+		if err := appendChangelog(path, "master", "", changes[:1], now, true); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if content := readChangelog(t, path); !strings.HasPrefix(content, "# Changelog of master\n\n## 2021-08-18\n\n### openshift/oc\n\n* Fix oc login") {
+		t.Errorf("expected a new changelog, got:\n%s", content)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file removed, got %v", err)
+	}
+}
+
+func TestChangelogLock(t *testing.T) {
+	path := copyChangelog(t, "hand-edited.md")
+	before := readChangelog(t, path)
+	unlock, err := lockChangelog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another run fails instead of writing the file
+	change := newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix oc logout"})
+	err = appendChangelog(path, "release-4.9", "", []Change{change}, time.Now(), false)
+	if err == nil || !strings.Contains(err.Error(), "is locked by another run, remove "+path+".lock") {
+		t.Errorf("expected the lock to fail the run, got %v", err)
+	}
+	if readChangelog(t, path) != before {
+		t.Errorf("expected the locked changelog unchanged")
+	}
+	unlock()
+	captureLog(t, func() {
+		if err := appendChangelog(path, "release-4.9", "", []Change{change}, time.Now(), false); err != nil {
+			t.Errorf("expected the changelog unlocked, got %v", err)
+		}
+	})
+}
+
+func TestRewriteChangelog(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 8, 16, 10, 0, 0, 0, time.UTC)
+	oc := "https://github.com/openshift/oc"
+	login := newChange(RawChange{Repository: oc, SHA: "d6cd1e2bd19e03a81132a23b2025920577f84e37", Message: "Fix oc login"})
+	logout := newChange(RawChange{Repository: oc, SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix oc logout"})
+	// the runs are read from the oldest, whatever their file names
+	for name, run := range map[string]struct {
+		created time.Time
+		changes []Change
+	}{
+		"a-second.json": {created: start.Add(24 * time.Hour), changes: []Change{logout, login}},
+		"b-first.json":  {created: start, changes: []Change{login}},
+	} {
+		data := newRawData(RawMetadata{Created: run.created, Branch: "release-4.9"}, []string{oc}, run.changes, nil)
+		if err := writeRawData(filepath.Join(dir, name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := copyChangelog(t, "hand-edited.md")
+	captureLog(t, func() {
+		if err := rewriteChangelog(path, []string{filepath.Join(dir, "*.json")}, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expected := `# Changelog of release-4.9
+
+## 2021-08-16
+
+### openshift/oc
+
+* Fix oc login ([d6cd1e2](https://github.com/openshift/oc/commit/d6cd1e2bd19e03a81132a23b2025920577f84e37))
+
+## 2021-08-17
+
+### openshift/oc
+
+* Fix oc logout ([7629413](https://github.com/openshift/oc/commit/762941318ee16e59dabbacb1b4049eec22f0d303))
+`
+	if content := readChangelog(t, path); content != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, content)
+	}
+	if err := rewriteChangelog(path, []string{filepath.Join(dir, "*.yaml")}, false); err == nil || !strings.Contains(err.Error(), "no saved raw outputs match") {
+		t.Errorf("expected no matching runs to fail, got %v", err)
+	}
+	if err := run([]string{"collect", "-changelog-rewrite", filepath.Join(dir, "*.json")}); err == nil || !strings.Contains(err.Error(), "-changelog-rewrite requires -changelog-file") {
+		t.Errorf("expected -changelog-rewrite without -changelog-file to fail, got %v", err)
+	}
+}
+
+func TestCollectChangelog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	out, _, err := runScenario(t, "normal", "-changelog-file", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := readChangelog(t, path)
+	if len(out.Changes) == 0 || !strings.HasPrefix(content, "# Changelog of master\n") {
+		t.Fatalf("expected a changelog of the changes, got:\n%s", content)
+	}
+	for _, c := range out.Changes {
+		if !strings.Contains(content, c.SHA) {
+			t.Errorf("expected %s in the changelog:\n%s", c.SHA, content)
+		}
+	}
+}
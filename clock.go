@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// maxClockSkew is the difference between the local and Github clocks worth warning about, as with
+// a local clock ahead of Github the -since window may start after the latest commits.
+const maxClockSkew = 2 * time.Minute
+
+// clockSkewTransport records how far the Github clock, from the Date header of the first response,
+// is ahead of the local clock.
+type clockSkewTransport struct {
+	base http.RoundTripper
+	now  func() time.Time
+
+	lock sync.Mutex
+	skew *time.Duration
+}
+
+func (t *clockSkewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent := t.now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		t.record(date, sent, t.now())
+	}
+	return resp, nil
+}
+
+// record compares the server time with the middle of the request, the Date header only has a precision of seconds.
+func (t *clockSkewTransport) record(server, sent, received time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.skew != nil {
+		return
+	}
+	skew := server.Sub(sent.Add(received.Sub(sent) / 2))
+	t.skew = &skew
+}
+
+// Skew returns the observed skew, false when there was no response yet.
+func (t *clockSkewTransport) Skew() (time.Duration, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.skew == nil {
+		return 0, false
+	}
+	return *t.skew, true
+}
+
+// measureClockSkew returns the skew observed by the transport, when no request was made yet (eg. -skip-token-check)
+// it asks for the rate limits, which don't count against them.
+func measureClockSkew(ctx context.Context, client *github.Client, t *clockSkewTransport) (time.Duration, error) {
+	if skew, ok := t.Skew(); ok {
+		return skew, nil
+	}
+	if _, _, err := client.RateLimits(withCategory(ctx, categoryOther)); err != nil {
+		return 0, err
+	}
+	if skew, ok := t.Skew(); ok {
+		return skew, nil
+	}
+	return 0, fmt.Errorf("Github response has no Date header")
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// warnClockSkew logs a prominent warning when the skew exceeds maxClockSkew.
+func warnClockSkew(skew time.Duration, trustServerTime bool) {
+	if absDuration(skew) <= maxClockSkew {
+		return
+	}
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
+	}
+	skew = absDuration(skew).Round(time.Second)
+	if trustServerTime {
+		log.Printf("WARNING: the local clock is %s %s Github, the window is computed using the Github time", skew, direction)
+		return
+	}
+	log.Printf("!!! WARNING: the local clock is %s %s Github, the -since window may miss or include extra changes. Fix the clock or use -trust-server-time.", skew, direction)
+}
+
+// windowStart returns the start of the window listing changes since the given duration, using the Github time
+// (the local time corrected by the skew) when trustServerTime is set.
+func windowStart(now time.Time, since, skew time.Duration, trustServerTime bool) time.Time {
+	if trustServerTime {
+		now = now.Add(skew)
+	}
+	return now.Add(-since)
+}
+
+// checkWindowStart fails when the window starts in the future according to Github, which would result in an
+// empty report (eg. the previous payload time is wrong or the local clock is far ahead).
+func checkWindowStart(start, now time.Time, skew time.Duration) error {
+	serverNow := now.Add(skew)
+	if start.After(serverNow) {
+		return fmt.Errorf("the window starts at %s, which is after the current Github time %s (local time %s), no changes can be listed",
+			start.UTC().Format(time.RFC3339), serverNow.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// dateTransport responds with the given Date header, the local clock advances by a second during each request.
+type dateTransport struct {
+	date  string
+	clock *time.Time
+}
+
+func (t *dateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	*t.clock = t.clock.Add(time.Second)
+	header := http.Header{}
+	if len(t.date) > 0 {
+		header.Set("Date", t.date)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestClockSkewTransport(t *testing.T) {
+	server := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		local    time.Time
+		date     string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "in sync", local: server.Add(-time.Second / 2), date: server.Format(http.TimeFormat), expected: 0, ok: true},
+		{name: "local clock ahead", local: server.Add(time.Hour - time.Second/2), date: server.Format(http.TimeFormat), expected: -time.Hour, ok: true},
+		{name: "local clock behind", local: server.Add(-5*time.Minute - time.Second/2), date: server.Format(http.TimeFormat), expected: 5 * time.Minute, ok: true},
+		{name: "no date", local: server},
+	}
+	for _, test := range tests {
+		clock := test.local
+		transport := &clockSkewTransport{base: &dateTransport{date: test.date, clock: &clock}, now: func() time.Time { return clock }}
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/", nil)
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the skew of the first response is measured from the middle of the request and kept, even though the local
+		// clock advanced
+		skew, ok := transport.Skew()
+		if ok != test.ok || skew != test.expected {
+			t.Errorf("%s: expected skew %s (%t), got %s (%t)", test.name, test.expected, test.ok, skew, ok)
+		}
+	}
+}
+
+func TestMeasureClockSkew(t *testing.T) {
+	serverTime := time.Now().Add(10 * time.Minute)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/rate_limit" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"resources": {}}`)
+	}))
+	defer server.Close()
+	transport := &clockSkewTransport{base: http.DefaultTransport, now: time.Now}
+	client := github.NewClient(&http.Client{Transport: transport})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	for i := 0; i < 2; i++ {
+		skew, err := measureClockSkew(context.Background(), client, transport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skew < 9*time.Minute || skew > 11*time.Minute {
+			t.Errorf("expected a skew of 10m, got %s", skew)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the skew to be measured once, got %d requests", requests)
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	now := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	// the local clock is an hour ahead of Github
+	skew := -time.Hour
+	if start := windowStart(now, 24*time.Hour, skew, false); !start.Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("expected the window to start a day before the local time, got %s", start)
+	}
+	if start := windowStart(now, 24*time.Hour, skew, true); !start.Equal(now.Add(-25 * time.Hour)) {
+		t.Errorf("expected the window to start a day before the Github time, got %s", start)
+	}
+
+	if err := checkWindowStart(now.Add(-time.Hour), now, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// a window starting 30 minutes before the local time is in the future for Github
+	err := checkWindowStart(now.Add(-30*time.Minute), now, skew)
+	if err == nil || !strings.Contains(err.Error(), "the window starts at 2021-08-20T09:30:00Z, which is after the current Github time 2021-08-20T09:00:00Z (local time 2021-08-20T10:00:00Z)") {
+		t.Errorf("expected both times in the error, got %v", err)
+	}
+}
+
+func TestWarnClockSkew(t *testing.T) {
+	tests := []struct {
+		skew            time.Duration
+		trustServerTime bool
+		expected        string
+	}{
+		{skew: time.Minute},
+		{skew: -2 * time.Minute},
+		{skew: -3 * time.Minute, expected: "!!! WARNING: the local clock is 3m0s ahead of Github"},
+		{skew: 3 * time.Minute, expected: "!!! WARNING: the local clock is 3m0s behind Github"},
+		{skew: 3 * time.Minute, trustServerTime: true, expected: "the window is computed using the Github time"},
+	}
+	for _, test := range tests {
+		output := captureLog(t, func() { warnClockSkew(test.skew, test.trustServerTime) })
+		switch {
+		case len(test.expected) == 0 && len(output) > 0:
+			t.Errorf("%s: unexpected warning %q", test.skew, output)
+		case !strings.Contains(output, test.expected):
+			t.Errorf("%s: expected %q, got %q", test.skew, test.expected, output)
+		}
+	}
+}
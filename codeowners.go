@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// codeownersLocations are the locations Github looks for the CODEOWNERS file, in order
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type codeownersRule struct {
+	pattern string
+	match   *regexp.Regexp
+	owners  []string
+}
+
+// codeownersPatternRegexp converts gitignore-style CODEOWNERS pattern to a regular expression
+// matching the file paths relative to the repository root.
+func codeownersPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	trimmed := strings.TrimSuffix(pattern, "/")
+	// patterns containing slash (other than trailing) are relative to the repository root
+	anchored := strings.Contains(trimmed, "/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(trimmed); i++ {
+		switch {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case trimmed[i] == '*':
+			expr.WriteString("[^/]*")
+		case trimmed[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(trimmed[i])))
+		}
+	}
+	// pattern matching a directory owns everything in it
+	expr.WriteString("(/.*)?$")
+	return regexp.Compile(expr.String())
+}
+
+func parseCodeowners(content string) []codeownersRule {
+	var rules []codeownersRule
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// "\#" is a literal hash, not a comment
+		match, err := codeownersPatternRegexp(strings.ReplaceAll(fields[0], `\#`, "#"))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, codeownersRule{pattern: fields[0], match: match, owners: fields[1:]})
+	}
+	return rules
+}
+
+// codeownersForPath returns owners of the path, the last matching rule wins.
+func codeownersForPath(rules []codeownersRule, path string) []string {
+	var owners []string
+	for _, rule := range rules {
+		if rule.match.MatchString(path) {
+			owners = rule.owners
+		}
+	}
+	return owners
+}
+
+// codeownersForPaths returns owners of all the paths, without duplicates.
+func codeownersForPaths(rules []codeownersRule, paths []string) []string {
+	var owners []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		for _, owner := range codeownersForPath(rules, path) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// rootCodeowners returns owners of the repository as a whole, which is the last rule matching
+// everything in the repository.
+func rootCodeowners(rules []codeownersRule) []string {
+	var owners []string
+	for _, rule := range rules {
+		switch rule.pattern {
+		case "*", "/*", "/", "**", "/**":
+			owners = rule.owners
+		}
+	}
+	return owners
+}
+
+// getCodeowners returns the CODEOWNERS file content, or empty string when the repository has none.
+func getCodeowners(ctx context.Context, client *github.Client, cache *Cache, organization, name, branch string) (string, error) {
+	if content, ok := cache.getCodeowners(organization, name, branch); ok {
+		return content, nil
+	}
+	var content string
+	for _, location := range codeownersLocations {
+		file, _, _, err := client.Repositories.GetContents(withCategory(ctx, categoryContents), organization, name, location, &github.RepositoryContentGetOptions{Ref: branch})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if content, err = file.GetContent(); err != nil {
+			return "", err
+		}
+		break
+	}
+	cache.setCodeowners(organization, name, branch, content)
+	return content, nil
+}
+
+// teamResolver expands "@org/team" owners to team names. When the token can't read the
+// organization teams, the owners are left as they are.
+type teamResolver struct {
+	client *github.Client
+
+	lock  sync.Mutex
+	teams map[string]map[string]string
+}
+
+func newTeamResolver(client *github.Client) *teamResolver {
+	return &teamResolver{client: client, teams: map[string]map[string]string{}}
+}
+
+func (r *teamResolver) organizationTeams(ctx context.Context, organization string) map[string]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if teams, ok := r.teams[organization]; ok {
+		return teams
+	}
+	teams := map[string]string{}
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := r.client.Teams.ListTeams(withCategory(ctx, categoryTeams), organization, options)
+		if err != nil {
+			teams = nil
+			break
+		}
+		for _, team := range page {
+			teams[team.GetSlug()] = team.GetName()
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	r.teams[organization] = teams
+	return teams
+}
+
+func (r *teamResolver) Expand(ctx context.Context, owners []string) []string {
+	var expanded []string
+	for _, owner := range owners {
+		parts := strings.SplitN(strings.TrimPrefix(owner, "@"), "/", 2)
+		if len(parts) != 2 || r == nil {
+			expanded = append(expanded, owner)
+			continue
+		}
+		if name, ok := r.organizationTeams(ctx, parts[0])[parts[1]]; ok && len(name) > 0 {
+			expanded = append(expanded, fmt.Sprintf("%s (%s)", name, owner))
+			continue
+		}
+		expanded = append(expanded, owner)
+	}
+	return expanded
+}
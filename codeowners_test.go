@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// samples of CODEOWNERS files as found in the payload repositories
+const (
+	// the repository owned as a whole, with a more specific rule later
+	codeownersConsole = `# Lines starting with '#' are comments.
+* @openshift/team-console-admins
+
+# frontend packages
+/frontend/packages/dev-console/ @openshift/team-devconsole-ux # dev console
+/frontend/packages/knative-plugin/ @openshift/team-serverless
+`
+	// gitignore style patterns without anchors and with globs
+	codeownersInstaller = `*.go @openshift/installer-maintainers
+docs/ @openshift/installer-docs
+**/aws/** @openshift/installer-aws
+pkg/types/*.go @openshift/installer-api
+data/data/\#config @openshift/installer-data
+`
+	// the last matching rule wins, a later catch-all overrides the earlier rules
+	codeownersOverride = `/pkg/ @alice
+*      @bob @openshift/team-b
+`
+)
+
+func TestCodeowners(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		paths    map[string][]string
+		root     []string
+		patterns []string
+	}{
+		{
+			name:    "console",
+			content: codeownersConsole,
+			paths: map[string][]string{
+				"README.md": {"@openshift/team-console-admins"},
+				"frontend/packages/dev-console/src/index.ts":      {"@openshift/team-devconsole-ux"},
+				"frontend/packages/knative-plugin/package.json":   {"@openshift/team-serverless"},
+				"frontend/packages/console-shared/src/index.ts":   {"@openshift/team-console-admins"},
+				"pkg/frontend/packages/dev-console/src/index.ts":  {"@openshift/team-console-admins"},
+				"frontend/packages/dev-console-extra/src/main.ts": {"@openshift/team-console-admins"},
+			},
+			root:     []string{"@openshift/team-console-admins"},
+			patterns: []string{"*", "/frontend/packages/dev-console/", "/frontend/packages/knative-plugin/"},
+		},
+		{
+			name:    "installer",
+			content: codeownersInstaller,
+			paths: map[string][]string{
+				"main.go":                     {"@openshift/installer-maintainers"},
+				"pkg/asset/installconfig.go":  {"@openshift/installer-maintainers"},
+				"pkg/types/installconfig.go":  {"@openshift/installer-api"},
+				"pkg/types/aws/platform.go":   {"@openshift/installer-aws"},
+				"docs/user/aws/install.md":    {"@openshift/installer-aws"},
+				"docs/user/gcp/install.md":    {"@openshift/installer-docs"},
+				"data/data/#config":           {"@openshift/installer-data"},
+				"hack/build.sh":               nil,
+				"upstream/docs/dev/readme.md": {"@openshift/installer-docs"},
+			},
+			patterns: []string{"*.go", "docs/", "**/aws/**", "pkg/types/*.go", `data/data/\#config`},
+		},
+		{
+			name:    "override",
+			content: codeownersOverride,
+			paths: map[string][]string{
+				"pkg/controller/sync.go": {"@bob", "@openshift/team-b"},
+			},
+			root:     []string{"@bob", "@openshift/team-b"},
+			patterns: []string{"/pkg/", "*"},
+		},
+		{name: "empty"},
+	}
+	for _, test := range tests {
+		rules := parseCodeowners(test.content)
+		var patterns []string
+		for _, rule := range rules {
+			patterns = append(patterns, rule.pattern)
+		}
+		if !reflect.DeepEqual(patterns, test.patterns) {
+			t.Errorf("%s: expected patterns %q, got %q", test.name, test.patterns, patterns)
+		}
+		for path, expected := range test.paths {
+			if owners := codeownersForPath(rules, path); !reflect.DeepEqual(owners, expected) {
+				t.Errorf("%s: %s: expected owners %v, got %v", test.name, path, expected, owners)
+			}
+		}
+		if root := rootCodeowners(rules); !reflect.DeepEqual(root, test.root) {
+			t.Errorf("%s: expected repository owners %v, got %v", test.name, test.root, root)
+		}
+	}
+
+	rules := parseCodeowners(codeownersConsole)
+	owners := codeownersForPaths(rules, []string{"README.md", "frontend/packages/dev-console/a.ts", "Makefile"})
+	if expected := []string{"@openshift/team-console-admins", "@openshift/team-devconsole-ux"}; !reflect.DeepEqual(owners, expected) {
+		t.Errorf("expected the owners of all the paths once, got %v", owners)
+	}
+}
+
+func TestGetCodeowners(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/console/contents/CODEOWNERS":
+			if req.URL.Query().Get("ref") != "release-4.9" {
+				t.Errorf("expected the CODEOWNERS of the branch, got %s", req.URL)
+			}
+			fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(codeownersConsole)))
+		case "/orgs/openshift/teams":
+			fmt.Fprint(w, `[{"slug": "team-console-admins", "name": "Console Admins"}]`)
+		case "/orgs/private/teams":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Must have admin rights to Repository."}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		}
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	cache := NewCache()
+	for i := 0; i < 2; i++ {
+		content, err := getCodeowners(context.Background(), client, cache, "openshift", "console", "release-4.9")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != codeownersConsole {
+			t.Errorf("expected the CODEOWNERS found in the root, got %q", content)
+		}
+	}
+	// .github/CODEOWNERS is missing, the root one is found, the second lookup is cached
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	content, err := getCodeowners(context.Background(), client, cache, "openshift", "api", "master")
+	if err != nil || len(content) > 0 {
+		t.Errorf("expected no CODEOWNERS, got %q and %v", content, err)
+	}
+
+	teams := newTeamResolver(client)
+	expanded := teams.Expand(context.Background(), []string{"@openshift/team-console-admins", "@openshift/team-unknown", "@private/team", "@alice"})
+	expected := []string{"Console Admins (@openshift/team-console-admins)", "@openshift/team-unknown", "@private/team", "@alice"}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("expected %v, got %v", expected, expanded)
+	}
+}
@@ -0,0 +1,1334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultSince is the window of a query without -since, when the previous payload is not known
+const defaultSince = "1d"
+
+// queryOptions are the flags of a query, given on the command line or by a job of the jobs file.
+type queryOptions struct {
+	since           string
+	branch          string
+	payload         string
+	releaseInfoFile string
+	manifestsDir    string
+	relativeTo      string
+	maxMessageLines int
+	tier            string
+	tierRules       string
+	groupByTier     bool
+	groupByBatch    bool
+	mergeCommits    string
+	preferCanonical bool
+	trustServerTime bool
+	withPRs         bool
+	withBackports   bool
+	backportTarget  string
+	mergedBy        string
+	excludeAuthors  commaSeparatedList
+	aggressivePages bool
+	withRetests     bool
+	retestsLimit    int
+	withCodeowners  bool
+	saveRaw         string
+	fromRaw         string
+	explainEmpty    bool
+	previousPayload string
+	sincePayload    string
+	multiSHA        string
+	showUnchanged   bool
+	leaderboard     bool
+	leaderboardBots bool
+	orgSummary      bool
+	prSummary       bool
+	showEmbargoLag  bool
+	stream          bool
+	noBranchCheck   bool
+	noResume        bool
+	resumeMaxAge    time.Duration
+	includeOrgRepos commaSeparatedList
+	maxOrgRepos     int
+	gitMirrorDir    string
+	gitTimeout      time.Duration
+	dedupeByMessage bool
+	dedupeThreshold int
+	explainFilters  bool
+
+	collapseDuplicates string
+	collapseWindow     time.Duration
+	collapseSessions   bool
+	sessionGap         time.Duration
+
+	branchPresence   bool
+	presenceBranches commaSeparatedList
+	columns          commaSeparatedList
+
+	components     repeatableList
+	repoBranches   string
+	capabilities   repeatableList
+	showCapability bool
+	repoAliases    string
+	authFailures   int
+	minCommits     int
+	maxRepoCommits int
+	maxCommits     int
+	maxLookback    time.Duration
+	strict         bool
+	strictInclude  commaSeparatedList
+	embargoWindow  time.Duration
+
+	branchStitching bool
+	firstParent     bool
+
+	classifyPaths      bool
+	classifyPathsLimit int
+	pathClasses        string
+	onlyPathClass      string
+	filesFilter        string
+
+	auditDirectPushes bool
+	auditMaxAge       time.Duration
+	incidentWindow    string
+
+	digest     bool
+	digestSize int
+	digestOnly bool
+
+	changelogFile string
+
+	postWebhook        string
+	postMinChanges     int
+	postHeartbeatEvery time.Duration
+	postStateFile      string
+
+	showVerification bool
+	onlyUnverified   bool
+	keepCoauthors    bool
+
+	futureTolerance  time.Duration
+	clampFutureDates bool
+
+	showSanitizationDiff bool
+	noSanitize           bool
+
+	onlyCVEs         bool
+	cveSeverity      bool
+	cveSeverityLimit int
+
+	volumeAlert       bool
+	volumeThreshold   int
+	volumeThresholds  string
+	volumeBots        bool
+	failOnVolumeAlert bool
+
+	secretPatterns   string
+	redactEverywhere bool
+	blockOnSecrets   bool
+
+	ignoreFile      string
+	noIgnore        bool
+	showSkippedTags bool
+
+	// maxWindow, maxRequests and yes guard against very large runs, the flags are only added by the collect command
+	maxWindow   time.Duration
+	maxRequests int
+	yes         bool
+	// maxRequestsSet is true when -max-requests was given explicitly
+	maxRequestsSet bool
+	// dryRun and dryRunWithQuota print the plan of the query instead of running it, only added by the collect command
+	dryRun          bool
+	dryRunWithQuota bool
+	// messageFormat is the output format the messages are compacted for at collection time (see messageRetention),
+	// set by the collect command only
+	messageFormat string
+
+	// onResult is called with the result of each repository as soon as it is processed, with the number of
+	// processed repositories out of the total (see serve)
+	onResult func(result RepositoryResult, processed, total int)
+	// provenance records the flags of the run, set by the collect command
+	provenance *Provenance
+	// releaseInfo is the payload release, read once when needed (from releaseInfoFile or manifestsDir when set)
+	releaseInfo *Release
+	// skippedTags are the payload tags skipped without a source repository, set by repositories
+	skippedTags []SkippedTag
+	// secrets is set by validate, from -secret-patterns
+	secrets *secretDetector
+	// aliases are set by validate, from -repo-alias
+	aliases map[string]string
+	// ignore is set by validate, from -ignore-file, nil when there is no ignore file
+	ignore *ignoreRules
+	// volumeOverrides are set by validate, from -volume-thresholds
+	volumeOverrides map[string]int
+	// branches are set by validate, from -repo-branches
+	branches map[string][]string
+	// incident is set by validate, from -incident-window
+	incident *IncidentWindow
+	// postGate is set by validate, from -post-webhook, nil when nothing is posted
+	postGate *postGate
+	// resolvedSince is the parsed -since, set by processOptions
+	resolvedSince sinceValue
+}
+
+func (o *queryOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.since, "since", "", fmt.Sprintf("Relative time (eg. '1d', '48h', ...), date (YYYY-MM-DD or RFC3339, in the -timezone) or payload (pullspec or tag, since it was created) to search the commits from, defaults to the previous accepted payload of the -payload stream or to %s", defaultSince))
+	fs.StringVar(&o.branch, "branch", "master", "Branch name to use for search (eg. 'release-4.6', ...)")
+	fs.StringVar(&o.payload, "payload", defaultPayloadFlag(), "Payload URL to use to determine list of repositories")
+	fs.BoolVar(&o.showSkippedTags, "show-skipped-tags", false, "Log every payload tag skipped without a usable source repository (eg. base images) with the reason and its annotations, instead of their number")
+	fs.StringVar(&o.releaseInfoFile, "release-info-file", "", "Read the payload from the output of 'oc adm release info -o json' saved in this file ('-' for stdin) instead of running oc")
+	fs.StringVar(&o.manifestsDir, "release-manifests-dir", "", "Read the payload from the release-manifests directory extracted from the release image (image-references and release-metadata) instead of running oc")
+	fs.IntVar(&o.maxMessageLines, "max-message-lines", defaultMaxMessageLines, "Maximum number of commit message lines shown in the table output, ticket references are preferred over other body lines (0 means no limit, other outputs always have the full message)")
+	fs.BoolVar(&o.digest, "digest", false, "Show the most notable changes above the table, each with why it was selected: CVE references first, then reverts, API changes and the largest diffstats (of -classify-paths)")
+	fs.IntVar(&o.digestSize, "digest-size", defaultDigestSize, "Number of changes in the -digest")
+	fs.BoolVar(&o.digestOnly, "digest-only", false, "Show the -digest instead of the table of all changes")
+	fs.StringVar(&o.changelogFile, "changelog-file", "", "Append a dated markdown section with the listed changes not in this changelog file yet (by their SHA), the file is created on first use")
+	fs.StringVar(&o.postWebhook, "post-webhook", "", "Post the rendered output, with potential secrets redacted, to this webhook URL as {\"text\": ...} (eg. a Slack incoming webhook with -format template -template slack), failed posts are logged")
+	fs.IntVar(&o.postMinChanges, "post-min-changes", 1, "Skip posting to the -post-webhook when fewer changes are listed, the -output is still written")
+	fs.DurationVar(&o.postHeartbeatEvery, "post-heartbeat-every", 0, "Post a 'nothing merged in the last 6h' heartbeat instead of a skipped post when nothing was posted for this long, requires -post-state-file (0 disables it)")
+	fs.StringVar(&o.postStateFile, "post-state-file", "", "File remembering when the last post was made, so -post-heartbeat-every keeps its schedule across runs")
+	fs.StringVar(&o.incidentWindow, "incident-window", "", "List the reverts merged within START..END (RFC 3339, eg. 2021-08-18T10:00:00Z..2021-08-18T14:00:00Z) with the commits they reverted, which are fetched when older than the window, and a summary of the incident")
+	fs.BoolVar(&o.auditDirectPushes, "audit-direct-pushes", false, fmt.Sprintf("List changes pushed without a pull request in a separate section, regardless of the filters, and exit with code %d when there are any (implies -with-prs)", exitCodeDirectPushes))
+	fs.DurationVar(&o.auditMaxAge, "audit-max-age", defaultAuditMaxAge, "Only audit changes younger than this with -audit-direct-pushes, Github may not find pull requests of older changes (0 means no limit)")
+	fs.StringVar(&o.relativeTo, "relative-to", relativeToNow, "Render when the changes merged relative to 'now', or to the creation of the -payload ('payload', eg. '-2h10m' before it, '+40m' after it and thus not in it)")
+	fs.StringVar(&o.tier, "tier", tierAll, "Only show changes of repositories with 'core' payload images, or only 'extras' (tests, artifacts, ...), or 'all'")
+	fs.StringVar(&o.tierRules, "tier-rules", "", "YAML file with rules classifying payload tags into tiers, checked before the built-in ones")
+	fs.Var(&o.components, "component", "Only process repositories of these payload components (image names, globs like '*-operator' are allowed), can be repeated")
+	fs.StringVar(&o.repoBranches, "repo-branches", "", "YAML file listing the branches of repositories building payload images from several branches (eg. 'branches: {openshift/oc: [release-4.9, master]}'), they are scanned on each of them instead of -branch")
+	fs.Var(&o.capabilities, "capability", "Only process repositories of this class of payload images: 'core' (operators of the cluster version operator), the name of an optional capability (eg. 'marketplace', 'openshift-samples') or 'other', can be repeated (implies -show-capability)")
+	fs.BoolVar(&o.showCapability, "show-capability", false, "Show the class of the repository of each change (core, capability:NAME or other) from the annotations of the payload images in the Capability column")
+	fs.Var(&o.columns, "columns", "Comma separated list of additional table columns: 'trailer:KEY' shows the values of the KEY commit message trailer (eg. 'trailer:Component,trailer:Upstream-commit'), trailers are left out of the messages and listed in the 'trailers' of the JSON changes")
+	fs.BoolVar(&o.keepCoauthors, "keep-coauthors", false, "Keep the Co-authored-by lines of commit messages, they are left out like the Signed-off-by ones by default")
+	fs.DurationVar(&o.futureTolerance, "future-tolerance", defaultFutureTolerance, "Mark changes dated more than this duration after the start of the run as having a future timestamp (eg. a bad clock of the committer)")
+	fs.BoolVar(&o.clampFutureDates, "clamp-future-dates", false, "Show and sort changes with future timestamps as if they were committed at the start of the run, JSON has both dates")
+	fs.BoolVar(&o.showSanitizationDiff, "show-sanitization-diff", false, "Log a diff of the raw and the sanitized message (without signature lines, ...) of each change whose message the table output changes beyond whitespace, with the number of such changes")
+	fs.BoolVar(&o.noSanitize, "no-sanitize", false, "Render the raw commit messages (with signature lines, ...) in the html output, the table is always sanitized (json, csv, templates and -save-raw always have the raw messages)")
+	fs.BoolVar(&o.showVerification, "show-verification", false, "Show whether the signature (GPG, SSH) of each change is verified by Github, with the share of verified changes of each repository")
+	fs.BoolVar(&o.onlyUnverified, "only-unverified", false, "Only show changes without a verified signature (implies -show-verification)")
+	fs.BoolVar(&o.onlyCVEs, "only-cves", false, "Only show changes whose message (or pull request title, see -with-prs) references a CVE (eg. 'CVE-2023-44487')")
+	fs.BoolVar(&o.cveSeverity, "cve-severity", false, "Show the severity of the CVEs referenced by the changes, fetched from the Red Hat Security Data API (CVEs whose severity can't be fetched are shown without it)")
+	fs.IntVar(&o.cveSeverityLimit, "cve-severity-limit", defaultCVESeverityLimit, "Maximum number of CVEs whose severity is fetched by -cve-severity, cached ones don't count (0 means no limit)")
+	fs.StringVar(&o.repoAliases, "repo-alias", "", "YAML file mapping repositories the token can't read to mirrors to list their commits from (eg. openshift-priv to openshift repositories)")
+	fs.IntVar(&o.maxRepoCommits, "max-commits-per-repo", 0, "Stop listing commits of a repository after this number of commits, the repository is reported as truncated (0 means no limit)")
+	fs.IntVar(&o.maxCommits, "max-total-commits", 0, "Stop listing further pages of commits once this number of commits was listed in total, every repository still lists its first page and the truncated repositories are reported (0 means no limit)")
+	fs.BoolVar(&o.strict, "strict", false, "Fail when the commit list of any repository is truncated (eg. by -max-commits-per-repo or -max-total-commits)")
+	fs.Var(&o.strictInclude, "strict-include", "Comma separated categories of repository errors -strict also fails on: 'blocked' (repositories Github blocks by IP allow lists or for legal reasons)")
+	fs.IntVar(&o.minCommits, "min-commits", 0, "Extend the window of repositories with fewer changes, doubling it up to -max-lookback, older changes are marked 'outside window' (0 disables it)")
+	fs.DurationVar(&o.maxLookback, "max-lookback", defaultMaxLookback, "Longest window -min-commits extends the window of a repository to")
+	fs.BoolVar(&o.branchStitching, "branch-stitching", false, "Add the commits of the old master (or main) branch to repositories whose -branch main (or master) has commits in the window, but none in its first half, as the default branch was renamed during the window (the stitched repositories are logged)")
+	fs.BoolVar(&o.firstParent, "first-parent", false, "List only the first-parent history of the branch (one merge commit per pull request in repositories merging with merge commits, they are shown as changes) with the Github GraphQL API, or git log --first-parent with -git-mirror-dir; repositories whose history can't be queried list all commits with a note, as their counts may differ")
+	fs.DurationVar(&o.embargoWindow, "embargo-window", defaultEmbargoWindow, "Show changes of a repository and its openshift-priv mirror (or -repo-alias) with the same subject and author landed within this duration as one row, 0 disables it")
+	fs.IntVar(&o.authFailures, "auth-failure-limit", defaultAuthFailureLimit, "Stop processing repositories when more than this number of them in a row fail to authenticate (eg. the token was revoked), 0 disables it")
+	fs.BoolVar(&o.classifyPaths, "classify-paths", false, "Classify the changed files of each change (api-change, manifest-change, docs-only, test-only) in the Path Class column")
+	fs.IntVar(&o.classifyPathsLimit, "classify-paths-limit", defaultClassifyPathsLimit, "Maximum number of changes whose files are fetched by -classify-paths (0 means no limit), the rest is 'unknown'")
+	fs.StringVar(&o.pathClasses, "path-classes", "", "YAML file with the path classes and their glob patterns used by -classify-paths instead of the built-in ones")
+	fs.StringVar(&o.filesFilter, "files-filter", "", "Only show changes touching a file matching the glob ('**' matches any directories, eg. 'pkg/**/*.go'), or whose files are unknown (implies -classify-paths, unlike a server side path filter it works with -since-payload too)")
+	fs.StringVar(&o.onlyPathClass, "only-path-class", "", "Only show changes of the path class, or whose class is unknown (eg. 'api-change', implies -classify-paths)")
+	fs.StringVar(&o.ignoreFile, "ignore-file", defaultIgnoreFile(), "File with personal 'repo: PATTERN' and 'message: PATTERN' lines of repositories (ORG/NAME) and change subjects to leave out, in addition to the other flags (the default one is read when it exists)")
+	fs.BoolVar(&o.noIgnore, "no-ignore", false, "Do not read the -ignore-file")
+	fs.StringVar(&o.secretPatterns, "secret-patterns", "", "File with additional regular expressions (one per line) matching secrets to redact from commit messages")
+	fs.BoolVar(&o.redactEverywhere, "redact-everywhere", false, "Redact potential secrets (eg. tokens, AWS keys) from commit messages in the output (always done by serve and for -post-webhook)")
+	fs.BoolVar(&o.blockOnSecrets, "block-on-secrets", false, "Fail without rendering the output when commit messages contain potential secrets, listing the changes")
+	fs.StringVar(&o.mergeCommits, "merge-commits", mergeCommitsHide, "How merge commits are shown: 'hide' them, 'show' them as changes, or 'collapse' the changes they merged beneath them")
+	fs.BoolVar(&o.groupByBatch, "group-by-batch", false, "Show changes merged together (eg. by a Tide batch) in separate sections (implies -with-prs)")
+	fs.BoolVar(&o.groupByTier, "group-by-tier", false, "Show changes of core and extras payload images in separate sections")
+	fs.StringVar(&o.gitMirrorDir, "git-mirror-dir", "", "List commits from local clones in this directory (ORG/NAME or ORG/NAME.git) instead of the Github API")
+	fs.DurationVar(&o.gitTimeout, "git-timeout", defaultGitTimeout, "Maximum time git may take to list commits of a repository with -git-mirror-dir")
+	fs.BoolVar(&o.trustServerTime, "trust-server-time", false, "Compute the -since window from the Github time instead of the local time (eg. when the local clock is skewed)")
+	fs.Var(&o.includeOrgRepos, "include-org-repos", "Comma separated list of ORG or ORG:TOPIC whose (not archived) repositories are processed together with the payload ones (eg. 'openshift:openshift-payload-adjacent')")
+	fs.IntVar(&o.maxOrgRepos, "max-org-repos", defaultMaxOrgRepositories, "Maximum number of repositories added by -include-org-repos")
+	fs.BoolVar(&o.preferCanonical, "prefer-canonical", false, "When payload repository is a fork, list commits from the parent repository instead")
+	fs.BoolVar(&o.withPRs, "with-prs", false, "Show the pull request that merged each change")
+	fs.BoolVar(&o.withBackports, "with-backports", false, "Show cherry-pick pull requests of each change into release branches (implies -with-prs)")
+	fs.BoolVar(&o.withCodeowners, "with-codeowners", false, "Show owners of the changed repository from its CODEOWNERS file")
+	fs.StringVar(&o.backportTarget, "backport-target", "", "Only show changes lacking a backport into the given branch (eg. 'release-4.9', implies -with-backports)")
+	fs.BoolVar(&o.withRetests, "with-retests", false, "Show the number of /retest and /override commands on the pull request of each change (implies -with-prs)")
+	fs.IntVar(&o.retestsLimit, "retests-limit", defaultRetestsLimit, "Maximum number of pull requests examined by -with-retests (0 means no limit)")
+	fs.Var(&o.excludeAuthors, "exclude-author", "Comma separated list of commit authors (Github logins or emails) whose changes are not shown (eg. 'openshift-bot')")
+	fs.BoolVar(&o.aggressivePages, "aggressive-pagination", false, "Stop listing commits of a repository once a page only has -exclude-author commits older than the middle of the window (saves requests, but may miss changes)")
+	fs.StringVar(&o.mergedBy, "merged-by", "", "Only show changes merged by the given Github user or bot (implies -with-prs)")
+	fs.BoolVar(&o.dedupeByMessage, "dedupe-by-message", false, "Show changes with the same message (ignoring numbers and repository names) in multiple repositories as one row")
+	fs.IntVar(&o.dedupeThreshold, "dedupe-threshold", 1, "Only dedupe changes found in more than this number of repositories")
+	fs.StringVar(&o.collapseDuplicates, "collapse-duplicates", collapseOff, "Collapse likely duplicate commits of a repository (eg. squashed and original commits of a pull request), 'off', 'conservative' or 'aggressive'")
+	fs.DurationVar(&o.collapseWindow, "collapse-window", 24*time.Hour, "Only collapse duplicate commits committed within this duration")
+	fs.BoolVar(&o.collapseSessions, "collapse-sessions", false, "Show consecutive commits of an author in a repository (eg. a pull request merged without squash) as one row with the commit count and the first and last subjects, JSON and html have all the commits")
+	fs.DurationVar(&o.sessionGap, "session-gap", defaultSessionGap, "Longest time between consecutive commits of a -collapse-sessions session")
+	fs.BoolVar(&o.explainFilters, "explain-filters", false, "Show changes excluded by filters too, with the filter that would exclude them")
+	fs.BoolVar(&o.branchPresence, "branch-presence", false, fmt.Sprintf("Show whether each change is present in release branches (the %d most recent release-4.x branches by default)", defaultPresenceBranches))
+	fs.Var(&o.presenceBranches, "presence-branches", "Comma separated list of branches checked by -branch-presence (eg. 'release-4.11,release-4.10')")
+	fs.BoolVar(&o.explainEmpty, "explain-empty", false, fmt.Sprintf("Look up the last activity of (up to %d) repositories without changes", maxEmptyExplanations))
+	fs.StringVar(&o.saveRaw, "save-raw", "", "Save all collected data into the given JSON file")
+	fs.StringVar(&o.fromRaw, "from-raw", "", "Render data previously saved via -save-raw instead of talking to Github")
+	fs.BoolVar(&o.noResume, "no-resume", false, "Process all repositories, even those completed by a previous interrupted run with the same parameters (see -cache)")
+	fs.DurationVar(&o.resumeMaxAge, "resume-max-age", defaultResumeMaxAge, "Do not resume results of an interrupted run older than this")
+	fs.BoolVar(&o.showUnchanged, "show-unchanged", false, "Report repositories without changes as skipped test cases in the junit format")
+	fs.BoolVar(&o.noBranchCheck, "no-branch-check", false, fmt.Sprintf("Do not fail early when the -branch does not exist in any of (up to) %d repositories probed before the collection", branchCheckSample))
+	fs.BoolVar(&o.stream, "stream", false, "Do not sort the changes by time, they are rendered in the order the repositories completed (saves time and memory of very large windows)")
+	fs.BoolVar(&o.leaderboard, "leaderboard", false, "Show the number of changes and repositories of each author after the changes (bots are left out)")
+	fs.BoolVar(&o.leaderboardBots, "leaderboard-include-bots", false, "Include bot accounts (eg. openshift-bot, dependabot[bot]) in -leaderboard")
+	fs.BoolVar(&o.volumeAlert, "volume-alert", false, "Warn about repositories with more changes than -volume-threshold (bots are left out), listing their top authors")
+	fs.IntVar(&o.volumeThreshold, "volume-threshold", defaultVolumeThreshold, "Number of changes of a repository in the window above which -volume-alert warns")
+	fs.StringVar(&o.volumeThresholds, "volume-thresholds", "", "YAML file overriding -volume-threshold of repositories (eg. 'thresholds: {openshift/origin: 60}')")
+	fs.BoolVar(&o.volumeBots, "volume-alert-include-bots", false, "Count bot changes (eg. vendor bumps) with -volume-alert")
+	fs.BoolVar(&o.failOnVolumeAlert, "fail-on-volume-alert", false, fmt.Sprintf("Exit with code %d when -volume-alert warns about any repository (implies -volume-alert)", exitCodeVolumeAlert))
+	fs.BoolVar(&o.prSummary, "pr-summary", false, "Show the number of changes, distinct pull requests and changes per pull request of each repository after the changes (pull requests are parsed from merge commits and squashed subjects, or found by -with-prs)")
+	fs.BoolVar(&o.orgSummary, "org-summary", false, "Show the number of changes, repositories with changes, authors and the share of bot changes of each Github organization after the changes")
+	fs.BoolVar(&o.showEmbargoLag, "show-embargo-lag", false, "List changes landed both in a repository and its openshift-priv mirror with the delay of the public landing")
+	fs.StringVar(&o.multiSHA, "multi-sha", multiSHAPerTag, "How -since-payload and -pending treat repositories the payload images were built from at several commits: 'per-tag' lists them since the oldest commit, marking the changes the other tags were already built with, and compares each commit with -pending, 'newest' uses the newest commit only")
+	fs.StringVar(&o.sincePayload, "since-payload", "", "List changes of each repository since its commit in this payload, repositories not in it are listed since the payload was created (or -since)")
+	fs.StringVar(&o.previousPayload, "previous-payload", "", "List changes since this payload was created")
+}
+
+func (o *queryOptions) processOptions(shared *sharedOptions) (ProcessOptions, error) {
+	if err := validateCollapseMode(o.collapseDuplicates); err != nil {
+		return ProcessOptions{}, err
+	}
+	if err := validateTier(o.tier); err != nil {
+		return ProcessOptions{}, err
+	}
+	if o.groupByTier && o.groupByBatch {
+		return ProcessOptions{}, fmt.Errorf("-group-by-tier and -group-by-batch are mutually exclusive")
+	}
+	if err := validateMergeCommits(o.mergeCommits); err != nil {
+		return ProcessOptions{}, err
+	}
+	if o.mergeCommits == mergeCommitsCollapse && (o.groupByTier || o.groupByBatch) {
+		return ProcessOptions{}, fmt.Errorf("-merge-commits collapse, -group-by-tier and -group-by-batch are mutually exclusive")
+	}
+	if o.firstParent && (o.mergeCommits == mergeCommitsCollapse || o.minCommits > 0 || o.branchStitching) {
+		return ProcessOptions{}, fmt.Errorf("-first-parent is not available with -merge-commits collapse (the merged commits are not listed), -min-commits and -branch-stitching")
+	}
+	if len(o.filesFilter) > 0 {
+		if err := validateFilesFilter(o.filesFilter); err != nil {
+			return ProcessOptions{}, err
+		}
+	}
+	trailerColumns, err := parseColumns(o.columns)
+	if err != nil {
+		return ProcessOptions{}, err
+	}
+	processOptions := ProcessOptions{
+		Concurrency:      shared.concurrency,
+		PreferCanonical:  o.preferCanonical,
+		TrustServerTime:  o.trustServerTime,
+		WithPullRequests: o.withPRs || o.withBackports || len(o.backportTarget) > 0 || len(o.mergedBy) > 0 || o.withRetests || o.groupByBatch || o.auditDirectPushes,
+		WithBackports:    o.withBackports || len(o.backportTarget) > 0,
+		WithCodeowners:   o.withCodeowners,
+		ShowVerification: o.showVerification || o.onlyUnverified,
+		KeepCoauthors:    o.keepCoauthors,
+		TrailerColumns:   trailerColumns,
+		Durations:        shared.durations(time.Now()),
+		Stream:           o.stream,
+
+		ExcludeAuthors:       o.excludeAuthors,
+		AggressivePagination: o.aggressivePages && len(o.excludeAuthors) > 0,
+
+		WithRetests:        o.withRetests,
+		RetestsLimit:       o.retestsLimit,
+		WithBranchPresence: o.branchPresence || len(o.presenceBranches) > 0,
+		PresenceBranches:   o.presenceBranches,
+
+		AuthFailureLimit:   o.authFailures,
+		MinCommits:         o.minCommits,
+		MaxLookback:        o.maxLookback,
+		BranchStitching:    o.branchStitching,
+		FirstParent:        o.firstParent,
+		ClassifyPaths:      o.classifyPaths || len(o.onlyPathClass) > 0 || len(o.filesFilter) > 0,
+		ClassifyPathsLimit: o.classifyPathsLimit,
+		FilesFilter:        o.filesFilter,
+		PathClasses:        defaultPathClasses,
+
+		MaxCommitsPerRepository: o.maxRepoCommits,
+		MaxTotalCommits:         o.maxCommits,
+		MergeCommits:            o.mergeCommits,
+	}
+	if o.firstParent {
+		// the merge commits are the merged pull requests
+		processOptions.MergeCommits = mergeCommitsShow
+	}
+	if len(o.pathClasses) > 0 {
+		var err error
+		if processOptions.PathClasses, err = readPathClasses(o.pathClasses); err != nil {
+			return processOptions, err
+		}
+	}
+	since := o.since
+	if len(since) == 0 {
+		since = defaultSince
+	}
+	if o.resolvedSince, err = parseSince(since, displayLocation, getPayloadCreated); err != nil {
+		return processOptions, err
+	}
+	processOptions.Since = o.resolvedSince.Duration
+	if !o.resolvedSince.Start.IsZero() {
+		processOptions.Since = time.Since(o.resolvedSince.Start)
+	}
+	if len(o.branch) > 0 {
+		processOptions.BranchName = o.branch
+	}
+	processOptions.MessageLines, _ = o.messageLines()
+	if len(o.gitMirrorDir) > 0 {
+		if err := validateGitMirror(processOptions); err != nil {
+			return processOptions, err
+		}
+		if len(o.includeOrgRepos) > 0 || o.explainEmpty || len(o.sincePayload) > 0 {
+			return processOptions, fmt.Errorf("-include-org-repos, -explain-empty and -since-payload require the Github API and are not available with -git-mirror-dir")
+		}
+		processOptions.GitMirrorDir, processOptions.GitTimeout = o.gitMirrorDir, o.gitTimeout
+	}
+	processOptions.RepositoryAliases = o.aliases
+	return processOptions, nil
+}
+
+func (o *queryOptions) validate() error {
+	if len(o.since) > 0 && len(o.previousPayload) > 0 {
+		return fmt.Errorf("-since and -previous-payload are mutually exclusive")
+	}
+	if len(o.sincePayload) > 0 && len(o.previousPayload) > 0 {
+		return fmt.Errorf("-since-payload and -previous-payload are mutually exclusive")
+	}
+	if len(o.releaseInfoFile) > 0 && len(o.manifestsDir) > 0 {
+		return fmt.Errorf("-release-info-file and -release-manifests-dir are mutually exclusive")
+	}
+	if err := validateMultiSHA(o.multiSHA); err != nil {
+		return err
+	}
+	for _, category := range o.strictInclude {
+		if category != strictIncludeBlocked {
+			return fmt.Errorf("unknown -strict-include category %q, use %s", category, strictIncludeBlocked)
+		}
+	}
+	if err := validateRelativeTo(o.relativeTo); err != nil {
+		return err
+	}
+	for _, value := range o.includeOrgRepos {
+		if _, err := parseOrgRepositoriesQuery(value); err != nil {
+			return err
+		}
+	}
+	if _, err := o.processOptions(&sharedOptions{}); err != nil {
+		return err
+	}
+	// invalid -repo-alias, -repo-branches, -ignore-file, -volume-thresholds and -secret-patterns files (and
+	// -incident-window) are reported before any request is made
+	if len(o.repoAliases) > 0 {
+		var err error
+		if o.aliases, err = readRepositoryAliases(o.repoAliases); err != nil {
+			return err
+		}
+	}
+	var err error
+	if len(o.repoBranches) > 0 {
+		if o.branches, err = readRepositoryBranches(o.repoBranches); err != nil {
+			return err
+		}
+	}
+	if len(o.volumeThresholds) > 0 {
+		if o.volumeOverrides, err = readVolumeThresholds(o.volumeThresholds); err != nil {
+			return err
+		}
+	}
+	if len(o.incidentWindow) > 0 {
+		if o.incident, err = parseIncidentWindow(o.incidentWindow); err != nil {
+			return err
+		}
+	}
+	if !o.noIgnore {
+		if o.ignore, err = readIgnoreFile(o.ignoreFile); err != nil {
+			return err
+		}
+	}
+	if len(o.postWebhook) > 0 {
+		if o.postGate, err = newPostGate(o.postMinChanges, o.postHeartbeatEvery, o.postStateFile); err != nil {
+			return err
+		}
+	}
+	o.secrets, err = readSecretDetector(o.secretPatterns)
+	return err
+}
+
+// needsGithub reports whether the query talks to Github, rendering raw data does not.
+func (o *queryOptions) needsGithub() bool {
+	return len(o.fromRaw) == 0 && len(o.gitMirrorDir) == 0
+}
+
+// strictIncludes reports whether -strict fails on the category of repository errors (see -strict-include).
+func (o *queryOptions) strictIncludes(category string) bool {
+	for _, c := range o.strictInclude {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// repositories returns the source repositories of the payload images, only those of -component when set.
+func (o *queryOptions) repositories(sourceAnnotations []string, cache *Cache) ([]string, error) {
+	if len(o.releaseSource()) == 0 && len(o.components) == 0 && len(o.capabilities) == 0 {
+		repositories, skipped, err := getCachedRepositoriesFromPayload(o.payload, sourceAnnotations, cache)
+		if err != nil {
+			return nil, err
+		}
+		o.skippedTags = skipped
+		logSkippedTags(skipped, o.showSkippedTags)
+		return repositories, nil
+	}
+	release, err := o.release()
+	if err != nil {
+		return nil, err
+	}
+	repositories, skipped := getRepositoriesFromRelease(release, sourceAnnotations)
+	o.skippedTags = skipped
+	logSkippedTags(skipped, o.showSkippedTags)
+	if len(o.components) > 0 {
+		if repositories, err = filterComponentRepositories(repositories, release.ComponentRepositories(sourceAnnotations), o.components); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.capabilities) > 0 {
+		all := len(repositories)
+		if repositories, err = filterCapabilityRepositories(repositories, release.RepositoryCapabilities(sourceAnnotations), o.capabilities); err != nil {
+			return nil, err
+		}
+		log.Printf("Kept %d of %d repositories of -capability %s", len(repositories), all, o.capabilities.String())
+	}
+	return repositories, nil
+}
+
+// release returns the payload release info, it is only read once (the release info file can be stdin).
+func (o *queryOptions) release() (*Release, error) {
+	if o.releaseInfo != nil {
+		return o.releaseInfo, nil
+	}
+	var (
+		release *Release
+		err     error
+	)
+	switch {
+	case len(o.manifestsDir) > 0:
+		release, err = readReleaseManifestsDir(o.manifestsDir)
+	case len(o.releaseInfoFile) > 0:
+		release, err = readReleaseInfoFile(o.releaseInfoFile)
+	default:
+		release, err = getReleaseInfo(o.payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.releaseInfo = release
+	return release, nil
+}
+
+// releaseSource is the file or directory the payload is read from instead of running oc, empty when oc is used.
+func (o *queryOptions) releaseSource() string {
+	if len(o.manifestsDir) > 0 {
+		return o.manifestsDir
+	}
+	return o.releaseInfoFile
+}
+
+// releaseLabel identifies the payload read from a file or directory, nil when it is read by oc.
+func (o *queryOptions) releaseLabel() (*ReleaseLabel, error) {
+	if len(o.releaseSource()) == 0 {
+		return nil, nil
+	}
+	release, err := o.release()
+	if err != nil {
+		return nil, err
+	}
+	return newReleaseLabel(o.releaseSource(), release), nil
+}
+
+// annotateCapabilities sets the class of the repository of the changes (see -show-capability).
+func (o *queryOptions) annotateCapabilities(changes []Change, sourceAnnotations []string) ([]Change, error) {
+	if !o.showCapability && len(o.capabilities) == 0 {
+		return changes, nil
+	}
+	release, err := o.release()
+	if err != nil {
+		return nil, err
+	}
+	classes := release.RepositoryCapabilities(sourceAnnotations)
+	for i := range changes {
+		raw := changes[i].raw
+		// repositories not in the payload (eg. -include-org-repos) are left unclassified
+		raw.Capability = classes[raw.Repository]
+		changes[i] = newChange(raw)
+	}
+	return changes, nil
+}
+
+// annotateTiers sets the payload image tier of the changes, when a tier is used by the flags.
+func (o *queryOptions) annotateTiers(changes []Change, sourceAnnotations []string) ([]Change, error) {
+	if (len(o.tier) == 0 || o.tier == tierAll) && !o.groupByTier {
+		return changes, nil
+	}
+	rules := defaultTierRules
+	if len(o.tierRules) > 0 {
+		var err error
+		if rules, err = readTierRules(o.tierRules); err != nil {
+			return nil, err
+		}
+	}
+	release, err := o.release()
+	if err != nil {
+		return nil, err
+	}
+	tiers := release.RepositoryTiers(sourceAnnotations, rules)
+	for i := range changes {
+		raw := changes[i].raw
+		raw.Tier = tiers[raw.Repository]
+		changes[i] = newChange(raw)
+	}
+	return changes, nil
+}
+
+// filters returns the chain of filters selected by the flags.
+func (o *queryOptions) filters() filterChain {
+	var chain filterChain
+	if o.ignore != nil && len(o.ignore.messages) > 0 {
+		chain = append(chain, ignoreFilter{rules: o.ignore})
+	}
+	if len(o.tier) > 0 && o.tier != tierAll {
+		chain = append(chain, tierFilter{tier: o.tier})
+	}
+	if len(o.excludeAuthors) > 0 {
+		chain = append(chain, excludeAuthorFilter{authors: o.excludeAuthors})
+	}
+	if len(o.backportTarget) > 0 {
+		chain = append(chain, missingBackportFilter{branch: o.backportTarget})
+	}
+	if len(o.mergedBy) > 0 {
+		chain = append(chain, mergedByFilter{login: o.mergedBy})
+	}
+	if o.onlyUnverified {
+		chain = append(chain, unverifiedFilter{})
+	}
+	if len(o.onlyPathClass) > 0 {
+		chain = append(chain, pathClassFilter{class: o.onlyPathClass})
+	}
+	if len(o.filesFilter) > 0 {
+		chain = append(chain, filesFilter{pattern: o.filesFilter})
+	}
+	if o.onlyCVEs {
+		chain = append(chain, onlyCVEsFilter{})
+	}
+	return chain
+}
+
+// apply applies the filters and transformations to the collected changes.
+func (o *queryOptions) apply(changes []Change) []Change {
+	changes, excluded := o.filter(changes)
+	o.filters().printSummary(excluded, o.explainFilters)
+	return changes
+}
+
+// filter is apply without the summary, it returns the number of changes excluded by each filter.
+func (o *queryOptions) filter(changes []Change) ([]Change, map[string]int) {
+	changes = collapseDuplicates(changes, o.collapseDuplicates, o.collapseWindow)
+	if o.embargoWindow > 0 {
+		changes = correlateEmbargoedChanges(changes, o.aliases, o.embargoWindow)
+	}
+	changes, excluded := o.filters().Apply(changes, o.explainFilters)
+	if o.dedupeByMessage {
+		changes = dedupeByMessage(changes, o.dedupeThreshold)
+	}
+	if o.collapseSessions {
+		changes = collapseSessions(changes, o.sessionGap)
+	}
+	return changes, excluded
+}
+
+// queryResult is what a query collected, written by the render of the query.
+type queryResult struct {
+	// Options are the options the changes were collected with
+	Options ProcessOptions
+	Changes []Change
+	Errors  []RepositoryError
+	// Empty explains the repositories without changes (-explain-empty)
+	Empty []EmptyRepository
+	// AllEmpty is set when none of the repositories had changes
+	AllEmpty bool
+	// Rebuilt are the images rebuilt without source changes (compare of payloads only)
+	Rebuilt []Rebuild
+	// Components are the payload tags renamed, added or removed (compare of payloads only)
+	Components []ComponentChange
+	// Regressions are the components whose version went backwards and Versions are the component versions of
+	// each image (compare of payloads only)
+	Regressions []VersionRegression
+	Versions    map[string]map[string]string
+	// Window is the resolved start of the listed changes
+	Window *Window
+	// Payload the repositories come from, Release identifies it when it is read from a file
+	Payload string
+	Release *ReleaseLabel
+	// SkippedTags are the payload tags skipped without a source repository
+	SkippedTags []SkippedTag
+	// Unchanged are the repositories without changes
+	Unchanged []string
+	// APIRequests is the number of Github requests made per category
+	APIRequests map[string]int
+	// APIDeprecations are the Github API endpoints responding with deprecation headers
+	APIDeprecations []APIDeprecation
+	// Template renders the result with -format template
+	Template *template.Template
+	// Wrap is how the table output wraps the messages
+	Wrap MessageWrap
+	// Mkdirs creates the missing directories of the files written with the output (eg. the -changelog-file)
+	Mkdirs bool
+	// Incident pairs the reverts of the -incident-window with the reverted commits
+	Incident *Incident
+	// Failed fails the query once its output is written (eg. -fail-on-version-regression)
+	Failed error
+}
+
+// collect lists the changes of the repositories, or of the payload when there are none. With -from-raw the changes are
+// loaded from the raw data instead, with -save-raw the collected changes are saved.
+func (o *queryOptions) collect(ctx context.Context, client *github.Client, shared *sharedOptions, repos []string, cache *Cache) (*queryResult, error) {
+	start := time.Now()
+	processOptions, err := o.processOptions(shared)
+	if err != nil {
+		return nil, err
+	}
+	processOptions.Cache = cache
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return nil, err
+	}
+
+	if len(o.fromRaw) > 0 {
+		data, err := readRawData(o.fromRaw)
+		if err != nil {
+			return nil, err
+		}
+		if err := data.Require(processOptions); err != nil {
+			return nil, err
+		}
+		log.Printf("Rendering %d repositories for commits in %s branch, since %s collected %s ...", len(data.Repositories), data.Metadata.Branch, data.Metadata.Since, processOptions.Durations.Ago(data.Metadata.Created))
+		result := &queryResult{Options: processOptions, Changes: data.Changes(), Errors: data.Errors(), Window: data.Metadata.Window, Payload: data.Metadata.Payload, Release: data.Metadata.Release, SkippedTags: data.Metadata.SkippedTags}
+		result.Options.BranchName = data.Metadata.Branch
+		for _, r := range data.Repositories {
+			if len(r.Changes) == 0 && r.Error == nil {
+				result.Unchanged = append(result.Unchanged, r.Repository)
+			}
+		}
+		if err := o.annotatePayloadOffsets(result); err != nil {
+			return nil, err
+		}
+		o.annotateCVESeverities(ctx, result, cache)
+		o.findIncident(ctx, nil, result, cache)
+		return result, nil
+	}
+
+	work, err := o.planWork(ctx, client, shared, processOptions, repos, cache, false)
+	if err != nil {
+		return nil, err
+	}
+	processOptions, repos, orgRepos, window, items := work.Options, work.Repositories, work.OrgRepositories, work.Window, work.Items
+	if len(items) > len(repos) {
+		log.Printf("Processing %d work items of %d unique repositories for commits in %s branch and the -repo-branches, since %s ...", len(items), len(repos), processOptions.BranchName, processOptions.Since)
+	} else {
+		log.Printf("Processing %d repositories for commits in %s branch, since %s ...", len(repos), processOptions.BranchName, processOptions.Since)
+	}
+	processed := 0
+	changes, errs, err := collectBranchWorkItems(ctx, client, processOptions, items, func(result RepositoryResult) {
+		processed++
+		if o.onResult == nil {
+			return
+		}
+		// the result is annotated like the collected changes, failures are returned once all are collected
+		if annotated, err := o.annotateTiers(result.Changes, shared.sourceAnnotations); err == nil {
+			if annotated, err = o.annotateCapabilities(annotated, shared.sourceAnnotations); err == nil {
+				result.Changes = annotateShippedTags(annotateSource(annotated, orgRepos), work.Shipped)
+			}
+		}
+		o.onResult(result, processed, len(items))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := processOptions.Resume.Done(); err != nil {
+		return nil, err
+	}
+	if changes, err = o.annotateTiers(changes, shared.sourceAnnotations); err != nil {
+		return nil, err
+	}
+	if changes, err = o.annotateCapabilities(changes, shared.sourceAnnotations); err != nil {
+		return nil, err
+	}
+	changes = annotateFutureDates(changes, start, o.futureTolerance, o.clampFutureDates)
+	if o.clampFutureDates && !processOptions.Stream {
+		sortChanges(changes)
+	}
+	changes = annotateSource(changes, orgRepos)
+	changes = annotateShippedTags(changes, work.Shipped)
+	window.Lookback = repositoryLookbacks(changes)
+	window.Stitched = repositoryStitches(changes)
+	if processOptions.FirstParent {
+		window.FirstParentFallback = firstParentFallbacks(changes)
+	}
+	result := &queryResult{Options: processOptions, Changes: changes, Errors: errs, Window: window, Payload: o.payload, SkippedTags: o.skippedTags}
+	if result.Release, err = o.releaseLabel(); err != nil {
+		return nil, err
+	}
+	if result.Release != nil && len(result.Release.Version) > 0 {
+		result.Payload = result.Release.Version
+	}
+
+	emptyRepos := findEmptyRepositories(repos, changes, errs)
+	result.AllEmpty = len(repos) > 0 && len(emptyRepos) == len(repos)
+	result.Unchanged = emptyRepos
+	if o.explainEmpty {
+		result.Empty = explainEmptyRepositories(ctx, client, processOptions.BranchName, emptyRepos)
+	}
+	if o.relativeTo == relativeToPayload {
+		created, err := o.payloadCreated(o.payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to render changes relative to the payload: %v", err)
+		}
+		window.PayloadCreated = &created
+	}
+	if o.provenance != nil {
+		o.provenance.setRepositories(repos, processOptions, changes)
+		shared.recordRateLimits(o.provenance)
+	}
+
+	if len(o.saveRaw) > 0 {
+		metadata := RawMetadata{
+			Created:          time.Now(),
+			Payload:          result.Payload,
+			Branch:           processOptions.BranchName,
+			Since:            processOptions.Since.String(),
+			WithPullRequests: processOptions.WithPullRequests,
+			WithBackports:    processOptions.WithBackports,
+			WithCodeowners:   processOptions.WithCodeowners,
+
+			WithRetests:        processOptions.WithRetests,
+			WithBranchPresence: processOptions.WithBranchPresence,
+			FirstParent:        processOptions.FirstParent,
+			ClassifyPaths:      processOptions.ClassifyPaths,
+			WithFiles:          processOptions.ClassifyPaths,
+
+			Window:      window,
+			Release:     result.Release,
+			SkippedTags: result.SkippedTags,
+		}
+		if err := writeRawData(o.saveRaw, newRawData(metadata, repos, changes, errs)); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.annotatePayloadOffsets(result); err != nil {
+		return nil, err
+	}
+	o.annotateCVESeverities(ctx, result, cache)
+	o.findIncident(ctx, client, result, cache)
+	return result, nil
+}
+
+// findIncident pairs the reverts of the -incident-window with the commits they reverted, among all the collected
+// changes (regardless of the filters).
+func (o *queryOptions) findIncident(ctx context.Context, client *github.Client, result *queryResult, cache *Cache) {
+	if o.incident == nil {
+		return
+	}
+	if result.Window != nil && o.incident.Start.Before(result.Window.Since) {
+		log.Printf("WARNING: the incident starts before the changes listed since %s, reverts merged before are not found", formatTime(result.Window.Since))
+	}
+	_, span := startSpan(ctx, "incident", nil)
+	defer span.End()
+	result.Incident = findIncident(ctx, client, cache, result.Changes, *o.incident, formatterOrNow(result.Options.Durations))
+}
+
+// workPlan is what a query processes: the work items of the repositories, in the window.
+type workPlan struct {
+	Options      ProcessOptions
+	Repositories []string
+	// OrgRepositories are the repositories of -include-org-repos, included in the Repositories
+	OrgRepositories []string
+	Window          *Window
+	// Shipped are the payload tags already built with the changes of repositories built from several commits
+	// (see -multi-sha per-tag)
+	Shipped map[string]map[string][]string
+	Items   []branchWorkItem
+}
+
+// planWork resolves the window, the repositories (the payload ones unless given) and the work items of the query,
+// with the options they are processed with. The Github requests made before the processing (the token, branch and
+// clock checks, the -include-org-repos listing and the -max-requests estimate) are skipped by a dry run.
+func (o *queryOptions) planWork(ctx context.Context, client *github.Client, shared *sharedOptions, processOptions ProcessOptions, repos []string, cache *Cache, dryRun bool) (*workPlan, error) {
+	var err error
+	// without -since, the window of the payload repositories starts at the previous payload of the stream
+	var window *Window
+	previousPayload := o.previousPayload
+	if len(o.sincePayload) > 0 && len(o.since) == 0 {
+		previousPayload = o.sincePayload
+	}
+	if len(previousPayload) > 0 || (len(o.since) == 0 && len(repos) == 0) {
+		window, err = resolvePayloadWindow(o.payload, previousPayload)
+		switch {
+		case err != nil && len(previousPayload) > 0:
+			return nil, err
+		case err != nil:
+			log.Printf("WARNING: unable to find the previous accepted payload, listing changes since %s: %v", processOptions.Since, err)
+		default:
+			processOptions.Since = time.Since(window.Since)
+			log.Printf("Listing changes since previous accepted payload %s created %s", window.PreviousPayload, processOptions.Durations.Ago(window.Since))
+		}
+	}
+	if len(repos) == 0 {
+		_, span := startSpan(ctx, "payload", map[string]interface{}{"payload": o.payload})
+		repos, err = o.repositories(shared.sourceAnnotations, cache)
+		span.End()
+		if err != nil {
+			return nil, err
+		}
+	}
+	repos = o.ignore.filterRepositories(repos)
+
+	// a dry run makes no Github requests
+	withGithub := len(o.gitMirrorDir) == 0 && !dryRun
+	if withGithub {
+		if err := shared.checkToken(ctx, client, repos); err != nil {
+			return nil, err
+		}
+		if !o.noBranchCheck {
+			if err := checkBranch(ctx, client, repos, processOptions.BranchName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var orgRepos []string
+	if len(o.includeOrgRepos) > 0 && dryRun {
+		log.Printf("WARNING: -dry-run leaves out the -include-org-repos repositories, listing them needs Github requests")
+	} else if len(o.includeOrgRepos) > 0 {
+		var queries []orgRepositoriesQuery
+		for _, value := range o.includeOrgRepos {
+			query, err := parseOrgRepositoriesQuery(value)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, query)
+		}
+		if orgRepos, err = includeOrgRepositories(ctx, client, queries, repos, o.maxOrgRepos, cache); err != nil {
+			return nil, err
+		}
+		repos = append(repos, orgRepos...)
+	}
+
+	var skew time.Duration
+	if withGithub {
+		if skew, err = shared.clockSkew(ctx, client); err != nil {
+			log.Printf("WARNING: unable to compare the local clock with Github: %v", err)
+		}
+		warnClockSkew(skew, o.trustServerTime)
+	}
+	if window == nil && !o.resolvedSince.Start.IsZero() {
+		window = &Window{Since: o.resolvedSince.Start, PreviousPayload: o.resolvedSince.Payload}
+	}
+	if window == nil {
+		// the previous payload creation time is absolute, only the relative window depends on the clock
+		processOptions.ClockSkew = skew
+		window = &Window{Since: windowStart(time.Now(), processOptions.Since, skew, o.trustServerTime)}
+	}
+	if len(o.since) > 0 {
+		log.Printf("Listing changes since %s (%s)", formatTime(window.Since), o.resolvedSince.describe(o.since))
+	}
+	if err := checkWindowStart(window.Since, time.Now(), skew); err != nil {
+		return nil, err
+	}
+	if processOptions.FirstParent {
+		window.History = historyFirstParent
+	}
+	var shipped map[string]map[string][]string
+	if len(o.sincePayload) > 0 {
+		commits, err := sincePayloadCommits(o.sincePayload, repos, shared.sourceAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		// a dry run does not compare the commits of repositories built from several ones
+		compareClient := client
+		if !withGithub {
+			compareClient = nil
+		}
+		window.Commits, shipped = resolvePayloadCommits(ctx, compareClient, commits, o.multiSHA)
+		processOptions.Compare = map[string]CompareRange{}
+		for repository, commit := range window.Commits {
+			processOptions.Compare[repository] = CompareRange{Base: commit, Head: processOptions.BranchName}
+		}
+	}
+
+	if withGithub && shared.appAuth() && o.maxRequests > 0 && !o.maxRequestsSet {
+		// the limit of installations is higher than the one of tokens the default is meant for
+		if limit, err := installationRequestLimit(ctx, client); err != nil {
+			log.Printf("WARNING: unable to get the rate limit of the Github App installation: %v", err)
+		} else {
+			logVerbose("Confirming runs estimated to make more than %d Github requests, the rate limit of the installation", limit)
+			o.maxRequests = limit
+		}
+	}
+	if withGithub && !o.yes && (o.maxWindow > 0 || o.maxRequests > 0) {
+		estimate, err := estimateRequests(ctx, client, repos, processOptions, window.Since)
+		if err != nil {
+			log.Printf("WARNING: unable to estimate the number of Github requests: %v", err)
+		}
+		if err := confirmLargeRun(time.Since(window.Since), o.maxWindow, estimate, o.maxRequests, o.yes, isInteractive(), os.Stdin, os.Stderr); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(shared.cache) > 0 && !o.noResume {
+		windowKey := o.since
+		if len(window.PreviousPayload) > 0 {
+			windowKey = window.PreviousPayload
+		}
+		if processOptions.Resume, err = loadResumeState(shared.cache, resumeKey(processOptions, windowKey), o.resumeMaxAge); err != nil {
+			return nil, err
+		}
+	}
+
+	return &workPlan{Options: processOptions, Repositories: repos, OrgRepositories: orgRepos, Window: window, Shipped: shipped, Items: branchWorkItems(repos, processOptions.BranchName, o.branches)}, nil
+}
+
+// annotateCVESeverities sets the severities of the CVEs referenced by the changes with -cve-severity, the
+// severities are kept in the cache.
+func (o *queryOptions) annotateCVESeverities(ctx context.Context, result *queryResult, cache *Cache) {
+	if !o.cveSeverity {
+		return
+	}
+	_, span := startSpan(ctx, "cve-severity", nil)
+	defer span.End()
+	result.Changes = newCVESeverityFetcher(cache, o.cveSeverityLimit).annotate(ctx, result.Changes)
+}
+
+// render applies the filters and transformations of the query to the result and writes the changes into out, the summaries are logged.
+func (o *queryOptions) render(out io.Writer, format string, result *queryResult) error {
+	if o.strict && result.Failed == nil {
+		if err := truncatedResult(result.Errors); err != nil {
+			result.Failed = err
+		}
+	}
+	if o.strict && o.strictIncludes(strictIncludeBlocked) && result.Failed == nil {
+		if err := blockedResult(result.Errors); err != nil {
+			result.Failed = err
+		}
+	}
+	// direct pushes are audited regardless of the filters
+	var directPushes []DirectPush
+	if o.auditDirectPushes {
+		directPushes = findDirectPushes(result.Changes, o.auditMaxAge, time.Now())
+		if o.redactEverywhere {
+			directPushes = redactDirectPushes(directPushes, o.secrets)
+		}
+		if len(directPushes) > 0 && result.Failed == nil {
+			result.Failed = &exitError{code: exitCodeDirectPushes, message: fmt.Sprintf("%d changes were pushed without a pull request", len(directPushes))}
+		}
+	}
+	result.Changes = o.apply(result.Changes)
+	if o.blockOnSecrets {
+		if err := checkSecrets(result.Changes, o.secrets); err != nil {
+			return err
+		}
+	}
+	incident := result.Incident
+	if o.redactEverywhere {
+		result.Changes = redactChanges(result.Changes, o.secrets)
+		incident = redactIncident(incident, o.secrets)
+	}
+	if result.Options.ShowVerification {
+		showVerification(result.Changes)
+	}
+	if result.Options.KeepCoauthors {
+		keepCoauthors(result.Changes)
+	}
+	// the changes were rendered relative to when they were created, the output is relative to the start of the
+	// collection
+	durations := formatterOrNow(result.Options.Durations)
+	formatDurations(result.Changes, durations)
+	if o.showSanitizationDiff {
+		logSanitizationDiffs(result.Changes, result.Options.KeepCoauthors)
+	}
+	if o.noSanitize && format == formatTable {
+		log.Printf("WARNING: -no-sanitize does not apply to the table output, its messages are sanitized")
+	}
+	result.Changes = truncateMessages(result.Changes, o.maxMessageLines)
+
+	report := o.report(result, result.Changes, directPushes, incident, durations)
+	if o.failOnVolumeAlert && len(report.VolumeAlerts) > 0 && result.Failed == nil {
+		result.Failed = &exitError{code: exitCodeVolumeAlert, message: fmt.Sprintf("%d repositories merged more changes than their -volume-threshold", len(report.VolumeAlerts))}
+	}
+	if err := writeReport(out, format, report); err != nil {
+		return err
+	}
+	if o.postGate != nil {
+		// external sinks never get potential secrets, the local output is redacted by -redact-everywhere only
+		posted := report
+		if !o.redactEverywhere {
+			posted = o.report(result, redactChanges(append([]Change{}, result.Changes...), o.secrets), redactDirectPushes(directPushes, o.secrets), redactIncident(incident, o.secrets), durations)
+		}
+		var rendered bytes.Buffer
+		if err := writeReport(&rendered, format, posted); err != nil {
+			return err
+		}
+		since := time.Now().Add(-result.Options.Since)
+		if result.Window != nil {
+			since = result.Window.Since
+		}
+		postReport(context.Background(), o.postGate, o.postWebhook, rendered.Bytes(), len(result.Changes), result.Options.BranchName, since, durations)
+	}
+	if len(o.changelogFile) > 0 {
+		if err := appendChangelog(o.changelogFile, result.Options.BranchName, report.Payload, result.Changes, time.Now(), result.Mkdirs); err != nil {
+			return err
+		}
+	}
+	printErrorSummary(result.Errors)
+	printRetestSummary(result.Changes)
+	if result.Options.ShowVerification {
+		printVerificationSummary(result.Changes)
+	}
+	printEmptySummary(result.Empty, result.AllEmpty, result.Options.BranchName, result.Options.Since, durations)
+	return nil
+}
+
+// report builds the report of the changes, render builds the copy posted to external sinks from the redacted ones.
+func (o *queryOptions) report(result *queryResult, changes []Change, directPushes []DirectPush, incident *Incident, durations Formatter) Report {
+	report := Report{
+		Changes:         changes,
+		Errors:          result.Errors,
+		Payload:         result.Payload,
+		Release:         result.Release,
+		Branch:          result.Options.BranchName,
+		Window:          result.Window,
+		GroupByTier:     o.groupByTier,
+		GroupByBatch:    o.groupByBatch,
+		GroupByMerge:    o.mergeCommits == mergeCommitsCollapse,
+		APIRequests:     result.APIRequests,
+		APIDeprecations: result.APIDeprecations,
+		Template:        result.Template,
+		Wrap:            result.Wrap,
+		TrailerColumns:  result.Options.TrailerColumns,
+		Provenance:      o.provenance,
+		NoSanitize:      o.noSanitize,
+		Coauthors:       result.Options.KeepCoauthors,
+		Durations:       durations,
+		DirectPushes:    directPushes,
+		Incident:        incident,
+		SkippedTags:     result.SkippedTags,
+		DigestOnly:      o.digestOnly,
+		CVEs:            cveChanges(changes),
+	}
+	if o.showUnchanged {
+		report.Unchanged = result.Unchanged
+	}
+	if o.leaderboard || o.leaderboardBots {
+		report.Leaderboard = leaderboard(changes, o.leaderboardBots)
+	}
+	if o.volumeAlert || o.failOnVolumeAlert {
+		report.VolumeAlerts = volumeAlerts(repositoryVolumes(changes, o.volumeBots), o.volumeThreshold, o.volumeOverrides)
+	}
+	if o.prSummary {
+		report.PullRequests = repositoryPullRequests(changes)
+	}
+	if o.orgSummary {
+		report.Organizations = organizationSummaries(changes)
+	}
+	if o.digest || o.digestOnly {
+		report.Digest = selectDigest(changes, o.digestSize)
+	}
+	if o.showEmbargoLag {
+		report.EmbargoLags = embargoLags(changes, durations)
+	}
+	return report
+}
+
+// messageLines returns the number of message body lines the changes keep at collection time and why.
+func (o *queryOptions) messageLines() (int, string) {
+	return messageRetention(o.messageFormat, len(o.saveRaw) > 0, o.showSanitizationDiff, o.blockOnSecrets, o.maxMessageLines)
+}
+
+type collectOptions struct {
+	queryOptions
+
+	jobsFile         string
+	listComponents   bool
+	pending          bool
+	branchCutCheck   string
+	checkProtection  bool
+	reproduce        string
+	changelogRewrite commaSeparatedList
+}
+
+func (o *collectOptions) addFlags(fs *flag.FlagSet) {
+	o.queryOptions.addFlags(fs)
+	fs.BoolVar(&o.listComponents, "list-components", false, "Print the repository of each payload component and exit, without talking to Github")
+	fs.BoolVar(&o.pending, "pending", false, "Instead of the changes, show how many commits of each repository branch are not in the -payload yet, with the oldest and the first pending commits")
+	fs.StringVar(&o.branchCutCheck, "branch-cut-check", "", "Instead of the changes, report which payload repositories miss this new release branch (eg. 'release-4.17') and how many commits of -branch the others miss, supports the markdown format")
+	fs.BoolVar(&o.checkProtection, "check-protection", false, "With -branch-cut-check, flag release branches that are not protected, reading the protection needs admin read access")
+	fs.StringVar(&o.jobsFile, "jobs", "", "YAML file with list of queries to run in batch, each job sets its own query flags (the query flags are ignored)")
+	fs.DurationVar(&o.maxWindow, "max-window", defaultMaxWindow, "Ask for a confirmation (or -yes) before collecting a longer window, 0 disables the check")
+	fs.IntVar(&o.maxRequests, "max-requests", defaultMaxEstimatedRequests, fmt.Sprintf("Ask for a confirmation (or -yes) before runs estimated (from a sample of %d repositories) to make more Github requests, 0 disables the check", estimateSample))
+	fs.BoolVar(&o.yes, "yes", false, "Do not ask for a confirmation of large runs (see -max-window and -max-requests)")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Print the execution plan (work items, window, enabled features, estimated requests and reused cache entries) and exit without making Github requests, -format json prints it as JSON")
+	fs.BoolVar(&o.dryRunWithQuota, "dry-run-with-quota", false, "Check the remaining Github rate limit with a single request in the -dry-run plan (implies -dry-run)")
+	fs.StringVar(&o.reproduce, "reproduce", "", "Run again with the flags recorded in this JSON report (flags given on the command line take precedence)")
+	fs.Var(&o.changelogRewrite, "changelog-rewrite", "Instead of the changes, regenerate the whole -changelog-file from these files saved by -save-raw (comma separated, globs are expanded), a section per run")
+}
+
+func newCollectCommand() *command {
+	cmd := newCommand("collect", "List changes merged into payload repositories (default command)", `
+Examples:
+  # changes merged to payload in last 24h
+  ocp-what-merged collect
+
+  # changes in OpenShift 4.6 branch in last 2 days
+  ocp-what-merged collect -branch release-4.6 -since 48h
+
+  # save the data and render it again later with different filters
+  ocp-what-merged collect -with-backports -save-raw today.json
+  ocp-what-merged collect -from-raw today.json -backport-target release-4.9
+
+  # run the queries of the jobs file
+  ocp-what-merged collect -jobs jobs.yaml
+`)
+	shared := &sharedOptions{}
+	options := &collectOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		if len(options.reproduce) > 0 {
+			provenance, window, err := readProvenance(options.reproduce)
+			if err != nil {
+				return err
+			}
+			if err := reproduce(cmd.flags, cmd.name, provenance, window); err != nil {
+				return err
+			}
+		}
+		options.provenance = newProvenance(cmd.name, cmd.flags)
+		cmd.flags.Visit(func(f *flag.Flag) {
+			if f.Name == "max-requests" {
+				options.maxRequestsSet = true
+			}
+		})
+		return runCollect(ctx, shared, options)
+	}
+	return cmd
+}
+
+func runCollect(ctx context.Context, shared *sharedOptions, o *collectOptions) error {
+	if len(o.jobsFile) > 0 {
+		return runJobsFile(ctx, shared, o.jobsFile)
+	}
+	if o.listComponents {
+		return listComponents(shared, &o.queryOptions)
+	}
+	if o.pending {
+		return runPending(ctx, shared, &o.queryOptions)
+	}
+	if len(o.branchCutCheck) > 0 {
+		return runBranchCut(ctx, shared, &o.queryOptions, o.branchCutCheck, o.checkProtection)
+	}
+	if len(o.changelogRewrite) > 0 {
+		if len(o.changelogFile) == 0 {
+			return fmt.Errorf("-changelog-rewrite requires -changelog-file")
+		}
+		return rewriteChangelog(o.changelogFile, o.changelogRewrite, shared.mkdirs)
+	}
+	o.messageFormat = shared.format
+	if o.dryRun || o.dryRunWithQuota {
+		return printPlan(ctx, shared, &o.queryOptions)
+	}
+	return runQuery(ctx, shared, &o.queryOptions, nil)
+}
+
+// listComponents prints the repository of each payload component.
+func listComponents(shared *sharedOptions, o *queryOptions) error {
+	var err error
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	release, err := o.release()
+	if err != nil {
+		return err
+	}
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	printComponents(out, release.ComponentRepositories(shared.sourceAnnotations))
+	return out.Close()
+}
+
+// runQuery runs the query of a command, the output is created only after the changes were collected.
+func runQuery(ctx context.Context, shared *sharedOptions, q changesQuery, repos []string) error {
+	ctx = shared.withTracing(ctx)
+	if err := q.validate(); err != nil {
+		return err
+	}
+	if !isFormat(shared.format) {
+		return fmt.Errorf("invalid -format %q, expected one of %s", shared.format, strings.Join(formats, ", "))
+	}
+	if err := shared.loadTemplate(); err != nil {
+		return err
+	}
+	var client *github.Client
+	if q.needsGithub() {
+		var err error
+		if client, err = shared.githubClient(); err != nil {
+			return err
+		}
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	result, err := q.collect(ctx, client, shared, repos, cache)
+	if err != nil {
+		return err
+	}
+	if err := shared.saveCache(cache); err != nil {
+		return err
+	}
+	result.APIRequests = shared.apiRequests()
+	result.APIDeprecations = shared.apiDeprecations()
+	result.Template = shared.template
+	result.Wrap = shared.messageWrap()
+	result.Mkdirs = shared.mkdirs
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	_, span := startSpan(ctx, "render", map[string]interface{}{"format": shared.format})
+	err = q.render(out, shared.format, result)
+	span.End()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := shared.finishTracing(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if result.Failed != nil {
+		return result.Failed
+	}
+	return repositoryErrorsResult(result.Errors)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// runTestQuery collects and renders the query like its command does, the rendered output is returned.
+func runTestQuery(t *testing.T, client *github.Client, query changesQuery, repos []string) (string, error) {
+	t.Helper()
+	if err := query.validate(); err != nil {
+		return "", err
+	}
+	result, err := query.collect(context.Background(), client, &sharedOptions{concurrency: 10, skipTokenCheck: true}, repos, NewCache())
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = query.render(&out, formatTable, result)
+	return out.String(), err
+}
+
+func TestCollectAndCompare(t *testing.T) {
+	client, _ := fakeJobsGithub(t)
+	repos := []string{"https://github.com/openshift/api"}
+
+	collected, err := runTestQuery(t, client, &queryOptions{since: "1d", branch: "master"}, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(collected, "Bump the API") {
+		t.Errorf("expected the change in the window, got:\n%s", collected)
+	}
+
+	compared, err := runTestQuery(t, client, &compareOptions{fromBranch: "release-4.9", toBranch: "master"}, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(compared, "Only on master") || strings.Contains(compared, "Bump the API") {
+		t.Errorf("expected only the change missing in release-4.9, got:\n%s", compared)
+	}
+
+	if _, err := runTestQuery(t, client, &compareOptions{fromBranch: "release-4.9"}, repos); err == nil || !strings.Contains(err.Error(), "-to-branch") {
+		t.Errorf("expected the missing -to-branch reported, got %v", err)
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"deploy"}, expected: `unknown command "deploy"`},
+		{args: []string{"lookup", "276e9d4"}, expected: "at least one -raw file must be given"},
+		{args: []string{"lookup", "-raw", "today.json", "276e9"}, expected: `commit SHA "276e9" is too short`},
+		// bare invocation is collect
+		{args: []string{"-from-raw", "missing.json"}, expected: "missing.json"},
+		{args: []string{"collect", "-since", "yesterday", "-from-raw", "missing.json"}, expected: `unable to parse -since "yesterday" as a duration or a date`},
+		{args: []string{"compare", "-from", "quay.io/x:1"}, expected: "both -from and -to payloads must be set"},
+	}
+	for _, test := range tests {
+		err := run(test.args)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.args, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// command is a subcommand with its own flags. Flags shared by all subcommands are
+// attached via sharedOptions.
+type command struct {
+	name        string
+	description string
+	usage       string
+	flags       *flag.FlagSet
+	run         func(ctx context.Context, args []string) error
+}
+
+func newCommand(name, description, usage string) *command {
+	cmd := &command{
+		name:        name,
+		description: description,
+		usage:       usage,
+		flags:       flag.NewFlagSet(name, flag.ExitOnError),
+	}
+	cmd.flags.Usage = func() {
+		fmt.Fprintf(cmd.flags.Output(), "Usage: ocp-what-merged %s [flags]\n\n%s\n\n%s\n\nFlags:\n", cmd.name, cmd.description, strings.TrimSpace(cmd.usage))
+		cmd.flags.PrintDefaults()
+	}
+	return cmd
+}
+
+// verbose is set by the -v flag
+var verbose bool
+
+func logVerbose(format string, args ...interface{}) {
+	if verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// sharedOptions are flags attached to every subcommand.
+type sharedOptions struct {
+	token       string
+	apiURL      string
+	apiVersion  string
+	output      string
+	outputMode  fileModeValue
+	mkdirs      bool
+	format      string
+	concurrency int
+	cache       string
+	apiBudget   int
+
+	requestsPerSecond int
+
+	appID             int64
+	appInstallationID int64
+	appPrivateKeyFile string
+
+	harFile      string
+	harMaxBodyKB int
+	fromHAR      string
+
+	sourceAnnotations commaSeparatedList
+	skipTokenCheck    bool
+	traceFile         string
+	templateFile      string
+	templateName      string
+	width             int
+	maxWrappedLines   int
+	durationStyle     durationStyleValue
+
+	// template is parsed by loadTemplate, before any request is made
+	template *template.Template
+
+	// tracer records spans when -trace-file or -v is set
+	tracer *traceRecorder
+
+	// usage, throttling, clock and versions are set once the Github client is created
+	usage      *APIUsage
+	throttling *throttlingTransport
+	clock      *clockSkewTransport
+	versions   *apiVersionTransport
+	// tokenCheck verifies the token once for all queries of the command
+	tokenCheck sync.Once
+	tokenErr   error
+	recorder   *harRecorder
+	replay     *harReplayTransport
+}
+
+func (o *sharedOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.token, "token", "", "Github token (defaults to GITHUB_TOKEN env variable)")
+	fs.Int64Var(&o.appID, "app-id", 0, "ID of the Github App to authenticate as instead of -token, with -app-installation-id and -app-private-key-file (installation tokens are refreshed before they expire)")
+	fs.Int64Var(&o.appInstallationID, "app-installation-id", 0, "ID of the Github App installation in the organization of the repositories")
+	fs.StringVar(&o.appPrivateKeyFile, "app-private-key-file", "", "PEM file with the private key of the Github App")
+	fs.StringVar(&o.apiURL, "github-api-url", "", "Base URL of the Github API to talk to instead of https://api.github.com/ (eg. a server replaying recorded responses)")
+	fs.StringVar(&o.apiVersion, "github-api-version", defaultGithubAPIVersion, "Github REST API version to request (X-GitHub-Api-Version header), endpoints responding with deprecation headers are listed after the run (empty requests none)")
+	fs.StringVar(&o.harFile, "har-file", "", "Record the Github requests and responses into this HAR 1.2 file (the Authorization header is redacted), written at the end of the run")
+	fs.IntVar(&o.harMaxBodyKB, "har-max-body-kb", defaultHARMaxBodyKB, "Size in KB longer response bodies are truncated to in the -har-file (0 means no limit), truncated responses can't be replayed")
+	fs.StringVar(&o.fromHAR, "from-har", "", "Respond to Github requests with the responses recorded by -har-file instead of talking to Github (no token needed), requests without a recorded response fail")
+	fs.StringVar(&o.output, "output", "", "File to write the output to (defaults to stdout), it is replaced only once the output is complete")
+	fs.Var(&o.outputMode, "output-file-mode", fmt.Sprintf("Permissions of the -output (and job output) files, eg. '0640' (defaults to those of the replaced file, or %#o)", defaultOutputFileMode))
+	fs.BoolVar(&o.mkdirs, "mkdirs", false, "Create the missing directories of the -output (and job output) files")
+	fs.StringVar(&o.format, "format", formatTable, "Output format, 'table', 'json', 'junit', 'template', 'csv', 'html' or 'triage' (markdown task lists of the changes)")
+	fs.StringVar(&o.templateFile, "template-file", "", "Go text/template file rendering the output with -format template (see README for the data passed to it)")
+	fs.StringVar(&o.templateName, "template", "", "Example template to render the output with -format template, 'slack' or 'changelog'")
+	fs.IntVar(&o.concurrency, "concurrency", 10, "Number of repositories processed in parallel")
+	fs.StringVar(&o.cache, "cache", "", "File to persist payload and Github responses between runs")
+	fs.IntVar(&o.apiBudget, "api-budget", 0, "Stop making optional Github requests (pull requests, owners, ...) after this number of requests in total")
+	fs.IntVar(&o.requestsPerSecond, "requests-per-second", 10, "Average number of Github requests per second shared by all repositories, with bursts of up to 1.5 times as many (0 disables the limit, search requests are always limited to 30 per minute)")
+	o.sourceAnnotations = append(commaSeparatedList{}, defaultSourceAnnotations...)
+	fs.Var(&o.sourceAnnotations, "source-annotation", "Comma separated list of payload image annotations to try, in order, to find the source repository")
+	fs.IntVar(&o.width, "width", 0, fmt.Sprintf("Width the table output wraps commit messages to, defaults to the width of the terminal (or %d when the output is not a terminal)", defaultTableWidth))
+	fs.IntVar(&o.maxWrappedLines, "max-wrapped-lines", defaultMaxWrappedLines, "Maximum number of lines a wrapped commit message is shown with in the table output (0 means no limit)")
+	fs.Var(&o.durationStyle, "duration-style", "How relative times and durations are rendered: 'humanized' ('3 hours ago', '2h10m'), 'compact' ('3h ago', '2d4h') or 'numeric' ISO 8601 durations ('-PT3H', 'P2DT4H')")
+	fs.Var(timezoneValue{}, "timezone", "Time zone to render times in (eg. 'UTC', 'Asia/Shanghai'), defaults to the local one")
+	fs.BoolVar(&verbose, "v", false, "Log more details (eg. warnings printed by oc)")
+	fs.StringVar(&o.traceFile, "trace-file", "", "Write timing of payload extraction, repositories and rendering into this file (Chrome trace event format, see about:tracing or Perfetto)")
+	fs.BoolVar(&o.skipTokenCheck, "skip-token-check", false, "Do not verify the Github token and its access to the repositories before processing them")
+}
+
+// durations returns the formatter of the -duration-style rendering times relative to now, each collection renders
+// them relative to its start.
+func (o *sharedOptions) durations(now time.Time) Formatter {
+	return newFormatter(string(o.durationStyle), now)
+}
+
+// messageWrap returns how the table output wraps the messages.
+func (o *sharedOptions) messageWrap() MessageWrap {
+	return MessageWrap{Width: o.width, MaxLines: o.maxWrappedLines}
+}
+
+// githubClient returns the client authenticated by the token (or the Github App), its requests are accounted in the
+// API usage.
+func (o *sharedOptions) githubClient() (*github.Client, error) {
+	if len(o.fromHAR) > 0 && len(o.harFile) > 0 {
+		return nil, fmt.Errorf("-from-har and -har-file are mutually exclusive")
+	}
+	// the recorder is beneath the authentication to record (and redact) the Authorization header
+	base := http.DefaultTransport
+	if len(o.harFile) > 0 {
+		o.recorder = newHARRecorder(base, o.harMaxBodyKB)
+		base = o.recorder
+	}
+	httpClient := &http.Client{}
+	if len(o.fromHAR) > 0 {
+		var err error
+		if o.replay, err = newHARReplayTransport(o.fromHAR); err != nil {
+			return nil, err
+		}
+		httpClient.Transport = o.replay
+	} else {
+		tokens, err := o.tokenSource()
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, tokens), Base: base}
+	}
+	o.usage = NewAPIUsage(o.apiBudget)
+	o.versions = newAPIVersionTransport(httpClient.Transport, o.apiVersion)
+	o.clock = &clockSkewTransport{base: o.versions, now: time.Now}
+	o.throttling = newThrottlingTransport(o.clock, o.requestsPerSecond)
+	httpClient.Transport = &countingTransport{base: o.throttling, usage: o.usage}
+	return newGithubClient(httpClient, o.apiURL)
+}
+
+// tokenSource returns the installation tokens of the Github App with -app-id, the -token (or GITHUB_TOKEN) otherwise.
+func (o *sharedOptions) tokenSource() (oauth2.TokenSource, error) {
+	if o.appAuth() {
+		return o.appTokenSource()
+	}
+	githubToken := o.token
+	if len(githubToken) == 0 {
+		githubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	if len(githubToken) == 0 {
+		return nil, fmt.Errorf(":-( I need you to set GITHUB_TOKEN env variable (or -token flag) in order to be able to talk to Github")
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken}), nil
+}
+
+// newGithubClient returns the client of the Github API at apiURL, the public one when it is empty.
+func newGithubClient(httpClient *http.Client, apiURL string) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if len(apiURL) == 0 {
+		return client, nil
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+	if err != nil || len(baseURL.Host) == 0 {
+		return nil, fmt.Errorf("invalid -github-api-url %q, expected an URL like https://api.github.com/", apiURL)
+	}
+	client.BaseURL = baseURL
+	return client, nil
+}
+
+// loadTemplate parses the template of -format template, so errors in it are reported before any request is made.
+func (o *sharedOptions) loadTemplate() error {
+	if o.format != formatTemplate {
+		if len(o.templateFile) > 0 || len(o.templateName) > 0 {
+			return fmt.Errorf("-template-file and -template require -format %s", formatTemplate)
+		}
+		return nil
+	}
+	var err error
+	o.template, err = parseTemplate(o.templateFile, o.templateName)
+	return err
+}
+
+// clockSkew returns how far the Github clock is ahead of the local one, zero when the client was not created by
+// githubClient.
+func (o *sharedOptions) clockSkew(ctx context.Context, client *github.Client) (time.Duration, error) {
+	if o.clock == nil {
+		return 0, nil
+	}
+	return measureClockSkew(ctx, client, o.clock)
+}
+
+// checkToken verifies the token unless -skip-token-check is set, the repositories of the first query of the command
+// are used to check the access.
+func (o *sharedOptions) checkToken(ctx context.Context, client *github.Client, repositories []string) error {
+	if o.skipTokenCheck {
+		return nil
+	}
+	o.tokenCheck.Do(func() {
+		if o.appAuth() {
+			o.tokenErr = checkInstallationAccess(ctx, client, o.appInstallationID, repositories)
+			return
+		}
+		o.tokenErr = checkToken(ctx, client, repositories)
+	})
+	return o.tokenErr
+}
+
+// withTracing records spans of the returned context, when they are written to -trace-file or summarized by -v.
+func (o *sharedOptions) withTracing(ctx context.Context) context.Context {
+	if len(o.traceFile) == 0 && !verbose {
+		return ctx
+	}
+	o.tracer = &traceRecorder{}
+	return withRecorder(ctx, o.tracer)
+}
+
+// finishTracing writes the recorded spans into -trace-file and prints the slowest repositories with -v.
+func (o *sharedOptions) finishTracing() error {
+	if o.tracer == nil {
+		return nil
+	}
+	if verbose {
+		o.tracer.PrintSlowest(os.Stderr, 10)
+	}
+	if len(o.traceFile) == 0 {
+		return nil
+	}
+	return o.tracer.WriteChromeTrace(o.traceFile)
+}
+
+// finishHAR writes the recorded requests into -har-file, and reports requests -from-har had no response of.
+func (o *sharedOptions) finishHAR() error {
+	if o.replay != nil && o.replay.Unmatched() > 0 {
+		log.Printf("WARNING: %d Github requests had no recorded response in %s", o.replay.Unmatched(), o.fromHAR)
+	}
+	if o.recorder == nil {
+		return nil
+	}
+	return o.recorder.Write(o.harFile, os.FileMode(o.outputMode), o.mkdirs)
+}
+
+// printAPIUsage prints the breakdown of Github requests made by the command.
+func (o *sharedOptions) printAPIUsage() {
+	if o.usage != nil {
+		o.usage.Print(os.Stderr)
+	}
+	if o.versions != nil {
+		printAPIDeprecations(os.Stderr, o.versions.Deprecations(), o.apiVersion)
+	}
+	if o.throttling != nil {
+		logVerbose("Github requests waited %s in total for the -requests-per-second and search API limits", o.throttling.Waited().Round(time.Millisecond))
+	}
+}
+
+// recordRateLimits sets the Github rate limits seen by the first and the last request of the command.
+func (o *sharedOptions) recordRateLimits(p *Provenance) {
+	if o.usage != nil {
+		p.RateLimitStart, p.RateLimitEnd = o.usage.RateLimits()
+	}
+}
+
+// apiDeprecations returns the Github API endpoints responding with deprecation headers.
+func (o *sharedOptions) apiDeprecations() []APIDeprecation {
+	if o.versions == nil {
+		return nil
+	}
+	return o.versions.Deprecations()
+}
+
+func (o *sharedOptions) apiRequests() map[string]int {
+	if o.usage == nil {
+		return nil
+	}
+	return o.usage.Requests()
+}
+
+// openOutput returns the writer for the command output, the caller must close it.
+func (o *sharedOptions) openOutput() (io.WriteCloser, error) {
+	if len(o.output) == 0 {
+		return nopCloser{os.Stdout}, nil
+	}
+	return o.createOutput(o.output)
+}
+
+// createOutput returns the writer of an output file, which replaces the file once it is closed.
+func (o *sharedOptions) createOutput(path string) (io.WriteCloser, error) {
+	return createAtomicFile(path, os.FileMode(o.outputMode), o.mkdirs)
+}
+
+func (o *sharedOptions) loadCache() (*Cache, error) {
+	if len(o.cache) == 0 {
+		return NewCache(), nil
+	}
+	return loadCache(o.cache)
+}
+
+func (o *sharedOptions) saveCache(cache *Cache) error {
+	if len(o.cache) == 0 {
+		return nil
+	}
+	return cache.Save(o.cache)
+}
+
+// changesQuery is a query of a command collecting changes, run from the command line or by a job of the jobs file.
+type changesQuery interface {
+	addFlags(fs *flag.FlagSet)
+	validate() error
+	// needsGithub reports whether collect talks to Github
+	needsGithub() bool
+	// collect lists the changes of the repositories, the query decides which repositories to list when none are given
+	collect(ctx context.Context, client *github.Client, shared *sharedOptions, repos []string, cache *Cache) (*queryResult, error)
+	// render writes the result into out in the format
+	render(out io.Writer, format string, result *queryResult) error
+}
+
+// commaSeparatedList is a flag value replacing its default with the comma separated values given.
+type commaSeparatedList []string
+
+func (l *commaSeparatedList) String() string { return strings.Join(*l, ",") }
+
+func (l *commaSeparatedList) Set(value string) error {
+	*l = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// repeatableList is a flag value collecting the comma separated values of all its occurrences.
+type repeatableList []string
+
+func (l *repeatableList) String() string { return strings.Join(*l, ",") }
+
+func (l *repeatableList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func commands() []*command {
+	return []*command{
+		newCollectCommand(),
+		newCompareCommand(),
+		newServeCommand(),
+		newLookupCommand(),
+		newWhenceCommand(),
+		newTrendCommand(),
+		newDiffCommand(),
+		newDepsCommand(),
+	}
+}
+
+func printUsage(w io.Writer, cmds []*command) {
+	fmt.Fprintf(w, "Usage: ocp-what-merged [command] [flags]\n\nCommands:\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "\nWithout a command, 'collect' is used. Run 'ocp-what-merged <command> -h' for the command flags.\n")
+}
+
+// exitError makes the command exit with the given code, for results (rather than failures) automation
+// needs to tell apart.
+type exitError struct {
+	code    int
+	message string
+}
+
+func (e *exitError) Error() string {
+	return e.message
+}
+
+// run dispatches the arguments to a subcommand, bare invocation behaves like "collect".
+func run(args []string) error {
+	cmds := commands()
+	name := "collect"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout, cmds)
+		return nil
+	}
+	for _, cmd := range cmds {
+		if cmd.name != name {
+			continue
+		}
+		cmd.flags.Parse(args)
+		return cmd.run(context.Background(), cmd.flags.Args())
+	}
+	printUsage(os.Stderr, cmds)
+	return fmt.Errorf("unknown command %q", name)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// CompareRange are the refs to compare in a repository.
+type CompareRange struct {
+	Base string
+	Head string
+}
+
+// getRepositoryComparison lists the commits present in head but not in base ref.
+func getRepositoryComparison(ctx context.Context, client *github.Client, organization, name string, compare CompareRange) ([]*github.RepositoryCommit, error) {
+	comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, compare.Base, compare.Head)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*github.RepositoryCommit, len(comparison.Commits))
+	for i := range comparison.Commits {
+		commits[i] = &comparison.Commits[i]
+	}
+	return commits, nil
+}
+
+// Rebuild is a payload image that changed between two payloads while its source commit didn't
+// (eg. because of base image or build configuration change).
+type Rebuild struct {
+	Tag        string `header:"Tag" json:"tag"`
+	Repository string `header:"Repository" json:"repository"`
+	Commit     string `header:"Commit" json:"commit"`
+	OldDigest  string `header:"Old Digest" json:"oldDigest"`
+	NewDigest  string `header:"New Digest" json:"newDigest"`
+}
+
+// Component change kinds of payload tags
+const (
+	componentRenamed = "renamed"
+	componentAdded   = "added"
+	componentRemoved = "removed"
+)
+
+// ComponentChange is a payload tag renamed, added or removed between two payloads.
+type ComponentChange struct {
+	Kind string `header:"Change" json:"kind"`
+	// Tag is the new name of renamed tags
+	Tag        string `header:"Tag" json:"tag"`
+	OldTag     string `json:"oldTag,omitempty"`
+	Repository string `header:"Repository" json:"repository,omitempty"`
+}
+
+// tagPair is a payload tag in the from and the to payloads.
+type tagPair struct {
+	from, to Tag
+}
+
+// matchTags pairs the tags of the payloads by name and then, as tags are sometimes renamed between minor versions
+// (eg. "cluster-foo-operator" becomes "foo-operator"), the remaining tags by their source repository. Tags matched
+// neither way were added or removed.
+func matchTags(from, to *Release, sourceAnnotations []string) ([]tagPair, []ComponentChange) {
+	fromTags := map[string]Tag{}
+	for _, t := range from.Refs.Spec.Tags {
+		fromTags[t.Name] = t
+	}
+	var pairs []tagPair
+	var unmatched []Tag
+	matched := map[string]bool{}
+	for _, toTag := range to.Refs.Spec.Tags {
+		if fromTag, ok := fromTags[toTag.Name]; ok {
+			pairs = append(pairs, tagPair{from: fromTag, to: toTag})
+			matched[toTag.Name] = true
+		} else {
+			unmatched = append(unmatched, toTag)
+		}
+	}
+	var changes []ComponentChange
+	for _, toTag := range unmatched {
+		repository, _, _, ok := toTag.Source(sourceAnnotations)
+		renamed := false
+		for _, fromTag := range from.Refs.Spec.Tags {
+			if matched[fromTag.Name] {
+				continue
+			}
+			if fromRepository, _, _, fromOK := fromTag.Source(sourceAnnotations); ok && fromOK && fromRepository == repository {
+				pairs = append(pairs, tagPair{from: fromTag, to: toTag})
+				matched[fromTag.Name] = true
+				changes = append(changes, ComponentChange{Kind: componentRenamed, Tag: toTag.Name, OldTag: fromTag.Name, Repository: repository})
+				renamed = true
+				break
+			}
+		}
+		if !renamed {
+			changes = append(changes, ComponentChange{Kind: componentAdded, Tag: toTag.Name, Repository: repository})
+		}
+	}
+	for _, fromTag := range from.Refs.Spec.Tags {
+		if !matched[fromTag.Name] {
+			repository, _, _, _ := fromTag.Source(sourceAnnotations)
+			changes = append(changes, ComponentChange{Kind: componentRemoved, Tag: fromTag.Name, Repository: repository})
+		}
+	}
+	return pairs, changes
+}
+
+// renderedTag is the tag of the change, "OLD → NEW" for renamed tags.
+func (c ComponentChange) renderedTag() string {
+	if c.Kind == componentRenamed {
+		return c.OldTag + " → " + c.Tag
+	}
+	return c.Tag
+}
+
+// compareRanges returns the repositories whose commit changed between the payloads, with the commits to compare.
+// The commits are those of the repositories, so the changes of renamed tags are listed like those of any other tag.
+func compareRanges(from, to *Release, sourceAnnotations []string) ([]string, map[string]CompareRange) {
+	fromCommits, toCommits := from.Commits(sourceAnnotations), to.Commits(sourceAnnotations)
+	toRepositories, _, _ := to.Repositories(sourceAnnotations)
+	fromRepositories, _, _ := from.Repositories(sourceAnnotations)
+	var repos []string
+	ranges := map[string]CompareRange{}
+	for _, repository := range toRepositories {
+		fromCommit, ok := fromCommits[repository]
+		if !ok {
+			log.Printf("[%s] was added to the payload", repository)
+			continue
+		}
+		if toCommit := toCommits[repository]; toCommit != fromCommit {
+			ranges[repository] = CompareRange{Base: fromCommit, Head: toCommit}
+			repos = append(repos, repository)
+		}
+	}
+	for _, repository := range fromRepositories {
+		if _, ok := toCommits[repository]; !ok {
+			log.Printf("[%s] was removed from the payload", repository)
+		}
+	}
+	return repos, ranges
+}
+
+// findRebuilds returns payload tags whose image digest changed while the source commit remained the same, renamed
+// tags are compared with their old name.
+func findRebuilds(from, to *Release, sourceAnnotations []string) []Rebuild {
+	pairs, _ := matchTags(from, to, sourceAnnotations)
+	var rebuilds []Rebuild
+	for _, pair := range pairs {
+		fromTag, toTag := pair.from, pair.to
+		repository, commit, _, _ := toTag.Source(sourceAnnotations)
+		if _, fromCommit, _, _ := fromTag.Source(sourceAnnotations); len(commit) == 0 || fromCommit != commit {
+			continue
+		}
+		oldDigest, newDigest := fromTag.From.Digest(), toTag.From.Digest()
+		if len(oldDigest) == 0 || len(newDigest) == 0 || oldDigest == newDigest {
+			continue
+		}
+		rebuilds = append(rebuilds, Rebuild{
+			Tag:        toTag.Name,
+			Repository: repository,
+			Commit:     commit,
+			OldDigest:  oldDigest,
+			NewDigest:  newDigest,
+		})
+	}
+	return rebuilds
+}
+
+type compareOptions struct {
+	from       string
+	to         string
+	fromBranch string
+	toBranch   string
+	payload    string
+	withPRs    bool
+
+	withVersions            bool
+	failOnVersionRegression bool
+}
+
+func (o *compareOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.from, "from", "", "Payload to compare from (eg. 'quay.io/openshift-release-dev/ocp-release:4.9.0-fc.0-x86_64')")
+	fs.StringVar(&o.to, "to", "", "Payload to compare to")
+	fs.StringVar(&o.fromBranch, "from-branch", "", "Branch to compare from (eg. 'release-4.9')")
+	fs.StringVar(&o.toBranch, "to-branch", "", "Branch to compare to (eg. 'master')")
+	fs.StringVar(&o.payload, "payload", defaultPayloadFlag(), "Payload URL to use to determine list of repositories when comparing branches")
+	fs.BoolVar(&o.withPRs, "with-prs", false, "Show the pull request that merged each change")
+	fs.BoolVar(&o.withVersions, "with-versions", false, "Show component versions of the images built from each repository (payload comparison only)")
+	fs.BoolVar(&o.failOnVersionRegression, "fail-on-version-regression", false, "Exit with an error when a component version went backwards between the payloads")
+}
+
+func (o *compareOptions) validate() error {
+	payloads := len(o.from) > 0 || len(o.to) > 0
+	branches := len(o.fromBranch) > 0 || len(o.toBranch) > 0
+	switch {
+	case payloads && branches:
+		return fmt.Errorf("-from/-to and -from-branch/-to-branch are mutually exclusive")
+	case payloads && (len(o.from) == 0 || len(o.to) == 0):
+		return fmt.Errorf("both -from and -to payloads must be set")
+	case branches && (len(o.fromBranch) == 0 || len(o.toBranch) == 0):
+		return fmt.Errorf("both -from-branch and -to-branch must be set")
+	case !payloads && !branches:
+		return fmt.Errorf("either -from/-to payloads or -from-branch/-to-branch must be set")
+	case branches && (o.withVersions || o.failOnVersionRegression):
+		return fmt.Errorf("-with-versions and -fail-on-version-regression require -from/-to payloads")
+	}
+	return nil
+}
+
+func newCompareCommand() *command {
+	cmd := newCommand("compare", "List changes between two payloads or two branches", `
+Examples:
+  # changes that made it into the payload since the previous one
+  ocp-what-merged compare -from quay.io/openshift-release-dev/ocp-release:4.9.0-fc.0-x86_64 -to quay.io/openshift-release-dev/ocp-release:4.9.0-fc.1-x86_64
+
+  # changes merged to master that are not in release-4.9 branch
+  ocp-what-merged compare -from-branch release-4.9 -to-branch master
+`)
+	shared := &sharedOptions{}
+	options := &compareOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		return runCompare(ctx, shared, options)
+	}
+	return cmd
+}
+
+func runCompare(ctx context.Context, shared *sharedOptions, o *compareOptions) error {
+	return runQuery(ctx, shared, o, nil)
+}
+
+func (o *compareOptions) needsGithub() bool {
+	return true
+}
+
+// collect lists the changes between the payloads, or between the branches of the repositories (of the payload when
+// there are none).
+func (o *compareOptions) collect(ctx context.Context, client *github.Client, shared *sharedOptions, repos []string, cache *Cache) (*queryResult, error) {
+	processOptions := ProcessOptions{
+		Concurrency:      shared.concurrency,
+		BranchName:       o.toBranch,
+		WithPullRequests: o.withPRs,
+		Compare:          map[string]CompareRange{},
+		Cache:            cache,
+		Durations:        shared.durations(time.Now()),
+	}
+
+	var (
+		rebuilds    []Rebuild
+		regressions []VersionRegression
+		versions    map[string]map[string]string
+		toRelease   *Release
+		components  []ComponentChange
+	)
+	if len(o.from) > 0 {
+		fromRelease, err := getReleaseInfo(o.from)
+		if err != nil {
+			return nil, err
+		}
+		toRelease, err = getReleaseInfo(o.to)
+		if err != nil {
+			return nil, err
+		}
+		repos, processOptions.Compare = compareRanges(fromRelease, toRelease, shared.sourceAnnotations)
+		rebuilds = findRebuilds(fromRelease, toRelease, shared.sourceAnnotations)
+		_, components = matchTags(fromRelease, toRelease, shared.sourceAnnotations)
+		for _, c := range components {
+			log.Printf("Component %s was %s", c.renderedTag(), c.Kind)
+		}
+		regressions = findVersionRegressions(fromRelease, toRelease)
+		for _, r := range regressions {
+			log.Printf("WARNING: %s %s version went backwards from %s to %s", r.Tag, r.Component, r.From, r.To)
+		}
+		if o.withVersions {
+			versions = toRelease.TagVersions()
+		}
+		log.Printf("Processing %d repositories changed between %s and %s ...", len(repos), o.from, o.to)
+	} else {
+		if len(repos) == 0 {
+			var err error
+			if o.payload, err = resolvePayload(o.payload); err != nil {
+				return nil, err
+			}
+			if repos, _, err = getCachedRepositoriesFromPayload(o.payload, shared.sourceAnnotations, cache); err != nil {
+				return nil, err
+			}
+		}
+		for _, repository := range repos {
+			processOptions.Compare[repository] = CompareRange{Base: o.fromBranch, Head: o.toBranch}
+		}
+		log.Printf("Processing %d repositories for commits in %s branch missing in %s branch ...", len(repos), o.toBranch, o.fromBranch)
+	}
+
+	if err := shared.checkToken(ctx, client, repos); err != nil {
+		return nil, err
+	}
+	changes, errs, err := processRepositories(ctx, client, processOptions, repos)
+	if err != nil {
+		return nil, err
+	}
+	if o.withVersions {
+		changes = annotateVersions(changes, toRelease.RepositoryVersions(shared.sourceAnnotations))
+	}
+	result := &queryResult{Options: processOptions, Changes: changes, Errors: errs, Rebuilt: rebuilds, Components: components, Regressions: regressions, Versions: versions}
+	if o.failOnVersionRegression && len(regressions) > 0 {
+		result.Failed = fmt.Errorf("%d component versions went backwards between %s and %s", len(regressions), o.from, o.to)
+	}
+	return result, nil
+}
+
+func (o *compareOptions) render(out io.Writer, format string, result *queryResult) error {
+	durations := formatterOrNow(result.Options.Durations)
+	formatDurations(result.Changes, durations)
+	if err := writeReport(out, format, Report{Changes: result.Changes, Errors: result.Errors, Rebuilt: result.Rebuilt, Components: result.Components, Regressions: result.Regressions, Versions: result.Versions, APIRequests: result.APIRequests, APIDeprecations: result.APIDeprecations, Template: result.Template, Wrap: result.Wrap, Durations: durations}); err != nil {
+		return err
+	}
+	printErrorSummary(result.Errors)
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func payloadTag(name, repository, commit, image string) Tag {
+	return Tag{
+		Name:        name,
+		Annotations: map[string]string{sourceLocationAnnotation: repository, commitIDAnnotation: commit},
+		From:        TagReference{Kind: "DockerImage", Name: image},
+	}
+}
+
+func TestFindRebuilds(t *testing.T) {
+	from := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{
+		payloadTag("cli", "https://github.com/openshift/oc", "a1", "quay.io/ocp@sha256:1"),
+		payloadTag("console", "https://github.com/openshift/console", "b1", "quay.io/ocp@sha256:2"),
+		payloadTag("installer", "https://github.com/openshift/installer", "c1", "quay.io/ocp@sha256:3"),
+		payloadTag("tests", "https://github.com/openshift/origin", "d1", "quay.io/ocp:tests"),
+	}}}}
+	to := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{
+		// rebuilt without source change
+		payloadTag("cli", "https://github.com/openshift/oc", "a1", "quay.io/ocp@sha256:10"),
+		// source changed
+		payloadTag("console", "https://github.com/openshift/console", "b2", "quay.io/ocp@sha256:20"),
+		// unchanged
+		payloadTag("installer", "https://github.com/openshift/installer", "c1", "quay.io/ocp@sha256:3"),
+		// not referenced by digest
+		payloadTag("tests", "https://github.com/openshift/origin", "d1", "quay.io/ocp:tests-2"),
+		// added
+		payloadTag("etcd", "https://github.com/openshift/etcd", "e1", "quay.io/ocp@sha256:5"),
+	}}}}
+	expected := []Rebuild{{Tag: "cli", Repository: "https://github.com/openshift/oc", Commit: "a1", OldDigest: "sha256:1", NewDigest: "sha256:10"}}
+	rebuilds := findRebuilds(from, to, defaultSourceAnnotations)
+	if !reflect.DeepEqual(rebuilds, expected) {
+		t.Errorf("expected %+v, got %+v", expected, rebuilds)
+	}
+
+	// automation reads the rebuilds from the JSON output
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Rebuilt: rebuilds}); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Rebuilt, expected) {
+		t.Errorf("expected the rebuilds in the JSON output, got %s", out.String())
+	}
+}
+
+func TestRenamedTags(t *testing.T) {
+	from, to := readReleaseFixture(t, "renamed-from.json"), readReleaseFixture(t, "renamed-to.json")
+	pairs, components := matchTags(from, to, defaultSourceAnnotations)
+	var paired []string
+	for _, p := range pairs {
+		paired = append(paired, p.from.Name+"="+p.to.Name)
+	}
+	if expected := []string{"cli=cli", "installer=installer", "cluster-foo-operator=foo-operator"}; !reflect.DeepEqual(paired, expected) {
+		t.Errorf("expected the tags paired by name and then by repository %v, got %v", expected, paired)
+	}
+	expected := []ComponentChange{
+		{Kind: componentRenamed, Tag: "foo-operator", OldTag: "cluster-foo-operator", Repository: "https://github.com/openshift/cluster-foo-operator"},
+		{Kind: componentAdded, Tag: "new-tool", Repository: "https://github.com/openshift/new-tool"},
+		{Kind: componentRemoved, Tag: "old-tool", Repository: "https://github.com/openshift/old-tool"},
+	}
+	if !reflect.DeepEqual(components, expected) {
+		t.Errorf("expected %+v, got %+v", expected, components)
+	}
+
+	// the changes of the renamed tag are compared between the commits of both payloads
+	var (
+		repos  []string
+		ranges map[string]CompareRange
+	)
+	captureLog(t, func() { repos, ranges = compareRanges(from, to, defaultSourceAnnotations) })
+	expectedRanges := map[string]CompareRange{
+		"https://github.com/openshift/cluster-foo-operator": {Base: strings.Repeat("b1", 20), Head: strings.Repeat("b2", 20)},
+		"https://github.com/openshift/installer":            {Base: strings.Repeat("c1", 20), Head: strings.Repeat("c2", 20)},
+	}
+	if len(repos) != 2 || !reflect.DeepEqual(ranges, expectedRanges) {
+		t.Errorf("expected the ranges %v, got %v of %v", expectedRanges, ranges, repos)
+	}
+	// the renamed image is checked for rebuilds under its new name
+	if rebuilds := findRebuilds(from, to, defaultSourceAnnotations); len(rebuilds) != 1 || rebuilds[0].Tag != "cli" {
+		t.Errorf("expected only cli rebuilt, got %+v", rebuilds)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, Report{Components: components}); err != nil {
+		t.Fatal(err)
+	}
+	if table := out.String(); !strings.Contains(table, "cluster-foo-operator → foo-operator") || !strings.Contains(table, "new-tool") || !strings.Contains(table, "old-tool") {
+		t.Errorf("expected the components in the table, got:\n%s", table)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatJSON, Report{Components: components}); err != nil {
+		t.Fatal(err)
+	}
+	if json := out.String(); !strings.Contains(json, `"oldTag": "cluster-foo-operator"`) || !strings.Contains(json, `"kind": "renamed"`) {
+		t.Errorf("expected the components in the JSON, got:\n%s", json)
+	}
+
+	// a renamed tag with a rebuilt image
+	renamed := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{payloadTag("foo", "https://github.com/openshift/foo", "a1", "quay.io/ocp@sha256:2")}}}}
+	original := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{payloadTag("cluster-foo", "https://github.com/openshift/foo", "a1", "quay.io/ocp@sha256:1")}}}}
+	if rebuilds := findRebuilds(original, renamed, defaultSourceAnnotations); len(rebuilds) != 1 || rebuilds[0].Tag != "foo" || rebuilds[0].OldDigest != "sha256:1" {
+		t.Errorf("expected the renamed tag rebuilt, got %+v", rebuilds)
+	}
+}
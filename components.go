@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// maxClosestComponents is the number of component names suggested when a -component pattern matches none.
+const maxClosestComponents = 10
+
+// ComponentRepository is a payload image and the repository it is built from.
+type ComponentRepository struct {
+	Component  string `header:"Component"`
+	Repository string `header:"Repository"`
+}
+
+// ComponentRepositories returns the source repository of each payload image, but the skipped ones (see
+// -show-skipped-tags).
+func (r *Release) ComponentRepositories(sourceAnnotations []string) map[string]string {
+	components := map[string]string{}
+	for _, t := range r.Refs.Spec.Tags {
+		if len(t.skipReason(sourceAnnotations)) > 0 {
+			continue
+		}
+		repository, _, _, _ := t.Source(sourceAnnotations)
+		components[t.Name] = repository
+	}
+	return components
+}
+
+// filterComponentRepositories returns repositories of the components matching any of the glob patterns, in the
+// order of repositories. A pattern matching no component fails with the closest component names.
+func filterComponentRepositories(repositories []string, components map[string]string, patterns []string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid -component pattern %q: %v", pattern, err)
+		}
+		matched := false
+		for name, repository := range components {
+			if ok, _ := path.Match(pattern, name); ok {
+				selected[repository] = true
+				matched = true
+			}
+		}
+		if !matched {
+			var names []string
+			for name := range components {
+				names = append(names, name)
+			}
+			return nil, fmt.Errorf("no payload component matches %q, closest components are: %s", pattern, strings.Join(closestNames(pattern, names, maxClosestComponents), ", "))
+		}
+	}
+	var result []string
+	for _, r := range repositories {
+		if selected[r] {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// closestNames returns up to max names with the smallest edit distance to the query.
+func closestNames(query string, names []string, max int) []string {
+	query = strings.ToLower(strings.Trim(query, "*?"))
+	distances := map[string]int{}
+	for _, name := range names {
+		distances[name] = levenshtein(query, strings.ToLower(name))
+		// prefer names containing the query, eg. "etcd" is closest to "cluster-etcd-operator"
+		if len(query) > 0 && strings.Contains(strings.ToLower(name), query) {
+			distances[name] -= len(name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if distances[names[i]] != distances[names[j]] {
+			return distances[names[i]] < distances[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > max {
+		names = names[:max]
+	}
+	return names
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// printComponents prints the repository of each payload component, sorted by the component name.
+func printComponents(w io.Writer, components map[string]string) {
+	var rows []ComponentRepository
+	for name, repository := range components {
+		rows = append(rows, ComponentRepository{Component: name, Repository: repository})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Component < rows[j].Component })
+	tableprinter.New(w).Print(rows)
+}
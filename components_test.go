@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComponentRepositories(t *testing.T) {
+	release := readReleaseFixture(t, "release-info.json")
+	components := release.ComponentRepositories(defaultSourceAnnotations)
+	expected := map[string]string{
+		"cli":                "https://github.com/openshift/oc",
+		"cli-artifacts":      "https://github.com/openshift/oc",
+		"cluster-config-api": "https://github.com/openshift/api",
+	}
+	if !reflect.DeepEqual(components, expected) {
+		t.Fatalf("expected %v, got %v", expected, components)
+	}
+	repositories, _ := getRepositoriesFromRelease(release, defaultSourceAnnotations)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+		err      string
+	}{
+		{name: "name", patterns: []string{"cluster-config-api"}, expected: []string{"https://github.com/openshift/api"}},
+		{name: "glob", patterns: []string{"cli*"}, expected: []string{"https://github.com/openshift/oc"}},
+		{name: "repeated", patterns: []string{"cli", "cluster-*"}, expected: repositories},
+		{name: "typo", patterns: []string{"cli", "clusterconfig-api"}, err: `no payload component matches "clusterconfig-api", closest components are: cluster-config-api, cli-artifacts, cli`},
+		{name: "suffix glob", patterns: []string{"*artifacts"}, expected: []string{"https://github.com/openshift/oc"}},
+		{name: "invalid glob", patterns: []string{"cli["}, err: `invalid -component pattern "cli["`},
+	}
+	for _, test := range tests {
+		selected, err := filterComponentRepositories(repositories, components, test.patterns)
+		switch {
+		case len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.err, err)
+		case len(test.err) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case len(test.err) == 0 && !reflect.DeepEqual(selected, test.expected):
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, selected)
+		}
+	}
+}
+
+func TestClosestNames(t *testing.T) {
+	names := []string{"cluster-etcd-operator", "etcd", "machine-config-operator", "cluster-version-operator", "console"}
+	// names containing the query come first, then by edit distance
+	if closest := closestNames("etcd", append([]string{}, names...), 3); !reflect.DeepEqual(closest, []string{"cluster-etcd-operator", "etcd", "console"}) {
+		t.Errorf("unexpected closest names %v", closest)
+	}
+	if closest := closestNames("machine-config-operatr", append([]string{}, names...), 1); !reflect.DeepEqual(closest, []string{"machine-config-operator"}) {
+		t.Errorf("unexpected closest names %v", closest)
+	}
+}
+
+func TestListComponents(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "components.txt")
+	shared := &sharedOptions{sourceAnnotations: defaultSourceAnnotations, output: output}
+	o := &queryOptions{releaseInfoFile: filepath.Join("testdata", "release", "release-info.json")}
+	// without a Github client, as no token or network is needed
+	if err := listComponents(shared, o); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	// the header, its separator and the components
+	if len(lines) != 5 || !strings.Contains(lines[2], "cli ") || !strings.Contains(lines[4], "cluster-config-api") || !strings.Contains(lines[4], "https://github.com/openshift/api") {
+		t.Errorf("expected the components sorted by name, got:\n%s", data)
+	}
+}
+
+func TestRepeatableList(t *testing.T) {
+	var components repeatableList
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&components, "component", "")
+	if err := fs.Parse([]string{"-component", "cli", "-component", "etcd, *-operator,"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (repeatableList{"cli", "etcd", "*-operator"}); !reflect.DeepEqual(components, expected) {
+		t.Errorf("expected %v, got %v", expected, components)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+)
+
+// formatCSV renders a record per change for spreadsheets, with the whole messages
+const formatCSV = "csv"
+
+var csvHeader = []string{"repository", "sha", "date", "author", "pull_request", "merged_by", "url", "subject", "message"}
+
+// csvRecord returns the fields of the change in the order of csvHeader, the date in RFC 3339 in the display time
+// zone (see -timezone).
+func csvRecord(raw RawChange) []string {
+	pullRequest := ""
+	if raw.PullRequest > 0 {
+		pullRequest = fmt.Sprintf("%d", raw.PullRequest)
+	}
+	return []string{
+		repositoryName(raw.Repository),
+		raw.SHA,
+		raw.Date.In(displayLocation).Format(time.RFC3339),
+		raw.Author,
+		pullRequest,
+		raw.MergedBy,
+		raw.URL,
+		commitSubject(raw.Message),
+		raw.Message,
+	}
+}
+
+// writeCSVReport writes the changes record by record, the errors are only logged.
+func writeCSVReport(w io.Writer, report Report) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, c := range report.Changes {
+		if err := out.Write(csvRecord(c.raw)); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// cveDatabaseURL is the page of a CVE in the Red Hat CVE database
+	cveDatabaseURL = "https://access.redhat.com/security/cve/"
+	// cveSeverityURL is the Red Hat Security Data API returning the severity of a CVE
+	cveSeverityURL = "https://access.redhat.com/hydra/rest/securitydata/cve/%s.json"
+	// cveSeverityTimeout limits each request of the Red Hat Security Data API
+	cveSeverityTimeout = 10 * time.Second
+	// defaultCVESeverityLimit is the default number of CVEs whose severity is fetched by -cve-severity
+	defaultCVESeverityLimit = 50
+	// cachedCVESeverityTTL limits how long severities persisted in the cache file are reused, they are rated later
+	// than the CVE is published and may change
+	cachedCVESeverityTTL = 24 * time.Hour
+)
+
+// cveReference matches CVE identifiers (eg. "CVE-2023-44487")
+var cveReference = regexp.MustCompile(`(?i)\bCVE-[0-9]{4}-[0-9]{4,}\b`)
+
+// cveSeverities are the severities of the Red Hat Security Data API, the most severe last
+var cveSeverities = []string{"Low", "Moderate", "Important", "Critical"}
+
+// cveReferences returns the unique CVE identifiers of the texts in the order of their first occurrence, so a CVE
+// both mentioned and linked (eg. "CVE-2023-1234 (https://access.redhat.com/security/cve/CVE-2023-1234)") is
+// returned once.
+func cveReferences(texts ...string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, cve := range cveReference.FindAllString(text, -1) {
+			if cve = strings.ToUpper(cve); !seen[cve] {
+				seen[cve] = true
+				result = append(result, cve)
+			}
+		}
+	}
+	return result
+}
+
+// changeCVEs returns the CVEs referenced by the commit message or the pull request title of the change.
+func changeCVEs(raw RawChange) []string {
+	return cveReferences(raw.Message, raw.PullRequestTitle)
+}
+
+// formatCVEs renders each CVE with its severity, when known, and its link to the Red Hat CVE database.
+func formatCVEs(cves []string, severities map[string]string) string {
+	var lines []string
+	for _, cve := range cves {
+		if severity := severities[cve]; len(severity) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (%s)", cve, severity))
+		} else {
+			lines = append(lines, cve)
+		}
+		lines = append(lines, cveDatabaseURL+cve)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// severityRank orders the severities, unknown ones first.
+func severityRank(severity string) int {
+	for i, s := range cveSeverities {
+		if strings.EqualFold(s, severity) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// onlyCVEsFilter keeps only changes referencing CVEs (see -only-cves).
+type onlyCVEsFilter struct{}
+
+func (f onlyCVEsFilter) Name() string {
+	return "only-cves"
+}
+
+func (f onlyCVEsFilter) Keep(c Change) (bool, string) {
+	if len(changeCVEs(c.raw)) > 0 {
+		return true, ""
+	}
+	return false, "references no CVE"
+}
+
+// cveSeverityFetcher fetches the severities of CVEs from the Red Hat Security Data API, up to limit CVEs.
+type cveSeverityFetcher struct {
+	client *http.Client
+	url    string
+	cache  *Cache
+	limit  int
+}
+
+func newCVESeverityFetcher(cache *Cache, limit int) *cveSeverityFetcher {
+	return &cveSeverityFetcher{client: &http.Client{Timeout: cveSeverityTimeout}, url: cveSeverityURL, cache: cache, limit: limit}
+}
+
+func (f *cveSeverityFetcher) fetch(ctx context.Context, cve string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(f.url, cve), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Red Hat Security Data API responded with %s", resp.Status)
+	}
+	var data struct {
+		ThreatSeverity string `json:"threat_severity"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	return data.ThreatSeverity, nil
+}
+
+// annotate sets the severity of the CVEs referenced by the changes. CVEs whose severity can't be
+// fetched (eg. network failures, the limit was reached) are rendered without it.
+func (f *cveSeverityFetcher) annotate(ctx context.Context, changes []Change) []Change {
+	severities := map[string]string{}
+	fetched, failed, skipped := 0, 0, 0
+	for _, c := range changes {
+		for _, cve := range changeCVEs(c.raw) {
+			if _, ok := severities[cve]; ok {
+				continue
+			}
+			if severity, ok := f.cache.getCVESeverity(cve); ok {
+				severities[cve] = severity
+				continue
+			}
+			if f.limit > 0 && fetched >= f.limit {
+				severities[cve] = ""
+				skipped++
+				continue
+			}
+			fetched++
+			severity, err := f.fetch(ctx, cve)
+			if err != nil {
+				logVerbose("Unable to fetch the severity of %s: %v", cve, err)
+				failed++
+			} else {
+				f.cache.setCVESeverity(cve, severity)
+			}
+			severities[cve] = severity
+		}
+	}
+	if failed > 0 {
+		log.Printf("WARNING: unable to fetch the severity of %d CVEs, they are shown without it (see -v)", failed)
+	}
+	if skipped > 0 {
+		log.Printf("Fetched the severity of %d CVEs (-cve-severity-limit), %d more are shown without it", fetched, skipped)
+	}
+
+	result := make([]Change, len(changes))
+	for i, c := range changes {
+		raw := c.raw
+		for _, cve := range changeCVEs(raw) {
+			if len(severities[cve]) == 0 {
+				continue
+			}
+			if raw.CVESeverities == nil {
+				raw.CVESeverities = map[string]string{}
+			}
+			raw.CVESeverities[cve] = severities[cve]
+		}
+		result[i] = newChange(raw)
+	}
+	return result
+}
+
+// CVEChange is a change referencing a CVE.
+type CVEChange struct {
+	CVE        string `header:"CVE" json:"cve"`
+	Severity   string `header:"Severity" json:"severity,omitempty"`
+	Repository string `header:"Repository" json:"repository"`
+	Subject    string `header:"Subject" json:"subject"`
+	URL        string `header:"URL" json:"url"`
+}
+
+// cveChanges lists the changes of each CVE, the most severe first.
+func cveChanges(changes []Change) []CVEChange {
+	var result []CVEChange
+	for _, c := range changes {
+		for _, cve := range changeCVEs(c.raw) {
+			result = append(result, CVEChange{
+				CVE:        cve,
+				Severity:   c.raw.CVESeverities[cve],
+				Repository: repositoryName(c.raw.Repository),
+				Subject:    commitSubject(c.raw.Message),
+				URL:        c.raw.URL,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if ri, rj := severityRank(result[i].Severity), severityRank(result[j].Severity); ri != rj {
+			return ri > rj
+		}
+		return result[i].CVE < result[j].CVE
+	})
+	return result
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCVEReferences(t *testing.T) {
+	tests := []struct {
+		texts    []string
+		expected []string
+	}{
+		{texts: []string{"Fix the validation"}},
+		{
+			texts:    []string{"Bump golang.org/x/net for CVE-2023-44487 and cve-2023-39325\n\nFixes CVE-2023-44487"},
+			expected: []string{"CVE-2023-44487", "CVE-2023-39325"},
+		},
+		{
+			// the link of a mentioned CVE is not another reference
+			texts:    []string{"Fix CVE-2021-25741 (https://access.redhat.com/security/cve/CVE-2021-25741)\n\nSee https://nvd.nist.gov/vuln/detail/CVE-2021-25742"},
+			expected: []string{"CVE-2021-25741", "CVE-2021-25742"},
+		},
+		{
+			texts:    []string{"Bump the API", "OCPBUGS-1234: Fix CVE-2022-1996 in the router"},
+			expected: []string{"CVE-2022-1996"},
+		},
+		{texts: []string{"CVE-21-1234, CVE-2021-123 and XCVE-2021-12345 are not CVEs"}},
+	}
+	for _, test := range tests {
+		if references := cveReferences(test.texts...); !reflect.DeepEqual(references, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.texts, test.expected, references)
+		}
+	}
+
+	// the pull request title is searched as well
+	c := newChange(RawChange{Message: "Bump the router", PullRequestTitle: "Fix CVE-2022-1996", CVESeverities: map[string]string{"CVE-2022-1996": "Important"}})
+	if c.CVEs != "CVE-2022-1996 (Important)\nhttps://access.redhat.com/security/cve/CVE-2022-1996" {
+		t.Errorf("unexpected CVEs column %q", c.CVEs)
+	}
+	if kept, _ := (onlyCVEsFilter{}).Keep(c); !kept {
+		t.Errorf("expected the change referencing a CVE to be kept")
+	}
+	if kept, reason := (onlyCVEsFilter{}).Keep(newChange(RawChange{Message: "Bump the router"})); kept || reason != "references no CVE" {
+		t.Errorf("expected the change without CVEs to be excluded, got %v (%s)", kept, reason)
+	}
+}
+
+func TestCVESeverityFetcher(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cve := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), ".json")
+		requests[cve]++
+		switch cve {
+		case "CVE-2023-44487":
+			fmt.Fprint(w, `{"name": "CVE-2023-44487", "threat_severity": "Important"}`)
+		case "CVE-2023-39325":
+			fmt.Fprint(w, `{"name": "CVE-2023-39325", "threat_severity": "Moderate"}`)
+		case "CVE-2021-25741":
+			fmt.Fprint(w, `{"name": "CVE-2021-25741", "threat_severity": "Critical"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	cache := NewCache()
+	cache.setCVESeverity("CVE-2022-1996", "Low")
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/router", URL: "https://github.com/openshift/router/commit/a1", Message: "Bump golang.org/x/net for CVE-2023-44487 and CVE-2023-39325"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", URL: "https://github.com/openshift/oc/commit/b1", Message: "Fix CVE-2023-44487 in the client\n\nAlso CVE-2022-1996"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", URL: "https://github.com/openshift/api/commit/c1", Message: "Fix CVE-2023-0001"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", URL: "https://github.com/openshift/api/commit/c2", Message: "Fix CVE-2021-25741"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", URL: "https://github.com/openshift/api/commit/c3", Message: "Bump the API"}),
+	}
+	fetcher := newCVESeverityFetcher(cache, 3)
+	fetcher.url = server.URL + "/%s.json"
+	var annotated []Change
+	output := captureLog(t, func() {
+		annotated = fetcher.annotate(context.Background(), changes)
+	})
+
+	// each CVE is fetched once, the cached one is not fetched and does not count towards the limit
+	if !reflect.DeepEqual(requests, map[string]int{"CVE-2023-44487": 1, "CVE-2023-39325": 1, "CVE-2023-0001": 1}) {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	for _, expected := range []string{"unable to fetch the severity of 1 CVEs", "Fetched the severity of 3 CVEs (-cve-severity-limit), 1 more are shown without it"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in the log:\n%s", expected, output)
+		}
+	}
+	if !strings.HasPrefix(annotated[0].CVEs, "CVE-2023-44487 (Important)\n") || !strings.Contains(annotated[1].CVEs, "CVE-2022-1996 (Low)") {
+		t.Errorf("expected the severities in the CVEs column, got %q and %q", annotated[0].CVEs, annotated[1].CVEs)
+	}
+	// a failed request and the limit degrade to the bare CVE
+	if annotated[2].CVEs != "CVE-2023-0001\nhttps://access.redhat.com/security/cve/CVE-2023-0001" || annotated[3].CVEs != "CVE-2021-25741\nhttps://access.redhat.com/security/cve/CVE-2021-25741" {
+		t.Errorf("expected the bare CVEs, got %q and %q", annotated[2].CVEs, annotated[3].CVEs)
+	}
+	if severity, ok := cache.getCVESeverity("CVE-2023-39325"); !ok || severity != "Moderate" {
+		t.Errorf("expected the fetched severity cached, got %q", severity)
+	}
+	if _, ok := cache.getCVESeverity("CVE-2023-0001"); ok {
+		t.Errorf("expected the failed CVE not to be cached")
+	}
+
+	var order []string
+	for _, c := range cveChanges(annotated) {
+		order = append(order, c.CVE+" "+c.Severity)
+	}
+	expected := []string{"CVE-2023-44487 Important", "CVE-2023-44487 Important", "CVE-2023-39325 Moderate", "CVE-2022-1996 Low", "CVE-2021-25741 ", "CVE-2023-0001 "}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected the most severe first, got %v", order)
+	}
+
+	// the network is not reachable
+	fetcher = newCVESeverityFetcher(NewCache(), 0)
+	fetcher.url = "http://127.0.0.1:1/%s.json"
+	captureLog(t, func() {
+		annotated = fetcher.annotate(context.Background(), changes[3:4])
+	})
+	if annotated[0].CVEs != changes[3].CVEs {
+		t.Errorf("expected the bare CVE, got %q", annotated[0].CVEs)
+	}
+}
+
+func TestRenderCVEs(t *testing.T) {
+	query := &queryOptions{onlyCVEs: true}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	result := &queryResult{Changes: []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/router", URL: "https://github.com/openshift/router/commit/a1", Message: "Fix CVE-2023-44487", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", URL: "https://github.com/openshift/api/commit/c1", Message: "Bump the API", Date: now}),
+	}}
+	var out bytes.Buffer
+	captureLog(t, func() {
+		if err := query.render(&out, formatTable, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+	table := out.String()
+	for _, expected := range []string{"CVES", "Changes referencing CVEs:", "https://access.redhat.com/security/cve/CVE-2023-44487"} {
+		if !strings.Contains(table, expected) {
+			t.Errorf("expected %q in:\n%s", expected, table)
+		}
+	}
+	if strings.Contains(table, "Bump the API") {
+		t.Errorf("expected -only-cves to leave out the change without CVEs:\n%s", table)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var fingerprintDigits = regexp.MustCompile(`[0-9]+`)
+
+// CollapsedChange references a change collapsed into another one.
+type CollapsedChange struct {
+	Repository string `json:"repository"`
+	SHA        string `json:"sha"`
+	URL        string `json:"url"`
+}
+
+// messageFingerprint normalizes the first line of the commit message, so commits like
+// "Update owners for openshift/api to 4.9" and "Update owners for openshift/cli to 4.10" match.
+func messageFingerprint(c Change) string {
+	subject := strings.ToLower(strings.SplitN(c.raw.Message, "\n", 2)[0])
+	if organization, name, ok := parseRepositoryOrgName(c.raw.Repository); ok {
+		subject = strings.Replace(subject, strings.ToLower(organization+"/"+name), "", -1)
+		subject = strings.Replace(subject, strings.ToLower(name), "", -1)
+	}
+	subject = fingerprintDigits.ReplaceAllString(subject, "")
+	return strings.Join(strings.Fields(subject), " ")
+}
+
+// dedupeByMessage collapses changes with the same message fingerprint found in more than
+// threshold repositories into the earliest change of the group.
+func dedupeByMessage(changes []Change, threshold int) []Change {
+	groups := map[string][]int{}
+	var order []string
+	for i, c := range changes {
+		fingerprint := messageFingerprint(c)
+		if _, ok := groups[fingerprint]; !ok {
+			order = append(order, fingerprint)
+		}
+		groups[fingerprint] = append(groups[fingerprint], i)
+	}
+
+	collapsed := map[int]bool{}
+	result := make([]Change, len(changes))
+	copy(result, changes)
+	for _, fingerprint := range order {
+		group := groups[fingerprint]
+		repositories := map[string]bool{}
+		for _, i := range group {
+			repositories[changes[i].raw.Repository] = true
+		}
+		if len(repositories) <= threshold || len(group) < 2 {
+			continue
+		}
+		first := changes[group[0]].raw
+		for _, i := range group {
+			if changes[i].raw.Date.Before(first.Date) {
+				first = changes[i].raw
+			}
+		}
+		first.Collapsed = nil
+		for _, i := range group {
+			c := changes[i].raw
+			if c.SHA == first.SHA && c.Repository == first.Repository {
+				continue
+			}
+			first.Collapsed = append(first.Collapsed, CollapsedChange{Repository: c.Repository, SHA: c.SHA, URL: c.URL})
+			collapsed[i] = true
+		}
+		for _, i := range group {
+			if !collapsed[i] {
+				result[i] = newChange(first)
+			}
+		}
+	}
+
+	var deduped []Change
+	for i, c := range result {
+		if !collapsed[i] {
+			deduped = append(deduped, c)
+		}
+	}
+	return deduped
+}
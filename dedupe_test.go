@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageFingerprint(t *testing.T) {
+	tests := []struct {
+		name         string
+		a, b         RawChange
+		sameMessages bool
+	}{
+		{
+			name:         "versions",
+			a:            RawChange{Repository: "https://github.com/openshift/api", Message: "Updating ose-base images to be consistent with ART for 4.9"},
+			b:            RawChange{Repository: "https://github.com/openshift/oc", Message: "Updating ose-base images to be consistent with ART for 4.10"},
+			sameMessages: true,
+		},
+		{
+			name:         "repository names",
+			a:            RawChange{Repository: "https://github.com/openshift/api", Message: "Update OWNERS of openshift/api"},
+			b:            RawChange{Repository: "https://github.com/openshift/oc", Message: "Update OWNERS of openshift/oc"},
+			sameMessages: true,
+		},
+		{
+			name:         "case and body",
+			a:            RawChange{Repository: "https://github.com/openshift/api", Message: "Rotate CI secrets reference\n\nfor api"},
+			b:            RawChange{Repository: "https://github.com/openshift/oc", Message: "rotate ci secrets  reference"},
+			sameMessages: true,
+		},
+		{
+			name: "different subjects",
+			a:    RawChange{Repository: "https://github.com/openshift/api", Message: "Bump the API"},
+			b:    RawChange{Repository: "https://github.com/openshift/oc", Message: "Bump the CLI"},
+		},
+	}
+	for _, test := range tests {
+		a, b := messageFingerprint(newChange(test.a)), messageFingerprint(newChange(test.b))
+		if (a == b) != test.sameMessages {
+			t.Errorf("%s: unexpected fingerprints %q and %q", test.name, a, b)
+		}
+	}
+}
+
+func TestDedupeByMessage(t *testing.T) {
+	now := time.Now()
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a1", Message: "Updating owners for 4.9", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a2", Message: "Bump the API", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "b1", Message: "Updating owners for 4.10", Date: now.Add(-time.Hour)}),
+		newChange(RawChange{Repository: "https://github.com/openshift/console", SHA: "c1", Message: "Updating owners for 4.11", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift/console", SHA: "c2", Message: "Rotate CI secrets reference", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "b2", Message: "Rotate CI secrets reference", Date: now}),
+	}
+	tests := []struct {
+		threshold int
+		expected  []string
+		repos     map[string]string
+	}{
+		{threshold: 1, expected: []string{"a2", "b1", "c2"}, repos: map[string]string{"b1": "3 repos", "c2": "2 repos"}},
+		{threshold: 2, expected: []string{"a2", "b1", "c2", "b2"}, repos: map[string]string{"b1": "3 repos"}},
+		{threshold: 3, expected: []string{"a1", "a2", "b1", "c1", "c2", "b2"}},
+	}
+	for _, test := range tests {
+		deduped := dedupeByMessage(changes, test.threshold)
+		var shas []string
+		for _, c := range deduped {
+			shas = append(shas, c.raw.SHA)
+			if c.Repos != test.repos[c.raw.SHA] {
+				t.Errorf("threshold %d: %s: expected %q in repos column, got %q", test.threshold, c.raw.SHA, test.repos[c.raw.SHA], c.Repos)
+			}
+		}
+		if !reflect.DeepEqual(shas, test.expected) {
+			t.Errorf("threshold %d: expected changes %v, got %v", test.threshold, test.expected, shas)
+		}
+	}
+	// the earliest change of the group lists the others
+	collapsed := dedupeByMessage(changes, 1)[1].raw.Collapsed
+	expected := []CollapsedChange{{Repository: "https://github.com/openshift/api", SHA: "a1"}, {Repository: "https://github.com/openshift/console", SHA: "c1"}}
+	if !reflect.DeepEqual(collapsed, expected) {
+		t.Errorf("expected collapsed changes %+v, got %+v", expected, collapsed)
+	}
+	// the input is not modified
+	if len(changes[2].raw.Collapsed) > 0 || changes[2].Repos != "" {
+		t.Errorf("expected the input unchanged, got %+v", changes[2])
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// defaultGithubAPIVersion is the Github REST API version requested unless -github-api-version is set
+const defaultGithubAPIVersion = "2022-11-28"
+
+// githubAPIVersionHeader pins the version of the Github REST API
+const githubAPIVersionHeader = "X-GitHub-Api-Version"
+
+var (
+	// deprecationWarning matches Warning headers with the 299 (miscellaneous persistent warning) code Github
+	// deprecation notices use, eg. `299 - "This endpoint is deprecated"`
+	deprecationWarning = regexp.MustCompile(`^\s*299\s`)
+	// shaSegment matches commit SHAs in request paths
+	shaSegment = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// numberSegment matches numbers (eg. of pull requests) in request paths
+	numberSegment = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// APIDeprecation is an endpoint of the Github API responding with deprecation headers.
+type APIDeprecation struct {
+	Method   string `header:"Method" json:"method"`
+	Endpoint string `header:"Endpoint" json:"endpoint"`
+	// Deprecation and Sunset are the values of the Deprecation and Sunset headers (eg. "Sat, 01 Nov 2025 00:00:00 GMT")
+	Deprecation string `header:"Deprecated" json:"deprecation,omitempty"`
+	Sunset      string `header:"Sunset" json:"sunset,omitempty"`
+	// Warning is the 299 Warning header
+	Warning string `header:"Warning" json:"warning,omitempty"`
+	// URL is the first request to the endpoint with the headers
+	URL string `json:"url"`
+}
+
+// endpointPattern replaces the repository, commit SHAs and numbers of the request path with placeholders, so
+// requests of all the repositories count as one endpoint (eg. "/repos/:owner/:repo/commits/:sha").
+func endpointPattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case i > 0 && segments[i-1] == "repos" && i+1 < len(segments):
+			segments[i], segments[i+1] = ":owner", ":repo"
+		case i > 1 && segments[i-2] == "repos":
+		case shaSegment.MatchString(segment):
+			segments[i] = ":sha"
+		case numberSegment.MatchString(segment):
+			segments[i] = ":number"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// apiVersionTransport pins the Github API version of every request and records the endpoints responding with
+// Deprecation, Sunset or 299 Warning headers, once per endpoint.
+type apiVersionTransport struct {
+	base    http.RoundTripper
+	version string
+
+	lock         sync.Mutex
+	deprecations map[string]APIDeprecation
+}
+
+func newAPIVersionTransport(base http.RoundTripper, version string) *apiVersionTransport {
+	return &apiVersionTransport{base: base, version: version, deprecations: map[string]APIDeprecation{}}
+}
+
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.version) > 0 && len(req.Header.Get(githubAPIVersionHeader)) == 0 {
+		// a RoundTripper must not modify the request
+		req = req.Clone(req.Context())
+		req.Header.Set(githubAPIVersionHeader, t.version)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.record(req, resp.Header)
+	return resp, nil
+}
+
+func (t *apiVersionTransport) record(req *http.Request, header http.Header) {
+	deprecation := APIDeprecation{
+		Method:      req.Method,
+		Endpoint:    endpointPattern(req.URL.Path),
+		Deprecation: header.Get("Deprecation"),
+		Sunset:      header.Get("Sunset"),
+		URL:         req.URL.String(),
+	}
+	for _, warning := range header.Values("Warning") {
+		if deprecationWarning.MatchString(warning) {
+			deprecation.Warning = strings.TrimSpace(warning)
+			break
+		}
+	}
+	if len(deprecation.Deprecation) == 0 && len(deprecation.Sunset) == 0 && len(deprecation.Warning) == 0 {
+		return
+	}
+	key := deprecation.Method + " " + deprecation.Endpoint
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.deprecations[key]; !ok {
+		t.deprecations[key] = deprecation
+	}
+}
+
+// Deprecations returns the deprecated endpoints, sorted.
+func (t *apiVersionTransport) Deprecations() []APIDeprecation {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var result []APIDeprecation
+	for _, d := range t.deprecations {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Endpoint != result[j].Endpoint {
+			return result[i].Endpoint < result[j].Endpoint
+		}
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
+
+// printAPIDeprecations warns about the deprecated endpoints, so deprecations are noticed before the endpoints
+// stop working.
+func printAPIDeprecations(w io.Writer, deprecations []APIDeprecation, version string) {
+	if len(deprecations) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nWARNING: %d Github API endpoints are deprecated (API version %q):\n", len(deprecations), version)
+	tableprinter.New(w).Print(deprecations)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEndpointPattern(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/repos/openshift/api/commits":                                          "/repos/:owner/:repo/commits",
+		"/repos/openshift/api/commits/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e": "/repos/:owner/:repo/commits/:sha",
+		"/repos/openshift/api/pulls/42/commits":                                 "/repos/:owner/:repo/pulls/:number/commits",
+		"/repos/openshift/api":                                                  "/repos/:owner/:repo",
+		"/search/issues":                                                        "/search/issues",
+		"/orgs/openshift/repos":                                                 "/orgs/openshift/repos",
+	} {
+		if pattern := endpointPattern(path); pattern != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, pattern)
+		}
+	}
+}
+
+func TestAPIVersionTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Requested-Version", req.Header.Get(githubAPIVersionHeader))
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/commits"):
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", "Sat, 01 Nov 2025 00:00:00 GMT")
+		case strings.HasSuffix(req.URL.Path, "/pulls"):
+			w.Header().Add("Warning", `199 - "miscellaneous warning"`)
+			w.Header().Add("Warning", `299 - "This endpoint is deprecated"`)
+		case strings.HasSuffix(req.URL.Path, "/branches"):
+			w.Header().Set("Warning", `199 - "miscellaneous warning"`)
+		}
+	}))
+	defer server.Close()
+
+	transport := newAPIVersionTransport(http.DefaultTransport, defaultGithubAPIVersion)
+	client := &http.Client{Transport: transport}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, endpoint := range []string{"commits", "pulls", "branches"} {
+			wg.Add(1)
+			go func(url string) {
+				defer wg.Done()
+				resp, err := client.Get(url)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if version := resp.Header.Get("X-Requested-Version"); version != "2022-11-28" {
+					t.Errorf("expected the version 2022-11-28 requested, got %q", version)
+				}
+			}(fmt.Sprintf("%s/repos/openshift/repo-%d/%s", server.URL, i, endpoint))
+		}
+	}
+	wg.Wait()
+
+	deprecations := transport.Deprecations()
+	if len(deprecations) != 2 {
+		t.Fatalf("expected each deprecated endpoint once, got %+v", deprecations)
+	}
+	commits, pulls := deprecations[0], deprecations[1]
+	if commits.Method != http.MethodGet || commits.Endpoint != "/repos/:owner/:repo/commits" || commits.Deprecation != "true" || commits.Sunset != "Sat, 01 Nov 2025 00:00:00 GMT" || !strings.HasPrefix(commits.URL, server.URL+"/repos/openshift/repo-") {
+		t.Errorf("unexpected deprecation %+v", commits)
+	}
+	if pulls.Endpoint != "/repos/:owner/:repo/pulls" || pulls.Warning != `299 - "This endpoint is deprecated"` || len(pulls.Sunset) > 0 {
+		t.Errorf("unexpected deprecation %+v", pulls)
+	}
+
+	var out bytes.Buffer
+	printAPIDeprecations(&out, deprecations, defaultGithubAPIVersion)
+	if !strings.Contains(out.String(), `WARNING: 2 Github API endpoints are deprecated (API version "2022-11-28")`) || !strings.Contains(out.String(), "/repos/:owner/:repo/pulls") {
+		t.Errorf("unexpected warning:\n%s", out.String())
+	}
+	out.Reset()
+	printAPIDeprecations(&out, nil, defaultGithubAPIVersion)
+	if out.Len() > 0 {
+		t.Errorf("expected no warning without deprecations, got:\n%s", out.String())
+	}
+}
+
+func TestAPIVersionTransportKeepsRequestedVersion(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.Header.Get(githubAPIVersionHeader))
+	}))
+	defer server.Close()
+	for _, version := range []string{"", "2021-01-01"} {
+		client := &http.Client{Transport: newAPIVersionTransport(http.DefaultTransport, version)}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if resp, err := client.Do(req); err != nil {
+			t.Fatal(err)
+		} else {
+			resp.Body.Close()
+		}
+		// the version set by the request is kept
+		req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set(githubAPIVersionHeader, "2020-01-01")
+		if resp, err := client.Do(req); err != nil {
+			t.Fatal(err)
+		} else {
+			resp.Body.Close()
+		}
+		if req.Header.Get(githubAPIVersionHeader) != "2020-01-01" {
+			t.Errorf("expected the request not modified")
+		}
+	}
+	if expected := []string{"", "2020-01-01", "2021-01-01", "2020-01-01"}; strings.Join(requested, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the versions %v, got %v", expected, requested)
+	}
+}
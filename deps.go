@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+	"github.com/xxjwxc/gowp/workpool"
+)
+
+// pseudoVersionRegexp matches the three forms of pseudo-versions (vX.0.0-, vX.Y.Z-pre.0. and vX.Y.Z-0. followed
+// by the commit time and the 12 characters of the commit hash)
+var pseudoVersionRegexp = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+-(.*\.)?([0-9]{14})-([0-9a-f]{12})(\+incompatible)?$`)
+
+// parsePseudoVersion returns the commit time and the abbreviated commit hash of a pseudo-version.
+func parsePseudoVersion(version string) (time.Time, string, bool) {
+	match := pseudoVersionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return time.Time{}, "", false
+	}
+	date, err := time.Parse("20060102150405", match[2])
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return date, match[3], true
+}
+
+// ModuleRequirement is the version of a module required by a go.mod, after its replace directives.
+type ModuleRequirement struct {
+	Version string `json:"version"`
+	// Replacement is the module replacing the required one, empty when it is not replaced by another module
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// parseGoMod returns the required modules of a go.mod file, the versions of replaced modules are those of their
+// replacements. Modules replaced by local directories have the directory as the version.
+func parseGoMod(content string) map[string]ModuleRequirement {
+	requirements := map[string]ModuleRequirement{}
+	type replace struct {
+		version, path, replacementVersion string
+	}
+	replaces := map[string][]replace{}
+	block := ""
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := block
+		switch {
+		case len(block) > 0 && fields[0] == ")":
+			block = ""
+			continue
+		case len(block) == 0 && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case len(block) == 0:
+			directive, fields = fields[0], fields[1:]
+		}
+		for i := range fields {
+			fields[i] = strings.Trim(fields[i], `"`)
+		}
+		switch directive {
+		case "require":
+			if len(fields) >= 2 {
+				requirements[fields[0]] = ModuleRequirement{Version: fields[1]}
+			}
+		case "replace":
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow != 1 && arrow != 2 || arrow+1 >= len(fields) {
+				continue
+			}
+			r := replace{path: fields[arrow+1]}
+			if arrow == 2 {
+				r.version = fields[1]
+			}
+			if arrow+2 < len(fields) {
+				r.replacementVersion = fields[arrow+2]
+			}
+			replaces[fields[0]] = append(replaces[fields[0]], r)
+		}
+	}
+	for module, required := range requirements {
+		for _, r := range replaces[module] {
+			if len(r.version) > 0 && r.version != required.Version {
+				continue
+			}
+			if len(r.replacementVersion) == 0 {
+				requirements[module] = ModuleRequirement{Version: r.path}
+				break
+			}
+			replaced := ModuleRequirement{Version: r.replacementVersion}
+			if r.path != module {
+				replaced.Replacement = r.path
+			}
+			requirements[module] = replaced
+			break
+		}
+	}
+	return requirements
+}
+
+// moduleRepository returns the Github repository of a module, modules of major versions 2+ and of
+// subdirectories are in the repository of the first two path elements.
+func moduleRepository(module string) (string, string, bool) {
+	parts := strings.Split(module, "/")
+	if len(parts) < 3 || parts[0] != "github.com" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// getGoMod returns the go.mod file of the repository at the commit, or empty string when the repository has none.
+func getGoMod(ctx context.Context, client *github.Client, cache *Cache, organization, name, commit string) (string, error) {
+	if content, ok := cache.getGoMod(organization, name, commit); ok {
+		return content, nil
+	}
+	var content string
+	file, _, _, err := client.Repositories.GetContents(withCategory(ctx, categoryContents), organization, name, "go.mod", &github.RepositoryContentGetOptions{Ref: commit})
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		return "", err
+	default:
+		if content, err = file.GetContent(); err != nil {
+			return "", err
+		}
+	}
+	cache.setGoMod(organization, name, commit, content)
+	return content, nil
+}
+
+// moduleVersionDates resolves versions of modules to the dates of their commits.
+type moduleVersionDates struct {
+	client *github.Client
+	dates  map[string]*time.Time
+}
+
+// Date returns the commit date of the version: of the commit of a pseudo-version, or of the tag. The time of a
+// pseudo-version is used when the module repository can't be read, nil is returned for unknown tags.
+func (d *moduleVersionDates) Date(ctx context.Context, module, version string) *time.Time {
+	key := module + "@" + version
+	if date, ok := d.dates[key]; ok {
+		return date
+	}
+	var date *time.Time
+	ref := strings.TrimSuffix(version, "+incompatible")
+	pseudoDate, hash, pseudo := parsePseudoVersion(version)
+	if pseudo {
+		date, ref = &pseudoDate, hash
+	}
+	if organization, name, ok := moduleRepository(module); ok {
+		commit, _, err := d.client.Repositories.GetCommit(withCategory(ctx, categoryModuleVersions), organization, name, ref)
+		if err != nil {
+			logVerbose("[%s] unable to get the commit of %s: %v", module, version, err)
+		} else if commitDate := commitDate(commit); !commitDate.IsZero() {
+			date = &commitDate
+		}
+	}
+	d.dates[key] = date
+	return date
+}
+
+// DependencyVersion is the version of a module consumed by a payload component.
+type DependencyVersion struct {
+	ModuleRequirement
+	Date *time.Time `json:"date,omitempty"`
+	// Oldest is set for the consumers of the oldest version of the module in the payload
+	Oldest bool `json:"oldest,omitempty"`
+}
+
+// DependencyRow is a payload component with the versions of the modules, modules not consumed by the component
+// (or components without go.mod) are missing.
+type DependencyRow struct {
+	Component  string                        `json:"component"`
+	Repository string                        `json:"repository"`
+	Commit     string                        `json:"commit"`
+	Modules    map[string]*DependencyVersion `json:"modules"`
+	// Error is set when the go.mod could not be read
+	Error string `json:"error,omitempty"`
+}
+
+// DependencyReport is the output of the deps command.
+type DependencyReport struct {
+	Payload    string          `json:"payload"`
+	Modules    []string        `json:"modules"`
+	Components []DependencyRow `json:"components"`
+}
+
+// markOldestConsumers sets Oldest for the components consuming the oldest dated version of each module.
+func (r DependencyReport) markOldestConsumers() {
+	for _, module := range r.Modules {
+		var oldest *time.Time
+		for _, row := range r.Components {
+			if v := row.Modules[module]; v != nil && v.Date != nil && (oldest == nil || v.Date.Before(*oldest)) {
+				oldest = v.Date
+			}
+		}
+		for _, row := range r.Components {
+			if v := row.Modules[module]; v != nil && v.Date != nil && v.Date.Equal(*oldest) {
+				v.Oldest = true
+			}
+		}
+	}
+}
+
+func (r DependencyReport) matrix() ([]string, [][]string) {
+	headers := []string{"Component", "Repository"}
+	for _, module := range r.Modules {
+		headers = append(headers, module)
+	}
+	var rows [][]string
+	for _, c := range r.Components {
+		row := []string{c.Component, repositoryName(c.Repository)}
+		for _, module := range r.Modules {
+			v := c.Modules[module]
+			switch {
+			case len(c.Error) > 0:
+				row = append(row, "?")
+			case v == nil:
+				row = append(row, "-")
+			default:
+				cell := v.Version
+				if len(v.Replacement) > 0 {
+					cell = v.Replacement + " " + cell
+				}
+				if v.Date != nil {
+					cell += "\n" + v.Date.In(displayLocation).Format("2006-01-02")
+				}
+				if v.Oldest {
+					cell += " (OLDEST)"
+				}
+				row = append(row, cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+func writeDependencyReport(w io.Writer, format string, report DependencyReport) error {
+	switch format {
+	case formatTable:
+		headers, rows := report.matrix()
+		tableprinter.New(w).Render(headers, rows, nil, false)
+		return nil
+	case formatMarkdown:
+		headers, rows := report.matrix()
+		writeMarkdownTable(w, headers, rows)
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q, deps supports %s, %s and %s", format, formatTable, formatMarkdown, formatJSON)
+	}
+}
+
+type depsOptions struct {
+	payload         string
+	releaseInfoFile string
+	modules         repeatableList
+}
+
+func (o *depsOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.payload, "payload", defaultPayloadFlag(), "Payload URL whose components are listed")
+	fs.StringVar(&o.releaseInfoFile, "release-info-file", "", "Read the payload from the output of 'oc adm release info -o json' saved in this file ('-' for stdin) instead of running oc")
+	fs.Var(&o.modules, "module", "Go module whose version is shown for each component (eg. 'github.com/openshift/library-go'), can be repeated")
+}
+
+func (o *depsOptions) release() (*Release, error) {
+	if len(o.releaseInfoFile) > 0 {
+		return readReleaseInfoFile(o.releaseInfoFile)
+	}
+	return getReleaseInfo(o.payload)
+}
+
+func newDepsCommand() *command {
+	cmd := newCommand("deps", "Show which versions of Go modules the payload components consume", `
+The go.mod of each payload repository is read at the commit the payload was built from. Components
+without go.mod, or not consuming the module, show "-". Versions are resolved to the dates of their
+commits, the consumers of the oldest version of each module are marked.
+
+Examples:
+  # which components picked up the recent library-go and api changes
+  ocp-what-merged deps -module github.com/openshift/library-go -module github.com/openshift/api
+
+  # the same for a specific payload, as JSON
+  ocp-what-merged deps -payload quay.io/openshift-release-dev/ocp-release:4.9.0-x86_64 -module github.com/openshift/api -format json
+`)
+	shared := &sharedOptions{}
+	options := &depsOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		return runDeps(ctx, shared, options)
+	}
+	return cmd
+}
+
+func runDeps(ctx context.Context, shared *sharedOptions, o *depsOptions) error {
+	if len(o.modules) == 0 {
+		return fmt.Errorf("at least one -module must be given")
+	}
+	var err error
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	release, err := o.release()
+	if err != nil {
+		return err
+	}
+	components := release.ComponentRepositories(shared.sourceAnnotations)
+	commits := release.Commits(shared.sourceAnnotations)
+
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+	if err := shared.checkToken(ctx, client, dependencyRepositories(components, commits)); err != nil {
+		return err
+	}
+	report, errs, err := o.collect(ctx, client, cache, shared.concurrency, components, commits)
+	if err != nil {
+		return err
+	}
+	if err := shared.saveCache(cache); err != nil {
+		return err
+	}
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeDependencyReport(out, shared.format, report); err != nil {
+		return err
+	}
+	printErrorSummary(errs)
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return repositoryErrorsResult(errs)
+}
+
+// dependencyRepositories returns the sorted repositories of the components built from a known commit.
+func dependencyRepositories(components, commits map[string]string) []string {
+	var repositories []string
+	seen := map[string]bool{}
+	for _, repository := range components {
+		if len(commits[repository]) == 0 || seen[repository] {
+			continue
+		}
+		seen[repository] = true
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+	return repositories
+}
+
+// collect reads the go.mod of the repositories of the components (the repository of each component) at their
+// commits (of each repository) and resolves the versions of the modules to their dates.
+func (o *depsOptions) collect(ctx context.Context, client *github.Client, cache *Cache, concurrency int, components, commits map[string]string) (DependencyReport, []RepositoryError, error) {
+	repositories := dependencyRepositories(components, commits)
+	log.Printf("Reading go.mod of %d repositories ...", len(repositories))
+	var (
+		lock     sync.Mutex
+		goMods   = map[string]map[string]ModuleRequirement{}
+		errs     []RepositoryError
+		failures = map[string]string{}
+	)
+	wp := workpool.New(concurrency)
+	for i := range repositories {
+		repository := repositories[i]
+		wp.Do(func() error {
+			organization, name, ok := parseRepositoryOrgName(repository)
+			if !ok {
+				return fmt.Errorf("unable to parse repository organization or name: %q", repository)
+			}
+			content, err := getGoMod(ctx, client, cache, organization, name, commits[repository])
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.Printf("[%s] unable to read go.mod: %v", repository, err)
+				errs = append(errs, RepositoryError{Repository: repository, Kind: classifyRepositoryError(organization, err), Err: err})
+				failures[repository] = err.Error()
+				return nil
+			}
+			goMods[repository] = parseGoMod(content)
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		return DependencyReport{}, nil, err
+	}
+
+	report := DependencyReport{Payload: o.payload, Modules: o.modules}
+	if len(o.releaseInfoFile) > 0 {
+		report.Payload = o.releaseInfoFile
+	}
+	dates := &moduleVersionDates{client: client, dates: map[string]*time.Time{}}
+	for component, repository := range components {
+		if len(commits[repository]) == 0 {
+			logVerbose("[%s] component %s has no commit in the payload", repository, component)
+			continue
+		}
+		row := DependencyRow{Component: component, Repository: repository, Commit: commits[repository], Modules: map[string]*DependencyVersion{}, Error: failures[repository]}
+		for _, module := range o.modules {
+			required, ok := goMods[repository][module]
+			if !ok {
+				continue
+			}
+			v := &DependencyVersion{ModuleRequirement: required}
+			source := module
+			if len(required.Replacement) > 0 {
+				source = required.Replacement
+			}
+			if strings.HasPrefix(required.Version, "v") {
+				v.Date = dates.Date(ctx, source, required.Version)
+			}
+			row.Modules[module] = v
+		}
+		report.Components = append(report.Components, row)
+	}
+	sort.Slice(report.Components, func(i, j int) bool { return report.Components[i].Component < report.Components[j].Component })
+	report.markOldestConsumers()
+	return report, errs, nil
+}
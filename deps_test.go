@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParsePseudoVersion(t *testing.T) {
+	date := time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)
+	for _, version := range []string{
+		"v0.0.0-20210818100000-553c2077f0ed",
+		"v0.22.0-rc.0.0.20210818100000-553c2077f0ed",
+		"v1.2.4-0.20210818100000-553c2077f0ed",
+		"v2.0.0-20210818100000-553c2077f0ed+incompatible",
+	} {
+		parsed, hash, ok := parsePseudoVersion(version)
+		if !ok || !parsed.Equal(date) || hash != "553c2077f0ed" {
+			t.Errorf("%s: expected the date and hash of the commit, got %v %q %v", version, parsed, hash, ok)
+		}
+	}
+	for _, version := range []string{"v0.22.1", "v0.22.0-rc.0", "v0.0.0-2021081810-553c2077f0ed", "v0.0.0-20210818100000-553C2077F0ED", "v0.0.0-20211318100000-553c2077f0ed"} {
+		if _, _, ok := parsePseudoVersion(version); ok {
+			t.Errorf("%s: expected not to be a pseudo-version", version)
+		}
+	}
+}
+
+func TestParseGoMod(t *testing.T) {
+	requirements := parseGoMod(`module github.com/openshift/cluster-authentication-operator
+
+go 1.16
+
+require (
+	github.com/openshift/api v0.0.0-20210818100000-553c2077f0ed
+	github.com/openshift/library-go v0.0.0-20210801100000-762941318ee1 // indirect
+	k8s.io/api v0.22.0
+	k8s.io/client-go v0.22.0
+)
+
+require "github.com/spf13/cobra" v1.1.3
+
+replace (
+	// replaced by the fork
+	k8s.io/api => github.com/openshift/kubernetes-api v0.0.0-20210810100000-0123456789ab
+	k8s.io/client-go v0.21.0 => k8s.io/client-go v0.21.1
+)
+
+replace github.com/openshift/library-go => ../library-go
+`)
+	expected := map[string]ModuleRequirement{
+		"github.com/openshift/api":        {Version: "v0.0.0-20210818100000-553c2077f0ed"},
+		"github.com/openshift/library-go": {Version: "../library-go"},
+		"k8s.io/api":                      {Version: "v0.0.0-20210810100000-0123456789ab", Replacement: "github.com/openshift/kubernetes-api"},
+		// the replace of another version does not apply
+		"k8s.io/client-go":       {Version: "v0.22.0"},
+		"github.com/spf13/cobra": {Version: "v1.1.3"},
+	}
+	if !reflect.DeepEqual(requirements, expected) {
+		t.Errorf("expected %+v, got %+v", expected, requirements)
+	}
+	if requirements := parseGoMod(""); len(requirements) != 0 {
+		t.Errorf("expected no requirements, got %+v", requirements)
+	}
+}
+
+func TestModuleRepository(t *testing.T) {
+	for module, expected := range map[string]string{
+		"github.com/openshift/api":               "openshift/api",
+		"github.com/openshift/library-go/v2":     "openshift/library-go",
+		"github.com/openshift/api/config/v1/foo": "openshift/api",
+		"k8s.io/api":                             "",
+		"github.com/openshift":                   "",
+	} {
+		organization, name, ok := moduleRepository(module)
+		if repository := organization + "/" + name; ok && repository != expected || !ok && len(expected) > 0 {
+			t.Errorf("%s: expected %q, got %q (%v)", module, expected, repository, ok)
+		}
+	}
+}
+
+// fakeDepsGithub serves the go.mod of openshift/oauth-server and openshift/cluster-authentication-operator,
+// openshift/origin has none and openshift/oc fails. Commits of openshift/library-go are dated by their hash,
+// openshift/api can't be read. It returns the number of go.mod requests.
+func fakeDepsGithub(t *testing.T) (*github.Client, func() int) {
+	goMods := map[string]string{
+		"openshift/oauth-server@a1":                    "module github.com/openshift/oauth-server\n\nrequire (\n\tgithub.com/openshift/library-go v0.0.0-20210601100000-aaaaaaaaaaaa\n\tgithub.com/openshift/api v0.0.0-20210818100000-553c2077f0ed\n)\n",
+		"openshift/cluster-authentication-operator@b2": "module github.com/openshift/cluster-authentication-operator\n\nrequire github.com/openshift/library-go v0.0.0-20210801100000-bbbbbbbbbbbb\n",
+	}
+	commitDates := map[string]string{"aaaaaaaaaaaa": "2021-06-01T12:00:00Z", "bbbbbbbbbbbb": "2021-08-01T12:00:00Z"}
+	var lock sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := strings.TrimPrefix(req.URL.Path, "/repos/")
+		switch {
+		case strings.HasSuffix(path, "/contents/go.mod"):
+			lock.Lock()
+			requests++
+			lock.Unlock()
+			repository := strings.TrimSuffix(path, "/contents/go.mod")
+			if repository == "openshift/oc" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			content, ok := goMods[repository+"@"+req.URL.Query().Get("ref")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "Not Found"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(content)))
+		case strings.HasPrefix(path, "openshift/library-go/commits/"):
+			date, ok := commitDates[strings.TrimPrefix(path, "openshift/library-go/commits/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"sha": "aaaa", "commit": {"committer": {"date": %q}}}`, date)
+		case strings.HasPrefix(path, "openshift/api/commits/"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func TestDependencyReport(t *testing.T) {
+	components := map[string]string{
+		"oauth-server":                    "https://github.com/openshift/oauth-server",
+		"cluster-authentication-operator": "https://github.com/openshift/cluster-authentication-operator",
+		"tests":                           "https://github.com/openshift/origin",
+		"cli":                             "https://github.com/openshift/oc",
+		"cli-artifacts":                   "https://github.com/openshift/oc",
+		"rhel-coreos":                     "https://github.com/openshift/os",
+	}
+	commits := map[string]string{
+		"https://github.com/openshift/oauth-server":                    "a1",
+		"https://github.com/openshift/cluster-authentication-operator": "b2",
+		"https://github.com/openshift/origin":                          "c3",
+		"https://github.com/openshift/oc":                              "d4",
+	}
+	if repositories := dependencyRepositories(components, commits); len(repositories) != 4 || repositories[0] != "https://github.com/openshift/cluster-authentication-operator" {
+		t.Errorf("expected the repositories with commits once, sorted, got %v", repositories)
+	}
+
+	client, requests := fakeDepsGithub(t)
+	o := &depsOptions{payload: "4.9.0-0.nightly", modules: repeatableList{"github.com/openshift/library-go", "github.com/openshift/api"}}
+	cache := NewCache()
+	var report DependencyReport
+	var errs []RepositoryError
+	captureLog(t, func() {
+		var err error
+		if report, errs, err = o.collect(context.Background(), client, cache, 2, components, commits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(errs) != 1 || errs[0].Repository != "https://github.com/openshift/oc" {
+		t.Errorf("expected openshift/oc to fail, got %v", errs)
+	}
+	rows := map[string]DependencyRow{}
+	for _, row := range report.Components {
+		rows[row.Component] = row
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected a row per component with a commit, got %+v", report.Components)
+	}
+	libraryGo := rows["oauth-server"].Modules["github.com/openshift/library-go"]
+	if libraryGo == nil || !libraryGo.Oldest || !libraryGo.Date.Equal(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the oldest library-go dated by its commit, got %+v", libraryGo)
+	}
+	if v := rows["cluster-authentication-operator"].Modules["github.com/openshift/library-go"]; v == nil || v.Oldest {
+		t.Errorf("expected a newer library-go, got %+v", v)
+	}
+	// the module repository can't be read, the pseudo-version has the date
+	if v := rows["oauth-server"].Modules["github.com/openshift/api"]; v == nil || !v.Date.Equal(time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the api dated by its pseudo-version, got %+v", v)
+	}
+	if len(rows["tests"].Modules) != 0 || len(rows["tests"].Error) > 0 || len(rows["cli"].Error) == 0 {
+		t.Errorf("expected origin without go.mod and oc failed, got %+v and %+v", rows["tests"], rows["cli"])
+	}
+
+	var out bytes.Buffer
+	if err := writeDependencyReport(&out, formatTable, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"v0.0.0-20210601100000-aaaaaaaaaaaa", "2021-06-01 (OLDEST)", "2021-08-01", " - ", " ? "} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+	if err := writeDependencyReport(&out, "csv", report); err == nil {
+		t.Errorf("expected an unsupported format to fail")
+	}
+
+	// the go.mod files at the commits are cached
+	before := requests()
+	captureLog(t, func() {
+		if _, _, err := o.collect(context.Background(), client, cache, 2, components, commits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if n := requests() - before; n != 1 {
+		t.Errorf("expected only the failed go.mod to be fetched again, got %d requests", n)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// exitCodeDifferences is the exit code of the diff command when the runs differ, failures exit with 1.
+const exitCodeDifferences = 2
+
+// FieldChange is a single attribute that differs between the runs.
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from,omitempty"`
+	To    json.RawMessage `json:"to,omitempty"`
+}
+
+// ChangedChange is a change present in both runs with different attributes.
+type ChangedChange struct {
+	Repository string        `json:"repository"`
+	SHA        string        `json:"sha"`
+	Subject    string        `json:"subject"`
+	Fields     []FieldChange `json:"fields"`
+}
+
+// DiffReport is the output of the diff command.
+type DiffReport struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	New         []RawChange     `json:"new,omitempty"`
+	Disappeared []RawChange     `json:"disappeared,omitempty"`
+	Changed     []ChangedChange `json:"changed,omitempty"`
+}
+
+func (r DiffReport) Empty() bool {
+	return len(r.New) == 0 && len(r.Disappeared) == 0 && len(r.Changed) == 0
+}
+
+// diffChangeRow is a row of the new and disappeared changes tables.
+type diffChangeRow struct {
+	Repository string `header:"Repository"`
+	SHA        string `header:"SHA"`
+	Message    string `header:"Message"`
+}
+
+// diffFieldRow is a row of the changed attributes table.
+type diffFieldRow struct {
+	Repository string `header:"Repository"`
+	SHA        string `header:"SHA"`
+	Field      string `header:"Field"`
+	From       string `header:"From"`
+	To         string `header:"To"`
+}
+
+func diffKey(c RawChange) string {
+	return c.Repository + "\x00" + commitSubject(c.Message)
+}
+
+// diffFields returns the attributes that differ, compared by their JSON representation so the
+// field names match the saved files.
+func diffFields(from, to RawChange) ([]FieldChange, error) {
+	var fromFields, toFields map[string]json.RawMessage
+	for _, c := range []struct {
+		change RawChange
+		fields *map[string]json.RawMessage
+	}{{from, &fromFields}, {to, &toFields}} {
+		data, err := json.Marshal(c.change)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, c.fields); err != nil {
+			return nil, err
+		}
+	}
+	names := map[string]bool{}
+	for name := range fromFields {
+		names[name] = true
+	}
+	for name := range toFields {
+		names[name] = true
+	}
+	var changes []FieldChange
+	for name := range names {
+		var a, b interface{}
+		json.Unmarshal(fromFields[name], &a)
+		json.Unmarshal(toFields[name], &b)
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, FieldChange{Field: name, From: fromFields[name], To: toFields[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// diffRuns matches the changes by SHA first, then by repository and subject to account for rewritten history.
+func diffRuns(from, to *trendRun) (DiffReport, error) {
+	report := DiffReport{From: from.Source, To: to.Source}
+
+	matched := map[int]int{}
+	fromSHAs := map[string]int{}
+	for i, c := range from.Changes {
+		fromSHAs[c.SHA] = i
+	}
+	usedFrom := map[int]bool{}
+	var unmatched []int
+	for j, c := range to.Changes {
+		if i, ok := fromSHAs[c.SHA]; ok && !usedFrom[i] {
+			matched[j] = i
+			usedFrom[i] = true
+			continue
+		}
+		unmatched = append(unmatched, j)
+	}
+	fromSubjects := map[string][]int{}
+	for i, c := range from.Changes {
+		if !usedFrom[i] {
+			fromSubjects[diffKey(c)] = append(fromSubjects[diffKey(c)], i)
+		}
+	}
+	for _, j := range unmatched {
+		key := diffKey(to.Changes[j])
+		if candidates := fromSubjects[key]; len(candidates) > 0 {
+			matched[j] = candidates[0]
+			usedFrom[candidates[0]] = true
+			fromSubjects[key] = candidates[1:]
+			continue
+		}
+		report.New = append(report.New, to.Changes[j])
+	}
+	for i, c := range from.Changes {
+		if !usedFrom[i] {
+			report.Disappeared = append(report.Disappeared, c)
+		}
+	}
+
+	for j, c := range to.Changes {
+		i, ok := matched[j]
+		if !ok {
+			continue
+		}
+		fields, err := diffFields(from.Changes[i], c)
+		if err != nil {
+			return report, err
+		}
+		if len(fields) > 0 {
+			report.Changed = append(report.Changed, ChangedChange{Repository: c.Repository, SHA: c.SHA, Subject: commitSubject(c.Message), Fields: fields})
+		}
+	}
+	return report, nil
+}
+
+func diffChangeRows(changes []RawChange) []diffChangeRow {
+	var rows []diffChangeRow
+	for _, c := range changes {
+		rows = append(rows, diffChangeRow{Repository: repositoryName(c.Repository), SHA: shortSHA(c.SHA), Message: commitSubject(c.Message)})
+	}
+	return rows
+}
+
+func (r DiffReport) fieldRows() []diffFieldRow {
+	var rows []diffFieldRow
+	for _, c := range r.Changed {
+		for _, f := range c.Fields {
+			rows = append(rows, diffFieldRow{Repository: repositoryName(c.Repository), SHA: shortSHA(c.SHA), Field: f.Field, From: string(f.From), To: string(f.To)})
+		}
+	}
+	return rows
+}
+
+func writeDiffReport(w io.Writer, format string, report DiffReport) error {
+	switch format {
+	case formatTable:
+		if report.Empty() {
+			fmt.Fprintln(w, "no differences")
+			return nil
+		}
+		for _, section := range []struct {
+			title   string
+			changes []RawChange
+		}{{"New changes", report.New}, {"Disappeared changes", report.Disappeared}} {
+			if len(section.changes) > 0 {
+				fmt.Fprintf(w, "%s:\n", section.title)
+				tableprinter.New(w).Print(diffChangeRows(section.changes))
+				fmt.Fprintln(w)
+			}
+		}
+		if len(report.Changed) > 0 {
+			fmt.Fprintf(w, "Changed attributes:\n")
+			tableprinter.New(w).Print(report.fieldRows())
+		}
+		return nil
+	case formatMarkdown:
+		fmt.Fprintf(w, "## Differences between %s and %s\n\n", report.From, report.To)
+		if report.Empty() {
+			fmt.Fprintln(w, "no differences")
+			return nil
+		}
+		for _, section := range []struct {
+			title   string
+			changes []RawChange
+		}{{"New changes", report.New}, {"Disappeared changes", report.Disappeared}} {
+			if len(section.changes) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "### %s\n\n", section.title)
+			var rows [][]string
+			for _, r := range diffChangeRows(section.changes) {
+				rows = append(rows, []string{r.Repository, r.SHA, r.Message})
+			}
+			writeMarkdownTable(w, []string{"Repository", "SHA", "Message"}, rows)
+			fmt.Fprintln(w)
+		}
+		if len(report.Changed) > 0 {
+			fmt.Fprintf(w, "### Changed attributes\n\n")
+			var rows [][]string
+			for _, r := range report.fieldRows() {
+				rows = append(rows, []string{r.Repository, r.SHA, r.Field, r.From, r.To})
+			}
+			writeMarkdownTable(w, []string{"Repository", "SHA", "Field", "From", "To"}, rows)
+		}
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q, diff supports %s, %s and %s", format, formatTable, formatMarkdown, formatJSON)
+	}
+}
+
+func newDiffCommand() *command {
+	cmd := newCommand("diff", "Show changes that are new, disappeared or changed between two saved runs", fmt.Sprintf(`
+The diff does not talk to Github, it reads files saved via 'collect -save-raw' or 'collect -format json'.
+Changes are matched by SHA, then by repository and subject (eg. after a force push).
+Exits with 0 when the runs are the same and with %d when they differ.
+
+Examples:
+  # what changed since yesterday
+  ocp-what-merged diff yesterday.json today.json
+
+  # the same as markdown
+  ocp-what-merged diff -format markdown yesterday.json today.json
+`, exitCodeDifferences))
+	shared := &sharedOptions{}
+	shared.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		if len(args) != 2 {
+			cmd.flags.Usage()
+			return fmt.Errorf("exactly two saved runs are required")
+		}
+		return runDiff(shared, args[0], args[1])
+	}
+	return cmd
+}
+
+func runDiff(shared *sharedOptions, fromPath, toPath string) error {
+	from, err := readTrendRun(fromPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fromPath, err)
+	}
+	to, err := readTrendRun(toPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", toPath, err)
+	}
+	if from.Kind != to.Kind {
+		log.Printf("WARNING: comparing %s (%s) with %s (%s), JSON reports only contain changes left after filters", fromPath, from.Kind, toPath, to.Kind)
+	}
+	report, err := diffRuns(from, to)
+	if err != nil {
+		return err
+	}
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeDiffReport(out, shared.format, report); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if !report.Empty() {
+		return &exitError{code: exitCodeDifferences, message: fmt.Sprintf("%d new, %d disappeared and %d changed", len(report.New), len(report.Disappeared), len(report.Changed))}
+	}
+	return nil
+}
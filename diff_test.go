@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffRuns(t *testing.T) {
+	api := "https://github.com/openshift/api"
+	from := &trendRun{Source: "yesterday.json", Changes: []RawChange{
+		{Repository: api, SHA: "a", Message: "Bump the API"},
+		{Repository: api, SHA: "b", Message: "Fix the validation\n\nLong description"},
+		{Repository: api, SHA: "c", Message: "Add a field", PullRequest: 42},
+		{Repository: api, SHA: "d", Message: "Reverted later"},
+	}}
+	to := &trendRun{Source: "today.json", Changes: []RawChange{
+		{Repository: api, SHA: "a", Message: "Bump the API"},
+		// rewritten by a force push
+		{Repository: api, SHA: "b2", Message: "Fix the validation\n\nAnother description"},
+		{Repository: api, SHA: "c", Message: "Add a field", PullRequest: 42, Backports: []Backport{{Branch: "release-4.9", Number: 43, State: "open"}}},
+		{Repository: api, SHA: "e", Message: "Brand new"},
+	}}
+	report, err := diffRuns(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.New) != 1 || report.New[0].SHA != "e" {
+		t.Errorf("expected the new change, got %+v", report.New)
+	}
+	if len(report.Disappeared) != 1 || report.Disappeared[0].SHA != "d" {
+		t.Errorf("expected the disappeared change, got %+v", report.Disappeared)
+	}
+	var changed []string
+	for _, c := range report.Changed {
+		for _, f := range c.Fields {
+			changed = append(changed, c.SHA+" "+f.Field)
+		}
+	}
+	if expected := []string{"b2 message", "b2 sha", "c backports"}; !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected changed fields %v, got %v", expected, changed)
+	}
+
+	var out bytes.Buffer
+	if err := writeDiffReport(&out, formatMarkdown, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"### New changes", "### Disappeared changes", "### Changed attributes", "| openshift/api | c | backports |  | [{\"branch\":\"release-4.9\""} {
+		if !strings.Contains(out.String(), section) {
+			t.Errorf("expected %q in the output:\n%s", section, out.String())
+		}
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	api := "https://github.com/openshift/api"
+	yesterday, today, future := filepath.Join(dir, "yesterday.json"), filepath.Join(dir, "today.json"), filepath.Join(dir, "future.json")
+	writeTestRun(t, yesterday, jsonReport{Changes: []RawChange{{Repository: api, SHA: "a", Message: "Bump the API"}}})
+	writeTestRun(t, today, RawData{Version: rawDataVersion, Repositories: []RawRepository{{Repository: api, Changes: []RawChange{{Repository: api, SHA: "a", Message: "Bump the API"}, {Repository: api, SHA: "b", Message: "Fix the validation"}}}}})
+	writeTestRun(t, future, RawData{Version: rawDataVersion + 1, Repositories: []RawRepository{}})
+	output := filepath.Join(dir, "diff.out")
+
+	if err := runDiff(&sharedOptions{format: formatTable, output: output}, yesterday, yesterday); err != nil {
+		t.Errorf("expected no error for identical runs, got %v", err)
+	}
+
+	var err error
+	logged := captureLog(t, func() { err = runDiff(&sharedOptions{format: formatTable, output: output}, yesterday, today) })
+	if exit, ok := err.(*exitError); !ok || exit.code != exitCodeDifferences || exit.message != "1 new, 0 disappeared and 0 changed" {
+		t.Errorf("expected the differences exit code, got %#v", err)
+	}
+	if !strings.Contains(logged, "comparing "+yesterday+" (JSON report) with "+today+" (raw data)") {
+		t.Errorf("expected a warning about the different kinds of files, got %q", logged)
+	}
+
+	if err := runDiff(&sharedOptions{format: formatTable, output: output}, yesterday, future); err == nil || !strings.Contains(err.Error(), future+": unsupported raw data version") {
+		t.Errorf("expected an error naming the file with unsupported version, got %v", err)
+	}
+}
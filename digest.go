@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// defaultDigestSize is the number of changes in the -digest
+const defaultDigestSize = 10
+
+// Reasons a change is in the digest, in the order they are selected
+const (
+	digestCVE = iota
+	digestRevert
+	digestAPIChange
+	digestDiffstat
+)
+
+// DigestEntry is a notable change with the reason it was selected (see -digest).
+type DigestEntry struct {
+	Rank       int    `header:"#" json:"rank"`
+	Reason     string `header:"Why" json:"reason"`
+	Repository string `header:"Repository" json:"repository"`
+	Subject    string `header:"Change" json:"subject"`
+	URL        string `header:"URL" json:"url"`
+	SHA        string `json:"sha"`
+
+	reason int
+	// weight orders entries of the same reason, the higher first
+	weight int
+	raw    RawChange
+}
+
+// diffstat returns the number of changed lines of the change, 0 when its files were not fetched (see -classify-paths).
+func diffstat(raw RawChange) int {
+	lines := 0
+	for _, f := range raw.Files {
+		lines += f.Additions + f.Deletions
+	}
+	return lines
+}
+
+// digestReason returns why the change is notable, its first reason by the digest order: it references CVEs (the
+// most severe first), it is a revert, it changes APIs (see -classify-paths) or it has a diffstat. Signals that were
+// not collected by the run (eg. changed files) contribute nothing.
+func digestReason(raw RawChange) (int, int, string, bool) {
+	if cves := changeCVEs(raw); len(cves) > 0 {
+		weight := 0
+		for _, cve := range cves {
+			if rank := severityRank(raw.CVESeverities[cve]); rank > weight {
+				weight = rank
+			}
+		}
+		return digestCVE, weight, "references " + strings.Join(cves, ", "), true
+	}
+	if _, ok := revertOf(raw.Message); ok {
+		return digestRevert, 0, "revert", true
+	}
+	for _, class := range raw.PathClasses {
+		if class == "api-change" {
+			return digestAPIChange, 0, "changes APIs", true
+		}
+	}
+	if lines := diffstat(raw); lines > 0 {
+		return digestDiffstat, lines, fmt.Sprintf("%d lines changed", lines), true
+	}
+	return 0, 0, "", false
+}
+
+// selectDigest returns up to size most notable changes. Changes are ordered by their reason (see digestReason),
+// then by the weight of the reason (CVE severity, diffstat), then the newest first, then by repository and SHA, so
+// the digest does not depend on the order of the changes. The digest is empty, not nil, without notable changes.
+func selectDigest(changes []Change, size int) []DigestEntry {
+	entries := []DigestEntry{}
+	for _, c := range changes {
+		reason, weight, why, ok := digestReason(c.raw)
+		if !ok {
+			continue
+		}
+		entries = append(entries, DigestEntry{
+			Reason:     why,
+			Repository: repositoryName(c.raw.Repository),
+			Subject:    commitSubject(c.raw.Message),
+			URL:        c.raw.URL,
+			SHA:        c.raw.SHA,
+			reason:     reason,
+			weight:     weight,
+			raw:        c.raw,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.reason != b.reason:
+			return a.reason < b.reason
+		case a.weight != b.weight:
+			return a.weight > b.weight
+		case !a.raw.Date.Equal(b.raw.Date):
+			return a.raw.Date.After(b.raw.Date)
+		case a.raw.Repository != b.raw.Repository:
+			return a.raw.Repository < b.raw.Repository
+		}
+		return a.raw.SHA < b.raw.SHA
+	})
+	if size > 0 && len(entries) > size {
+		entries = entries[:size]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries
+}
+
+// printDigest prints the digest above the changes.
+func printDigest(w io.Writer, digest []DigestEntry, changes int) {
+	if len(digest) == 0 {
+		fmt.Fprintf(w, "Digest: none of the %d changes is notable.\n", changes)
+		return
+	}
+	fmt.Fprintf(w, "Digest (%d notable of %d changes):\n", len(digest), changes)
+	tableprinter.New(w).Print(digest)
+}
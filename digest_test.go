@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectDigest(t *testing.T) {
+	start := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	raws := []RawChange{
+		{Repository: api, SHA: "diff1", Message: "Bump the vendor", Date: start, Files: []ChangedFile{{Path: "vendor/a.go", Additions: 300, Deletions: 20}}},
+		{Repository: api, SHA: "diff2", Message: "Fix the typo", Date: start, Files: []ChangedFile{{Path: "README.md", Additions: 1, Deletions: 1}}},
+		// the API change outranks any diffstat
+		{Repository: api, SHA: "apich", Message: "Add the field", Date: start, PathClasses: []string{"manifest-change", "api-change"}, Files: []ChangedFile{{Path: "types.go", Additions: 1}}},
+		{Repository: oc, SHA: "revrt", Message: "Revert \"Fix the login\"\n\nThis reverts commit 0123abcd.", Date: start},
+		// an unknown severity ranks below the known ones
+		{Repository: oc, SHA: "cve00", Message: "Fix CVE-2021-0001", Date: start.Add(time.Hour)},
+		{Repository: oc, SHA: "cve01", Message: "Fix CVE-2021-0002", Date: start, CVESeverities: map[string]string{"CVE-2021-0002": "Moderate"}},
+		// the most severe of the referenced CVEs counts
+		{Repository: oc, SHA: "cve02", Message: "Fix CVE-2021-0003 and CVE-2021-0004", Date: start, CVESeverities: map[string]string{"CVE-2021-0003": "Low", "CVE-2021-0004": "Important"}},
+		// ties of the same severity go to the newest, then by repository and SHA
+		{Repository: oc, SHA: "cve03", Message: "Fix CVE-2021-0005", Date: start, CVESeverities: map[string]string{"CVE-2021-0005": "Low"}},
+		{Repository: api, SHA: "cve04", Message: "Fix CVE-2021-0006", Date: start, CVESeverities: map[string]string{"CVE-2021-0006": "Low"}},
+		{Repository: api, SHA: "cve05", Message: "Fix CVE-2021-0007", Date: start, CVESeverities: map[string]string{"CVE-2021-0007": "Low"}},
+		{Repository: oc, SHA: "cve06", Message: "Fix CVE-2021-0008", Date: start.Add(time.Minute), CVESeverities: map[string]string{"CVE-2021-0008": "Low"}},
+		// signals that were not collected contribute nothing
+		{Repository: oc, SHA: "plain", Message: "Fix the logout", Date: start.Add(2 * time.Hour)},
+		{Repository: oc, SHA: "unkno", Message: "Fix the whoami", Date: start, PathClasses: []string{pathClassUnknown}},
+	}
+	expected := []string{"cve02", "cve01", "cve06", "cve04", "cve05", "cve03", "cve00", "revrt", "apich", "diff1", "diff2"}
+
+	var changes, reversed []Change
+	for i := range raws {
+		changes = append(changes, newChange(raws[i]))
+		reversed = append(reversed, newChange(raws[len(raws)-1-i]))
+	}
+	shas := func(entries []DigestEntry) []string {
+		var result []string
+		for i, e := range entries {
+			if e.Rank != i+1 {
+				t.Errorf("expected %s ranked %d, got %d", e.SHA, i+1, e.Rank)
+			}
+			result = append(result, e.SHA)
+		}
+		return result
+	}
+	digest := selectDigest(changes, 0)
+	if found := shas(digest); !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+	// the digest does not depend on the order of the changes
+	if found := shas(selectDigest(reversed, 0)); !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected the same digest of the reversed changes, got %v", found)
+	}
+	if found := shas(selectDigest(changes, 3)); !reflect.DeepEqual(found, expected[:3]) {
+		t.Errorf("expected the 3 most notable changes, got %v", found)
+	}
+
+	reasons := map[string]string{}
+	for _, e := range digest {
+		reasons[e.SHA] = e.Reason
+	}
+	for sha, reason := range map[string]string{
+		"cve02": "references CVE-2021-0003, CVE-2021-0004",
+		"revrt": "revert",
+		"apich": "changes APIs",
+		"diff1": "320 lines changed",
+	} {
+		if reasons[sha] != reason {
+			t.Errorf("%s: expected the reason %q, got %q", sha, reason, reasons[sha])
+		}
+	}
+	if digest[7].Subject != "Revert \"Fix the login\"" || digest[7].Repository != "openshift/oc" {
+		t.Errorf("expected the subject and the repository name, got %+v", digest[7])
+	}
+}
+
+func TestWriteDigest(t *testing.T) {
+	oc := "https://github.com/openshift/oc"
+	changes := []Change{
+		newChange(RawChange{Repository: oc, SHA: "a1a1a1a1", URL: oc + "/commit/a1a1a1a1", Message: "Revert \"Fix the login\""}),
+		newChange(RawChange{Repository: oc, SHA: "b1b1b1b1", URL: oc + "/commit/b1b1b1b1", Message: "Fix the logout"}),
+	}
+	digest := selectDigest(changes, defaultDigestSize)
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, Report{Changes: changes, Digest: digest, Wrap: MessageWrap{Width: 200}}); err != nil {
+		t.Fatal(err)
+	}
+	table := out.String()
+	if !strings.HasPrefix(table, "Digest (1 notable of 2 changes):") || !strings.Contains(table, "Fix the logout") {
+		t.Errorf("expected the digest above the changes, got:\n%s", table)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatTable, Report{Changes: changes, Digest: digest, DigestOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if table := out.String(); strings.Contains(table, "Fix the logout") {
+		t.Errorf("expected only the digest with -digest-only, got:\n%s", table)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatTable, Report{Changes: changes[1:], Digest: selectDigest(changes[1:], defaultDigestSize)}); err != nil {
+		t.Fatal(err)
+	}
+	if table := out.String(); !strings.HasPrefix(table, "Digest: none of the 1 changes is notable.") {
+		t.Errorf("expected an empty digest, got:\n%s", table)
+	}
+
+	out.Reset()
+	if err := writeReport(&out, formatJSON, Report{Changes: changes, Digest: digest}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"digest": [`) || !strings.Contains(report, `"reason": "revert"`) {
+		t.Errorf("expected the entries under digest, got:\n%s", report)
+	}
+
+	slack, err := parseTemplate("", "slack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatTemplate, Report{Changes: changes, Digest: digest, Template: slack}); err != nil {
+		t.Fatal(err)
+	}
+	message := out.String()
+	if !strings.Contains(message, "1. <"+oc+"/commit/a1a1a1a1|a1a1a1a> *openshift/oc* Revert \"Fix the login\" _(revert)_") || strings.Contains(message, "Fix the logout") {
+		t.Errorf("expected the digest as the slack message, got:\n%s", message)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultAuditMaxAge is the default age of the oldest commit audited by -audit-direct-pushes, Github does not
+// associate old commits with their pull requests reliably
+const defaultAuditMaxAge = 7 * 24 * time.Hour
+
+// exitCodeDirectPushes is the exit code of -audit-direct-pushes when direct pushes were found.
+const exitCodeDirectPushes = 4
+
+// DirectPush is a change pushed to the branch without a pull request.
+type DirectPush struct {
+	Repository string    `header:"Repository" json:"repository"`
+	SHA        string    `header:"Commit" json:"sha"`
+	Committer  string    `header:"Committer" json:"committer"`
+	Time       string    `header:"Time" json:"-"`
+	Date       time.Time `json:"date"`
+	Subject    string    `header:"Subject" json:"subject"`
+}
+
+// commitCommitter returns the Github login of the committer, or the committer email (or name) when it is not
+// linked to an account.
+func commitCommitter(c *github.RepositoryCommit) string {
+	if login := c.GetCommitter().GetLogin(); len(login) > 0 {
+		return login
+	}
+	if email := c.GetCommit().GetCommitter().GetEmail(); len(email) > 0 {
+		return email
+	}
+	return c.GetCommit().GetCommitter().GetName()
+}
+
+// findDirectPushes returns changes without a pull request committed after now-maxAge.
+func findDirectPushes(changes []Change, maxAge time.Duration, now time.Time) []DirectPush {
+	result := []DirectPush{}
+	for _, c := range changes {
+		if c.raw.MergeMethod != mergeMethodDirectPush || (maxAge > 0 && c.raw.Date.Before(now.Add(-maxAge))) {
+			continue
+		}
+		result = append(result, DirectPush{
+			Repository: c.raw.Repository,
+			SHA:        c.raw.SHA,
+			Committer:  c.raw.Committer,
+			Time:       formatTime(c.raw.Date),
+			Date:       c.raw.Date,
+			Subject:    commitSubject(c.raw.Message),
+		})
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeDirectPushGithub serves three commits of openshift/api: a1 squash merged by a pull request, b2 pushed
+// directly by an administrator and c3 pushed directly three hours ago.
+func fakeDirectPushGithub(t *testing.T) *github.Client {
+	now := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/commits":
+			fmt.Fprintf(w, `[{"sha": "a1", "commit": {"message": "Bump the API (#42)", "author": {"name": "deads2k"}, "committer": {"name": "GitHub", "date": %[1]q}}, "committer": {"login": "web-flow"}},
+				{"sha": "b2", "commit": {"message": "Emergency fix of the CRD", "author": {"name": "admin"}, "committer": {"name": "Admin", "email": "admin@redhat.com", "date": %[1]q}}},
+				{"sha": "c3", "commit": {"message": "Old fix", "author": {"name": "admin"}, "committer": {"name": "Admin", "date": %[2]q}}, "committer": {"login": "openshift-admin"}}]`,
+				now.Add(-30*time.Minute).Format(time.RFC3339), now.Add(-3*time.Hour).Format(time.RFC3339))
+		case "/repos/openshift/api/commits/a1/pulls":
+			fmt.Fprint(w, `[{"number": 42, "merged_at": "2021-08-18T10:00:00Z", "merge_commit_sha": "a1", "base": {"ref": "master"}, "merged_by": {"login": "openshift-merge-robot"}}]`)
+		case "/repos/openshift/api/commits/b2/pulls", "/repos/openshift/api/commits/c3/pulls":
+			fmt.Fprint(w, `[]`)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestFindDirectPushes(t *testing.T) {
+	now := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	changes := []Change{
+		newChange(RawChange{SHA: "a1", Message: "Bump the API", Date: now.Add(-time.Hour), MergeMethod: mergeMethodSquash}),
+		newChange(RawChange{SHA: "b2", Message: "Emergency fix\n\nOf the CRD", Date: now.Add(-time.Hour), MergeMethod: mergeMethodDirectPush, Committer: "admin"}),
+		newChange(RawChange{SHA: "c3", Message: "Old fix", Date: now.Add(-8 * 24 * time.Hour), MergeMethod: mergeMethodDirectPush}),
+	}
+	pushes := findDirectPushes(changes, defaultAuditMaxAge, now)
+	if len(pushes) != 1 || pushes[0].SHA != "b2" || pushes[0].Committer != "admin" || pushes[0].Subject != "Emergency fix" || !pushes[0].Date.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected the recent direct push, got %+v", pushes)
+	}
+	if pushes := findDirectPushes(changes, 0, now); len(pushes) != 2 {
+		t.Errorf("expected all direct pushes without a maximum age, got %+v", pushes)
+	}
+	if pushes := findDirectPushes(changes[:1], defaultAuditMaxAge, now); pushes == nil || len(pushes) != 0 {
+		t.Errorf("expected an empty audit, got %#v", pushes)
+	}
+}
+
+func TestAuditDirectPushes(t *testing.T) {
+	// the direct push is audited even though its author is excluded
+	query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, auditDirectPushes: true, auditMaxAge: time.Hour, excludeAuthors: commaSeparatedList{"admin"}}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	var result *queryResult
+	captureLog(t, func() {
+		var err error
+		if result, err = query.collect(context.Background(), fakeDirectPushGithub(t), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api"}, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+		if err := query.render(&out, formatTable, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+	table := out.String()
+	i := strings.Index(table, "WARNING: 1 changes were pushed without a pull request")
+	if i < 0 || strings.Contains(table[:i], "Emergency fix") {
+		t.Fatalf("expected the excluded direct push in the audit only, got:\n%s", table)
+	}
+	section := table[i:]
+	if !strings.Contains(section, "Emergency fix of the CRD") || !strings.Contains(section, "admin@redhat.com") {
+		t.Errorf("expected the direct push with its committer, got:\n%s", table)
+	}
+	// the squash merged pull request and the direct push older than -audit-max-age are not audited
+	if strings.Contains(section, "Bump the API") || strings.Contains(section, "Old fix") {
+		t.Errorf("expected only the recent direct push to be audited, got:\n%s", section)
+	}
+	var exit *exitError
+	if !errors.As(result.Failed, &exit) || exit.code != exitCodeDirectPushes {
+		t.Errorf("expected the exit code %d, got %v", exitCodeDirectPushes, result.Failed)
+	}
+
+	// without direct pushes the audit passes
+	query.auditMaxAge = 10 * time.Minute
+	out.Reset()
+	captureLog(t, func() {
+		var err error
+		if result, err = query.collect(context.Background(), fakeDirectPushGithub(t), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api"}, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+		if err := query.render(&out, formatTable, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out.String(), "No changes were pushed without a pull request.") || result.Failed != nil {
+		t.Errorf("expected no direct pushes, got %v:\n%s", result.Failed, out.String())
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Modes of -collapse-duplicates
+const (
+	collapseOff          = "off"
+	collapseConservative = "conservative"
+	collapseAggressive   = "aggressive"
+)
+
+var (
+	// ticketReference matches Jira issues (eg. "OCPBUGS-1234") and Bugzilla bugs (eg. "Bug 1987654")
+	ticketReference = regexp.MustCompile(`\b([A-Z][A-Z0-9]+-[0-9]+|[Bb]ug [0-9]+)\b`)
+	// aggressiveSubjectNoise are parts of the subject that differ between a squashed commit and its original commits,
+	// eg. "[release-4.9] ", "UPSTREAM: <carry>: " or " (#1234)", matched in the lower cased subject
+	aggressiveSubjectNoise = regexp.MustCompile(`^(\[[^\]]+\]\s*)+|^upstream:\s*(<[^>]+>|[0-9]+):\s*|\s*\(#[0-9]+\)$|[^a-z0-9 ]`)
+)
+
+func validateCollapseMode(mode string) error {
+	switch mode {
+	case "", collapseOff, collapseConservative, collapseAggressive:
+		return nil
+	default:
+		return fmt.Errorf("unknown -collapse-duplicates mode %q, use %s, %s or %s", mode, collapseOff, collapseConservative, collapseAggressive)
+	}
+}
+
+// duplicateSubject normalizes the commit subject, the aggressive mode also drops backport prefixes, pull request
+// references and punctuation.
+func duplicateSubject(message, mode string) string {
+	subject := strings.ToLower(commitSubject(message))
+	if mode == collapseAggressive {
+		subject = aggressiveSubjectNoise.ReplaceAllString(subject, "")
+	}
+	return strings.Join(strings.Fields(subject), " ")
+}
+
+func ticketReferences(message string) string {
+	references := ticketReference.FindAllString(message, -1)
+	for i := range references {
+		references[i] = strings.ToUpper(references[i])
+	}
+	sort.Strings(references)
+	return strings.Join(references, ",")
+}
+
+// collapseDuplicates collapses likely duplicate changes of the same repository (eg. original commits of a pull
+// request and its squashed result) into the earliest one. Changes are duplicates when they have the same normalized
+// subject, the same author and the same ticket references, and were committed within the window.
+func collapseDuplicates(changes []Change, mode string, window time.Duration) []Change {
+	if mode == collapseOff || len(mode) == 0 {
+		return changes
+	}
+	type key struct {
+		repository, author, subject, tickets string
+	}
+	groups := map[key][]int{}
+	for i, c := range changes {
+		// changes without known author (eg. raw data saved by older versions) are never collapsed
+		if len(c.raw.Author) == 0 {
+			continue
+		}
+		k := key{c.raw.Repository, c.raw.Author, duplicateSubject(c.raw.Message, mode), ticketReferences(c.raw.Message)}
+		groups[k] = append(groups[k], i)
+	}
+
+	collapsed := map[int]bool{}
+	result := make([]Change, len(changes))
+	copy(result, changes)
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return changes[group[i]].raw.Date.Before(changes[group[j]].raw.Date) })
+		first := group[0]
+		raw := changes[first].raw
+		for _, i := range group[1:] {
+			if changes[i].raw.Date.Sub(raw.Date) > window {
+				continue
+			}
+			c := changes[i].raw
+			raw.Duplicates = append(raw.Duplicates, CollapsedChange{Repository: c.Repository, SHA: c.SHA, URL: c.URL})
+			collapsed[i] = true
+		}
+		result[first] = newChange(raw)
+	}
+
+	var r []Change
+	for i, c := range result {
+		if !collapsed[i] {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func formatDuplicates(duplicates []CollapsedChange) string {
+	var r []string
+	for _, d := range duplicates {
+		r = append(r, shortSHA(d.SHA))
+	}
+	return strings.Join(r, "\n")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollapseDuplicates(t *testing.T) {
+	now := time.Now()
+	api := "https://github.com/openshift/api"
+	tests := []struct {
+		name    string
+		mode    string
+		changes []RawChange
+		// expected are the SHAs of the changes kept, with the SHAs of their duplicates
+		expected map[string][]string
+	}{
+		{
+			name: "off",
+			mode: collapseOff,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "Bump the API", Date: now.Add(time.Hour)},
+			},
+			expected: map[string][]string{"a": nil, "b": nil},
+		},
+		{
+			name: "conservative squashed commit",
+			mode: collapseConservative,
+			changes: []RawChange{
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "Bump the API\n\nsquashed", Date: now.Add(time.Hour)},
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "bump the  API", Date: now},
+			},
+			expected: map[string][]string{"a": {"b"}},
+		},
+		{
+			name: "conservative differing ticket references",
+			mode: collapseConservative,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Fix the validation\n\nFixes OCPBUGS-1234", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "Fix the validation\n\nFixes OCPBUGS-4321", Date: now.Add(time.Hour)},
+			},
+			expected: map[string][]string{"a": nil, "b": nil},
+		},
+		{
+			name: "conservative different authors, repositories and windows",
+			mode: collapseConservative,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: api, SHA: "b", Author: "sttts", Message: "Bump the API", Date: now},
+				{Repository: "https://github.com/openshift/oc", SHA: "c", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: api, SHA: "d", Author: "mfojtik", Message: "Bump the API", Date: now.Add(48 * time.Hour)},
+				// unknown author
+				{Repository: api, SHA: "e", Message: "Bump the API", Date: now},
+			},
+			expected: map[string][]string{"a": nil, "b": nil, "c": nil, "d": nil, "e": nil},
+		},
+		{
+			name: "conservative backport prefix",
+			mode: collapseConservative,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "[release-4.9] Bump the API (#1234)", Date: now.Add(time.Hour)},
+			},
+			expected: map[string][]string{"a": nil, "b": nil},
+		},
+		{
+			name: "aggressive backport prefix",
+			mode: collapseAggressive,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "[release-4.9] Bump the API (#1234)", Date: now.Add(time.Hour)},
+				{Repository: api, SHA: "c", Author: "mfojtik", Message: "UPSTREAM: <carry>: Bump the API.", Date: now.Add(2 * time.Hour)},
+			},
+			expected: map[string][]string{"a": {"b", "c"}},
+		},
+		{
+			name: "aggressive differing ticket references",
+			mode: collapseAggressive,
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Bug 1987654: Fix the validation", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "[release-4.9] Bug 1987655: Fix the validation", Date: now.Add(time.Hour)},
+			},
+			expected: map[string][]string{"a": nil, "b": nil},
+		},
+	}
+	for _, test := range tests {
+		var changes []Change
+		for _, raw := range test.changes {
+			changes = append(changes, newChange(raw))
+		}
+		result := map[string][]string{}
+		for _, c := range collapseDuplicates(changes, test.mode, 24*time.Hour) {
+			var duplicates []string
+			for _, d := range c.raw.Duplicates {
+				duplicates = append(duplicates, d.SHA)
+			}
+			result[c.raw.SHA] = duplicates
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestCollapseMode(t *testing.T) {
+	for _, mode := range []string{collapseOff, collapseConservative, collapseAggressive} {
+		if err := (&queryOptions{collapseDuplicates: mode}).validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", mode, err)
+		}
+	}
+	if err := (&queryOptions{collapseDuplicates: "always"}).validate(); err == nil {
+		t.Errorf("expected an unknown mode rejected")
+	}
+}
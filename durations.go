@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Styles of -duration-style
+const (
+	durationStyleHumanized = "humanized"
+	durationStyleCompact   = "compact"
+	durationStyleNumeric   = "numeric"
+)
+
+// Formatter renders times relative to a fixed reference time and durations, so the output does not depend on
+// when it is rendered.
+type Formatter interface {
+	// Ago renders the time relative to the reference time (eg. "3 hours ago")
+	Ago(t time.Time) string
+	// Duration renders the length of a duration, rounded to minutes (eg. "2h10m")
+	Duration(d time.Duration) string
+}
+
+// validateDurationStyle accepts the -duration-style values, empty is the default humanized style.
+func validateDurationStyle(style string) error {
+	switch style {
+	case "", durationStyleHumanized, durationStyleCompact, durationStyleNumeric:
+		return nil
+	}
+	return fmt.Errorf("unknown -duration-style %q, use %s, %s or %s", style, durationStyleHumanized, durationStyleCompact, durationStyleNumeric)
+}
+
+// newFormatter returns the formatter of the (validated) style rendering times relative to now.
+func newFormatter(style string, now time.Time) Formatter {
+	switch style {
+	case durationStyleCompact:
+		return compactFormatter{now: now}
+	case durationStyleNumeric:
+		return numericFormatter{now: now}
+	default:
+		return humanizedFormatter{now: now}
+	}
+}
+
+// formatterOrNow returns the formatter, or the humanized one relative to now for changes and reports built without
+// one (eg. by newChange, before the formatter of the collection is applied).
+func formatterOrNow(f Formatter) Formatter {
+	if f == nil {
+		return humanizedFormatter{now: time.Now()}
+	}
+	return f
+}
+
+// durationStyleValue is the -duration-style flag value.
+type durationStyleValue string
+
+func (v *durationStyleValue) String() string {
+	if v == nil || len(*v) == 0 {
+		return durationStyleHumanized
+	}
+	return string(*v)
+}
+
+func (v *durationStyleValue) Set(value string) error {
+	if err := validateDurationStyle(value); err != nil {
+		return err
+	}
+	*v = durationStyleValue(value)
+	return nil
+}
+
+// durationParts splits the duration rounded to minutes into days, hours and minutes.
+func durationParts(d time.Duration) (time.Duration, time.Duration, time.Duration) {
+	d = absDuration(d).Round(time.Minute)
+	return d / (24 * time.Hour), d % (24 * time.Hour) / time.Hour, d % time.Hour / time.Minute
+}
+
+// compactDuration renders "2d4h", "3h", "40m" or "0m".
+func compactDuration(d time.Duration) string {
+	days, hours, minutes := durationParts(d)
+	var b strings.Builder
+	if days > 0 {
+		fmt.Fprintf(&b, "%dd", days)
+	}
+	if hours > 0 {
+		fmt.Fprintf(&b, "%dh", hours)
+	}
+	if minutes > 0 || b.Len() == 0 {
+		fmt.Fprintf(&b, "%dm", minutes)
+	}
+	return b.String()
+}
+
+// humanizedFormatter renders English relative times ("3 hours ago") and compact durations, the default.
+type humanizedFormatter struct {
+	now time.Time
+}
+
+func (f humanizedFormatter) Ago(t time.Time) string {
+	return humanize.RelTime(t, f.now, "ago", "from now")
+}
+
+func (f humanizedFormatter) Duration(d time.Duration) string {
+	return compactDuration(d)
+}
+
+// compactFormatter renders relative times as compact durations ("2d4h ago").
+type compactFormatter struct {
+	now time.Time
+}
+
+func (f compactFormatter) Ago(t time.Time) string {
+	if t.After(f.now) {
+		return "in " + compactDuration(t.Sub(f.now))
+	}
+	return compactDuration(f.now.Sub(t)) + " ago"
+}
+
+func (f compactFormatter) Duration(d time.Duration) string {
+	return compactDuration(d)
+}
+
+// numericFormatter renders locale neutral ISO 8601 durations ("P2DT4H"), relative times are signed ("-PT3H" is
+// 3 hours before the reference time).
+type numericFormatter struct {
+	now time.Time
+}
+
+func (f numericFormatter) Ago(t time.Time) string {
+	if t.After(f.now) {
+		return "+" + f.Duration(t.Sub(f.now))
+	}
+	return "-" + f.Duration(f.now.Sub(t))
+}
+
+func (f numericFormatter) Duration(d time.Duration) string {
+	days, hours, minutes := durationParts(d)
+	var b strings.Builder
+	b.WriteString("P")
+	if days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if hours > 0 || minutes > 0 || days == 0 {
+		b.WriteString("T")
+	}
+	if hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+	}
+	if minutes > 0 || (days == 0 && hours == 0) {
+		fmt.Fprintf(&b, "%dM", minutes)
+	}
+	return b.String()
+}
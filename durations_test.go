@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFormatterBoundaries(t *testing.T) {
+	now := time.Date(2021, 8, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		style    string
+		ago      time.Duration
+		expected string
+	}{
+		{durationStyleCompact, 59 * time.Minute, "59m ago"},
+		{durationStyleCompact, 59*time.Minute + 40*time.Second, "1h ago"},
+		{durationStyleCompact, time.Hour, "1h ago"},
+		{durationStyleCompact, 23 * time.Hour, "23h ago"},
+		{durationStyleCompact, 24 * time.Hour, "1d ago"},
+		{durationStyleCompact, 26*time.Hour + 10*time.Minute, "1d2h10m ago"},
+		{durationStyleCompact, 0, "0m ago"},
+		{durationStyleCompact, -2 * time.Hour, "in 2h"},
+		{durationStyleNumeric, 59 * time.Minute, "-PT59M"},
+		{durationStyleNumeric, time.Hour, "-PT1H"},
+		{durationStyleNumeric, 23 * time.Hour, "-PT23H"},
+		{durationStyleNumeric, 24 * time.Hour, "-P1D"},
+		{durationStyleNumeric, 28 * time.Hour, "-P1DT4H"},
+		{durationStyleNumeric, 0, "-PT0M"},
+		{durationStyleNumeric, -90 * time.Minute, "+PT1H30M"},
+		{durationStyleHumanized, 59 * time.Minute, "59 minutes ago"},
+		{durationStyleHumanized, time.Hour, "1 hour ago"},
+		{durationStyleHumanized, 23 * time.Hour, "23 hours ago"},
+		{durationStyleHumanized, 24 * time.Hour, "1 day ago"},
+		// the default style
+		{"", 2 * time.Hour, "2 hours ago"},
+	}
+	for _, test := range tests {
+		if actual := newFormatter(test.style, now).Ago(now.Add(-test.ago)); actual != test.expected {
+			t.Errorf("%s: expected %s ago to be %q, got %q", test.style, test.ago, test.expected, actual)
+		}
+	}
+
+	for d, expected := range map[time.Duration]string{0: "PT0M", 59 * time.Minute: "PT59M", 24 * time.Hour: "P1D", 26*time.Hour + 5*time.Minute: "P1DT2H5M"} {
+		if actual := newFormatter(durationStyleNumeric, now).Duration(d); actual != expected {
+			t.Errorf("expected %s to be %q, got %q", d, expected, actual)
+		}
+	}
+}
+
+func TestDurationStyleFlag(t *testing.T) {
+	var style durationStyleValue
+	if style.String() != durationStyleHumanized {
+		t.Errorf("expected the humanized style by default, got %q", style.String())
+	}
+	if err := style.Set("roman"); err == nil || !strings.Contains(err.Error(), `unknown -duration-style "roman"`) {
+		t.Errorf("expected an unknown style to fail, got %v", err)
+	}
+	if err := style.Set(durationStyleCompact); err != nil {
+		t.Fatal(err)
+	}
+	shared := &sharedOptions{durationStyle: style}
+	start := time.Date(2021, 8, 18, 12, 0, 0, 0, time.UTC)
+	merged := start.Add(-time.Hour)
+	if actual := shared.durations(start).Ago(merged); actual != "1h ago" {
+		t.Errorf("expected 1h ago, got %q", actual)
+	}
+	// a later collection (eg. the next tick of serve or the next job) renders relative to its own start
+	if actual := shared.durations(start.Add(6 * time.Hour)).Ago(merged); actual != "7h ago" {
+		t.Errorf("expected 7h ago, got %q", actual)
+	}
+}
+
+func TestFormatDurations(t *testing.T) {
+	start := time.Date(2021, 8, 18, 12, 0, 0, 0, time.UTC)
+	durations := newFormatter(durationStyleNumeric, start)
+	api := "https://github.com/openshift/api"
+	offset := int64(40 * 60)
+	changes := []Change{
+		newChange(RawChange{Repository: api, SHA: "a1a1a1a1", URL: api + "/commit/a1a1a1a1", Date: start.Add(-3 * time.Hour), OutsideWindow: true}),
+		newChange(RawChange{Repository: api, SHA: "b1b1b1b1", Date: start.Add(-time.Hour), PayloadOffset: &offset}),
+		newChange(RawChange{Repository: api, SHA: "c1c1c1c1", URL: api + "/commit/c1c1c1c1", Mirror: "openshift-priv/api", Date: start, PrivatePair: &EmbargoPair{Repository: "https://github.com/openshift-priv/api", SHA: "d1d1d1d1", LagSeconds: 2 * 3600}}),
+		newChange(RawChange{Repository: api, SHA: "e1e1e1e1", Author: "mfojtik", Date: start, Session: &Session{Author: "mfojtik", Start: start.Add(-26 * time.Hour), End: start, Commits: []SessionCommit{{Subject: "Add the field"}, {Subject: "Document the field"}}}}),
+	}
+	formatDurations(changes, durations)
+	for i, expected := range []struct{ time, url, message string }{
+		{time: "-PT3H (outside window)", url: api + "/commit/a1a1a1a1"},
+		{time: "+PT40M (NOT IN PAYLOAD)"},
+		{time: "-PT0M", url: api + "/commit/c1c1c1c1\n(listed from openshift-priv/api)\n(also in openshift-priv/api, earlier by PT2H)"},
+		{time: "-PT0M", message: "2 commits by mfojtik over P1DT2H:\nAdd the field\nDocument the field"},
+	} {
+		c := changes[i]
+		if c.Time != expected.time || c.URL != expected.url || (len(expected.message) > 0 && c.Message != expected.message) {
+			t.Errorf("%s: expected %+v, got %q, %q and %q", c.raw.SHA, expected, c.Time, c.URL, c.Message)
+		}
+	}
+
+	// the humanize function of templates renders relative to the report
+	tmpl, err := template.New("test").Funcs(templateFuncs).Parse(`{{range .Changes}}{{humanize .Date}};{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := writeTemplateReport(&out, Report{Changes: changes[:1], Template: tmpl, Durations: durations}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "-PT3H;" {
+		t.Errorf("expected the time relative to the report, got %q", out.String())
+	}
+	out.Reset()
+	if err := writeHTMLReport(&out, Report{Changes: changes[:1], Durations: durations}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "-PT3H") {
+		t.Errorf("expected the time relative to the report in:\n%s", out.String())
+	}
+}
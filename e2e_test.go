@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func changeSHAs(changes []RawChange) []string {
+	var shas []string
+	for _, c := range changes {
+		shas = append(shas, shortSHA(c.SHA))
+	}
+	return shas
+}
+
+func TestCollectNormalRun(t *testing.T) {
+	out, github, err := runScenario(t, "normal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Errors) > 0 {
+		t.Errorf("unexpected errors: %+v", out.Errors)
+	}
+	// the merge commit is hidden by default
+	if shas := strings.Join(changeSHAs(out.Changes), " "); shas != "553c207 7629413" {
+		t.Errorf("expected changes 553c207 7629413, got %s", shas)
+	}
+	for _, c := range out.Changes {
+		if c.Repository != "https://github.com/octocat/Hello-World" {
+			t.Errorf("%s: unexpected repository %s", shortSHA(c.SHA), c.Repository)
+		}
+		if !strings.HasPrefix(c.URL, "https://github.com/octocat/Hello-World/commit/") {
+			t.Errorf("%s: unexpected URL %s", shortSHA(c.SHA), c.URL)
+		}
+	}
+	if author := out.Changes[1].Author; author != "Spaceghost" {
+		t.Errorf("expected the login of the author, got %q", author)
+	}
+	if out.Metadata.APIRequests[categoryCommitList] == 0 {
+		t.Errorf("expected the commit-list requests in the metadata, got %v", out.Metadata.APIRequests)
+	}
+	if n := github.countRequests("/repos/octocat/Hello-World/commits"); n == 0 {
+		t.Errorf("the commits were not listed: %v", github.Requests())
+	}
+}
+
+func TestCollectRateLimited(t *testing.T) {
+	out, _, err := runScenario(t, "rate-limit")
+	if err == nil || !strings.Contains(err.Error(), "rate limits") {
+		t.Fatalf("expected the run to fail because of rate limits, got %v", err)
+	}
+	if len(out.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", changeSHAs(out.Changes))
+	}
+	if len(out.Errors) != 1 || out.Errors[0].Kind != ErrorKindRateLimited || out.Errors[0].Repository != "https://github.com/openshift/oc" {
+		t.Errorf("expected openshift/oc to be rate limited, got %+v", out.Errors)
+	}
+}
+
+func TestCollectNotFoundRepository(t *testing.T) {
+	out, _, err := runScenario(t, "not-found")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Errors) != 1 || out.Errors[0].Kind != ErrorKindNotFound || out.Errors[0].Repository != "https://github.com/openshift/gone" {
+		t.Errorf("expected openshift/gone to be not found, got %+v", out.Errors)
+	}
+	// the other repositories are still listed
+	if len(out.Changes) != 2 {
+		t.Errorf("expected the 2 changes of octocat/Hello-World, got %v", changeSHAs(out.Changes))
+	}
+}
+
+func TestCollectPagination(t *testing.T) {
+	out, github, err := runScenario(t, "pagination")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Changes) != 105 {
+		t.Errorf("expected the 105 changes of both pages, got %d", len(out.Changes))
+	}
+	seen := map[string]bool{}
+	for _, c := range out.Changes {
+		if seen[c.SHA] {
+			t.Errorf("duplicate change %s", c.SHA)
+		}
+		seen[c.SHA] = true
+	}
+	if len(out.Errors) > 0 || len(out.Metadata.Truncated) > 0 {
+		t.Errorf("expected a complete listing, got errors %+v and truncated %v", out.Errors, out.Metadata.Truncated)
+	}
+	if !strings.Contains(strings.Join(github.Requests(), "\n"), "/repos/openshift/api/commits?page=2&") {
+		t.Errorf("the second page was not requested: %v", github.Requests())
+	}
+}
+
+func TestCollectEmptyResult(t *testing.T) {
+	out, _, err := runScenario(t, "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Changes) != 0 || len(out.Errors) != 0 {
+		t.Errorf("expected no changes and no errors, got %v and %+v", changeSHAs(out.Changes), out.Errors)
+	}
+	if out.Changes == nil {
+		t.Errorf("expected an empty list of changes in the output")
+	}
+}
+
+func TestRepositoryComparison(t *testing.T) {
+	github := newFakeGithub(t, []fakeRoute{{Method: http.MethodGet, Path: "/repos/octocat/Hello-World/compare/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e...7fd1a60b01f91b314f59955a4e4d4e80d8edf11d", Fixture: "compare-octocat-Hello-World.json"}})
+	client, err := newGithubClient(nil, github.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := getRepositoryComparison(context.Background(), client, "octocat", "Hello-World", CompareRange{Base: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Head: "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].GetSHA() != "762941318ee16e59dabbacb1b4049eec22f0d303" || !isMergeCommit(commits[1]) {
+		t.Errorf("unexpected comparison: %v", commits)
+	}
+}
+
+func TestNewGithubClient(t *testing.T) {
+	for apiURL, expected := range map[string]string{
+		"":                                   "https://api.github.com/",
+		"http://127.0.0.1:8080":              "http://127.0.0.1:8080/",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/v3/",
+	} {
+		client, err := newGithubClient(nil, apiURL)
+		if err != nil || client.BaseURL.String() != expected {
+			t.Errorf("%q: expected the base URL %s, got %v: %v", apiURL, expected, client, err)
+		}
+	}
+	if _, err := newGithubClient(nil, "api.github.com"); err == nil || !strings.Contains(err.Error(), "invalid -github-api-url") {
+		t.Errorf("expected an URL without host to be rejected, got %v", err)
+	}
+}
+
+func TestCollectRepositoryBranches(t *testing.T) {
+	branches := filepath.Join(t.TempDir(), "branches.yaml")
+	if err := ioutil.WriteFile(branches, []byte("branches:\n  openshift/oc: [release-4.9, master]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, github, err := runScenario(t, "repo-branches", "-repo-branches", branches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the commit on both branches is a single row
+	if shas := strings.Join(changeSHAs(out.Changes), " "); shas != "c3c3c3c c2c2c2c c1c1c1c" {
+		t.Errorf("expected changes c3c3c3c c2c2c2c c1c1c1c, got %s", shas)
+	}
+	found := map[string]string{}
+	for _, c := range out.Changes {
+		found[shortSHA(c.SHA)] = strings.Join(c.Branches, ",")
+	}
+	if expected := map[string]string{"c1c1c1c": "master,release-4.9", "c2c2c2c": "master", "c3c3c3c": "release-4.9"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected the branches %v, got %v", expected, found)
+	}
+	for _, branch := range []string{"master", "release-4.9"} {
+		listed := 0
+		for _, request := range github.Requests() {
+			if strings.Contains(request, "/repos/openshift/oc/commits?page=1&") && strings.Contains(request, "sha="+branch+"&") {
+				listed++
+			}
+		}
+		if listed != 1 {
+			t.Errorf("expected the commits of %s listed once, got %d: %v", branch, listed, github.Requests())
+		}
+	}
+}
+
+func TestCollectAPIDeprecations(t *testing.T) {
+	out, _, err := runScenario(t, "deprecated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deprecations := out.Metadata.APIDeprecations
+	if len(deprecations) != 1 || deprecations[0].Endpoint != "/repos/:owner/:repo/commits" || deprecations[0].Sunset != "Sat, 01 Nov 2025 00:00:00 GMT" {
+		t.Errorf("expected the deprecated commit listing in the metadata, got %+v", deprecations)
+	}
+	if len(out.Changes) != 2 {
+		t.Errorf("expected the changes of the deprecated endpoint, got %d", len(out.Changes))
+	}
+}
+
+func TestCollectDryRun(t *testing.T) {
+	scenario := loadScenario(t, "normal")
+	github := newFakeGithub(t, scenario.Routes)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "plan.txt")
+	err := run([]string{"collect", "-release-info-file", scenario.writeRelease(t, dir), "-github-api-url", github.URL, "-token", "fake-token", "-since", "24h", "-no-ignore", "-with-prs", "-dry-run", "-output", output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Work items (1):", "https://github.com/octocat/Hello-World", "pull requests", "At least 2 Github requests, with 1 more per change", "Messages: the subject and 5 body lines are kept"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected %q in the plan:\n%s", expected, data)
+		}
+	}
+	if requests := github.Requests(); len(requests) > 0 {
+		t.Errorf("expected no Github requests, got %v", requests)
+	}
+}
+
+func TestCollectDryRunWithQuota(t *testing.T) {
+	scenario := loadScenario(t, "normal")
+	github := newFakeGithub(t, scenario.Routes)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "plan.json")
+	err := run([]string{"collect", "-release-info-file", scenario.writeRelease(t, dir), "-github-api-url", github.URL, "-token", "fake-token", "-since", "24h", "-no-ignore", "-dry-run-with-quota", "-format", formatJSON, "-output", output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan ExecutionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.RateLimit == nil || plan.RateLimit.Remaining != 4999 || plan.RateLimit.Limit != 5000 {
+		t.Errorf("expected the rate limit of the fixture, got %+v", plan.RateLimit)
+	}
+	if n := github.countRequests("/repos/octocat/Hello-World/commits"); n > 0 {
+		t.Errorf("the dry run listed commits: %v", github.Requests())
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultEmbargoWindow is the default longest time between a change landing in an openshift-priv mirror and in the
+// public repository for the changes to be paired
+const defaultEmbargoWindow = 30 * 24 * time.Hour
+
+// EmbargoPair is the change of the private mirror (eg. openshift-priv/REPO) matching a change of the public repository.
+type EmbargoPair struct {
+	Repository string    `json:"repository"`
+	SHA        string    `json:"sha"`
+	URL        string    `json:"url"`
+	Date       time.Time `json:"date"`
+	// LagSeconds is how much later the change landed in the public repository, negative when it landed there first
+	LagSeconds int64 `json:"lagSeconds"`
+}
+
+func (p EmbargoPair) Lag() time.Duration {
+	return time.Duration(p.LagSeconds) * time.Second
+}
+
+// formatEmbargoPair renders "also in openshift-priv/REPO (earlier by 3d)".
+func formatEmbargoPair(p EmbargoPair, durations Formatter) string {
+	lag, relation := p.Lag(), "earlier"
+	if lag < 0 {
+		lag, relation = -lag, "later"
+	}
+	return fmt.Sprintf("(also in %s, %s by %s)", repositoryName(p.Repository), relation, durations.Duration(lag))
+}
+
+// privateMirrors maps the public repositories to their private mirrors among the repositories, related by the
+// -priv organization suffix or by the aliases.
+func privateMirrors(repositories []string, aliases map[string]string) map[string][]string {
+	mirrors := map[string][]string{}
+	for _, repository := range repositories {
+		for _, public := range repositoryAlternatives(repository, aliases) {
+			mirrors[public] = append(mirrors[public], repository)
+		}
+	}
+	return mirrors
+}
+
+// conflictingTickets reports whether both messages reference tickets, but not the same ones.
+func conflictingTickets(a, b string) bool {
+	ticketsA, ticketsB := ticketReferences(a), ticketReferences(b)
+	return len(ticketsA) > 0 && len(ticketsB) > 0 && ticketsA != ticketsB
+}
+
+// correlateEmbargoedChanges pairs changes of public repositories with the same changes of their private mirrors
+// (the same normalized subject and author, no conflicting ticket references, landed within the window) and
+// collapses each pair into the public change. The closest change in time is paired when there are multiple.
+func correlateEmbargoedChanges(changes []Change, aliases map[string]string, window time.Duration) []Change {
+	var repositories []string
+	seen := map[string]bool{}
+	for _, c := range changes {
+		if !seen[c.raw.Repository] {
+			seen[c.raw.Repository] = true
+			repositories = append(repositories, c.raw.Repository)
+		}
+	}
+	mirrors := privateMirrors(repositories, aliases)
+	if len(mirrors) == 0 {
+		return changes
+	}
+
+	type key struct {
+		repository, author, subject string
+	}
+	candidates := map[key][]int{}
+	for i, c := range changes {
+		// changes without known author (eg. raw data saved by older versions) are never paired
+		if len(c.raw.Author) == 0 {
+			continue
+		}
+		k := key{c.raw.Repository, c.raw.Author, duplicateSubject(c.raw.Message, collapseAggressive)}
+		candidates[k] = append(candidates[k], i)
+	}
+
+	paired := map[int]bool{}
+	result := make([]Change, len(changes))
+	copy(result, changes)
+	for i, c := range changes {
+		if len(c.raw.Author) == 0 || len(mirrors[c.raw.Repository]) == 0 {
+			continue
+		}
+		best := -1
+		for _, mirror := range mirrors[c.raw.Repository] {
+			for _, j := range candidates[key{mirror, c.raw.Author, duplicateSubject(c.raw.Message, collapseAggressive)}] {
+				if paired[j] || conflictingTickets(c.raw.Message, changes[j].raw.Message) || absDuration(c.raw.Date.Sub(changes[j].raw.Date)) > window {
+					continue
+				}
+				if best < 0 || absDuration(c.raw.Date.Sub(changes[j].raw.Date)) < absDuration(c.raw.Date.Sub(changes[best].raw.Date)) {
+					best = j
+				}
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		paired[best] = true
+		private := changes[best].raw
+		raw := c.raw
+		raw.PrivatePair = &EmbargoPair{
+			Repository: private.Repository,
+			SHA:        private.SHA,
+			URL:        private.URL,
+			Date:       private.Date,
+			LagSeconds: int64(raw.Date.Sub(private.Date) / time.Second),
+		}
+		result[i] = newChange(raw)
+	}
+
+	var r []Change
+	for i, c := range result {
+		if !paired[i] {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// EmbargoLag is a change that landed in the private mirror and in the public repository.
+type EmbargoLag struct {
+	Repository string `header:"Repository" json:"repository"`
+	Subject    string `header:"Subject" json:"subject"`
+	Public     string `header:"Public commit" json:"publicSHA"`
+	Private    string `header:"Private commit" json:"privateSHA"`
+	Lag        string `header:"Public landing delay" json:"-"`
+	LagSeconds int64  `json:"lagSeconds"`
+}
+
+// embargoLags lists the paired changes, the longest delays first.
+func embargoLags(changes []Change, durations Formatter) []EmbargoLag {
+	lags := []EmbargoLag{}
+	for _, c := range changes {
+		p := c.raw.PrivatePair
+		if p == nil {
+			continue
+		}
+		lags = append(lags, EmbargoLag{
+			Repository: repositoryName(c.raw.Repository),
+			Subject:    commitSubject(c.raw.Message),
+			Public:     c.raw.SHA,
+			Private:    p.SHA,
+			Lag:        formatPayloadOffset(p.Lag(), durations),
+			LagSeconds: p.LagSeconds,
+		})
+	}
+	sort.SliceStable(lags, func(i, j int) bool { return lags[i].LagSeconds > lags[j].LagSeconds })
+	return lags
+}
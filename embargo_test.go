@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCorrelateEmbargoedChanges(t *testing.T) {
+	now := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	api, privAPI := "https://github.com/openshift/api", "https://github.com/openshift-priv/api"
+	mirror := "https://github.com/security/api-mirror"
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		changes []RawChange
+		// expected are the SHAs of the changes kept, with the SHA of their private pair
+		expected map[string]string
+	}{
+		{
+			name: "pair",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix CVE-2021-1234 (#42)", Date: now},
+				{Repository: privAPI, SHA: "private", Author: "mfojtik", Message: "fix cve-2021-1234", Date: now.Add(-3 * 24 * time.Hour)},
+			},
+			expected: map[string]string{"public": "private"},
+		},
+		{
+			name: "different authors",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix the validation", Date: now},
+				{Repository: privAPI, SHA: "private", Author: "deads2k", Message: "Fix the validation", Date: now.Add(-time.Hour)},
+			},
+			expected: map[string]string{"public": "", "private": ""},
+		},
+		{
+			name: "conflicting tickets",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix the validation\n\nBug 1234", Date: now},
+				{Repository: privAPI, SHA: "private", Author: "mfojtik", Message: "Fix the validation\n\nBug 5678", Date: now.Add(-time.Hour)},
+			},
+			expected: map[string]string{"public": "", "private": ""},
+		},
+		{
+			name: "ticket only in one",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix the validation\n\nBug 1234", Date: now},
+				{Repository: privAPI, SHA: "private", Author: "mfojtik", Message: "Fix the validation", Date: now.Add(-time.Hour)},
+			},
+			expected: map[string]string{"public": "private"},
+		},
+		{
+			name: "outside window",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix the validation", Date: now},
+				{Repository: privAPI, SHA: "private", Author: "mfojtik", Message: "Fix the validation", Date: now.Add(-40 * 24 * time.Hour)},
+			},
+			expected: map[string]string{"public": "", "private": ""},
+		},
+		{
+			name: "same repository",
+			changes: []RawChange{
+				{Repository: api, SHA: "a", Author: "mfojtik", Message: "Fix the validation", Date: now},
+				{Repository: api, SHA: "b", Author: "mfojtik", Message: "Fix the validation", Date: now.Add(-time.Hour)},
+			},
+			expected: map[string]string{"a": "", "b": ""},
+		},
+		{
+			name: "closest",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Bump the API", Date: now},
+				{Repository: privAPI, SHA: "old", Author: "mfojtik", Message: "Bump the API", Date: now.Add(-10 * 24 * time.Hour)},
+				{Repository: privAPI, SHA: "recent", Author: "mfojtik", Message: "Bump the API", Date: now.Add(-24 * time.Hour)},
+			},
+			expected: map[string]string{"public": "recent", "old": ""},
+		},
+		{
+			name:    "alias",
+			aliases: map[string]string{mirror: api},
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Author: "mfojtik", Message: "Fix the validation", Date: now},
+				{Repository: mirror, SHA: "private", Author: "mfojtik", Message: "Fix the validation", Date: now.Add(time.Hour)},
+			},
+			expected: map[string]string{"public": "private"},
+		},
+		{
+			name: "unknown author",
+			changes: []RawChange{
+				{Repository: api, SHA: "public", Message: "Fix the validation", Date: now},
+				{Repository: privAPI, SHA: "private", Message: "Fix the validation", Date: now.Add(-time.Hour)},
+			},
+			expected: map[string]string{"public": "", "private": ""},
+		},
+	}
+	for _, test := range tests {
+		var changes []Change
+		for _, raw := range test.changes {
+			changes = append(changes, newChange(raw))
+		}
+		result := map[string]string{}
+		for _, c := range correlateEmbargoedChanges(changes, test.aliases, defaultEmbargoWindow) {
+			result[c.raw.SHA] = ""
+			if c.raw.PrivatePair != nil {
+				result[c.raw.SHA] = c.raw.PrivatePair.SHA
+			}
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestEmbargoLags(t *testing.T) {
+	now := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	changes := correlateEmbargoedChanges([]Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a1", Author: "mfojtik", Message: "Fix the validation", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift-priv/api", SHA: "a2", Author: "mfojtik", Message: "Fix the validation", Date: now.Add(-3 * 24 * time.Hour)}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "b1", Author: "deads2k", Message: "Fix the login", Date: now}),
+		newChange(RawChange{Repository: "https://github.com/openshift-priv/oc", SHA: "b2", Author: "deads2k", Message: "Fix the login", Date: now.Add(-2 * time.Hour)}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "c1", Author: "deads2k", Message: "Bump", Date: now}),
+	}, nil, defaultEmbargoWindow)
+	if len(changes) != 3 {
+		t.Fatalf("expected the pairs collapsed, got %d changes", len(changes))
+	}
+	for _, c := range changes {
+		if c.raw.SHA == "a1" && !strings.Contains(c.URL, "(also in openshift-priv/api, earlier by 3d)") {
+			t.Errorf("expected the private pair annotated, got %q", c.URL)
+		}
+	}
+
+	lags := embargoLags(changes, newFormatter("", time.Now()))
+	if len(lags) != 2 || lags[0].Public != "a1" || lags[0].Private != "a2" || lags[0].Lag != "+3d" || lags[1].Repository != "openshift/oc" || lags[1].LagSeconds != 7200 {
+		t.Errorf("expected the longest delay first, got %+v", lags)
+	}
+	if lags := embargoLags(changes[2:], newFormatter("", time.Now())); lags == nil || len(lags) != 0 {
+		t.Errorf("expected no pairs, got %#v", lags)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Changes: changes, EmbargoLags: lags}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"privatePair": {`) || !strings.Contains(report, `"privateSHA": "a2"`) || !strings.Contains(report, `"lagSeconds": 259200`) {
+		t.Errorf("expected both commits in the JSON, got:\n%s", report)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatTable, Report{Changes: changes, EmbargoLags: []EmbargoLag{}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No changes landed both in a private mirror and in the public repository.") {
+		t.Errorf("expected the empty embargo lag section, got:\n%s", out.String())
+	}
+}
+
+func TestFormatEmbargoPair(t *testing.T) {
+	pair := EmbargoPair{Repository: "https://github.com/openshift-priv/api", LagSeconds: -int64((2 * time.Hour).Seconds())}
+	if formatted := formatEmbargoPair(pair, newFormatter("", time.Now())); formatted != "(also in openshift-priv/api, later by 2h)" {
+		t.Errorf("unexpected %q", formatted)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// maxEmptyExplanations caps the number of extra requests made to explain empty repositories
+const maxEmptyExplanations = 20
+
+// EmptyRepository is a repository that had no changes in the requested window.
+type EmptyRepository struct {
+	Repository   string
+	LastActivity time.Time
+	Err          error
+}
+
+func getLastActivity(ctx context.Context, client *github.Client, repository, branch string) (time.Time, error) {
+	organization, name, ok := parseRepositoryOrgName(repository)
+	if !ok {
+		return time.Time{}, nil
+	}
+	commits, _, err := client.Repositories.ListCommits(withCategory(ctx, categoryLastActivity), organization, name, &github.CommitsListOptions{
+		SHA:         branch,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil || len(commits) == 0 {
+		return time.Time{}, err
+	}
+	return commitDate(commits[0]), nil
+}
+
+// findEmptyRepositories returns repositories that were processed without error but had no changes.
+func findEmptyRepositories(repositories []string, changes []Change, errs []RepositoryError) []string {
+	seen := map[string]bool{}
+	for _, c := range changes {
+		seen[c.raw.Repository] = true
+	}
+	for _, e := range errs {
+		seen[e.Repository] = true
+	}
+	var empty []string
+	for _, r := range repositories {
+		if !seen[r] {
+			empty = append(empty, r)
+		}
+	}
+	return empty
+}
+
+// explainEmptyRepositories looks up the most recent commit on the branch for (up to maxEmptyExplanations)
+// repositories without changes, regardless of the window.
+func explainEmptyRepositories(ctx context.Context, client *github.Client, branch string, repositories []string) []EmptyRepository {
+	if len(repositories) > maxEmptyExplanations {
+		log.Printf("Only looking up last activity for %d of %d repositories without changes", maxEmptyExplanations, len(repositories))
+		repositories = repositories[:maxEmptyExplanations]
+	}
+	var result []EmptyRepository
+	for _, r := range repositories {
+		lastActivity, err := getLastActivity(ctx, client, r, branch)
+		result = append(result, EmptyRepository{Repository: r, LastActivity: lastActivity, Err: err})
+	}
+	return result
+}
+
+func printEmptySummary(empty []EmptyRepository, allEmpty bool, branch string, since time.Duration, durations Formatter) {
+	var mostRecent time.Time
+	if len(empty) > 0 {
+		log.Printf("%d repositories without changes:", len(empty))
+	}
+	for _, e := range empty {
+		switch {
+		case e.Err != nil:
+			log.Printf("  %s: %v", e.Repository, e.Err)
+		case e.LastActivity.IsZero():
+			log.Printf("  %s: no commits in %s branch", e.Repository, branch)
+		default:
+			log.Printf("  %s: last activity %s", e.Repository, durations.Ago(e.LastActivity))
+			if e.LastActivity.After(mostRecent) {
+				mostRecent = e.LastActivity
+			}
+		}
+	}
+	if !allEmpty {
+		return
+	}
+	log.Printf("!!! No changes found in any repository. The %s branch may not exist yet or the %s window may be too short.", branch, since)
+	if !mostRecent.IsZero() {
+		log.Printf("!!! The most recent activity seen across all repositories was %s (%s).", durations.Ago(mostRecent), mostRecent.In(displayLocation).Format(time.RFC3339))
+	}
+}
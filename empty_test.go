@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestFindEmptyRepositories(t *testing.T) {
+	repositories := []string{"https://github.com/openshift/api", "https://github.com/openshift/origin", "https://github.com/openshift/installer"}
+	changes := []Change{{raw: RawChange{Repository: "https://github.com/openshift/api"}}}
+	errs := []RepositoryError{{Repository: "https://github.com/openshift/installer"}}
+	if empty := findEmptyRepositories(repositories, changes, errs); !reflect.DeepEqual(empty, []string{"https://github.com/openshift/origin"}) {
+		t.Errorf("expected only the repository without changes and errors, got %v", empty)
+	}
+}
+
+func TestExplainEmptyRepositories(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lookups++
+		if req.URL.Query().Get("per_page") != "1" || req.URL.Query().Get("sha") != "release-4.12" {
+			t.Errorf("expected a single commit of the branch, got %s", req.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"sha": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "commit": {"committer": {"date": "2021-08-06T10:00:00Z"}}}]`)
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	var repositories []string
+	for i := 0; i < maxEmptyExplanations+5; i++ {
+		repositories = append(repositories, fmt.Sprintf("https://github.com/openshift/repo-%d", i))
+	}
+	empty := explainEmptyRepositories(context.Background(), client, "release-4.12", repositories)
+	if len(empty) != maxEmptyExplanations || lookups != maxEmptyExplanations {
+		t.Errorf("expected the lookups capped at %d, got %d results and %d lookups", maxEmptyExplanations, len(empty), lookups)
+	}
+	if empty[0].Err != nil || empty[0].LastActivity.Format("2006-01-02") != "2021-08-06" {
+		t.Errorf("expected the date of the last commit, got %+v", empty[0])
+	}
+}
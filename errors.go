@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Kinds of RepositoryError.
+const (
+	ErrorKindPrivateFork   = "private fork"
+	ErrorKindNotFound      = "not found"
+	ErrorKindBranchMissing = "branch missing"
+	ErrorKindUnauthorized  = "unauthorized"
+	ErrorKindRateLimited   = "rate limited"
+	ErrorKindTimeout       = "timeout"
+	ErrorKindMissingClone  = "missing clone"
+	ErrorKindInternal      = "internal error"
+	ErrorKindCanceled      = "canceled"
+	ErrorKindTruncated     = "truncated"
+	ErrorKindOther         = "error"
+
+	// repositories Github blocks access to, retrying or another token does not help
+	ErrorKindIPAllowList = "blocked by IP allow list"
+	ErrorKindLegalBlock  = "blocked for legal reasons"
+)
+
+// strictIncludeBlocked makes -strict fail on repositories blocked by Github (see -strict-include)
+const strictIncludeBlocked = "blocked"
+
+// ErrPayloadNotFound is wrapped by errors of payloads that don't exist or can't be pulled.
+var ErrPayloadNotFound = errors.New("payload not found")
+
+// Sentinel errors matching a RepositoryError of the kind with errors.Is. The underlying go-github error (eg.
+// *github.RateLimitError) is still available to errors.As.
+var (
+	ErrPrivateFork   = errors.New(ErrorKindPrivateFork)
+	ErrNotFound      = errors.New(ErrorKindNotFound)
+	ErrBranchMissing = errors.New(ErrorKindBranchMissing)
+	ErrUnauthorized  = errors.New(ErrorKindUnauthorized)
+	ErrRateLimited   = errors.New(ErrorKindRateLimited)
+	ErrTimeout       = errors.New(ErrorKindTimeout)
+	// ErrMissingClone is also wrapped by the errors of repositories without a clone in -git-mirror-dir
+	ErrMissingClone = errors.New("no clone in the mirror directory")
+	// ErrPanic is also wrapped by the errors of repositories whose processing panicked
+	ErrPanic = errors.New("panic while processing the repository")
+	// ErrCanceled is also wrapped by the errors of repositories not processed because the previous ones failed
+	// to authenticate
+	ErrCanceled    = errors.New("canceled after consecutive authentication failures")
+	ErrTruncated   = errors.New(ErrorKindTruncated)
+	ErrIPAllowList = errors.New(ErrorKindIPAllowList)
+	ErrLegalBlock  = errors.New(ErrorKindLegalBlock)
+)
+
+// errAppTokenRefresh is wrapped by errors of requests made without a token, as the Github App installation token could
+// not be refreshed.
+var errAppTokenRefresh = errors.New("unable to refresh the Github App installation token")
+
+// exitCodeAuthFailure is the exit code when the run was canceled because the token stopped working.
+const exitCodeAuthFailure = 3
+
+var errorKindSentinels = map[string]error{
+	ErrorKindPrivateFork:   ErrPrivateFork,
+	ErrorKindNotFound:      ErrNotFound,
+	ErrorKindBranchMissing: ErrBranchMissing,
+	ErrorKindUnauthorized:  ErrUnauthorized,
+	ErrorKindRateLimited:   ErrRateLimited,
+	ErrorKindTimeout:       ErrTimeout,
+	ErrorKindMissingClone:  ErrMissingClone,
+	ErrorKindInternal:      ErrPanic,
+	ErrorKindCanceled:      ErrCanceled,
+	ErrorKindTruncated:     ErrTruncated,
+	ErrorKindIPAllowList:   ErrIPAllowList,
+	ErrorKindLegalBlock:    ErrLegalBlock,
+}
+
+// RepositoryError records a repository that could not be processed, together with
+// a classification that is more useful to the user than the raw API error.
+type RepositoryError struct {
+	Repository string
+	Kind       string
+	Err        error
+}
+
+func (e RepositoryError) Error() string {
+	return fmt.Sprintf("%s [%s]: %v", e.Repository, e.Kind, e.Err)
+}
+
+// Unwrap allows errors.Is and errors.As to check the underlying (eg. go-github) error.
+func (e RepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error of the kind, which also works for errors loaded from raw data or resumed runs that
+// no longer have the go-github error.
+func (e RepositoryError) Is(target error) bool {
+	sentinel, ok := errorKindSentinels[e.Kind]
+	return ok && sentinel == target
+}
+
+func responseStatus(err error) int {
+	var errResponse *github.ErrorResponse
+	if errors.As(err, &errResponse) && errResponse.Response != nil {
+		return errResponse.Response.StatusCode
+	}
+	return 0
+}
+
+func isNotFound(err error) bool {
+	return responseStatus(err) == http.StatusNotFound
+}
+
+// isBranchMissing reports whether the commits could not be listed because the branch does not exist.
+func isBranchMissing(err error) bool {
+	var errResponse *github.ErrorResponse
+	if !errors.As(err, &errResponse) {
+		return false
+	}
+	status := responseStatus(err)
+	return (status == http.StatusNotFound || status == http.StatusUnprocessableEntity) && strings.HasPrefix(errResponse.Message, "No commit found")
+}
+
+// isIPAllowListed reports whether Github refused access (403) because the organization allows access only from
+// listed IP addresses, eg. "... the `openshift-priv` organization has an IP allow list enabled, and your IP address
+// is not permitted to access this resource."
+func isIPAllowListed(err error) bool {
+	var errResponse *github.ErrorResponse
+	if !errors.As(err, &errResponse) || responseStatus(err) != http.StatusForbidden {
+		return false
+	}
+	return strings.Contains(strings.ToLower(errResponse.Message), "ip allow list")
+}
+
+// isLegalBlock reports whether Github blocks the repository for legal reasons (451, eg. a DMCA takedown).
+func isLegalBlock(err error) bool {
+	return responseStatus(err) == http.StatusUnavailableForLegalReasons
+}
+
+// isBlocked reports whether the errors of the kind are repositories Github blocks access to.
+func isBlocked(kind string) bool {
+	return kind == ErrorKindIPAllowList || kind == ErrorKindLegalBlock
+}
+
+func isRateLimited(err error) bool {
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	return errors.As(err, &rateLimit) || errors.As(err, &abuse)
+}
+
+// isAuthFailure reports whether Github rejected the token (401), or refused access (403) for a reason other
+// than rate limits and IP allow lists, which Github also responds to with 403.
+func isAuthFailure(err error) bool {
+	if errors.Is(err, errAppTokenRefresh) {
+		return true
+	}
+	if isIPAllowListed(err) {
+		return false
+	}
+	switch responseStatus(err) {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		var errResponse *github.ErrorResponse
+		errors.As(err, &errResponse)
+		return !isRateLimited(err) && errResponse.Response.Header.Get("X-RateLimit-Remaining") != "0" && len(errResponse.Response.Header.Get("Retry-After")) == 0
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func classifyRepositoryError(organization string, err error) string {
+	switch {
+	case errors.Is(err, ErrCanceled):
+		return ErrorKindCanceled
+	case errors.Is(err, ErrPanic):
+		return ErrorKindInternal
+	case errors.Is(err, ErrMissingClone):
+		return ErrorKindMissingClone
+	case isTruncated(err):
+		return ErrorKindTruncated
+	case isRateLimited(err):
+		return ErrorKindRateLimited
+	case isIPAllowListed(err):
+		return ErrorKindIPAllowList
+	case isLegalBlock(err):
+		return ErrorKindLegalBlock
+	case responseStatus(err) == http.StatusUnauthorized || errors.Is(err, errAppTokenRefresh):
+		return ErrorKindUnauthorized
+	case isTimeout(err):
+		return ErrorKindTimeout
+	case isBranchMissing(err):
+		return ErrorKindBranchMissing
+	case !isNotFound(err):
+		return ErrorKindOther
+	}
+	// Github responds with 404 for private repositories the token can't read
+	if isPrivateForkOrganization(organization) {
+		return ErrorKindPrivateFork
+	}
+	return ErrorKindNotFound
+}
+
+// errorKindHints tell the user what to do about the errors of the kind.
+var errorKindHints = map[string]string{
+	ErrorKindUnauthorized:  "the Github token is invalid or expired",
+	ErrorKindRateLimited:   "retry later or lower -requests-per-second",
+	ErrorKindTimeout:       "Github did not respond in time, retry later",
+	ErrorKindCanceled:      "these repositories were not processed, as the previous ones failed to authenticate (see -auth-failure-limit)",
+	ErrorKindInternal:      "this is a bug, please report it together with the stack trace printed with -v",
+	ErrorKindBranchMissing: "the branch does not exist (yet) in these repositories",
+	ErrorKindNotFound:      "the token can't read these repositories, map them to readable mirrors with -repo-alias",
+	ErrorKindPrivateFork:   "the token can't read these private forks, map them to readable mirrors with -repo-alias",
+	ErrorKindTruncated:     "only some commits of these repositories are shown, raise -max-commits-per-repo or -max-total-commits when they were reached",
+	ErrorKindIPAllowList:   "their organization only allows listed IP addresses, run from an allowlisted runner (eg. the CI) instead of a VPN or laptop",
+	ErrorKindLegalBlock:    "Github blocks these repositories for legal reasons (eg. a DMCA takedown), remove them with -ignore-file or map them to another mirror with -repo-alias",
+}
+
+func printErrorSummary(errs []RepositoryError) {
+	if len(errs) == 0 {
+		return
+	}
+	var failed, blocked []RepositoryError
+	for _, e := range errs {
+		if isBlocked(e.Kind) {
+			blocked = append(blocked, e)
+		} else {
+			failed = append(failed, e)
+		}
+	}
+	if len(failed) > 0 {
+		log.Printf("%d repositories could not be processed:", len(failed))
+		printErrors(failed)
+	}
+	if len(blocked) > 0 {
+		log.Printf("%d repositories are blocked by Github, retrying does not help:", len(blocked))
+		printErrors(blocked)
+	}
+}
+
+// printErrors logs the errors followed by the hints of their kinds.
+func printErrors(errs []RepositoryError) {
+	seen := map[string]bool{}
+	var kinds []string
+	for _, e := range errs {
+		log.Printf("  %s [%s]: %v", e.Repository, e.Kind, e.Err)
+		if _, ok := errorKindHints[e.Kind]; ok && !seen[e.Kind] {
+			seen[e.Kind] = true
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	// sorted by kind, so the output is stable
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		log.Printf("  %s: %s", kind, errorKindHints[kind])
+	}
+}
+
+// repositoryErrorsResult fails the command when repositories failed for a reason the user has to fix
+// (token, rate limits), repositories that don't exist or are truncated don't fail it.
+func repositoryErrorsResult(errs []RepositoryError) error {
+	failed := map[string]int{}
+	for _, e := range errs {
+		switch e.Kind {
+		case ErrorKindUnauthorized, ErrorKindRateLimited, ErrorKindCanceled:
+			failed[e.Kind]++
+		}
+	}
+	if n := failed[ErrorKindCanceled]; n > 0 {
+		return &exitError{code: exitCodeAuthFailure, message: fmt.Sprintf(":-( the Github token stopped working, %d repositories were not processed", n)}
+	}
+	if n := failed[ErrorKindUnauthorized]; n > 0 {
+		return fmt.Errorf("%d repositories could not be processed because the Github token is not authorized", n)
+	}
+	if n := failed[ErrorKindRateLimited]; n > 0 {
+		return fmt.Errorf("%d repositories could not be processed because of Github rate limits", n)
+	}
+	return nil
+}
+
+// truncatedResult fails the -strict runs with truncated repositories.
+func truncatedResult(errs []RepositoryError) error {
+	truncated, skipped := 0, 0
+	for _, e := range errs {
+		if e.Kind == ErrorKindTruncated {
+			truncated++
+			skipped += skippedCommits(e.Err)
+		}
+	}
+	if truncated == 0 {
+		return nil
+	}
+	return fmt.Errorf("-strict: the commit list of %d repositories is truncated, about %d commits were skipped", truncated, skipped)
+}
+
+// blockedResult fails the -strict runs with repositories blocked by Github, when -strict-include has blocked.
+func blockedResult(errs []RepositoryError) error {
+	blocked := 0
+	for _, e := range errs {
+		if isBlocked(e.Kind) {
+			blocked++
+		}
+	}
+	if blocked == 0 {
+		return nil
+	}
+	return fmt.Errorf("-strict: %d repositories are blocked by Github (IP allow lists or legal blocks)", blocked)
+}
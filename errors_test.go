@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeErrorsGithub responds to the commit listing of each repository with a realistic Github error, the blocked
+// repositories with bodies captured from Github.
+func fakeErrorsGithub(t *testing.T) *github.Client {
+	fixture := func(name string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join(fixturesDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	ipAllowList, legalBlock := fixture("ip-allow-list.json"), fixture("legal-block.json")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/missing/commits", "/repos/openshift-priv/api/commits":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found", "documentation_url": "https://docs.github.com/rest/reference/repos#list-commits"}`)
+		case "/repos/openshift/api/commits":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No commit found for SHA: release-4.99", "documentation_url": "https://docs.github.com/rest/reference/repos#list-commits"}`)
+		case "/repos/openshift/oc/commits":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "Bad credentials", "documentation_url": "https://docs.github.com/rest"}`)
+		case "/repos/openshift/origin/commits":
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "API rate limit exceeded for user ID 1.", "documentation_url": "https://docs.github.com/rest/overview/resources-in-the-rest-api#rate-limiting"}`)
+		case "/repos/openshift/installer/commits":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have triggered an abuse detection mechanism.", "documentation_url": "https://developer.github.com/v3/#abuse-rate-limits"}`)
+		case "/repos/openshift-priv/installer/commits":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(ipAllowList)
+		case "/repos/openshift/dmca/commits":
+			w.WriteHeader(http.StatusUnavailableForLegalReasons)
+			w.Write(legalBlock)
+		case "/repos/openshift/console/commits":
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"message": "Server Error"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		organization, name string
+		kind               string
+		sentinel           error
+		// hint is logged by printErrorSummary for the kind
+		hint string
+	}{
+		{organization: "openshift", name: "missing", kind: ErrorKindNotFound, sentinel: ErrNotFound},
+		{organization: "openshift-priv", name: "api", kind: ErrorKindPrivateFork, sentinel: ErrPrivateFork},
+		{organization: "openshift", name: "api", kind: ErrorKindBranchMissing, sentinel: ErrBranchMissing, hint: "branch missing: the branch does not exist (yet) in these repositories"},
+		{organization: "openshift", name: "oc", kind: ErrorKindUnauthorized, sentinel: ErrUnauthorized, hint: "unauthorized: the Github token is invalid or expired"},
+		{organization: "openshift", name: "origin", kind: ErrorKindRateLimited, sentinel: ErrRateLimited, hint: "rate limited: retry later or lower -requests-per-second"},
+		{organization: "openshift", name: "installer", kind: ErrorKindRateLimited, sentinel: ErrRateLimited},
+		{organization: "openshift", name: "console", kind: ErrorKindTimeout, sentinel: ErrTimeout, hint: "timeout: Github did not respond in time, retry later"},
+		{organization: "openshift-priv", name: "installer", kind: ErrorKindIPAllowList, sentinel: ErrIPAllowList, hint: "run from an allowlisted runner"},
+		{organization: "openshift", name: "dmca", kind: ErrorKindLegalBlock, sentinel: ErrLegalBlock, hint: "Github blocks these repositories for legal reasons"},
+		{organization: "openshift", name: "router", kind: ErrorKindOther},
+	}
+	for _, test := range tests {
+		// a client per repository, go-github refuses requests once it saw the rate limit exhausted
+		client := fakeErrorsGithub(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, _, err := client.Repositories.ListCommits(ctx, test.organization, test.name, &github.CommitsListOptions{SHA: "release-4.99"})
+		cancel()
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		repository := "https://github.com/" + test.organization + "/" + test.name
+		repositoryErr := RepositoryError{Repository: repository, Kind: classifyRepositoryError(test.organization, err), Err: err}
+		if repositoryErr.Kind != test.kind {
+			t.Errorf("%s: expected kind %q, got %q (%v)", test.name, test.kind, repositoryErr.Kind, err)
+			continue
+		}
+
+		var wrapped error = fmt.Errorf("collect: %w", repositoryErr)
+		if test.sentinel != nil && !errors.Is(wrapped, test.sentinel) {
+			t.Errorf("%s: expected the error to be %v", test.name, test.sentinel)
+		}
+		for _, other := range []error{ErrNotFound, ErrUnauthorized, ErrTruncated} {
+			if other != test.sentinel && errors.Is(wrapped, other) {
+				t.Errorf("%s: expected the error not to be %v", test.name, other)
+			}
+		}
+		// the go-github error is still reachable
+		var errResponse *github.ErrorResponse
+		var rateLimit *github.RateLimitError
+		var abuse *github.AbuseRateLimitError
+		if !errors.As(wrapped, &errResponse) && !errors.As(wrapped, &rateLimit) && !errors.As(wrapped, &abuse) && !errors.Is(wrapped, context.DeadlineExceeded) {
+			t.Errorf("%s: expected the underlying error to be available, got %#v", test.name, err)
+		}
+
+		if rendered := repositoryErr.Error(); !strings.HasPrefix(rendered, repository+" ["+test.kind+"]: ") {
+			t.Errorf("%s: unexpected rendering %q", test.name, rendered)
+		}
+		output := captureLog(t, func() { printErrorSummary([]RepositoryError{repositoryErr}) })
+		header := "1 repositories could not be processed:"
+		if isBlocked(test.kind) {
+			header = "1 repositories are blocked by Github, retrying does not help:"
+		}
+		if !strings.Contains(output, header) || !strings.Contains(output, repository+" ["+test.kind+"]") {
+			t.Errorf("%s: expected the error in the summary, got:\n%s", test.name, output)
+		}
+		if len(test.hint) > 0 && !strings.Contains(output, test.hint) {
+			t.Errorf("%s: expected the hint %q, got:\n%s", test.name, test.hint, output)
+		}
+	}
+}
+
+func TestRepositoryErrorWithoutCause(t *testing.T) {
+	// errors loaded from raw data or resumed runs only have the message, the kind still matches
+	err := error(RepositoryError{Repository: "https://github.com/openshift/api", Kind: ErrorKindTruncated, Err: errors.New("page 2 failed")})
+	if !errors.Is(err, ErrTruncated) || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the error to only match ErrTruncated")
+	}
+	if errors.Is(RepositoryError{Kind: ErrorKindOther, Err: errors.New("boom")}, ErrNotFound) {
+		t.Errorf("expected other errors not to match a sentinel")
+	}
+}
+
+func TestPrintErrorSummarySortsHints(t *testing.T) {
+	errs := []RepositoryError{
+		{Repository: "https://github.com/openshift/c", Kind: ErrorKindUnauthorized, Err: errors.New("401")},
+		{Repository: "https://github.com/openshift/a", Kind: ErrorKindTimeout, Err: errors.New("timeout")},
+		{Repository: "https://github.com/openshift/b", Kind: ErrorKindBranchMissing, Err: errors.New("404")},
+		{Repository: "https://github.com/openshift/d", Kind: ErrorKindBranchMissing, Err: errors.New("404")},
+		{Repository: "https://github.com/openshift/e", Kind: ErrorKindOther, Err: errors.New("502")},
+	}
+	first := captureLog(t, func() { printErrorSummary(errs) })
+	for i := 0; i < 10; i++ {
+		if output := captureLog(t, func() { printErrorSummary(errs) }); output != first {
+			t.Fatalf("expected the same output, got:\n%s\nand:\n%s", first, output)
+		}
+	}
+	branch, timeout, unauthorized := strings.Index(first, "  branch missing: "), strings.Index(first, "  timeout: "), strings.Index(first, "  unauthorized: ")
+	if branch < 0 || !(branch < timeout && timeout < unauthorized) {
+		t.Errorf("expected the hints sorted by kind, got:\n%s", first)
+	}
+}
+
+func TestRepositoryErrorsResult(t *testing.T) {
+	tests := []struct {
+		kinds    []string
+		expected string
+	}{
+		{kinds: []string{ErrorKindNotFound, ErrorKindTruncated, ErrorKindBranchMissing}},
+		{kinds: []string{ErrorKindNotFound, ErrorKindRateLimited, ErrorKindRateLimited}, expected: "2 repositories could not be processed because of Github rate limits"},
+		{kinds: []string{ErrorKindRateLimited, ErrorKindUnauthorized}, expected: "1 repositories could not be processed because the Github token is not authorized"},
+	}
+	for _, test := range tests {
+		var errs []RepositoryError
+		for _, kind := range test.kinds {
+			errs = append(errs, RepositoryError{Kind: kind, Err: errors.New(kind)})
+		}
+		err := repositoryErrorsResult(errs)
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%v: unexpected error: %v", test.kinds, err)
+		case len(test.expected) > 0 && (err == nil || err.Error() != test.expected):
+			t.Errorf("%v: expected %q, got %v", test.kinds, test.expected, err)
+		}
+	}
+}
+
+func TestBlockedRepositories(t *testing.T) {
+	errs := []RepositoryError{
+		{Repository: "https://github.com/openshift/api", Kind: ErrorKindTimeout, Err: errors.New("timeout")},
+		{Repository: "https://github.com/openshift-priv/installer", Kind: ErrorKindIPAllowList, Err: errors.New("403")},
+		{Repository: "https://github.com/openshift/dmca", Kind: ErrorKindLegalBlock, Err: errors.New("451")},
+	}
+	output := captureLog(t, func() { printErrorSummary(errs) })
+	failed, blocked := strings.Index(output, "1 repositories could not be processed:"), strings.Index(output, "2 repositories are blocked by Github")
+	if failed < 0 || blocked < failed || strings.Index(output, "openshift/api [") > blocked || strings.Index(output, "openshift/dmca [") < blocked {
+		t.Errorf("expected the blocked repositories in their own section, got:\n%s", output)
+	}
+
+	if err := (&queryOptions{strictInclude: commaSeparatedList{"forbidden"}}).validate(); err == nil || !strings.Contains(err.Error(), `unknown -strict-include category "forbidden"`) {
+		t.Errorf("expected an unknown category to fail, got %v", err)
+	}
+	// blocked repositories only fail -strict runs including them
+	for _, test := range []struct {
+		query  queryOptions
+		failed bool
+	}{
+		{query: queryOptions{}},
+		{query: queryOptions{strict: true}},
+		{query: queryOptions{strictInclude: commaSeparatedList{strictIncludeBlocked}}},
+		{query: queryOptions{strict: true, strictInclude: commaSeparatedList{strictIncludeBlocked}}, failed: true},
+	} {
+		result := &queryResult{Errors: errs}
+		captureLog(t, func() {
+			if err := test.query.render(ioutil.Discard, formatJSON, result); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if failed := result.Failed != nil; failed != test.failed {
+			t.Errorf("strict %v, include %v: unexpected result %v", test.query.strict, test.query.strictInclude, result.Failed)
+		} else if failed && result.Failed.Error() != "-strict: 2 repositories are blocked by Github (IP allow lists or legal blocks)" {
+			t.Errorf("unexpected error %v", result.Failed)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fixturesDir holds the Github API responses recorded by record_test.go (or written in their format)
+var fixturesDir = filepath.Join("testdata", "github", "fixtures")
+
+// scenariosDir holds the scenarios of the end to end tests
+var scenariosDir = filepath.Join("testdata", "github", "scenarios")
+
+// fakeRoute is the response of the fake Github API to the requests with its method, path and query parameters (the
+// other parameters are ignored).
+type fakeRoute struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Fixture is the file in fixturesDir with the response body, Body is the body itself
+	Fixture string          `json:"fixture,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	// Link are the pages of the Link header (eg. {"next": 2, "last": 3}), the page parameter of the request URL
+	// is replaced by them
+	Link map[string]int `json:"link,omitempty"`
+}
+
+// fakePayloadTag is a payload image built from the repository.
+type fakePayloadTag struct {
+	Tag        string `json:"tag"`
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+}
+
+// fakeScenario describes the payload and the responses of the Github API of an end to end test.
+type fakeScenario struct {
+	Description string           `json:"description"`
+	Payload     []fakePayloadTag `json:"payload"`
+	Routes      []fakeRoute      `json:"routes"`
+}
+
+// defaultRoutes answer the requests made by most runs, the routes of the scenario take precedence.
+var defaultRoutes = []fakeRoute{
+	{Method: http.MethodGet, Path: "/user", Fixture: "user.json"},
+	{Method: http.MethodGet, Path: "/rate_limit", Fixture: "rate-limit.json"},
+}
+
+func loadScenario(t *testing.T, name string) fakeScenario {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(scenariosDir, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scenario fakeScenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		t.Fatalf("invalid scenario %s: %v", name, err)
+	}
+	return scenario
+}
+
+// writeRelease writes the payload of the scenario in the format of "oc adm release info -o json", for
+// -release-info-file.
+func (s fakeScenario) writeRelease(t *testing.T, dir string) string {
+	t.Helper()
+	var release Release
+	for _, tag := range s.Payload {
+		release.Refs.Spec.Tags = append(release.Refs.Spec.Tags, Tag{
+			Name: tag.Tag,
+			Annotations: map[string]string{
+				sourceLocationAnnotation: "https://github.com/" + tag.Repository,
+				commitIDAnnotation:       tag.Commit,
+			},
+			From: TagReference{Kind: "DockerImage", Name: "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:" + tag.Commit},
+		})
+	}
+	data, err := json.Marshal(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "release.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakeGithub serves the routes as the Github API, requests matching none of them fail the test.
+type fakeGithub struct {
+	*httptest.Server
+	t      *testing.T
+	routes []fakeRoute
+
+	lock     sync.Mutex
+	requests []string
+}
+
+func newFakeGithub(t *testing.T, routes []fakeRoute) *fakeGithub {
+	f := &fakeGithub{t: t, routes: append(append([]fakeRoute{}, routes...), defaultRoutes...)}
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (r fakeRoute) matches(req *http.Request) bool {
+	if r.Method != req.Method || r.Path != req.URL.Path {
+		return false
+	}
+	query := req.URL.Query()
+	for key, value := range r.Query {
+		// go-github leaves the first page out
+		if actual := query.Get(key); actual != value && !(key == "page" && value == "1" && len(actual) == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeGithub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.lock.Lock()
+	f.requests = append(f.requests, req.Method+" "+req.URL.RequestURI())
+	f.lock.Unlock()
+	for _, route := range f.routes {
+		if !route.matches(req) {
+			continue
+		}
+		body := []byte(route.Body)
+		if len(route.Fixture) > 0 {
+			var err error
+			if body, err = ioutil.ReadFile(filepath.Join(fixturesDir, route.Fixture)); err != nil {
+				f.t.Errorf("fake Github: %v", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		if len(route.Link) > 0 {
+			w.Header().Set("Link", f.link(req, route.Link))
+		}
+		for key, value := range route.Headers {
+			w.Header().Set(key, value)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+	f.t.Errorf("fake Github: unexpected request %s %s", req.Method, req.URL.RequestURI())
+	w.WriteHeader(http.StatusNotImplemented)
+	fmt.Fprintf(w, `{"message": "no route for %s %s"}`, req.Method, req.URL.Path)
+}
+
+// link returns the Link header with the pages, in the order Github sends them.
+func (f *fakeGithub) link(req *http.Request, pages map[string]int) string {
+	var links []string
+	for _, rel := range []string{"prev", "next", "last", "first"} {
+		page, ok := pages[rel]
+		if !ok {
+			continue
+		}
+		query := req.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		links = append(links, fmt.Sprintf(`<%s%s?%s>; rel="%s"`, f.URL, req.URL.Path, query.Encode(), rel))
+	}
+	return strings.Join(links, ", ")
+}
+
+// Requests returns the requests made so far, as "METHOD URI".
+func (f *fakeGithub) Requests() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string{}, f.requests...)
+}
+
+// countRequests returns the number of requests made to the path.
+func (f *fakeGithub) countRequests(path string) int {
+	count := 0
+	for _, r := range f.Requests() {
+		if strings.HasPrefix(strings.SplitN(r, " ", 2)[1], path+"?") || strings.HasSuffix(r, " "+path) {
+			count++
+		}
+	}
+	return count
+}
+
+// scenarioOutput is the JSON output of a run.
+type scenarioOutput struct {
+	Changes  []RawChange  `json:"changes"`
+	Errors   []RawError   `json:"errors"`
+	Metadata jsonMetadata `json:"metadata"`
+}
+
+// runScenario runs collect with the arguments against the fake Github API serving the scenario, and returns the JSON
+// output, written even by runs failing with an exitError.
+func runScenario(t *testing.T, name string, args ...string) (scenarioOutput, *fakeGithub, error) {
+	t.Helper()
+	return runFakeScenario(t, loadScenario(t, name), args...)
+}
+
+// runFakeScenario is runScenario of a scenario built by the test, eg. with commits relative to the current time.
+func runFakeScenario(t *testing.T, scenario fakeScenario, args ...string) (scenarioOutput, *fakeGithub, error) {
+	t.Helper()
+	github := newFakeGithub(t, scenario.Routes)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.json")
+	err := run(append([]string{
+		"collect",
+		"-release-info-file", scenario.writeRelease(t, dir),
+		"-github-api-url", github.URL,
+		"-token", "fake-token",
+		"-format", formatJSON,
+		"-output", output,
+		// without -since the window starts at the previous accepted payload of the release controller
+		"-since", "24h",
+		// the personal ignore file of the user running the tests
+		"-no-ignore",
+	}, args...))
+	var out scenarioOutput
+	data, readErr := ioutil.ReadFile(output)
+	// a failed run may have created the output without writing it
+	if readErr != nil || (err != nil && len(data) == 0) {
+		return out, github, err
+	}
+	if jsonErr := json.Unmarshal(data, &out); jsonErr != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", jsonErr, data)
+	}
+	return out, github, err
+}
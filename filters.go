@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Filter decides whether a collected change is shown. Keep returns the reason when the change is excluded.
+type Filter interface {
+	Name() string
+	Keep(c Change) (bool, string)
+}
+
+// filterChain applies filters in order, a change is excluded by the first filter that does not keep it.
+type filterChain []Filter
+
+// Apply returns the kept changes together with the number of changes excluded by each filter.
+// In explain mode no change is dropped, instead the excluded ones are annotated with the filter name.
+func (f filterChain) Apply(changes []Change, explain bool) ([]Change, map[string]int) {
+	excluded := map[string]int{}
+	var result []Change
+	for _, c := range changes {
+		name, reason, ok := f.exclude(c)
+		if !ok {
+			result = append(result, c)
+			continue
+		}
+		excluded[name]++
+		if explain {
+			c.raw.ExcludedBy = fmt.Sprintf("%s: %s", name, reason)
+			c.ExcludedBy = c.raw.ExcludedBy
+			result = append(result, c)
+		}
+	}
+	return result, excluded
+}
+
+func (f filterChain) exclude(c Change) (string, string, bool) {
+	for _, filter := range f {
+		if keep, reason := filter.Keep(c); !keep {
+			return filter.Name(), reason, true
+		}
+	}
+	return "", "", false
+}
+
+func (f filterChain) printSummary(excluded map[string]int, explain bool) {
+	if len(f) == 0 {
+		return
+	}
+	verb := "excluded"
+	if explain {
+		verb = "would exclude"
+	}
+	for _, filter := range f {
+		log.Printf("Filter %s %s %d changes", filter.Name(), verb, excluded[filter.Name()])
+	}
+}
+
+// mergedByFilter keeps only changes merged by the given user (or bot).
+type mergedByFilter struct {
+	login string
+}
+
+func (f mergedByFilter) Name() string {
+	return "merged-by"
+}
+
+func (f mergedByFilter) Keep(c Change) (bool, string) {
+	if strings.EqualFold(c.raw.MergedBy, f.login) {
+		return true, ""
+	}
+	if len(c.raw.MergedBy) == 0 {
+		return false, "merger is not known"
+	}
+	return false, fmt.Sprintf("merged by %s", c.raw.MergedBy)
+}
+
+// excludeAuthorFilter drops changes by the given authors (eg. bots).
+type excludeAuthorFilter struct {
+	authors []string
+}
+
+func (f excludeAuthorFilter) Name() string {
+	return "exclude-author"
+}
+
+func (f excludeAuthorFilter) Keep(c Change) (bool, string) {
+	for _, a := range f.authors {
+		if strings.EqualFold(c.raw.Author, a) {
+			return false, fmt.Sprintf("authored by %s", c.raw.Author)
+		}
+	}
+	return true, ""
+}
+
+// missingBackportFilter keeps only changes that don't have a backport into the given branch.
+type missingBackportFilter struct {
+	branch string
+}
+
+func (f missingBackportFilter) Name() string {
+	return "backport-target"
+}
+
+func (f missingBackportFilter) Keep(c Change) (bool, string) {
+	for _, b := range c.raw.Backports {
+		if b.Branch == f.branch && b.State != "closed" {
+			return false, fmt.Sprintf("backported to %s in #%d", f.branch, b.Number)
+		}
+	}
+	return true, ""
+}
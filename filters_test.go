@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingBackportFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		change Change
+		keep   bool
+		reason string
+	}{
+		{name: "merged", change: Change{raw: RawChange{Backports: []Backport{{Branch: "release-4.9", Number: 43, State: "merged"}}}}, reason: "backported to release-4.9 in #43"},
+		{name: "open", change: Change{raw: RawChange{Backports: []Backport{{Branch: "release-4.9", Number: 44, State: "open"}}}}, reason: "backported to release-4.9 in #44"},
+		{name: "closed", change: Change{raw: RawChange{Backports: []Backport{{Branch: "release-4.9", Number: 45, State: "closed"}}}}, keep: true},
+		{name: "other branch", change: Change{raw: RawChange{Backports: []Backport{{Branch: "release-4.8", Number: 46, State: "merged"}}}}, keep: true},
+		{name: "none", keep: true},
+	}
+	filter := missingBackportFilter{branch: "release-4.9"}
+	for _, test := range tests {
+		keep, reason := filter.Keep(test.change)
+		if keep != test.keep || reason != test.reason {
+			t.Errorf("%s: expected %v %q, got %v %q", test.name, test.keep, test.reason, keep, reason)
+		}
+	}
+}
+
+// prefixFilter excludes the changes with message starting with the prefix.
+type prefixFilter struct {
+	name, prefix string
+}
+
+func (f prefixFilter) Name() string { return f.name }
+
+func (f prefixFilter) Keep(c Change) (bool, string) {
+	if strings.HasPrefix(c.raw.Message, f.prefix) {
+		return false, "starts with " + f.prefix
+	}
+	return true, ""
+}
+
+func TestFilterChain(t *testing.T) {
+	changes := []Change{
+		newChange(RawChange{SHA: "a", Message: "Bump the API"}),
+		newChange(RawChange{SHA: "b", Message: "Bump vendor"}),
+		newChange(RawChange{SHA: "c", Message: "Fix the validation"}),
+		newChange(RawChange{SHA: "d", Message: "Bump the API again"}),
+	}
+	chain := filterChain{prefixFilter{name: "bump", prefix: "Bump"}, prefixFilter{name: "bump-api", prefix: "Bump the API"}}
+
+	kept, excluded := chain.Apply(changes, false)
+	if len(kept) != 1 || kept[0].raw.SHA != "c" {
+		t.Errorf("expected only the fix kept, got %+v", kept)
+	}
+	// the first filter excluding a change gets it, even when the following filters exclude it too
+	if expected := map[string]int{"bump": 3}; !reflect.DeepEqual(excluded, expected) {
+		t.Errorf("expected exclusions %v, got %v", expected, excluded)
+	}
+
+	chain = filterChain{chain[1], chain[0]}
+	explained, excluded := chain.Apply(changes, true)
+	if expected := map[string]int{"bump-api": 2, "bump": 1}; !reflect.DeepEqual(excluded, expected) {
+		t.Errorf("expected exclusions %v, got %v", expected, excluded)
+	}
+	var excludedBy []string
+	for _, c := range explained {
+		excludedBy = append(excludedBy, c.ExcludedBy)
+		if c.ExcludedBy != c.raw.ExcludedBy {
+			t.Errorf("%s: expected the raw change annotated too, got %q", c.raw.SHA, c.raw.ExcludedBy)
+		}
+	}
+	expected := []string{"bump-api: starts with Bump the API", "bump: starts with Bump", "", "bump-api: starts with Bump the API"}
+	if !reflect.DeepEqual(excludedBy, expected) {
+		t.Errorf("expected all changes explained as %q, got %q", expected, excludedBy)
+	}
+	// the input is not annotated
+	if changes[0].ExcludedBy != "" {
+		t.Errorf("expected the input unchanged, got %+v", changes[0])
+	}
+}
+
+func TestMergedByFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		change Change
+		keep   bool
+		reason string
+	}{
+		{name: "merger", change: Change{raw: RawChange{MergedBy: "openshift-merge-robot"}}, keep: true},
+		{name: "case insensitive", change: Change{raw: RawChange{MergedBy: "OpenShift-Merge-Robot"}}, keep: true},
+		{name: "other merger", change: Change{raw: RawChange{MergedBy: "deads2k"}}, reason: "merged by deads2k"},
+		{name: "unknown", change: Change{raw: RawChange{MergeMethod: mergeMethodDirectPush}}, reason: "merger is not known"},
+	}
+	filter := mergedByFilter{login: "openshift-merge-robot"}
+	for _, test := range tests {
+		keep, reason := filter.Keep(test.change)
+		if keep != test.keep || reason != test.reason {
+			t.Errorf("%s: expected %v %q, got %v %q", test.name, test.keep, test.reason, keep, reason)
+		}
+	}
+}
+
+func TestExcludeAuthorFilter(t *testing.T) {
+	filter := excludeAuthorFilter{authors: []string{"openshift-bot", "bot@example.com"}}
+	tests := []struct {
+		author string
+		keep   bool
+		reason string
+	}{
+		{author: "openshift-bot", reason: "authored by openshift-bot"},
+		{author: "OpenShift-Bot", reason: "authored by OpenShift-Bot"},
+		{author: "bot@example.com", reason: "authored by bot@example.com"},
+		{author: "deads2k", keep: true},
+	}
+	for _, test := range tests {
+		keep, reason := filter.Keep(Change{raw: RawChange{Author: test.author}})
+		if keep != test.keep || reason != test.reason {
+			t.Errorf("%s: expected %v %q, got %v %q", test.author, test.keep, test.reason, keep, reason)
+		}
+	}
+}
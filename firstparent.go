@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// historyFirstParent is the Window.History of runs listing the first-parent history only (see -first-parent)
+const historyFirstParent = "first-parent"
+
+// firstParentQuery lists the commits of the branch in the window with their parents, the history connection has no
+// first-parent filter, so the mainline is followed from the head of the branch by the first parents.
+const firstParentQuery = `query($owner: String!, $name: String!, $branch: String!, $since: GitTimestamp!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    ref(qualifiedName: $branch) {
+      target {
+        ... on Commit {
+          oid
+          history(first: 100, since: $since, after: $cursor) {
+            pageInfo { hasNextPage endCursor }
+            nodes {
+              oid
+              url
+              message
+              authoredDate
+              committedDate
+              author { name email user { login } }
+              committer { name email user { login } }
+              parents(first: 2) { nodes { oid } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type graphqlActor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	User  *struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+type graphqlCommit struct {
+	OID           string        `json:"oid"`
+	URL           string        `json:"url"`
+	Message       string        `json:"message"`
+	AuthoredDate  time.Time     `json:"authoredDate"`
+	CommittedDate time.Time     `json:"committedDate"`
+	Author        *graphqlActor `json:"author"`
+	Committer     *graphqlActor `json:"committer"`
+	Parents       struct {
+		Nodes []struct {
+			OID string `json:"oid"`
+		} `json:"nodes"`
+	} `json:"parents"`
+}
+
+type firstParentResponse struct {
+	Data struct {
+		Repository *struct {
+			Ref *struct {
+				Target struct {
+					OID     string `json:"oid"`
+					History *struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []graphqlCommit `json:"nodes"`
+					} `json:"history"`
+				} `json:"target"`
+			} `json:"ref"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphqlEndpoint returns the GraphQL endpoint relative to the REST API of the client, Github Enterprise serves it
+// at /api/graphql next to /api/v3.
+func graphqlEndpoint(client *github.Client) string {
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		return "../graphql"
+	}
+	return "graphql"
+}
+
+// repositoryCommit converts the GraphQL commit to the REST one, so the rest of the processing is the same.
+func (c graphqlCommit) repositoryCommit() *github.RepositoryCommit {
+	commit := &github.RepositoryCommit{
+		SHA:     github.String(c.OID),
+		HTMLURL: github.String(c.URL),
+		Commit: &github.Commit{
+			SHA:       github.String(c.OID),
+			Message:   github.String(c.Message),
+			Author:    &github.CommitAuthor{Date: &c.AuthoredDate},
+			Committer: &github.CommitAuthor{Date: &c.CommittedDate},
+		},
+	}
+	if c.Author != nil {
+		commit.Commit.Author.Name, commit.Commit.Author.Email = github.String(c.Author.Name), github.String(c.Author.Email)
+		if c.Author.User != nil {
+			commit.Author = &github.User{Login: github.String(c.Author.User.Login)}
+		}
+	}
+	if c.Committer != nil {
+		commit.Commit.Committer.Name, commit.Commit.Committer.Email = github.String(c.Committer.Name), github.String(c.Committer.Email)
+		if c.Committer.User != nil {
+			commit.Committer = &github.User{Login: github.String(c.Committer.User.Login)}
+		}
+	}
+	for _, p := range c.Parents.Nodes {
+		commit.Parents = append(commit.Parents, github.Commit{SHA: github.String(p.OID)})
+	}
+	return commit
+}
+
+// listFirstParentCommits lists the commits of the branch since the given time reachable from its head by first
+// parents, one per merged pull request in repositories merging with merge commits.
+func listFirstParentCommits(ctx context.Context, client *github.Client, organization, name, branch string, since time.Time) ([]*github.RepositoryCommit, error) {
+	var (
+		head   string
+		listed []*github.RepositoryCommit
+		cursor *string
+	)
+	for {
+		req, err := client.NewRequest("POST", graphqlEndpoint(client), map[string]interface{}{
+			"query": firstParentQuery,
+			"variables": map[string]interface{}{
+				"owner":  organization,
+				"name":   name,
+				"branch": "refs/heads/" + branch,
+				"since":  since.UTC().Format(time.RFC3339),
+				"cursor": cursor,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var response firstParentResponse
+		if _, err := client.Do(withCategory(ctx, categoryCommitHistory), req, &response); err != nil {
+			return nil, err
+		}
+		if len(response.Errors) > 0 {
+			return nil, fmt.Errorf("GraphQL query failed: %s", response.Errors[0].Message)
+		}
+		repository := response.Data.Repository
+		if repository == nil || repository.Ref == nil {
+			return nil, fmt.Errorf("branch %s not found", branch)
+		}
+		history := repository.Ref.Target.History
+		if history == nil {
+			return nil, fmt.Errorf("branch %s does not point at a commit", branch)
+		}
+		addSpanCounter(ctx, "pages", 1)
+		head = repository.Ref.Target.OID
+		for _, c := range history.Nodes {
+			listed = append(listed, c.repositoryCommit())
+		}
+		if !history.PageInfo.HasNextPage {
+			break
+		}
+		cursor = github.String(history.PageInfo.EndCursor)
+	}
+	if len(listed) == 0 || listed[0].GetSHA() != head {
+		// the head is older than the window
+		return nil, nil
+	}
+	bySHA := map[string]*github.RepositoryCommit{}
+	for _, c := range listed {
+		bySHA[c.GetSHA()] = c
+	}
+	mainline := mainlineCommits(listed, bySHA)
+	var commits []*github.RepositoryCommit
+	for _, c := range listed {
+		if mainline[c.GetSHA()] {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
+// getFirstParentChanges lists the first-parent history of the branch, from the git mirror when it is used.
+// Repositories whose history can't be queried fall back to all commits, fallback is then set as their changes may
+// be counted differently.
+func getFirstParentChanges(ctx context.Context, client *github.Client, organization, name string, options ProcessOptions, limit *commitLimit) ([]*github.RepositoryCommit, bool, error) {
+	if len(options.GitMirrorDir) > 0 {
+		commits, err := getRepositoryChanges(ctx, client, organization, name, options, limit)
+		return commits, false, err
+	}
+	since := windowStart(time.Now(), options.Since, options.ClockSkew, options.TrustServerTime)
+	commits, err := listFirstParentCommits(ctx, client, organization, name, options.BranchName, since)
+	if err == nil {
+		commits, err = limit.capListed(commits)
+		return commits, false, err
+	}
+	if ctx.Err() != nil || isBudgetExhausted(err) {
+		return nil, false, err
+	}
+	log.Printf("WARNING: [%s/%s] unable to list the first-parent history, listing all commits instead, the counts may differ: %v", organization, name, err)
+	commits, err = getRepositoryChanges(ctx, client, organization, name, options, limit)
+	return commits, true, err
+}
+
+// firstParentFallbacks returns the repositories whose changes are all commits instead of the first-parent history.
+func firstParentFallbacks(changes []Change) []string {
+	seen := map[string]bool{}
+	var repositories []string
+	for _, c := range changes {
+		if c.raw.FirstParentFallback && !seen[c.raw.Repository] {
+			seen[c.raw.Repository] = true
+			repositories = append(repositories, c.raw.Repository)
+		}
+	}
+	return repositories
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// firstParentScenario is the merges scenario with the GraphQL API answering the first-parent history query.
+func firstParentScenario(t *testing.T, graphql fakeRoute) fakeScenario {
+	scenario := loadScenario(t, "merges")
+	graphql.Method, graphql.Path = http.MethodPost, "/graphql"
+	scenario.Routes = append(scenario.Routes, graphql)
+	return scenario
+}
+
+func TestCollectFirstParent(t *testing.T) {
+	out, _, err := runFakeScenario(t, firstParentScenario(t, fakeRoute{Fixture: "graphql-first-parent-openshift-oc.json"}), "-first-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the octopus merge, the merge of #12 and the commit pushed to master, not the commits they merged
+	if shas := changeSHAs(out.Changes); !reflect.DeepEqual(shas, []string{"b0b0b0b", "e1e1e1e", "f1f1f1f"}) {
+		t.Errorf("expected the first-parent history, got %v", shas)
+	}
+	for _, c := range out.Changes {
+		if c.FirstParentFallback || (c.Merge != (c.SHA != "b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0")) {
+			t.Errorf("expected the merge commits shown as changes, got %+v", c)
+		}
+	}
+	if w := out.Metadata.Window; w == nil || w.History != historyFirstParent || len(w.FirstParentFallback) != 0 {
+		t.Errorf("expected the first-parent history in the window, got %+v", w)
+	}
+	// the commits listed by the request estimate are not used
+	if requests := out.Metadata.APIRequests; requests[categoryCommitHistory] != 1 || requests[categoryCommitList] != 0 {
+		t.Errorf("expected the history listed with one GraphQL query, got %v", requests)
+	}
+}
+
+func TestCollectFirstParentFallback(t *testing.T) {
+	scenario := firstParentScenario(t, fakeRoute{Body: json.RawMessage(`{"data": null, "errors": [{"message": "Something went wrong while executing your query."}]}`)})
+	var (
+		out scenarioOutput
+		err error
+	)
+	output := captureLog(t, func() { out, _, err = runFakeScenario(t, scenario, "-first-parent") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "WARNING: [openshift/oc] unable to list the first-parent history, listing all commits instead, the counts may differ: GraphQL query failed: Something went wrong") {
+		t.Errorf("expected the fallback logged, got:\n%s", output)
+	}
+	if len(out.Changes) != 6 {
+		t.Errorf("expected all the commits, got %v", changeSHAs(out.Changes))
+	}
+	for _, c := range out.Changes {
+		if !c.FirstParentFallback {
+			t.Errorf("expected the fallback noted, got %+v", c)
+		}
+	}
+	if c := newChange(out.Changes[0]); !strings.HasSuffix(c.URL, "\n(all commits, no first-parent history)") {
+		t.Errorf("expected the fallback in the URL column, got %q", c.URL)
+	}
+	if w := out.Metadata.Window; w == nil || !reflect.DeepEqual(w.FirstParentFallback, []string{"https://github.com/openshift/oc"}) {
+		t.Errorf("expected the repository in the window, got %+v", w)
+	}
+}
+
+// mergeHeavyHistory returns the GraphQL response of a branch where every pull request is merged with a merge
+// commit: each pull request has 2 commits and the branch of the last ones merged master in before being merged.
+func mergeHeavyHistory(pulls int) json.RawMessage {
+	var (
+		nodes []string
+		head  string
+	)
+	sha := func(kind byte, n int) string { return fmt.Sprintf("%c%039d", kind, n) }
+	node := func(oid, message string, date time.Time, parents ...string) {
+		var listed []string
+		for _, p := range parents {
+			listed = append(listed, fmt.Sprintf(`{"oid": %q}`, p))
+		}
+		nodes = append(nodes, fmt.Sprintf(`{"oid": %q, "url": "https://github.com/openshift/oc/commit/%s", "message": %q, "authoredDate": %q, "committedDate": %q, "author": {"name": "Alice", "email": "alice@example.com", "user": {"login": "alice"}}, "committer": {"name": "GitHub", "email": "noreply@github.com", "user": null}, "parents": {"nodes": [%s]}}`,
+			oid, oid, message, date.Format(time.RFC3339), date.Format(time.RFC3339), strings.Join(listed, ", ")))
+	}
+	date := time.Date(2021, 8, 20, 12, 0, 0, 0, time.UTC)
+	// the history is listed from the newest commit, the mainline of pull request n is merged by a(n)
+	for n := pulls; n > 0; n-- {
+		merge, first, second, previous := sha('a', n), sha('b', n), sha('c', n), sha('a', n-1)
+		if len(head) == 0 {
+			head = merge
+		}
+		node(merge, fmt.Sprintf("Merge pull request #%d from alice/change-%d", n, n), date, previous, second)
+		if n > pulls/2 {
+			// master merged into the branch of the pull request
+			node(second, "Merge branch 'master' into change", date.Add(-time.Minute), first, previous)
+		} else {
+			node(second, fmt.Sprintf("Fix change %d", n), date.Add(-time.Minute), first)
+		}
+		node(first, fmt.Sprintf("Add change %d", n), date.Add(-2*time.Minute), previous)
+		date = date.Add(-time.Hour)
+	}
+	return json.RawMessage(fmt.Sprintf(`{"data": {"repository": {"ref": {"target": {"oid": %q, "history": {"pageInfo": {"hasNextPage": false, "endCursor": null}, "nodes": [%s]}}}}}}`, head, strings.Join(nodes, ",\n")))
+}
+
+func TestCollectFirstParentMergeHeavy(t *testing.T) {
+	out, _, err := runFakeScenario(t, firstParentScenario(t, fakeRoute{Body: mergeHeavyHistory(6)}), "-first-parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 18 commits were merged, one change per pull request
+	if len(out.Changes) != 6 {
+		t.Fatalf("expected the 6 pull requests, got %v", changeSHAs(out.Changes))
+	}
+	for _, c := range out.Changes {
+		if !c.Merge || !strings.HasPrefix(c.SHA, "a") {
+			t.Errorf("expected only the merge commits of the pull requests, got %s %q", c.SHA, c.Message)
+		}
+	}
+}
+
+func TestFirstParentOptions(t *testing.T) {
+	for _, o := range []queryOptions{
+		{firstParent: true, mergeCommits: mergeCommitsCollapse},
+		{firstParent: true, mergeCommits: mergeCommitsHide, minCommits: 10},
+		{firstParent: true, mergeCommits: mergeCommitsHide, branchStitching: true},
+	} {
+		if _, err := o.processOptions(&sharedOptions{}); err == nil || err.Error() != "-first-parent is not available with -merge-commits collapse (the merged commits are not listed), -min-commits and -branch-stitching" {
+			t.Errorf("expected %+v to fail, got %v", o, err)
+		}
+	}
+	options, err := (&queryOptions{firstParent: true, mergeCommits: mergeCommitsHide}).processOptions(&sharedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.FirstParent || options.MergeCommits != mergeCommitsShow {
+		t.Errorf("expected the merge commits shown, got %+v", options)
+	}
+}
+
+func TestListMirrorFirstParent(t *testing.T) {
+	dir := t.TempDir()
+	api := filepath.Join(dir, "openshift", "api")
+	if err := os.MkdirAll(api, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	git(t, api, now, "init", "-q", "-b", "master")
+	git(t, api, now.Add(-3*time.Hour), "commit", "-q", "--allow-empty", "-m", "Bump the API")
+	git(t, api, now.Add(-3*time.Hour), "checkout", "-q", "-b", "change")
+	git(t, api, now.Add(-2*time.Hour), "commit", "-q", "--allow-empty", "-m", "Add the field")
+	git(t, api, now.Add(-2*time.Hour), "checkout", "-q", "master")
+	git(t, api, now.Add(-time.Hour), "merge", "-q", "--no-ff", "-m", "Merge pull request #1 from alice/change", "change")
+
+	since := now.Add(-24 * time.Hour)
+	all, err := listMirrorCommits(context.Background(), dir, "openshift", "api", "master", since, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstParent, err := listMirrorCommits(context.Background(), dir, "openshift", "api", "master", since, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || len(firstParent) != 2 || firstParent[0].GetCommit().GetMessage() != "Merge pull request #1 from alice/change" {
+		t.Errorf("expected the merged commit left out, got %d and %d commits", len(all), len(firstParent))
+	}
+}
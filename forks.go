@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// privateForkOrganizations lists organizations that host private forks of the
+// public OpenShift repositories (eg. for embargoed security fixes).
+var privateForkOrganizations = []string{"openshift-priv"}
+
+func isPrivateForkOrganization(organization string) bool {
+	for _, o := range privateForkOrganizations {
+		if strings.EqualFold(o, organization) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveParentRepository returns the repository the given repository was forked from,
+// or nil when it is not a fork.
+func resolveParentRepository(ctx context.Context, client *github.Client, organization, name string) (*github.Repository, error) {
+	repo, _, err := client.Repositories.Get(withCategory(ctx, categoryRepository), organization, name)
+	if err != nil {
+		return nil, err
+	}
+	if !repo.GetFork() {
+		return nil, nil
+	}
+	return repo.GetParent(), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// defaultFutureTolerance is how far ahead of the start of the run a change may be dated before it is reported as
+// having a future timestamp (eg. committed on a machine with a bad clock)
+const defaultFutureTolerance = 10 * time.Minute
+
+// isFutureDate reports whether the date is more than tolerance after the start of the run.
+func isFutureDate(date, start time.Time, tolerance time.Duration) bool {
+	return date.Sub(start) > tolerance
+}
+
+// clampDate returns the date, or the start of the run when the date is after it.
+func clampDate(date, start time.Time) time.Time {
+	if date.After(start) {
+		return start
+	}
+	return date
+}
+
+// sortDate is the date changes are sorted by, the clamped one for changes with future timestamps.
+func sortDate(raw RawChange) time.Time {
+	if raw.ClampedDate != nil {
+		return *raw.ClampedDate
+	}
+	return raw.Date
+}
+
+// annotateFutureDates marks changes dated more than tolerance after the start of the run. With clamp (see
+// -clamp-future-dates) it also sets their clamped date, which they are rendered and sorted by (see sortChanges).
+// The marked changes are logged as data quality warnings.
+func annotateFutureDates(changes []Change, start time.Time, tolerance time.Duration, clamp bool) []Change {
+	future := 0
+	for i, c := range changes {
+		if !isFutureDate(c.raw.Date, start, tolerance) {
+			continue
+		}
+		future++
+		raw := c.raw
+		raw.FutureDate = true
+		if clamp {
+			clamped := clampDate(raw.Date, start)
+			raw.ClampedDate = &clamped
+		}
+		log.Printf("WARNING: [%s] %s is dated %s, %s after the start of the run", raw.Repository, shortSHA(raw.SHA), formatTime(raw.Date), raw.Date.Sub(start).Round(time.Second))
+		changes[i] = newChange(raw)
+	}
+	if future > 0 {
+		log.Printf("WARNING: %d changes have future timestamps (eg. a bad clock of the committer), they are marked in the output", future)
+	}
+	return changes
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsFutureDate(t *testing.T) {
+	start := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		offset   time.Duration
+		expected bool
+	}{
+		{offset: -time.Hour},
+		{offset: 0},
+		{offset: defaultFutureTolerance - time.Second},
+		// the tolerance itself is not in the future
+		{offset: defaultFutureTolerance},
+		{offset: defaultFutureTolerance + time.Nanosecond, expected: true},
+		{offset: 3 * time.Hour, expected: true},
+	} {
+		if future := isFutureDate(start.Add(test.offset), start, defaultFutureTolerance); future != test.expected {
+			t.Errorf("%s after the start: expected %v, got %v", test.offset, test.expected, future)
+		}
+	}
+	if !isFutureDate(start.Add(time.Second), start, 0) {
+		t.Errorf("expected any date after the start in the future without tolerance")
+	}
+}
+
+func TestClampDate(t *testing.T) {
+	start := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	for offset, expected := range map[time.Duration]time.Time{
+		-time.Hour:    start.Add(-time.Hour),
+		0:             start,
+		time.Second:   start,
+		3 * time.Hour: start,
+	} {
+		if clamped := clampDate(start.Add(offset), start); !clamped.Equal(expected) {
+			t.Errorf("%s after the start: expected %s, got %s", offset, expected, clamped)
+		}
+	}
+}
+
+func TestAnnotateFutureDates(t *testing.T) {
+	start := time.Now()
+	newChanges := func() []Change {
+		return []Change{
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "future", Date: start.Add(3 * time.Hour)}),
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "tolerated", Date: start.Add(5 * time.Minute)}),
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "past", Date: start.Add(-time.Hour)}),
+		}
+	}
+	var changes []Change
+	output := captureLog(t, func() { changes = annotateFutureDates(newChanges(), start, defaultFutureTolerance, false) })
+	if !changes[0].raw.FutureDate || changes[0].raw.ClampedDate != nil || changes[1].raw.FutureDate || changes[2].raw.FutureDate {
+		t.Errorf("expected only the change dated 3h ahead marked, got %+v", changes)
+	}
+	if !strings.HasSuffix(changes[0].Time, " (future timestamp)") || strings.Contains(changes[1].Time, "future timestamp") {
+		t.Errorf("expected the marked change rendered as future, got %q and %q", changes[0].Time, changes[1].Time)
+	}
+	for _, expected := range []string{"WARNING: [https://github.com/openshift/api] future is dated", "3h0m0s after the start of the run", "1 changes have future timestamps"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in the log:\n%s", expected, output)
+		}
+	}
+
+	captureLog(t, func() { changes = annotateFutureDates(newChanges(), start, defaultFutureTolerance, true) })
+	if changes[0].raw.ClampedDate == nil || !changes[0].raw.ClampedDate.Equal(start) || !changes[0].raw.Date.Equal(start.Add(3*time.Hour)) {
+		t.Fatalf("expected the clamped date next to the raw one, got %+v", changes[0].raw)
+	}
+	if changes[0].Time != "now (future timestamp)" {
+		t.Errorf("expected the clamped change rendered at the start of the run, got %q", changes[0].Time)
+	}
+	// the clamped change sorts before the tolerated one, dated after the start of the run
+	sortChanges(changes)
+	if order := strings.Join([]string{changes[0].raw.SHA, changes[1].raw.SHA, changes[2].raw.SHA}, " "); order != "past future tolerated" {
+		t.Errorf("expected the clamped change sorted by the start of the run, got %s", order)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Changes: changes}); err != nil {
+		t.Fatal(err)
+	}
+	if json := out.String(); !strings.Contains(json, `"futureTimestamp": true`) || strings.Count(json, `"clampedDate"`) != 1 {
+		t.Errorf("expected both dates of the future change in the JSON, got:\n%s", json)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const defaultGitTimeout = time.Minute
+
+// gitLogFormat separates the fields by NUL and the commits by the record separator, as messages span lines.
+const gitLogFormat = "%H%x00%an%x00%ae%x00%aI%x00%cI%x00%B%x1e"
+
+// mirrorClone returns the clone of the repository, either ORG/NAME or ORG/NAME.git in the mirror directory.
+func mirrorClone(dir, organization, name string) (string, error) {
+	for _, clone := range []string{filepath.Join(dir, organization, name), filepath.Join(dir, organization, name+".git")} {
+		if info, err := os.Stat(clone); err == nil && info.IsDir() {
+			return clone, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrMissingClone, filepath.Join(dir, organization, name))
+}
+
+// runGit runs git in the clone, the arguments are passed to git as they are, without a shell.
+func runGit(ctx context.Context, clone string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", clone}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("git %s timed out: %w", args[0], ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// mirrorBranch returns the ref of the branch, mirrors (git clone --mirror) have it in refs/heads, regular
+// clones only have the default branch there and the rest in refs/remotes/origin.
+func mirrorBranch(ctx context.Context, clone, branch string) (string, error) {
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		_, err := runGit(ctx, clone, "rev-parse", "--verify", "--quiet", ref)
+		if err == nil {
+			return ref, nil
+		}
+		// a timeout is not a missing branch
+		if ctx.Err() != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch, clone)
+}
+
+// listMirrorCommits lists commits of the branch in the local clone since the given time, as they would be listed by
+// Github, so the rest of the processing is the same. All commits are listed, the same as the Github commits API does,
+// unless firstParent lists only the first parents (see -first-parent).
+func listMirrorCommits(ctx context.Context, dir, organization, name, branch string, since time.Time, timeout time.Duration, firstParent bool) ([]*github.RepositoryCommit, error) {
+	clone, err := mirrorClone(dir, organization, name)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ref, err := mirrorBranch(ctx, clone, branch)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"log", "--since=" + since.Format(time.RFC3339), "--format=" + gitLogFormat}
+	if firstParent {
+		args = append(args, "--first-parent")
+	}
+	out, err := runGit(ctx, clone, append(args, ref, "--")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitLog(out, organization, name)
+}
+
+// parseGitLog parses the output of git log with gitLogFormat, the commit URLs point at github.com.
+func parseGitLog(out []byte, organization, name string) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	for _, record := range strings.Split(string(out), "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if len(record) == 0 {
+			continue
+		}
+		fields := strings.SplitN(record, "\x00", 6)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected git log output: %q", record)
+		}
+		authored, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return nil, err
+		}
+		committed, err := time.Parse(time.RFC3339, fields[4])
+		if err != nil {
+			return nil, err
+		}
+		sha := fields[0]
+		commits = append(commits, &github.RepositoryCommit{
+			SHA:     github.String(sha),
+			HTMLURL: github.String(fmt.Sprintf("https://github.com/%s/%s/commit/%s", organization, name, sha)),
+			Commit: &github.Commit{
+				SHA:       github.String(sha),
+				Message:   github.String(strings.TrimRight(fields[5], "\n")),
+				Author:    &github.CommitAuthor{Name: github.String(fields[1]), Email: github.String(fields[2]), Date: &authored},
+				Committer: &github.CommitAuthor{Date: &committed},
+			},
+		})
+	}
+	return commits, nil
+}
+
+// validateGitMirror fails for features that need the Github API, which is not used with -git-mirror-dir.
+func validateGitMirror(options ProcessOptions) error {
+	for _, feature := range []struct {
+		flag    string
+		enabled bool
+	}{
+		{"-with-prs (or a flag implying it)", options.WithPullRequests},
+		{"-with-backports", options.WithBackports},
+		{"-with-codeowners", options.WithCodeowners},
+		{"-with-retests", options.WithRetests},
+		{"-classify-paths", options.ClassifyPaths},
+		{"-branch-presence", options.WithBranchPresence},
+		{"-prefer-canonical", options.PreferCanonical},
+		{"-trust-server-time", options.TrustServerTime},
+		{"-min-commits", options.MinCommits > 0},
+	} {
+		if feature.enabled {
+			return fmt.Errorf("%s requires the Github API and is not available with -git-mirror-dir", feature.flag)
+		}
+	}
+	return nil
+}
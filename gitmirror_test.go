@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// git runs git in the directory with fixed dates and identity, the test is skipped without git.
+func git(t *testing.T, dir string, date time.Time, args ...string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Alice", "GIT_AUTHOR_EMAIL=alice@example.com", "GIT_COMMITTER_NAME=Alice", "GIT_COMMITTER_EMAIL=alice@example.com",
+		"GIT_AUTHOR_DATE="+date.Format(time.RFC3339), "GIT_COMMITTER_DATE="+date.Format(time.RFC3339))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+// gitMirror creates openshift/api with an old commit and a recent one on master, and a regular clone of it in
+// openshift/oc.git where release-4.9 is only a remote branch.
+func gitMirror(t *testing.T) string {
+	dir := t.TempDir()
+	api := filepath.Join(dir, "openshift", "api")
+	if err := os.MkdirAll(api, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(t, api, time.Now(), "init", "-q", "-b", "master")
+	git(t, api, time.Now().Add(-72*time.Hour), "commit", "-q", "--allow-empty", "-m", "Old change")
+	git(t, api, time.Now().Add(-time.Hour), "commit", "-q", "--allow-empty", "-m", "Bump the API\n\nWith $(details) in the body")
+	git(t, api, time.Now(), "branch", "release-4.9")
+	git(t, dir, time.Now(), "clone", "-q", api, filepath.Join(dir, "openshift", "oc.git"))
+	return dir
+}
+
+func TestListMirrorCommits(t *testing.T) {
+	dir := gitMirror(t)
+	since := time.Now().Add(-24 * time.Hour)
+	commits, err := listMirrorCommits(context.Background(), dir, "openshift", "api", "master", since, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("expected the commit in the window, got %d commits", len(commits))
+	}
+	c := commits[0]
+	if c.GetCommit().GetMessage() != "Bump the API\n\nWith $(details) in the body" || c.GetCommit().GetAuthor().GetName() != "Alice" || c.GetCommit().GetAuthor().GetEmail() != "alice@example.com" {
+		t.Errorf("unexpected commit %+v", c.GetCommit())
+	}
+	if c.GetHTMLURL() != "https://github.com/openshift/api/commit/"+c.GetSHA() || len(c.GetSHA()) != 40 {
+		t.Errorf("expected the commit URL to point at github.com, got %s", c.GetHTMLURL())
+	}
+
+	// release-4.9 is a remote branch of the clone
+	commits, err = listMirrorCommits(context.Background(), dir, "openshift", "oc", "release-4.9", since, time.Minute, false)
+	if err != nil || len(commits) != 1 {
+		t.Errorf("expected the commit of the remote branch, got %d: %v", len(commits), err)
+	}
+
+	_, err = listMirrorCommits(context.Background(), dir, "openshift", "api", "release-4.10", since, time.Minute, false)
+	if err == nil || !strings.Contains(err.Error(), "branch release-4.10 not found") {
+		t.Errorf("expected a missing branch error, got %v", err)
+	}
+
+	// the branch is passed to git as an argument, never through a shell
+	_, err = listMirrorCommits(context.Background(), dir, "openshift", "api", "master;touch pwned", since, time.Minute, false)
+	if err == nil {
+		t.Errorf("expected the branch not to be found")
+	}
+	if _, statErr := os.Stat("pwned"); statErr == nil {
+		os.Remove("pwned")
+		t.Errorf("expected the branch not to be interpreted by a shell")
+	}
+
+	_, err = listMirrorCommits(context.Background(), dir, "openshift", "console", "master", since, time.Minute, false)
+	if !errors.Is(err, ErrMissingClone) || classifyRepositoryError("openshift", err) != ErrorKindMissingClone {
+		t.Errorf("expected a missing clone error, got %v", err)
+	}
+
+	_, err = listMirrorCommits(context.Background(), dir, "openshift", "api", "master", since, time.Nanosecond, false)
+	if err == nil || classifyRepositoryError("openshift", err) != ErrorKindTimeout {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestGitMirrorQuery(t *testing.T) {
+	dir := gitMirror(t)
+	repos := []string{"https://github.com/openshift/api", "https://github.com/openshift/console"}
+	// there is no Github client
+	query := &queryOptions{since: "1d", branch: "master", gitMirrorDir: dir, gitTimeout: time.Minute}
+	if query.needsGithub() {
+		t.Errorf("expected the query not to need Github")
+	}
+	var result *queryResult
+	output := captureLog(t, func() {
+		var err error
+		if err = query.validate(); err == nil {
+			result, err = query.collect(context.Background(), nil, &sharedOptions{concurrency: 10}, repos, NewCache())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(result.Changes) != 1 || result.Changes[0].raw.Message != "Bump the API\n\nWith $(details) in the body" {
+		t.Errorf("expected the change of the clone, got %+v", result.Changes)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], ErrMissingClone) || result.Errors[0].Repository != "https://github.com/openshift/console" {
+		t.Errorf("expected the repository without a clone to be reported, got %+v\n%s", result.Errors, output)
+	}
+
+	for _, invalid := range []*queryOptions{
+		{gitMirrorDir: dir, withPRs: true},
+		{gitMirrorDir: dir, withCodeowners: true},
+		{gitMirrorDir: dir, explainEmpty: true},
+	} {
+		if err := invalid.validate(); err == nil || !strings.Contains(err.Error(), "not available with -git-mirror-dir") {
+			t.Errorf("expected the API feature to be rejected, got %v", err)
+		}
+	}
+}
+
+func TestParseGitLog(t *testing.T) {
+	if _, err := parseGitLog([]byte("553c207\x00Alice\x1e"), "openshift", "api"); err == nil {
+		t.Errorf("expected malformed output to fail")
+	}
+	commits, err := parseGitLog([]byte("553c207\x00Alice\x00a@example.com\x002021-08-20T10:00:00+02:00\x002021-08-20T11:00:00+02:00\x00Fix\n\nBody\n\x1e\n"), "openshift", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].GetCommit().GetMessage() != "Fix\n\nBody" || !commits[0].GetCommit().GetCommitter().GetDate().Equal(time.Date(2021, 8, 20, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected commits %+v", commits)
+	}
+}
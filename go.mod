@@ -6,9 +6,11 @@ require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/google/go-querystring v1.1.0 // indirect
-	github.com/kataras/tablewriter v0.0.0-20180708051242-e063d29b7c23 // indirect
+	github.com/kataras/tablewriter v0.0.0-20180708051242-e063d29b7c23
 	github.com/lensesio/tableprinter v0.0.0-20201125135848-89e81fc956e7
+	github.com/mattn/go-runewidth v0.0.9
 	github.com/xhit/go-str2duration/v2 v2.0.0
 	github.com/xxjwxc/gowp v0.0.0-20210520113007-57eb4693b12d
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	gopkg.in/yaml.v3 v3.0.1
 )
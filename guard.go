@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// defaultMaxWindow is the longest window collected without a confirmation
+	defaultMaxWindow = 30 * 24 * time.Hour
+	// defaultMaxEstimatedRequests is the most Github requests a run is estimated to make without a confirmation
+	defaultMaxEstimatedRequests = 5000
+	// estimateSample is the number of repositories whose first page of commits is listed for the estimate
+	estimateSample = 3
+)
+
+// requestEstimate is the expected number of Github requests of a run, extrapolated from a sample of repositories.
+type requestEstimate struct {
+	Repositories int
+	Sampled      int
+	// Pages and Commits are the average number of commit pages and commits per sampled repository
+	Pages   float64
+	Commits float64
+	// Requests is the estimated total, listing commits and the per commit requests of the enabled features
+	Requests int
+}
+
+func (e requestEstimate) String() string {
+	return fmt.Sprintf("about %d Github requests (%d repositories, %.1f pages and %.0f commits per repository in a sample of %d)", e.Requests, e.Repositories, e.Pages, e.Commits, e.Sampled)
+}
+
+// estimateRequests lists the first page of commits of a few repositories, the number of pages comes from the
+// Link header of the response, and extrapolates it to all repositories.
+func estimateRequests(ctx context.Context, client *github.Client, repositories []string, options ProcessOptions, since time.Time) (requestEstimate, error) {
+	estimate := requestEstimate{Repositories: len(repositories)}
+	var pages, commits int
+	for _, repository := range repositories {
+		if estimate.Sampled == estimateSample {
+			break
+		}
+		organization, name, ok := parseRepositoryOrgName(repository)
+		if !ok {
+			continue
+		}
+		listOptions := &github.CommitsListOptions{SHA: options.BranchName, Since: since, ListOptions: github.ListOptions{PerPage: commitsPerPage}}
+		page, resp, err := client.Repositories.ListCommits(withCategory(ctx, categoryEstimate), organization, name, listOptions)
+		if isNotFound(err) || isBranchMissing(err) {
+			continue
+		}
+		if err != nil {
+			return estimate, err
+		}
+		estimate.Sampled++
+		p, c := estimatePages(len(page), resp.LastPage)
+		pages += p
+		commits += c
+	}
+	if estimate.Sampled == 0 {
+		return estimate, nil
+	}
+	estimate.Pages = float64(pages) / float64(estimate.Sampled)
+	estimate.Commits = float64(commits) / float64(estimate.Sampled)
+	estimate.Requests = int(float64(estimate.Repositories) * (estimate.Pages + estimate.Commits*float64(perCommitRequests(options))))
+	return estimate, nil
+}
+
+// estimatePages returns the number of pages and commits of a repository from its first page, the last page
+// is 0 when there is just one page.
+func estimatePages(firstPage, lastPage int) (int, int) {
+	if lastPage == 0 {
+		return 1, firstPage
+	}
+	return lastPage, lastPage * commitsPerPage
+}
+
+// perCommitRequests is the number of requests the enabled features make for every commit.
+func perCommitRequests(options ProcessOptions) int {
+	requests := 0
+	for _, f := range plannedFeatures(options) {
+		requests += f.PerCommit
+	}
+	return requests
+}
+
+// isInteractive reports whether the standard input is a terminal a confirmation can be asked on.
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmLargeRun asks for a confirmation of runs with windows longer than maxWindow or estimated to make more
+// than maxRequests requests, non interactive runs fail unless yes is set.
+func confirmLargeRun(window time.Duration, maxWindow time.Duration, estimate requestEstimate, maxRequests int, yes bool, interactive bool, in io.Reader, out io.Writer) error {
+	var reasons []string
+	if maxWindow > 0 && window > maxWindow {
+		reasons = append(reasons, fmt.Sprintf("the window of %s is longer than -max-window %s", window.Round(time.Hour), maxWindow))
+	}
+	if maxRequests > 0 && estimate.Requests > maxRequests {
+		reasons = append(reasons, fmt.Sprintf("more than -max-requests %d requests are expected", maxRequests))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	log.Printf("This run is large, %s: %s", strings.Join(reasons, " and "), estimate)
+	if yes {
+		return nil
+	}
+	if !interactive {
+		return fmt.Errorf(":-( refusing to start a large run without a confirmation, use -yes to proceed")
+	}
+	fmt.Fprintf(out, "Continue? [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("canceled")
+}
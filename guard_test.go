@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestEstimatePages(t *testing.T) {
+	if pages, commits := estimatePages(42, 0); pages != 1 || commits != 42 {
+		t.Errorf("expected a single page of 42 commits, got %d pages and %d commits", pages, commits)
+	}
+	if pages, commits := estimatePages(commitsPerPage, 4); pages != 4 || commits != 4*commitsPerPage {
+		t.Errorf("expected 4 full pages, got %d pages and %d commits", pages, commits)
+	}
+}
+
+// fakeEstimateGithub serves the first page of commits of each repository with the Link header of the number of
+// pages, repositories without pages are not found.
+func fakeEstimateGithub(t *testing.T, pages map[string]int) (*github.Client, func() []string) {
+	var listed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		name := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/repos/openshift/"), "/commits")
+		listed = append(listed, name)
+		n, ok := pages[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+			return
+		}
+		if n > 1 {
+			w.Header().Set("Link", fmt.Sprintf(`<%[1]s%[2]s?page=2>; rel="next", <%[1]s%[2]s?page=%[3]d>; rel="last"`, "http://"+req.Host, req.URL.Path, n))
+		}
+		fmt.Fprint(w, `[{"sha": "a1"}, {"sha": "b2"}]`)
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() []string { return listed }
+}
+
+func TestEstimateRequests(t *testing.T) {
+	client, listed := fakeEstimateGithub(t, map[string]int{"api": 1, "origin": 5, "oc": 3, "installer": 10})
+	var repositories []string
+	for _, name := range []string{"api", "missing", "origin", "oc", "installer", "console"} {
+		repositories = append(repositories, "https://github.com/openshift/"+name)
+	}
+	options := ProcessOptions{BranchName: "master", WithPullRequests: true}
+	estimate, err := estimateRequests(context.Background(), client, repositories, options, time.Now().Add(-365*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the missing repository is skipped, the sample stops after 3 repositories
+	if got := strings.Join(listed(), ","); got != "api,missing,origin,oc" {
+		t.Errorf("unexpected repositories listed %s", got)
+	}
+	if estimate.Sampled != 3 || estimate.Repositories != 6 || estimate.Pages != 3 {
+		t.Errorf("unexpected estimate %+v", estimate)
+	}
+	// (2 + 5*100 + 3*100) commits and 9 pages in 3 repositories, with a pull request request per commit
+	commits := float64(2+8*commitsPerPage) / 3
+	if expected := int(6 * (3 + commits)); estimate.Requests != expected {
+		t.Errorf("expected %d requests, got %d (%s)", expected, estimate.Requests, estimate)
+	}
+
+	// without sampled repositories there is no estimate
+	client, _ = fakeEstimateGithub(t, nil)
+	if estimate, err := estimateRequests(context.Background(), client, repositories[:2], options, time.Now()); err != nil || estimate.Sampled != 0 || estimate.Requests != 0 {
+		t.Errorf("expected an empty estimate, got %+v: %v", estimate, err)
+	}
+}
+
+func TestPerCommitRequests(t *testing.T) {
+	for expected, options := range []ProcessOptions{{}, {WithPullRequests: true}, {WithPullRequests: true, ClassifyPaths: true}} {
+		if requests := perCommitRequests(options); requests != expected {
+			t.Errorf("%+v: expected %d requests, got %d", options, expected, requests)
+		}
+	}
+}
+
+func TestConfirmLargeRun(t *testing.T) {
+	large := requestEstimate{Repositories: 200, Sampled: 3, Pages: 4, Commits: 400, Requests: 800}
+	tests := []struct {
+		name        string
+		window      time.Duration
+		estimate    requestEstimate
+		yes         bool
+		interactive bool
+		answer      string
+		expected    string
+	}{
+		{name: "small", window: 24 * time.Hour, estimate: requestEstimate{Requests: 100}},
+		{name: "yes", window: 365 * 24 * time.Hour, estimate: large, yes: true},
+		{name: "non interactive", window: 365 * 24 * time.Hour, expected: "use -yes to proceed"},
+		{name: "requests over the limit", window: 24 * time.Hour, estimate: large, expected: "use -yes to proceed"},
+		{name: "confirmed", window: 365 * 24 * time.Hour, interactive: true, answer: "y\n"},
+		{name: "declined", window: 365 * 24 * time.Hour, interactive: true, answer: "n\n", expected: "canceled"},
+		{name: "no answer", window: 365 * 24 * time.Hour, interactive: true, expected: "canceled"},
+	}
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		var err error
+		captureLog(t, func() {
+			err = confirmLargeRun(test.window, defaultMaxWindow, test.estimate, 500, test.yes, test.interactive, strings.NewReader(test.answer), out)
+		})
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+		if asked := strings.Contains(out.String(), "Continue?"); asked != test.interactive {
+			t.Errorf("%s: expected to ask for a confirmation %v, got %q", test.name, test.interactive, out.String())
+		}
+	}
+}
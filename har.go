@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHARMaxBodyKB is the size of response bodies recorded by -har-file, longer ones are truncated
+const defaultHARMaxBodyKB = 2048
+
+// harRedacted replaces the values of the redactedHARHeaders
+const harRedacted = "REDACTED"
+
+// redactedHARHeaders are request headers never written into HAR files
+var redactedHARHeaders = []string{"Authorization", "Cookie"}
+
+// errUnmatchedRequest is wrapped by errors of requests -from-har has no recorded response of.
+var errUnmatchedRequest = errors.New("no recorded response")
+
+// HAR is a HTTP Archive 1.2 file (see http://www.softwareishard.com/blog/har-12-spec/), only the fields the
+// recordings use.
+type HAR struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	Cookies     []harHeader `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []harHeader `json:"cookies"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Comment marks bodies truncated to -har-max-body-kb
+	Comment string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(header http.Header, redacted []string) []harHeader {
+	var headers []harHeader
+	for name, values := range header {
+		for _, value := range values {
+			for _, r := range redacted {
+				if strings.EqualFold(name, r) {
+					value = harRedacted
+				}
+			}
+			headers = append(headers, harHeader{Name: name, Value: value})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func harQueryString(u *url.URL) []harHeader {
+	query := []harHeader{}
+	for name, values := range u.Query() {
+		for _, value := range values {
+			query = append(query, harHeader{Name: name, Value: value})
+		}
+	}
+	sort.Slice(query, func(i, j int) bool { return query[i].Name < query[j].Name })
+	return query
+}
+
+// harRecorder records the Github requests and responses passing through it (see -har-file), response bodies are
+// truncated to maxBody bytes.
+type harRecorder struct {
+	base    http.RoundTripper
+	maxBody int
+
+	lock    sync.Mutex
+	entries []harEntry
+}
+
+func newHARRecorder(base http.RoundTripper, maxBodyKB int) *harRecorder {
+	return &harRecorder{base: base, maxBody: maxBodyKB * 1024}
+}
+
+func (r *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	wait := time.Since(start)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := harEntry{
+		StartedDateTime: start,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header, redactedHARHeaders),
+			QueryString: harQueryString(req.URL),
+			Cookies:     []harHeader{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+			HTTPVersion: resp.Proto,
+			Headers:     harHeaders(resp.Header, nil),
+			Cookies:     []harHeader{},
+			Content:     harContent{Size: len(body), MimeType: resp.Header.Get("Content-Type"), Text: string(body)},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+		Timings: harTimings{Send: 0, Wait: durationMillis(wait), Receive: durationMillis(time.Since(start) - wait)},
+	}
+	entry.Time = entry.Timings.Wait + entry.Timings.Receive
+	if r.maxBody > 0 && len(body) > r.maxBody {
+		entry.Response.Content.Text = string(body[:r.maxBody])
+		entry.Response.Content.Comment = fmt.Sprintf("truncated to %d of %d bytes", r.maxBody, len(body))
+	}
+	r.lock.Lock()
+	r.entries = append(r.entries, entry)
+	r.lock.Unlock()
+	return resp, nil
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Write writes the recorded entries into the HAR file, via a temporary file renamed over it.
+func (r *harRecorder) Write(path string, mode os.FileMode, mkdirs bool) error {
+	r.lock.Lock()
+	har := HAR{Log: harLog{Version: "1.2", Creator: harCreator{Name: "ocp-what-merged", Version: "1"}, Entries: r.entries}}
+	data, err := json.MarshalIndent(har, "", "  ")
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	f, err := createAtomicFile(path, mode, mkdirs)
+	if err != nil {
+		return err
+	}
+	// a failed write is reported by Close
+	f.Write(data)
+	return f.Close()
+}
+
+// readHAR reads the entries of a HAR file recorded by -har-file.
+func readHAR(path string) ([]harEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return har.Log.Entries, nil
+}
+
+// harReplayKey matches requests by method and URL, the time window parameters (eg. since of commit listings)
+// are left out of the fallback key as the window moves with the time of the replay.
+func harReplayKey(method string, u *url.URL, exact bool) string {
+	if exact {
+		return method + " " + u.String()
+	}
+	stripped := *u
+	query := stripped.Query()
+	query.Del("since")
+	query.Del("until")
+	stripped.RawQuery = query.Encode()
+	return method + " " + stripped.String()
+}
+
+// harReplayTransport responds to requests with the responses recorded in a HAR file (see -from-har) without any
+// network access. Repeated requests get the recorded responses in order, the last one once they are used up.
+type harReplayTransport struct {
+	path string
+
+	lock      sync.Mutex
+	exact     map[string][]harEntry
+	windowed  map[string][]harEntry
+	unmatched int
+}
+
+func newHARReplayTransport(path string) (*harReplayTransport, error) {
+	entries, err := readHAR(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &harReplayTransport{path: path, exact: map[string][]harEntry{}, windowed: map[string][]harEntry{}}
+	for _, e := range entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid request URL %q: %v", path, e.Request.URL, err)
+		}
+		t.exact[harReplayKey(e.Request.Method, u, true)] = append(t.exact[harReplayKey(e.Request.Method, u, true)], e)
+		t.windowed[harReplayKey(e.Request.Method, u, false)] = append(t.windowed[harReplayKey(e.Request.Method, u, false)], e)
+	}
+	return t, nil
+}
+
+// nextHAREntry returns the next recorded response of the key and consumes it, unless it is the last one.
+func nextHAREntry(entries map[string][]harEntry, key string) (harEntry, bool) {
+	recorded := entries[key]
+	if len(recorded) == 0 {
+		return harEntry{}, false
+	}
+	if len(recorded) > 1 {
+		entries[key] = recorded[1:]
+	}
+	return recorded[0], true
+}
+
+func (t *harReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	t.lock.Lock()
+	entry, ok := nextHAREntry(t.exact, harReplayKey(req.Method, req.URL, true))
+	if !ok {
+		entry, ok = nextHAREntry(t.windowed, harReplayKey(req.Method, req.URL, false))
+	}
+	if !ok {
+		t.unmatched++
+	}
+	t.lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w of %s %s in %s, replay with the flags of the recorded run", errUnmatchedRequest, req.Method, req.URL, t.path)
+	}
+	if len(entry.Response.Content.Comment) > 0 {
+		return nil, fmt.Errorf("recorded response of %s %s in %s was %s, record it again with a larger -har-max-body-kb", req.Method, req.URL, t.path, entry.Response.Content.Comment)
+	}
+	header := http.Header{}
+	for _, h := range entry.Response.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(entry.Response.Content.Text)),
+		ContentLength: int64(len(entry.Response.Content.Text)),
+		Request:       req,
+	}, nil
+}
+
+// Unmatched returns the number of requests without a recorded response.
+func (t *harReplayTransport) Unmatched() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.unmatched
+}
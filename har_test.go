@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRoundTrip(t *testing.T) {
+	scenario := loadScenario(t, "normal")
+	github := newFakeGithub(t, scenario.Routes)
+	dir := t.TempDir()
+	release := scenario.writeRelease(t, dir)
+	har := filepath.Join(dir, "run.har")
+	collect := func(output string, args ...string) string {
+		t.Helper()
+		if err := run(append([]string{
+			"collect",
+			"-release-info-file", release,
+			"-github-api-url", github.URL,
+			"-format", formatCSV,
+			"-output", output,
+			"-since", "24h",
+			"-no-ignore",
+		}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	recorded := collect(filepath.Join(dir, "recorded.csv"), "-token", "fake-token", "-har-file", har)
+	if !strings.Contains(recorded, "553c207") {
+		t.Fatalf("expected the changes in the output:\n%s", recorded)
+	}
+	requests := len(github.Requests())
+	replayed := collect(filepath.Join(dir, "replayed.csv"), "-from-har", har)
+	if replayed != recorded {
+		t.Errorf("expected the output of the recorded run:\n%s\ngot:\n%s", recorded, replayed)
+	}
+	if n := len(github.Requests()); n != requests {
+		t.Errorf("expected no Github requests from the replay, got %d", n-requests)
+	}
+
+	data, err := ioutil.ReadFile(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "fake-token") {
+		t.Errorf("expected the token redacted from the HAR file")
+	}
+	entries, err := readHAR(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized := 0
+	for _, e := range entries {
+		for _, h := range e.Request.Headers {
+			if h.Name != "Authorization" {
+				continue
+			}
+			authorized++
+			if h.Value != harRedacted {
+				t.Errorf("%s: expected the Authorization header redacted, got %q", e.Request.URL, h.Value)
+			}
+		}
+	}
+	if authorized == 0 {
+		t.Errorf("expected the Authorization header in the recorded requests")
+	}
+
+	replay, err := newHARReplayTransport(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, github.URL+"/repos/octocat/Spoon-Knife/commits", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replay.RoundTrip(req); !errors.Is(err, errUnmatchedRequest) || !strings.Contains(err.Error(), "Spoon-Knife") {
+		t.Errorf("expected an unmatched request error naming the request, got %v", err)
+	}
+	if replay.Unmatched() != 1 {
+		t.Errorf("expected 1 unmatched request, got %d", replay.Unmatched())
+	}
+}
+
+func TestHARBodyLimit(t *testing.T) {
+	github := newFakeGithub(t, []fakeRoute{
+		{Method: http.MethodGet, Path: "/repos/openshift/api/commits", Body: json.RawMessage(`[` + strings.Repeat(`{"sha": "0000000000000000000000000000000000000000"},`, 100) + `{}]`)},
+	})
+	recorder := newHARRecorder(http.DefaultTransport, 1)
+	client := &http.Client{Transport: recorder}
+	for _, path := range []string{"/repos/openshift/api/commits", "/user"} {
+		resp, err := client.Get(github.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the response is complete, only the recorded body is truncated
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if path == "/repos/openshift/api/commits" && len(body) <= 1024 {
+			t.Errorf("expected the whole response, got %d bytes", len(body))
+		}
+	}
+	har := filepath.Join(t.TempDir(), "run.har")
+	if err := recorder.Write(har, 0644, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readHAR(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(entries[0].Response.Content.Text) != 1024 || !strings.HasPrefix(entries[0].Response.Content.Comment, "truncated to 1024 of") || len(entries[1].Response.Content.Comment) > 0 {
+		t.Errorf("expected only the commits body truncated, got %+v", entries)
+	}
+
+	replay, err := newHARReplayTransport(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: replay}
+	if _, err := client.Get(github.URL + "/repos/openshift/api/commits"); err == nil || !strings.Contains(err.Error(), "record it again with a larger -har-max-body-kb") {
+		t.Errorf("expected the truncated response not to be replayed, got %v", err)
+	}
+	resp, err := client.Get(github.URL + "/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the recorded status, got %s", resp.Status)
+	}
+}
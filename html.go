@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// formatHTML renders a standalone HTML page of the changes
+const formatHTML = "html"
+
+// htmlTemplate has a block for the start of the page, one executed for each change and one for the end, so the
+// rows are written as they are rendered.
+var htmlTemplate = template.Must(template.New("html").Parse(`
+{{- define "start" -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { margin: 0; white-space: pre-wrap; }
+tr.not-in-payload { background: #fdd; }
+tr.merge { font-weight: bold; }
+tr.merged td:first-child { padding-left: 24px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Since}}
+<p>Changes merged to {{.Branch}} since {{.Since}}.</p>
+{{- end}}
+<table>
+<tr><th>Repository</th><th>Commit</th><th>PR</th><th>Author</th><th>When</th><th>Message</th></tr>
+{{end -}}
+{{- define "change" -}}
+<tr{{with .Class}} class="{{.}}"{{end}}><td>{{.Repository}}</td><td><a href="{{.URL}}">{{.SHA}}</a></td><td>{{if .PullRequestURL}}<a href="{{.PullRequestURL}}">#{{.PullRequest}}</a>{{end}}</td><td>{{.Author}}</td><td title="{{.Date}}">{{.When}}</td><td><pre>{{.Message}}</pre>{{with .Session}}<details><summary>{{len .}} commits</summary><ul>{{range .}}<li><a href="{{.URL}}">{{.SHA}}</a> {{.Subject}}</li>{{end}}</ul></details>{{end}}</td></tr>
+{{end -}}
+{{- define "end" -}}
+</table>
+{{- range .Errors}}
+<p><strong>Warning:</strong> {{.}}</p>
+{{- end}}
+</body>
+</html>
+{{end -}}
+`))
+
+type htmlPage struct {
+	Title  string
+	Branch string
+	Since  string
+	Errors []string
+}
+
+type htmlChange struct {
+	Repository     string
+	SHA            string
+	URL            string
+	PullRequest    int
+	PullRequestURL string
+	Author         string
+	Date           string
+	When           string
+	Message        string
+	// NotInPayload is set for changes merged after the payload was created (see -relative-to)
+	NotInPayload bool
+	// Merge is set for merge commits, Merged for the changes nested beneath their merge commit (see -merge-commits)
+	Merge  bool
+	Merged bool
+	// Session are all the commits of the session the change is the newest of (see -collapse-sessions)
+	Session []SessionCommit
+}
+
+// Class returns the classes of the row of the change.
+func (c htmlChange) Class() string {
+	var classes []string
+	if c.NotInPayload {
+		classes = append(classes, "not-in-payload")
+	}
+	if c.Merge {
+		classes = append(classes, "merge")
+	}
+	if c.Merged {
+		classes = append(classes, "merged")
+	}
+	return strings.Join(classes, " ")
+}
+
+// newHTMLChange returns the row of the change, its message sanitized like in the table (but not truncated) unless
+// rawMessage is set.
+func newHTMLChange(raw RawChange, rawMessage, coauthors bool, durations Formatter) htmlChange {
+	change := htmlChange{
+		Repository:  repositoryName(raw.Repository),
+		SHA:         shortSHA(raw.SHA),
+		URL:         raw.URL,
+		PullRequest: raw.PullRequest,
+		Author:      raw.Author,
+		Date:        formatTime(raw.Date),
+		When:        durations.Ago(raw.Date),
+		Message:     raw.Message,
+		Merge:       raw.Merge,
+	}
+	if !rawMessage {
+		change.Message = sanitizeMessage(raw.Message, raw.SHA, coauthors)
+	}
+	if raw.Session != nil {
+		change.Message = formatSession(raw.Session, durations)
+		for _, c := range raw.Session.Commits {
+			c.SHA = shortSHA(c.SHA)
+			change.Session = append(change.Session, c)
+		}
+	}
+	if raw.PayloadOffset != nil {
+		change.When = formatPayloadOffset(time.Duration(*raw.PayloadOffset)*time.Second, durations)
+		change.NotInPayload = *raw.PayloadOffset > 0
+	}
+	if _, _, ok := parseRepositoryOrgName(raw.Repository); ok && raw.PullRequest > 0 {
+		change.PullRequestURL = fmt.Sprintf("%s/pull/%d", raw.Repository, raw.PullRequest)
+	}
+	return change
+}
+
+// writeHTMLReport writes the page with a row per change, executing the change block for each of them.
+func writeHTMLReport(w io.Writer, report Report) error {
+	page := htmlPage{Title: fmt.Sprintf("%d changes", len(report.Changes)), Branch: report.Branch}
+	if len(report.Payload) > 0 {
+		page.Title += " in " + report.Payload
+	}
+	if report.Window != nil {
+		page.Since = formatTime(report.Window.Since)
+	}
+	for _, e := range report.Errors {
+		page.Errors = append(page.Errors, fmt.Sprintf("%s could not be processed (%s), its changes are missing.", repositoryName(e.Repository), e.Kind))
+	}
+	b := bufio.NewWriter(w)
+	if err := htmlTemplate.ExecuteTemplate(b, "start", page); err != nil {
+		return err
+	}
+	durations := formatterOrNow(report.Durations)
+	var rows []htmlChange
+	if report.GroupByMerge {
+		sections, others := mergeSections(report.Changes)
+		for _, section := range sections {
+			rows = append(rows, newHTMLChange(section.Merge.raw, report.NoSanitize, report.Coauthors, durations))
+			for _, c := range section.Changes {
+				row := newHTMLChange(c.raw, report.NoSanitize, report.Coauthors, durations)
+				row.Merged = true
+				rows = append(rows, row)
+			}
+		}
+		for _, c := range others {
+			rows = append(rows, newHTMLChange(c.raw, report.NoSanitize, report.Coauthors, durations))
+		}
+	} else {
+		for _, c := range report.Changes {
+			rows = append(rows, newHTMLChange(c.raw, report.NoSanitize, report.Coauthors, durations))
+		}
+	}
+	for _, row := range rows {
+		if err := htmlTemplate.ExecuteTemplate(b, "change", row); err != nil {
+			return err
+		}
+	}
+	if err := htmlTemplate.ExecuteTemplate(b, "end", page); err != nil {
+		return err
+	}
+	return b.Flush()
+}
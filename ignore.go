@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultIgnoreFile returns the personal ignore file read unless -ignore-file or -no-ignore is given, empty
+// without a home directory.
+func defaultIgnoreFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "ocp-what-merged", "ignore")
+}
+
+// ignorePattern is a glob pattern of the ignore file with the line it was read from.
+type ignorePattern struct {
+	line    int
+	pattern string
+	// message is the pattern compiled to match commit subjects
+	message *regexp.Regexp
+}
+
+// ignoreRules are the repositories and commit messages to ignore, read from a personal ignore file. Each line is
+// either "repo: PATTERN", matched against ORG/NAME of the repositories, or "message: PATTERN", matched against the
+// subject of the changes (case insensitive, '*' matches '/' too). Patterns are the globs of -component, empty lines
+// and lines starting with '#' are ignored.
+type ignoreRules struct {
+	file         string
+	repositories []ignorePattern
+	messages     []ignorePattern
+}
+
+// readIgnoreFile reads the ignore file, the default one may not exist. There are no rules without a file.
+func readIgnoreFile(file string) (*ignoreRules, error) {
+	if len(file) == 0 {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && file == defaultIgnoreFile() {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseIgnoreRules(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	rules.file = file
+	logVerbose("Read %d repository and %d message patterns from ignore file %s", len(rules.repositories), len(rules.messages), file)
+	return rules, nil
+}
+
+func parseIgnoreRules(content string) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("line %d: expected 'repo: PATTERN' or 'message: PATTERN', got %q", i+1, line)
+		}
+		p := ignorePattern{line: i + 1, pattern: strings.TrimSpace(parts[1])}
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q: %v", i+1, p.pattern, err)
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "repo":
+			p.pattern = strings.TrimPrefix(strings.TrimPrefix(p.pattern, "https://"), "github.com/")
+			rules.repositories = append(rules.repositories, p)
+		case "message":
+			p.message = regexp.MustCompile("(?is)^" + globRegexp(p.pattern) + "$")
+			rules.messages = append(rules.messages, p)
+		default:
+			return nil, fmt.Errorf("line %d: unknown kind %q, expected 'repo' or 'message'", i+1, strings.TrimSpace(parts[0]))
+		}
+	}
+	return rules, nil
+}
+
+// globRegexp translates a valid glob pattern to a regular expression whose '*' matches any text.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			// character classes of globs are those of regular expressions, including the '^' negation and escapes
+			end := i + 1
+			if pattern[end] == '^' {
+				end++
+			}
+			for end++; pattern[end] != ']'; end++ {
+				if pattern[end] == '\\' {
+					end++
+				}
+			}
+			b.WriteString(pattern[i : end+1])
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignoredRepository returns the pattern matching the repository.
+func (r *ignoreRules) ignoredRepository(repository string) (ignorePattern, bool) {
+	organization, name, ok := parseRepositoryOrgName(repository)
+	if !ok {
+		return ignorePattern{}, false
+	}
+	for _, p := range r.repositories {
+		if matched, _ := path.Match(p.pattern, organization+"/"+name); matched {
+			return p, true
+		}
+	}
+	return ignorePattern{}, false
+}
+
+// filterRepositories drops the ignored repositories, logging how many were dropped and the patterns matching
+// none, so stale patterns are noticed.
+func (r *ignoreRules) filterRepositories(repositories []string) []string {
+	if r == nil || len(r.repositories) == 0 {
+		return repositories
+	}
+	used := map[int]bool{}
+	var result []string
+	for _, repository := range repositories {
+		if p, ignored := r.ignoredRepository(repository); ignored {
+			logVerbose("[%s] ignored by line %d of %s", repository, p.line, r.file)
+			used[p.line] = true
+			continue
+		}
+		result = append(result, repository)
+	}
+	log.Printf("Ignore file %s dropped %d of %d repositories", r.file, len(repositories)-len(result), len(repositories))
+	for _, p := range r.repositories {
+		if !used[p.line] {
+			log.Printf("Ignore file %s: pattern %q on line %d matches no repository", r.file, p.pattern, p.line)
+		}
+	}
+	return result
+}
+
+// ignoreFilter drops changes whose subject matches a message pattern of the ignore file.
+type ignoreFilter struct {
+	rules *ignoreRules
+}
+
+func (f ignoreFilter) Name() string {
+	return "ignore-file"
+}
+
+func (f ignoreFilter) Keep(c Change) (bool, string) {
+	subject := commitSubject(c.raw.Message)
+	for _, p := range f.rules.messages {
+		if p.message.MatchString(subject) {
+			return false, fmt.Sprintf("message matches %q on line %d of %s", p.pattern, p.line, f.rules.file)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnoreRules(t *testing.T) {
+	rules, err := parseIgnoreRules(`# personal ignores
+repo: openshift/*-tests
+repo:  https://github.com/openshift/origin
+
+message: bump *
+message: [Ww]IP: *
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repositories []string
+	for _, p := range rules.repositories {
+		repositories = append(repositories, p.pattern)
+	}
+	if !reflect.DeepEqual(repositories, []string{"openshift/*-tests", "openshift/origin"}) || len(rules.messages) != 2 || rules.messages[1].line != 6 {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	for content, expected := range map[string]string{
+		"repo: openshift/api\nopenshift/oc": `line 2: expected 'repo: PATTERN' or 'message: PATTERN', got "openshift/oc"`,
+		"message:":                          `line 1: expected 'repo: PATTERN' or 'message: PATTERN', got "message:"`,
+		"\n\nauthor: deads2k":               `line 3: unknown kind "author", expected 'repo' or 'message'`,
+		"repo: openshift/[api":              `line 1: invalid pattern "openshift/[api"`,
+	} {
+		if _, err := parseIgnoreRules(content); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, expected, err)
+		}
+	}
+}
+
+func TestIgnoreFilter(t *testing.T) {
+	rules, err := parseIgnoreRules("message: bump *\nmessage: [Ww]IP?*\nmessage: *[^a-z]\\*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := ignoreFilter{rules: rules}
+	for message, keep := range map[string]bool{
+		"Bump the API\n\nBody":       false,
+		"bump k8s.io/api to v0.22.0": false,
+		"Fix the bump":               true,
+		"WIP: drop the field":        false,
+		"wip drop the field":         false,
+		"Match the glob 1*":          false,
+		"Match the glob a*":          true,
+	} {
+		if kept, reason := filter.Keep(newChange(RawChange{Message: message})); kept != keep {
+			t.Errorf("%q: expected kept %v, got %v (%s)", message, keep, kept, reason)
+		}
+	}
+}
+
+func TestReadIgnoreFile(t *testing.T) {
+	if rules, err := readIgnoreFile(""); rules != nil || err != nil {
+		t.Errorf("expected no rules without a file, got %+v: %v", rules, err)
+	}
+	dir := t.TempDir()
+	if _, err := readIgnoreFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected a missing -ignore-file to fail")
+	}
+	// the default ignore file may not exist
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+	if rules, err := readIgnoreFile(defaultIgnoreFile()); rules != nil || err != nil {
+		t.Errorf("expected no rules without the default file, got %+v: %v", rules, err)
+	}
+
+	file := filepath.Join(dir, "ignore")
+	if err := ioutil.WriteFile(file, []byte("repo: openshift/api\nrepo openshift/oc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readIgnoreFile(file); err == nil || !strings.HasPrefix(err.Error(), file+": line 2:") {
+		t.Errorf("expected the file and line of the invalid line, got %v", err)
+	}
+}
+
+func TestIgnoreFileQuery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ignore")
+	if err := ioutil.WriteFile(file, []byte("repo: openshift/quiet\nrepo: openshift/stale\nmessage: change 0 *\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, noIgnore := range []bool{false, true} {
+		client, listings := fakeQuietGithub(t)
+		query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, ignoreFile: file, noIgnore: noIgnore}
+		var collected string
+		output := captureLog(t, func() {
+			var err error
+			if collected, err = runTestQuery(t, client, query, []string{"https://github.com/openshift/busy", "https://github.com/openshift/quiet"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if noIgnore {
+			if !strings.Contains(collected, "Change 0 of busy") || listings()["quiet"] != 1 {
+				t.Errorf("expected -no-ignore to skip the ignore file, got %v:\n%s", listings(), collected)
+			}
+			continue
+		}
+		if strings.Contains(collected, "Change 0 of busy") || !strings.Contains(collected, "Change 1 of busy") {
+			t.Errorf("expected the ignored change left out, got:\n%s", collected)
+		}
+		if _, listed := listings()["quiet"]; listed {
+			t.Errorf("expected the ignored repository not to be listed")
+		}
+		for _, expected := range []string{"Filter ignore-file excluded 1 changes", "dropped 1 of 2 repositories", `pattern "openshift/stale" on line 2 matches no repository`} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected %q in the log:\n%s", expected, output)
+			}
+		}
+	}
+	query := &queryOptions{ignoreFile: filepath.Join(filepath.Dir(file), "missing")}
+	if _, err := runTestQuery(t, nil, query, nil); err == nil {
+		t.Errorf("expected a missing -ignore-file to fail before any request")
+	}
+}
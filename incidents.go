@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+)
+
+// maxIncidentLookups is the most reverted commits older than the scanned window fetched one by one per run
+const maxIncidentLookups = 50
+
+var (
+	// revertedCommit matches the body git revert writes, eg. "This reverts commit 0123abc."
+	revertedCommit = regexp.MustCompile(`This reverts commit ([0-9a-f]{7,40})`)
+	// revertSubject matches subjects of reverts, eg. `Revert "Bump the thing"` or `Revert "..." (#1234)`
+	revertSubject = regexp.MustCompile(`^Revert "(.*)"`)
+)
+
+// IncidentWindow is the time range of an incident (see -incident-window).
+type IncidentWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// parseIncidentWindow parses START..END of absolute RFC 3339 times (eg. "2021-08-18T10:00:00Z..2021-08-18T14:00:00Z").
+func parseIncidentWindow(value string) (*IncidentWindow, error) {
+	parts := strings.Split(value, "..")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid -incident-window %q, expected START..END (eg. 2021-08-18T10:00:00Z..2021-08-18T14:00:00Z)", value)
+	}
+	var window IncidentWindow
+	var err error
+	if window.Start, err = time.Parse(time.RFC3339, strings.TrimSpace(parts[0])); err != nil {
+		return nil, fmt.Errorf("invalid -incident-window start: %v", err)
+	}
+	if window.End, err = time.Parse(time.RFC3339, strings.TrimSpace(parts[1])); err != nil {
+		return nil, fmt.Errorf("invalid -incident-window end: %v", err)
+	}
+	if !window.End.After(window.Start) {
+		return nil, fmt.Errorf("invalid -incident-window %q, the end is not after the start", value)
+	}
+	return &window, nil
+}
+
+// revertOf returns the (possibly abbreviated) SHA of the commit the message reverts, ok is false for messages
+// that are not reverts. The SHA is empty for reverts without the "This reverts commit" line (eg. squashed ones).
+func revertOf(message string) (string, bool) {
+	if match := revertedCommit.FindStringSubmatch(message); match != nil {
+		return match[1], true
+	}
+	return "", revertSubject.MatchString(commitSubject(message))
+}
+
+// IncidentCommit is a revert or the commit it reverted.
+type IncidentCommit struct {
+	SHA     string    `json:"sha"`
+	URL     string    `json:"url"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+}
+
+// IncidentPair is a revert merged during the incident and the commit it reverted.
+type IncidentPair struct {
+	Repository string          `json:"repository"`
+	Revert     IncidentCommit  `json:"revert"`
+	Original   *IncidentCommit `json:"original,omitempty"`
+	// TimeToRevert is how long the original commit was merged before its revert
+	TimeToRevert string `json:"timeToRevert,omitempty"`
+	// OutsideWindow originals are older than the scanned window, they were fetched one by one
+	OutsideWindow bool `json:"fetchedOutsideWindow,omitempty"`
+	// Bot is set when the revert was authored by a bot (eg. a revert bot of the CI)
+	Bot bool `json:"bot,omitempty"`
+}
+
+// Incident groups the reverts merged during the incident window with the commits they reverted.
+type Incident struct {
+	Window       IncidentWindow `json:"window"`
+	Pairs        []IncidentPair `json:"pairs"`
+	Repositories []string       `json:"repositories"`
+	Summary      string         `json:"summary"`
+}
+
+// incidentResolver finds the reverted commits, among the changes first and then with single commit requests.
+type incidentResolver struct {
+	client  *github.Client
+	cache   *Cache
+	changes map[string][]RawChange
+	lookups int
+}
+
+func (r *incidentResolver) resolve(ctx context.Context, repository, sha string) (*IncidentCommit, bool) {
+	for _, c := range r.changes[repository] {
+		if strings.HasPrefix(c.SHA, sha) {
+			return &IncidentCommit{SHA: c.SHA, URL: c.URL, Subject: commitSubject(c.Message), Author: c.Author, Date: c.Date}, false
+		}
+	}
+	organization, name, ok := parseRepositoryOrgName(repository)
+	if !ok {
+		return nil, false
+	}
+	commit, ok := r.cache.getRevertedCommit(organization, name, sha)
+	if !ok {
+		if r.client == nil {
+			return nil, false
+		}
+		if r.lookups == maxIncidentLookups {
+			log.Printf("[%s] not fetching reverted commit %s, already fetched %d reverted commits", repository, sha, maxIncidentLookups)
+			return nil, false
+		}
+		r.lookups++
+		var err error
+		if commit, _, err = r.client.Repositories.GetCommit(withCategory(ctx, categoryOther), organization, name, sha); err != nil {
+			log.Printf("[%s] unable to fetch reverted commit %s: %v", repository, sha, err)
+			return nil, false
+		}
+		r.cache.setRevertedCommit(organization, name, sha, commit)
+	}
+	return &IncidentCommit{SHA: commit.GetSHA(), URL: commit.GetHTMLURL(), Subject: commitSubject(commit.GetCommit().GetMessage()), Author: commitAuthor(commit), Date: commitDate(commit)}, true
+}
+
+// findIncident pairs the reverts merged during the window with the commits they reverted. Reverted commits older
+// than the scanned window are fetched one by one (up to maxIncidentLookups, cached), without a client they are
+// left unresolved.
+func findIncident(ctx context.Context, client *github.Client, cache *Cache, changes []Change, window IncidentWindow, durations Formatter) *Incident {
+	resolver := &incidentResolver{client: client, cache: cache, changes: map[string][]RawChange{}}
+	for _, c := range changes {
+		resolver.changes[c.raw.Repository] = append(resolver.changes[c.raw.Repository], c.raw)
+	}
+	incident := &Incident{Window: window}
+	repositories := map[string]bool{}
+	for _, c := range changes {
+		raw := c.raw
+		if raw.Date.Before(window.Start) || raw.Date.After(window.End) {
+			continue
+		}
+		sha, ok := revertOf(raw.Message)
+		if !ok {
+			continue
+		}
+		pair := IncidentPair{
+			Repository: raw.Repository,
+			Revert:     IncidentCommit{SHA: raw.SHA, URL: raw.URL, Subject: commitSubject(raw.Message), Author: raw.Author, Date: raw.Date},
+			Bot:        isBot(raw.Author),
+		}
+		if len(sha) > 0 {
+			pair.Original, pair.OutsideWindow = resolver.resolve(ctx, raw.Repository, sha)
+		}
+		if pair.Original != nil {
+			pair.TimeToRevert = durations.Duration(pair.Revert.Date.Sub(pair.Original.Date))
+		}
+		repositories[raw.Repository] = true
+		incident.Pairs = append(incident.Pairs, pair)
+	}
+	sort.SliceStable(incident.Pairs, func(i, j int) bool { return incident.Pairs[i].Revert.Date.Before(incident.Pairs[j].Revert.Date) })
+	for repository := range repositories {
+		incident.Repositories = append(incident.Repositories, repository)
+	}
+	sort.Strings(incident.Repositories)
+	incident.Summary = incidentSummary(*incident, durations)
+	return incident
+}
+
+// incidentSummary is a line for retrospective documents, eg. "Incident 2021-08-18 10:00..14:00: 5 reverts (3 by
+// bots) in 2 repositories (openshift/api, openshift/oc), reverted 40m to 2d3h after they merged".
+func incidentSummary(incident Incident, durations Formatter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Incident %s..%s: %d reverts", formatTime(incident.Window.Start), formatTime(incident.Window.End), len(incident.Pairs))
+	bots := 0
+	var fastest, slowest time.Duration
+	resolved := 0
+	for _, p := range incident.Pairs {
+		if p.Bot {
+			bots++
+		}
+		if p.Original == nil {
+			continue
+		}
+		d := p.Revert.Date.Sub(p.Original.Date)
+		if resolved == 0 || d < fastest {
+			fastest = d
+		}
+		if resolved == 0 || d > slowest {
+			slowest = d
+		}
+		resolved++
+	}
+	if bots > 0 {
+		fmt.Fprintf(&b, " (%d by bots)", bots)
+	}
+	var names []string
+	for _, repository := range incident.Repositories {
+		names = append(names, repositoryName(repository))
+	}
+	fmt.Fprintf(&b, " in %d repositories (%s)", len(names), strings.Join(names, ", "))
+	switch {
+	case resolved > 0 && fastest == slowest:
+		fmt.Fprintf(&b, ", reverted %s after they merged", durations.Duration(fastest))
+	case resolved > 0:
+		fmt.Fprintf(&b, ", reverted %s to %s after they merged", durations.Duration(fastest), durations.Duration(slowest))
+	}
+	return b.String()
+}
+
+// incidentRow is a row of the incident table.
+type incidentRow struct {
+	Repository string `header:"Repository"`
+	Revert     string `header:"Revert"`
+	Original   string `header:"Original"`
+	After      string `header:"Reverted after"`
+}
+
+// printIncident prints the reverts of the incident paired with the commits they reverted, and the summary.
+func printIncident(w io.Writer, incident *Incident) {
+	if len(incident.Pairs) == 0 {
+		fmt.Fprintf(w, "\nNo reverts merged during the incident %s..%s.\n", formatTime(incident.Window.Start), formatTime(incident.Window.End))
+		return
+	}
+	var rows []incidentRow
+	for _, p := range incident.Pairs {
+		row := incidentRow{Repository: repositoryName(p.Repository), Revert: shortSHA(p.Revert.SHA) + " " + p.Revert.Subject + "\nby " + p.Revert.Author, After: p.TimeToRevert, Original: "(unknown)"}
+		if p.Bot {
+			row.Revert += " (bot)"
+		}
+		if p.Original != nil {
+			row.Original = shortSHA(p.Original.SHA) + " " + p.Original.Subject + "\nby " + p.Original.Author
+			if p.OutsideWindow {
+				row.Original += " (fetched outside the window)"
+			}
+		}
+		rows = append(rows, row)
+	}
+	fmt.Fprintf(w, "\nIncident reverts:\n")
+	tableprinter.New(w).Print(rows)
+	fmt.Fprintln(w, incident.Summary)
+}
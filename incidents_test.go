@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParseIncidentWindow(t *testing.T) {
+	window, err := parseIncidentWindow("2021-08-18T10:00:00Z..2021-08-18T14:00:00+02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !window.Start.Equal(time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)) || window.End.Sub(window.Start) != 2*time.Hour {
+		t.Errorf("unexpected window %+v", window)
+	}
+	for value, expected := range map[string]string{
+		"2021-08-18T10:00:00Z":                       "expected START..END",
+		"yesterday..2021-08-18T14:00:00Z":            "invalid -incident-window start",
+		"2021-08-18T10:00:00Z..now":                  "invalid -incident-window end",
+		"2021-08-18T10:00:00Z..2021-08-18T10:00:00Z": "the end is not after the start",
+	} {
+		if _, err := parseIncidentWindow(value); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", value, expected, err)
+		}
+	}
+	// the window is parsed before any request is made
+	if err := (&queryOptions{incidentWindow: "yesterday"}).validate(); err == nil || !strings.Contains(err.Error(), "expected START..END") {
+		t.Errorf("expected an invalid window to fail the validation, got %v", err)
+	}
+}
+
+func TestRevertOf(t *testing.T) {
+	for message, expected := range map[string]struct {
+		sha    string
+		revert bool
+	}{
+		"Revert \"Bump the API\"\n\nThis reverts commit 0123abcd.":  {sha: "0123abcd", revert: true},
+		"Revert \"Bump the API\" (#42)":                             {revert: true},
+		"Fix the revert of the API\n\nThis reverts commit 0123abcd": {sha: "0123abcd", revert: true},
+		"Revert the API bump":                                       {},
+	} {
+		if sha, revert := revertOf(message); sha != expected.sha || revert != expected.revert {
+			t.Errorf("%q: expected %q %v, got %q %v", message, expected.sha, expected.revert, sha, revert)
+		}
+	}
+}
+
+func TestFindIncident(t *testing.T) {
+	start := time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)
+	window := IncidentWindow{Start: start, End: start.Add(4 * time.Hour)}
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	changes := []Change{
+		newChange(RawChange{Repository: api, SHA: "a1a1a1a1", Author: "deads2k", Message: "Bump the API", Date: start.Add(-time.Hour)}),
+		newChange(RawChange{Repository: api, SHA: "r1r1r1r1", Author: "openshift-ci[bot]", Message: "Revert \"Bump the API\"\n\nThis reverts commit a1a1a1a.", Date: start.Add(time.Hour)}),
+		// the reverted commit is older than the listed changes
+		newChange(RawChange{Repository: oc, SHA: "r2r2r2r2", Author: "soltysh", Message: "Revert \"Fix the login\"\n\nThis reverts commit 0dd0dd0.", Date: start.Add(2 * time.Hour)}),
+		newChange(RawChange{Repository: oc, SHA: "r3r3r3r3", Author: "soltysh", Message: "Revert \"Fix the logout\" (#12)", Date: start.Add(3 * time.Hour)}),
+		// reverts outside the incident are left out
+		newChange(RawChange{Repository: oc, SHA: "r4r4r4r4", Author: "soltysh", Message: "Revert \"Fix the build\"", Date: start.Add(5 * time.Hour)}),
+	}
+	fake := newFakeGithub(t, []fakeRoute{
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/commits/0dd0dd0", Body: json.RawMessage(`{"sha": "0dd0dd0dd0dd", "html_url": "https://github.com/openshift/oc/commit/0dd0dd0dd0dd", "commit": {"message": "Fix the login", "committer": {"date": "2021-08-16T12:00:00Z"}}, "author": {"login": "mfojtik"}}`)},
+	})
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(fake.URL + "/")
+	cache := NewCache()
+
+	incident := findIncident(context.Background(), client, cache, changes, window, newFormatter("", time.Now()))
+	if len(incident.Pairs) != 3 {
+		t.Fatalf("expected 3 reverts, got %+v", incident.Pairs)
+	}
+	listed, fetched, squashed := incident.Pairs[0], incident.Pairs[1], incident.Pairs[2]
+	if listed.Original == nil || listed.Original.SHA != "a1a1a1a1" || listed.OutsideWindow || !listed.Bot || listed.TimeToRevert != "2h" {
+		t.Errorf("expected the listed original, got %+v", listed)
+	}
+	if fetched.Original == nil || fetched.Original.Author != "mfojtik" || !fetched.OutsideWindow || fetched.TimeToRevert != "2d" {
+		t.Errorf("expected the original fetched outside the window, got %+v", fetched)
+	}
+	if squashed.Original != nil {
+		t.Errorf("expected no original of a revert without the reverted commit, got %+v", squashed.Original)
+	}
+	if expected := "Incident 2021-08-18 10:00 UTC..2021-08-18 14:00 UTC: 3 reverts (1 by bots) in 2 repositories (openshift/api, openshift/oc), reverted 2h to 2d after they merged"; incident.Summary != expected {
+		t.Errorf("expected the summary\n%s\ngot\n%s", expected, incident.Summary)
+	}
+
+	// the fetched commit is cached, without a client the others are left unresolved
+	requests := fake.countRequests("/repos/openshift/oc/commits/0dd0dd0")
+	if incident := findIncident(context.Background(), nil, cache, changes, window, newFormatter("", time.Now())); incident.Pairs[1].Original == nil || fake.countRequests("/repos/openshift/oc/commits/0dd0dd0") != requests {
+		t.Errorf("expected the cached reverted commit, got %+v", incident.Pairs[1])
+	}
+	if incident := findIncident(context.Background(), nil, NewCache(), changes, window, newFormatter("", time.Now())); incident.Pairs[1].Original != nil {
+		t.Errorf("expected no lookups without a client, got %+v", incident.Pairs[1].Original)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, Report{Incident: incident}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Incident reverts:", "(fetched outside the window)", "(bot)", "(unknown)", incident.Summary} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+	out.Reset()
+	if err := writeReport(&out, formatJSON, Report{Incident: incident}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"incidents": [`) || !strings.Contains(report, `"fetchedOutsideWindow": true`) {
+		t.Errorf("expected the pairs under incidents, got:\n%s", report)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+	"github.com/xxjwxc/gowp/workpool"
+	"gopkg.in/yaml.v3"
+)
+
+// Job is a single named query defined in the jobs file. Besides the name, command, output, format, template and
+// repositories,
+// the fields of a job are the flags of its command (eg. "since: 72h" sets -since), the flags the job does not set keep
+// their defaults.
+type Job struct {
+	Name string
+	// Command is the command of the query, collect when not set (see jobCommands)
+	Command string
+	Output  string
+	// Format is the format of the output, the table when empty (see formats)
+	Format string
+	// Template and TemplateFile select the template of the template format (see -template and -template-file)
+	Template     string
+	TemplateFile string
+	Repositories []string
+	// Flags are the query flags set by the job, in the order of the file
+	Flags []JobFlag
+
+	// template is parsed with the jobs file, before any request is made
+	template *template.Template
+}
+
+// JobFlag is a query flag set by a job, lists are joined by commas.
+type JobFlag struct {
+	Name  string
+	Value string
+}
+
+// Jobs is the content of the file passed via -jobs flag.
+type Jobs struct {
+	// Index is the file where the summary of all jobs is written, stdout when empty.
+	Index string `yaml:"index"`
+	// Concurrency is the number of jobs run at once, 1 when not set.
+	Concurrency int `yaml:"concurrency"`
+	// APIBudget is the number of Github requests all jobs together make before optional requests are skipped (see
+	// -api-budget), it overrides the flag when set.
+	APIBudget int         `yaml:"api-budget"`
+	Jobs      []yaml.Node `yaml:"jobs"`
+
+	// parsed are the jobs of the Jobs nodes
+	parsed []Job
+}
+
+// JobResult is the summary of a single job printed into the index.
+type JobResult struct {
+	Name    string `header:"Job"`
+	Status  string `header:"Status"`
+	Changes int    `header:"Changes"`
+	Errors  int    `header:"Errors"`
+	Output  string `header:"Output"`
+}
+
+var jobsFileKeys = []string{"index", "concurrency", "api-budget", "jobs"}
+
+// jobCommands are the commands a job can run, collect the changes in a window or compare two payloads or branches
+var jobCommands = map[string]func() changesQuery{
+	"collect": func() changesQuery { return &queryOptions{} },
+	"compare": func() changesQuery { return &compareOptions{} },
+}
+
+func validateKeys(node *yaml.Node, allowed []string, context string) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at line %d", context, node.Line)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		known := false
+		for _, k := range allowed {
+			if k == key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%s: unknown field %q at line %d", context, key, node.Content[i].Line)
+		}
+	}
+	return nil
+}
+
+// jobNodeContext names the job in error messages, falling back to its position when the name is not set.
+func jobNodeContext(node *yaml.Node, n int) string {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "name" && len(node.Content[i+1].Value) > 0 {
+			return fmt.Sprintf("job %q", node.Content[i+1].Value)
+		}
+	}
+	return fmt.Sprintf("job #%d", n+1)
+}
+
+// jobNodeCommand returns the command of the job node, collect when it is not set.
+func jobNodeCommand(node *yaml.Node) string {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "command" {
+			return node.Content[i+1].Value
+		}
+	}
+	return "collect"
+}
+
+// queryFlags returns the flags a job can set, bound to the query.
+func queryFlags(name string, query changesQuery) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	query.addFlags(fs)
+	return fs
+}
+
+// parseJob reads the job from its node, the fields that are not flags of the query are rejected.
+func parseJob(node *yaml.Node, n int) (Job, error) {
+	context := jobNodeContext(node, n)
+	if node.Kind != yaml.MappingNode {
+		return Job{}, fmt.Errorf("%s: expected a mapping at line %d", context, node.Line)
+	}
+	job := Job{Command: jobNodeCommand(node)}
+	newQuery, ok := jobCommands[job.Command]
+	if !ok {
+		return Job{}, fmt.Errorf("%s: invalid field \"command\": %q is not one of collect, compare", context, job.Command)
+	}
+	flags := queryFlags(context, newQuery())
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch {
+		case key.Value == "command":
+		case key.Value == "name":
+			if err := value.Decode(&job.Name); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"name\": %v", context, err)
+			}
+		case key.Value == "output":
+			if err := value.Decode(&job.Output); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"output\": %v", context, err)
+			}
+		case key.Value == "format":
+			if err := value.Decode(&job.Format); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"format\": %v", context, err)
+			}
+		case key.Value == "template":
+			if err := value.Decode(&job.Template); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"template\": %v", context, err)
+			}
+		case key.Value == "template-file":
+			if err := value.Decode(&job.TemplateFile); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"template-file\": %v", context, err)
+			}
+		case key.Value == "repositories":
+			if err := value.Decode(&job.Repositories); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field \"repositories\": %v", context, err)
+			}
+		case flags.Lookup(key.Value) == nil:
+			return Job{}, fmt.Errorf("%s: unknown field %q at line %d", context, key.Value, key.Line)
+		case value.Kind == yaml.ScalarNode:
+			job.Flags = append(job.Flags, JobFlag{Name: key.Value, Value: value.Value})
+		case value.Kind == yaml.SequenceNode:
+			var values []string
+			if err := value.Decode(&values); err != nil {
+				return Job{}, fmt.Errorf("%s: invalid field %q: %v", context, key.Value, err)
+			}
+			job.Flags = append(job.Flags, JobFlag{Name: key.Value, Value: strings.Join(values, ",")})
+		default:
+			return Job{}, fmt.Errorf("%s: field %q must be a value or a list at line %d", context, key.Value, value.Line)
+		}
+	}
+	return job, nil
+}
+
+// query returns the query of the job, the defaults of the flags of its command replaced by the fields of the job.
+func (job Job) query() (changesQuery, error) {
+	query := jobCommands[job.Command]()
+	flags := queryFlags(job.Name, query)
+	for _, f := range job.Flags {
+		if err := flags.Set(f.Name, f.Value); err != nil {
+			return nil, fmt.Errorf("job %q: invalid field %q: %v", job.Name, f.Name, err)
+		}
+	}
+	if err := query.validate(); err != nil {
+		return nil, fmt.Errorf("job %q: %v", job.Name, err)
+	}
+	return query, nil
+}
+
+// setsFlag reports whether the job sets the query flag.
+func (job Job) setsFlag(name string) bool {
+	for _, f := range job.Flags {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseJobs(data []byte) (*Jobs, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("no jobs defined")
+	}
+	root := document.Content[0]
+	if err := validateKeys(root, jobsFileKeys, "jobs file"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value == "jobs" && root.Content[i+1].Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("jobs file: field \"jobs\" must be a list at line %d", root.Content[i+1].Line)
+		}
+	}
+
+	var jobs Jobs
+	if err := root.Decode(&jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs defined")
+	}
+	if jobs.Concurrency < 0 {
+		return nil, fmt.Errorf("jobs file: field \"concurrency\" must not be negative")
+	}
+	if jobs.APIBudget < 0 {
+		return nil, fmt.Errorf("jobs file: field \"api-budget\" must not be negative")
+	}
+	names := map[string]bool{}
+	for n := range jobs.Jobs {
+		job, err := parseJob(&jobs.Jobs[n], n)
+		if err != nil {
+			return nil, err
+		}
+		if len(job.Name) == 0 {
+			return nil, fmt.Errorf("job #%d: missing required field \"name\"", n+1)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("job %q: duplicate job name", job.Name)
+		}
+		names[job.Name] = true
+		if len(job.Output) == 0 {
+			return nil, fmt.Errorf("job %q: missing required field \"output\"", job.Name)
+		}
+		if len(job.Format) > 0 && !isFormat(job.Format) {
+			return nil, fmt.Errorf("job %q: invalid field \"format\": %q is not one of %s", job.Name, job.Format, strings.Join(formats, ", "))
+		}
+		switch {
+		case job.Format == formatTemplate:
+			if job.template, err = parseTemplate(job.TemplateFile, job.Template); err != nil {
+				return nil, fmt.Errorf("job %q: %v", job.Name, err)
+			}
+		case len(job.Template) > 0 || len(job.TemplateFile) > 0:
+			return nil, fmt.Errorf("job %q: fields \"template\" and \"template-file\" require format %s", job.Name, formatTemplate)
+		}
+		for _, name := range []string{"payload", "from", "to"} {
+			if job.setsFlag(name) && len(job.Repositories) > 0 {
+				return nil, fmt.Errorf("job %q: fields %q and \"repositories\" are mutually exclusive", job.Name, name)
+			}
+		}
+		if _, err := job.query(); err != nil {
+			return nil, err
+		}
+		jobs.parsed = append(jobs.parsed, job)
+	}
+	return &jobs, nil
+}
+
+func readJobsFile(path string) (*Jobs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := parseJobs(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return jobs, nil
+}
+
+// writeJobOutput writes the rendered output of a job, the previous output is replaced only once it is complete.
+func writeJobOutput(shared *sharedOptions, path string, output []byte) error {
+	f, err := shared.createOutput(path)
+	if err != nil {
+		return err
+	}
+	// a failed write is reported by Close
+	f.Write(output)
+	return f.Close()
+}
+
+// runJob runs the query of the job, with the flags of the job only, and writes its output.
+func runJob(ctx context.Context, client *github.Client, job Job, shared *sharedOptions, cache *Cache) (*queryResult, error) {
+	query, err := job.query()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[%s] Running the job ...", job.Name)
+	result, err := query.collect(ctx, client, shared, job.Repositories, cache)
+	if err != nil {
+		return nil, err
+	}
+	format := job.Format
+	if len(format) == 0 {
+		format = formatTable
+	}
+	result.Template = job.template
+	// the deprecations seen by the jobs run so far, so each job output can alert about them
+	result.APIDeprecations = shared.apiDeprecations()
+	result.Wrap = shared.messageWrap()
+	result.Mkdirs = shared.mkdirs
+	var out bytes.Buffer
+	_, span := startSpan(ctx, "render", map[string]interface{}{"job": job.Name, "format": format})
+	err = query.render(&out, format, result)
+	span.End()
+	if err != nil {
+		return result, err
+	}
+	if err := writeJobOutput(shared, job.Output, out.Bytes()); err != nil {
+		return result, err
+	}
+	if result.Failed != nil {
+		return result, result.Failed
+	}
+	return result, repositoryErrorsResult(result.Errors)
+}
+
+// runJobs runs the jobs, jobs.Concurrency of them at once, and returns the number of failed jobs. A failure in one
+// job does not prevent the remaining jobs from running.
+func runJobs(ctx context.Context, client *github.Client, jobs *Jobs, shared *sharedOptions, cache *Cache) (int, error) {
+	concurrency := jobs.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	wp := workpool.New(concurrency)
+	results := make([]JobResult, len(jobs.parsed))
+	var lock sync.Mutex
+	failed := 0
+	for i := range jobs.parsed {
+		i, job := i, jobs.parsed[i]
+		wp.Do(func() error {
+			result := JobResult{Name: job.Name, Status: "ok", Output: job.Output}
+			collected, err := runJob(ctx, client, job, shared, cache)
+			if err != nil {
+				log.Printf("[%s] failed: %v", job.Name, err)
+				result.Status = "failed"
+				lock.Lock()
+				failed++
+				lock.Unlock()
+			}
+			if collected != nil {
+				result.Changes = len(collected.Changes)
+				result.Errors = len(collected.Errors)
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		return failed, err
+	}
+
+	if len(jobs.Index) == 0 {
+		tableprinter.New(os.Stdout).Print(results)
+		return failed, nil
+	}
+	f, err := shared.createOutput(jobs.Index)
+	if err != nil {
+		return failed, fmt.Errorf("unable to write jobs index: %v", err)
+	}
+	tableprinter.New(f).Print(results)
+	if err := f.Close(); err != nil {
+		return failed, fmt.Errorf("unable to write jobs index: %v", err)
+	}
+	return failed, nil
+}
+
+// runJobsFile runs the jobs of the file, the jobs share the client, its API budget and the cache.
+func runJobsFile(ctx context.Context, shared *sharedOptions, path string) error {
+	ctx = shared.withTracing(ctx)
+	jobs, err := readJobsFile(path)
+	if err != nil {
+		return err
+	}
+	if jobs.APIBudget > 0 {
+		shared.apiBudget = jobs.APIBudget
+	}
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	failed, err := runJobs(ctx, client, jobs, shared, cache)
+	if err != nil {
+		return err
+	}
+	if err := shared.saveCache(cache); err != nil {
+		return err
+	}
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		return err
+	}
+	if err := shared.finishTracing(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(jobs.parsed))
+	}
+	return nil
+}
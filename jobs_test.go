@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParseJobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{
+			name: "valid",
+			file: "concurrency: 2\napi-budget: 100\njobs:\n- name: master\n  since: 24h\n  output: master.txt\n- name: origin\n  repositories:\n  - https://github.com/openshift/origin\n  prefer-canonical: true\n  output: origin.txt\n",
+		},
+		{name: "no jobs", file: "index: index.txt\n", expected: "no jobs defined"},
+		{name: "unknown file field", file: "indexes: index.txt\njobs:\n- name: master\n  output: master.txt\n", expected: `jobs file: unknown field "indexes"`},
+		{name: "unknown job field", file: "jobs:\n- name: master\n  sincee: 24h\n  output: master.txt\n", expected: `job "master": unknown field "sincee" at line 3`},
+		{name: "unknown field of a job without name", file: "jobs:\n- output: master.txt\n  sincee: 24h\n", expected: `job #1: unknown field "sincee"`},
+		{name: "missing name", file: "jobs:\n- name: master\n  output: master.txt\n- output: other.txt\n", expected: `job #2: missing required field "name"`},
+		{name: "missing output", file: "jobs:\n- name: master\n", expected: `job "master": missing required field "output"`},
+		{name: "duplicate name", file: "jobs:\n- name: master\n  output: a.txt\n- name: master\n  output: b.txt\n", expected: `job "master": duplicate job name`},
+		{name: "payload and repositories", file: "jobs:\n- name: master\n  payload: quay.io/x\n  repositories: [https://github.com/openshift/api]\n  output: a.txt\n", expected: `job "master": fields "payload" and "repositories" are mutually exclusive`},
+		{name: "invalid flag value", file: "jobs:\n- name: master\n  prefer-canonical: maybe\n  output: a.txt\n", expected: `job "master": invalid field "prefer-canonical"`},
+		{name: "invalid since", file: "jobs:\n- name: master\n  since: yesterday\n  output: a.txt\n", expected: `job "master": :-( I am unable to parse -since "yesterday" as a duration or a date`},
+		{name: "since and previous payload", file: "jobs:\n- name: master\n  since: 24h\n  previous-payload: quay.io/x:1\n  output: a.txt\n", expected: `job "master": -since and -previous-payload are mutually exclusive`},
+		{name: "mapping value", file: "jobs:\n- name: master\n  branch:\n    name: master\n  output: a.txt\n", expected: `job "master": field "branch" must be a value or a list`},
+		{name: "unknown command", file: "jobs:\n- name: master\n  command: watch\n  output: a.txt\n", expected: `job "master": invalid field "command": "watch" is not one of collect, compare`},
+		{name: "flag of another command", file: "jobs:\n- name: master\n  from-branch: release-4.9\n  output: a.txt\n", expected: `job "master": unknown field "from-branch"`},
+		{name: "invalid compare", file: "jobs:\n- name: master\n  command: compare\n  from-branch: release-4.9\n  output: a.txt\n", expected: `job "master": both -from-branch and -to-branch must be set`},
+		{name: "payloads and repositories", file: "jobs:\n- name: delta\n  command: compare\n  from: quay.io/x:1\n  to: quay.io/x:2\n  repositories: [https://github.com/openshift/api]\n  output: a.txt\n", expected: `job "delta": fields "from" and "repositories" are mutually exclusive`},
+		{name: "invalid format", file: "jobs:\n- name: master\n  format: xml\n  output: a.txt\n", expected: `job "master": invalid field "format": "xml" is not one of table, json, junit, template`},
+		{name: "template without format", file: "jobs:\n- name: master\n  template: slack\n  output: a.txt\n", expected: `job "master": fields "template" and "template-file" require format template`},
+		{name: "unknown template", file: "jobs:\n- name: master\n  format: template\n  template: email\n  output: a.txt\n", expected: `job "master": unknown template "email", expected one of changelog, slack`},
+		{name: "negative concurrency", file: "concurrency: -1\njobs:\n- name: master\n  output: a.txt\n", expected: `field "concurrency" must not be negative`},
+	}
+	for _, test := range tests {
+		_, err := parseJobs([]byte(test.file))
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestJobOptions(t *testing.T) {
+	jobs, err := parseJobs([]byte("jobs:\n- name: z-stream\n  branch: release-4.9\n  since: 72h\n  output: a.txt\n- name: master\n  output: b.txt\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zStream, err := jobs.parsed[0].query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := jobs.parsed[1].query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the flags a job does not set keep their defaults, whatever the other jobs set
+	if o := zStream.(*queryOptions); o.branch != "release-4.9" || o.since != "72h" {
+		t.Errorf("expected the flags of the job, got %+v", o)
+	}
+	if o := master.(*queryOptions); o.branch != "master" || o.since != "" || o.payload != defaultPayload {
+		t.Errorf("expected the default flags, got %+v", o)
+	}
+
+	jobs, err = parseJobs([]byte("jobs:\n- name: master-only\n  command: compare\n  from-branch: release-4.9\n  to-branch: master\n  output: a.txt\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare, err := jobs.parsed[0].query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := compare.(*compareOptions); !ok || o.fromBranch != "release-4.9" || o.toBranch != "master" {
+		t.Errorf("expected the flags of the compare command, got %+v", compare)
+	}
+}
+
+// fakeJobsGithub serves a repository with a single commit and a comparison of release-4.9 and master branches, it
+// counts the commit listings.
+func fakeJobsGithub(t *testing.T) (*github.Client, func() int) {
+	var lock sync.Mutex
+	listings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/branches/master":
+			fmt.Fprint(w, `{"name": "master"}`)
+		case "/repos/openshift/api/commits":
+			lock.Lock()
+			listings++
+			lock.Unlock()
+			fmt.Fprintf(w, `[{"sha": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "html_url": "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "commit": {"message": "Bump the API", "committer": {"date": %q}}}]`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+		case "/repos/openshift/api/compare/release-4.9...master":
+			fmt.Fprint(w, `{"commits": [{"sha": "d6cd1e2bd19e03a81132a23b2025920577f84e37", "html_url": "https://github.com/openshift/api/commit/d6cd1e2bd19e03a81132a23b2025920577f84e37", "commit": {"message": "Only on master", "committer": {"date": "2021-08-20T10:00:00Z"}}}]}`)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return listings
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	client, listings := fakeJobsGithub(t)
+	dir := t.TempDir()
+	file := fmt.Sprintf(`index: %[1]s/index.txt
+jobs:
+- name: master
+  repositories: [https://github.com/openshift/api]
+  output: %[1]s/master.txt
+- name: broken
+  repositories: [https://github.com/openshift/api]
+  output: %[1]s/missing/broken.txt
+- name: last-week
+  repositories: [https://github.com/openshift/api]
+  since: 7d
+  output: %[1]s/last-week.txt
+- name: slack
+  repositories: [https://github.com/openshift/api]
+  format: template
+  template: slack
+  output: %[1]s/slack.txt
+- name: master-only
+  command: compare
+  repositories: [https://github.com/openshift/api]
+  from-branch: release-4.9
+  to-branch: master
+  output: %[1]s/master-only.txt
+`, dir)
+	jobs, err := parseJobs([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := runJobs(context.Background(), client, jobs, &sharedOptions{concurrency: 10, skipTokenCheck: true}, NewCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Errorf("expected the broken job to fail, got %d failed jobs", failed)
+	}
+	for _, output := range []string{"master.txt", "last-week.txt", "slack.txt"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "Bump the API") {
+			t.Errorf("%s: expected the change, got:\n%s", output, data)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "master-only.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Only on master") || strings.Contains(string(data), "Bump the API") {
+		t.Errorf("expected only the compared change in the compare job output, got:\n%s", data)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"master", "broken", "failed", "last-week", "master-only"} {
+		if !strings.Contains(string(index), line) {
+			t.Errorf("expected %q in the index:\n%s", line, index)
+		}
+	}
+	// the longer window of the last job is not covered by the commits listed for the first ones
+	if n := listings(); n != 2 {
+		t.Errorf("expected the jobs with the same window to share the commits, got %d listings", n)
+	}
+	// the directory of the broken job is created with -mkdirs
+	if failed, err := runJobs(context.Background(), client, jobs, &sharedOptions{concurrency: 10, skipTokenCheck: true, mkdirs: true}, NewCache()); err != nil || failed != 0 {
+		t.Errorf("expected all jobs to succeed with -mkdirs, got %d failed jobs: %v", failed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing", "broken.txt")); err != nil {
+		t.Errorf("expected the output of the broken job: %v", err)
+	}
+}
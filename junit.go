@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// newJUnitReport converts the report into test suites, one per repository. Changes are passing test cases,
+// repositories that could not be processed are failing ones and repositories without changes are skipped.
+func newJUnitReport(report Report) junitTestSuites {
+	var properties []junitProperty
+	if len(report.Payload) > 0 {
+		properties = append(properties, junitProperty{Name: "payload", Value: report.Payload})
+	}
+	if len(report.Branch) > 0 {
+		properties = append(properties, junitProperty{Name: "branch", Value: report.Branch})
+	}
+	if report.Window != nil {
+		properties = append(properties, junitProperty{Name: "since", Value: report.Window.Since.In(displayLocation).Format(time.RFC3339)})
+		if len(report.Window.PreviousPayload) > 0 {
+			properties = append(properties, junitProperty{Name: "previous-payload", Value: report.Window.PreviousPayload})
+		}
+	}
+
+	suites := map[string]*junitTestSuite{}
+	suite := func(repository string) *junitTestSuite {
+		if s, ok := suites[repository]; ok {
+			return s
+		}
+		suites[repository] = &junitTestSuite{Name: repositoryName(repository), Properties: properties}
+		return suites[repository]
+	}
+	for _, c := range report.Changes {
+		s := suite(c.raw.Repository)
+		s.Cases = append(s.Cases, junitTestCase{
+			Name:      fmt.Sprintf("%s %s", shortSHA(c.raw.SHA), commitSubject(c.raw.Message)),
+			Classname: repositoryName(c.raw.Repository),
+			SystemOut: c.raw.URL,
+		})
+	}
+	for _, e := range report.Errors {
+		s := suite(e.Repository)
+		s.Failures++
+		s.Cases = append(s.Cases, junitTestCase{
+			Name:      e.Kind,
+			Classname: repositoryName(e.Repository),
+			Failure:   &junitFailure{Message: e.Kind, Text: e.Err.Error()},
+		})
+	}
+	for _, repository := range report.Unchanged {
+		s := suite(repository)
+		s.Skipped++
+		s.Cases = append(s.Cases, junitTestCase{
+			Name:      "no changes",
+			Classname: repositoryName(repository),
+			Skipped:   &junitSkipped{Message: "no changes in the window"},
+		})
+	}
+
+	var result junitTestSuites
+	for _, s := range suites {
+		s.Tests = len(s.Cases)
+		result.Tests += s.Tests
+		result.Failures += s.Failures
+		result.Skipped += s.Skipped
+		result.Suites = append(result.Suites, *s)
+	}
+	sort.Slice(result.Suites, func(i, j int) bool { return result.Suites[i].Name < result.Suites[j].Name })
+	return result
+}
+
+// repositoryName returns the "org/repo" part of the repository URL.
+func repositoryName(repository string) string {
+	if organization, name, ok := parseRepositoryOrgName(repository); ok {
+		return organization + "/" + name
+	}
+	return repository
+}
+
+func writeJUnitReport(w io.Writer, report Report) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(newJUnitReport(report)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	report := Report{
+		Changes: []Change{
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", URL: "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Validate <name> & \"namespace\" of 'pods'\n\nDetails"}),
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "d6cd1e2bd19e03a81132a23b2025920577f84e37", Message: "Bump the API"}),
+		},
+		Errors:    []RepositoryError{{Repository: "https://github.com/openshift/oc", Kind: "not-found", Err: errors.New("GET https://api.github.com/repos/openshift/oc: 404 Not Found <html>")}},
+		Unchanged: []string{"https://github.com/openshift/console"},
+		Payload:   defaultPayload,
+		Branch:    "master",
+		Window:    &Window{Since: time.Date(2021, 8, 17, 8, 45, 12, 0, time.UTC), PreviousPayload: "quay.io/openshift-release-dev/ocp-release:4.9.0-fc.1-x86_64"},
+	}
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJUnit, report); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("expected well-formed XML, got %v:\n%s", err, out.String())
+	}
+	if suites.Tests != 4 || suites.Failures != 1 || suites.Skipped != 1 {
+		t.Errorf("expected 4 tests, 1 failure and 1 skipped, got %d, %d and %d", suites.Tests, suites.Failures, suites.Skipped)
+	}
+	var names []string
+	for _, s := range suites.Suites {
+		names = append(names, s.Name)
+	}
+	if expected := []string{"openshift/api", "openshift/console", "openshift/oc"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected suites %v, got %v", expected, names)
+	}
+
+	api := suites.Suites[0]
+	expectedCases := []junitTestCase{
+		{Name: "553c207 Validate <name> & \"namespace\" of 'pods'", Classname: "openshift/api", SystemOut: "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e"},
+		{Name: "d6cd1e2 Bump the API", Classname: "openshift/api"},
+	}
+	if !reflect.DeepEqual(api.Cases, expectedCases) {
+		t.Errorf("expected test cases %+v, got %+v", expectedCases, api.Cases)
+	}
+	expectedProperties := []junitProperty{
+		{Name: "payload", Value: defaultPayload},
+		{Name: "branch", Value: "master"},
+		{Name: "since", Value: "2021-08-17T08:45:12Z"},
+		{Name: "previous-payload", Value: "quay.io/openshift-release-dev/ocp-release:4.9.0-fc.1-x86_64"},
+	}
+	if !reflect.DeepEqual(api.Properties, expectedProperties) {
+		t.Errorf("expected properties %+v, got %+v", expectedProperties, api.Properties)
+	}
+
+	if console := suites.Suites[1]; console.Skipped != 1 || console.Cases[0].Skipped == nil {
+		t.Errorf("expected the unchanged repository skipped, got %+v", console)
+	}
+	oc := suites.Suites[2]
+	if oc.Failures != 1 || oc.Cases[0].Failure == nil || oc.Cases[0].Failure.Text != "GET https://api.github.com/repos/openshift/oc: 404 Not Found <html>" {
+		t.Errorf("expected the failed repository with the error, got %+v", oc)
+	}
+}
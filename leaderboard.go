@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const unknownAuthor = "unknown author"
+
+// knownBots are accounts whose commits are not contributions of people, accounts of Github apps end with "[bot]".
+var knownBots = []string{
+	"openshift-bot",
+	"openshift-ci-robot",
+	"openshift-merge-robot",
+	"openshift-merge-bot",
+	cherryPickRobot,
+}
+
+func isBot(author string) bool {
+	if strings.HasSuffix(author, "[bot]") {
+		return true
+	}
+	for _, bot := range knownBots {
+		if strings.EqualFold(author, bot) {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaderboardEntry is the number of changes of an author and the number of repositories they touched.
+type LeaderboardEntry struct {
+	Author       string `header:"Author" json:"author"`
+	Commits      int    `header:"Commits" json:"commits"`
+	Repositories int    `header:"Repositories" json:"repositories"`
+}
+
+// leaderboard aggregates the changes by author, sorted by the number of changes and then by author. Commits
+// of known bots are left out unless includeBots is set.
+func leaderboard(changes []Change, includeBots bool) []LeaderboardEntry {
+	entries := map[string]*LeaderboardEntry{}
+	repositories := map[string]map[string]bool{}
+	for _, c := range changes {
+		author := c.raw.Author
+		if len(author) == 0 {
+			author = unknownAuthor
+		}
+		if !includeBots && isBot(author) {
+			continue
+		}
+		entry, ok := entries[author]
+		if !ok {
+			entry = &LeaderboardEntry{Author: author}
+			entries[author] = entry
+			repositories[author] = map[string]bool{}
+		}
+		entry.Commits++
+		repositories[author][c.raw.Repository] = true
+	}
+
+	result := []LeaderboardEntry{}
+	for author, entry := range entries {
+		entry.Repositories = len(repositories[author])
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Author < result[j].Author
+	})
+	return result
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCommitAuthor(t *testing.T) {
+	tests := []struct {
+		name     string
+		commit   *github.RepositoryCommit
+		expected string
+	}{
+		{name: "login", commit: &github.RepositoryCommit{Author: &github.User{Login: github.String("alice")}, Commit: &github.Commit{Author: &github.CommitAuthor{Email: github.String("alice@example.com")}}}, expected: "alice"},
+		{name: "email", commit: &github.RepositoryCommit{Commit: &github.Commit{Author: &github.CommitAuthor{Name: github.String("Bob"), Email: github.String("bob@example.com")}}}, expected: "bob@example.com"},
+		{name: "name", commit: &github.RepositoryCommit{Commit: &github.Commit{Author: &github.CommitAuthor{Name: github.String("Carol")}}}, expected: "Carol"},
+		{name: "nil author", commit: &github.RepositoryCommit{Commit: &github.Commit{}}, expected: unknownAuthor},
+	}
+	for _, test := range tests {
+		if author := commitAuthor(test.commit); author != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, author)
+		}
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	var changes []Change
+	for _, c := range []struct{ author, repository string }{
+		{"bob", "https://github.com/openshift/api"},
+		{"alice", "https://github.com/openshift/api"},
+		{"alice", "https://github.com/openshift/oc"},
+		{"bob", "https://github.com/openshift/oc"},
+		{"carol@example.com", "https://github.com/openshift/oc"},
+		{"", "https://github.com/openshift/oc"},
+		{"openshift-bot", "https://github.com/openshift/api"},
+		{"openshift-bot", "https://github.com/openshift/oc"},
+		{"openshift-bot", "https://github.com/openshift/oc"},
+		{"dependabot[bot]", "https://github.com/openshift/oc"},
+	} {
+		changes = append(changes, newChange(RawChange{Repository: c.repository, Author: c.author, Message: "Change"}))
+	}
+
+	// ties are sorted by author, commits without an author are counted together
+	expected := []LeaderboardEntry{
+		{Author: "alice", Commits: 2, Repositories: 2},
+		{Author: "bob", Commits: 2, Repositories: 2},
+		{Author: "carol@example.com", Commits: 1, Repositories: 1},
+		{Author: unknownAuthor, Commits: 1, Repositories: 1},
+	}
+	if entries := leaderboard(changes, false); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+	withBots := leaderboard(changes, true)
+	if len(withBots) != 6 || withBots[0] != (LeaderboardEntry{Author: "openshift-bot", Commits: 3, Repositories: 2}) || withBots[4].Author != "dependabot[bot]" {
+		t.Errorf("expected the bots to be included, got %+v", withBots)
+	}
+	if entries := leaderboard(nil, false); entries == nil || len(entries) != 0 {
+		t.Errorf("expected an empty leaderboard, got %#v", entries)
+	}
+}
+
+func TestRenderLeaderboard(t *testing.T) {
+	report := templateTestReport()
+	report.Leaderboard = leaderboard(report.Changes, false)
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, report); err != nil {
+		t.Fatal(err)
+	}
+	if table := out.String(); !strings.Contains(table, "Leaderboard:") || !strings.Contains(table, "COMMITS") {
+		t.Errorf("expected the leaderboard table, got:\n%s", table)
+	}
+
+	out.Reset()
+	if err := writeReport(&out, formatJSON, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded jsonReport
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Leaderboard, report.Leaderboard) {
+		t.Errorf("expected the leaderboard key, got %+v", decoded.Leaderboard)
+	}
+}
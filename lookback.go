@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultMaxLookback is the default longest window -min-commits extends the window of a repository to
+const defaultMaxLookback = 90 * 24 * time.Hour
+
+// extendLookback lists older commits of a repository with fewer than MinCommits changes in the window. The
+// window is doubled until it has MinCommits changes, up to MaxLookback, but the commits are listed just once:
+// since MaxLookback ago, stopping once enough changes are listed. Returns the commits in the extended window
+// and the window, which is the original one when it had enough changes.
+func extendLookback(ctx context.Context, client *github.Client, organization, name string, options ProcessOptions, limit *commitLimit, commits []*github.RepositoryCommit) ([]*github.RepositoryCommit, time.Duration, error) {
+	if countChanges(commits) >= options.MinCommits || options.MaxLookback <= options.Since {
+		return commits, options.Since, nil
+	}
+	now := time.Now()
+	listed := 0
+	stop := func(page []*github.RepositoryCommit) bool {
+		listed += countChanges(page)
+		return listed >= options.MinCommits
+	}
+	all, err := listAllCommits(ctx, client, organization, name, github.CommitsListOptions{
+		SHA:   options.BranchName,
+		Since: windowStart(now, options.MaxLookback, options.ClockSkew, options.TrustServerTime),
+	}, stop, limit)
+	if err != nil && !isTruncated(err) {
+		return commits, options.Since, err
+	}
+
+	// the commits are listed from the newest, the oldest needed change decides the window
+	lookback := options.MaxLookback
+	found := 0
+	for _, c := range all {
+		if isMergeCommit(c) {
+			continue
+		}
+		if found++; found == options.MinCommits {
+			lookback = options.Since
+			for lookback < options.MaxLookback && now.Sub(commitDate(c)) > lookback {
+				lookback *= 2
+			}
+			if lookback > options.MaxLookback {
+				lookback = options.MaxLookback
+			}
+			break
+		}
+	}
+	since := windowStart(now, lookback, options.ClockSkew, options.TrustServerTime)
+	var result []*github.RepositoryCommit
+	for _, c := range all {
+		if !commitDate(c).Before(since) {
+			result = append(result, c)
+		}
+	}
+	return result, lookback, err
+}
+
+// countChanges counts the commits that are changes, not merge commits.
+func countChanges(commits []*github.RepositoryCommit) int {
+	n := 0
+	for _, c := range commits {
+		if !isMergeCommit(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// repositoryLookbacks returns the extended windows of repositories, nil when no window was extended.
+func repositoryLookbacks(changes []Change) map[string]string {
+	var lookbacks map[string]string
+	for _, c := range changes {
+		if len(c.raw.Lookback) == 0 {
+			continue
+		}
+		if lookbacks == nil {
+			lookbacks = map[string]string{}
+		}
+		lookbacks[c.raw.Repository] = c.raw.Lookback
+	}
+	return lookbacks
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeQuietGithub serves commits of openshift/busy merged in the last hours and of openshift/quiet merged 3, 5, 10
+// and 40 days ago, listed since the requested time. It returns the number of listings of each repository.
+func fakeQuietGithub(t *testing.T) (*github.Client, func() map[string]int) {
+	now := time.Now()
+	ages := map[string][]time.Duration{
+		"busy":  {time.Hour, 2 * time.Hour, 3 * time.Hour},
+		"quiet": {3 * 24 * time.Hour, 5 * 24 * time.Hour, 10 * 24 * time.Hour, 40 * 24 * time.Hour},
+	}
+	var lock sync.Mutex
+	listings := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/repos/openshift/"), "/")
+		switch {
+		case len(parts) == 1:
+			fmt.Fprintf(w, `{"name": %q, "fork": false}`, parts[0])
+		case len(parts) == 2 && parts[1] == "commits":
+			lock.Lock()
+			listings[parts[0]]++
+			lock.Unlock()
+			since, err := time.Parse(time.RFC3339, req.URL.Query().Get("since"))
+			if err != nil {
+				t.Errorf("unexpected since %q", req.URL.Query().Get("since"))
+			}
+			var commits []string
+			for i, age := range ages[parts[0]] {
+				if date := now.Add(-age); !date.Before(since) {
+					commits = append(commits, fmt.Sprintf(`{"sha": "%s%d", "commit": {"message": "Change %d of %s", "committer": {"date": %q}}}`, parts[0], i, i, parts[0], date.Format(time.RFC3339)))
+				}
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(commits, ","))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() map[string]int {
+		lock.Lock()
+		defer lock.Unlock()
+		return listings
+	}
+}
+
+func TestMinCommits(t *testing.T) {
+	defer func(v bool) { verbose = v }(verbose)
+	verbose = true
+	client, listings := fakeQuietGithub(t)
+	query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, minCommits: 3, maxLookback: defaultMaxLookback}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var result *queryResult
+	output := captureLog(t, func() {
+		var err error
+		if result, err = query.collect(context.Background(), client, &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/busy", "https://github.com/openshift/quiet"}, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// the window of openshift/quiet doubles to 16 days to include its third change, listed just once more
+	times := map[string]string{}
+	for _, c := range result.Changes {
+		times[c.raw.Message] = c.Time
+		if c.raw.Repository == "https://github.com/openshift/busy" && (c.raw.OutsideWindow || len(c.raw.Lookback) > 0) {
+			t.Errorf("expected the window of openshift/busy not to be extended, got %+v", c.raw)
+		}
+	}
+	if len(times) != 6 || !strings.HasSuffix(times["Change 2 of quiet"], "(outside window)") || strings.HasSuffix(times["Change 0 of busy"], "(outside window)") {
+		t.Errorf("expected the older changes of openshift/quiet marked outside the window, got %v", times)
+	}
+	if _, ok := times["Change 3 of quiet"]; ok {
+		t.Errorf("expected the change older than the extended window to be left out")
+	}
+	if !reflect.DeepEqual(listings(), map[string]int{"busy": 1, "quiet": 2}) {
+		t.Errorf("expected the extended window to be listed once, got %v", listings())
+	}
+	if !reflect.DeepEqual(result.Window.Lookback, map[string]string{"https://github.com/openshift/quiet": (16 * 24 * time.Hour).String()}) {
+		t.Errorf("unexpected lookback %v", result.Window.Lookback)
+	}
+	if !strings.Contains(output, "[https://github.com/openshift/quiet] extended the window to 384h0m0s to list 3 changes") {
+		t.Errorf("expected the extended window to be logged, got:\n%s", output)
+	}
+
+	// the window is not extended beyond -max-lookback, without -min-commits it is not extended at all
+	for _, test := range []struct {
+		options  ProcessOptions
+		expected int
+	}{
+		{options: ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", MinCommits: 3, MaxLookback: 4 * 24 * time.Hour}, expected: 4},
+		{options: ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master"}, expected: 3},
+	} {
+		client, _ := fakeQuietGithub(t)
+		var changes []Change
+		captureLog(t, func() {
+			var err error
+			if changes, _, err = processRepositories(context.Background(), client, test.options, []string{"https://github.com/openshift/busy", "https://github.com/openshift/quiet"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if len(changes) != test.expected {
+			t.Errorf("%+v: expected %d changes, got %d", test.options, test.expected, len(changes))
+		}
+	}
+}
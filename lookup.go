@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// minimumSHALength avoids ambiguous matches of very short SHA prefixes
+const minimumSHALength = 7
+
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type lookupOptions struct {
+	raw stringList
+}
+
+func (o *lookupOptions) addFlags(fs *flag.FlagSet) {
+	fs.Var(&o.raw, "raw", "Raw data file saved via 'collect -save-raw' to search in (can be repeated)")
+}
+
+// LookupResult is a change matching the looked up SHA.
+type LookupResult struct {
+	SHA         string `header:"SHA" json:"sha"`
+	Repository  string `header:"Repository" json:"repository"`
+	PullRequest string `header:"PR" json:"pullRequest,omitempty"`
+	Branch      string `header:"Branch" json:"branch"`
+	Payload     string `header:"Payload" json:"payload,omitempty"`
+	Source      string `header:"Source" json:"source"`
+}
+
+func newLookupCommand() *command {
+	cmd := newCommand("lookup", "Find which payload repository a commit SHA belongs to, using local state", `
+The lookup does not talk to Github, it searches data previously saved via 'collect -save-raw'.
+
+Examples:
+  # find the repository and pull request of a commit
+  ocp-what-merged lookup -raw today.json 276e9d4
+
+  # search multiple saved runs
+  ocp-what-merged lookup -raw master.json -raw release-4.9.json 276e9d4 1469b05
+`)
+	shared := &sharedOptions{}
+	options := &lookupOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		return runLookup(shared, options, args)
+	}
+	return cmd
+}
+
+func lookupSHA(data *RawData, source, sha string) []LookupResult {
+	var results []LookupResult
+	for _, r := range data.Repositories {
+		for _, c := range r.Changes {
+			if !strings.HasPrefix(c.SHA, sha) {
+				continue
+			}
+			result := LookupResult{
+				SHA:        c.SHA,
+				Repository: c.Repository,
+				Branch:     data.Metadata.Branch,
+				Payload:    data.Metadata.Payload,
+				Source:     source,
+			}
+			if c.PullRequest > 0 {
+				result.PullRequest = fmt.Sprintf("#%d", c.PullRequest)
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func runLookup(shared *sharedOptions, o *lookupOptions, shas []string) error {
+	if len(o.raw) == 0 {
+		return fmt.Errorf("at least one -raw file must be given")
+	}
+	if len(shas) == 0 {
+		return fmt.Errorf("at least one commit SHA must be given")
+	}
+	for _, sha := range shas {
+		if len(sha) < minimumSHALength {
+			return fmt.Errorf("commit SHA %q is too short, at least %d characters are required", sha, minimumSHALength)
+		}
+	}
+
+	var results []LookupResult
+	for _, path := range o.raw {
+		data, err := readRawData(path)
+		if err != nil {
+			return err
+		}
+		for _, sha := range shas {
+			results = append(results, lookupSHA(data, path, sha)...)
+		}
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no commit matching %s found", strings.Join(shas, ", "))
+	}
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	switch shared.format {
+	case formatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	default:
+		tableprinter.New(out).Print(results)
+	}
+	return out.Close()
+}
@@ -2,51 +2,230 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"runtime/debug"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/google/go-github/github"
-	"github.com/lensesio/tableprinter"
-	"github.com/xhit/go-str2duration/v2"
-	"github.com/xxjwxc/gowp/workpool"
-	"golang.org/x/oauth2"
 )
 
-const defaultPayload = "quay.io/openshift-release-dev/ocp-release:4.9.0-fc.0-x86_64"
-
-type Release struct {
-	Refs References `json:"references"`
+type Change struct {
+	URL         string `header:"URL"`
+	Message     string `header:"Message"`
+	CVEs        string `header:"CVEs"`
+	Time        string `header:"When"`
+	PullRequest string `header:"PR"`
+	MergedBy    string `header:"Merged by"`
+	MergeMethod string `header:"Merge method"`
+	Merge       string `header:"Merge"`
+	ShippedIn   string `header:"Shipped in"`
+	Retests     string `header:"Retests"`
+	Backports   string `header:"Backports"`
+	Owners      string `header:"Owners"`
+	Repos       string `header:"Repos"`
+	Branches    string `header:"Branches"`
+	Tier        string `header:"Tier"`
+	Capability  string `header:"Capability"`
+	Source      string `header:"Source"`
+	Versions    string `header:"Versions"`
+	Verified    string `header:"Verified"`
+	PathClass   string `header:"Path Class"`
+	Files       string `header:"Files"`
+	Duplicates  string `header:"Duplicates"`
+	Presence    string `header:"Presence"`
+	ExcludedBy  string `header:"Excluded by"`
+
+	raw RawChange
 }
 
-type References struct {
-	Spec ReferencesSpec `json:"spec"`
+// RawChange holds all collected data about a change. The printed Change columns are
+// derived from it, which allows to render changes loaded from a raw data file.
+type RawChange struct {
+	Repository string    `json:"repository"`
+	SHA        string    `json:"sha"`
+	URL        string    `json:"url"`
+	Message    string    `json:"message"`
+	Date       time.Time `json:"date"`
+	// FutureDate changes are dated after the start of the run (see -future-tolerance), ClampedDate is the start of
+	// the run they are rendered and sorted by with -clamp-future-dates
+	FutureDate  bool       `json:"futureTimestamp,omitempty"`
+	ClampedDate *time.Time `json:"clampedDate,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Committer   string     `json:"committer,omitempty"`
+	Tier        string     `json:"tier,omitempty"`
+	// Branches are the branches the change was found on when repositories are scanned on several (see -repo-branches)
+	Branches []string `json:"branches,omitempty"`
+	// Capability is the class of the repository (core, capability:NAME or other, see -show-capability)
+	Capability string `json:"capability,omitempty"`
+	// Source is "org" for repositories added by -include-org-repos, empty for payload repositories
+	Source string `json:"source,omitempty"`
+	// Versions are component versions of the repository payload images (see -with-versions)
+	Versions map[string]string `json:"versions,omitempty"`
+	ForkNote string            `json:"forkNote,omitempty"`
+	// OutsideWindow changes are older than the window, listed as the window of the repository was extended to Lookback by -min-commits
+	OutsideWindow bool   `json:"outsideWindow,omitempty"`
+	Lookback      string `json:"lookback,omitempty"`
+	// StitchedBranch is the old default branch whose commits in the window were merged in, as the default branch was
+	// renamed during the window (see -branch-stitching)
+	StitchedBranch string `json:"stitchedBranch,omitempty"`
+	// FirstParentFallback changes are listed from all commits as the first-parent history of the repository could
+	// not be listed (see -first-parent), their counts may differ from the other repositories
+	FirstParentFallback bool `json:"firstParentFallback,omitempty"`
+	// PayloadOffset is the number of seconds the change was merged after (or before, when negative) the payload was created
+	PayloadOffset *int64 `json:"payloadOffsetSeconds,omitempty"`
+	// PathClasses are the classes of the changed files (see -classify-paths)
+	PathClasses []string `json:"pathClasses,omitempty"`
+	// OmittedLines are the message lines dropped at collection time (see ProcessOptions.MessageLines), still counted
+	// by the truncated table message
+	OmittedLines int `json:"omittedLines,omitempty"`
+	// Trailers are the git trailers of the message (eg. "Upstream-Commit", "Component") by their canonical key
+	Trailers map[string][]string `json:"trailers,omitempty"`
+	// Files are the changed files fetched by -classify-paths, FilesIncomplete when Github listed only maxCommitFiles
+	Files           []ChangedFile `json:"files,omitempty"`
+	FilesIncomplete bool          `json:"filesIncomplete,omitempty"`
+	// Verification is the signature verification returned with the commit, nil when it is not known
+	Verification *Verification `json:"verification,omitempty"`
+	// PrivatePair is the same change in the private mirror of the repository (eg. openshift-priv during an embargo)
+	PrivatePair *EmbargoPair `json:"privatePair,omitempty"`
+	// Mirror is the repository the commits were listed from when the token can't read the repository (see -repo-alias)
+	Mirror      string `json:"mirror,omitempty"`
+	PullRequest int    `json:"pullRequest,omitempty"`
+	// ParsedPullRequest is the pull request found in the history without requests (see parseCommitPullRequests)
+	ParsedPullRequest int `json:"parsedPullRequest,omitempty"`
+	// PullRequestTitle is searched for CVE references together with the message
+	PullRequestTitle string `json:"pullRequestTitle,omitempty"`
+	// CVESeverities are the severities of the referenced CVEs (see -cve-severity)
+	CVESeverities map[string]string `json:"cveSeverities,omitempty"`
+	MergedBy      string            `json:"mergedBy,omitempty"`
+	MergeMethod   string            `json:"mergeMethod,omitempty"`
+	MergedAt      *time.Time        `json:"mergedAt,omitempty"`
+	MergeCommit   string            `json:"mergeCommit,omitempty"`
+	// Merge commits are listed with -merge-commits show or collapse, MergedInto is the merge commit of the changes
+	// it merged with collapse
+	Merge      bool   `json:"merge,omitempty"`
+	MergedInto string `json:"mergedInto,omitempty"`
+	// ShippedIn are the payload tags already built from a commit containing the change, when the repository was
+	// built from several commits in -since-payload (see -multi-sha per-tag)
+	ShippedIn []string `json:"shippedIn,omitempty"`
+	// BatchID is the merge commit of the first pull request merged together with this one (eg. by a Tide batch)
+	BatchID   string     `json:"batchID,omitempty"`
+	Retests   *int       `json:"retests,omitempty"`
+	Overrides []string   `json:"overrides,omitempty"`
+	Backports []Backport `json:"backports,omitempty"`
+	Owners    []string   `json:"owners,omitempty"`
+
+	// Presence maps release branches to whether the change is present in them (see -branch-presence)
+	Presence map[string]bool `json:"presence"`
+
+	// ExcludedBy is the filter that would have excluded the change (see -explain-filters)
+	ExcludedBy string `json:"excludedBy,omitempty"`
+
+	// Collapsed are changes with the same message in other repositories (see -dedupe-by-message)
+	Collapsed []CollapsedChange `json:"collapsed,omitempty"`
+	// Duplicates are likely duplicates of the change in the same repository (see -collapse-duplicates)
+	Duplicates []CollapsedChange `json:"duplicates,omitempty"`
+	// Session are the consecutive commits of the author the change is the newest of (see -collapse-sessions)
+	Session *Session `json:"session,omitempty"`
 }
 
-type ReferencesSpec struct {
-	Tags []Tag `json:"tags"`
+func newChange(raw RawChange) Change {
+	// parsed again, the message may have been redacted
+	raw.Trailers = parseTrailers(raw.Message)
+	change := Change{
+		Message:     sanitizeMessage(raw.Message, raw.SHA, false),
+		CVEs:        formatCVEs(changeCVEs(raw), raw.CVESeverities),
+		MergedBy:    raw.MergedBy,
+		MergeMethod: raw.MergeMethod,
+		Backports:   formatBackports(raw.Backports),
+		Owners:      strings.Join(raw.Owners, "\n"),
+		Branches:    strings.Join(raw.Branches, "\n"),
+		Presence:    formatPresence(raw.Presence),
+		Duplicates:  formatDuplicates(raw.Duplicates),
+		ExcludedBy:  raw.ExcludedBy,
+		Tier:        raw.Tier,
+		Capability:  raw.Capability,
+		Source:      raw.Source,
+		Versions:    formatVersions(raw.Versions),
+		PathClass:   strings.Join(raw.PathClasses, "\n"),
+		Files:       formatFileCount(raw),
+		ShippedIn:   strings.Join(raw.ShippedIn, "\n"),
+		raw:         raw,
+	}
+	if raw.Merge {
+		change.Merge = "merge commit"
+	}
+	if raw.PullRequest > 0 {
+		change.PullRequest = fmt.Sprintf("#%d", raw.PullRequest)
+	}
+	if raw.Retests != nil {
+		change.Retests = fmt.Sprintf("%d", *raw.Retests)
+	}
+	if len(raw.Collapsed) > 0 {
+		repositories := map[string]bool{raw.Repository: true}
+		for _, c := range raw.Collapsed {
+			repositories[c.Repository] = true
+		}
+		change.Repos = fmt.Sprintf("%d repos", len(repositories))
+	}
+	change.formatDurations(formatterOrNow(nil))
+	return change
 }
 
-type Tag struct {
-	Name        string            `json:"name"`
-	Annotations map[string]string `json:"annotations"`
+// formatDurations renders the time of the change, the duration of its session and the lag of its embargo pair (in
+// the URL column, with the notes of forks and mirrors). newChange renders them relative to now, queries render them
+// again in the -duration-style, relative to the start of their collection.
+func (c *Change) formatDurations(durations Formatter) {
+	raw := c.raw
+	c.Time = durations.Ago(raw.Date)
+	if raw.PayloadOffset != nil {
+		c.Time = formatPayloadOffset(time.Duration(*raw.PayloadOffset)*time.Second, durations)
+		// changes merged after the payload was created are not in it
+		if *raw.PayloadOffset > 0 {
+			c.Time += " (NOT IN PAYLOAD)"
+		}
+	}
+	if raw.ClampedDate != nil && raw.PayloadOffset == nil {
+		c.Time = durations.Ago(*raw.ClampedDate)
+	}
+	if raw.FutureDate {
+		c.Time += " (future timestamp)"
+	}
+	if raw.OutsideWindow {
+		c.Time += " (outside window)"
+	}
+	if showAbsoluteTime {
+		c.Time += "\n" + formatTime(raw.Date)
+	}
+	if raw.Session != nil {
+		c.Message = formatSession(raw.Session, durations)
+	}
+	c.URL = raw.URL
+	if len(raw.ForkNote) > 0 {
+		c.URL += "\n" + raw.ForkNote
+	}
+	if len(raw.StitchedBranch) > 0 {
+		c.URL += "\n(history stitched with " + raw.StitchedBranch + ")"
+	}
+	if raw.FirstParentFallback {
+		c.URL += "\n(all commits, no first-parent history)"
+	}
+	if len(raw.Mirror) > 0 {
+		c.URL += "\n(listed from " + raw.Mirror + ")"
+	}
+	if raw.PrivatePair != nil {
+		c.URL += "\n" + formatEmbargoPair(*raw.PrivatePair, durations)
+	}
 }
 
-type Change struct {
-	URL     string `header:"URL"`
-	Message string `header:"Message"`
-	Time    string `header:"When"`
-
-	repository   string
-	originalTime time.Time
+// formatDurations renders the durations of the changes with the formatter of the collection.
+func formatDurations(changes []Change, durations Formatter) {
+	for i := range changes {
+		changes[i].formatDurations(durations)
+	}
 }
 
 type ProcessOptions struct {
@@ -54,6 +233,79 @@ type ProcessOptions struct {
 
 	Since      time.Duration
 	BranchName string
+
+	// PreferCanonical queries the parent repository instead of a fork referenced by the payload
+	PreferCanonical bool
+
+	// WithPullRequests finds the pull request that merged each change
+	WithPullRequests bool
+	// WithBackports searches for cherry-pick pull requests of each change pull request
+	WithBackports bool
+	// WithCodeowners attributes changes to owners from the repository CODEOWNERS file
+	WithCodeowners bool
+	// ShowVerification shows whether the signature of each change is verified, the verification is always collected
+	ShowVerification bool
+	// KeepCoauthors keeps the Co-authored-by lines of the messages, which are dropped like the signatures by default
+	KeepCoauthors bool
+	// TrailerColumns are the keys of the trailers shown as table columns (see -columns trailer:KEY)
+	TrailerColumns []string
+	// ExcludeAuthors are commit authors (eg. bots) whose changes are not shown
+	ExcludeAuthors []string
+	// AggressivePagination stops listing commits early when the remaining pages likely only contain excluded authors
+	AggressivePagination bool
+	// WithRetests counts /retest and /override commands on pull requests of (up to RetestsLimit) changes
+	WithRetests  bool
+	RetestsLimit int
+	// WithBranchPresence checks whether the changes are present in release branches
+	WithBranchPresence bool
+	// PresenceBranches are the release branches to check, the most recent ones are discovered when empty
+	PresenceBranches []string
+
+	// Compare lists commits between the given refs instead of commits in the window, keyed by repository
+	Compare map[string]CompareRange
+
+	// Cache is optional and allows to share Github responses between multiple runs
+	Cache *Cache `json:"-"`
+	// Resume is optional, it skips repositories completed by an interrupted run and records completed ones
+	Resume *resumeState `json:"-"`
+	// ClockSkew is how far the Github clock is ahead of the local one, used for the window start with TrustServerTime
+	ClockSkew       time.Duration `json:"-"`
+	TrustServerTime bool          `json:"-"`
+	// GitMirrorDir lists commits from local clones (ORG/NAME) instead of the Github API
+	GitMirrorDir string
+	GitTimeout   time.Duration `json:"-"`
+	// ClassifyPaths fetches changed files of (up to ClassifyPathsLimit) changes and classifies them by PathClasses
+	ClassifyPaths      bool
+	ClassifyPathsLimit int
+	PathClasses        []PathClass
+	// FilesFilter is the glob of -files-filter, the changes are filtered by the files fetched by ClassifyPaths
+	FilesFilter string
+	// MaxCommitsPerRepository and MaxTotalCommits cap the listed commits, capped repositories are truncated
+	MaxCommitsPerRepository int
+	MaxTotalCommits         int
+	// MinCommits extends the window of repositories with fewer changes, up to MaxLookback
+	MinCommits  int
+	MaxLookback time.Duration
+	// BranchStitching adds the commits of the old default branch (master or main) to the shallow history of a
+	// default branch renamed during the window
+	BranchStitching bool
+	// AuthFailureLimit cancels the run when more repositories in a row fail to authenticate (0 disables it)
+	AuthFailureLimit int `json:"-"`
+	// MergeCommits is whether merge commits are hidden (the default), shown or shown with the changes they merged (see
+	// -merge-commits)
+	MergeCommits string
+	// Stream leaves the changes in the order the repositories completed instead of sorting them by time
+	Stream bool `json:"-"`
+	// RepositoryAliases map repositories the token can't read to mirrors to list the commits from instead
+	RepositoryAliases map[string]string
+	// FirstParent lists only the commits reachable by the first parents of the branch head, the merge commits of
+	// pull requests merged with them instead of the commits they merged
+	FirstParent bool
+	// MessageLines drops the message bodies after that many lines at collection time, except the lines other
+	// features read (see compactMessage), 0 keeps the whole messages
+	MessageLines int
+	// Durations renders relative times and durations in the -duration-style, relative to the start of the collection
+	Durations Formatter `json:"-"`
 }
 
 func parseRepositoryOrgName(repository string) (string, string, bool) {
@@ -67,175 +319,397 @@ func parseRepositoryOrgName(repository string) (string, string, bool) {
 	return parts[0], parts[1], true
 }
 
-func getRepositoryChanges(ctx context.Context, client *github.Client, repository string, options ProcessOptions) ([]*github.RepositoryCommit, error) {
-	organization, name, ok := parseRepositoryOrgName(repository)
-	if !ok {
-		return nil, fmt.Errorf("unable to parse repository organization or name: %q", repository)
+func getRepositoryChanges(ctx context.Context, client *github.Client, organization, name string, options ProcessOptions, limit *commitLimit) ([]*github.RepositoryCommit, error) {
+	since := windowStart(time.Now(), options.Since, options.ClockSkew, options.TrustServerTime)
+	if len(options.GitMirrorDir) > 0 {
+		commits, err := listMirrorCommits(ctx, options.GitMirrorDir, organization, name, options.BranchName, since, options.GitTimeout, options.FirstParent)
+		if err != nil {
+			return nil, err
+		}
+		return limit.capListed(commits)
 	}
-
-	commits, _, err := client.Repositories.ListCommits(ctx, organization, name, &github.CommitsListOptions{
+	if commits, ok := options.Cache.getCommits(organization, name, options.BranchName, since); ok {
+		return limit.capListed(commits)
+	}
+	var stop pageFilter
+	if options.AggressivePagination {
+		stop = excludedAuthorsPageFilter(options.ExcludeAuthors, since)
+	}
+	commits, err := listAllCommits(ctx, client, organization, name, github.CommitsListOptions{
 		SHA:   options.BranchName,
-		Since: time.Now().Add(-options.Since),
+		Since: since,
 		// TODO: If you want to add Until, this is the place.
-	})
+	}, stop, limit)
+	// don't cache truncated or early stopped list, so the next run fetches it again
+	if isTruncated(err) || stop != nil {
+		return commits, err
+	}
 	if err != nil {
-		log.Printf("[%s] %v", repository, err)
-		return []*github.RepositoryCommit{}, nil
+		return nil, err
 	}
+	options.Cache.setCommits(organization, name, options.BranchName, since, commits)
 	return commits, nil
 }
 
-// this is weak, but cheap and does not require extra request to GH API
-func isMergeCommit(commit *github.Commit) bool {
-	return strings.Contains(commit.GetMessage(), "Merge pull request")
+// commitAuthor returns the Github login of the commit author, or the author email (or name) when it is not linked to an account.
+// Commits without any author information (eg. a missing commit or author in the response) are by unknownAuthor.
+func commitAuthor(c *github.RepositoryCommit) string {
+	if c == nil {
+		return unknownAuthor
+	}
+	if c.Author != nil && len(c.Author.GetLogin()) > 0 {
+		return c.Author.GetLogin()
+	}
+	if c.Commit == nil || c.Commit.Author == nil {
+		return unknownAuthor
+	}
+	if email := c.Commit.Author.GetEmail(); len(email) > 0 {
+		return email
+	}
+	if name := c.Commit.Author.GetName(); len(name) > 0 {
+		return name
+	}
+	return unknownAuthor
 }
 
-func sanitizeMessage(msg string) string {
-	lines := strings.Split(msg, "\n")
+// commitDate returns the committer date of the commit, or the author date when the committer is missing. Commits
+// without either have the zero time and are sorted last.
+func commitDate(c *github.RepositoryCommit) time.Time {
+	if c == nil || c.Commit == nil {
+		return time.Time{}
+	}
+	if c.Commit.Committer != nil && c.Commit.Committer.Date != nil {
+		return *c.Commit.Committer.Date
+	}
+	if c.Commit.Author != nil && c.Commit.Author.Date != nil {
+		return *c.Commit.Author.Date
+	}
+	return time.Time{}
+}
+
+// sanitizeMessage drops the trailers (see stripTrailers), the empty and signature lines of the message (and the
+// Co-authored-by lines, unless coauthors is set), the body lines keep their indentation and long lines are wrapped
+// by the table output (see wrapMessage). The result is never empty: the first line of the message is kept when all
+// lines are dropped, or "(no commit message)" with the short SHA.
+func sanitizeMessage(msg, sha string, coauthors bool) string {
+	lines := strings.Split(stripTrailers(msg, coauthors), "\n")
 	var r []string
 	for _, l := range lines {
 		// filter out signatures from commit messages
 		if strings.Contains(l, "Signed-off-by") || len(strings.TrimSpace(l)) == 0 {
 			continue
 		}
-		// trim the length of each line to 80 characters
-		if len(l) > 80 {
-			l = l[0:80] + " ..."
+		if !coauthors && strings.HasPrefix(strings.ToLower(strings.TrimSpace(l)), "co-authored-by:") {
+			continue
+		}
+		if len(r) == 0 {
+			l = strings.TrimSpace(l)
 		}
-		r = append(r, strings.TrimSpace(l))
+		r = append(r, strings.TrimRight(l, " \t\r"))
+	}
+	if len(r) == 0 {
+		if first := strings.TrimSpace(lines[0]); len(first) > 0 {
+			return first
+		}
+		return fmt.Sprintf("(no commit message) %s", shortSHA(sha))
 	}
 	return strings.Join(r, "\n")
 }
 
-func processRepositories(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) ([]Change, error) {
-	wp := workpool.New(options.Concurrency)
-	var changes []Change
-	var commitsLock sync.Mutex
-	var tasks []workpool.TaskHandler
-
-	for i := range repositories {
-		repository := &repositories[i]
-		tasks = append(tasks, func() error {
-			result, err := getRepositoryChanges(ctx, client, *repository, options)
-			if err != nil {
-				return err
-			}
-			var change []Change
-			for _, c := range result {
-				if isMergeCommit(c.GetCommit()) {
-					continue
-				}
-				change = append(change, Change{
-					repository:   *repository,
-					URL:          c.GetHTMLURL(),
-					Message:      sanitizeMessage(c.GetCommit().GetMessage()),
-					Time:         humanize.Time(c.GetCommit().GetCommitter().GetDate()),
-					originalTime: c.GetCommit().GetCommitter().GetDate(),
-				})
-			}
-
-			commitsLock.Lock()
-			defer commitsLock.Unlock()
-			changes = append(changes, change...)
-			return nil
-		})
+// keepCoauthors sanitizes the messages of the changes again, keeping their Co-authored-by lines.
+func keepCoauthors(changes []Change) {
+	for i := range changes {
+		changes[i].Message = sanitizeMessage(changes[i].raw.Message, changes[i].raw.SHA, true)
 	}
+}
 
-	// schedule all tasks, the work pool will take care of queuing
-	for i := range tasks {
-		wp.Do(tasks[i])
+// defaultMaxMessageLines is the default number of message lines shown in the table output
+const defaultMaxMessageLines = 5
+
+// truncateMessages truncates the messages of the changes rendered in the table output, the raw messages in the
+// other outputs are kept whole.
+func truncateMessages(changes []Change, max int) []Change {
+	if max <= 0 {
+		return changes
 	}
-	if err := wp.Wait(); err != nil {
-		return nil, err
+	truncated := make([]Change, len(changes))
+	for i, c := range changes {
+		c.Message = truncateMessage(c.Message, max, c.raw.OmittedLines)
+		truncated[i] = c
 	}
-
-	// sort by time, from oldest to latest
-	sort.Slice(changes, func(i, j int) bool {
-		return changes[j].originalTime.After(changes[i].originalTime)
-	})
-	return changes, nil
+	return truncated
 }
 
-func getRepositoriesFromPayload(payload string) ([]string, error) {
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("oc adm release info %s --commit-urls -o json", payload))
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, err
-	}
-	var release Release
-	if err := json.Unmarshal(out, &release); err != nil {
-		return nil, err
+// truncateMessage keeps the subject and the first body lines of a message longer than max lines, preferring
+// lines referencing tickets (eg. "Bug 1987654", "OCPBUGS-1234") anywhere in the body over the other lines. omitted
+// lines were already dropped from the message and count as more lines.
+func truncateMessage(msg string, max, omitted int) string {
+	lines := strings.Split(msg, "\n")
+	if max <= 0 || len(lines)+omitted <= max {
+		return msg
 	}
-	var repositories []string
-	for _, t := range release.Refs.Spec.Tags {
-		sourceLocation, ok := t.Annotations["io.openshift.build.source-location"]
-		if !ok {
-			continue
+	keep := make([]bool, len(lines))
+	keep[0] = true
+	kept := 1
+	for i := 1; i < len(lines) && kept < max; i++ {
+		if ticketReference.MatchString(lines[i]) {
+			keep[i] = true
+			kept++
 		}
-		if len(sourceLocation) == 0 {
-			continue
-		}
-		hasRepository := false
-		for _, r := range repositories {
-			if sourceLocation == r {
-				hasRepository = true
-				break
-			}
+	}
+	for i := 1; i < len(lines) && kept < max; i++ {
+		if !keep[i] {
+			keep[i] = true
+			kept++
 		}
-		if !hasRepository {
-			repositories = append(repositories, sourceLocation)
+	}
+	var r []string
+	for i, l := range lines {
+		if keep[i] {
+			r = append(r, l)
 		}
 	}
-	return repositories, nil
+	r = append(r, fmt.Sprintf("(… %d more lines)", len(lines)+omitted-kept))
+	return strings.Join(r, "\n")
 }
 
-func main() {
-	var (
-		since   string
-		branch  string
-		payload string
-	)
+// runState holds helpers shared by all repositories processed in one run.
+type runState struct {
+	backports *backportFinder
+	teams     *teamResolver
+	presence  *presenceChecker
+	retests   *retestCounter
+	paths     *pathClassifier
+	commits   *commitLimit
+}
 
-	flag.StringVar(&since, "since", "1d", "Relative time to search the commits from (eg. '1d', '48h', ...)")
-	flag.StringVar(&branch, "branch", "master", "Branch name to use for search (eg. 'release-4.6', ...)")
-	flag.StringVar(&payload, "payload", defaultPayload, "Payload URL to use to determine list of repositories")
+func newRunState(client *github.Client, options ProcessOptions) *runState {
+	state := &runState{commits: newCommitLimit(options.MaxCommitsPerRepository, options.MaxTotalCommits)}
+	if options.WithBackports {
+		state.backports = newBackportFinder(client)
+	}
+	if options.WithCodeowners {
+		state.teams = newTeamResolver(client)
+	}
+	if options.WithRetests {
+		state.retests = newRetestCounter(client, options.RetestsLimit)
+	}
+	if options.ClassifyPaths {
+		state.paths = newPathClassifier(client, options.PathClasses, options.ClassifyPathsLimit)
+	}
+	if options.WithBranchPresence {
+		state.presence = newPresenceChecker(client, options.PresenceBranches)
+	}
+	return state
+}
 
-	flag.Parse()
+// processRepository lists changes in a single repository. The returned error is specific
+// to the repository and should not fail the whole run.
+func processRepository(ctx context.Context, client *github.Client, options ProcessOptions, state *runState, repository, organization, name string) ([]Change, error) {
+	// forks can't be resolved without the Github API
+	parent, ok := options.Cache.getParent(organization, name)
+	if !ok && len(options.GitMirrorDir) == 0 {
+		var err error
+		parent, err = resolveParentRepository(ctx, client, organization, name)
+		if err != nil {
+			return nil, err
+		}
+		options.Cache.setParent(organization, name, parent)
+	}
+	var forkNote string
+	if parent != nil {
+		if options.PreferCanonical {
+			log.Printf("[%s] is a fork of %s, listing commits from the parent repository instead", repository, parent.GetFullName())
+			forkNote = fmt.Sprintf("(%s instead of fork %s/%s)", parent.GetFullName(), organization, name)
+			organization, name = parent.GetOwner().GetLogin(), parent.GetName()
+		} else {
+			forkNote = fmt.Sprintf("(fork of %s)", parent.GetFullName())
+		}
+	}
 
-	githubToken := os.Getenv("GITHUB_TOKEN")
-	if len(githubToken) == 0 {
-		log.Fatal(":-( I need you to set GITHUB_TOKEN env variable in order to be able to talk to Github")
+	var (
+		result              []*github.RepositoryCommit
+		stitchedBranch      string
+		firstParentFallback bool
+		err                 error
+	)
+	// lookback is the window of the repository, longer than Since when extended by MinCommits
+	lookback := options.Since
+	if compare, ok := options.Compare[repository]; ok {
+		result, err = getRepositoryComparison(ctx, client, organization, name, compare)
+	} else if options.FirstParent {
+		result, firstParentFallback, err = getFirstParentChanges(ctx, client, organization, name, options, state.commits)
+	} else {
+		result, err = getRepositoryChanges(ctx, client, organization, name, options, state.commits)
+		if err == nil {
+			result, stitchedBranch, err = stitchRenamedBranch(ctx, client, organization, name, options, state.commits, result)
+		}
+		if err == nil && options.MinCommits > 0 {
+			result, lookback, err = extendLookback(ctx, client, organization, name, options, state.commits, result)
+			if lookback != options.Since {
+				logVerbose("[%s] extended the window to %s to list %d changes", repository, lookback, options.MinCommits)
+			}
+		}
+	}
+	windowSince := windowStart(time.Now(), options.Since, options.ClockSkew, options.TrustServerTime)
+	// changes of truncated repositories are still reported, together with the error
+	truncated := err
+	if err != nil && !isTruncated(err) {
+		return nil, err
+	}
+	addSpanCounter(ctx, "commits", len(result))
+
+	var owners []string
+	if options.WithCodeowners {
+		ownersCtx, span := startSpan(ctx, "codeowners", nil)
+		content, err := getCodeowners(ownersCtx, client, options.Cache, organization, name, options.BranchName)
+		if err != nil && !isBudgetExhausted(err) {
+			log.Printf("[%s] unable to get CODEOWNERS: %v", repository, err)
+		}
+		owners = state.teams.Expand(ownersCtx, rootCodeowners(parseCodeowners(content)))
+		span.End()
 	}
-	client := github.NewClient(oauth2.NewClient(context.TODO(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})))
 
-	processOptions := ProcessOptions{
-		Concurrency: 10,
+	commits := map[string]*github.RepositoryCommit{}
+	for _, c := range result {
+		commits[c.GetSHA()] = c
 	}
 
-	if len(since) > 0 {
-		var err error
-		processOptions.Since, err = str2duration.ParseDuration(since)
-		if err != nil {
-			log.Fatalf(":-( I am unable to parse duration %q", since)
+	parsedPulls := parseCommitPullRequests(result)
+	var merges map[string]string
+	if options.MergeCommits == mergeCommitsCollapse {
+		merges = commitMerges(result)
+	}
+	var raws []RawChange
+	for _, c := range result {
+		merge := isMergeCommit(c)
+		if merge && options.MergeCommits != mergeCommitsShow && options.MergeCommits != mergeCommitsCollapse {
+			continue
+		}
+		raw := RawChange{
+			Repository:   repository,
+			SHA:          c.GetSHA(),
+			URL:          c.GetHTMLURL(),
+			Message:      c.GetCommit().GetMessage(),
+			Date:         commitDate(c),
+			Author:       commitAuthor(c),
+			Committer:    commitCommitter(c),
+			Verification: commitVerification(c),
+			ForkNote:     forkNote,
+			Owners:       owners,
+
+			StitchedBranch:      stitchedBranch,
+			FirstParentFallback: firstParentFallback,
+
+			ParsedPullRequest: parsedPulls[c.GetSHA()],
+
+			Merge:      merge,
+			MergedInto: merges[c.GetSHA()],
+		}
+		raw.Message, raw.OmittedLines = compactMessage(raw.Message, options.MessageLines, options.KeepCoauthors)
+		if lookback != options.Since {
+			raw.Lookback = lookback.String()
+			raw.OutsideWindow = raw.Date.Before(windowSince)
+		}
+		if options.WithPullRequests {
+			pullCtx, span := startSpan(ctx, "pr-lookup", map[string]interface{}{"sha": c.GetSHA()})
+			pull, err := getCommitPullRequest(pullCtx, client, organization, name, c.GetSHA(), options.BranchName)
+			span.End()
+			if err != nil && !isBudgetExhausted(err) {
+				log.Printf("[%s] unable to find pull request for %s: %v", repository, c.GetSHA(), err)
+			}
+			if err == nil && pull == nil {
+				raw.MergeMethod = mergeMethodDirectPush
+			}
+			if pull != nil {
+				raw.PullRequest, raw.PullRequestTitle = pull.GetNumber(), pull.GetTitle()
+				raw.MergedBy, raw.MergeMethod = pullRequestMerge(pull, c.GetSHA(), commits)
+				raw.MergedAt, raw.MergeCommit = pull.MergedAt, pull.GetMergeCommitSHA()
+				if state.retests != nil {
+					retestsCtx, span := startSpan(ctx, "retests", map[string]interface{}{"pullRequest": pull.GetNumber()})
+					retests, err := state.retests.Count(retestsCtx, organization, name, pull.GetNumber())
+					span.End()
+					if err != nil && !isBudgetExhausted(err) && err != errRetestsLimit {
+						log.Printf("[%s] unable to count retests of #%d: %v", repository, pull.GetNumber(), err)
+					}
+					if retests != nil {
+						raw.Retests, raw.Overrides = &retests.Count, retests.Overrides
+					}
+				}
+				if state.backports != nil {
+					backportsCtx, span := startSpan(ctx, "backports", map[string]interface{}{"pullRequest": pull.GetNumber()})
+					raw.Backports, err = state.backports.Find(backportsCtx, organization, name, pull.GetNumber())
+					span.End()
+					if err != nil && !isBudgetExhausted(err) {
+						log.Printf("[%s] unable to search backports for #%d: %v", repository, pull.GetNumber(), err)
+					}
+				}
+			}
 		}
+		raws = append(raws, raw)
+	}
+	if options.WithPullRequests {
+		assignBatches(raws)
 	}
-	if len(branch) > 0 {
-		processOptions.BranchName = branch
+	if state.paths != nil {
+		pathsCtx, span := startSpan(ctx, "classify-paths", nil)
+		state.paths.classifyRawChanges(pathsCtx, repository, organization, name, raws)
+		span.End()
+	}
+	if state.presence != nil {
+		presenceCtx, span := startSpan(ctx, "branch-presence", nil)
+		if err := state.presence.Check(presenceCtx, organization, name, raws); err != nil && !isBudgetExhausted(err) {
+			log.Printf("[%s] unable to check release branches presence: %v", repository, err)
+		}
+		span.End()
 	}
 
-	ctx := context.Background()
+	var changes []Change
+	for _, raw := range raws {
+		changes = append(changes, newChange(raw))
+	}
+	return changes, truncated
+}
 
-	repos, err := getRepositoriesFromPayload(payload)
+func processRepositories(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) ([]Change, []RepositoryError, error) {
+	stream, err := CollectChangesStream(ctx, client, options, repositories)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
+	return stream.collect(nil)
+}
 
-	log.Printf("Processing %d repositories for commits in %s branch, since %s ...", len(repos), processOptions.BranchName, processOptions.Since)
-	changes, err := processRepositories(ctx, client, processOptions, repos)
-	if err != nil {
+// processRepositorySafely processes the repository, a panic (eg. on an unexpected Github response) fails only
+// the repository instead of the whole run.
+func processRepositorySafely(ctx context.Context, client *github.Client, options ProcessOptions, state *runState, repository, organization, name string) (changes []Change, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logVerbose("[%s] panic: %v\n%s", repository, r, debug.Stack())
+			changes, err = nil, fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return processRepositoryOrAlternative(ctx, client, options, state, repository, organization, name)
+}
+
+// sortChanges sorts by time, from oldest to latest, changes without time are last
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		di, dj := sortDate(changes[i].raw), sortDate(changes[j].raw)
+		if di.IsZero() || dj.IsZero() {
+			return !di.IsZero() && dj.IsZero()
+		}
+		return dj.After(di)
+	})
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if exit, ok := err.(*exitError); ok {
+			if len(exit.message) > 0 {
+				log.Print(exit.message)
+			}
+			os.Exit(exit.code)
+		}
 		log.Fatal(err)
 	}
-
-	printer := tableprinter.New(os.Stdout)
-	printer.Print(changes)
 }
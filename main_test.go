@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeIncompleteGithub serves commits of openshift/api with missing commit, author and committer information.
+func fakeIncompleteGithub(t *testing.T) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/commits":
+			date := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			fmt.Fprintf(w, `[{"sha": "a1", "commit": {"message": "No committer", "author": {"name": "Alice", "date": %q}}},
+				{"sha": "b2", "author": {}, "commit": {"message": "No author", "committer": {"date": %q}}},
+				{"sha": "c3", "author": null, "commit": null},
+				{"sha": "d4"}]`, date, date)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestIncompleteCommits(t *testing.T) {
+	options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master"}
+	var changes []Change
+	var errs []RepositoryError
+	captureLog(t, func() {
+		var err error
+		changes, errs, err = processRepositories(context.Background(), fakeIncompleteGithub(t), options, []string{"https://github.com/openshift/api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(errs) != 0 || len(changes) != 4 {
+		t.Fatalf("expected all commits to be listed, got %+v: %v", changes, errs)
+	}
+	sortChanges(changes)
+	// the commit without a committer has the author date, commits without any date are last
+	if changes[0].raw.SHA != "a1" || changes[0].raw.Author != "Alice" || changes[0].raw.Date.IsZero() {
+		t.Errorf("expected the author date and name, got %+v", changes[0].raw)
+	}
+	if changes[1].raw.SHA != "b2" || changes[1].raw.Author != unknownAuthor {
+		t.Errorf("expected an unknown author, got %+v", changes[1].raw)
+	}
+	for _, c := range changes[2:] {
+		if !c.raw.Date.IsZero() || c.raw.Author != unknownAuthor {
+			t.Errorf("expected no date and an unknown author, got %+v", c.raw)
+		}
+	}
+}
+
+func TestCommitDate(t *testing.T) {
+	authored, committed := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC), time.Date(2021, 8, 20, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		commit   *github.RepositoryCommit
+		expected time.Time
+	}{
+		{name: "committer", commit: &github.RepositoryCommit{Commit: &github.Commit{Author: &github.CommitAuthor{Date: &authored}, Committer: &github.CommitAuthor{Date: &committed}}}, expected: committed},
+		{name: "author", commit: &github.RepositoryCommit{Commit: &github.Commit{Author: &github.CommitAuthor{Date: &authored}, Committer: &github.CommitAuthor{}}}, expected: authored},
+		{name: "no commit", commit: &github.RepositoryCommit{}},
+		{name: "nil", commit: nil},
+	}
+	for _, test := range tests {
+		if date := commitDate(test.commit); !date.Equal(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, date)
+		}
+	}
+}
+
+func TestProcessRepositoryPanic(t *testing.T) {
+	// openshift/api is served from the cache, processing openshift/oc without a client panics
+	cache := NewCache()
+	cache.setParent("openshift", "api", nil)
+	date := time.Now().Add(-time.Hour)
+	cache.setCommits("openshift", "api", "master", time.Time{}, []*github.RepositoryCommit{
+		{SHA: github.String("a1"), Commit: &github.Commit{Message: github.String("Bump the API"), Committer: &github.CommitAuthor{Date: &date}}},
+	})
+	options := ProcessOptions{Concurrency: 2, Since: 24 * time.Hour, BranchName: "master", Cache: cache}
+
+	defer func(v bool) { verbose = v }(verbose)
+	verbose = true
+	var changes []Change
+	var errs []RepositoryError
+	output := captureLog(t, func() {
+		var err error
+		changes, errs, err = processRepositories(context.Background(), nil, options, []string{"https://github.com/openshift/api", "https://github.com/openshift/oc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(changes) != 1 || changes[0].raw.Message != "Bump the API" {
+		t.Errorf("expected the other repository to complete, got %+v", changes)
+	}
+	if len(errs) != 1 || errs[0].Repository != "https://github.com/openshift/oc" || errs[0].Kind != ErrorKindInternal || !errors.Is(errs[0], ErrPanic) {
+		t.Fatalf("expected an internal error of the repository, got %+v", errs)
+	}
+	if !strings.Contains(output, "[https://github.com/openshift/oc] panic: ") || !strings.Contains(output, "goroutine ") {
+		t.Errorf("expected the stack trace with -v, got:\n%s", output)
+	}
+	summary := captureLog(t, func() { printErrorSummary(errs) })
+	if !strings.Contains(summary, "internal error: this is a bug") {
+		t.Errorf("expected the internal error hint, got:\n%s", summary)
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	body := func(lines int) []string {
+		var r []string
+		for i := 1; i <= lines; i++ {
+			r = append(r, fmt.Sprintf("line %d", i))
+		}
+		return r
+	}
+	ticket := body(45)
+	ticket[39] = "Fixes OCPBUGS-1234"
+	tests := []struct {
+		name     string
+		lines    []string
+		expected []string
+	}{
+		{name: "shorter", lines: body(3), expected: body(3)},
+		{name: "at the limit", lines: body(5), expected: body(5)},
+		{name: "longer", lines: body(8), expected: append(body(5), "(… 3 more lines)")},
+		{name: "ticket at line 40", lines: ticket, expected: []string{"line 1", "line 2", "line 3", "line 4", "Fixes OCPBUGS-1234", "(… 40 more lines)"}},
+	}
+	for _, test := range tests {
+		if truncated := truncateMessage(strings.Join(test.lines, "\n"), 5, 0); truncated != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", test.name, strings.Join(test.expected, "\n"), truncated)
+		}
+	}
+	if truncated := truncateMessage(strings.Join(body(8), "\n"), 0, 0); truncated != strings.Join(body(8), "\n") {
+		t.Errorf("expected no limit, got:\n%s", truncated)
+	}
+
+	// long ticket reference lines are not cut by the sanitization
+	reference := "Bug 1987654: " + strings.Repeat("the operator degrades ", 5)
+	if sanitized := sanitizeMessage("Fix the operator\n"+reference, "a1", false); !strings.HasSuffix(sanitized, strings.TrimSpace(reference)) {
+		t.Errorf("expected the whole ticket reference, got %q", sanitized)
+	}
+}
+
+func TestRenderTruncatedMessages(t *testing.T) {
+	message := strings.Join([]string{"Revert the bump", "1", "2", "3", "4", "5", "6", "7"}, "\n")
+	render := func(format string) string {
+		o := &queryOptions{maxMessageLines: 3}
+		result := &queryResult{Changes: []Change{newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a1", Message: message, Date: time.Now()})}}
+		var out strings.Builder
+		captureLog(t, func() {
+			if err := o.render(&out, format, result); err != nil {
+				t.Fatal(err)
+			}
+		})
+		return out.String()
+	}
+	if table := render(formatTable); !strings.Contains(table, "(… 5 more lines)") {
+		t.Errorf("expected the message to be truncated in the table, got:\n%s", table)
+	}
+	if report := render(formatJSON); !strings.Contains(report, `"message": "Revert the bump\n1\n2\n3\n4\n5\n6\n7"`) {
+		t.Errorf("expected the full message in the JSON output, got:\n%s", report)
+	}
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		coauthors bool
+		expected  string
+	}{
+		{name: "subject", message: "  Bump the API  \n", expected: "Bump the API"},
+		{name: "signature", message: "Bump the API\n\nSigned-off-by: Jane Doe <jane@example.com>", expected: "Bump the API"},
+		{name: "only a signature", message: "Signed-off-by: Jane Doe <jane@example.com>", expected: "Signed-off-by: Jane Doe <jane@example.com>"},
+		{name: "signature and whitespace", message: "\n  \nSigned-off-by: Jane Doe <jane@example.com>\n\t\n", expected: "(no commit message) 0123456"},
+		{name: "empty", message: "", expected: "(no commit message) 0123456"},
+		{name: "indented body", message: "Bump the API\n\nChanges:\n  - add a field\n    func Foo() {}\n\t\tindented by tabs  ", expected: "Bump the API\nChanges:\n  - add a field\n    func Foo() {}\n\t\tindented by tabs"},
+		{name: "co-authors", message: "Bump the API\n\nCo-authored-by: Jane Doe <jane@example.com>\n  co-authored-by: John Doe <john@example.com>", expected: "Bump the API"},
+		{name: "kept co-authors", message: "Bump the API\n\nCo-authored-by: Jane Doe <jane@example.com>\nSigned-off-by: John Doe <john@example.com>", coauthors: true, expected: "Bump the API\nCo-authored-by: Jane Doe <jane@example.com>"},
+		{name: "only co-authors", message: "Co-authored-by: Jane Doe <jane@example.com>", expected: "Co-authored-by: Jane Doe <jane@example.com>"},
+		{name: "long line", message: "Bump the API\n" + strings.Repeat("x", 90), expected: "Bump the API\n" + strings.Repeat("x", 90)},
+	}
+	for _, test := range tests {
+		if sanitized := sanitizeMessage(test.message, "0123456789abcdef", test.coauthors); sanitized != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, sanitized)
+		}
+	}
+}
+
+func TestRenderKeepCoauthors(t *testing.T) {
+	message := "Bump the API\n\nCo-authored-by: Jane Doe <jane@example.com>"
+	for _, keep := range []bool{false, true} {
+		o := &queryOptions{keepCoauthors: keep}
+		options, err := o.processOptions(&sharedOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &queryResult{Options: options, Changes: []Change{newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a1", Message: message, Date: time.Now()})}}
+		var out strings.Builder
+		captureLog(t, func() {
+			if err := o.render(&out, formatTable, result); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if kept := strings.Contains(out.String(), "Co-authored-by: Jane Doe"); kept != keep {
+			t.Errorf("-keep-coauthors %v: unexpected table:\n%s", keep, out.String())
+		}
+	}
+}
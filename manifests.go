@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// imageReferencesFile is the image stream of the payload images in the release-manifests directory
+	imageReferencesFile = "image-references"
+	// releaseMetadataFile holds the version of the payload in the release-manifests directory
+	releaseMetadataFile = "release-metadata"
+)
+
+// readReleaseManifestsDir reads the payload from the release-manifests directory extracted from the release image,
+// the image-references are the references of "oc adm release info -o json" and release-metadata is its metadata.
+// The image-references are JSON, or YAML in some releases.
+func readReleaseManifestsDir(dir string) (*Release, error) {
+	path := filepath.Join(dir, imageReferencesFile)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s does not exist, is %s an extracted release-manifests directory?", path, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var release Release
+	if err := unmarshalJSONOrYAML(content, &release.Refs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if release.Refs.Kind != "ImageStream" || len(release.Refs.Spec.Tags) == 0 {
+		return nil, fmt.Errorf("%s: not an image-references document, expected an ImageStream with tags (kind %q, %d tags)", path, release.Refs.Kind, len(release.Refs.Spec.Tags))
+	}
+	if created := release.Refs.Metadata.CreationTimestamp; len(created) > 0 {
+		if release.Config.Created, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, fmt.Errorf("%s: invalid creationTimestamp %q: %v", path, created, err)
+		}
+	}
+
+	path = filepath.Join(dir, releaseMetadataFile)
+	content, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		logVerbose("%s does not exist, the payload version is not known", path)
+		return &release, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &release.Metadata); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &release, nil
+}
+
+// unmarshalJSONOrYAML decodes the YAML (or JSON, which is YAML too) document using the JSON field names.
+func unmarshalJSONOrYAML(content []byte, v interface{}) error {
+	err := json.Unmarshal(content, v)
+	if err == nil || bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		return err
+	}
+	var document interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(converted, v)
+}
+
+// ReleaseLabel identifies the payload read from a file, where the -payload pullspec does not apply.
+type ReleaseLabel struct {
+	Source  string     `json:"source"`
+	Version string     `json:"version,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+func newReleaseLabel(source string, release *Release) *ReleaseLabel {
+	label := &ReleaseLabel{Source: source, Version: release.Metadata.Version}
+	if !release.Config.Created.IsZero() {
+		created := release.Config.Created
+		label.Created = &created
+	}
+	return label
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReleaseManifestsDir(t *testing.T) {
+	created := time.Date(2021, 8, 18, 9, 55, 0, 0, time.UTC)
+	tests := []struct {
+		dir          string
+		repositories []string
+		version      string
+		created      time.Time
+		expectedErr  string
+	}{
+		{
+			dir:          "4.9",
+			repositories: []string{"https://github.com/openshift/oc", "https://github.com/openshift/api"},
+			version:      "4.9.0-fc.0",
+			created:      created,
+		},
+		{
+			// older releases have YAML image-references and no release-metadata
+			dir:          "4.1",
+			repositories: []string{"https://github.com/openshift/oc", "https://github.com/openshift/console"},
+		},
+		{
+			dir:         "corrupted",
+			expectedErr: filepath.Join("testdata", "release-manifests", "corrupted", "image-references") + ": unexpected end of JSON input",
+		},
+		{
+			dir:         "not-image-references",
+			expectedErr: `not an image-references document, expected an ImageStream with tags (kind "ConfigMap", 0 tags)`,
+		},
+		{
+			dir:         "missing",
+			expectedErr: "is testdata/release-manifests/missing an extracted release-manifests directory?",
+		},
+	}
+	for _, test := range tests {
+		release, err := readReleaseManifestsDir(filepath.Join("testdata", "release-manifests", test.dir))
+		if len(test.expectedErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("%s: expected an error containing %q, got %v", test.dir, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.dir, err)
+			continue
+		}
+		if repositories, _ := getRepositoriesFromRelease(release, defaultSourceAnnotations); !reflect.DeepEqual(repositories, test.repositories) {
+			t.Errorf("%s: expected %v, got %v", test.dir, test.repositories, repositories)
+		}
+		if release.Metadata.Version != test.version || !release.Config.Created.Equal(test.created) {
+			t.Errorf("%s: expected version %q created %s, got %+v", test.dir, test.version, test.created, release.Metadata)
+		}
+	}
+}
+
+func TestReleaseManifestsDirQuery(t *testing.T) {
+	o := &queryOptions{manifestsDir: filepath.Join("testdata", "release-manifests", "4.9"), releaseInfoFile: "release.json"}
+	if err := o.validate(); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected both payload files to be rejected, got %v", err)
+	}
+	o.releaseInfoFile = ""
+	repositories, err := o.repositories(defaultSourceAnnotations, NewCache())
+	if err != nil || len(repositories) != 2 {
+		t.Fatalf("expected the repositories of the directory, got %v: %v", repositories, err)
+	}
+	label, err := o.releaseLabel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label.Source != o.manifestsDir || label.Version != "4.9.0-fc.0" || label.Created == nil || !label.Created.Equal(time.Date(2021, 8, 18, 9, 55, 0, 0, time.UTC)) {
+		t.Errorf("unexpected label %+v", label)
+	}
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Payload: label.Version, Release: label}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"version": "4.9.0-fc.0"`) || !strings.Contains(report, `"created": "2021-08-18T09:55:00Z"`) {
+		t.Errorf("expected the release in the metadata, got:\n%s", report)
+	}
+
+	// the creation time is not known without creationTimestamp
+	o = &queryOptions{manifestsDir: filepath.Join("testdata", "release-manifests", "4.1")}
+	if _, err := o.payloadCreated(o.payload); err == nil || !strings.Contains(err.Error(), "does not record the payload creation time") {
+		t.Errorf("expected the missing creation time, got %v", err)
+	}
+	if label, err := o.releaseLabel(); err != nil || len(label.Version) > 0 || label.Created != nil {
+		t.Errorf("expected a label without version, got %+v: %v", label, err)
+	}
+	if label, err := (&queryOptions{}).releaseLabel(); label != nil || err != nil {
+		t.Errorf("expected no label of payloads read by oc, got %+v: %v", label, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Handling of merge commits (see -merge-commits)
+const (
+	mergeCommitsHide     = "hide"
+	mergeCommitsShow     = "show"
+	mergeCommitsCollapse = "collapse"
+)
+
+func validateMergeCommits(mode string) error {
+	switch mode {
+	case "", mergeCommitsHide, mergeCommitsShow, mergeCommitsCollapse:
+		return nil
+	default:
+		return fmt.Errorf("unknown -merge-commits %q, use %s, %s or %s", mode, mergeCommitsHide, mergeCommitsShow, mergeCommitsCollapse)
+	}
+}
+
+// isMergeCommit reports whether the commit has more parents, commits without known parents (eg. listed from a git
+// mirror) are merge commits when their message is the one of merged pull requests.
+func isMergeCommit(c *github.RepositoryCommit) bool {
+	if len(c.Parents) > 0 {
+		return len(c.Parents) > 1
+	}
+	return strings.Contains(c.GetCommit().GetMessage(), "Merge pull request")
+}
+
+// mainlineCommits returns the listed commits reachable by the first parents of the newest one, the commits are
+// listed from the newest.
+func mainlineCommits(commits []*github.RepositoryCommit, bySHA map[string]*github.RepositoryCommit) map[string]bool {
+	mainline := map[string]bool{}
+	if len(commits) == 0 {
+		return mainline
+	}
+	for c := commits[0]; c != nil && !mainline[c.GetSHA()]; {
+		mainline[c.GetSHA()] = true
+		if len(c.Parents) == 0 {
+			break
+		}
+		c = bySHA[c.Parents[0].GetSHA()]
+	}
+	return mainline
+}
+
+// commitMerges returns the mainline merge commit of each listed commit it merged: the commits reachable from the
+// other parents of the merge commit (all of them for octopus merges) until the mainline.
+func commitMerges(commits []*github.RepositoryCommit) map[string]string {
+	bySHA := map[string]*github.RepositoryCommit{}
+	for _, c := range commits {
+		bySHA[c.GetSHA()] = c
+	}
+	mainline := mainlineCommits(commits, bySHA)
+	merges := map[string]string{}
+	for _, c := range commits {
+		if !mainline[c.GetSHA()] || len(c.Parents) < 2 {
+			continue
+		}
+		var pending []string
+		for _, p := range c.Parents[1:] {
+			pending = append(pending, p.GetSHA())
+		}
+		for len(pending) > 0 {
+			sha := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			parent, listed := bySHA[sha]
+			if _, merged := merges[sha]; !listed || mainline[sha] || merged {
+				continue
+			}
+			merges[sha] = c.GetSHA()
+			for _, p := range parent.Parents {
+				pending = append(pending, p.GetSHA())
+			}
+		}
+	}
+	return merges
+}
+
+// mergeSection is a merge commit with the changes it merged.
+type mergeSection struct {
+	Merge   Change
+	Changes []Change
+}
+
+// mergeSections returns the listed merge commits that merged listed changes, each with them (see -merge-commits
+// collapse), and the other changes.
+func mergeSections(changes []Change) ([]mergeSection, []Change) {
+	listed := map[string]bool{}
+	for _, c := range changes {
+		if c.raw.Merge {
+			listed[c.raw.Repository+"@"+c.raw.SHA] = true
+		}
+	}
+	merged := map[string][]Change{}
+	var others []Change
+	for _, c := range changes {
+		if key := c.raw.Repository + "@" + c.raw.MergedInto; len(c.raw.MergedInto) > 0 && listed[key] {
+			merged[key] = append(merged[key], c)
+		}
+	}
+	var sections []mergeSection
+	for _, c := range changes {
+		key := c.raw.Repository + "@" + c.raw.SHA
+		switch {
+		case c.raw.Merge && len(merged[key]) > 0:
+			sections = append(sections, mergeSection{Merge: c, Changes: merged[key]})
+		case len(c.raw.MergedInto) == 0 || !listed[c.raw.Repository+"@"+c.raw.MergedInto]:
+			others = append(others, c)
+		}
+	}
+	return sections, others
+}
+
+// printChangesByMerge prints each merge commit followed by the changes it merged (see -merge-commits collapse),
+// the other changes last.
+func printChangesByMerge(w io.Writer, changes []Change, wrap MessageWrap, trailers []string) {
+	sections, others := mergeSections(changes)
+	if len(sections) == 0 {
+		printChanges(w, others, wrap, trailers)
+		return
+	}
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		merge := section.Merge.raw
+		fmt.Fprintf(w, "%s merge %s at %s: %s\n", repositoryName(merge.Repository), shortSHA(merge.SHA), formatTime(merge.Date), commitSubject(merge.Message))
+		printChanges(w, section.Changes, wrap, trailers)
+	}
+	if len(others) > 0 {
+		fmt.Fprintf(w, "\nNot merged by a listed merge commit:\n")
+		printChanges(w, others, wrap, trailers)
+	}
+}
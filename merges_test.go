@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// testCommit returns a listed commit with the message and parents.
+func testCommit(sha, message string, parents ...string) *github.RepositoryCommit {
+	c := &github.RepositoryCommit{SHA: github.String(sha), Commit: &github.Commit{Message: github.String(message)}}
+	for _, p := range parents {
+		c.Parents = append(c.Parents, github.Commit{SHA: github.String(p)})
+	}
+	return c
+}
+
+func TestIsMergeCommit(t *testing.T) {
+	tests := []struct {
+		name     string
+		commit   *github.RepositoryCommit
+		expected bool
+	}{
+		{name: "single parent", commit: testCommit("a", "Fix the build", "p1")},
+		{name: "merge", commit: testCommit("a", "Merge branch 'fix'", "p1", "p2"), expected: true},
+		{name: "octopus", commit: testCommit("a", "Merge branches 'a', 'b' and 'c'", "p1", "p2", "p3"), expected: true},
+		// the message does not make a commit with a single parent a merge commit
+		{name: "squashed with the merge message", commit: testCommit("a", "Merge pull request #12 from soltysh/fix", "p1")},
+		{name: "unknown parents", commit: testCommit("a", "Merge pull request #12 from soltysh/fix"), expected: true},
+		{name: "unknown parents without the message", commit: testCommit("a", "Fix the build (#12)")},
+	}
+	for _, test := range tests {
+		if merge := isMergeCommit(test.commit); merge != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, merge)
+		}
+	}
+}
+
+func TestCommitMerges(t *testing.T) {
+	tests := []struct {
+		name     string
+		commits  []*github.RepositoryCommit
+		expected map[string]string
+	}{
+		{
+			name: "octopus",
+			commits: []*github.RepositoryCommit{
+				testCommit("m2", "Merge branches 'a', 'b'", "m1", "a2", "b1"),
+				testCommit("a2", "Second of a", "a1"),
+				testCommit("a1", "First of a", "base"),
+				testCommit("b1", "Only of b", "base"),
+				testCommit("m1", "Merge pull request #12 from soltysh/c", "base", "c1"),
+				testCommit("c1", "Only of c", "base"),
+				testCommit("base", "Before the window", "older"),
+			},
+			expected: map[string]string{"a2": "m2", "a1": "m2", "b1": "m2", "c1": "m1"},
+		},
+		{
+			name: "squash merged",
+			commits: []*github.RepositoryCommit{
+				testCommit("s2", "Fix the login (#13)", "s1"),
+				testCommit("s1", "Fix the build (#12)", "base"),
+			},
+			expected: map[string]string{},
+		},
+		{
+			name:     "empty",
+			expected: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		if merges := commitMerges(test.commits); !reflect.DeepEqual(merges, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, merges)
+		}
+	}
+}
+
+func TestValidateMergeCommits(t *testing.T) {
+	for _, mode := range []string{mergeCommitsHide, mergeCommitsShow, mergeCommitsCollapse} {
+		if err := validateMergeCommits(mode); err != nil {
+			t.Errorf("%s: unexpected error %v", mode, err)
+		}
+	}
+	if err := validateMergeCommits("squash"); err == nil || !strings.Contains(err.Error(), `unknown -merge-commits "squash"`) {
+		t.Errorf("expected an unknown mode to fail, got %v", err)
+	}
+	o := &queryOptions{mergeCommits: mergeCommitsCollapse, groupByBatch: true}
+	if _, err := o.processOptions(&sharedOptions{}); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected collapse with -group-by-batch to fail, got %v", err)
+	}
+}
+
+func TestPrintChangesByMerge(t *testing.T) {
+	oc := "https://github.com/openshift/oc"
+	changes := []Change{
+		newChange(RawChange{Repository: oc, SHA: "c1c1c1c1", Message: "Fix oc login", MergedInto: "m1m1m1m1"}),
+		newChange(RawChange{Repository: oc, SHA: "m1m1m1m1", Message: "Merge pull request #12 from soltysh/login", Merge: true}),
+		newChange(RawChange{Repository: oc, SHA: "d1d1d1d1", Message: "Fix oc logout"}),
+		// the merge commit was filtered out
+		newChange(RawChange{Repository: oc, SHA: "e1e1e1e1", Message: "Fix oc whoami", MergedInto: "m2m2m2m2"}),
+	}
+	sections, others := mergeSections(changes)
+	if len(sections) != 1 || sections[0].Merge.raw.SHA != "m1m1m1m1" || len(sections[0].Changes) != 1 || len(others) != 2 {
+		t.Fatalf("unexpected sections %+v and other changes %+v", sections, others)
+	}
+
+	var out bytes.Buffer
+	printChangesByMerge(&out, changes, MessageWrap{Width: 200}, nil)
+	table := out.String()
+	merge, login := strings.Index(table, "merge m1m1m1m"), strings.Index(table, "Fix oc login")
+	notMerged := strings.Index(table, "Not merged by a listed merge commit:")
+	if merge < 0 || login < merge || notMerged < login || !strings.Contains(table[notMerged:], "Fix oc whoami") {
+		t.Errorf("expected the merged change beneath its merge commit, got:\n%s", table)
+	}
+
+	out.Reset()
+	if err := writeHTMLReport(&out, Report{Changes: changes, GroupByMerge: true}); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if merge, merged := strings.Index(page, `<tr class="merge">`), strings.Index(page, `<tr class="merged">`); merge < 0 || merged < merge || !strings.Contains(page[merged:], "Fix oc login") {
+		t.Errorf("expected the merged change nested beneath its merge commit, got:\n%s", page)
+	}
+}
+
+func TestCollectMergeCommits(t *testing.T) {
+	for mode, expected := range map[string]map[string]string{
+		mergeCommitsHide:     {"b0b0b0b": "", "c2c2c2c": "", "c4c4c4c": "", "c3c3c3c": ""},
+		mergeCommitsShow:     {"b0b0b0b": "", "c2c2c2c": "", "e1e1e1e": "merge", "c4c4c4c": "", "c3c3c3c": "", "f1f1f1f": "merge"},
+		mergeCommitsCollapse: {"b0b0b0b": "", "c2c2c2c": "e1e1e1e", "e1e1e1e": "merge", "c4c4c4c": "f1f1f1f", "c3c3c3c": "f1f1f1f", "f1f1f1f": "merge"},
+	} {
+		out, _, err := runScenario(t, "merges", "-merge-commits", mode)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		found := map[string]string{}
+		for _, c := range out.Changes {
+			found[shortSHA(c.SHA)] = shortSHA(c.MergedInto)
+			if c.Merge {
+				found[shortSHA(c.SHA)] = "merge"
+			}
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("%s: expected %v, got %v", mode, expected, found)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Strategies of -multi-sha for repositories the payload images were built from at several commits
+const (
+	multiSHAPerTag = "per-tag"
+	multiSHANewest = "newest"
+)
+
+// validateMultiSHA checks the -multi-sha strategy, empty is per-tag.
+func validateMultiSHA(mode string) error {
+	switch mode {
+	case "", multiSHAPerTag, multiSHANewest:
+		return nil
+	default:
+		return fmt.Errorf("unknown -multi-sha %q, use %s or %s", mode, multiSHAPerTag, multiSHANewest)
+	}
+}
+
+// PayloadCommit is a commit of a repository the payload images (tags) were built from.
+type PayloadCommit struct {
+	Commit string   `json:"commit"`
+	Tags   []string `json:"tags"`
+}
+
+// RepositoryCommits returns the distinct commits each repository was built from, in the order of the tags.
+// Repositories of multi-image builds may be built at different commits (eg. tags rebuilt at different times).
+func (r *Release) RepositoryCommits(sourceAnnotations []string) map[string][]PayloadCommit {
+	commits := map[string][]PayloadCommit{}
+	for _, t := range r.Refs.Spec.Tags {
+		repository, commit, _, ok := t.Source(sourceAnnotations)
+		if !ok || len(commit) == 0 {
+			continue
+		}
+		found := false
+		for i := range commits[repository] {
+			if commits[repository][i].Commit == commit {
+				commits[repository][i].Tags = append(commits[repository][i].Tags, t.Name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			commits[repository] = append(commits[repository], PayloadCommit{Commit: commit, Tags: []string{t.Name}})
+		}
+	}
+	return commits
+}
+
+// logMultipleCommits logs the repositories the payload images were built from at several commits.
+func logMultipleCommits(commits map[string][]PayloadCommit) {
+	var repositories []string
+	for repository, c := range commits {
+		if len(c) > 1 {
+			repositories = append(repositories, repository)
+		}
+	}
+	sort.Strings(repositories)
+	for _, repository := range repositories {
+		var built []string
+		for _, c := range commits[repository] {
+			built = append(built, fmt.Sprintf("%s (%s)", shortSHA(c.Commit), strings.Join(c.Tags, ", ")))
+		}
+		log.Printf("[%s] payload images were built from %d commits: %s", repository, len(commits[repository]), strings.Join(built, ", "))
+	}
+}
+
+// payloadCommitOrder is the history of the commits a repository was built from.
+type payloadCommitOrder struct {
+	Oldest PayloadCommit
+	Newest PayloadCommit
+	// Shipped maps the commits after the oldest one to the tags built from a commit containing them
+	Shipped map[string][]string
+}
+
+// orderPayloadCommits compares the commits of a repository: the oldest is the one the others are ahead of, the
+// newest the one the most commits ahead of it. Commits that diverged count by how many commits they are ahead.
+func orderPayloadCommits(ctx context.Context, client *github.Client, organization, name string, commits []PayloadCommit) (payloadCommitOrder, error) {
+	order := payloadCommitOrder{Oldest: commits[0], Newest: commits[0], Shipped: map[string][]string{}}
+	for _, c := range commits[1:] {
+		comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, order.Oldest.Commit, c.Commit)
+		if err != nil {
+			return order, err
+		}
+		if comparison.GetStatus() == "behind" {
+			order.Oldest = c
+		}
+	}
+	newestAhead := 0
+	for _, c := range commits {
+		if c.Commit == order.Oldest.Commit {
+			continue
+		}
+		comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, order.Oldest.Commit, c.Commit)
+		if err != nil {
+			return order, err
+		}
+		if comparison.GetAheadBy() > newestAhead {
+			order.Newest, newestAhead = c, comparison.GetAheadBy()
+		}
+		for _, shipped := range comparison.Commits {
+			order.Shipped[shipped.GetSHA()] = append(order.Shipped[shipped.GetSHA()], c.Tags...)
+		}
+	}
+	if newestAhead == 0 {
+		order.Newest = order.Oldest
+	}
+	return order, nil
+}
+
+// resolvePayloadCommits returns the commit changes of each repository are listed since (see -since-payload). The
+// changes of repositories built from several commits are listed since the newest one, or since the oldest one
+// with per-tag, the returned tags then record which changes the other tags were already built with.
+func resolvePayloadCommits(ctx context.Context, client *github.Client, commits map[string][]PayloadCommit, mode string) (map[string]string, map[string]map[string][]string) {
+	resolved := map[string]string{}
+	shipped := map[string]map[string][]string{}
+	for repository, c := range commits {
+		resolved[repository] = c[0].Commit
+		if len(c) < 2 {
+			continue
+		}
+		organization, name, ok := parseRepositoryOrgName(repository)
+		if !ok || client == nil {
+			log.Printf("WARNING: [%s] is built from %d commits, listing changes since %s of %s", repository, len(c), shortSHA(c[0].Commit), strings.Join(c[0].Tags, ", "))
+			continue
+		}
+		order, err := orderPayloadCommits(ctx, client, organization, name, c)
+		if err != nil {
+			log.Printf("WARNING: [%s] unable to compare its %d payload commits, listing changes since %s of %s: %v", repository, len(c), shortSHA(c[0].Commit), strings.Join(c[0].Tags, ", "), err)
+			continue
+		}
+		if mode == multiSHANewest {
+			resolved[repository] = order.Newest.Commit
+			log.Printf("[%s] is built from %d commits, listing changes since the newest %s of %s", repository, len(c), shortSHA(order.Newest.Commit), strings.Join(order.Newest.Tags, ", "))
+			continue
+		}
+		resolved[repository] = order.Oldest.Commit
+		shipped[repository] = order.Shipped
+		log.Printf("[%s] is built from %d commits, listing changes since the oldest %s of %s with the tags already built with them", repository, len(c), shortSHA(order.Oldest.Commit), strings.Join(order.Oldest.Tags, ", "))
+	}
+	return resolved, shipped
+}
+
+// annotateShippedTags sets the payload tags already built with each change (see -multi-sha per-tag).
+func annotateShippedTags(changes []Change, shipped map[string]map[string][]string) []Change {
+	if len(shipped) == 0 {
+		return changes
+	}
+	for i, c := range changes {
+		tags := shipped[c.raw.Repository][c.raw.SHA]
+		if len(tags) == 0 {
+			continue
+		}
+		raw := c.raw
+		raw.ShippedIn = tags
+		changes[i] = newChange(raw)
+	}
+	return changes
+}
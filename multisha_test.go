@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// oldestOC and newestOC are the commits openshift/oc is built from in testdata/release/multi-sha.json
+	oldestOC = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	newestOC = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// multiSHAGithub serves the comparisons of the openshift/oc commits: the newest commit is 2 commits ahead of the
+// oldest one, the master branch is 1 commit ahead of the newest one.
+func multiSHAGithub(t *testing.T) (*fakeGithub, *github.Client) {
+	compare := func(base, head, status string, ahead int, commits ...string) fakeRoute {
+		var listed []string
+		for _, c := range commits {
+			listed = append(listed, fmt.Sprintf(`{"sha": %q, "commit": {"message": "Change %s", "committer": {"date": "2021-08-24T10:00:00Z"}}}`, c, c))
+		}
+		return fakeRoute{
+			Method: http.MethodGet,
+			Path:   fmt.Sprintf("/repos/openshift/oc/compare/%s...%s", base, head),
+			Body:   json.RawMessage(fmt.Sprintf(`{"status": %q, "ahead_by": %d, "commits": [%s]}`, status, ahead, strings.Join(listed, ", "))),
+		}
+	}
+	fake := newFakeGithub(t, []fakeRoute{
+		compare(newestOC, oldestOC, "behind", 0),
+		compare(oldestOC, newestOC, "ahead", 2, "dddddddd", newestOC),
+		compare(oldestOC, "master", "ahead", 3, "dddddddd", newestOC, "eeeeeeee"),
+		compare(newestOC, "master", "ahead", 1, "eeeeeeee"),
+	})
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(fake.URL + "/")
+	return fake, client
+}
+
+func TestRepositoryCommits(t *testing.T) {
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	commits := readReleaseFixture(t, "multi-sha.json").RepositoryCommits(defaultSourceAnnotations)
+	expected := map[string][]PayloadCommit{
+		oc:  {{Commit: newestOC, Tags: []string{"cli", "tools"}}, {Commit: oldestOC, Tags: []string{"cli-artifacts"}}},
+		api: {{Commit: "cccccccccccccccccccccccccccccccccccccccc", Tags: []string{"cluster-config-api"}}},
+	}
+	if !reflect.DeepEqual(commits, expected) {
+		t.Errorf("expected %+v, got %+v", expected, commits)
+	}
+	output := captureLog(t, func() { logMultipleCommits(commits) })
+	if !strings.Contains(output, "[https://github.com/openshift/oc] payload images were built from 2 commits: bbbbbbb (cli, tools), aaaaaaa (cli-artifacts)") || strings.Contains(output, api) {
+		t.Errorf("expected only openshift/oc logged, got:\n%s", output)
+	}
+
+	if err := (&queryOptions{multiSHA: "oldest"}).validate(); err == nil || !strings.Contains(err.Error(), `unknown -multi-sha "oldest"`) {
+		t.Errorf("expected an unknown strategy to fail, got %v", err)
+	}
+}
+
+func TestResolvePayloadCommits(t *testing.T) {
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	commits := readReleaseFixture(t, "multi-sha.json").RepositoryCommits(defaultSourceAnnotations)
+	_, client := multiSHAGithub(t)
+
+	var (
+		resolved map[string]string
+		shipped  map[string]map[string][]string
+	)
+	captureLog(t, func() {
+		resolved, shipped = resolvePayloadCommits(context.Background(), client, commits, multiSHAPerTag)
+	})
+	if resolved[oc] != oldestOC || resolved[api] != "cccccccccccccccccccccccccccccccccccccccc" {
+		t.Errorf("expected openshift/oc listed since the oldest commit, got %v", resolved)
+	}
+	if expected := map[string][]string{"dddddddd": {"cli", "tools"}, newestOC: {"cli", "tools"}}; !reflect.DeepEqual(shipped[oc], expected) {
+		t.Errorf("expected the changes the newest tags were built with, got %v", shipped[oc])
+	}
+	changes := annotateShippedTags([]Change{
+		newChange(RawChange{Repository: oc, SHA: "dddddddd"}),
+		newChange(RawChange{Repository: oc, SHA: "eeeeeeee"}),
+	}, shipped)
+	if changes[0].ShippedIn != "cli\ntools" || changes[1].ShippedIn != "" || !reflect.DeepEqual(changes[0].raw.ShippedIn, []string{"cli", "tools"}) {
+		t.Errorf("expected only the change built with the newest commit shipped, got %+v", changes)
+	}
+
+	output := captureLog(t, func() {
+		resolved, shipped = resolvePayloadCommits(context.Background(), client, commits, multiSHANewest)
+	})
+	if resolved[oc] != newestOC || len(shipped) != 0 {
+		t.Errorf("expected openshift/oc listed since the newest commit, got %v and %v", resolved, shipped)
+	}
+	if !strings.Contains(output, "[https://github.com/openshift/oc] is built from 2 commits, listing changes since the newest bbbbbbb of cli, tools") {
+		t.Errorf("expected the newest commit noted, got:\n%s", output)
+	}
+
+	// without the comparisons the first commit of the tags is used
+	output = captureLog(t, func() { resolved, _ = resolvePayloadCommits(context.Background(), nil, commits, multiSHAPerTag) })
+	if resolved[oc] != newestOC || !strings.Contains(output, "WARNING: [https://github.com/openshift/oc] is built from 2 commits") {
+		t.Errorf("expected a warning and the first commit, got %v:\n%s", resolved, output)
+	}
+}
+
+func TestPendingMultiSHA(t *testing.T) {
+	oc := "https://github.com/openshift/oc"
+	commits := readReleaseFixture(t, "multi-sha.json").RepositoryCommits(defaultSourceAnnotations)
+	fake, client := multiSHAGithub(t)
+	for mode, expected := range map[string]map[string]int{
+		multiSHAPerTag: {"cli-artifacts": 3, "cli, tools": 1},
+		multiSHANewest: {"": 1},
+	} {
+		var pending []PendingRepository
+		captureLog(t, func() {
+			var err error
+			if pending, _, err = collectPending(context.Background(), client, 2, []string{oc}, commits, "master", mode); err != nil {
+				t.Fatal(err)
+			}
+		})
+		found := map[string]int{}
+		for _, p := range pending {
+			found[strings.Join(p.Tags, ", ")] = p.Ahead
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("%s: expected %v, got %v", mode, expected, found)
+		}
+	}
+	if n := fake.countRequests("/repos/openshift/oc/compare/" + oldestOC + "...master"); n != 1 {
+		t.Errorf("expected the oldest commit compared with the branch only per tag, got %d comparisons", n)
+	}
+
+	rows := newPendingReport("4.9.0-fc.1", "master", []PendingRepository{{Repository: oc, PayloadCommit: oldestOC, Tags: []string{"cli-artifacts"}, Ahead: 3}}, nil).rows()
+	if rows[0].Repository != "openshift/oc\n(cli-artifacts)" {
+		t.Errorf("expected the tags of the commit in the table, got %q", rows[0].Repository)
+	}
+}
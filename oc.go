@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ocCheckTimeout limits the commands run to check the oc binary
+const ocCheckTimeout = 10 * time.Second
+
+// ocInstallURL is where the oc client can be downloaded from
+const ocInstallURL = "https://mirror.openshift.com/pub/openshift-v4/clients/ocp/latest/"
+
+// commandRunner runs the command and returns its combined output.
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// ocChecker verifies oc is able to extract payloads, lookPath and run are replaced to simulate missing or
+// outdated binaries.
+type ocChecker struct {
+	lookPath func(file string) (string, error)
+	run      commandRunner
+}
+
+// check returns an error explaining the alternatives when oc is missing, broken, or too old to read payloads.
+func (c ocChecker) check(ctx context.Context) error {
+	if _, err := c.lookPath("oc"); err != nil {
+		return ocAlternatives("oc was not found in PATH")
+	}
+	ctx, cancel := context.WithTimeout(ctx, ocCheckTimeout)
+	defer cancel()
+	version, err := c.run(ctx, "oc", "version", "--client")
+	if err != nil {
+		return ocAlternatives(fmt.Sprintf("'oc version --client' failed (%v): %s", err, strings.TrimSpace(string(version))))
+	}
+	help, err := c.run(ctx, "oc", "adm", "release", "info", "--help")
+	if err != nil {
+		return ocAlternatives(fmt.Sprintf("oc %s does not support 'oc adm release info'", ocClientVersion(version)))
+	}
+	if !strings.Contains(string(help), "--commit-urls") {
+		return ocAlternatives(fmt.Sprintf("oc %s is too old, 'oc adm release info' does not support --commit-urls", ocClientVersion(version)))
+	}
+	return nil
+}
+
+// ocClientVersion returns the version from the output of "oc version --client".
+func ocClientVersion(out []byte) string {
+	for _, line := range strings.Split(string(out), "\n") {
+		if i := strings.Index(line, "Client Version:"); i >= 0 {
+			return strings.TrimSpace(line[i+len("Client Version:"):])
+		}
+	}
+	return "(unknown version)"
+}
+
+func ocAlternatives(problem string) error {
+	return fmt.Errorf(`:-( I need oc to read the repositories of the payload, but %s. Either:
+  * install a recent oc from %s
+  * run 'oc adm release info <payload> --commit-urls -o json > release.json' where oc is available and pass the file via -release-info-file
+  * pass the release-manifests directory extracted from the payload via -release-manifests-dir
+  * list the repositories to query in the "repositories" of a job of a -jobs file`, problem, ocInstallURL)
+}
+
+var (
+	ocCheckOnce sync.Once
+	ocCheckErr  error
+)
+
+// checkOC checks the oc binary once, before the first payload is extracted.
+func checkOC() error {
+	ocCheckOnce.Do(func() {
+		ocCheckErr = ocChecker{lookPath: exec.LookPath, run: runCommand}.check(context.Background())
+	})
+	return ocCheckErr
+}
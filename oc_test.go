@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// stubOC returns a command runner answering the oc commands with the outputs, commands without an output fail.
+func stubOC(outputs map[string]string) commandRunner {
+	return func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		out, ok := outputs[strings.Join(append([]string{name}, args...), " ")]
+		if !ok {
+			return []byte("error: unknown command"), errors.New("exit status 1")
+		}
+		return []byte(out), nil
+	}
+}
+
+func TestOCChecker(t *testing.T) {
+	found := func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	version := "Client Version: 4.9.0\nKustomize Version: v4.2.0\n"
+	tests := []struct {
+		name     string
+		lookPath func(string) (string, error)
+		outputs  map[string]string
+		expected string
+	}{
+		{
+			name:     "missing",
+			lookPath: func(string) (string, error) { return "", exec.ErrNotFound },
+			expected: "oc was not found in PATH",
+		},
+		{
+			name:     "broken",
+			lookPath: found,
+			expected: "'oc version --client' failed (exit status 1): error: unknown command",
+		},
+		{
+			name:     "without release info",
+			lookPath: found,
+			outputs:  map[string]string{"oc version --client": "Client Version: 3.11.0\n"},
+			expected: "oc 3.11.0 does not support 'oc adm release info'",
+		},
+		{
+			name:     "without commit urls",
+			lookPath: found,
+			outputs:  map[string]string{"oc version --client": "Client Version: 4.1.0\n", "oc adm release info --help": "Usage:\n  oc adm release info IMAGE [--changes-from=IMAGE] [flags]\n"},
+			expected: "oc 4.1.0 is too old, 'oc adm release info' does not support --commit-urls",
+		},
+		{
+			name:     "supported",
+			lookPath: found,
+			outputs:  map[string]string{"oc version --client": version, "oc adm release info --help": "Options:\n      --commit-urls=false: Display a link to the commit of each image\n"},
+		},
+	}
+	for _, test := range tests {
+		err := ocChecker{lookPath: test.lookPath, run: stubOC(test.outputs)}.check(context.Background())
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		case err != nil:
+			// all the alternatives are explained
+			for _, alternative := range []string{ocInstallURL, "-release-info-file", "-jobs"} {
+				if !strings.Contains(err.Error(), alternative) {
+					t.Errorf("%s: expected %s to be suggested, got %v", test.name, alternative, err)
+				}
+			}
+		}
+	}
+}
+
+func TestOCClientVersion(t *testing.T) {
+	if version := ocClientVersion([]byte("Client Version: 4.9.0-202108181000.p0.git.abc.el8\n")); version != "4.9.0-202108181000.p0.git.abc.el8" {
+		t.Errorf("unexpected version %q", version)
+	}
+	if version := ocClientVersion([]byte("oc v3.11.0\n")); version != "(unknown version)" {
+		t.Errorf("unexpected version %q", version)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	relativeToNow     = "now"
+	relativeToPayload = "payload"
+)
+
+// validateRelativeTo accepts the -relative-to values, empty is the default relative to now.
+func validateRelativeTo(relativeTo string) error {
+	switch relativeTo {
+	case "", relativeToNow, relativeToPayload:
+		return nil
+	}
+	return fmt.Errorf("unknown -relative-to %q, use %q or %q", relativeTo, relativeToNow, relativeToPayload)
+}
+
+// formatPayloadOffset renders the offset of the change from the payload creation, rounded to minutes: "-2h10m"
+// is a change merged 2h10m before the payload was created, "+40m" a change merged after it, which is not in
+// the payload.
+func formatPayloadOffset(offset time.Duration, durations Formatter) string {
+	switch {
+	case offset.Round(time.Minute) == 0:
+		return durations.Duration(0)
+	case offset < 0:
+		return "-" + durations.Duration(offset)
+	}
+	return "+" + durations.Duration(offset)
+}
+
+// annotatePayloadOffsets sets the offset of the changes from the payload creation with -relative-to payload, they
+// are rendered instead of the time relative to now.
+func (o *queryOptions) annotatePayloadOffsets(result *queryResult) error {
+	if o.relativeTo != relativeToPayload {
+		return nil
+	}
+	// raw data collected without -relative-to payload don't record the payload creation
+	var created time.Time
+	if result.Window != nil && result.Window.PayloadCreated != nil {
+		created = *result.Window.PayloadCreated
+	} else {
+		var err error
+		if created, err = o.payloadCreated(result.Payload); err != nil {
+			return fmt.Errorf("unable to render changes relative to the payload: %v", err)
+		}
+	}
+	for i := range result.Changes {
+		raw := result.Changes[i].raw
+		offset := int64(raw.Date.Sub(created) / time.Second)
+		raw.PayloadOffset = &offset
+		result.Changes[i] = newChange(raw)
+	}
+	return nil
+}
+
+// payloadCreated returns the creation time of the payload, from the -release-info-file (or -release-manifests-dir) when set.
+func (o *queryOptions) payloadCreated(payload string) (time.Time, error) {
+	if len(o.releaseSource()) == 0 {
+		return getPayloadCreated(payload)
+	}
+	release, err := o.release()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if release.Config.Created.IsZero() {
+		return time.Time{}, fmt.Errorf("%s does not record the payload creation time", o.releaseSource())
+	}
+	return release.Config.Created, nil
+}
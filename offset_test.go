@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPayloadOffset(t *testing.T) {
+	tests := map[time.Duration]string{
+		-(2*time.Hour + 10*time.Minute):  "-2h10m",
+		40 * time.Minute:                 "+40m",
+		-(26*time.Hour + 20*time.Second): "-1d2h",
+		3 * time.Hour:                    "+3h",
+		20 * time.Second:                 "0m",
+		-50 * time.Second:                "-1m",
+		0:                                "0m",
+	}
+	for offset, expected := range tests {
+		if formatted := formatPayloadOffset(offset, newFormatter("", time.Now())); formatted != expected {
+			t.Errorf("%s: expected %q, got %q", offset, expected, formatted)
+		}
+	}
+}
+
+func TestValidateRelativeTo(t *testing.T) {
+	for _, relativeTo := range []string{"", relativeToNow, relativeToPayload} {
+		if err := validateRelativeTo(relativeTo); err != nil {
+			t.Errorf("%q: unexpected error %v", relativeTo, err)
+		}
+	}
+	if err := validateRelativeTo("build"); err == nil {
+		t.Errorf("expected an unknown value to be rejected")
+	}
+}
+
+func TestAnnotatePayloadOffsets(t *testing.T) {
+	created := time.Date(2021, 8, 18, 10, 30, 0, 0, time.UTC)
+	result := &queryResult{Changes: testChanges(), Window: &Window{PayloadCreated: &created}}
+	if err := (&queryOptions{}).annotatePayloadOffsets(result); err != nil || result.Changes[0].raw.PayloadOffset != nil {
+		t.Fatalf("expected no offsets relative to now, got %+v: %v", result.Changes[0].raw, err)
+	}
+	o := &queryOptions{relativeTo: relativeToPayload}
+	if err := o.annotatePayloadOffsets(result); err != nil {
+		t.Fatal(err)
+	}
+	if when := result.Changes[0].Time; when != "-30m" {
+		t.Errorf("expected the change merged before the payload, got %q", when)
+	}
+	if when := result.Changes[1].Time; when != "-1h30m" {
+		t.Errorf("expected the change merged before the payload, got %q", when)
+	}
+
+	// a change merged after the payload was created is not in it
+	created = created.Add(-time.Hour)
+	if err := o.annotatePayloadOffsets(result); err != nil {
+		t.Fatal(err)
+	}
+	if when := result.Changes[0].Time; when != "+30m (NOT IN PAYLOAD)" {
+		t.Errorf("expected the change merged after the payload, got %q", when)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Changes: result.Changes}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"payloadOffsetSeconds": 1800`) || !strings.Contains(report, `"payloadOffsetSeconds": -1800`) || !strings.Contains(report, `"date": "2021-08-18T10:00:00Z"`) {
+		t.Errorf("expected the offsets next to the dates, got:\n%s", report)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatHTML, Report{Changes: result.Changes}); err != nil {
+		t.Fatal(err)
+	}
+	if page := out.String(); strings.Count(page, `<tr class="not-in-payload">`) != 1 || !strings.Contains(page, ">&#43;30m</td>") || !strings.Contains(page, ">-30m</td>") {
+		t.Errorf("expected the change not in the payload to be highlighted, got:\n%s", page)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// sourceOrg marks changes of repositories added by -include-org-repos, payload repositories have no source set.
+const sourceOrg = "org"
+
+const defaultMaxOrgRepositories = 200
+
+// cachedOrgRepositoriesTTL limits how long organization repositories persisted in the cache file are reused,
+// listing them is slow and they rarely change.
+const cachedOrgRepositoriesTTL = 24 * time.Hour
+
+// orgRepositoriesQuery is a single -include-org-repos value, ORG or ORG:TOPIC.
+type orgRepositoriesQuery struct {
+	Organization string
+	Topic        string
+}
+
+func parseOrgRepositoriesQuery(value string) (orgRepositoriesQuery, error) {
+	parts := strings.SplitN(value, ":", 2)
+	query := orgRepositoriesQuery{Organization: strings.TrimSpace(parts[0])}
+	if len(parts) == 2 {
+		query.Topic = strings.TrimSpace(parts[1])
+		if len(query.Topic) == 0 {
+			return query, fmt.Errorf("invalid -include-org-repos %q, the topic after ':' is empty", value)
+		}
+	}
+	if len(query.Organization) == 0 {
+		return query, fmt.Errorf("invalid -include-org-repos %q, expected ORG or ORG:TOPIC", value)
+	}
+	return query, nil
+}
+
+func (q orgRepositoriesQuery) String() string {
+	if len(q.Topic) == 0 {
+		return q.Organization
+	}
+	return q.Organization + ":" + q.Topic
+}
+
+// listOrgRepositories lists repositories of the organization with the topic, archived repositories are skipped.
+func listOrgRepositories(ctx context.Context, client *github.Client, query orgRepositoriesQuery) ([]string, error) {
+	var repositories []string
+	options := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := client.Repositories.ListByOrg(withCategory(ctx, categoryOrgRepositories), query.Organization, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			if r.GetArchived() || !hasTopic(r, query.Topic) {
+				continue
+			}
+			repositories = append(repositories, r.GetHTMLURL())
+		}
+		if resp.NextPage == 0 {
+			return repositories, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
+
+func hasTopic(repository *github.Repository, topic string) bool {
+	if len(topic) == 0 {
+		return true
+	}
+	for _, t := range repository.Topics {
+		if strings.EqualFold(t, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCachedOrgRepositories is listOrgRepositories that reuses repositories listed in the last day.
+func getCachedOrgRepositories(ctx context.Context, client *github.Client, query orgRepositoriesQuery, cache *Cache) ([]string, error) {
+	if repositories, ok := cache.getOrgRepositories(query.String()); ok {
+		return repositories, nil
+	}
+	repositories, err := listOrgRepositories(ctx, client, query)
+	if err != nil {
+		return nil, err
+	}
+	cache.setOrgRepositories(query.String(), repositories)
+	return repositories, nil
+}
+
+// includeOrgRepositories returns the organization repositories not already in the payload repositories,
+// no more than max of them are returned.
+func includeOrgRepositories(ctx context.Context, client *github.Client, queries []orgRepositoriesQuery, payloadRepositories []string, max int, cache *Cache) ([]string, error) {
+	known := map[string]bool{}
+	for _, r := range payloadRepositories {
+		known[strings.ToLower(repositoryName(r))] = true
+	}
+	var added []string
+	for _, query := range queries {
+		repositories, err := getCachedOrgRepositories(ctx, client, query, cache)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list %s repositories: %v", query, err)
+		}
+		for _, r := range repositories {
+			key := strings.ToLower(repositoryName(r))
+			if known[key] {
+				continue
+			}
+			known[key] = true
+			added = append(added, r)
+		}
+	}
+	if len(added) > max {
+		log.Printf("WARNING: %d organization repositories found, only the first %d are included (see -max-org-repos)", len(added), max)
+		added = added[:max]
+	}
+	log.Printf("Including %d organization repositories not referenced by the payload", len(added))
+	return added, nil
+}
+
+// annotateSource marks changes of the organization repositories.
+func annotateSource(changes []Change, orgRepositories []string) []Change {
+	if len(orgRepositories) == 0 {
+		return changes
+	}
+	org := map[string]bool{}
+	for _, r := range orgRepositories {
+		org[r] = true
+	}
+	for i := range changes {
+		if raw := changes[i].raw; org[raw.Repository] {
+			raw.Source = sourceOrg
+			changes[i] = newChange(raw)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeOrgGithub serves two pages of openshift repositories, it counts the listed pages.
+func fakeOrgGithub(t *testing.T) (*github.Client, *int) {
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/orgs/openshift/repos" {
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pages++
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("page") != "2" {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/orgs/openshift/repos?page=2>; rel="next"`, req.Host))
+			fmt.Fprint(w, `[{"html_url": "https://github.com/openshift/api", "topics": ["openshift-payload-adjacent"]},
+				{"html_url": "https://github.com/openshift/library-go", "topics": ["Openshift-Payload-Adjacent"]},
+				{"html_url": "https://github.com/openshift/origin", "archived": true, "topics": ["openshift-payload-adjacent"]}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"html_url": "https://github.com/openshift/client-go", "topics": ["openshift-payload-adjacent"]},
+			{"html_url": "https://github.com/openshift/release"}]`)
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, &pages
+}
+
+func TestParseOrgRepositoriesQuery(t *testing.T) {
+	if query, err := parseOrgRepositoriesQuery("openshift:openshift-payload-adjacent"); err != nil || query != (orgRepositoriesQuery{Organization: "openshift", Topic: "openshift-payload-adjacent"}) {
+		t.Errorf("unexpected query %+v: %v", query, err)
+	}
+	for _, value := range []string{"", ":topic", "openshift:"} {
+		if _, err := parseOrgRepositoriesQuery(value); err == nil {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestIncludeOrgRepositories(t *testing.T) {
+	client, pages := fakeOrgGithub(t)
+	cache := NewCache()
+	queries := []orgRepositoriesQuery{{Organization: "openshift", Topic: "openshift-payload-adjacent"}}
+	payload := []string{"https://github.com/openshift/API"}
+
+	// the archived repository, the repository without the topic and the payload repository are not included
+	added, err := includeOrgRepositories(context.Background(), client, queries, payload, 10, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"https://github.com/openshift/library-go", "https://github.com/openshift/client-go"}; !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected %v, got %v", expected, added)
+	}
+
+	added, err = includeOrgRepositories(context.Background(), client, queries, payload, 1, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"https://github.com/openshift/library-go"}; !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected the repositories to be limited to %v, got %v", expected, added)
+	}
+	if *pages != 2 {
+		t.Errorf("expected the organization repositories to be listed once, got %d pages", *pages)
+	}
+}
+
+func TestAnnotateSource(t *testing.T) {
+	changes := annotateSource([]Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/library-go", SHA: "b"}),
+	}, []string{"https://github.com/openshift/library-go"})
+	if changes[0].Source != "" || changes[1].Source != sourceOrg || changes[1].raw.Source != sourceOrg {
+		t.Errorf("expected only the organization repository change to be marked, got %+v", changes)
+	}
+}
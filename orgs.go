@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// unknownOrganization groups changes of repositories outside github.com
+const unknownOrganization = "(unknown)"
+
+// OrganizationSummary is the activity of a Github organization (eg. openshift, operator-framework) in the window.
+type OrganizationSummary struct {
+	Organization string `header:"Organization" json:"organization"`
+	Commits      int    `header:"Commits" json:"commits"`
+	Repositories int    `header:"Repositories" json:"repositories"`
+	Authors      int    `header:"Authors" json:"authors"`
+	BotShare     string `header:"Bot commits" json:"-"`
+	// BotPercent is the share of commits authored by bots (see isBot)
+	BotPercent float64 `json:"botPercent"`
+}
+
+// organizationSummaries aggregates the changes by the organization of their repository, sorted by the number of
+// changes and then by organization.
+func organizationSummaries(changes []Change) []OrganizationSummary {
+	type activity struct {
+		commits, bots         int
+		repositories, authors map[string]bool
+	}
+	organizations := map[string]*activity{}
+	for _, c := range changes {
+		organization, _, ok := parseRepositoryOrgName(c.raw.Repository)
+		if !ok {
+			organization = unknownOrganization
+		}
+		a, ok := organizations[organization]
+		if !ok {
+			a = &activity{repositories: map[string]bool{}, authors: map[string]bool{}}
+			organizations[organization] = a
+		}
+		a.commits++
+		a.repositories[c.raw.Repository] = true
+		if len(c.raw.Author) > 0 {
+			a.authors[c.raw.Author] = true
+		}
+		if isBot(c.raw.Author) {
+			a.bots++
+		}
+	}
+
+	result := []OrganizationSummary{}
+	for organization, a := range organizations {
+		percent := 100 * float64(a.bots) / float64(a.commits)
+		result = append(result, OrganizationSummary{
+			Organization: organization,
+			Commits:      a.commits,
+			Repositories: len(a.repositories),
+			Authors:      len(a.authors),
+			BotShare:     fmt.Sprintf("%.0f%%", percent),
+			BotPercent:   percent,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Organization < result[j].Organization
+	})
+	return result
+}
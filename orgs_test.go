@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrganizationSummaries(t *testing.T) {
+	var changes []Change
+	for _, c := range []struct{ author, repository string }{
+		{"mfojtik", "https://github.com/openshift/api"},
+		{"deads2k", "https://github.com/openshift/api"},
+		{"mfojtik", "https://github.com/openshift/oc"},
+		{"openshift-bot", "https://github.com/openshift/oc"},
+		{"dependabot[bot]", "https://github.com/operator-framework/api"},
+		{"joelanford", "https://github.com/operator-framework/api"},
+		{"joelanford", "https://github.com/operator-framework/operator-registry"},
+		{"", "https://github.com/operator-framework/api"},
+		{"k8s-ci-robot", "https://github.com/kubernetes-sigs/kube-storage-version-migrator"},
+		{"mfojtik", "https://gitlab.com/redhat/rhel/rpms/kernel"},
+	} {
+		changes = append(changes, newChange(RawChange{Repository: c.repository, Author: c.author, Message: "Change"}))
+	}
+
+	// ties are sorted by organization, commits without an author are not counted as an author
+	expected := []OrganizationSummary{
+		{Organization: "openshift", Commits: 4, Repositories: 2, Authors: 3, BotShare: "25%", BotPercent: 25},
+		{Organization: "operator-framework", Commits: 4, Repositories: 2, Authors: 2, BotShare: "25%", BotPercent: 25},
+		{Organization: unknownOrganization, Commits: 1, Repositories: 1, Authors: 1, BotShare: "0%", BotPercent: 0},
+		{Organization: "kubernetes-sigs", Commits: 1, Repositories: 1, Authors: 1, BotShare: "0%", BotPercent: 0},
+	}
+	if summaries := organizationSummaries(changes); !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summaries)
+	}
+	if summaries := organizationSummaries(nil); summaries == nil || len(summaries) != 0 {
+		t.Errorf("expected no organizations, got %#v", summaries)
+	}
+}
+
+func TestRenderOrganizationSummaries(t *testing.T) {
+	report := Report{Organizations: []OrganizationSummary{{Organization: "openshift", Commits: 3, Repositories: 2, Authors: 2, BotShare: "33%", BotPercent: 100.0 / 3}}}
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, report); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	organizations, _ := decoded["organizations"].([]interface{})
+	if len(organizations) != 1 {
+		t.Fatalf("expected the organizations key, got:\n%s", out.String())
+	}
+	if organization := organizations[0].(map[string]interface{}); organization["organization"] != "openshift" || organization["botPercent"] != 100.0/3 || organization["BotShare"] != nil {
+		t.Errorf("expected the bot share as a number, got %v", organization)
+	}
+
+	for _, orgSummary := range []bool{false, true} {
+		query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, orgSummary: orgSummary}
+		var collected string
+		captureLog(t, func() {
+			var err error
+			if collected, err = runTestQuery(t, fakeCappedGithub(t, map[string]int{"api": 2, "oc": 1}), query, []string{"https://github.com/openshift/api", "https://github.com/openshift/oc"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if shown := strings.Contains(collected, "Organizations:") && strings.Contains(collected, "BOT COMMITS"); shown != orgSummary {
+			t.Errorf("org-summary %v: unexpected table:\n%s", orgSummary, collected)
+		}
+	}
+}
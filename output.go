@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/template"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatJUnit = "junit"
+	// formatMarkdown is supported by the trend, diff and deps commands and -branch-cut-check only
+	formatMarkdown = "markdown"
+)
+
+// formats are the output formats of the reports
+var formats = []string{formatTable, formatJSON, formatJUnit, formatTemplate, formatCSV, formatHTML, formatTriage}
+
+func isFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is the output of a command, rendered as tables, JSON or JUnit XML.
+type Report struct {
+	Changes []Change
+	Errors  []RepositoryError
+	// Rebuilt are images rebuilt without source changes (compare mode only)
+	Rebuilt []Rebuild
+	// Components are payload tags renamed, added or removed (compare mode only)
+	Components []ComponentChange
+	// Regressions are components whose version went backwards (compare mode only)
+	Regressions []VersionRegression
+	// Versions are component versions of each payload image (see -with-versions)
+	Versions map[string]map[string]string
+	// DirectPushes are changes pushed without a pull request (see -audit-direct-pushes), nil when not audited
+	DirectPushes []DirectPush
+	// Digest are the most notable changes (see -digest), nil without it. DigestOnly leaves out the table of changes
+	Digest     []DigestEntry
+	DigestOnly bool
+	// Incident pairs the reverts of the -incident-window with the reverted commits, nil without the window
+	Incident *Incident
+	// Leaderboard is the number of changes of each author (see -leaderboard)
+	Leaderboard []LeaderboardEntry
+	// CVEs are the changes referencing CVEs, the most severe first
+	CVEs []CVEChange
+	// VolumeAlerts are repositories with more changes than their threshold (see -volume-alert), nil when not checked
+	VolumeAlerts []VolumeAlert
+	// PullRequests are the numbers of changes and pull requests of each repository (see -pr-summary)
+	PullRequests []RepositoryPullRequests
+	// Organizations is the activity of each Github organization (see -org-summary)
+	Organizations []OrganizationSummary
+	// Release identifies the payload read from a file (see -release-manifests-dir)
+	Release *ReleaseLabel
+	// SkippedTags are the payload tags skipped without a source repository
+	SkippedTags []SkippedTag
+	// EmbargoLags are the changes landed in a private mirror and in the public repository (see -show-embargo-lag)
+	EmbargoLags []EmbargoLag
+	// Payload and Branch describe the query, for formats that record it (eg. junit)
+	Payload string
+	Branch  string
+	// Unchanged are repositories without changes, only reported when -show-unchanged is set
+	Unchanged []string
+	// GroupByTier prints changes of core and extras payload images in separate sections
+	GroupByTier bool
+	// GroupByBatch prints changes merged together (eg. by a Tide batch) in separate sections
+	GroupByBatch bool
+	// GroupByMerge prints the changes merged by each merge commit beneath it (see -merge-commits collapse)
+	GroupByMerge bool
+	// Window is the resolved start of the listed changes
+	Window *Window
+	// APIRequests is the number of Github requests made per category
+	APIRequests map[string]int
+	// APIDeprecations are the Github API endpoints responding with deprecation headers
+	APIDeprecations []APIDeprecation
+	// Template renders the report with -format template
+	Template *template.Template
+	// Wrap is how the table output wraps the messages (see -width)
+	Wrap MessageWrap
+	// TrailerColumns are the keys of the trailers shown as table columns (see -columns trailer:KEY)
+	TrailerColumns []string
+	// Provenance records how the report was produced (JSON only)
+	Provenance *Provenance
+	// NoSanitize renders the raw messages in the html output (see -no-sanitize), Coauthors keeps the
+	// Co-authored-by lines of its sanitized messages (see -keep-coauthors)
+	NoSanitize bool
+	Coauthors  bool
+	// Durations renders the relative times of the html and template outputs (see -duration-style)
+	Durations Formatter
+}
+
+type jsonReport struct {
+	// Changes are streamed by writeJSONReport before the other fields, so they are not set when writing the report
+	Changes []RawChange `json:"changes,omitempty"`
+	Errors  []RawError  `json:"errors,omitempty"`
+	Rebuilt []Rebuild   `json:"rebuilt,omitempty"`
+	// Components are the payload tags renamed, added or removed between the compared payloads
+	Components []ComponentChange `json:"components,omitempty"`
+
+	Regressions   []VersionRegression          `json:"versionRegressions,omitempty"`
+	Versions      map[string]map[string]string `json:"versions,omitempty"`
+	Leaderboard   []LeaderboardEntry           `json:"leaderboard,omitempty"`
+	Organizations []OrganizationSummary        `json:"organizations,omitempty"`
+	PullRequests  []RepositoryPullRequests     `json:"pullRequests,omitempty"`
+	CVEs          []CVEChange                  `json:"cves,omitempty"`
+	EmbargoLags   []EmbargoLag                 `json:"embargoLag,omitempty"`
+	DirectPushes  []DirectPush                 `json:"directPushes,omitempty"`
+	Incidents     []Incident                   `json:"incidents,omitempty"`
+	Digest        []DigestEntry                `json:"digest,omitempty"`
+
+	Metadata jsonMetadata `json:"metadata"`
+}
+
+type jsonMetadata struct {
+	Created     time.Time      `json:"created"`
+	Payload     string         `json:"payload,omitempty"`
+	Window      *Window        `json:"window,omitempty"`
+	Release     *ReleaseLabel  `json:"release,omitempty"`
+	APIRequests map[string]int `json:"apiRequests,omitempty"`
+	// APIDeprecations are the Github API endpoints responding with Deprecation, Sunset or 299 Warning headers
+	APIDeprecations []APIDeprecation `json:"apiDeprecations,omitempty"`
+	// VolumeAlerts are repositories with more changes than their threshold (see -volume-alert)
+	VolumeAlerts []VolumeAlert `json:"volumeAlerts,omitempty"`
+	// Truncated are repositories whose commit list may be incomplete
+	Truncated []string `json:"truncated,omitempty"`
+	// SkippedCommits is the estimated number of commits not listed because of -max-commits-per-repo and -max-total-commits
+	SkippedCommits int `json:"skippedCommits,omitempty"`
+	// Provenance allows to reproduce the report (see -reproduce)
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// SkippedTags are the payload tags skipped without a source repository, with the reason (eg. to fix their
+	// annotations)
+	SkippedTags []SkippedTag `json:"skippedTags,omitempty"`
+}
+
+func writeReport(w io.Writer, format string, report Report) error {
+	switch format {
+	case formatTable:
+		if report.Digest != nil {
+			printDigest(w, report.Digest, len(report.Changes))
+			fmt.Fprintln(w)
+		}
+		if len(report.Regressions) > 0 {
+			fmt.Fprintf(w, "WARNING: component versions went backwards:\n")
+			tableprinter.New(w).Print(report.Regressions)
+			fmt.Fprintln(w)
+		}
+		switch {
+		case report.DigestOnly:
+		case report.GroupByBatch:
+			printChangesByBatch(w, report.Changes, report.Wrap, report.TrailerColumns)
+		case report.GroupByMerge:
+			printChangesByMerge(w, report.Changes, report.Wrap, report.TrailerColumns)
+		case report.GroupByTier:
+			printChangesByTier(w, report.Changes, report.Wrap, report.TrailerColumns)
+		default:
+			printChanges(w, report.Changes, report.Wrap, report.TrailerColumns)
+		}
+		if len(report.Components) > 0 {
+			fmt.Fprintf(w, "\nComponents:\n")
+			var rows []ComponentChange
+			for _, c := range report.Components {
+				c.Tag = c.renderedTag()
+				rows = append(rows, c)
+			}
+			tableprinter.New(w).Print(rows)
+		}
+		if len(report.Rebuilt) > 0 {
+			fmt.Fprintf(w, "\nRebuilt without source changes:\n")
+			tableprinter.New(w).Print(report.Rebuilt)
+		}
+		if report.Incident != nil {
+			printIncident(w, report.Incident)
+		}
+		if report.DirectPushes != nil {
+			if len(report.DirectPushes) > 0 {
+				fmt.Fprintf(w, "\nWARNING: %d changes were pushed without a pull request:\n", len(report.DirectPushes))
+				tableprinter.New(w).Print(report.DirectPushes)
+			} else {
+				fmt.Fprintf(w, "\nNo changes were pushed without a pull request.\n")
+			}
+		}
+		if len(report.VolumeAlerts) > 0 {
+			fmt.Fprintf(w, "\nWARNING: %d repositories merged more changes than their threshold:\n", len(report.VolumeAlerts))
+			tableprinter.New(w).Print(report.VolumeAlerts)
+		}
+		if len(report.CVEs) > 0 {
+			fmt.Fprintf(w, "\nChanges referencing CVEs:\n")
+			tableprinter.New(w).Print(report.CVEs)
+		}
+		if report.EmbargoLags != nil {
+			if len(report.EmbargoLags) > 0 {
+				fmt.Fprintf(w, "\nEmbargo lag, %d changes landed in a private mirror first:\n", len(report.EmbargoLags))
+				tableprinter.New(w).Print(report.EmbargoLags)
+			} else {
+				fmt.Fprintf(w, "\nNo changes landed both in a private mirror and in the public repository.\n")
+			}
+		}
+		if report.Leaderboard != nil {
+			fmt.Fprintf(w, "\nLeaderboard:\n")
+			tableprinter.New(w).Print(report.Leaderboard)
+		}
+		if report.PullRequests != nil {
+			fmt.Fprintf(w, "\nPull requests per repository:\n")
+			tableprinter.New(w).Print(report.PullRequests)
+		}
+		if report.Organizations != nil {
+			fmt.Fprintf(w, "\nOrganizations:\n")
+			tableprinter.New(w).Print(report.Organizations)
+		}
+		return nil
+	case formatJSON:
+		out := jsonReport{Rebuilt: report.Rebuilt, Components: report.Components, Regressions: report.Regressions, Versions: report.Versions, Leaderboard: report.Leaderboard, Organizations: report.Organizations, PullRequests: report.PullRequests, CVEs: report.CVEs, EmbargoLags: report.EmbargoLags, DirectPushes: report.DirectPushes, Metadata: jsonMetadata{Created: time.Now(), Payload: report.Payload, Window: report.Window, Release: report.Release, APIRequests: report.APIRequests, APIDeprecations: report.APIDeprecations, VolumeAlerts: report.VolumeAlerts, Provenance: report.Provenance, SkippedTags: report.SkippedTags}}
+		if report.Incident != nil {
+			out.Incidents = []Incident{*report.Incident}
+		}
+		out.Digest = report.Digest
+		for _, e := range report.Errors {
+			out.Errors = append(out.Errors, RawError{Repository: e.Repository, Kind: e.Kind, Message: e.Err.Error()})
+			if e.Kind == ErrorKindTruncated {
+				out.Metadata.Truncated = append(out.Metadata.Truncated, e.Repository)
+				out.Metadata.SkippedCommits += skippedCommits(e.Err)
+			}
+		}
+		return writeJSONReport(w, out, report.Changes)
+	case formatJUnit:
+		return writeJUnitReport(w, report)
+	case formatTemplate:
+		return writeTemplateReport(w, report)
+	case formatCSV:
+		return writeCSVReport(w, report)
+	case formatHTML:
+		return writeHTMLReport(w, report)
+	case formatTriage:
+		return writeTriageReport(w, report)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeJSONReport writes the report with the changes first, encoding them one by one, so a report of many
+// changes is never held in memory as a whole.
+func writeJSONReport(w io.Writer, out jsonReport, changes []Change) error {
+	rest, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(w)
+	buffered.WriteString("{\n  \"changes\": [")
+	for i, c := range changes {
+		if i > 0 {
+			buffered.WriteString(",")
+		}
+		data, err := json.MarshalIndent(c.raw, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		buffered.WriteString("\n    ")
+		buffered.Write(data)
+	}
+	if len(changes) > 0 {
+		buffered.WriteString("\n  ")
+	}
+	// the rest of the fields follow the changes, without the opening brace of the object
+	buffered.WriteString("],")
+	buffered.Write(rest[1:])
+	buffered.WriteString("\n")
+	return buffered.Flush()
+}
+
+// printChangesByTier prints a table of changes for each payload image tier.
+func printChangesByTier(w io.Writer, changes []Change, wrap MessageWrap, trailers []string) {
+	for _, tier := range []string{tierCore, tierExtras, ""} {
+		var tierChanges []Change
+		for _, c := range changes {
+			if c.raw.Tier == tier {
+				tierChanges = append(tierChanges, c)
+			}
+		}
+		if len(tierChanges) == 0 {
+			continue
+		}
+		switch tier {
+		case tierCore:
+			fmt.Fprintf(w, "Core payload images:\n")
+		case tierExtras:
+			fmt.Fprintf(w, "\nExtra payload images (tests, artifacts, ...):\n")
+		default:
+			fmt.Fprintf(w, "\nUnknown tier:\n")
+		}
+		printChanges(w, tierChanges, wrap, trailers)
+	}
+}
+
+// printChanges prints the changes as a table, followed by columns of the trailers keys. Columns backed by optional
+// features (eg. pull requests) are omitted when none of the changes carry a value for them. The rows are streamed: a first
+// pass measures the columns, the second writes each row as it is built. The Message column is wrapped to the width
+// left by the other columns, which then takes another pass to measure it.
+func printChanges(w io.Writer, changes []Change, wrap MessageWrap, trailers []string) {
+	if len(changes) == 0 {
+		tableprinter.New(w).Print(changes)
+		return
+	}
+
+	changeType := reflect.TypeOf(Change{})
+	var (
+		headers []string
+		fields  []int
+	)
+	for i := 0; i < changeType.NumField(); i++ {
+		header := changeType.Field(i).Tag.Get("header")
+		if len(header) == 0 {
+			continue
+		}
+		// the changes are not copied into interfaces, which would allocate each of them for each column
+		for j := range changes {
+			if len(reflect.ValueOf(&changes[j]).Elem().Field(i).String()) > 0 {
+				headers = append(headers, header)
+				fields = append(fields, i)
+				break
+			}
+		}
+	}
+	// the trailer columns are omitted the same way
+	var keys []string
+	for _, key := range trailers {
+		for j := range changes {
+			if len(formatTrailer(changes[j].raw.Trailers, key)) > 0 {
+				headers = append(headers, key)
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+
+	table := newTableStream(bufio.NewWriter(w), headers, len(changes))
+	for i, header := range headers {
+		if header == "Message" {
+			table.wrapped = i
+		}
+	}
+	// the messages are not wrapped while the other columns are measured
+	width := 0
+	row := func(c *Change) []string {
+		value := reflect.ValueOf(c).Elem()
+		cells := make([]string, 0, len(headers))
+		for _, f := range fields {
+			cells = append(cells, value.Field(f).String())
+		}
+		for _, key := range keys {
+			cells = append(cells, formatTrailer(c.raw.Trailers, key))
+		}
+		if width > 0 {
+			cells[table.wrapped] = wrapMessage(cells[table.wrapped], width, wrap.MaxLines)
+		}
+		return cells
+	}
+
+	for j := range changes {
+		table.measure(row(&changes[j]))
+	}
+	if table.wrapped >= 0 {
+		width = messageWidth(outputWidth(w, wrap.Width), table.widths, table.wrapped)
+		table.widths[table.wrapped] = textWidth(table.headers[table.wrapped])
+		for j := range changes {
+			table.measureCell(table.wrapped, row(&changes[j])[table.wrapped])
+		}
+	}
+	table.writeHeader()
+	for j := range changes {
+		table.writeRow(row(&changes[j]))
+	}
+	table.flush()
+}
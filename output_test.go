@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func testChanges() []Change {
+	date := time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)
+	return []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", URL: "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API\n\nWith \"quotes\", commas and <tags>.", Date: date, Author: "deads2k", PullRequest: 42}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", URL: "https://github.com/openshift/oc/commit/762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix the build", Date: date.Add(-time.Hour), Author: "soltysh"}),
+	}
+}
+
+func TestWriteJSONReportStreamed(t *testing.T) {
+	changes := testChanges()
+	out := jsonReport{
+		Errors:      []RawError{{Repository: "https://github.com/openshift/gone", Kind: ErrorKindNotFound, Message: "404"}},
+		Leaderboard: leaderboard(changes, false),
+		Metadata:    jsonMetadata{Created: time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)},
+	}
+	var streamed bytes.Buffer
+	if err := writeJSONReport(&streamed, out, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	// the streamed report is the same as the whole report encoded at once
+	for _, c := range changes {
+		out.Changes = append(out.Changes, c.raw)
+	}
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		t.Fatal(err)
+	}
+	if streamed.String() != encoded.String() {
+		t.Errorf("expected:\n%s\ngot:\n%s", encoded.String(), streamed.String())
+	}
+
+	streamed.Reset()
+	if err := writeJSONReport(&streamed, jsonReport{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(streamed.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got %v:\n%s", err, streamed.String())
+	}
+	if changes, ok := decoded["changes"].([]interface{}); !ok || len(changes) != 0 {
+		t.Errorf("expected an empty list of changes, got:\n%s", streamed.String())
+	}
+}
+
+// fakeNewestFirstGithub lists a newer and an older commit of openshift/api, newest first like Github does.
+func fakeNewestFirstGithub(t *testing.T) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/commits":
+			fmt.Fprintf(w, `[{"sha": "b2", "commit": {"message": "Newer", "committer": {"date": %q}}},
+				{"sha": "a1", "commit": {"message": "Older", "committer": {"date": %q}}}]`, time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(-2*time.Hour).Format(time.RFC3339))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestStreamSkipsSort(t *testing.T) {
+	for _, test := range []struct {
+		stream   bool
+		expected string
+	}{
+		{stream: false, expected: "Older,Newer"},
+		{stream: true, expected: "Newer,Older"},
+	} {
+		options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", Stream: test.stream}
+		var changes []Change
+		captureLog(t, func() {
+			var err error
+			if changes, _, err = processRepositories(context.Background(), fakeNewestFirstGithub(t), options, []string{"https://github.com/openshift/api"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		var messages []string
+		for _, c := range changes {
+			messages = append(messages, c.raw.Message)
+		}
+		if order := strings.Join(messages, ","); order != test.expected {
+			t.Errorf("stream %v: expected %s, got %s", test.stream, test.expected, order)
+		}
+	}
+}
+
+func TestWriteCSVReport(t *testing.T) {
+	defer func(location *time.Location) { displayLocation = location }(displayLocation)
+	displayLocation = time.UTC
+	var out bytes.Buffer
+	if err := writeReport(&out, formatCSV, Report{Changes: testChanges()}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("expected the header and a record per change, got %q", records)
+	}
+	expected := []string{"openshift/api", "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "2021-08-18T10:00:00Z", "deads2k", "42", "", "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "Bump the API", "Bump the API\n\nWith \"quotes\", commas and <tags>."}
+	if fmt.Sprintf("%q", records[1]) != fmt.Sprintf("%q", expected) {
+		t.Errorf("expected %q, got %q", expected, records[1])
+	}
+	if records[2][4] != "" {
+		t.Errorf("expected no pull request, got %q", records[2][4])
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	var out bytes.Buffer
+	report := Report{Changes: testChanges(), Payload: "4.9.0-0.nightly", Branch: "master", Errors: []RepositoryError{{Repository: "https://github.com/openshift/gone", Kind: ErrorKindNotFound, Err: errors.New("404")}}}
+	if err := writeReport(&out, formatHTML, report); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, expected := range []string{
+		"<title>2 changes in 4.9.0-0.nightly</title>",
+		`<a href="https://github.com/openshift/api/pull/42">#42</a>`,
+		`<a href="https://github.com/openshift/oc/commit/762941318ee16e59dabbacb1b4049eec22f0d303">7629413</a>`,
+		"With &#34;quotes&#34;, commas and &lt;tags&gt;.",
+		"openshift/gone could not be processed (not found)",
+		"</html>",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected the page to contain %s:\n%s", expected, page)
+		}
+	}
+	if strings.Count(page, "<tr>") != 3 {
+		t.Errorf("expected a header row and a row per change:\n%s", page)
+	}
+}
+
+// syntheticChanges returns n changes of 200 repositories and 50 authors, with messages of a few lines.
+func syntheticChanges(n int) []Change {
+	changes := make([]Change, n)
+	date := time.Now()
+	for i := range changes {
+		changes[i] = newChange(RawChange{
+			Repository: fmt.Sprintf("https://github.com/openshift/repository-%d", i%200),
+			SHA:        fmt.Sprintf("%040x", i),
+			URL:        fmt.Sprintf("https://github.com/openshift/repository-%d/commit/%040x", i%200, i),
+			Message:    fmt.Sprintf("Change %d of the synthetic data set\n\nA body line describing the change in some detail.\nAnother one.", i),
+			Date:       date.Add(-time.Duration(i) * time.Second),
+			Author:     fmt.Sprintf("author-%d", i%50),
+		})
+	}
+	return changes
+}
+
+// peakHeap returns the most heap in use above the heap before f, sampled every millisecond while it runs.
+func peakHeap(f func()) uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base, peak := stats.HeapInuse, stats.HeapInuse
+	done, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > peak {
+				peak = stats.HeapInuse
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+	f()
+	close(done)
+	<-sampled
+	return peak - base
+}
+
+// BenchmarkWriteReport renders 50k changes in each streamed format, run with -benchmem to compare the
+// allocations, peak-heap-B is the most heap in use while rendering.
+func BenchmarkWriteReport(b *testing.B) {
+	changes := syntheticChanges(50000)
+	for _, format := range []string{formatTable, formatJSON, formatCSV, formatHTML} {
+		b.Run(format, func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				if p := peakHeap(func() {
+					if err := writeReport(ioutil.Discard, format, Report{Changes: changes}); err != nil {
+						b.Fatal(err)
+					}
+				}); p > peak {
+					peak = p
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-heap-B")
+		})
+	}
+}
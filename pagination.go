@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const commitsPerPage = 100
+
+// truncatedError is returned when the commit listing stayed inconsistent after a retry, or when it was
+// capped by a commitLimit, the commits listed so far are returned with it.
+type truncatedError struct {
+	reason string
+	// capped listings are not retried, skipped is the estimated number of commits they did not list
+	capped  bool
+	skipped int
+}
+
+func (e *truncatedError) Error() string {
+	if e.capped {
+		return fmt.Sprintf("commit list is truncated: %s, about %d commits skipped", e.reason, e.skipped)
+	}
+	return fmt.Sprintf("commit list is truncated: %s", e.reason)
+}
+
+func isTruncated(err error) bool {
+	var truncated *truncatedError
+	return errors.As(err, &truncated)
+}
+
+// pageFilter decides whether the listing can stop early after the given page, remaining pages are not listed.
+type pageFilter func(page []*github.RepositoryCommit) bool
+
+// excludedAuthorsPageFilter stops the listing once a page consists entirely of commits by excluded authors
+// older than the middle of the window. This is an approximation: it assumes such a page means the rest of
+// the window is dominated by the excluded authors (eg. bots), which saves the requests for their commits.
+func excludedAuthorsPageFilter(authors []string, since time.Time) pageFilter {
+	excluded := map[string]bool{}
+	for _, a := range authors {
+		excluded[strings.ToLower(a)] = true
+	}
+	midpoint := since.Add(time.Since(since) / 2)
+	return func(page []*github.RepositoryCommit) bool {
+		if len(authors) == 0 || len(page) == 0 {
+			return false
+		}
+		for _, c := range page {
+			if !excluded[strings.ToLower(commitAuthor(c))] || commitDate(c).After(midpoint) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// listCommitsPages lists all pages of commits. The pagination is inconsistent when a page fails after the first one,
+// or when a page before the last one (according to the Link header of the first response) is not full.
+// The listing stops early when the limit is reached.
+func listCommitsPages(ctx context.Context, client *github.Client, organization, name string, options github.CommitsListOptions, stop pageFilter, limit *commitLimit) ([]*github.RepositoryCommit, *truncatedError, error) {
+	options.ListOptions = github.ListOptions{PerPage: commitsPerPage}
+	var (
+		commits  []*github.RepositoryCommit
+		lastPage int
+	)
+	for page := 1; ; page++ {
+		if page > 1 && limit.exhausted() {
+			return commits, newCapTruncation(fmt.Sprintf("-max-total-commits %d reached", limit.total), len(commits), len(commits), lastPage), nil
+		}
+		options.Page = page
+		result, resp, err := client.Repositories.ListCommits(withCategory(ctx, categoryCommitList), organization, name, &options)
+		if err != nil {
+			if page == 1 {
+				return nil, nil, err
+			}
+			return commits, &truncatedError{reason: fmt.Sprintf("page %d failed: %v", page, err)}, nil
+		}
+		addSpanCounter(ctx, "pages", 1)
+		commits = append(commits, result...)
+		limit.add(len(result))
+		if page == 1 {
+			lastPage = resp.LastPage
+		}
+		if capped, truncated := limit.capRepository(commits, resp.NextPage != 0, lastPage); truncated != nil {
+			return capped, truncated, nil
+		}
+		if stop != nil && stop(result) {
+			logVerbose("[%s/%s] stopped listing commits after page %d of %d", organization, name, page, resp.LastPage)
+			return commits, nil, nil
+		}
+		if resp.NextPage == 0 {
+			if page < lastPage {
+				return commits, &truncatedError{reason: fmt.Sprintf("page %d of %d has no next page", page, lastPage)}, nil
+			}
+			return commits, nil, nil
+		}
+		if len(result) < commitsPerPage {
+			return commits, &truncatedError{reason: fmt.Sprintf("page %d has only %d commits", page, len(result))}, nil
+		}
+	}
+}
+
+// listAllCommits lists all pages of commits and retries the whole listing once when the pagination is inconsistent.
+func listAllCommits(ctx context.Context, client *github.Client, organization, name string, options github.CommitsListOptions, stop pageFilter, limit *commitLimit) ([]*github.RepositoryCommit, error) {
+	commits, truncated, err := listCommitsPages(ctx, client, organization, name, options, stop, limit)
+	if err != nil || truncated == nil {
+		return commits, err
+	}
+	if truncated.capped {
+		return commits, truncated
+	}
+	log.Printf("[%s/%s] %v, listing commits again", organization, name, truncated)
+	addSpanCounter(ctx, "retries", 1)
+	limit.rollback(len(commits))
+	commits, truncated, err = listCommitsPages(ctx, client, organization, name, options, stop, limit)
+	if err != nil || truncated == nil {
+		return commits, err
+	}
+	return commits, truncated
+}
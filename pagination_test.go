@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakePaginatedGithub serves openshift/api with 105 commits of openshift/api in two pages, the second page fails the first failures
+// times it is requested (always when negative). It returns the number of requests of each page.
+func fakePaginatedGithub(t *testing.T, failures int) (*github.Client, func(page int) int) {
+	var lock sync.Mutex
+	requests := map[int]int{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/repos/openshift/api" {
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+			return
+		}
+		if req.URL.Path != "/repos/openshift/api/commits" {
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		lock.Lock()
+		requests[page]++
+		failed := page == 2 && (failures < 0 || requests[page] <= failures)
+		lock.Unlock()
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message": "Server Error"}`)
+			return
+		}
+		first, last := 0, 100
+		if page == 2 {
+			first, last = 100, 105
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%[1]s/repos/openshift/api/commits?page=2>; rel="next", <%[1]s/repos/openshift/api/commits?page=2>; rel="last"`, server.URL))
+		}
+		var commits []string
+		for i := first; i < last; i++ {
+			commits = append(commits, fmt.Sprintf(`{"sha": "%040d", "commit": {"message": "Change %d", "committer": {"date": %q}}}`, i, i, time.Now().Add(-time.Minute).Format(time.RFC3339)))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(commits, ","))
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func(page int) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests[page]
+	}
+}
+
+func TestListAllCommitsRetriesFailingMiddlePage(t *testing.T) {
+	client, requests := fakePaginatedGithub(t, 1)
+	commits, err := listAllCommits(context.Background(), client, "openshift", "api", github.CommitsListOptions{SHA: "master"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 105 {
+		t.Errorf("expected the 105 commits listed again, got %d", len(commits))
+	}
+	if requests(1) != 2 || requests(2) != 2 {
+		t.Errorf("expected the whole listing retried once, got %d and %d requests of the pages", requests(1), requests(2))
+	}
+}
+
+func TestCollectTruncatedByFailingMiddlePage(t *testing.T) {
+	client, requests := fakePaginatedGithub(t, -1)
+	options := ProcessOptions{Concurrency: 1, BranchName: "master", Since: 24 * time.Hour, Cache: NewCache()}
+	changes, errs, err := processRepositories(context.Background(), client, options, []string{"https://github.com/openshift/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the changes of the first page are still reported
+	if len(changes) != 100 {
+		t.Errorf("expected the 100 changes of the first page, got %d", len(changes))
+	}
+	if len(errs) != 1 || errs[0].Kind != ErrorKindTruncated || errs[0].Repository != "https://github.com/openshift/api" {
+		t.Fatalf("expected the repository truncated, got %+v", errs)
+	}
+	if requests(2) != 2 {
+		t.Errorf("expected the listing retried once, got %d requests of the second page", requests(2))
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Changes: changes, Errors: errs}); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Metadata.Truncated) != 1 || report.Metadata.Truncated[0] != "https://github.com/openshift/api" {
+		t.Errorf("expected the repository truncated in the metadata, got %v", report.Metadata.Truncated)
+	}
+
+	// the truncated listing is not cached, the next run lists the commits again
+	if _, _, err := processRepositories(context.Background(), client, options, []string{"https://github.com/openshift/api"}); err != nil {
+		t.Fatal(err)
+	}
+	if requests(1) != 4 {
+		t.Errorf("expected the commits listed again, got %d requests of the first page", requests(1))
+	}
+}
+
+// fakeBotGithub serves three pages of openshift/api commits: recent commits of people and openshift-bot, a full
+// page of older openshift-bot commits and the oldest commits of people. It returns the number of page requests.
+func fakeBotGithub(t *testing.T) (*github.Client, func() int) {
+	var lock sync.Mutex
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/repos/openshift/api" {
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+			return
+		}
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`<%[1]s/repos/openshift/api/commits?page=%[2]d>; rel="next", <%[1]s/repos/openshift/api/commits?page=3>; rel="last"`, server.URL, page+1))
+		}
+		var commits []string
+		commit := func(i int, author string, age time.Duration) {
+			commits = append(commits, fmt.Sprintf(`{"sha": "%040d", "author": {"login": %q}, "commit": {"message": "Change %d", "committer": {"date": %q}}}`, i, author, i, time.Now().Add(-age).Format(time.RFC3339)))
+		}
+		switch page {
+		case 0, 1:
+			for i := 0; i < 100; i++ {
+				author := "openshift-bot"
+				if i%10 == 0 {
+					author = "deads2k"
+				}
+				commit(i, author, time.Hour)
+			}
+		case 2:
+			for i := 100; i < 200; i++ {
+				commit(i, "openshift-bot", 13*time.Hour)
+			}
+		case 3:
+			for i := 200; i < 205; i++ {
+				commit(i, "sttts", 20*time.Hour)
+			}
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(commits, ","))
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func TestAggressivePagination(t *testing.T) {
+	tests := []struct {
+		name             string
+		aggressive       bool
+		expectedRequests int
+		expectedChanges  int
+	}{
+		{name: "all pages", expectedRequests: 3, expectedChanges: 15},
+		// the oldest changes after the page of excluded commits are missed
+		{name: "aggressive", aggressive: true, expectedRequests: 2, expectedChanges: 10},
+	}
+	for _, test := range tests {
+		client, requests := fakeBotGithub(t)
+		query := &queryOptions{since: "24h", branch: "master", excludeAuthors: commaSeparatedList{"openshift-bot"}, aggressivePages: test.aggressive}
+		processOptions, err := query.processOptions(&sharedOptions{concurrency: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		processOptions.Cache = NewCache()
+		changes, _, err := processRepositories(context.Background(), client, processOptions, []string{"https://github.com/openshift/api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes = query.apply(changes)
+		if requests() != test.expectedRequests {
+			t.Errorf("%s: expected %d requests, got %d", test.name, test.expectedRequests, requests())
+		}
+		if len(changes) != test.expectedChanges {
+			t.Errorf("%s: expected %d changes, got %d", test.name, test.expectedChanges, len(changes))
+		}
+	}
+}
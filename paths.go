@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultClassifyPathsLimit is the default number of commits whose files are fetched by -classify-paths
+const defaultClassifyPathsLimit = 200
+
+// pathClassUnknown is the class of commits whose files could not be fetched, it is never excluded by -only-path-class
+const pathClassUnknown = "unknown"
+
+// pathClassOnlySuffix marks classes that apply only when all files of the commit match them (eg. docs-only)
+const pathClassOnlySuffix = "-only"
+
+// errClassifyPathsLimit is returned for commits over the -classify-paths-limit, their files are not fetched
+var errClassifyPathsLimit = errors.New("classify paths limit reached")
+
+// PathClass maps changed files matching the patterns to a class. The patterns are globs where "**" matches
+// any number of directories, patterns without a "/" match the file name in any directory.
+type PathClass struct {
+	Class    string   `yaml:"class"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// defaultPathClasses highlight changes likely visible to customers for the release notes.
+var defaultPathClasses = []PathClass{
+	{Class: "api-change", Patterns: []string{"**/vendor/github.com/openshift/api/**", "*_types.go", "**/crds/**/*.yaml", "*.crd.yaml", "*customresourcedefinition*.yaml"}},
+	{Class: "manifest-change", Patterns: []string{"**/manifests/**"}},
+	{Class: "docs-only", Patterns: []string{"*.md", "**/docs/**"}},
+	{Class: "test-only", Patterns: []string{"*_test.go", "**/test/**", "**/testdata/**"}},
+}
+
+// readPathClasses reads classes from the YAML file, replacing the default ones:
+//
+//	classes:
+//	- class: api-change
+//	  patterns: ["**/apis/**/*_types.go"]
+func readPathClasses(file string) ([]PathClass, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Classes []PathClass `yaml:"classes"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(config.Classes) == 0 {
+		return nil, fmt.Errorf("%s: no classes defined", file)
+	}
+	for i, c := range config.Classes {
+		if len(c.Class) == 0 || len(c.Patterns) == 0 {
+			return nil, fmt.Errorf("%s: class %d must have a class and patterns", file, i+1)
+		}
+		for _, pattern := range c.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: class %s has an invalid pattern %q: %v", file, c.Class, pattern, err)
+			}
+		}
+	}
+	return config.Classes, nil
+}
+
+// matchPath reports whether the file matches the glob, where a "**" segment matches any number of directories.
+func matchPath(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(file))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(file); i++ {
+				if matchSegments(pattern[1:], file[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(file) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], file[0]); !matched {
+			return false
+		}
+		pattern, file = pattern[1:], file[1:]
+	}
+	return len(file) == 0
+}
+
+// classifyPaths returns the classes of the changed files, sorted. A class ending with "-only" applies when all
+// the files match it, the other classes apply when any file does.
+func classifyPaths(classes []PathClass, files []string) []string {
+	var result []string
+	for _, c := range classes {
+		matching := 0
+		for _, file := range files {
+			for _, pattern := range c.Patterns {
+				if matchPath(pattern, file) {
+					matching++
+					break
+				}
+			}
+		}
+		if matching == 0 || (strings.HasSuffix(c.Class, pathClassOnlySuffix) && matching < len(files)) {
+			continue
+		}
+		result = append(result, c.Class)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// pathClassifier fetches changed files of (up to limit) commits and classifies them.
+type pathClassifier struct {
+	client  *github.Client
+	classes []PathClass
+	limit   int
+
+	lock    sync.Mutex
+	fetched int
+}
+
+func newPathClassifier(client *github.Client, classes []PathClass, limit int) *pathClassifier {
+	return &pathClassifier{client: client, classes: classes, limit: limit}
+}
+
+// Files returns the changed files of the commit, Github lists at most maxCommitFiles of them.
+func (p *pathClassifier) Files(ctx context.Context, organization, name, sha string) ([]ChangedFile, error) {
+	p.lock.Lock()
+	if p.limit > 0 && p.fetched >= p.limit {
+		p.lock.Unlock()
+		return nil, errClassifyPathsLimit
+	}
+	p.fetched++
+	p.lock.Unlock()
+
+	commit, _, err := p.client.Repositories.GetCommit(withCategory(ctx, categoryCommitFiles), organization, name, sha)
+	if err != nil {
+		return nil, err
+	}
+	var files []ChangedFile
+	for _, f := range commit.Files {
+		files = append(files, ChangedFile{Path: f.GetFilename(), Status: f.GetStatus(), Additions: f.GetAdditions(), Deletions: f.GetDeletions()})
+	}
+	return files, nil
+}
+
+// classifyRawChanges sets the changed files and the path classes of the changes, those whose files could not be
+// fetched are unknown.
+func (p *pathClassifier) classifyRawChanges(ctx context.Context, repository, organization, name string, raws []RawChange) {
+	for i := range raws {
+		files, err := p.Files(ctx, organization, name, raws[i].SHA)
+		if err != nil {
+			if !isBudgetExhausted(err) && err != errClassifyPathsLimit {
+				log.Printf("[%s] unable to get files of %s: %v", repository, raws[i].SHA, err)
+			}
+			raws[i].PathClasses = []string{pathClassUnknown}
+			continue
+		}
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		raws[i].Files = files
+		raws[i].FilesIncomplete = len(files) >= maxCommitFiles
+		raws[i].PathClasses = classifyPaths(p.classes, paths)
+	}
+}
+
+// pathClassFilter keeps only changes of the class, or of an unknown class.
+type pathClassFilter struct {
+	class string
+}
+
+func (f pathClassFilter) Name() string {
+	return "only-path-class"
+}
+
+func (f pathClassFilter) Keep(c Change) (bool, string) {
+	for _, class := range c.raw.PathClasses {
+		if class == f.class || class == pathClassUnknown {
+			return true, ""
+		}
+	}
+	if len(c.raw.PathClasses) == 0 {
+		return false, "no path class"
+	}
+	return false, fmt.Sprintf("path class %s", strings.Join(c.raw.PathClasses, ", "))
+}
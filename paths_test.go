@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, file string
+		expected      bool
+	}{
+		{pattern: "**/vendor/github.com/openshift/api/**", file: "vendor/github.com/openshift/api/config/v1/types.go", expected: true},
+		{pattern: "**/vendor/github.com/openshift/api/**", file: "staging/src/k8s.io/kubectl/vendor/github.com/openshift/api/route/v1/types.go", expected: true},
+		{pattern: "**/vendor/github.com/openshift/api/**", file: "vendor/github.com/openshift/apiserver-library-go/pkg/types.go"},
+		{pattern: "**/vendor/github.com/openshift/api/**", file: "pkg/vendor.go"},
+		{pattern: "*_types.go", file: "pkg/apis/config/v1/config_types.go", expected: true},
+		{pattern: "*_types.go", file: "pkg/types.go"},
+		{pattern: "**/crds/**/*.yaml", file: "crds/machine.yaml", expected: true},
+		{pattern: "**/crds/**/*.yaml", file: "install/crds/v1/nested/machine.yaml", expected: true},
+		{pattern: "**/crds/**/*.yaml", file: "install/crds/README.md"},
+		{pattern: "**/manifests/**", file: "manifests", expected: true},
+		{pattern: "**/manifests/**", file: "manifests/0000_50_deployment.yaml", expected: true},
+		{pattern: "docs/*.md", file: "docs/nested/index.md"},
+	}
+	for _, test := range tests {
+		if matched := matchPath(test.pattern, test.file); matched != test.expected {
+			t.Errorf("%s %s: expected %v, got %v", test.pattern, test.file, test.expected, matched)
+		}
+	}
+}
+
+func TestClassifyPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		expected []string
+	}{
+		{name: "api and manifests", files: []string{"vendor/github.com/openshift/api/config/v1/types.go", "manifests/0000_03_config.crd.yaml"}, expected: []string{"api-change", "manifest-change"}},
+		{name: "docs only", files: []string{"README.md", "docs/dev/setup.md"}, expected: []string{"docs-only"}},
+		{name: "docs and code", files: []string{"README.md", "pkg/operator/sync.go"}},
+		{name: "tests only", files: []string{"pkg/operator/sync_test.go", "test/e2e/operator.go"}, expected: []string{"test-only"}},
+		{name: "no files"},
+	}
+	for _, test := range tests {
+		if classes := classifyPaths(defaultPathClasses, test.files); !reflect.DeepEqual(classes, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, classes)
+		}
+	}
+}
+
+func TestReadPathClasses(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		file := filepath.Join(dir, "classes.yaml")
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	classes, err := readPathClasses(write("classes:\n- class: api-change\n  patterns: ['**/apis/**/*_types.go']\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(classes, []PathClass{{Class: "api-change", Patterns: []string{"**/apis/**/*_types.go"}}}) {
+		t.Errorf("unexpected classes %+v", classes)
+	}
+	for content, expected := range map[string]string{
+		"classes: []\n":                                  "no classes defined",
+		"classes:\n- class: api-change\n":                "class 1 must have a class and patterns",
+		"classes:\n- class: docs\n  patterns: ['[a-']\n": `class docs has an invalid pattern "[a-"`,
+	} {
+		if _, err := readPathClasses(write(content)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestPathClassFilter(t *testing.T) {
+	filter := pathClassFilter{class: "api-change"}
+	for _, test := range []struct {
+		classes  []string
+		expected bool
+	}{
+		{classes: []string{"api-change", "manifest-change"}, expected: true},
+		{classes: []string{pathClassUnknown}, expected: true},
+		{classes: []string{"docs-only"}},
+		{},
+	} {
+		if keep, _ := filter.Keep(newChange(RawChange{PathClasses: test.classes})); keep != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.classes, test.expected, keep)
+		}
+	}
+}
+
+// fakeFilesGithub serves three commits of openshift/api and their files, the files of c3 can't be fetched.
+func fakeFilesGithub(t *testing.T) *github.Client {
+	files := map[string]string{
+		"a1": `[{"filename": "vendor/github.com/openshift/api/config/v1/types.go"}]`,
+		"b2": `[{"filename": "README.md"}]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.URL.Path == "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case req.URL.Path == "/repos/openshift/api/commits":
+			date := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			fmt.Fprintf(w, `[{"sha": "a1", "commit": {"message": "Bump the API", "committer": {"date": %[1]q}}},
+				{"sha": "b2", "commit": {"message": "Fix the README", "committer": {"date": %[1]q}}},
+				{"sha": "c3", "commit": {"message": "Refactor", "committer": {"date": %[1]q}}}]`, date)
+		case strings.HasPrefix(req.URL.Path, "/repos/openshift/api/commits/"):
+			sha := strings.TrimPrefix(req.URL.Path, "/repos/openshift/api/commits/")
+			if _, ok := files[sha]; !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, `{"sha": %q, "files": %s}`, sha, files[sha])
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestOnlyPathClass(t *testing.T) {
+	query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, onlyPathClass: "api-change"}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var table string
+	output := captureLog(t, func() {
+		var err error
+		if table, err = runTestQuery(t, fakeFilesGithub(t), query, []string{"https://github.com/openshift/api"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// the commit whose files could not be fetched is kept as unknown
+	if !strings.Contains(table, "Bump the API") || !strings.Contains(table, "Refactor") || strings.Contains(table, "README") || !strings.Contains(table, "PATH CLASS") {
+		t.Errorf("expected the API and the unknown changes, got:\n%s", table)
+	}
+	if !strings.Contains(output, "unable to get files of c3") {
+		t.Errorf("expected the failed commit to be logged, got:\n%s", output)
+	}
+
+	// over the limit, the files are not fetched and the class is unknown
+	options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", ClassifyPaths: true, ClassifyPathsLimit: 1, PathClasses: defaultPathClasses}
+	var changes []Change
+	captureLog(t, func() {
+		var err error
+		if changes, _, err = processRepositories(context.Background(), fakeFilesGithub(t), options, []string{"https://github.com/openshift/api"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	classes := map[string][]string{}
+	for _, c := range changes {
+		classes[c.raw.SHA] = c.raw.PathClasses
+	}
+	if !reflect.DeepEqual(classes, map[string][]string{"a1": {"api-change"}, "b2": {pathClassUnknown}, "c3": {pathClassUnknown}}) {
+		t.Errorf("expected only the first commit to be classified, got %v", classes)
+	}
+}
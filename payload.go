@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultPayload = "quay.io/openshift-release-dev/ocp-release:4.9.0-fc.0-x86_64"
+
+// payloadEnv overrides the default -payload (eg. "latest-accepted:4.16")
+const payloadEnv = "OCP_WHAT_MERGED_PAYLOAD"
+
+// defaultPayloadFlag is the default of the -payload flags, from the environment when set.
+func defaultPayloadFlag() string {
+	if payload := os.Getenv(payloadEnv); len(payload) > 0 {
+		return payload
+	}
+	return defaultPayload
+}
+
+const (
+	sourceLocationAnnotation = "io.openshift.build.source-location"
+	commitIDAnnotation       = "io.openshift.build.commit.id"
+
+	// annotations used by images built via Konflux
+	imageSourceAnnotation   = "org.opencontainers.image.source"
+	imageRevisionAnnotation = "org.opencontainers.image.revision"
+)
+
+// defaultSourceAnnotations are the annotation keys tried, in order, to find the source repository of a payload image
+var defaultSourceAnnotations = []string{sourceLocationAnnotation, imageSourceAnnotation}
+
+// revisionAnnotations maps the source repository annotation to the annotation holding the source commit
+var revisionAnnotations = map[string]string{
+	sourceLocationAnnotation: commitIDAnnotation,
+	imageSourceAnnotation:    imageRevisionAnnotation,
+}
+
+// Reasons payload tags are skipped without a source repository (see -show-skipped-tags)
+const (
+	skippedNoAnnotation  = "no source annotation"
+	skippedEmptyValue    = "empty source annotation"
+	skippedUnparsableURL = "unparsable source URL"
+	skippedNonGithubURL  = "non-GitHub source URL"
+)
+
+// SkippedTag is a payload tag no source repository is listed for (eg. base images or machine-os-content, which are
+// not built from a repository).
+type SkippedTag struct {
+	Name        string            `json:"name"`
+	Reason      string            `json:"reason"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Release struct {
+	Config   ReleaseConfig   `json:"config"`
+	Refs     References      `json:"references"`
+	Metadata ReleaseMetadata `json:"metadata"`
+}
+
+// ReleaseMetadata is the release-metadata of the payload.
+type ReleaseMetadata struct {
+	Version string `json:"version"`
+}
+
+// ReleaseConfig is the image configuration of the payload.
+type ReleaseConfig struct {
+	Created time.Time `json:"created"`
+}
+
+type References struct {
+	Kind     string             `json:"kind"`
+	Metadata ReferencesMetadata `json:"metadata"`
+	Spec     ReferencesSpec     `json:"spec"`
+}
+
+type ReferencesMetadata struct {
+	CreationTimestamp string `json:"creationTimestamp"`
+}
+
+type ReferencesSpec struct {
+	Tags []Tag `json:"tags"`
+}
+
+type Tag struct {
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations"`
+	From        TagReference      `json:"from"`
+}
+
+// TagReference points to the image of the tag (eg. "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:...").
+type TagReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Digest returns the digest part of the image reference, or empty string when the image is not referenced by digest.
+func (r TagReference) Digest() string {
+	if i := strings.LastIndex(r.Name, "@"); i >= 0 {
+		return r.Name[i+1:]
+	}
+	return ""
+}
+
+// normalizeSourceURL converts the various forms of source repository annotations (eg. "git+https://github.com/org/repo.git#ref",
+// "git@github.com:org/repo") to "https://github.com/org/repo". The fragment, if any, is returned as the ref.
+func normalizeSourceURL(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	var ref string
+	if i := strings.Index(value, "#"); i >= 0 {
+		value, ref = value[:i], value[i+1:]
+	}
+	value = strings.TrimPrefix(value, "git+")
+	if strings.HasPrefix(value, "git@github.com:") {
+		value = "https://github.com/" + strings.TrimPrefix(value, "git@github.com:")
+	}
+	value = strings.Replace(value, "http://", "https://", 1)
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "/"), ".git")
+	// drop paths pointing into the repository (eg. ".../tree/<ref>")
+	if strings.HasPrefix(value, "https://github.com/") {
+		parts := strings.Split(strings.TrimPrefix(value, "https://github.com/"), "/")
+		if len(parts) > 2 {
+			value = "https://github.com/" + strings.TrimSuffix(parts[0]+"/"+parts[1], ".git")
+		}
+	}
+	return value, ref
+}
+
+// Source returns the source repository and commit of the tag image using the first of the annotation keys
+// present, together with the key used.
+func (t Tag) Source(sourceAnnotations []string) (string, string, string, bool) {
+	for _, key := range sourceAnnotations {
+		value, ok := t.Annotations[key]
+		if !ok || len(strings.TrimSpace(value)) == 0 {
+			continue
+		}
+		repository, commit := normalizeSourceURL(value)
+		if revisionKey, ok := revisionAnnotations[key]; ok && len(t.Annotations[revisionKey]) > 0 {
+			commit = t.Annotations[revisionKey]
+		}
+		return repository, commit, key, true
+	}
+	return "", "", "", false
+}
+
+// skipReason returns why the tag has no source repository to list changes of, empty when it has one.
+func (t Tag) skipReason(sourceAnnotations []string) string {
+	repository, _, _, ok := t.Source(sourceAnnotations)
+	if !ok {
+		for _, key := range sourceAnnotations {
+			if _, ok := t.Annotations[key]; ok {
+				return skippedEmptyValue
+			}
+		}
+		return skippedNoAnnotation
+	}
+	u, err := url.Parse(repository)
+	if err != nil || len(u.Host) == 0 {
+		return skippedUnparsableURL
+	}
+	if u.Host != "github.com" {
+		return skippedNonGithubURL
+	}
+	if _, _, ok := parseRepositoryOrgName(repository); !ok {
+		return skippedUnparsableURL
+	}
+	return ""
+}
+
+// ParseRelease parses the output of "oc adm release info -o json".
+func ParseRelease(r io.Reader) (Release, error) {
+	var release Release
+	if err := json.NewDecoder(r).Decode(&release); err != nil {
+		return release, fmt.Errorf("unable to parse release info: %v", err)
+	}
+	return release, nil
+}
+
+// releaseJSON skips noise (eg. warnings) printed by oc before the JSON document.
+func releaseJSON(out []byte) []byte {
+	if bytes.HasPrefix(bytes.TrimSpace(out), []byte("{")) {
+		return out
+	}
+	if i := bytes.Index(out, []byte("\n{")); i >= 0 {
+		return out[i+1:]
+	}
+	return out
+}
+
+func getReleaseInfo(payload string) (*Release, error) {
+	if err := checkOC(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("sh", "-c", fmt.Sprintf("oc adm release info %s --commit-urls -o json", payload))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	return parseReleaseInfoOutput(payload, out, stderr.String(), err)
+}
+
+// parseReleaseInfoOutput parses the release from the output of oc, the error of oc is translated to a readable one
+// and the warnings printed by oc are only logged in verbose mode.
+func parseReleaseInfoOutput(payload string, out []byte, stderr string, ocErr error) (*Release, error) {
+	warnings := strings.TrimSpace(stderr)
+	if ocErr != nil {
+		if strings.Contains(warnings, "image does not exist") {
+			return nil, fmt.Errorf("%w: %s, check the pullspec and your pull secret", ErrPayloadNotFound, payload)
+		}
+		return nil, fmt.Errorf("oc adm release info failed: %v: %s", ocErr, warnings)
+	}
+	if len(warnings) > 0 {
+		for _, line := range strings.Split(warnings, "\n") {
+			logVerbose("oc: %s", line)
+		}
+	}
+	release, err := ParseRelease(bytes.NewReader(releaseJSON(out)))
+	if err != nil {
+		if len(warnings) > 0 {
+			return nil, fmt.Errorf("%v (oc printed: %s)", err, warnings)
+		}
+		return nil, err
+	}
+	return &release, nil
+}
+
+// readReleaseInfoFile reads the release saved from "oc adm release info -o json", path "-" reads it from stdin.
+func readReleaseInfoFile(path string) (*Release, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	release, err := ParseRelease(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &release, nil
+}
+
+// getRepositoriesFromRelease returns the source repositories of the payload images and the tags skipped without one.
+func getRepositoriesFromRelease(release *Release, sourceAnnotations []string) ([]string, []SkippedTag) {
+	repositories, discoveredBy, skipped := release.Repositories(sourceAnnotations)
+	for _, key := range sourceAnnotations {
+		if discoveredBy[key] > 0 {
+			log.Printf("Discovered %d repositories via %s annotation", discoveredBy[key], key)
+		}
+	}
+	logMultipleCommits(release.RepositoryCommits(sourceAnnotations))
+	return repositories, skipped
+}
+
+func getRepositoriesFromPayload(payload string, sourceAnnotations []string) ([]string, []SkippedTag, error) {
+	release, err := getReleaseInfo(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	repositories, skipped := getRepositoriesFromRelease(release, sourceAnnotations)
+	return repositories, skipped, nil
+}
+
+// getCachedRepositoriesFromPayload is getRepositoriesFromPayload that reuses repositories already
+// extracted from the same payload.
+func getCachedRepositoriesFromPayload(payload string, sourceAnnotations []string, cache *Cache) ([]string, []SkippedTag, error) {
+	key := payload + "|" + strings.Join(sourceAnnotations, ",")
+	if repositories, skipped, ok := cache.getPayload(key); ok {
+		return repositories, skipped, nil
+	}
+	repositories, skipped, err := getRepositoriesFromPayload(payload, sourceAnnotations)
+	if err != nil {
+		return nil, nil, err
+	}
+	cache.setPayload(key, repositories, skipped)
+	return repositories, skipped, nil
+}
+
+// Repositories returns unique source repositories of all payload images, together with the number
+// of repositories discovered via each annotation key and the tags skipped without a Github repository.
+func (r *Release) Repositories(sourceAnnotations []string) ([]string, map[string]int, []SkippedTag) {
+	var repositories []string
+	var skipped []SkippedTag
+	discoveredBy := map[string]int{}
+	for _, t := range r.Refs.Spec.Tags {
+		if reason := t.skipReason(sourceAnnotations); len(reason) > 0 {
+			skipped = append(skipped, SkippedTag{Name: t.Name, Reason: reason, Annotations: t.Annotations})
+			continue
+		}
+		sourceLocation, _, key, _ := t.Source(sourceAnnotations)
+		hasRepository := false
+		for _, r := range repositories {
+			if sourceLocation == r {
+				hasRepository = true
+				break
+			}
+		}
+		if !hasRepository {
+			repositories = append(repositories, sourceLocation)
+			discoveredBy[key]++
+		}
+	}
+	return repositories, discoveredBy, skipped
+}
+
+// logSkippedTags logs the number of payload tags skipped without a source repository, or each of them with its
+// annotations when show is set (see -show-skipped-tags).
+func logSkippedTags(skipped []SkippedTag, show bool) {
+	if len(skipped) == 0 {
+		return
+	}
+	if !show {
+		log.Printf("Skipped %d tags without source info, use -show-skipped-tags for details", len(skipped))
+		return
+	}
+	log.Printf("Skipped %d tags without source info:", len(skipped))
+	for _, t := range skipped {
+		var annotations []string
+		for key, value := range t.Annotations {
+			annotations = append(annotations, key+"="+value)
+		}
+		sort.Strings(annotations)
+		if len(annotations) == 0 {
+			log.Printf("  %s: %s", t.Name, t.Reason)
+			continue
+		}
+		log.Printf("  %s: %s (%s)", t.Name, t.Reason, strings.Join(annotations, ", "))
+	}
+}
+
+// Commits returns the source commit each repository was built from.
+func (r *Release) Commits(sourceAnnotations []string) map[string]string {
+	commits := map[string]string{}
+	for _, t := range r.Refs.Spec.Tags {
+		sourceLocation, commit, _, ok := t.Source(sourceAnnotations)
+		if !ok || len(commit) == 0 {
+			continue
+		}
+		commits[sourceLocation] = commit
+	}
+	return commits
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readReleaseFixture(t *testing.T, name string) *Release {
+	t.Helper()
+	release, err := readReleaseInfoFile(filepath.Join("testdata", "release", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+func TestReleaseRepositories(t *testing.T) {
+	tests := []struct {
+		fixture      string
+		annotations  []string
+		repositories []string
+		discoveredBy map[string]int
+		commits      map[string]string
+		// skipped are the reasons of the skipped tags
+		skipped map[string]string
+	}{
+		{
+			fixture:      "classic.json",
+			annotations:  defaultSourceAnnotations,
+			repositories: []string{"https://github.com/openshift/oc", "https://github.com/openshift/console"},
+			discoveredBy: map[string]int{sourceLocationAnnotation: 2},
+			commits: map[string]string{
+				"https://github.com/openshift/oc":      "a5f9aba2cbb0b5e4bfc0b4bc3c5c3e3ba3a2c6e1",
+				"https://github.com/openshift/console": "276e9d485897af3d9ad28236635e94324e03336e",
+			},
+		},
+		{
+			// tags built from the same repository (with and without .git) list it once, tags with missing or empty
+			// source annotations and outside of Github are skipped
+			fixture:      "release-info.json",
+			annotations:  defaultSourceAnnotations,
+			repositories: []string{"https://github.com/openshift/oc", "https://github.com/openshift/api"},
+			discoveredBy: map[string]int{sourceLocationAnnotation: 1, imageSourceAnnotation: 1},
+			commits: map[string]string{
+				"https://github.com/openshift/oc":  "762941318ee16e59dabbacb1b4049eec22f0d303",
+				"https://github.com/openshift/api": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e",
+			},
+			skipped: map[string]string{"machine-os-content": skippedNoAnnotation, "pod": skippedNoAnnotation, "must-gather": skippedEmptyValue, "rhel-coreos": skippedNonGithubURL},
+		},
+		{
+			fixture:      "konflux.json",
+			annotations:  defaultSourceAnnotations,
+			repositories: []string{"https://github.com/openshift/oc", "https://github.com/openshift/console", "https://github.com/openshift/installer", "https://github.com/openshift/etcd"},
+			discoveredBy: map[string]int{sourceLocationAnnotation: 1, imageSourceAnnotation: 3},
+			commits: map[string]string{
+				"https://github.com/openshift/oc": "c3d1f0e9b8a7c6d5e4f3a2b1c0d9e8f7a6b5c4d3",
+				// the revision annotation wins over the fragment of the source
+				"https://github.com/openshift/console":   "9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c",
+				"https://github.com/openshift/installer": "",
+				"https://github.com/openshift/etcd":      "",
+			},
+		},
+		{
+			// only the classic annotations, the Konflux images are skipped
+			fixture:      "konflux.json",
+			annotations:  []string{sourceLocationAnnotation},
+			repositories: []string{"https://github.com/openshift/oc"},
+			discoveredBy: map[string]int{sourceLocationAnnotation: 1},
+			commits:      map[string]string{"https://github.com/openshift/oc": "c3d1f0e9b8a7c6d5e4f3a2b1c0d9e8f7a6b5c4d3"},
+		},
+	}
+	for _, test := range tests {
+		release := readReleaseFixture(t, test.fixture)
+		repositories, discoveredBy, skipped := release.Repositories(test.annotations)
+		if !reflect.DeepEqual(repositories, test.repositories) {
+			t.Errorf("%s %v: expected repositories %v, got %v", test.fixture, test.annotations, test.repositories, repositories)
+		}
+		if !reflect.DeepEqual(discoveredBy, test.discoveredBy) {
+			t.Errorf("%s %v: expected discovered %v, got %v", test.fixture, test.annotations, test.discoveredBy, discoveredBy)
+		}
+		reasons := map[string]string{}
+		for _, tag := range skipped {
+			reasons[tag.Name] = tag.Reason
+		}
+		if test.skipped != nil && !reflect.DeepEqual(reasons, test.skipped) {
+			t.Errorf("%s %v: expected skipped tags %v, got %v", test.fixture, test.annotations, test.skipped, reasons)
+		}
+		commits := release.Commits(test.annotations)
+		for repository, commit := range test.commits {
+			if commits[repository] != commit {
+				t.Errorf("%s %v: %s: expected commit %q, got %q", test.fixture, test.annotations, repository, commit, commits[repository])
+			}
+		}
+	}
+}
+
+func TestSkippedTags(t *testing.T) {
+	for source, expected := range map[string]string{
+		"https://github.com/openshift/oc":     "",
+		"https://gitlab.com/redhat/rhcos":     skippedNonGithubURL,
+		"https://pkgs.devel.redhat.com/rhcos": skippedNonGithubURL,
+		"not a repository":                    skippedUnparsableURL,
+		"https://github.com/openshift":        skippedUnparsableURL,
+		"":                                    skippedEmptyValue,
+	} {
+		tag := Tag{Name: "test", Annotations: map[string]string{sourceLocationAnnotation: source}}
+		if reason := tag.skipReason(defaultSourceAnnotations); reason != expected {
+			t.Errorf("%q: expected %q, got %q", source, expected, reason)
+		}
+	}
+
+	o := &queryOptions{releaseInfoFile: filepath.Join("testdata", "release", "release-info.json")}
+	output := captureLog(t, func() {
+		if _, err := o.repositories(defaultSourceAnnotations, NewCache()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(o.skippedTags) != 4 || !strings.Contains(output, "Skipped 4 tags without source info, use -show-skipped-tags for details") || strings.Contains(output, "rhel-coreos") {
+		t.Errorf("expected only the number of skipped tags logged, got %v:\n%s", o.skippedTags, output)
+	}
+	output = captureLog(t, func() { logSkippedTags(o.skippedTags, true) })
+	if !strings.Contains(output, "  rhel-coreos: non-GitHub source URL (io.openshift.build.source-location=https://gitlab.com/redhat/rhcos)") || !strings.Contains(output, "  pod: no source annotation\n") {
+		t.Errorf("expected every skipped tag with its annotations, got:\n%s", output)
+	}
+
+	// payload tooling owners find the skipped tags in the JSON metadata
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{SkippedTags: o.skippedTags}); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if skipped := report.Metadata.SkippedTags; len(skipped) != 4 || skipped[3].Name != "rhel-coreos" || skipped[3].Reason != skippedNonGithubURL || skipped[3].Annotations[sourceLocationAnnotation] != "https://gitlab.com/redhat/rhcos" {
+		t.Errorf("expected the skipped tags in the metadata, got:\n%s", out.String())
+	}
+}
+
+func TestNormalizeSourceURL(t *testing.T) {
+	tests := []struct {
+		value, repository, ref string
+	}{
+		{value: "https://github.com/openshift/oc", repository: "https://github.com/openshift/oc"},
+		{value: "https://github.com/openshift/oc.git", repository: "https://github.com/openshift/oc"},
+		{value: "git+https://github.com/openshift/console.git#release-4.16", repository: "https://github.com/openshift/console", ref: "release-4.16"},
+		{value: "git@github.com:openshift/etcd.git", repository: "https://github.com/openshift/etcd"},
+		{value: "http://github.com/openshift/api/", repository: "https://github.com/openshift/api"},
+		{value: " https://github.com/openshift/installer/tree/release-4.16 ", repository: "https://github.com/openshift/installer"},
+	}
+	for _, test := range tests {
+		repository, ref := normalizeSourceURL(test.value)
+		if repository != test.repository || ref != test.ref {
+			t.Errorf("%q: expected %q and %q, got %q and %q", test.value, test.repository, test.ref, repository, ref)
+		}
+	}
+}
+
+func TestParseRelease(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "release", "release-info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := ParseRelease(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(release.Refs.Spec.Tags) != 7 || !release.Config.Created.Equal(time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected release %+v", release)
+	}
+	if _, err := ParseRelease(strings.NewReader("error: image not found")); err == nil {
+		t.Errorf("expected an error parsing the output of a failed oc")
+	}
+	if _, err := readReleaseInfoFile(filepath.Join("testdata", "release", "missing.json")); err == nil {
+		t.Errorf("expected an error reading a missing file")
+	}
+}
+
+func TestParseReleaseInfoOutput(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "release", "release-info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		out      string
+		stderr   string
+		ocErr    error
+		expected string
+	}{
+		{name: "clean", out: string(data)},
+		{name: "warnings on stderr", out: string(data), stderr: "warning: the --commit-urls flag is deprecated\n"},
+		{name: "warnings before the JSON", out: "warning: unable to load the pull secret\nW0818 10:00:00.000000 1 client.go:42] retrying\n" + string(data)},
+		{name: "trailing noise", out: string(data) + "info: done\n"},
+		{name: "no JSON", out: "warning: unable to load the pull secret\n", stderr: "warning: deprecated flag", expected: "oc printed: warning: deprecated flag"},
+		{name: "missing image", stderr: "error: image does not exist or you don't have permission to access the repository", ocErr: errors.New("exit status 1"), expected: "payload not found: quay.io/x:1, check the pullspec and your pull secret"},
+		{name: "failed oc", stderr: "error: unable to connect", ocErr: errors.New("exit status 1"), expected: "oc adm release info failed: exit status 1: error: unable to connect"},
+	}
+	for _, test := range tests {
+		release, err := parseReleaseInfoOutput("quay.io/x:1", []byte(test.out), test.stderr, test.ocErr)
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case len(test.expected) == 0 && len(release.Refs.Spec.Tags) != 7:
+			t.Errorf("%s: expected the release tags, got %+v", test.name, release)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+		if missing := test.name == "missing image"; errors.Is(err, ErrPayloadNotFound) != missing {
+			t.Errorf("%s: expected errors.Is(ErrPayloadNotFound) to be %t, got %v", test.name, missing, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+	"github.com/xxjwxc/gowp/workpool"
+)
+
+// maxPendingSubjects is the number of pending commits shown for each repository in the table
+const maxPendingSubjects = 3
+
+// PendingCommit is a commit of the branch that is not in the payload yet.
+type PendingCommit struct {
+	SHA     string    `json:"sha"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+}
+
+// PendingRepository is the number of commits of the branch head ahead of the payload commit of a repository.
+type PendingRepository struct {
+	Repository    string `json:"repository"`
+	PayloadCommit string `json:"payloadCommit"`
+	// Tags are the payload tags built from the commit, set when the repository was built from several commits
+	// (see -multi-sha per-tag)
+	Tags  []string `json:"tags,omitempty"`
+	Ahead int      `json:"ahead"`
+	// NotOnBranch is set when the payload commit is not in the history of the branch (eg. after a force-push or a rebase)
+	NotOnBranch bool       `json:"notOnBranch,omitempty"`
+	Oldest      *time.Time `json:"oldestPending,omitempty"`
+	// Commits are the pending commits, oldest first, Github compares up to 250 commits
+	Commits []PendingCommit `json:"commits,omitempty"`
+}
+
+// PendingReport is the output of -pending.
+type PendingReport struct {
+	Payload      string              `json:"payload"`
+	Branch       string              `json:"branch"`
+	Repositories []PendingRepository `json:"repositories"`
+	// Pending is the number of pending commits of all repositories, UpToDate the number of repositories without any
+	Pending  int `json:"pending"`
+	UpToDate int `json:"upToDate"`
+
+	// durations renders the age of the oldest pending commits
+	durations Formatter
+}
+
+// PendingRow is a row of the -pending table.
+type PendingRow struct {
+	Repository string `header:"Repository"`
+	Ahead      string `header:"Ahead"`
+	Oldest     string `header:"Oldest pending"`
+	Commits    string `header:"Pending commits"`
+}
+
+// getPendingCommits compares the payload commit with the branch head. When the comparison does not find the commit
+// in a readable repository, it is not on the branch.
+func getPendingCommits(ctx context.Context, client *github.Client, organization, name, commit, branch string) (PendingRepository, error) {
+	pending := PendingRepository{PayloadCommit: commit}
+	comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, commit, branch)
+	if isNotFound(err) {
+		if _, _, repositoryErr := client.Repositories.Get(withCategory(ctx, categoryRepository), organization, name); repositoryErr == nil {
+			pending.NotOnBranch = true
+			return pending, nil
+		}
+	}
+	if err != nil {
+		return pending, err
+	}
+	switch comparison.GetStatus() {
+	case "behind", "diverged":
+		pending.NotOnBranch = true
+		return pending, nil
+	}
+	pending.Ahead = comparison.GetAheadBy()
+	for _, c := range comparison.Commits {
+		pending.Commits = append(pending.Commits, PendingCommit{
+			SHA:     c.GetSHA(),
+			Subject: commitSubject(c.GetCommit().GetMessage()),
+			Author:  commitAuthor(&c),
+			Date:    commitDate(&c),
+		})
+	}
+	if len(pending.Commits) > 0 {
+		oldest := pending.Commits[0].Date
+		pending.Oldest = &oldest
+	}
+	return pending, nil
+}
+
+// newPendingReport sorts the repositories by the number of pending commits, those not on the branch first, their
+// ages are rendered by the formatter.
+func newPendingReport(payload, branch string, repositories []PendingRepository, durations Formatter) PendingReport {
+	sort.SliceStable(repositories, func(i, j int) bool {
+		if repositories[i].NotOnBranch != repositories[j].NotOnBranch {
+			return repositories[i].NotOnBranch
+		}
+		return repositories[i].Ahead > repositories[j].Ahead
+	})
+	report := PendingReport{Payload: payload, Branch: branch, Repositories: repositories, durations: durations}
+	for _, r := range repositories {
+		report.Pending += r.Ahead
+		if r.Ahead == 0 && !r.NotOnBranch {
+			report.UpToDate++
+		}
+	}
+	return report
+}
+
+func (r PendingReport) rows() []PendingRow {
+	var rows []PendingRow
+	for _, p := range r.Repositories {
+		row := PendingRow{Repository: repositoryName(p.Repository), Ahead: fmt.Sprintf("%d", p.Ahead)}
+		if len(p.Tags) > 0 {
+			row.Repository += "\n(" + strings.Join(p.Tags, ", ") + ")"
+		}
+		if p.NotOnBranch {
+			row.Ahead = "NOT ON BRANCH"
+			row.Commits = fmt.Sprintf("payload commit %s is not in %s (force-push or rebase?)", shortSHA(p.PayloadCommit), r.Branch)
+		}
+		if p.Oldest != nil {
+			row.Oldest = formatterOrNow(r.durations).Ago(*p.Oldest)
+		}
+		var subjects []string
+		for i, c := range p.Commits {
+			if i == maxPendingSubjects {
+				subjects = append(subjects, fmt.Sprintf("(… %d more)", p.Ahead-maxPendingSubjects))
+				break
+			}
+			subjects = append(subjects, c.Subject)
+		}
+		if len(subjects) > 0 {
+			row.Commits = strings.Join(subjects, "\n")
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func writePendingReport(w io.Writer, format string, report PendingReport) error {
+	switch format {
+	case formatTable:
+		tableprinter.New(w).Print(report.rows())
+		fmt.Fprintf(w, "\n%d commits pending in %s, %d of %d repositories have no pending commits\n", report.Pending, report.Branch, report.UpToDate, len(report.Repositories))
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q, -pending supports %s and %s", format, formatTable, formatJSON)
+	}
+}
+
+// collectPending compares the payload commit of each repository with the branch head. Repositories built from
+// several commits have each of them compared, or only the newest one with -multi-sha newest.
+func collectPending(ctx context.Context, client *github.Client, concurrency int, repositories []string, commits map[string][]PayloadCommit, branch, multiSHA string) ([]PendingRepository, []RepositoryError, error) {
+	log.Printf("Comparing %d repositories with %s branch ...", len(repositories), branch)
+	var (
+		lock    sync.Mutex
+		pending []PendingRepository
+		errs    []RepositoryError
+	)
+	wp := workpool.New(concurrency)
+	for i := range repositories {
+		repository := repositories[i]
+		wp.Do(func() error {
+			organization, name, ok := parseRepositoryOrgName(repository)
+			if !ok || len(commits[repository]) == 0 {
+				logVerbose("[%s] has no payload commit, skipping", repository)
+				return nil
+			}
+			built := commits[repository]
+			if len(built) > 1 && multiSHA == multiSHANewest {
+				order, err := orderPayloadCommits(ctx, client, organization, name, built)
+				if err != nil {
+					log.Printf("[%s] %v", repository, err)
+					lock.Lock()
+					defer lock.Unlock()
+					errs = append(errs, RepositoryError{Repository: repository, Kind: classifyRepositoryError(organization, err), Err: err})
+					return nil
+				}
+				log.Printf("[%s] is built from %d commits, comparing the newest %s of %s", repository, len(built), shortSHA(order.Newest.Commit), strings.Join(order.Newest.Tags, ", "))
+				built = []PayloadCommit{order.Newest}
+			}
+			for _, c := range built {
+				p, err := getPendingCommits(ctx, client, organization, name, c.Commit, branch)
+				lock.Lock()
+				if err != nil {
+					log.Printf("[%s] %v", repository, err)
+					errs = append(errs, RepositoryError{Repository: repository, Kind: classifyRepositoryError(organization, err), Err: err})
+					lock.Unlock()
+					return nil
+				}
+				p.Repository = repository
+				if len(built) > 1 {
+					p.Tags = c.Tags
+				}
+				pending = append(pending, p)
+				lock.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := wp.Wait(); err != nil {
+		return nil, nil, err
+	}
+	return pending, errs, nil
+}
+
+// runPending reports the commits of the branch that are not in the payload yet, one comparison per repository.
+func runPending(ctx context.Context, shared *sharedOptions, o *queryOptions) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	processOptions, err := o.processOptions(shared)
+	if err != nil {
+		return err
+	}
+	branch := processOptions.BranchName
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	release, err := o.release()
+	if err != nil {
+		return err
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	repositories, err := o.repositories(shared.sourceAnnotations, cache)
+	if err != nil {
+		return err
+	}
+	repositories = o.ignore.filterRepositories(repositories)
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+	if err := shared.checkToken(ctx, client, repositories); err != nil {
+		return err
+	}
+	pending, errs, err := collectPending(ctx, client, shared.concurrency, repositories, release.RepositoryCommits(shared.sourceAnnotations), branch, o.multiSHA)
+	if err != nil {
+		return err
+	}
+
+	payload := o.payload
+	if label := newReleaseLabel(o.releaseSource(), release); len(o.releaseSource()) > 0 && len(label.Version) > 0 {
+		payload = label.Version
+	}
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writePendingReport(out, shared.format, newPendingReport(payload, branch, pending, processOptions.Durations)); err != nil {
+		out.Close()
+		return err
+	}
+	printErrorSummary(errs)
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return repositoryErrorsResult(errs)
+}
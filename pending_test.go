@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakePendingGithub compares the payload commits of openshift repositories with the master branch: openshift/api
+// is 4 commits ahead, openshift/oc is up to date, the payload commit of openshift/console was force-pushed away,
+// openshift/origin diverged and openshift/secret can't be read.
+func fakePendingGithub(t *testing.T) *github.Client {
+	commit := func(sha, message string, age time.Duration) string {
+		return fmt.Sprintf(`{"sha": %q, "commit": {"message": %q, "author": {"email": "mfojtik@redhat.com"}, "committer": {"date": %q}}, "author": {"login": "mfojtik"}}`, sha, message, time.Now().Add(-age).Format(time.RFC3339))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api/compare/a1...master":
+			fmt.Fprintf(w, `{"status": "ahead", "ahead_by": 4, "commits": [%s, %s, %s, %s]}`, commit("a2", "Bump the API\n\nBody", 5*time.Hour), commit("a3", "Fix the CRD", 4*time.Hour), commit("a4", "Add a field", 2*time.Hour), commit("a5", "Drop a field", time.Hour))
+		case "/repos/openshift/oc/compare/b1...master":
+			fmt.Fprint(w, `{"status": "identical", "ahead_by": 0, "commits": []}`)
+		case "/repos/openshift/origin/compare/d1...master":
+			fmt.Fprint(w, `{"status": "diverged", "ahead_by": 3, "behind_by": 2, "commits": []}`)
+		case "/repos/openshift/console":
+			fmt.Fprint(w, `{"name": "console", "fork": false}`)
+		case "/repos/openshift/console/compare/c1...master", "/repos/openshift/secret/compare/e1...master", "/repos/openshift/secret":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestPendingReport(t *testing.T) {
+	var repositories []string
+	commits := map[string][]PayloadCommit{}
+	for name, commit := range map[string]string{"api": "a1", "oc": "b1", "console": "c1", "origin": "d1", "secret": "e1", "installer": ""} {
+		repository := "https://github.com/openshift/" + name
+		repositories = append(repositories, repository)
+		if len(commit) > 0 {
+			commits[repository] = []PayloadCommit{{Commit: commit, Tags: []string{name}}}
+		}
+	}
+	var (
+		pending []PendingRepository
+		errs    []RepositoryError
+	)
+	captureLog(t, func() {
+		var err error
+		if pending, errs, err = collectPending(context.Background(), fakePendingGithub(t), 2, repositories, commits, "master", multiSHAPerTag); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(errs) != 1 || errs[0].Repository != "https://github.com/openshift/secret" {
+		t.Errorf("expected openshift/secret to fail, got %v", errs)
+	}
+	report := newPendingReport("4.9.0-0.nightly", "master", pending, nil)
+	var order []string
+	for _, r := range report.Repositories {
+		order = append(order, repositoryName(r.Repository))
+	}
+	// the repositories whose payload commit is not on the branch first, then the most pending
+	if len(order) != 4 || order[2] != "openshift/api" || order[3] != "openshift/oc" || !report.Repositories[0].NotOnBranch || !report.Repositories[1].NotOnBranch {
+		t.Errorf("unexpected order %v", order)
+	}
+	if report.Pending != 4 || report.UpToDate != 1 {
+		t.Errorf("expected 4 pending commits and 1 repository up to date, got %d and %d", report.Pending, report.UpToDate)
+	}
+	api := report.Repositories[2]
+	if len(api.Commits) != 4 || api.Commits[0].Subject != "Bump the API" || api.Commits[0].Author != "mfojtik" || api.Oldest == nil || !api.Oldest.Equal(api.Commits[0].Date) {
+		t.Errorf("expected the pending commits oldest first, got %+v", api)
+	}
+
+	var out bytes.Buffer
+	if err := writePendingReport(&out, formatTable, report); err != nil {
+		t.Fatal(err)
+	}
+	table := out.String()
+	for _, expected := range []string{"NOT ON BRANCH", "payload commit c1 is not in master (force-push or rebase?)", "Add a field", "(… 1 more)", "4 commits pending in master, 1 of 4 repositories have no pending commits"} {
+		if !strings.Contains(table, expected) {
+			t.Errorf("expected %q in:\n%s", expected, table)
+		}
+	}
+	if strings.Contains(table, "Drop a field") {
+		t.Errorf("expected only %d pending commits in the table, got:\n%s", maxPendingSubjects, table)
+	}
+	out.Reset()
+	if err := writePendingReport(&out, formatJSON, report); err != nil {
+		t.Fatal(err)
+	}
+	if json := out.String(); !strings.Contains(json, `"subject": "Drop a field"`) || !strings.Contains(json, `"notOnBranch": true`) || !strings.Contains(json, `"upToDate": 1`) {
+		t.Errorf("expected all pending commits in the JSON, got:\n%s", json)
+	}
+	if err := writePendingReport(&out, formatHTML, report); err == nil {
+		t.Errorf("expected an unsupported format to fail")
+	}
+}
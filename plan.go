@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+)
+
+// PlannedFeature is a feature enabled by the flags with the extra Github requests it makes.
+type PlannedFeature struct {
+	Feature string `header:"Feature" json:"feature"`
+	// PerCommit and PerItem are the requests made for every change and every work item
+	PerCommit int `header:"Requests per change" json:"requestsPerCommit"`
+	PerItem   int `header:"Requests per item" json:"requestsPerItem"`
+}
+
+// plannedFeatures returns the enabled features making extra requests, perCommitRequests sums their requests per
+// change.
+func plannedFeatures(options ProcessOptions) []PlannedFeature {
+	var features []PlannedFeature
+	if options.WithPullRequests {
+		features = append(features, PlannedFeature{Feature: "pull requests", PerCommit: 1})
+	}
+	if options.WithBackports {
+		// one search of cherry-picks per pull request
+		features = append(features, PlannedFeature{Feature: "backports", PerCommit: 1})
+	}
+	if options.WithRetests {
+		features = append(features, PlannedFeature{Feature: "retests", PerCommit: 1})
+	}
+	if options.ClassifyPaths {
+		features = append(features, PlannedFeature{Feature: "changed files", PerCommit: 1})
+	}
+	if options.WithCodeowners {
+		features = append(features, PlannedFeature{Feature: "codeowners", PerItem: 1})
+	}
+	if options.WithBranchPresence {
+		// the release branches are listed unless given, then the commits of each of them
+		branches := len(options.PresenceBranches)
+		if branches == 0 {
+			branches = defaultPresenceBranches + 1
+		}
+		features = append(features, PlannedFeature{Feature: "branch presence", PerItem: branches})
+	}
+	return features
+}
+
+// PlannedWorkItem is a repository and branch the run would list changes of.
+type PlannedWorkItem struct {
+	Repository string `header:"Repository" json:"repository"`
+	Branch     string `header:"Branch" json:"branch"`
+	// Mirrors are listed instead of the repository when the token can't read it (see -repo-alias)
+	Mirrors []string `json:"mirrors,omitempty"`
+	Mirror  string   `header:"Mirrors" json:"-"`
+	// Reused are the cache (parent, commits) and resume entries the work item reuses instead of requests
+	Reused      []string `json:"reused,omitempty"`
+	ReusedLabel string   `header:"Reused" json:"-"`
+	// Requests is the least number of requests of the work item, without those made for each change
+	Requests int `header:"Least requests" json:"minRequests"`
+}
+
+// ExecutionPlan is what a run would do, printed by -dry-run instead of making Github requests.
+type ExecutionPlan struct {
+	Payload   string            `json:"payload"`
+	Branch    string            `json:"branch"`
+	Window    *Window           `json:"window"`
+	WorkItems []PlannedWorkItem `json:"workItems"`
+	Features  []PlannedFeature  `json:"features,omitempty"`
+	// MinRequests is the least number of requests of the run, RequestsPerCommit are made for every change on top
+	MinRequests       int `json:"minRequests"`
+	RequestsPerCommit int `json:"requestsPerCommit"`
+	// Messages is how much of the commit messages is kept at collection time, and why
+	Messages string `json:"messages,omitempty"`
+	// RateLimit is the current core rate limit, with -dry-run-with-quota
+	RateLimit *RateLimitSnapshot `json:"rateLimit,omitempty"`
+}
+
+// planWorkItems returns the plan of the work items, from the cache and the resume state of the options only.
+func planWorkItems(options ProcessOptions, items []branchWorkItem, window *Window) ExecutionPlan {
+	plan := ExecutionPlan{Branch: options.BranchName, Window: window, Features: plannedFeatures(options), RequestsPerCommit: perCommitRequests(options)}
+	perItem := 0
+	for _, f := range plan.Features {
+		perItem += f.PerItem
+	}
+	for _, item := range items {
+		planned := PlannedWorkItem{Repository: item.Repository, Branch: item.Branch, Mirrors: repositoryAlternatives(item.Repository, options.RepositoryAliases)}
+		planned.Mirror = strings.Join(planned.Mirrors, "\n")
+		if _, _, ok := options.Resume.Get(item.Repository); ok && item.Branch == options.BranchName {
+			planned.Reused = append(planned.Reused, "resume")
+		} else {
+			planned.Requests = perItem
+			if organization, name, ok := parseRepositoryOrgName(item.Repository); ok {
+				if _, ok := options.Cache.getParent(organization, name); ok {
+					planned.Reused = append(planned.Reused, "parent")
+				} else {
+					planned.Requests++
+				}
+				// the first-parent history is not cached
+				if _, ok := options.Cache.getCommits(organization, name, item.Branch, window.Since); ok && !options.FirstParent {
+					planned.Reused = append(planned.Reused, "commits")
+				} else {
+					planned.Requests++
+				}
+			}
+		}
+		planned.ReusedLabel = strings.Join(planned.Reused, ", ")
+		plan.MinRequests += planned.Requests
+		plan.WorkItems = append(plan.WorkItems, planned)
+	}
+	return plan
+}
+
+// printPlan writes the execution plan of the query instead of running it (see -dry-run), the rate limit check of
+// -dry-run-with-quota is its only Github request.
+func printPlan(ctx context.Context, shared *sharedOptions, o *queryOptions) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if len(o.fromRaw) > 0 {
+		return fmt.Errorf("-dry-run plans the Github requests of a collection, -from-raw makes none")
+	}
+	if shared.format != formatTable && shared.format != formatJSON {
+		return fmt.Errorf("invalid -format %q of -dry-run, expected %s or %s", shared.format, formatTable, formatJSON)
+	}
+	processOptions, err := o.processOptions(shared)
+	if err != nil {
+		return err
+	}
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	processOptions.Cache = cache
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	work, err := o.planWork(ctx, nil, shared, processOptions, nil, cache, true)
+	if err != nil {
+		return err
+	}
+	plan := planWorkItems(work.Options, work.Items, work.Window)
+	plan.Payload = o.payload
+	_, plan.Messages = o.messageLines()
+	if o.dryRunWithQuota {
+		client, err := shared.githubClient()
+		if err != nil {
+			return err
+		}
+		if err := plan.checkQuota(ctx, client); err != nil {
+			return err
+		}
+	}
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeExecutionPlan(out, shared.format, plan); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkQuota sets the current core rate limit of the plan, the only request of -dry-run-with-quota.
+func (p *ExecutionPlan) checkQuota(ctx context.Context, client *github.Client) error {
+	limits, _, err := client.RateLimits(withCategory(ctx, categoryOther))
+	if err != nil {
+		return fmt.Errorf("unable to check the Github rate limit: %v", err)
+	}
+	if core := limits.GetCore(); core != nil {
+		p.RateLimit = &RateLimitSnapshot{Limit: core.Limit, Remaining: core.Remaining, Reset: core.Reset.Time}
+	}
+	return nil
+}
+
+// writeExecutionPlan writes the plan as a table, or as JSON.
+func writeExecutionPlan(w io.Writer, format string, plan ExecutionPlan) error {
+	if format == formatJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	fmt.Fprintf(w, "Dry run of %s, %s branch, changes since %s:\n", plan.Payload, plan.Branch, formatTime(plan.Window.Since))
+	if len(plan.Window.PreviousPayload) > 0 {
+		fmt.Fprintf(w, "The window starts at the previous payload %s.\n", plan.Window.PreviousPayload)
+	}
+	fmt.Fprintf(w, "\nWork items (%d):\n", len(plan.WorkItems))
+	tableprinter.New(w).Print(plan.WorkItems)
+	if len(plan.Features) > 0 {
+		fmt.Fprintf(w, "\nFeatures:\n")
+		tableprinter.New(w).Print(plan.Features)
+	}
+	fmt.Fprintf(w, "\nAt least %d Github requests, with %d more per change and 1 more per additional page of %d changes.\n", plan.MinRequests, plan.RequestsPerCommit, commitsPerPage)
+	if len(plan.Messages) > 0 {
+		fmt.Fprintf(w, "Messages: %s.\n", plan.Messages)
+	}
+	if plan.RateLimit != nil {
+		fmt.Fprintf(w, "%d of %d requests remaining, reset %s.\n", plan.RateLimit.Remaining, plan.RateLimit.Limit, formatTime(plan.RateLimit.Reset))
+	}
+	return nil
+}
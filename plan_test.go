@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestPlannedFeatures(t *testing.T) {
+	options := ProcessOptions{WithPullRequests: true, WithBackports: true, ClassifyPaths: true, WithCodeowners: true, WithBranchPresence: true}
+	var features []string
+	for _, f := range plannedFeatures(options) {
+		features = append(features, f.Feature)
+	}
+	if expected := []string{"pull requests", "backports", "changed files", "codeowners", "branch presence"}; !reflect.DeepEqual(features, expected) {
+		t.Errorf("expected %v, got %v", expected, features)
+	}
+	if requests := perCommitRequests(options); requests != 3 {
+		t.Errorf("expected 3 requests per change, got %d", requests)
+	}
+	// the release branches are listed unless given
+	if presence := plannedFeatures(ProcessOptions{WithBranchPresence: true})[0]; presence.PerItem != defaultPresenceBranches+1 {
+		t.Errorf("expected the release branches listed, got %+v", presence)
+	}
+	if presence := plannedFeatures(ProcessOptions{WithBranchPresence: true, PresenceBranches: []string{"release-4.9"}})[0]; presence.PerItem != 1 {
+		t.Errorf("expected the commits of the given branch listed, got %+v", presence)
+	}
+	if requests := perCommitRequests(ProcessOptions{}); requests != 0 {
+		t.Errorf("expected no requests per change without features, got %d", requests)
+	}
+}
+
+func TestPlanWorkItems(t *testing.T) {
+	since := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	api, oc, priv := "https://github.com/openshift/api", "https://github.com/openshift/oc", "https://github.com/openshift-priv/console"
+	cache := NewCache()
+	cache.setParent("openshift", "api", &github.Repository{})
+	cache.setCommits("openshift", "api", "master", since, []*github.RepositoryCommit{})
+	key := resumeKey(ProcessOptions{BranchName: "master"}, "1d")
+	resume, err := loadResumeState(filepath.Join(t.TempDir(), "cache.json"), key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resume.Record(oc, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	options := ProcessOptions{BranchName: "master", WithCodeowners: true, WithPullRequests: true, Cache: cache, Resume: resume}
+	items := []branchWorkItem{{Repository: api, Branch: "master"}, {Repository: oc, Branch: "master"}, {Repository: oc, Branch: "release-4.9"}, {Repository: priv, Branch: "master"}}
+	plan := planWorkItems(options, items, &Window{Since: since})
+
+	var reused []string
+	var requests []int
+	for _, item := range plan.WorkItems {
+		reused = append(reused, item.ReusedLabel)
+		requests = append(requests, item.Requests)
+	}
+	// only the first branch of a repository is resumed
+	if expected := []string{"parent, commits", "resume", "", ""}; !reflect.DeepEqual(reused, expected) {
+		t.Errorf("expected the reused entries %q, got %q", expected, reused)
+	}
+	if expected := []int{1, 0, 3, 3}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+	if plan.MinRequests != 7 || plan.RequestsPerCommit != 1 || len(plan.Features) != 2 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if mirrors := plan.WorkItems[3].Mirrors; !reflect.DeepEqual(mirrors, []string{"https://github.com/openshift/console"}) {
+		t.Errorf("expected the public mirror of the private repository, got %v", mirrors)
+	}
+
+	plan.Payload = "4.9.0-0.nightly"
+	var out bytes.Buffer
+	if err := writeExecutionPlan(&out, formatTable, plan); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Dry run of 4.9.0-0.nightly, master branch, changes since", "Work items (4):", "release-4.9", "codeowners", "At least 7 Github requests, with 1 more per change"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+	out.Reset()
+	if err := writeExecutionPlan(&out, formatJSON, plan); err != nil {
+		t.Fatal(err)
+	}
+	var decoded ExecutionPlan
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MinRequests != 7 || len(decoded.WorkItems) != 4 || !reflect.DeepEqual(decoded.WorkItems[0].Reused, []string{"parent", "commits"}) {
+		t.Errorf("unexpected JSON plan %+v", decoded)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// postTimeout bounds a single post to an external sink
+const postTimeout = 30 * time.Second
+
+// postStateFile remembers when the last post was made, so restarted runs keep the heartbeat schedule.
+type postStateFile struct {
+	LastPost time.Time `json:"lastPost"`
+}
+
+// postGate decides whether a report is posted to external sinks (see -post-webhook): reports with fewer than
+// minChanges changes are skipped, except for a heartbeat post when nothing was posted for heartbeatEvery. It is
+// shared by all sinks, stdout and file outputs are not gated.
+type postGate struct {
+	minChanges     int
+	heartbeatEvery time.Duration
+	// statePath persists the time of the last post, required by the heartbeat
+	statePath string
+	// now is the clock, replaced to test the heartbeat schedule
+	now func() time.Time
+}
+
+func newPostGate(minChanges int, heartbeatEvery time.Duration, statePath string) (*postGate, error) {
+	if minChanges < 0 {
+		return nil, fmt.Errorf("-post-min-changes must not be negative")
+	}
+	if heartbeatEvery > 0 && len(statePath) == 0 {
+		return nil, fmt.Errorf("-post-heartbeat-every requires -post-state-file")
+	}
+	return &postGate{minChanges: minChanges, heartbeatEvery: heartbeatEvery, statePath: statePath, now: time.Now}, nil
+}
+
+// lastPost returns the time of the last post, zero when there was none or the state is unreadable.
+func (g *postGate) lastPost() time.Time {
+	if len(g.statePath) == 0 {
+		return time.Time{}
+	}
+	data, err := ioutil.ReadFile(g.statePath)
+	if os.IsNotExist(err) {
+		return time.Time{}
+	}
+	var state postStateFile
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		log.Printf("WARNING: ignoring unreadable post state file %s: %v", g.statePath, err)
+	}
+	return state.LastPost
+}
+
+// decide returns whether the report with the number of changes is posted, and whether as a heartbeat of a quiet
+// period (the report then has fewer than minChanges changes).
+func (g *postGate) decide(changes int) (post, heartbeat bool) {
+	if changes >= g.minChanges {
+		return true, false
+	}
+	if g.heartbeatEvery <= 0 {
+		return false, false
+	}
+	last := g.lastPost()
+	return last.IsZero() || g.now().Sub(last) >= g.heartbeatEvery, true
+}
+
+// posted records a successful post, the heartbeat waits heartbeatEvery from it.
+func (g *postGate) posted() error {
+	if len(g.statePath) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(postStateFile{LastPost: g.now()})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(g.statePath, data, 0)
+}
+
+// postWebhook posts the text as {"text": ...}, the payload of Slack incoming webhooks (and many others).
+func postWebhook(ctx context.Context, url, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook responded %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// heartbeatText is posted instead of a report with too few changes, eg. "Nothing merged to master in the last 6h"
+// when posted 6h after since.
+func heartbeatText(changes int, branch string, since, now time.Time, durations Formatter) string {
+	what := "Nothing"
+	if changes > 0 {
+		what = fmt.Sprintf("Only %d changes", changes)
+	}
+	return fmt.Sprintf("%s merged to %s in the last %s", what, branch, durations.Duration(now.Sub(since)))
+}
+
+// postReport posts the rendered report (or a heartbeat) to the -post-webhook when the gate allows it, failures to
+// post are logged and don't fail the run. The heartbeat covers the window since the last post, or since the start
+// of the window when it is older.
+func postReport(ctx context.Context, gate *postGate, url string, rendered []byte, changes int, branch string, since time.Time, durations Formatter) {
+	post, heartbeat := gate.decide(changes)
+	switch {
+	case !post && heartbeat:
+		log.Printf("Skipped posting %d changes (-post-min-changes %d), the last heartbeat is more recent than -post-heartbeat-every %s", changes, gate.minChanges, gate.heartbeatEvery)
+		return
+	case !post:
+		log.Printf("Skipped posting %d changes (-post-min-changes %d)", changes, gate.minChanges)
+		return
+	}
+	text := string(rendered)
+	if heartbeat {
+		if last := gate.lastPost(); !last.IsZero() && last.Before(since) {
+			since = last
+		}
+		text = heartbeatText(changes, branch, since, gate.now(), durations)
+	}
+	if err := postWebhook(ctx, url, text); err != nil {
+		log.Printf("WARNING: unable to post to the webhook: %v", err)
+		return
+	}
+	if err := gate.posted(); err != nil {
+		log.Printf("WARNING: unable to record the post in %s: %v", gate.statePath, err)
+	}
+	if heartbeat {
+		log.Printf("Posted a heartbeat of %d changes to the webhook", changes)
+		return
+	}
+	log.Printf("Posted %d changes to the webhook", changes)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-github/github"
+)
+
+var (
+	// mergeCommitPullRequest matches the merge commits of pull requests (eg. "Merge pull request #1234 from user/branch")
+	mergeCommitPullRequest = regexp.MustCompile(`^Merge pull request #([0-9]+) from`)
+	// squashedPullRequest matches the subject of squash merged pull requests (eg. "Fix the thing (#1234)")
+	squashedPullRequest = regexp.MustCompile(`\(#([0-9]+)\)$`)
+)
+
+// parseCommitPullRequests returns the pull request of each listed commit known without requests: the commits
+// reachable from the second parent of a "Merge pull request" commit until the mainline belong to its pull request,
+// mainline commits with a "(#1234)" subject are squash merged pull requests.
+func parseCommitPullRequests(commits []*github.RepositoryCommit) map[string]int {
+	bySHA := map[string]*github.RepositoryCommit{}
+	for _, c := range commits {
+		bySHA[c.GetSHA()] = c
+	}
+	pulls := map[string]int{}
+	if len(commits) == 0 {
+		return pulls
+	}
+
+	mainline := mainlineCommits(commits, bySHA)
+	for _, c := range commits {
+		message := c.GetCommit().GetMessage()
+		if !mainline[c.GetSHA()] {
+			continue
+		}
+		if match := squashedPullRequest.FindStringSubmatch(commitSubject(message)); match != nil && !isMergeCommit(c) {
+			pulls[c.GetSHA()], _ = strconv.Atoi(match[1])
+			continue
+		}
+		match := mergeCommitPullRequest.FindStringSubmatch(message)
+		if match == nil || len(c.Parents) < 2 {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		pending := []string{c.Parents[1].GetSHA()}
+		for len(pending) > 0 {
+			sha := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			parent, listed := bySHA[sha]
+			if !listed || mainline[sha] || pulls[sha] != 0 {
+				continue
+			}
+			pulls[sha] = number
+			for _, p := range parent.Parents {
+				pending = append(pending, p.GetSHA())
+			}
+		}
+	}
+	return pulls
+}
+
+// changePullRequest returns the pull request of the change, from the Github API (see -with-prs) or parsed from the
+// history, known is false when it is not known whether the change was merged by a pull request.
+func changePullRequest(raw RawChange) (int, bool) {
+	switch {
+	case raw.PullRequest > 0:
+		return raw.PullRequest, true
+	case raw.ParsedPullRequest > 0:
+		return raw.ParsedPullRequest, true
+	case raw.MergeMethod == mergeMethodDirectPush:
+		return 0, true
+	}
+	return 0, false
+}
+
+// RepositoryPullRequests are the number of changes and of the distinct pull requests merging them in a repository.
+type RepositoryPullRequests struct {
+	Repository string `header:"Repository" json:"repository"`
+	Commits    int    `header:"Commits" json:"commits"`
+	PRs        string `header:"PRs" json:"-"`
+	// PullRequests is at least the number of pull requests when Incomplete is set
+	PullRequests int  `json:"pullRequests"`
+	Incomplete   bool `json:"incomplete,omitempty"`
+	// Unknown is the number of changes whose pull request is not known
+	Unknown      int     `json:"unknown,omitempty"`
+	PerPR        string  `header:"Commits per PR" json:"-"`
+	CommitsPerPR float64 `json:"commitsPerPullRequest,omitempty"`
+	DirectPushes int     `json:"directPushes,omitempty"`
+}
+
+// repositoryPullRequests counts the changes and pull requests of each repository, the most changes first.
+// Changes whose pull request is not known make the count of pull requests a lower bound, rendered as "≥N".
+func repositoryPullRequests(changes []Change) []RepositoryPullRequests {
+	type counts struct {
+		RepositoryPullRequests
+		pulls map[int]bool
+		// merged are the changes merged by the pulls
+		merged int
+	}
+	byRepository := map[string]*counts{}
+	for _, c := range changes {
+		r, ok := byRepository[c.raw.Repository]
+		if !ok {
+			r = &counts{RepositoryPullRequests: RepositoryPullRequests{Repository: repositoryName(c.raw.Repository)}, pulls: map[int]bool{}}
+			byRepository[c.raw.Repository] = r
+		}
+		r.Commits++
+		number, known := changePullRequest(c.raw)
+		switch {
+		case !known:
+			r.Unknown++
+		case number == 0:
+			r.DirectPushes++
+		default:
+			r.pulls[number] = true
+			r.merged++
+		}
+	}
+
+	result := []RepositoryPullRequests{}
+	for _, r := range byRepository {
+		r.PullRequests = len(r.pulls)
+		r.Incomplete = r.Unknown > 0
+		r.PRs = fmt.Sprintf("%d", r.PullRequests)
+		if r.Incomplete {
+			r.PRs = "≥" + r.PRs
+		}
+		if r.PullRequests > 0 {
+			r.CommitsPerPR = float64(r.merged) / float64(r.PullRequests)
+			r.PerPR = fmt.Sprintf("%.1f", r.CommitsPerPR)
+		}
+		result = append(result, r.RepositoryPullRequests)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Repository < result[j].Repository
+	})
+	return result
+}
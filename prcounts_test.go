@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// testPullRequestHistory is the history of a repository mixing merge commits and squash merges, from the newest:
+// pull request #12 with two commits merged by a merge commit, #11 squash merged, #10 with one commit merged by a
+// merge commit and a commit pushed directly to the branch.
+var testPullRequestHistory = []struct {
+	sha, message string
+	parents      []string
+}{
+	{"m2", "Merge pull request #12 from deads2k/fix\n\nFix the validation", []string{"s1", "b2"}},
+	{"b2", "Add a test", []string{"b1"}},
+	{"b1", "Fix the validation", []string{"s1"}},
+	{"s1", "Bump the API (#11)", []string{"m1"}},
+	{"m1", "Merge pull request #10 from mfojtik/field\n\nAdd a field", []string{"d1", "a1"}},
+	{"a1", "Add a field", []string{"d1"}},
+	{"d1", "Fix the build", []string{"x1"}},
+}
+
+func testPullRequestCommits() []*github.RepositoryCommit {
+	var commits []*github.RepositoryCommit
+	for _, c := range testPullRequestHistory {
+		commit := &github.RepositoryCommit{SHA: github.String(c.sha), Commit: &github.Commit{Message: github.String(c.message)}}
+		for _, p := range c.parents {
+			commit.Parents = append(commit.Parents, github.Commit{SHA: github.String(p)})
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+func TestParseCommitPullRequests(t *testing.T) {
+	expected := map[string]int{"b2": 12, "b1": 12, "s1": 11, "a1": 10}
+	if pulls := parseCommitPullRequests(testPullRequestCommits()); !reflect.DeepEqual(pulls, expected) {
+		t.Errorf("expected %v, got %v", expected, pulls)
+	}
+	if pulls := parseCommitPullRequests(nil); len(pulls) != 0 {
+		t.Errorf("expected no pull requests, got %v", pulls)
+	}
+}
+
+func TestPullRequestsOfListedCommits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/commits":
+			var listed []string
+			for _, c := range testPullRequestHistory {
+				var parents []string
+				for _, p := range c.parents {
+					parents = append(parents, fmt.Sprintf(`{"sha": %q}`, p))
+				}
+				listed = append(listed, fmt.Sprintf(`{"sha": %q, "commit": {"message": %q, "committer": {"date": %q}}, "parents": [%s]}`, c.sha, c.message, time.Now().Add(-time.Hour).Format(time.RFC3339), strings.Join(parents, ",")))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(listed, ","))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	changes, errs, err := processRepositories(context.Background(), client, ProcessOptions{Concurrency: 1, BranchName: "master", Since: 24 * time.Hour}, []string{"https://github.com/openshift/api"})
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("unexpected errors %v: %v", errs, err)
+	}
+	pulls := map[string]int{}
+	for _, c := range changes {
+		pulls[c.raw.SHA] = c.raw.ParsedPullRequest
+	}
+	// the merge commits are hidden
+	if expected := map[string]int{"b2": 12, "b1": 12, "s1": 11, "a1": 10, "d1": 0}; !reflect.DeepEqual(pulls, expected) {
+		t.Errorf("expected %v, got %v", expected, pulls)
+	}
+
+	summary := repositoryPullRequests(changes)
+	expected := []RepositoryPullRequests{{Repository: "openshift/api", Commits: 5, PRs: "≥3", PullRequests: 3, Incomplete: true, Unknown: 1, PerPR: "1.3", CommitsPerPR: 4.0 / 3}}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestRepositoryPullRequests(t *testing.T) {
+	var changes []Change
+	for _, raw := range []RawChange{
+		{Repository: "https://github.com/openshift/api", SHA: "a1", ParsedPullRequest: 10},
+		{Repository: "https://github.com/openshift/api", SHA: "a2", ParsedPullRequest: 10},
+		// the pull request found by -with-prs takes precedence
+		{Repository: "https://github.com/openshift/api", SHA: "a3", PullRequest: 11, ParsedPullRequest: 10},
+		{Repository: "https://github.com/openshift/api", SHA: "a4", MergeMethod: mergeMethodDirectPush},
+		{Repository: "https://github.com/openshift/oc", SHA: "b1", PullRequest: 20},
+		{Repository: "https://github.com/openshift/oc", SHA: "b2", PullRequest: 21},
+		{Repository: "https://github.com/openshift/installer", SHA: "c1"},
+	} {
+		raw.Message = "Change " + raw.SHA
+		changes = append(changes, newChange(raw))
+	}
+	expected := []RepositoryPullRequests{
+		{Repository: "openshift/api", Commits: 4, PRs: "2", PullRequests: 2, PerPR: "1.5", CommitsPerPR: 1.5, DirectPushes: 1},
+		{Repository: "openshift/oc", Commits: 2, PRs: "2", PullRequests: 2, PerPR: "1.0", CommitsPerPR: 1},
+		{Repository: "openshift/installer", Commits: 1, PRs: "≥0", PullRequests: 0, Incomplete: true, Unknown: 1},
+	}
+	summary := repositoryPullRequests(changes)
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+
+	// the table and the JSON outputs have the same counts
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, Report{PullRequests: summary}); err != nil {
+		t.Fatal(err)
+	}
+	if table := out.String(); !strings.Contains(table, "Pull requests per repository:") || !strings.Contains(table, "≥0") || !strings.Contains(table, "1.5") {
+		t.Errorf("expected the pull request section, got:\n%s", table)
+	}
+	out.Reset()
+	if err := writeReport(&out, formatJSON, Report{PullRequests: summary}); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	for i := range summary {
+		summary[i].PRs, summary[i].PerPR = "", ""
+	}
+	if !reflect.DeepEqual(report.PullRequests, summary) {
+		t.Errorf("expected the pullRequests key, got %+v", report.PullRequests)
+	}
+
+	for _, prSummary := range []bool{false, true} {
+		out.Reset()
+		captureLog(t, func() {
+			if err := (&queryOptions{prSummary: prSummary}).render(&out, formatTable, &queryResult{Changes: changes}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if shown := strings.Contains(out.String(), "Pull requests per repository:"); shown != prSummary {
+			t.Errorf("pr-summary %v: unexpected output:\n%s", prSummary, out.String())
+		}
+	}
+}
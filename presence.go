@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultPresenceBranches is the number of the most recent release branches checked by default
+const defaultPresenceBranches = 3
+
+// maxPresencePages caps the number of commit pages listed per release branch
+const maxPresencePages = 5
+
+var releaseBranchPattern = regexp.MustCompile(`^release-4\.([0-9]+)$`)
+
+// discoverReleaseBranches returns the most recent release-4.x branches, newest first.
+func discoverReleaseBranches(ctx context.Context, client *github.Client, organization, name string, count int) ([]string, error) {
+	var branches []string
+	minors := map[string]int{}
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Repositories.ListBranches(withCategory(ctx, categoryBranches), organization, name, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, branch := range page {
+			match := releaseBranchPattern.FindStringSubmatch(branch.GetName())
+			if match == nil {
+				continue
+			}
+			minors[branch.GetName()], _ = strconv.Atoi(match[1])
+			branches = append(branches, branch.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	sort.Slice(branches, func(i, j int) bool { return minors[branches[i]] > minors[branches[j]] })
+	if len(branches) > count {
+		branches = branches[:count]
+	}
+	return branches, nil
+}
+
+// branchCommits are commits of a branch since a point in time, indexed for the presence lookup.
+type branchCommits struct {
+	shas     map[string]bool
+	subjects map[string]bool
+}
+
+func commitSubject(message string) string {
+	return strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+}
+
+func listBranchCommits(ctx context.Context, client *github.Client, organization, name, branch string, since time.Time) (*branchCommits, error) {
+	result := &branchCommits{shas: map[string]bool{}, subjects: map[string]bool{}}
+	options := &github.CommitsListOptions{SHA: branch, Since: since, ListOptions: github.ListOptions{PerPage: 100}}
+	for i := 0; i < maxPresencePages; i++ {
+		page, resp, err := client.Repositories.ListCommits(withCategory(ctx, categoryBranches), organization, name, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page {
+			result.shas[c.GetSHA()] = true
+			result.subjects[commitSubject(c.GetCommit().GetMessage())] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	return result, nil
+}
+
+// presenceChecker finds whether changes are present in release branches, either by the same SHA
+// (eg. branch fast-forwarded before GA) or as a cherry-pick with the same subject.
+type presenceChecker struct {
+	client   *github.Client
+	branches []string
+
+	lock       sync.Mutex
+	discovered map[string][]string
+}
+
+func newPresenceChecker(client *github.Client, branches []string) *presenceChecker {
+	return &presenceChecker{client: client, branches: branches, discovered: map[string][]string{}}
+}
+
+func (p *presenceChecker) repositoryBranches(ctx context.Context, organization, name string) ([]string, error) {
+	if len(p.branches) > 0 {
+		return p.branches, nil
+	}
+	key := organization + "/" + name
+	p.lock.Lock()
+	branches, ok := p.discovered[key]
+	p.lock.Unlock()
+	if ok {
+		return branches, nil
+	}
+	branches, err := discoverReleaseBranches(ctx, p.client, organization, name, defaultPresenceBranches)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.discovered[key] = branches
+	return branches, nil
+}
+
+// Check sets the per branch presence of all changes of a single repository.
+func (p *presenceChecker) Check(ctx context.Context, organization, name string, changes []RawChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	branches, err := p.repositoryBranches(ctx, organization, name)
+	if err != nil {
+		return err
+	}
+	since := changes[0].Date
+	for _, c := range changes {
+		if c.Date.Before(since) {
+			since = c.Date
+		}
+	}
+	for i := range changes {
+		changes[i].Presence = map[string]bool{}
+	}
+	for _, branch := range branches {
+		commits, err := listBranchCommits(ctx, p.client, organization, name, branch, since)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for i := range changes {
+			changes[i].Presence[branch] = commits.shas[changes[i].SHA] || commits.subjects[commitSubject(changes[i].Message)]
+		}
+	}
+	return nil
+}
+
+// formatPresence renders the presence as "4.11✓ 4.10✗", or "-" when there are no release branches.
+func formatPresence(presence map[string]bool) string {
+	if presence == nil {
+		return ""
+	}
+	if len(presence) == 0 {
+		return "-"
+	}
+	var branches []string
+	for branch := range presence {
+		branches = append(branches, branch)
+	}
+	sort.Slice(branches, func(i, j int) bool { return branchVersionLess(branches[j], branches[i]) })
+	var r []string
+	for _, branch := range branches {
+		mark := "✗"
+		if presence[branch] {
+			mark = "✓"
+		}
+		r = append(r, fmt.Sprintf("%s%s", strings.TrimPrefix(branch, "release-"), mark))
+	}
+	return strings.Join(r, " ")
+}
+
+// branchVersionLess orders release-4.x branches by their minor version, other branches by name.
+func branchVersionLess(a, b string) bool {
+	ma, mb := releaseBranchPattern.FindStringSubmatch(a), releaseBranchPattern.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return a < b
+	}
+	minorA, _ := strconv.Atoi(ma[1])
+	minorB, _ := strconv.Atoi(mb[1])
+	return minorA < minorB
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestPresenceChecker(t *testing.T) {
+	listings := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api/branches":
+			listings["branches"]++
+			fmt.Fprint(w, `[{"name": "master"}, {"name": "release-4.9"}, {"name": "release-4.11"}, {"name": "release-4.8"}, {"name": "release-4.10"}, {"name": "release-3.11"}]`)
+		case "/repos/openshift/api/commits":
+			branch := req.URL.Query().Get("sha")
+			listings[branch]++
+			switch branch {
+			case "release-4.11":
+				// fast-forwarded from master
+				fmt.Fprint(w, `[{"sha": "a1", "commit": {"message": "Bump the API"}}, {"sha": "b1", "commit": {"message": "Fix the validation\n\nDetails"}}]`)
+			case "release-4.10":
+				// cherry-picked
+				fmt.Fprint(w, `[{"sha": "b2", "commit": {"message": "Fix the validation"}}]`)
+			default:
+				fmt.Fprint(w, `[]`)
+			}
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	changes := []RawChange{
+		{SHA: "a1", Message: "Bump the API", Date: time.Now()},
+		{SHA: "b0", Message: "Fix the validation", Date: time.Now().Add(-time.Hour)},
+	}
+	checker := newPresenceChecker(client, nil)
+	if err := checker.Check(context.Background(), "openshift", "api", changes); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]bool{
+		{"release-4.11": true, "release-4.10": false, "release-4.9": false},
+		{"release-4.11": true, "release-4.10": true, "release-4.9": false},
+	}
+	for i := range changes {
+		if !reflect.DeepEqual(changes[i].Presence, expected[i]) {
+			t.Errorf("%s: expected presence %v, got %v", changes[i].SHA, expected[i], changes[i].Presence)
+		}
+	}
+	if presence := formatPresence(changes[1].Presence); presence != "4.11✓ 4.10✓ 4.9✗" {
+		t.Errorf("unexpected presence column %q", presence)
+	}
+	if listings["release-4.8"] > 0 || listings["master"] > 0 {
+		t.Errorf("expected only the three most recent release branches listed, got %v", listings)
+	}
+	// the discovered branches are reused for the next changes of the repository
+	if _, err := checker.repositoryBranches(context.Background(), "openshift", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if listings["branches"] != 1 {
+		t.Errorf("expected the branches listed once, got %d", listings["branches"])
+	}
+}
+
+func TestFormatPresence(t *testing.T) {
+	tests := []struct {
+		presence map[string]bool
+		expected string
+	}{
+		{presence: nil, expected: ""},
+		{presence: map[string]bool{}, expected: "-"},
+		{presence: map[string]bool{"release-4.9": true, "release-4.10": false}, expected: "4.10✗ 4.9✓"},
+	}
+	for _, test := range tests {
+		if presence := formatPresence(test.presence); presence != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.presence, test.expected, presence)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// provenanceVersion is the version of the Provenance schema, increased on incompatible changes.
+const provenanceVersion = 1
+
+// redactedFlag replaces values of flags holding credentials
+const redactedFlag = "REDACTED"
+
+// reproduceIgnoredFlags are not restored by -reproduce: they don't change the results, or are credentials.
+var reproduceIgnoredFlags = map[string]bool{
+	"reproduce":  true,
+	"token":      true,
+	"output":     true,
+	"trace-file": true,
+	"v":          true,
+}
+
+// Provenance records how a report was produced, so it can be reproduced (see -reproduce).
+type Provenance struct {
+	Version int    `json:"version"`
+	Command string `json:"command"`
+	// Repositories are the processed repositories, after -component and the other repository flags
+	Repositories []ProvenanceRepository `json:"repositories,omitempty"`
+	// Flags are values of all flags, ExplicitFlags those set on the command line
+	Flags         map[string]string `json:"flags"`
+	ExplicitFlags []string          `json:"explicitFlags,omitempty"`
+	Build         BuildInfo         `json:"build"`
+	// RateLimitStart and RateLimitEnd are the Github rate limits seen by the first and the last request
+	RateLimitStart *RateLimitSnapshot `json:"rateLimitStart,omitempty"`
+	RateLimitEnd   *RateLimitSnapshot `json:"rateLimitEnd,omitempty"`
+}
+
+// ProvenanceRepository is a processed repository with the branch (or the compared commits) and the mirror it was listed from.
+type ProvenanceRepository struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	Base       string `json:"base,omitempty"`
+	Mirror     string `json:"mirror,omitempty"`
+}
+
+// BuildInfo identifies the binary that produced the report.
+type BuildInfo struct {
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Sum       string `json:"sum,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// RateLimitSnapshot is the core Github rate limit reported in the response headers.
+type RateLimitSnapshot struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// parseRateLimit returns the core rate limit of the response, nil for responses of other resources (eg. search).
+func parseRateLimit(resp *http.Response) *RateLimitSnapshot {
+	if resp == nil {
+		return nil
+	}
+	if resource := resp.Header.Get("X-RateLimit-Resource"); len(resource) > 0 && resource != "core" {
+		return nil
+	}
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return nil
+	}
+	remaining, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	return &RateLimitSnapshot{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Path, info.Version, info.Sum = build.Main.Path, build.Main.Version, build.Main.Sum
+	}
+	return info
+}
+
+// newProvenance records the flags of the command, the values of credential flags are redacted.
+func newProvenance(command string, fs *flag.FlagSet) *Provenance {
+	p := &Provenance{Version: provenanceVersion, Command: command, Flags: map[string]string{}, Build: buildInfo()}
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if f.Name == "token" && len(value) > 0 {
+			value = redactedFlag
+		}
+		p.Flags[f.Name] = value
+	})
+	fs.Visit(func(f *flag.Flag) {
+		p.ExplicitFlags = append(p.ExplicitFlags, f.Name)
+	})
+	return p
+}
+
+// setRepositories records the processed repositories, with the mirrors their changes were listed from.
+func (p *Provenance) setRepositories(repositories []string, options ProcessOptions, changes []Change) {
+	mirrors := map[string]string{}
+	for _, c := range changes {
+		if len(c.raw.Mirror) > 0 {
+			mirrors[c.raw.Repository] = c.raw.Mirror
+		}
+	}
+	p.Repositories = nil
+	for _, repository := range repositories {
+		r := ProvenanceRepository{Repository: repository, Branch: options.BranchName, Mirror: mirrors[repository]}
+		if compare, ok := options.Compare[repository]; ok {
+			r.Base, r.Branch = compare.Base, compare.Head
+		}
+		p.Repositories = append(p.Repositories, r)
+	}
+}
+
+// readProvenance reads the provenance from the metadata of a JSON report.
+func readProvenance(file string) (*Provenance, *Window, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var report struct {
+		Metadata jsonMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", file, err)
+	}
+	p := report.Metadata.Provenance
+	if p == nil {
+		return nil, nil, fmt.Errorf("%s: the report has no provenance, only JSON reports record it", file)
+	}
+	if p.Version > provenanceVersion {
+		return nil, nil, fmt.Errorf("%s: provenance version %d is newer than the supported version %d", file, p.Version, provenanceVersion)
+	}
+	return p, report.Metadata.Window, nil
+}
+
+// reproduce sets the flags explicitly set by the run of the provenance, except those set on the command line now,
+// and warns about what can't be restored.
+func reproduce(fs *flag.FlagSet, command string, p *Provenance, window *Window) error {
+	if p.Command != command {
+		return fmt.Errorf("the report was produced by the %s command, not %s", p.Command, command)
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	restored := map[string]bool{}
+	for _, name := range p.ExplicitFlags {
+		if reproduceIgnoredFlags[name] || explicit[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			log.Printf("WARNING: flag -%s of the report is not known by this version, it is ignored", name)
+			continue
+		}
+		if err := fs.Set(name, p.Flags[name]); err != nil {
+			return fmt.Errorf("unable to restore -%s=%q: %v", name, p.Flags[name], err)
+		}
+		restored[name] = true
+	}
+	// flags left at their defaults only reproduce the run when the defaults did not change, the default
+	// time zone is the local one and only changes the rendering
+	var changed []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "timezone" {
+			return
+		}
+		if value, ok := p.Flags[f.Name]; ok && !restored[f.Name] && !explicit[f.Name] && !reproduceIgnoredFlags[f.Name] && value != f.DefValue {
+			changed = append(changed, fmt.Sprintf("-%s (%q, now %q)", f.Name, value, f.DefValue))
+		}
+	})
+	sort.Strings(changed)
+	if len(changed) > 0 {
+		log.Printf("WARNING: defaults of these flags changed since the report: %s", strings.Join(changed, ", "))
+	}
+	if len(p.Flags["token"]) > 0 {
+		log.Printf("WARNING: the report was produced with -token, which is not recorded, set it again or use GITHUB_TOKEN")
+	}
+	if window != nil && len(window.PreviousPayload) == 0 && len(window.Commits) == 0 {
+		log.Printf("WARNING: the report listed changes since %s, the relative window now starts at the current time", formatTime(window.Since))
+	}
+	if p.Build.Version != buildInfo().Version || p.Build.GoVersion != runtime.Version() {
+		log.Printf("WARNING: the report was produced by a different build (%s)", strings.TrimSpace(strings.Join([]string{p.Build.Path, p.Build.Version, p.Build.GoVersion}, " ")))
+	}
+	return nil
+}
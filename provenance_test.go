@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeProvenanceReport writes a JSON report with the provenance into a temporary file and returns its path.
+func writeProvenanceReport(t *testing.T, p *Provenance, window *Window) string {
+	file := filepath.Join(t.TempDir(), "report.json")
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := writeReport(out, formatJSON, Report{Window: window, Provenance: p}); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestProvenanceRoundTrip(t *testing.T) {
+	cmd := newCollectCommand()
+	if err := cmd.flags.Parse([]string{"-branch", "release-4.9", "-since", "2d", "-token", "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	p := newProvenance(cmd.name, cmd.flags)
+	if p.Flags["token"] != redactedFlag || p.Flags["branch"] != "release-4.9" || p.Flags["format"] != formatTable {
+		t.Errorf("unexpected flags %v", p.Flags)
+	}
+	if !reflect.DeepEqual(p.ExplicitFlags, []string{"branch", "since", "token"}) {
+		t.Errorf("unexpected explicit flags %v", p.ExplicitFlags)
+	}
+
+	changes := []Change{newChange(RawChange{Repository: "https://github.com/openshift-priv/api", Mirror: "https://github.com/openshift/api"})}
+	p.setRepositories([]string{"https://github.com/openshift-priv/api", "https://github.com/openshift/oc"}, ProcessOptions{BranchName: "release-4.9"}, changes)
+	window := &Window{Since: time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)}
+
+	read, readWindow, err := readProvenance(writeProvenanceReport(t, p, window))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, p) {
+		t.Errorf("expected %+v, got %+v", p, read)
+	}
+	if readWindow == nil || !readWindow.Since.Equal(window.Since) {
+		t.Errorf("expected the window of the report, got %+v", readWindow)
+	}
+	if read.Repositories[0].Mirror != "https://github.com/openshift/api" || read.Repositories[1].Mirror != "" || read.Repositories[1].Branch != "release-4.9" {
+		t.Errorf("unexpected repositories %+v", read.Repositories)
+	}
+}
+
+func TestReadProvenanceVersion(t *testing.T) {
+	p := &Provenance{Version: provenanceVersion + 1, Command: "collect", Flags: map[string]string{}}
+	if _, _, err := readProvenance(writeProvenanceReport(t, p, nil)); err == nil || !strings.Contains(err.Error(), "is newer than the supported version") {
+		t.Errorf("expected a newer version to be rejected, got %v", err)
+	}
+	if _, _, err := readProvenance(writeProvenanceReport(t, nil, nil)); err == nil || !strings.Contains(err.Error(), "has no provenance") {
+		t.Errorf("expected a report without provenance to be rejected, got %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "report.txt")
+	if err := ioutil.WriteFile(file, []byte("NAME  URL\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readProvenance(file); err == nil {
+		t.Errorf("expected a table output to be rejected")
+	}
+}
+
+func TestReproduce(t *testing.T) {
+	recorded := newCollectCommand()
+	if err := recorded.flags.Parse([]string{"-branch", "release-4.9", "-since", "2d", "-token", "secret", "-output", "report.json"}); err != nil {
+		t.Fatal(err)
+	}
+	p := newProvenance(recorded.name, recorded.flags)
+	p.ExplicitFlags = append(p.ExplicitFlags, "removed-flag")
+	p.Flags["removed-flag"] = "true"
+	p.Flags["concurrency"] = "1"
+
+	// -since given on the command line takes precedence
+	cmd := newCollectCommand()
+	if err := cmd.flags.Parse([]string{"-since", "1d"}); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	output := captureLog(t, func() {
+		err = reproduce(cmd.flags, cmd.name, p, &Window{Since: time.Now().Add(-48 * time.Hour)})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"branch": "release-4.9", "since": "1d", "token": "", "output": ""} {
+		if value := cmd.flags.Lookup(name).Value.String(); value != expected {
+			t.Errorf("expected -%s=%q, got %q", name, expected, value)
+		}
+	}
+	for _, expected := range []string{
+		"flag -removed-flag of the report is not known by this version",
+		`defaults of these flags changed since the report: -concurrency ("1", now "10")`,
+		"the report was produced with -token",
+		"the relative window now starts at the current time",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in:\n%s", expected, output)
+		}
+	}
+
+	if err := reproduce(newCollectCommand().flags, "compare", p, nil); err == nil || !strings.Contains(err.Error(), "produced by the collect command") {
+		t.Errorf("expected a different command to be rejected, got %v", err)
+	}
+	p.ExplicitFlags, p.Flags["concurrency"] = []string{"concurrency"}, "many"
+	captureLog(t, func() { err = reproduce(newCollectCommand().flags, "collect", p, nil) })
+	if err == nil || !strings.Contains(err.Error(), `unable to restore -concurrency="many"`) {
+		t.Errorf("expected an invalid value to fail, got %v", err)
+	}
+}
+
+func TestAPIUsageRateLimits(t *testing.T) {
+	remaining := 5000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/search" {
+			w.Header().Set("X-RateLimit-Resource", "search")
+			w.Header().Set("X-RateLimit-Limit", "30")
+		} else {
+			remaining--
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(remaining))
+			w.Header().Set("X-RateLimit-Reset", "1629453600")
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+
+	usage := NewAPIUsage(0)
+	if start, end := usage.RateLimits(); start != nil || end != nil {
+		t.Errorf("expected no rate limits before the first request, got %+v %+v", start, end)
+	}
+	client := &http.Client{Transport: &countingTransport{base: http.DefaultTransport, usage: usage}}
+	for _, path := range []string{"/repos", "/repos", "/repos", "/search"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// the search rate limit is separate from the core one and is left out
+	start, end := usage.RateLimits()
+	if start == nil || start.Limit != 5000 || start.Remaining != 4999 || !start.Reset.Equal(time.Unix(1629453600, 0)) {
+		t.Errorf("unexpected rate limit at the start %+v", start)
+	}
+	if end == nil || end.Remaining != 4997 {
+		t.Errorf("unexpected rate limit at the end %+v", end)
+	}
+	p := &Provenance{}
+	(&sharedOptions{usage: usage}).recordRateLimits(p)
+	if p.RateLimitStart != start || p.RateLimitEnd != end {
+		t.Errorf("expected the rate limits in the provenance, got %+v", p)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+)
+
+// mediaTypeCommitPullsPreview is required to list pull requests associated with a commit
+const mediaTypeCommitPullsPreview = "application/vnd.github.groot-preview+json"
+
+// getCommitPullRequest returns the pull request that merged the commit into the branch,
+// or nil when the commit was pushed directly.
+func getCommitPullRequest(ctx context.Context, client *github.Client, organization, name, sha, branch string) (*github.PullRequest, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/commits/%s/pulls", organization, name, sha), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeCommitPullsPreview)
+
+	var pulls []*github.PullRequest
+	if _, err := client.Do(withCategory(ctx, categoryPullRequest), req, &pulls); err != nil {
+		return nil, err
+	}
+	// prefer the pull request merged into the branch we search, the commit can be part of many
+	for _, pull := range pulls {
+		if pull.GetBase().GetRef() == branch && pull.MergedAt != nil {
+			return pull, nil
+		}
+	}
+	if len(pulls) > 0 {
+		return pulls[0], nil
+	}
+	return nil, nil
+}
+
+// Merge methods of pull requests
+const (
+	mergeMethodMerge      = "merge"
+	mergeMethodSquash     = "squash"
+	mergeMethodRebase     = "rebase"
+	mergeMethodUnknown    = "unknown"
+	mergeMethodDirectPush = "direct push"
+)
+
+// pullRequestMerge infers who merged the pull request and how, from the pull request and the listed commits,
+// so no extra requests are needed. The merge commit author is the merger when the pull request doesn't carry it.
+func pullRequestMerge(pull *github.PullRequest, sha string, commits map[string]*github.RepositoryCommit) (string, string) {
+	mergedBy := pull.GetMergedBy().GetLogin()
+	mergeSHA := pull.GetMergeCommitSHA()
+	if mergeSHA == sha {
+		return mergedBy, mergeMethodSquash
+	}
+	mergeCommit, ok := commits[mergeSHA]
+	if !ok {
+		return mergedBy, mergeMethodUnknown
+	}
+	if !isMergeCommit(mergeCommit) {
+		return mergedBy, mergeMethodRebase
+	}
+	if len(mergedBy) == 0 {
+		mergedBy = mergeCommit.GetAuthor().GetLogin()
+	}
+	return mergedBy, mergeMethodMerge
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestPullRequestMerge(t *testing.T) {
+	repositoryCommit := func(sha, message, author string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			SHA:    github.String(sha),
+			Commit: &github.Commit{Message: github.String(message)},
+			Author: &github.User{Login: github.String(author)},
+		}
+	}
+	commits := map[string]*github.RepositoryCommit{}
+	for _, c := range []*github.RepositoryCommit{
+		repositoryCommit("a", "Bump the API", "deads2k"),
+		repositoryCommit("b", "Merge pull request #42 from deads2k/bump", "openshift-merge-robot"),
+		repositoryCommit("c", "Fix the validation", "sttts"),
+	} {
+		commits[c.GetSHA()] = c
+	}
+
+	tests := []struct {
+		name             string
+		pull             *github.PullRequest
+		sha              string
+		expectedMergedBy string
+		expectedMethod   string
+	}{
+		{
+			name:             "merge commit",
+			pull:             &github.PullRequest{MergeCommitSHA: github.String("b"), MergedBy: &github.User{Login: github.String("openshift-merge-robot")}},
+			sha:              "a",
+			expectedMergedBy: "openshift-merge-robot",
+			expectedMethod:   mergeMethodMerge,
+		},
+		{
+			name:             "merger from the merge commit",
+			pull:             &github.PullRequest{MergeCommitSHA: github.String("b")},
+			sha:              "a",
+			expectedMergedBy: "openshift-merge-robot",
+			expectedMethod:   mergeMethodMerge,
+		},
+		{
+			name:             "squash",
+			pull:             &github.PullRequest{MergeCommitSHA: github.String("c"), MergedBy: &github.User{Login: github.String("sttts")}},
+			sha:              "c",
+			expectedMergedBy: "sttts",
+			expectedMethod:   mergeMethodSquash,
+		},
+		{
+			name:             "rebase",
+			pull:             &github.PullRequest{MergeCommitSHA: github.String("c"), MergedBy: &github.User{Login: github.String("sttts")}},
+			sha:              "a",
+			expectedMergedBy: "sttts",
+			expectedMethod:   mergeMethodRebase,
+		},
+		{
+			name:           "merge commit not listed",
+			pull:           &github.PullRequest{MergeCommitSHA: github.String("d")},
+			sha:            "a",
+			expectedMethod: mergeMethodUnknown,
+		},
+	}
+	for _, test := range tests {
+		mergedBy, method := pullRequestMerge(test.pull, test.sha, commits)
+		if mergedBy != test.expectedMergedBy || method != test.expectedMethod {
+			t.Errorf("%s: expected %q %q, got %q %q", test.name, test.expectedMergedBy, test.expectedMethod, mergedBy, method)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// rawDataVersion must be bumped whenever RawData changes incompatibly
+const rawDataVersion = 1
+
+// RawData is the full dataset collected by a run, saved via -save-raw and rendered
+// again later via -from-raw without talking to Github.
+type RawData struct {
+	Version      int             `json:"version"`
+	Metadata     RawMetadata     `json:"metadata"`
+	Repositories []RawRepository `json:"repositories"`
+}
+
+// RawMetadata describes the run that collected the data, including the optional data it fetched.
+type RawMetadata struct {
+	Created          time.Time `json:"created"`
+	Payload          string    `json:"payload,omitempty"`
+	Branch           string    `json:"branch"`
+	Since            string    `json:"since"`
+	WithPullRequests bool      `json:"withPullRequests"`
+	WithBackports    bool      `json:"withBackports"`
+	WithCodeowners   bool      `json:"withCodeowners"`
+
+	WithRetests        bool `json:"withRetests"`
+	WithBranchPresence bool `json:"withBranchPresence"`
+	// FirstParent is set when only the first-parent history was listed (see -first-parent)
+	FirstParent bool `json:"firstParent,omitempty"`
+	// ClassifyPaths is set when the path classes of the changes were collected (see -classify-paths)
+	ClassifyPaths bool `json:"classifyPaths,omitempty"`
+	// WithFiles is set when the changed files were kept with the changes, for -files-filter
+	WithFiles bool `json:"withFiles,omitempty"`
+
+	// Window is the resolved start of the listed changes
+	Window *Window `json:"window,omitempty"`
+	// Release identifies the payload read from a file instead of Payload
+	Release *ReleaseLabel `json:"release,omitempty"`
+	// SkippedTags are the payload tags skipped without a source repository
+	SkippedTags []SkippedTag `json:"skippedTags,omitempty"`
+}
+
+type RawRepository struct {
+	Repository string      `json:"repository"`
+	Changes    []RawChange `json:"changes"`
+	Error      *RawError   `json:"error,omitempty"`
+}
+
+type RawError struct {
+	Repository string `json:"repository,omitempty"`
+	Kind       string `json:"kind"`
+	Message    string `json:"message"`
+}
+
+func newRawData(metadata RawMetadata, repositories []string, changes []Change, errs []RepositoryError) *RawData {
+	data := &RawData{Version: rawDataVersion, Metadata: metadata}
+	index := map[string]int{}
+	for _, r := range repositories {
+		index[r] = len(data.Repositories)
+		data.Repositories = append(data.Repositories, RawRepository{Repository: r, Changes: []RawChange{}})
+	}
+	for _, c := range changes {
+		i := index[c.raw.Repository]
+		data.Repositories[i].Changes = append(data.Repositories[i].Changes, c.raw)
+	}
+	for _, e := range errs {
+		i := index[e.Repository]
+		data.Repositories[i].Error = &RawError{Kind: e.Kind, Message: e.Err.Error()}
+	}
+	return data
+}
+
+// Changes returns the changes of all repositories, sorted the same way as in live run.
+func (d *RawData) Changes() []Change {
+	var changes []Change
+	for _, r := range d.Repositories {
+		for _, c := range r.Changes {
+			changes = append(changes, newChange(c))
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+func (d *RawData) Errors() []RepositoryError {
+	var errs []RepositoryError
+	for _, r := range d.Repositories {
+		if r.Error == nil {
+			continue
+		}
+		errs = append(errs, RepositoryError{Repository: r.Repository, Kind: r.Error.Kind, Err: errors.New(r.Error.Message)})
+	}
+	return errs
+}
+
+// Require fails when the options ask for data that was not collected by the original run.
+func (d *RawData) Require(options ProcessOptions) error {
+	if options.WithPullRequests && !d.Metadata.WithPullRequests {
+		return fmt.Errorf("raw data does not contain pull requests (collected without -with-prs)")
+	}
+	if options.WithBackports && !d.Metadata.WithBackports {
+		return fmt.Errorf("raw data does not contain backports (collected without -with-backports)")
+	}
+	if options.WithCodeowners && !d.Metadata.WithCodeowners {
+		return fmt.Errorf("raw data does not contain owners (collected without -with-codeowners)")
+	}
+	if options.WithRetests && !d.Metadata.WithRetests {
+		return fmt.Errorf("raw data does not contain retests (collected without -with-retests)")
+	}
+	if options.WithBranchPresence && !d.Metadata.WithBranchPresence {
+		return fmt.Errorf("raw data does not contain release branches presence (collected without -branch-presence)")
+	}
+	if options.ClassifyPaths && !d.Metadata.ClassifyPaths {
+		return fmt.Errorf("raw data does not contain path classes (collected without -classify-paths)")
+	}
+	if len(options.FilesFilter) > 0 && !d.Metadata.WithFiles {
+		return fmt.Errorf("raw data does not contain the changed files (collected without -classify-paths or -files-filter)")
+	}
+	return nil
+}
+
+func writeRawData(path string, data *RawData) error {
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, out, 0)
+}
+
+func readRawData(path string) (*RawData, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data RawData
+	if err := json.Unmarshal(in, &data); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if data.Version != rawDataVersion {
+		return nil, fmt.Errorf("%s: unsupported raw data version %d (expected %d)", path, data.Version, rawDataVersion)
+	}
+	return &data, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRawDataRequire(t *testing.T) {
+	data := &RawData{Metadata: RawMetadata{WithPullRequests: true}}
+	tests := []struct {
+		options  ProcessOptions
+		expected string
+	}{
+		{options: ProcessOptions{}},
+		{options: ProcessOptions{WithPullRequests: true}},
+		{options: ProcessOptions{WithPullRequests: true, WithBackports: true}, expected: "raw data does not contain backports"},
+		{options: ProcessOptions{ClassifyPaths: true}, expected: "raw data does not contain path classes"},
+	}
+	for _, test := range tests {
+		err := data.Require(test.options)
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%+v: unexpected error: %v", test.options, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%+v: expected an error containing %q, got %v", test.options, test.expected, err)
+		}
+	}
+
+	// -files-filter needs the changed files, which older raw data collected with -classify-paths does not keep
+	data = &RawData{Metadata: RawMetadata{ClassifyPaths: true}}
+	if err := data.Require(ProcessOptions{ClassifyPaths: true, FilesFilter: "pkg/**"}); err == nil || !strings.Contains(err.Error(), "raw data does not contain the changed files") {
+		t.Errorf("expected the missing files to fail, got %v", err)
+	}
+	data.Metadata.WithFiles = true
+	if err := data.Require(ProcessOptions{ClassifyPaths: true, FilesFilter: "pkg/**"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRawDataRoundTrip(t *testing.T) {
+	client, _ := fakeJobsGithub(t)
+	raw := filepath.Join(t.TempDir(), "raw.json")
+	repos := []string{"https://github.com/openshift/api"}
+
+	collected, err := runTestQuery(t, client, &queryOptions{since: "1d", branch: "master", saveRaw: raw}, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(collected, "Bump the API") {
+		t.Errorf("expected the change in the output:\n%s", collected)
+	}
+
+	// the raw data is rendered without talking to Github
+	rendered, err := runTestQuery(t, nil, &queryOptions{fromRaw: raw}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != collected {
+		t.Errorf("expected the output of the collection:\n%s\ngot:\n%s", collected, rendered)
+	}
+
+	// the pull requests were not collected
+	_, err = runTestQuery(t, nil, &queryOptions{fromRaw: raw, withPRs: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "pull requests") {
+		t.Errorf("expected -with-prs to fail naming the pull requests, got %v", err)
+	}
+}
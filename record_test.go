@@ -0,0 +1,69 @@
+//go:build record
+// +build record
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordedRepository is the tiny public repository whose responses the fixtures are recorded from
+const recordedRepository = "octocat/Hello-World"
+
+// TestRecordFixtures refreshes the fixtures of recordedRepository from the Github API, run it with
+//
+//	GITHUB_TOKEN=... go test -tags record -run TestRecordFixtures .
+//
+// The fixtures of the other repositories are written by hand in the format of the recorded ones.
+func TestRecordFixtures(t *testing.T) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if len(token) == 0 {
+		t.Skip("recording the fixtures requires GITHUB_TOKEN")
+	}
+	for fixture, path := range map[string]string{
+		"repos-octocat-Hello-World.json":   "repos/" + recordedRepository,
+		"commits-octocat-Hello-World.json": "repos/" + recordedRepository + "/commits?sha=master&per_page=100",
+		"compare-octocat-Hello-World.json": "repos/" + recordedRepository + "/compare/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e...7fd1a60b01f91b314f59955a4e4d4e80d8edf11d",
+		"branch-master.json":               "repos/" + recordedRepository + "/branches/master",
+		"rate-limit.json":                  "rate_limit",
+	} {
+		if err := recordFixture(token, path, fixture); err != nil {
+			t.Errorf("%s: %v", fixture, err)
+		}
+	}
+}
+
+// recordFixture writes the indented response of the API path into the fixture.
+func recordFixture(token, path, fixture string) error {
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s: %s", path, resp.Status, body)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteString("\n")
+	return ioutil.WriteFile(filepath.Join(fixturesDir, fixture), indented.Bytes(), 0644)
+}
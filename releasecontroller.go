@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// releaseControllerURL is the release controller of the given architecture (eg. "amd64", "arm64"), tests replace it
+var releaseControllerURL = "https://%s.ocp.releases.ci.openshift.org"
+
+// releaseControllerTimeout bounds requests to the release controller, so an unreachable one falls back quickly
+const releaseControllerTimeout = 30 * time.Second
+
+var (
+	// eg. "4.9.0-0.nightly-2021-08-18-123456" or "4.9.0-0.nightly-arm64-2021-08-18-123456"
+	ciPayloadPattern = regexp.MustCompile(`^([0-9]+\.[0-9]+\.[0-9]+-0\.(?:nightly|ci))(?:-([a-z0-9]+))?-([0-9]{4}-[0-9]{2}-[0-9]{2}-[0-9]{6})$`)
+	// eg. "4.9.0-fc.0-x86_64" or "4.8.5-aarch64"
+	stablePayloadPattern = regexp.MustCompile(`^([0-9]+\.[0-9]+\.[0-9]+(?:-[a-z]+\.[0-9]+)?)-(x86_64|aarch64|ppc64le|s390x)$`)
+)
+
+// releaseArchitectures maps the architecture suffix of stable payloads to the release controller architecture
+var releaseArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+const (
+	// latestNightlyPrefix selects the newest nightly payload of a minor version (eg. "latest-nightly:4.16")
+	latestNightlyPrefix = "latest-nightly:"
+	// latestAcceptedPrefix selects the newest accepted nightly payload of a minor version (eg. "latest-accepted:4.16")
+	latestAcceptedPrefix = "latest-accepted:"
+)
+
+// minorVersionPattern matches minor versions (eg. "4.16")
+var minorVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// releaseStreamTag identifies a payload known to the release controller.
+type releaseStreamTag struct {
+	Architecture string
+	Stream       string
+	Name         string
+}
+
+type releaseStreamTags struct {
+	Tags []releaseTag `json:"tags"`
+}
+
+type releaseTag struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	PullSpec string `json:"pullSpec"`
+}
+
+// Window is the resolved start of the time window changes are listed from.
+type Window struct {
+	Since time.Time `json:"since"`
+	// PreviousPayload is the payload the window starts at, when the window was derived from it
+	PreviousPayload string `json:"previousPayload,omitempty"`
+	// Commits are the commits of repositories listed from their commit in -since-payload instead of Since
+	Commits map[string]string `json:"commits,omitempty"`
+	// PayloadCreated is the creation time of the payload, the changes are rendered relative to it with -relative-to payload
+	PayloadCreated *time.Time `json:"payloadCreated,omitempty"`
+	// Lookback are the windows of repositories extended by -min-commits
+	Lookback map[string]string `json:"lookback,omitempty"`
+	// Stitched are the old default branches of repositories whose history was stitched across a branch rename
+	Stitched map[string]string `json:"stitched,omitempty"`
+	// History is how the commits were listed, empty for all commits and historyFirstParent with -first-parent
+	History string `json:"history,omitempty"`
+	// FirstParentFallback are the repositories listed with all commits as their first-parent history failed
+	FirstParentFallback []string `json:"firstParentFallback,omitempty"`
+}
+
+func payloadTagName(payload string) string {
+	if strings.Contains(payload, "@") {
+		return ""
+	}
+	if i := strings.LastIndex(payload, ":"); i >= 0 && !strings.Contains(payload[i:], "/") {
+		return payload[i+1:]
+	}
+	return payload
+}
+
+// parseReleaseStreamTag returns the release controller stream of the payload, ok is false when the payload
+// is not named the way release controller names them (eg. a custom build).
+func parseReleaseStreamTag(payload string) (releaseStreamTag, bool) {
+	name := payloadTagName(payload)
+	if match := ciPayloadPattern.FindStringSubmatch(name); match != nil {
+		tag := releaseStreamTag{Architecture: "amd64", Stream: match[1], Name: name}
+		if len(match[2]) > 0 {
+			tag.Architecture = match[2]
+			tag.Stream += "-" + match[2]
+		}
+		return tag, true
+	}
+	if match := stablePayloadPattern.FindStringSubmatch(name); match != nil {
+		tag := releaseStreamTag{Architecture: releaseArchitectures[match[2]], Stream: "4-stable", Name: match[1]}
+		if tag.Architecture != "amd64" {
+			tag.Stream += "-" + tag.Architecture
+			tag.Name = name
+		}
+		return tag, true
+	}
+	return releaseStreamTag{}, false
+}
+
+// getReleaseStreamTags returns the tags of the release stream, ordered from the newest.
+func getReleaseStreamTags(architecture, stream string) (*releaseStreamTags, error) {
+	client := &http.Client{Timeout: releaseControllerTimeout}
+	url := fmt.Sprintf(releaseControllerURL+"/api/v1/releasestream/%s/tags", architecture, stream)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("release controller does not know stream %s (%s)", stream, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release controller responded with %s for stream %s (%s)", resp.Status, stream, url)
+	}
+	var tags releaseStreamTags
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("unable to decode tags of stream %s (%s): %v", stream, url, err)
+	}
+	return &tags, nil
+}
+
+// resolvePayload resolves the "latest-nightly:MINOR" and "latest-accepted:MINOR" shorthands to the pullspec of the
+// newest (accepted) nightly payload of the minor version, other payloads are returned as they are.
+func resolvePayload(payload string) (string, error) {
+	var minor string
+	acceptedOnly := false
+	switch {
+	case strings.HasPrefix(payload, latestNightlyPrefix):
+		minor = strings.TrimPrefix(payload, latestNightlyPrefix)
+	case strings.HasPrefix(payload, latestAcceptedPrefix):
+		minor, acceptedOnly = strings.TrimPrefix(payload, latestAcceptedPrefix), true
+	default:
+		return payload, nil
+	}
+	if !minorVersionPattern.MatchString(minor) {
+		return "", fmt.Errorf("invalid payload %q, expected a minor version like %s4.16", payload, latestNightlyPrefix)
+	}
+	stream := minor + ".0-0.nightly"
+	tags, err := getReleaseStreamTags("amd64", stream)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve %s: %v", payload, err)
+	}
+	tag, err := latestStreamTag(tags, acceptedOnly)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve %s: %v in stream %s", payload, err, stream)
+	}
+	log.Printf("Resolved %s to payload %s (%s)", payload, tag.Name, tag.PullSpec)
+	return tag.PullSpec, nil
+}
+
+// latestStreamTag returns the newest tag of the stream, only the accepted ones when acceptedOnly is set.
+func latestStreamTag(tags *releaseStreamTags, acceptedOnly bool) (*releaseTag, error) {
+	for i := range tags.Tags {
+		if acceptedOnly && tags.Tags[i].Phase != "Accepted" {
+			continue
+		}
+		if len(tags.Tags[i].PullSpec) == 0 {
+			return nil, fmt.Errorf("payload %s has no pullspec", tags.Tags[i].Name)
+		}
+		return &tags.Tags[i], nil
+	}
+	if acceptedOnly {
+		return nil, fmt.Errorf("no accepted payload")
+	}
+	return nil, fmt.Errorf("no payload")
+}
+
+// getPreviousAcceptedPayload returns the accepted payload preceding the given one in its release stream.
+func getPreviousAcceptedPayload(tag releaseStreamTag) (*releaseTag, error) {
+	tags, err := getReleaseStreamTags(tag.Architecture, tag.Stream)
+	if err != nil {
+		return nil, err
+	}
+	// tags are ordered from the newest
+	found := false
+	for i := range tags.Tags {
+		if !found {
+			found = tags.Tags[i].Name == tag.Name
+			continue
+		}
+		if tags.Tags[i].Phase == "Accepted" {
+			return &tags.Tags[i], nil
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("payload %s not found in stream %s", tag.Name, tag.Stream)
+	}
+	return nil, fmt.Errorf("no accepted payload precedes %s in stream %s", tag.Name, tag.Stream)
+}
+
+// getPayloadCreated returns the time the payload was created, either from its name (nightly and ci payloads)
+// or from the payload image itself.
+func getPayloadCreated(payload string) (time.Time, error) {
+	if match := ciPayloadPattern.FindStringSubmatch(payloadTagName(payload)); match != nil {
+		return time.Parse("2006-01-02-150405", match[3])
+	}
+	release, err := getReleaseInfo(payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if release.Config.Created.IsZero() {
+		return time.Time{}, fmt.Errorf("payload %s does not record its creation time", payload)
+	}
+	return release.Config.Created, nil
+}
+
+// resolvePayloadWindow returns the window since the previous accepted payload of the same stream,
+// or since the given previous payload when set.
+func resolvePayloadWindow(payload, previousPayload string) (*Window, error) {
+	if len(previousPayload) == 0 {
+		tag, ok := parseReleaseStreamTag(payload)
+		if !ok {
+			return nil, fmt.Errorf("payload %s is not known to release controller", payload)
+		}
+		previous, err := getPreviousAcceptedPayload(tag)
+		if err != nil {
+			return nil, err
+		}
+		previousPayload = previous.PullSpec
+		if len(previousPayload) == 0 {
+			previousPayload = previous.Name
+		}
+	}
+	created, err := getPayloadCreated(previousPayload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine when %s was created: %v", previousPayload, err)
+	}
+	return &Window{Since: created, PreviousPayload: previousPayload}, nil
+}
+
+// sincePayloadCommits returns the commits of the repositories in the payload, changes of these repositories
+// are listed from the commit instead of the time window, which needs fewer requests for quiet repositories.
+// Repositories the payload images were built from at several commits have all of them (see -multi-sha).
+func sincePayloadCommits(payload string, repositories []string, sourceAnnotations []string) (map[string][]PayloadCommit, error) {
+	release, err := getReleaseInfo(payload)
+	if err != nil {
+		return nil, err
+	}
+	return selectPayloadCommits(payload, release.RepositoryCommits(sourceAnnotations), repositories), nil
+}
+
+// selectPayloadCommits returns the commits of the repositories found in the previous payload commits.
+func selectPayloadCommits(payload string, previous map[string][]PayloadCommit, repositories []string) map[string][]PayloadCommit {
+	commits := map[string][]PayloadCommit{}
+	for _, repository := range repositories {
+		built, ok := previous[repository]
+		if !ok || len(built) == 0 {
+			logVerbose("[%s] not in %s, listing commits in the time window", repository, payload)
+			continue
+		}
+		logVerbose("[%s] listing commits since %s in %s", repository, shortSHA(built[0].Commit), payload)
+		commits[repository] = built
+	}
+	log.Printf("Listing %d repositories since their commit in %s, %d repositories not in it in the time window", len(commits), payload, len(repositories)-len(commits))
+	return commits
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReleaseStreamTag(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected releaseStreamTag
+		ok       bool
+	}{
+		{
+			payload:  "registry.ci.openshift.org/ocp/release:4.9.0-0.nightly-2021-08-18-123456",
+			expected: releaseStreamTag{Architecture: "amd64", Stream: "4.9.0-0.nightly", Name: "4.9.0-0.nightly-2021-08-18-123456"},
+			ok:       true,
+		},
+		{
+			payload:  "registry.ci.openshift.org/ocp-arm64/release-arm64:4.9.0-0.nightly-arm64-2021-08-18-123456",
+			expected: releaseStreamTag{Architecture: "arm64", Stream: "4.9.0-0.nightly-arm64", Name: "4.9.0-0.nightly-arm64-2021-08-18-123456"},
+			ok:       true,
+		},
+		{
+			payload:  "registry.ci.openshift.org/ocp/release:4.9.0-0.ci-2021-08-18-123456",
+			expected: releaseStreamTag{Architecture: "amd64", Stream: "4.9.0-0.ci", Name: "4.9.0-0.ci-2021-08-18-123456"},
+			ok:       true,
+		},
+		{
+			payload:  "quay.io/openshift-release-dev/ocp-release:4.9.0-fc.0-x86_64",
+			expected: releaseStreamTag{Architecture: "amd64", Stream: "4-stable", Name: "4.9.0-fc.0"},
+			ok:       true,
+		},
+		{
+			payload:  "quay.io/openshift-release-dev/ocp-release:4.8.5-aarch64",
+			expected: releaseStreamTag{Architecture: "arm64", Stream: "4-stable-arm64", Name: "4.8.5-aarch64"},
+			ok:       true,
+		},
+		{payload: "quay.io/openshift-release-dev/ocp-release@sha256:0d3e8e8a0c4b5e0c1c3cf0c4a9b8f0c3d0c4f3b1a7e2f4c5d6e7f8a9b0c1d2e3"},
+		{payload: "registry.example.com/custom/release:latest"},
+	}
+	for _, test := range tests {
+		tag, ok := parseReleaseStreamTag(test.payload)
+		if ok != test.ok || tag != test.expected {
+			t.Errorf("%s: expected %+v %v, got %+v %v", test.payload, test.expected, test.ok, tag, ok)
+		}
+	}
+}
+
+func TestResolvePreviousPayloadWindow(t *testing.T) {
+	// the creation of nightly payloads is in their name, the release controller is not asked
+	window, err := resolvePayloadWindow(defaultPayload, "registry.ci.openshift.org/ocp/release:4.9.0-0.nightly-2021-08-17-084512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Window{Since: time.Date(2021, 8, 17, 8, 45, 12, 0, time.UTC), PreviousPayload: "registry.ci.openshift.org/ocp/release:4.9.0-0.nightly-2021-08-17-084512"}
+	if !reflect.DeepEqual(*window, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *window)
+	}
+	if _, err := resolvePayloadWindow("registry.example.com/custom/release:latest", ""); err == nil {
+		t.Errorf("expected an error for a payload unknown to release controller")
+	}
+}
+
+func TestSelectPayloadCommits(t *testing.T) {
+	previous := map[string][]PayloadCommit{
+		"https://github.com/openshift/api":       {{Commit: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Tags: []string{"cluster-config-api"}}},
+		"https://github.com/openshift/oc":        {{Commit: "d6cd1e2bd19e03a81132a23b2025920577f84e37", Tags: []string{"cli"}}},
+		"https://github.com/openshift/installer": {},
+	}
+	repositories := []string{"https://github.com/openshift/api", "https://github.com/openshift/installer", "https://github.com/openshift/console"}
+	var selected map[string][]PayloadCommit
+	output := captureLog(t, func() { selected = selectPayloadCommits("quay.io/x:1", previous, repositories) })
+	// repositories without a commit in the previous payload are listed in the time window
+	if expected := map[string][]PayloadCommit{"https://github.com/openshift/api": previous["https://github.com/openshift/api"]}; !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+	commits, _ := resolvePayloadCommits(context.Background(), nil, selected, multiSHAPerTag)
+	if !strings.Contains(output, "Listing 1 repositories since their commit in quay.io/x:1, 2 repositories not in it in the time window") {
+		t.Errorf("expected the summary, got:\n%s", output)
+	}
+
+	// the commits are in the JSON metadata
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{Window: &Window{Since: time.Date(2021, 8, 17, 8, 45, 12, 0, time.UTC), PreviousPayload: "quay.io/x:1", Commits: commits}}); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Metadata.Window.Commits, commits) {
+		t.Errorf("expected the commits in the window, got:\n%s", out.String())
+	}
+
+	if err := (&queryOptions{sincePayload: "quay.io/x:1", previousPayload: "quay.io/x:0"}).validate(); err == nil {
+		t.Errorf("expected -since-payload and -previous-payload to be mutually exclusive")
+	}
+}
+
+// fakeReleaseController serves the tags of the release streams recorded in testdata/releasecontroller, the
+// 4.15.0-0.nightly stream is unavailable.
+func fakeReleaseController(t *testing.T) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		stream := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/amd64/api/v1/releasestream/"), "/tags")
+		if stream == "4.15.0-0.nightly" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "releasecontroller", stream+".json"))
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	original := releaseControllerURL
+	releaseControllerURL = server.URL + "/%s"
+	t.Cleanup(func() { releaseControllerURL = original })
+	return server.URL
+}
+
+func TestResolvePayload(t *testing.T) {
+	url := fakeReleaseController(t)
+	tests := []struct {
+		payload     string
+		expected    string
+		expectedErr string
+	}{
+		{payload: defaultPayload, expected: defaultPayload},
+		{payload: "latest-nightly:4.16", expected: "registry.ci.openshift.org/ocp/release:4.16.0-0.nightly-2024-05-16-165920"},
+		{payload: "latest-accepted:4.16", expected: "registry.ci.openshift.org/ocp/release:4.16.0-0.nightly-2024-05-15-212231"},
+		{payload: "latest-accepted:4.17", expectedErr: "unable to resolve latest-accepted:4.17: no accepted payload in stream 4.17.0-0.nightly"},
+		{payload: "latest-nightly:4.99", expectedErr: "release controller does not know stream 4.99.0-0.nightly (" + url + "/amd64/api/v1/releasestream/4.99.0-0.nightly/tags)"},
+		{payload: "latest-nightly:4.15", expectedErr: "release controller responded with 503 Service Unavailable for stream 4.15.0-0.nightly (" + url + "/amd64/api/v1/releasestream/4.15.0-0.nightly/tags)"},
+		{payload: "latest-nightly:4", expectedErr: `invalid payload "latest-nightly:4", expected a minor version like latest-nightly:4.16`},
+	}
+	for _, test := range tests {
+		var payload string
+		var err error
+		output := captureLog(t, func() { payload, err = resolvePayload(test.payload) })
+		if len(test.expectedErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("%s: expected an error containing %q, got %v", test.payload, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil || payload != test.expected {
+			t.Errorf("%s: expected %s, got %s: %v", test.payload, test.expected, payload, err)
+		}
+		// the chosen payload is logged
+		if test.payload != test.expected && !strings.Contains(output, "Resolved "+test.payload+" to payload ") {
+			t.Errorf("%s: expected the chosen payload logged, got:\n%s", test.payload, output)
+		}
+	}
+}
+
+func TestLatestPayloadQuery(t *testing.T) {
+	fakeReleaseController(t)
+	defer os.Setenv(payloadEnv, os.Getenv(payloadEnv))
+	os.Setenv(payloadEnv, "latest-accepted:4.16")
+	query := &queryOptions{}
+	query.addFlags(flag.NewFlagSet("collect", flag.ContinueOnError))
+	query.since, query.noBranchCheck = "1d", true
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	captureLog(t, func() {
+		result, err := query.collect(context.Background(), fakeCappedGithub(t, map[string]int{"api": 1}), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api"}, NewCache())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := query.render(&out, formatJSON, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	// the payload of the environment is resolved and recorded in the metadata
+	if expected := "registry.ci.openshift.org/ocp/release:4.16.0-0.nightly-2024-05-15-212231"; report.Metadata.Payload != expected {
+		t.Errorf("expected the payload %s in the metadata, got %q", expected, report.Metadata.Payload)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultResumeMaxAge is how long results of an interrupted run are reused by default
+const defaultResumeMaxAge = time.Hour
+
+// resumeResult is the result of a single completed repository.
+type resumeResult struct {
+	Finished time.Time   `json:"finished"`
+	Changes  []RawChange `json:"changes"`
+	Error    *RawError   `json:"error,omitempty"`
+}
+
+type resumeFile struct {
+	Key     string                  `json:"key"`
+	Results map[string]resumeResult `json:"results"`
+}
+
+// resumeState persists results of completed repositories as they finish, so an interrupted run
+// started again with the same parameters only processes the remaining repositories.
+type resumeState struct {
+	path   string
+	key    string
+	maxAge time.Duration
+
+	lock    sync.Mutex
+	results map[string]resumeResult
+}
+
+// resumeKey hashes the options that affect the collected data. The window is given by the caller, as the
+// relative Since changes between runs.
+func resumeKey(options ProcessOptions, window string) string {
+	options.Concurrency = 0
+	options.Since = 0
+	options.Cache = nil
+	options.Resume = nil
+	data, _ := json.Marshal(struct {
+		Options ProcessOptions
+		Window  string
+	}{options, window})
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// loadResumeState reads results of a previous run with the same key, stored next to the cache file, results older
+// than maxAge are dropped. Runs with different parameters (eg. jobs sharing the cache) use different files.
+func loadResumeState(cachePath, key string, maxAge time.Duration) (*resumeState, error) {
+	path := fmt.Sprintf("%s.resume-%s", cachePath, key[:16])
+	state := &resumeState{path: path, key: key, maxAge: maxAge, results: map[string]resumeResult{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f resumeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		log.Printf("WARNING: ignoring unreadable resume file %s: %v", path, err)
+		return state, nil
+	}
+	if f.Key != key {
+		return state, nil
+	}
+	for repository, result := range f.Results {
+		if time.Since(result.Finished) > maxAge {
+			continue
+		}
+		state.results[repository] = result
+	}
+	return state, nil
+}
+
+// Get returns the changes and error of a repository completed by the previous run.
+func (s *resumeState) Get(repository string) ([]Change, *RepositoryError, bool) {
+	if s == nil {
+		return nil, nil, false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result, ok := s.results[repository]
+	if !ok {
+		return nil, nil, false
+	}
+	var changes []Change
+	for _, c := range result.Changes {
+		changes = append(changes, newChange(c))
+	}
+	if result.Error == nil {
+		return changes, nil, true
+	}
+	return changes, &RepositoryError{Repository: repository, Kind: result.Error.Kind, Err: errors.New(result.Error.Message)}, true
+}
+
+// Record persists the result of a completed repository.
+func (s *resumeState) Record(repository string, changes []Change, repositoryErr *RepositoryError) error {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := resumeResult{Finished: time.Now(), Changes: []RawChange{}}
+	for _, c := range changes {
+		result.Changes = append(result.Changes, c.raw)
+	}
+	if repositoryErr != nil {
+		result.Error = &RawError{Kind: repositoryErr.Kind, Message: repositoryErr.Err.Error()}
+	}
+	s.results[repository] = result
+	return s.save()
+}
+
+// save writes the state into a temporary file renamed over the previous one, so a crash can't leave a partial file.
+func (s *resumeState) save() error {
+	data, err := json.Marshal(resumeFile{Key: s.key, Results: s.results})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0600)
+}
+
+// Done removes the state of a completed run.
+func (s *resumeState) Done() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
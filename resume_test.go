@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeKey(t *testing.T) {
+	options := ProcessOptions{BranchName: "master", Concurrency: 10, Since: time.Hour, WithPullRequests: true}
+	key := resumeKey(options, "1h")
+
+	same := options
+	same.Concurrency, same.Since, same.Cache = 1, 2*time.Hour, NewCache()
+	if resumeKey(same, "1h") != key {
+		t.Errorf("expected the concurrency, relative window and cache not to change the key")
+	}
+	for name, other := range map[string]ProcessOptions{
+		"branch":          {BranchName: "release-4.9", WithPullRequests: true},
+		"pull requests":   {BranchName: "master"},
+		"excluded author": {BranchName: "master", WithPullRequests: true, ExcludeAuthors: []string{"openshift-bot"}},
+	} {
+		if resumeKey(other, "1h") == key {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+	if resumeKey(options, "quay.io/x:1") == key {
+		t.Errorf("expected a different key for a different window")
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	key, otherKey := resumeKey(ProcessOptions{BranchName: "master"}, "1h"), resumeKey(ProcessOptions{BranchName: "release-4.9"}, "1h")
+
+	state, err := loadResumeState(cache, key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []Change{newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "a", Message: "Bump the API"})}
+	if err := state.Record("https://github.com/openshift/api", changes, nil); err != nil {
+		t.Fatal(err)
+	}
+	repositoryErr := &RepositoryError{Repository: "https://github.com/openshift/origin", Kind: ErrorKindNotFound, Err: errors.New("404 Not Found")}
+	if err := state.Record("https://github.com/openshift/origin", nil, repositoryErr); err != nil {
+		t.Fatal(err)
+	}
+	// the state is written atomically, no temporary files are left behind
+	files, err := ioutil.ReadDir(filepath.Dir(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasPrefix(files[0].Name(), "cache.json.resume-") {
+		t.Errorf("expected only the resume file, got %v", files)
+	}
+
+	resumed, err := loadResumeState(cache, key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, gotErr, ok := resumed.Get("https://github.com/openshift/api")
+	if !ok || gotErr != nil || len(got) != 1 || got[0].raw.Message != "Bump the API" {
+		t.Errorf("expected the recorded changes, got %+v %v %v", got, gotErr, ok)
+	}
+	if _, gotErr, ok := resumed.Get("https://github.com/openshift/origin"); !ok || gotErr == nil || gotErr.Kind != ErrorKindNotFound || gotErr.Err.Error() != "404 Not Found" {
+		t.Errorf("expected the recorded error, got %v %v", gotErr, ok)
+	}
+	if _, _, ok := resumed.Get("https://github.com/openshift/installer"); ok {
+		t.Errorf("expected no result of a repository not completed")
+	}
+
+	// other parameters and old results are not resumed
+	if other, err := loadResumeState(cache, otherKey, time.Hour); err != nil || len(other.results) != 0 {
+		t.Errorf("expected no results with other parameters, got %v %v", other.results, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if stale, err := loadResumeState(cache, key, time.Millisecond); err != nil || len(stale.results) != 0 {
+		t.Errorf("expected no stale results, got %v %v", stale.results, err)
+	}
+
+	if err := resumed.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(resumed.path); !os.IsNotExist(err) {
+		t.Errorf("expected the resume file removed after the run, got %v", err)
+	}
+}
+
+func TestProcessRepositoriesResume(t *testing.T) {
+	client, listings := fakeJobsGithub(t)
+	cache := filepath.Join(t.TempDir(), "cache.json")
+	options := ProcessOptions{Concurrency: 1, BranchName: "master", Since: 24 * time.Hour, Cache: NewCache()}
+	key := resumeKey(options, "1d")
+
+	// the previous run completed openshift/origin before it was interrupted, which the fake server does not serve
+	previous, err := loadResumeState(cache, key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.Record("https://github.com/openshift/origin", []Change{newChange(RawChange{Repository: "https://github.com/openshift/origin", SHA: "b", Message: "Fix the test"})}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if options.Resume, err = loadResumeState(cache, key, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var changes []Change
+	logged := captureLog(t, func() {
+		changes, _, err = processRepositories(context.Background(), client, options, []string{"https://github.com/openshift/api", "https://github.com/openshift/origin"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || listings() != 1 {
+		t.Errorf("expected the resumed and the listed change with a single listing, got %d changes and %d listings", len(changes), listings())
+	}
+	if !strings.Contains(logged, "resuming: 1/2 repos loaded from previous run") {
+		t.Errorf("expected the resumed repositories logged, got %q", logged)
+	}
+	if _, _, ok := options.Resume.Get("https://github.com/openshift/api"); !ok {
+		t.Errorf("expected the completed repository recorded")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// interner shares the backing data of equal strings (eg. the authors and repositories of thousands of changes), so
+// large result sets retain each of them once.
+type interner struct {
+	lock    sync.Mutex
+	strings map[string]string
+}
+
+func newInterner() *interner {
+	return &interner{strings: map[string]string{}}
+}
+
+func (i *interner) intern(s string) string {
+	if i == nil || len(s) == 0 {
+		return s
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if interned, ok := i.strings[s]; ok {
+		return interned
+	}
+	i.strings[s] = s
+	return s
+}
+
+func (i *interner) internAll(values []string) {
+	for j := range values {
+		values[j] = i.intern(values[j])
+	}
+}
+
+// internChanges interns the repeated fields of the changes and the columns rendered from them.
+func (i *interner) internChanges(changes []Change) {
+	for j := range changes {
+		raw := &changes[j].raw
+		raw.Repository = i.intern(raw.Repository)
+		raw.Author = i.intern(raw.Author)
+		raw.Committer = i.intern(raw.Committer)
+		raw.MergedBy = i.intern(raw.MergedBy)
+		raw.Tier = i.intern(raw.Tier)
+		raw.Capability = i.intern(raw.Capability)
+		i.internAll(raw.Branches)
+		i.internAll(raw.Owners)
+		changes[j].MergedBy = i.intern(changes[j].MergedBy)
+		changes[j].Tier = i.intern(changes[j].Tier)
+		changes[j].Capability = i.intern(changes[j].Capability)
+	}
+}
+
+// compactMessage keeps the subject and the first lines body lines of the message, with the lines other features
+// read: ticket and CVE references, the "This reverts commit" line and the trailers. Returns the message and the
+// number of dropped lines the table output would show (the Co-authored-by lines are shown when coauthors is set),
+// lines 0 keeps the whole message.
+func compactMessage(message string, lines int, coauthors bool) (string, int) {
+	if lines <= 0 {
+		return message, 0
+	}
+	all := strings.Split(message, "\n")
+	trailerStart, _ := trailerBlock(all)
+	kept := []string{all[0]}
+	body, omitted := 0, 0
+	for i := 1; i < len(all); i++ {
+		line := all[i]
+		content := len(strings.TrimSpace(line)) > 0 && !strings.Contains(line, "Signed-off-by") &&
+			(coauthors || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "co-authored-by:"))
+		switch {
+		case trailerStart > 0 && i >= trailerStart-1:
+			// the trailers with the blank line separating them from the body
+			kept = append(kept, line)
+		case !content:
+			// blank lines and signatures are not shown
+		case body < lines:
+			body++
+			kept = append(kept, line)
+		case ticketReference.MatchString(line) || cveReference.MatchString(line) || revertedCommit.MatchString(line):
+			kept = append(kept, line)
+		default:
+			omitted++
+		}
+	}
+	compacted := strings.Join(kept, "\n")
+	// dropping lines must not turn the last body paragraph into trailers
+	if start, _ := trailerBlock(kept); trailerStart < 0 && start >= 0 {
+		return message, 0
+	}
+	return compacted, omitted
+}
+
+// messageRetention returns the number of message body lines the changes keep at collection time and why, 0 when the
+// whole messages are needed: by JSON and template outputs, -save-raw, -show-sanitization-diff, -block-on-secrets or
+// a table without -max-message-lines. Jobs and serve don't set the format and keep the whole messages.
+func messageRetention(format string, saveRaw, sanitizationDiff, blockOnSecrets bool, maxLines int) (int, string) {
+	switch {
+	case len(format) == 0:
+		return 0, "the whole messages are kept"
+	case saveRaw:
+		return 0, "the whole messages are kept for -save-raw"
+	case sanitizationDiff:
+		return 0, "the whole messages are kept for -show-sanitization-diff"
+	case blockOnSecrets:
+		return 0, "the whole messages are kept for -block-on-secrets"
+	case format != formatTable && format != formatJUnit && format != formatTriage:
+		return 0, fmt.Sprintf("the whole messages are kept for the %s output", format)
+	case format == formatTable && maxLines <= 0:
+		return 0, "the whole messages are kept for the table without -max-message-lines"
+	case maxLines <= 0:
+		maxLines = defaultMaxMessageLines
+	}
+	return maxLines, fmt.Sprintf("the subject and %d body lines are kept (with ticket, CVE and revert references and trailers), the rest of the messages is dropped", maxLines)
+}
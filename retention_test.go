@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactMessage(t *testing.T) {
+	message := "Bump the API\n\nFirst line.\nSecond line.\nThird line.\nFixes OCPBUGS-1234\nFourth line.\n\nSigned-off-by: Jane Doe <jane@example.com>"
+	compacted, omitted := compactMessage(message, 2, false)
+	expected := "Bump the API\nFirst line.\nSecond line.\nFixes OCPBUGS-1234\n\nSigned-off-by: Jane Doe <jane@example.com>"
+	if compacted != expected || omitted != 2 {
+		t.Errorf("expected %q with 2 omitted lines, got %q with %d", expected, compacted, omitted)
+	}
+	if compacted, omitted := compactMessage(message, 0, false); compacted != message || omitted != 0 {
+		t.Errorf("expected the whole message without a limit, got %q with %d omitted lines", compacted, omitted)
+	}
+	// the rendered table message counts the omitted lines
+	if full, compact := truncateMessage(sanitizeMessage(message, "", false), 2, 0), truncateMessage(sanitizeMessage(compacted, "", false), 2, omitted); full != compact {
+		t.Errorf("expected the same table message, got %q and %q", full, compact)
+	}
+}
+
+func TestMessageRetention(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		format         string
+		saveRaw        bool
+		blockOnSecrets bool
+		maxLines       int
+		expected       int
+	}{
+		{name: "table", format: formatTable, maxLines: 5, expected: 5},
+		{name: "table without a limit", format: formatTable, maxLines: 0, expected: 0},
+		{name: "junit", format: formatJUnit, maxLines: 0, expected: defaultMaxMessageLines},
+		{name: "json", format: formatJSON, maxLines: 5, expected: 0},
+		{name: "html", format: formatHTML, maxLines: 5, expected: 0},
+		{name: "save raw", format: formatTable, saveRaw: true, maxLines: 5, expected: 0},
+		{name: "block on secrets", format: formatTable, blockOnSecrets: true, maxLines: 5, expected: 0},
+		{name: "jobs and serve", maxLines: 5, expected: 0},
+	} {
+		if lines, _ := messageRetention(test.format, test.saveRaw, false, test.blockOnSecrets, test.maxLines); lines != test.expected {
+			t.Errorf("%s: expected %d lines, got %d", test.name, test.expected, lines)
+		}
+	}
+
+	// the collect command compacts the messages of its format, -save-raw keeps the full fidelity
+	for saveRaw, expected := range map[string]int{"": 5, "raw.json": 0} {
+		options, err := (&queryOptions{messageFormat: formatTable, maxMessageLines: 5, saveRaw: saveRaw}).processOptions(&sharedOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if options.MessageLines != expected {
+			t.Errorf("-save-raw %q: expected %d lines kept, got %d", saveRaw, expected, options.MessageLines)
+		}
+	}
+}
+
+func TestInterner(t *testing.T) {
+	i := newInterner()
+	changes := []Change{
+		{raw: RawChange{Repository: strings.Repeat("openshift", 2), Author: "deads2k", Branches: []string{"master"}}},
+		{raw: RawChange{Repository: strings.Repeat("openshift", 2), Author: "deads2k", Branches: []string{"master"}}},
+	}
+	i.internChanges(changes)
+	if len(i.strings) != 3 {
+		t.Errorf("expected the repository, author and branch interned once, got %q", i.strings)
+	}
+	var disabled *interner
+	if s := disabled.intern("openshift"); s != "openshift" {
+		t.Errorf("expected the nil interner to return the string, got %q", s)
+	}
+}
+
+// collectedChanges builds the n changes of a collection the way processRepository does, each from its own decoded
+// strings: the messages have a subject, 30 body lines and a Signed-off-by trailer. The message bodies are compacted
+// to lines (see compactMessage) and the strings interned by interned when it is not nil.
+func collectedChanges(n, lines int, interned *interner) []Change {
+	date := time.Now()
+	changes := make([]Change, n)
+	for i := range changes {
+		body := make([]string, 30)
+		for j := range body {
+			body[j] = fmt.Sprintf("Line %d of the body of change %d describing it in some detail.", j, i)
+		}
+		raw := RawChange{
+			Repository: fmt.Sprintf("https://github.com/openshift/repository-%d", i%200),
+			SHA:        fmt.Sprintf("%040x", i),
+			URL:        fmt.Sprintf("https://github.com/openshift/repository-%d/commit/%040x", i%200, i),
+			Message:    fmt.Sprintf("Change %d of the synthetic data set\n\n%s\n\nSigned-off-by: author-%d <author-%d@example.com>", i, strings.Join(body, "\n"), i%50, i%50),
+			Date:       date.Add(-time.Duration(i) * time.Second),
+			Author:     fmt.Sprintf("author-%d", i%50),
+			Committer:  fmt.Sprintf("author-%d", i%50),
+			// each decoded change has its own copy
+			Branches: []string{string([]byte("release-4.9"))},
+		}
+		raw.Message, raw.OmittedLines = compactMessage(raw.Message, lines, false)
+		changes[i] = newChange(raw)
+	}
+	interned.internChanges(changes)
+	return changes
+}
+
+// BenchmarkRetainedChanges collects 50k changes with the whole messages and no interning (as before the
+// retention), and with the messages of the table compacted and the strings interned, run with -benchmem,
+// retained-heap-B is the heap retained by the collected changes.
+func BenchmarkRetainedChanges(b *testing.B) {
+	for _, test := range []struct {
+		name   string
+		lines  int
+		intern bool
+	}{
+		{name: "whole", lines: 0},
+		{name: "interned", lines: 0, intern: true},
+		{name: "compacted", lines: defaultMaxMessageLines, intern: true},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var retained uint64
+			for i := 0; i < b.N; i++ {
+				var stats runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&stats)
+				base := stats.HeapAlloc
+				var interned *interner
+				if test.intern {
+					interned = newInterner()
+				}
+				// the interner is dropped with the run state, the changes keep the interned strings
+				changes := collectedChanges(50000, test.lines, interned)
+				interned = nil
+				runtime.GC()
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > base {
+					retained = stats.HeapAlloc - base
+				}
+				runtime.KeepAlive(changes)
+			}
+			b.ReportMetric(float64(retained), "retained-heap-B")
+		})
+	}
+}
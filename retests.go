@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// defaultRetestsLimit is the default number of pull requests examined by -with-retests
+const defaultRetestsLimit = 50
+
+// errRetestsLimit is returned for pull requests over the -retests-limit, they are not examined
+var errRetestsLimit = errors.New("retests limit reached")
+
+// Retests are the Prow commands issued on a pull request before it merged.
+type Retests struct {
+	Count     int
+	Overrides []string
+}
+
+// parseRetests counts "/retest" (including "/retest-required") and "/override" commands in the comments,
+// returning the overridden contexts.
+func parseRetests(comments []*github.IssueComment) Retests {
+	var result Retests
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment.GetBody(), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(fields[0], "/retest"):
+				result.Count++
+			case fields[0] == "/override":
+				result.Count++
+				result.Overrides = append(result.Overrides, fields[1:]...)
+			}
+		}
+	}
+	return result
+}
+
+// retestCounter counts retests of (up to limit) pull requests, results are cached per pull request.
+type retestCounter struct {
+	client *github.Client
+	limit  int
+
+	lock     sync.Mutex
+	examined int
+	cache    map[string]Retests
+}
+
+func newRetestCounter(client *github.Client, limit int) *retestCounter {
+	return &retestCounter{client: client, limit: limit, cache: map[string]Retests{}}
+}
+
+func (r *retestCounter) Count(ctx context.Context, organization, name string, number int) (*Retests, error) {
+	key := fmt.Sprintf("%s/%s#%d", organization, name, number)
+	r.lock.Lock()
+	retests, ok := r.cache[key]
+	if !ok && r.limit > 0 && r.examined >= r.limit {
+		r.lock.Unlock()
+		return nil, errRetestsLimit
+	}
+	if !ok {
+		r.examined++
+	}
+	r.lock.Unlock()
+	if ok {
+		return &retests, nil
+	}
+
+	var comments []*github.IssueComment
+	options := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := r.client.Issues.ListComments(withCategory(ctx, categoryComments), organization, name, number, options)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+	retests = parseRetests(comments)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cache[key] = retests
+	return &retests, nil
+}
+
+// printRetestSummary calls out the pull request with the most retests.
+func printRetestSummary(changes []Change) {
+	var most *RawChange
+	for i := range changes {
+		c := &changes[i].raw
+		if c.Retests != nil && *c.Retests > 0 && (most == nil || *c.Retests > *most.Retests) {
+			most = c
+		}
+	}
+	if most == nil {
+		return
+	}
+	log.Printf("The most retested change is %s (#%d) with %d /retest and /override commands", most.URL, most.PullRequest, *most.Retests)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParseRetests(t *testing.T) {
+	comments := []*github.IssueComment{
+		{Body: github.String("/retest")},
+		{Body: github.String("LGTM\n/retest-required\n")},
+		{Body: github.String("/override ci/prow/e2e-aws ci/prow/e2e-gcp")},
+		{Body: github.String("please do not /retest yet")},
+		{Body: github.String("/lgtm")},
+	}
+	retests := parseRetests(comments)
+	if expected := (Retests{Count: 3, Overrides: []string{"ci/prow/e2e-aws", "ci/prow/e2e-gcp"}}); !reflect.DeepEqual(retests, expected) {
+		t.Errorf("expected %+v, got %+v", expected, retests)
+	}
+}
+
+// fakeCommentsGithub serves the comments of openshift/api pull requests in pages of a single comment. It returns
+// the number of requests of each pull request.
+func fakeCommentsGithub(t *testing.T) (*github.Client, func(number int) int) {
+	var lock sync.Mutex
+	requests := map[int]int{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var number int
+		if _, err := fmt.Sscanf(req.URL.Path, "/repos/openshift/api/issues/%d/comments", &number); err != nil {
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lock.Lock()
+		requests[number]++
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"body": "/override ci/prow/unit"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%[1]s%[2]s?page=2>; rel="next", <%[1]s%[2]s?page=2>; rel="last"`, server.URL, req.URL.Path))
+		fmt.Fprint(w, `[{"body": "/retest"}]`)
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func(number int) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests[number]
+	}
+}
+
+func TestRetestCounter(t *testing.T) {
+	client, requests := fakeCommentsGithub(t)
+	counter := newRetestCounter(client, 1)
+
+	retests, err := counter.Count(context.Background(), "openshift", "api", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Retests{Count: 2, Overrides: []string{"ci/prow/unit"}}); !reflect.DeepEqual(*retests, expected) {
+		t.Errorf("expected the commands of both pages %+v, got %+v", expected, *retests)
+	}
+	// the pull request is cached, the limit only applies to pull requests not examined yet
+	if _, err := counter.Count(context.Background(), "openshift", "api", 42); err != nil {
+		t.Errorf("expected the cached retests, got %v", err)
+	}
+	if requests(42) != 2 {
+		t.Errorf("expected the two pages requested once, got %d requests", requests(42))
+	}
+	if _, err := counter.Count(context.Background(), "openshift", "api", 43); err != errRetestsLimit {
+		t.Errorf("expected the limit reached, got %v", err)
+	}
+	if requests(43) != 0 {
+		t.Errorf("expected no requests over the limit, got %d", requests(43))
+	}
+}
+
+func TestPrintRetestSummary(t *testing.T) {
+	one, three := 1, 3
+	changes := []Change{
+		newChange(RawChange{URL: "https://github.com/openshift/api/commit/a", PullRequest: 1, Retests: &one}),
+		newChange(RawChange{URL: "https://github.com/openshift/api/commit/b", PullRequest: 2, Retests: &three}),
+		newChange(RawChange{URL: "https://github.com/openshift/api/commit/c"}),
+	}
+	output := captureLog(t, func() { printRetestSummary(changes) })
+	if expected := "The most retested change is https://github.com/openshift/api/commit/b (#2) with 3 /retest and /override commands"; !strings.Contains(output, expected) {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+	if output := captureLog(t, func() { printRetestSummary(changes[2:]) }); len(output) > 0 {
+		t.Errorf("expected no summary without retests, got %q", output)
+	}
+}
+
+// captureLog returns what the function logs.
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	f()
+	return buf.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// lineDiff returns the unified diff lines turning a into b, prefixed by '-' (only in a), '+' (only in b) or ' '
+// (in both), computed from their longest common subsequence.
+func lineDiff(a, b []string) []string {
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, " "+a[i])
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+"+b[j])
+	}
+	return diff
+}
+
+// contentLines are the lines of the message without surrounding whitespace, empty lines are left out.
+func contentLines(message string) []string {
+	var lines []string
+	for _, l := range strings.Split(message, "\n") {
+		if l = strings.TrimSpace(l); len(l) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// sanitizationChanged reports whether sanitizeMessage changes the message beyond whitespace.
+func sanitizationChanged(raw RawChange, coauthors bool) bool {
+	before, after := contentLines(raw.Message), contentLines(sanitizeMessage(raw.Message, raw.SHA, coauthors))
+	if len(before) != len(after) {
+		return true
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// logSanitizationDiffs logs how sanitizeMessage changed the message of each change beyond whitespace (see
+// -show-sanitization-diff) and how many changes it affected, to tell over-aggressive sanitization from messages
+// that are wrong upstream. The Co-authored-by lines are kept with coauthors.
+func logSanitizationDiffs(changes []Change, coauthors bool) {
+	affected := 0
+	for _, c := range changes {
+		if !sanitizationChanged(c.raw, coauthors) {
+			continue
+		}
+		affected++
+		diff := lineDiff(strings.Split(c.raw.Message, "\n"), strings.Split(sanitizeMessage(c.raw.Message, c.raw.SHA, coauthors), "\n"))
+		log.Printf("[%s] sanitized message of %s:\n--- raw\n+++ sanitized\n%s", c.raw.Repository, shortSHA(c.raw.SHA), strings.Join(diff, "\n"))
+	}
+	log.Printf("Sanitization changed the message of %d of %d changes beyond whitespace", affected, len(changes))
+}
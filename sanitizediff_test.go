@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected string
+	}{
+		{a: "a\nb\nc", b: "a\nb\nc", expected: " a| b| c"},
+		{a: "a\nb\nc", b: "a\nc", expected: " a|-b| c"},
+		{a: "a\nc", b: "a\nb\nc", expected: " a|+b| c"},
+		{a: "a\nb", b: "c\nd", expected: "-a|-b|+c|+d"},
+		{a: "subject\n\nbody\nSigned-off-by: x", b: "subject\nbody", expected: " subject|-| body|-Signed-off-by: x"},
+	} {
+		if diff := strings.Join(lineDiff(strings.Split(test.a, "\n"), strings.Split(test.b, "\n")), "|"); diff != test.expected {
+			t.Errorf("diff of %q and %q: expected %q, got %q", test.a, test.b, test.expected, diff)
+		}
+	}
+}
+
+func TestSanitizationChanged(t *testing.T) {
+	for message, expected := range map[string]bool{
+		"Fix the build": false,
+		"Fix the build\n\n  with indentation\n\n":     false,
+		"Fix the build\n\nSigned-off-by: Jane <j@x>":  true,
+		"Fix the build\n\nCo-authored-by: Jane <j@x>": true,
+	} {
+		if changed := sanitizationChanged(RawChange{Message: message, SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e"}, false); changed != expected {
+			t.Errorf("%q: expected changed %v, got %v", message, expected, changed)
+		}
+	}
+	if sanitizationChanged(RawChange{Message: "Fix the build\n\nCo-authored-by: Jane <j@x>"}, true) {
+		t.Errorf("expected the Co-authored-by lines kept with -keep-coauthors")
+	}
+}
+
+func TestHTMLNoSanitize(t *testing.T) {
+	changes := []Change{newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API\n\nSigned-off-by: Jane Doe <jane@example.com>"})}
+	for _, noSanitize := range []bool{false, true} {
+		var out bytes.Buffer
+		if err := writeReport(&out, formatHTML, Report{Changes: changes, NoSanitize: noSanitize}); err != nil {
+			t.Fatal(err)
+		}
+		if signed := strings.Contains(out.String(), "Signed-off-by"); signed != noSanitize {
+			t.Errorf("-no-sanitize %v: expected the signature line %v, got %v:\n%s", noSanitize, noSanitize, signed, out.String())
+		}
+		if !strings.Contains(out.String(), "Bump the API") {
+			t.Errorf("-no-sanitize %v: expected the subject:\n%s", noSanitize, out.String())
+		}
+	}
+}
+
+func TestLogSanitizationDiffs(t *testing.T) {
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API\n\nSigned-off-by: Jane Doe <jane@example.com>"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "7629413fb0b4a5bbbf19a3a0f9c5fed58af1e3b0", Message: "Fix the login\n\n"}),
+	}
+	output := captureLog(t, func() { logSanitizationDiffs(changes, false) })
+	for _, expected := range []string{"sanitized message of 553c207:\n--- raw\n+++ sanitized\n Bump the API\n-\n-Signed-off-by: Jane Doe <jane@example.com>", "Sanitization changed the message of 1 of 2 changes beyond whitespace"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in the log:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "7629413") {
+		t.Errorf("expected only the changed message diffed:\n%s", output)
+	}
+}
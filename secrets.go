@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const redactedSecret = "[REDACTED]"
+
+// defaultSecretPatterns match strings that look like credentials. When a pattern has a group, only the
+// group is the secret (eg. the value following "password:").
+var defaultSecretPatterns = []string{
+	// AWS access key IDs
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// Github tokens
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	// bearer tokens in headers or curl commands
+	`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{20,}=*)`,
+	// long base64-like values of password, token, secret or api key fields
+	`(?i)\b(?:password|passwd|token|secret|api[_-]?key)["']?\s*[:=]\s*["']?([A-Za-z0-9+/_\-]{16,}={0,2})`,
+}
+
+// notSecret matches values that look like a secret but are common in commit messages (SHAs and UUIDs).
+var notSecret = regexp.MustCompile(`^(?i:[0-9a-f]{7,64}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// secretDetector finds potential secrets in commit messages.
+type secretDetector struct {
+	patterns []*regexp.Regexp
+}
+
+// newSecretDetector returns a detector of the default patterns and the additional ones.
+func newSecretDetector(additional []string) (*secretDetector, error) {
+	d := &secretDetector{}
+	for _, pattern := range append(append([]string{}, defaultSecretPatterns...), additional...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %v", pattern, err)
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	return d, nil
+}
+
+// readSecretDetector returns a detector with additional patterns read from the file, one per line,
+// empty lines and lines starting with '#' are ignored.
+func readSecretDetector(file string) (*secretDetector, error) {
+	if len(file) == 0 {
+		return newSecretDetector(nil)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	detector, err := newSecretDetector(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return detector, nil
+}
+
+// matches returns the start and end offsets of the secrets in the message.
+func (d *secretDetector) matches(message string) [][2]int {
+	var result [][2]int
+	for _, re := range d.patterns {
+		for _, m := range re.FindAllStringSubmatchIndex(message, -1) {
+			start, end := m[0], m[1]
+			// the first matching group is the secret, when the pattern has one
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if notSecret.MatchString(message[start:end]) {
+				continue
+			}
+			result = append(result, [2]int{start, end})
+		}
+	}
+	return result
+}
+
+// Find returns the potential secrets in the message.
+func (d *secretDetector) Find(message string) []string {
+	var secrets []string
+	for _, m := range d.matches(message) {
+		secrets = append(secrets, message[m[0]:m[1]])
+	}
+	return secrets
+}
+
+// Redact replaces the potential secrets in the message.
+func (d *secretDetector) Redact(message string) string {
+	redact := make([]bool, len(message))
+	for _, m := range d.matches(message) {
+		for i := m[0]; i < m[1]; i++ {
+			redact[i] = true
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if !redact[i] {
+			b.WriteByte(message[i])
+			continue
+		}
+		if i == 0 || !redact[i-1] {
+			b.WriteString(redactedSecret)
+		}
+	}
+	return b.String()
+}
+
+// redactChanges replaces potential secrets in the messages of the changes.
+func redactChanges(changes []Change, detector *secretDetector) []Change {
+	for i := range changes {
+		raw := changes[i].raw
+		if redacted := detector.Redact(raw.Message); redacted != raw.Message {
+			raw.Message = redacted
+			changes[i] = newChange(raw)
+		}
+	}
+	return changes
+}
+
+// redactDirectPushes returns the direct pushes with potential secrets replaced in their subjects.
+func redactDirectPushes(pushes []DirectPush, detector *secretDetector) []DirectPush {
+	redacted := make([]DirectPush, len(pushes))
+	for i, p := range pushes {
+		p.Subject = detector.Redact(p.Subject)
+		redacted[i] = p
+	}
+	return redacted
+}
+
+// redactIncident returns a copy of the incident with potential secrets replaced in the subjects of its commits.
+func redactIncident(incident *Incident, detector *secretDetector) *Incident {
+	if incident == nil {
+		return nil
+	}
+	redacted := *incident
+	redacted.Pairs = make([]IncidentPair, len(incident.Pairs))
+	for i, pair := range incident.Pairs {
+		pair.Revert.Subject = detector.Redact(pair.Revert.Subject)
+		if pair.Original != nil {
+			original := *pair.Original
+			original.Subject = detector.Redact(original.Subject)
+			pair.Original = &original
+		}
+		redacted.Pairs[i] = pair
+	}
+	return &redacted
+}
+
+// checkSecrets fails with the list of changes whose messages contain potential secrets.
+func checkSecrets(changes []Change, detector *secretDetector) error {
+	var offending []string
+	for _, c := range changes {
+		if secrets := detector.Find(c.raw.Message); len(secrets) > 0 {
+			offending = append(offending, fmt.Sprintf("%s (%d potential secrets)", c.raw.URL, len(secrets)))
+		}
+	}
+	if len(offending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d changes contain potential secrets:\n  %s", len(offending), strings.Join(offending, "\n  "))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultSeenStore is the store of the changes announced by serve unless -seen-store is given, relative to the
+// home directory
+var defaultSeenStore = filepath.Join(".local", "state", "ocp-what-merged", "seen.json")
+
+// seenMargin is how long changes are remembered after they left the window, so a slow clock or a longer window
+// after a restart doesn't announce them again
+const seenMargin = 24 * time.Hour
+
+// seenRetention is how long the changes are remembered: the longest window of a collection (-min-commits extends
+// the windows of quiet repositories) plus seenMargin.
+func seenRetention(options ProcessOptions) time.Duration {
+	retention := options.Since
+	if options.MinCommits > 0 && options.MaxLookback > retention {
+		retention = options.MaxLookback
+	}
+	return retention + seenMargin
+}
+
+type seenFile struct {
+	// Checksum is the SHA256 of the JSON of Commits, to detect truncated or edited files
+	Checksum string `json:"checksum"`
+	// Commits are the merge times of the announced commits by ORG/NAME@BRANCH and SHA
+	Commits map[string]map[string]time.Time `json:"commits"`
+}
+
+// seenStore persists the changes already announced by serve, so restarted processes announce only the new ones.
+type seenStore struct {
+	path string
+	// retention is how long changes are remembered after they merged, the longest window plus seenMargin
+	retention time.Duration
+	commits   map[string]map[string]time.Time
+	// now is the clock, replaced to test the retention
+	now func() time.Time
+}
+
+func seenChecksum(commits map[string]map[string]time.Time) (string, error) {
+	// maps are encoded with sorted keys
+	data, err := json.Marshal(commits)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// loadSeenStore reads the store, a corrupted file is moved aside with a warning and the store starts empty. reset
+// forgets all the announced changes (see -reset-seen).
+func loadSeenStore(path string, retention time.Duration, reset bool) (*seenStore, error) {
+	store := &seenStore{path: path, retention: retention, commits: map[string]map[string]time.Time{}, now: time.Now}
+	if reset {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		log.Printf("Forgot the announced changes in %s", path)
+		return store, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f seenFile
+	err = json.Unmarshal(data, &f)
+	if err == nil {
+		var checksum string
+		if checksum, err = seenChecksum(f.Commits); err == nil && checksum != f.Checksum {
+			err = fmt.Errorf("checksum mismatch")
+		}
+	}
+	if err != nil {
+		backup := fmt.Sprintf("%s.corrupt-%s", path, store.now().UTC().Format("20060102-150405"))
+		if renameErr := os.Rename(path, backup); renameErr != nil {
+			return nil, fmt.Errorf("unable to move the corrupted seen store %s aside: %v", path, renameErr)
+		}
+		log.Printf("WARNING: the seen store %s is corrupted (%v), moved it to %s and starting from scratch, changes in the window are announced again", path, err, backup)
+		return store, nil
+	}
+	if f.Commits != nil {
+		store.commits = f.Commits
+	}
+	store.prune()
+	return store, nil
+}
+
+func seenKey(repository, branch string) string {
+	return repositoryName(repository) + "@" + branch
+}
+
+// prune forgets the changes merged before the retention, they are out of any window.
+func (s *seenStore) prune() {
+	cutoff := s.now().Add(-s.retention)
+	for key, commits := range s.commits {
+		for sha, merged := range commits {
+			if merged.Before(cutoff) {
+				delete(commits, sha)
+			}
+		}
+		if len(commits) == 0 {
+			delete(s.commits, key)
+		}
+	}
+}
+
+// unseen returns the changes of the branch that were not announced yet.
+func (s *seenStore) unseen(changes []Change, branch string) []Change {
+	var fresh []Change
+	for _, c := range changes {
+		if _, ok := s.commits[seenKey(c.raw.Repository, branch)][c.raw.SHA]; !ok {
+			fresh = append(fresh, c)
+		}
+	}
+	return fresh
+}
+
+// markSeen remembers the changes as announced.
+func (s *seenStore) markSeen(changes []Change, branch string) {
+	for _, c := range changes {
+		key := seenKey(c.raw.Repository, branch)
+		if s.commits[key] == nil {
+			s.commits[key] = map[string]time.Time{}
+		}
+		s.commits[key][c.raw.SHA] = c.raw.Date
+	}
+}
+
+// save prunes the store and replaces the file atomically.
+func (s *seenStore) save() error {
+	s.prune()
+	checksum, err := seenChecksum(s.commits)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(seenFile{Checksum: checksum, Commits: s.commits})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0)
+}
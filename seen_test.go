@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seenChange(sha string, merged time.Time) Change {
+	return Change{raw: RawChange{Repository: "https://github.com/openshift/origin", SHA: sha, Date: merged}}
+}
+
+func seenSHAs(changes []Change) string {
+	var shas []string
+	for _, c := range changes {
+		shas = append(shas, c.raw.SHA)
+	}
+	return fmt.Sprint(shas)
+}
+
+func TestSeenStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "seen.json")
+	start := time.Now()
+	recent, old, fresh := seenChange("aaa", start.Add(-time.Hour)), seenChange("bbb", start.Add(-20*time.Hour)), seenChange("ccc", start)
+
+	store, err := loadSeenStore(path, 30*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.markSeen([]Change{recent, old}, "master")
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted process announces only the new change, of the branch the changes were seen on
+	store, err = loadSeenStore(path, 30*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []Change{recent, old, fresh}
+	if unseen := seenSHAs(store.unseen(changes, "master")); unseen != "[ccc]" {
+		t.Errorf("expected only the new change unseen, got %s", unseen)
+	}
+	if unseen := seenSHAs(store.unseen(changes, "release-4.8")); unseen != "[aaa bbb ccc]" {
+		t.Errorf("expected all the changes of another branch unseen, got %s", unseen)
+	}
+
+	// the old change merged before the retention is forgotten when the store is saved
+	store.now = func() time.Time { return start.Add(15 * time.Hour) }
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = loadSeenStore(path, 30*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unseen := seenSHAs(store.unseen(changes, "master")); unseen != "[bbb ccc]" {
+		t.Errorf("expected the change out of the retention unseen, got %s", unseen)
+	}
+
+	store, err = loadSeenStore(path, 30*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unseen := seenSHAs(store.unseen(changes, "master")); unseen != "[aaa bbb ccc]" {
+		t.Errorf("expected -reset-seen to forget the changes, got %s", unseen)
+	}
+}
+
+func TestSeenStoreCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "seen.json")
+	store, err := loadSeenStore(path, 30*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.markSeen([]Change{seenChange("aaa", time.Now())}, "master")
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a truncated file fails the checksum or the JSON
+	if err := ioutil.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = loadSeenStore(path, 30*time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+	if unseen := seenSHAs(store.unseen([]Change{seenChange("aaa", time.Now())}, "master")); unseen != "[aaa]" {
+		t.Errorf("expected the corrupted store to start empty, got %s unseen", unseen)
+	}
+	backups, err := filepath.Glob(path + ".corrupt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("expected the corrupted store moved aside, got %v", backups)
+	}
+}
+
+func TestSeenStoreRetentionBoundary(t *testing.T) {
+	start := time.Date(2021, 8, 18, 12, 0, 0, 0, time.UTC)
+	retention := seenRetention(ProcessOptions{Since: 24 * time.Hour})
+	if retention != 48*time.Hour {
+		t.Errorf("expected the window plus a day, got %s", retention)
+	}
+	// quiet repositories are listed back to -max-lookback with -min-commits
+	if r := seenRetention(ProcessOptions{Since: 24 * time.Hour, MinCommits: 5, MaxLookback: 7 * 24 * time.Hour}); r != 8*24*time.Hour {
+		t.Errorf("expected the lookback plus a day, got %s", r)
+	}
+
+	path := filepath.Join(t.TempDir(), "seen.json")
+	store, err := loadSeenStore(path, retention, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return start }
+	edge, before := seenChange("aaa", start.Add(-retention)), seenChange("bbb", start.Add(-retention-time.Second))
+	store.markSeen([]Change{edge, before}, "master")
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+	// the change merged right at the retention is kept, a second earlier it is forgotten
+	if unseen := seenSHAs(store.unseen([]Change{edge, before}, "master")); unseen != "[bbb]" {
+		t.Errorf("expected only the change before the retention forgotten, got %s unseen", unseen)
+	}
+}
+
+func TestAnnounce(t *testing.T) {
+	store, err := loadSeenStore(filepath.Join(t.TempDir(), "seen.json"), 48*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	first := []Change{seenChange("aaaaaaaa", now.Add(-time.Hour))}
+	first[0].raw.Message = "Fix the build\n\nDetails"
+	var announced int
+	output := captureLog(t, func() { announced = announce(store, first, "master") })
+	if announced != 1 || !strings.Contains(output, "[openshift/origin] aaaaaaa Fix the build") {
+		t.Errorf("expected the change announced, got %d:\n%s", announced, output)
+	}
+	if announced = announce(store, append(first, seenChange("bbbbbbbb", now)), "master"); announced != 1 {
+		t.Errorf("expected only the new change announced, got %d", announced)
+	}
+
+	c := &collection{}
+	c.set(first, nil, announced)
+	recorder := httptest.NewRecorder()
+	c.serveMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), "ocp_what_merged_announced_changes 1\n") {
+		t.Errorf("expected the announced changes in the metrics, got:\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+type serveOptions struct {
+	queryOptions
+
+	listen   string
+	interval time.Duration
+
+	seenStore string
+	resetSeen bool
+}
+
+func (o *serveOptions) addFlags(fs *flag.FlagSet) {
+	o.queryOptions.addFlags(fs)
+	fs.StringVar(&o.listen, "listen", ":8080", "Address to serve the changes and metrics on")
+	fs.DurationVar(&o.interval, "interval", 15*time.Minute, "How often the changes are collected")
+	fs.StringVar(&o.seenStore, "seen-store", "", "File remembering the announced changes, so restarts announce only new ones (defaults to ~/"+defaultSeenStore+")")
+	fs.BoolVar(&o.resetSeen, "reset-seen", false, "Forget the announced changes, the changes in the window are announced again")
+}
+
+func newServeCommand() *command {
+	cmd := newCommand("serve", "Periodically collect changes and serve them over HTTP with metrics", `
+Endpoints:
+  /         the table of changes from the last collection, or of the repositories processed so far until the
+            first collection completes
+  /metrics  number of changes per repository in Prometheus text format
+
+Changes not announced by a previous collection are logged, the announced ones are remembered in the -seen-store
+across restarts.
+
+Examples:
+  # serve changes merged in last 24h, refreshed every 15 minutes
+  ocp-what-merged serve -listen :8080
+
+  # serve release-4.9 changes for the last week, refreshed every hour
+  ocp-what-merged serve -branch release-4.9 -since 7d -interval 1h
+`)
+	shared := &sharedOptions{}
+	options := &serveOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		return runServe(ctx, shared, options)
+	}
+	return cmd
+}
+
+// collection is the result of the last collection served over HTTP.
+type collection struct {
+	lock sync.RWMutex
+
+	collected time.Time
+	changes   []Change
+	errs      []RepositoryError
+	// announced is the number of changes of the collection that were not announced before
+	announced int
+
+	// partial are the changes of the collection in progress, of processed out of total repositories, total is 0
+	// when no collection is in progress
+	partial   []Change
+	processed int
+	total     int
+
+	// wrap is how the messages are wrapped (see -width), trailers are the keys of the trailer columns (see -columns)
+	wrap     MessageWrap
+	trailers []string
+}
+
+// add adds the changes of a repository processed by the collection in progress.
+func (c *collection) add(changes []Change, processed, total int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.partial = append(c.partial, changes...)
+	sortChanges(c.partial)
+	c.processed, c.total = processed, total
+}
+
+func (c *collection) set(changes []Change, errs []RepositoryError, announced int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.collected = time.Now()
+	c.changes = changes
+	c.errs = errs
+	c.announced = announced
+	c.partial = nil
+	c.processed, c.total = 0, 0
+}
+
+// reset drops the changes of the collection in progress when it failed.
+func (c *collection) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.partial = nil
+	c.processed, c.total = 0, 0
+}
+
+// serveChanges serves the changes of the last collection, or the changes of the repositories processed so far
+// until the first collection completes.
+func (c *collection) serveChanges(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var out bytes.Buffer
+	if c.collected.IsZero() {
+		fmt.Fprintf(&out, "Collecting, %d/%d repositories processed\n\n", c.processed, c.total)
+		printChanges(&out, c.partial, c.wrap, c.trailers)
+	} else {
+		fmt.Fprintf(&out, "Collected %s\n", c.collected.In(displayLocation).Format(time.RFC3339))
+		if c.total > 0 {
+			fmt.Fprintf(&out, "Collecting again, %d/%d repositories processed\n", c.processed, c.total)
+		}
+		fmt.Fprintln(&out)
+		printChanges(&out, c.changes, c.wrap, c.trailers)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(out.Bytes())
+}
+
+func (c *collection) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	counts := map[string]int{}
+	for _, change := range c.changes {
+		counts[change.raw.Repository]++
+	}
+	var repositories []string
+	for repository := range counts {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP ocp_what_merged_changes Number of changes in the window per repository.\n")
+	fmt.Fprintf(w, "# TYPE ocp_what_merged_changes gauge\n")
+	for _, repository := range repositories {
+		fmt.Fprintf(w, "ocp_what_merged_changes{repository=%q} %d\n", repository, counts[repository])
+	}
+	fmt.Fprintf(w, "# HELP ocp_what_merged_repository_errors Number of repositories that could not be processed.\n")
+	fmt.Fprintf(w, "# TYPE ocp_what_merged_repository_errors gauge\n")
+	fmt.Fprintf(w, "ocp_what_merged_repository_errors %d\n", len(c.errs))
+	fmt.Fprintf(w, "# HELP ocp_what_merged_announced_changes Number of changes of the last collection that were not announced before.\n")
+	fmt.Fprintf(w, "# TYPE ocp_what_merged_announced_changes gauge\n")
+	fmt.Fprintf(w, "ocp_what_merged_announced_changes %d\n", c.announced)
+	fmt.Fprintf(w, "# HELP ocp_what_merged_last_collection_timestamp_seconds Time of the last successful collection.\n")
+	fmt.Fprintf(w, "# TYPE ocp_what_merged_last_collection_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "ocp_what_merged_last_collection_timestamp_seconds %d\n", c.collected.Unix())
+}
+
+// announce logs the changes that were not announced yet and remembers them in the seen store, failures to save it
+// are logged as the collection goes on. Returns the number of announced changes.
+func announce(seen *seenStore, changes []Change, branch string) int {
+	fresh := seen.unseen(changes, branch)
+	if len(fresh) > 0 {
+		log.Printf("Announcing %d new changes of %d in the window:", len(fresh), len(changes))
+	}
+	for _, c := range fresh {
+		log.Printf("[%s] %s %s", repositoryName(c.raw.Repository), shortSHA(c.raw.SHA), commitSubject(c.raw.Message))
+	}
+	seen.markSeen(fresh, branch)
+	if err := seen.save(); err != nil {
+		log.Printf("WARNING: unable to save the seen store %s, the changes may be announced again after a restart: %v", seen.path, err)
+	}
+	return len(fresh)
+}
+
+func collectPeriodically(ctx context.Context, client *github.Client, shared *sharedOptions, o *serveOptions, c *collection, seen *seenStore) {
+	for {
+		result, err := o.collect(ctx, client, shared, nil, nil)
+		if err != nil {
+			log.Printf("unable to collect changes: %v", err)
+			c.reset()
+		} else {
+			// the changes are published, so potential secrets are always redacted
+			changes := redactChanges(o.apply(result.Changes), o.secrets)
+			formatDurations(changes, formatterOrNow(result.Options.Durations))
+			// a window starting at a date or a payload grows with each collection
+			seen.retention = seenRetention(result.Options)
+			announced := announce(seen, changes, result.Options.BranchName)
+			c.set(truncateMessages(changes, o.maxMessageLines), result.Errors, announced)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.interval):
+		}
+	}
+}
+
+// publishProgress adds the changes of each repository to the collection in progress as soon as it is processed,
+// filtered and redacted like the collected changes.
+func (o *serveOptions) publishProgress(c *collection) {
+	o.onResult = func(result RepositoryResult, processed, total int) {
+		changes, _ := o.filter(result.Changes)
+		c.add(truncateMessages(redactChanges(changes, o.secrets), o.maxMessageLines), processed, total)
+	}
+}
+
+func runServe(ctx context.Context, shared *sharedOptions, o *serveOptions) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	processOptions, err := o.processOptions(shared)
+	if err != nil {
+		return err
+	}
+	if o.payload, err = resolvePayload(o.payload); err != nil {
+		return err
+	}
+	if len(o.seenStore) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("unable to find the home directory for the seen store, use -seen-store: %v", err)
+		}
+		o.seenStore = filepath.Join(home, defaultSeenStore)
+	}
+	seen, err := loadSeenStore(o.seenStore, seenRetention(processOptions), o.resetSeen)
+	if err != nil {
+		return err
+	}
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+
+	trailers, err := parseColumns(o.columns)
+	if err != nil {
+		return err
+	}
+	c := &collection{wrap: shared.messageWrap(), trailers: trailers}
+	o.publishProgress(c)
+	go collectPeriodically(ctx, client, shared, o, c, seen)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", c.serveChanges)
+	mux.HandleFunc("/metrics", c.serveMetrics)
+	log.Printf("Serving changes on %s ...", o.listen)
+	return http.ListenAndServe(o.listen, mux)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultSessionGap is the longest time between consecutive commits of a session (see -collapse-sessions)
+const defaultSessionGap = 30 * time.Minute
+
+// Session is a run of consecutive commits of an author in a repository (eg. a pull request merged without squash),
+// shown as one row by -collapse-sessions.
+type Session struct {
+	Author string    `json:"author"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Commits are all the commits of the session, the oldest first
+	Commits []SessionCommit `json:"commits"`
+}
+
+// SessionCommit is a commit of a session.
+type SessionCommit struct {
+	SHA     string    `json:"sha"`
+	URL     string    `json:"url"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// sessionBreaks reports whether next can't continue the session ending with last: it has another author, was
+// committed gap or more after it, is on the other side of the window start (see -max-lookback) or belongs to another
+// pull request when both pull requests are known.
+func sessionBreaks(last, next RawChange, gap time.Duration) bool {
+	if len(next.Author) == 0 || next.Author != last.Author || next.Date.Sub(last.Date) >= gap || next.OutsideWindow != last.OutsideWindow {
+		return true
+	}
+	lastPull, lastKnown := changePullRequest(last)
+	nextPull, nextKnown := changePullRequest(next)
+	return lastKnown && nextKnown && lastPull != nextPull
+}
+
+// collapseSessions shows consecutive commits of an author in a repository, each committed less than gap after the
+// previous one, as one row: the newest commit with the Session, in its place. Another author committing in between
+// ends the session. Merge commits and changes already collapsed with other ones (see -dedupe-by-message,
+// -collapse-duplicates) are never part of a session.
+func collapseSessions(changes []Change, gap time.Duration) []Change {
+	repositories := map[string][]int{}
+	for i, c := range changes {
+		repositories[c.raw.Repository] = append(repositories[c.raw.Repository], i)
+	}
+
+	collapsed := map[int]bool{}
+	result := make([]Change, len(changes))
+	copy(result, changes)
+	for _, indexes := range repositories {
+		sort.SliceStable(indexes, func(i, j int) bool { return changes[indexes[i]].raw.Date.Before(changes[indexes[j]].raw.Date) })
+		var session []int
+		flush := func() {
+			if len(session) > 1 {
+				newest := session[len(session)-1]
+				raw := changes[newest].raw
+				raw.Session = newSession(changes, session)
+				result[newest] = newChange(raw)
+				for _, i := range session[:len(session)-1] {
+					collapsed[i] = true
+				}
+			}
+			session = nil
+		}
+		for _, i := range indexes {
+			raw := changes[i].raw
+			if raw.Merge || len(raw.Collapsed) > 0 || len(raw.Duplicates) > 0 {
+				flush()
+				continue
+			}
+			if len(session) > 0 && sessionBreaks(changes[session[len(session)-1]].raw, raw, gap) {
+				flush()
+			}
+			session = append(session, i)
+		}
+		flush()
+	}
+
+	var r []Change
+	for i, c := range result {
+		if !collapsed[i] {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func newSession(changes []Change, indexes []int) *Session {
+	first, last := changes[indexes[0]].raw, changes[indexes[len(indexes)-1]].raw
+	session := &Session{Author: first.Author, Start: first.Date, End: last.Date}
+	for _, i := range indexes {
+		c := changes[i].raw
+		session.Commits = append(session.Commits, SessionCommit{SHA: c.SHA, URL: c.URL, Date: c.Date, Subject: commitSubject(c.Message)})
+	}
+	return session
+}
+
+// formatSession describes the session in the Message column, with the subjects of its first and last commit.
+func formatSession(session *Session, durations Formatter) string {
+	first, last := session.Commits[0], session.Commits[len(session.Commits)-1]
+	subjects := first.Subject + "\n" + last.Subject
+	if len(session.Commits) > 2 {
+		subjects = first.Subject + "\n...\n" + last.Subject
+	}
+	return fmt.Sprintf("%d commits by %s over %s:\n%s", len(session.Commits), session.Author, durations.Duration(session.End.Sub(session.Start)), subjects)
+}
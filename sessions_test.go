@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollapseSessions(t *testing.T) {
+	start := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	commit := func(repository, sha, author string, offset time.Duration) RawChange {
+		return RawChange{Repository: repository, SHA: sha, Author: author, Message: "Change " + sha, Date: start.Add(offset)}
+	}
+	tests := []struct {
+		name    string
+		changes []RawChange
+		// expected are the SHAs of the sessions, changes not in a session are on their own
+		expected [][]string
+	}{
+		{
+			name: "gap boundary",
+			changes: []RawChange{
+				commit(api, "a1", "mfojtik", 0),
+				commit(api, "a2", "mfojtik", defaultSessionGap-time.Second),
+				// exactly the gap after the previous commit starts a new session
+				commit(api, "a3", "mfojtik", 2*defaultSessionGap-time.Second),
+				commit(api, "a4", "mfojtik", 2*defaultSessionGap),
+			},
+			expected: [][]string{{"a1", "a2"}, {"a3", "a4"}},
+		},
+		{
+			name: "interleaved authors",
+			changes: []RawChange{
+				commit(api, "a1", "mfojtik", 0),
+				commit(api, "a2", "mfojtik", time.Minute),
+				commit(api, "b1", "deads2k", 2*time.Minute),
+				commit(api, "a3", "mfojtik", 3*time.Minute),
+				commit(api, "a4", "mfojtik", 4*time.Minute),
+				// commits of other repositories don't interrupt sessions
+				commit(oc, "c1", "mfojtik", 5*time.Minute),
+				commit(api, "a5", "mfojtik", 6*time.Minute),
+			},
+			expected: [][]string{{"a1", "a2"}, {"b1"}, {"c1"}, {"a3", "a4", "a5"}},
+		},
+		{
+			name: "window edge",
+			changes: []RawChange{
+				{Repository: api, SHA: "a1", Author: "mfojtik", Date: start, OutsideWindow: true},
+				{Repository: api, SHA: "a2", Author: "mfojtik", Date: start.Add(time.Minute), OutsideWindow: true},
+				commit(api, "a3", "mfojtik", 2*time.Minute),
+				commit(api, "a4", "mfojtik", 3*time.Minute),
+			},
+			expected: [][]string{{"a1", "a2"}, {"a3", "a4"}},
+		},
+		{
+			name: "pull requests",
+			changes: []RawChange{
+				{Repository: api, SHA: "a1", Author: "mfojtik", Date: start, PullRequest: 12},
+				{Repository: api, SHA: "a2", Author: "mfojtik", Date: start.Add(time.Minute), PullRequest: 12},
+				{Repository: api, SHA: "a3", Author: "mfojtik", Date: start.Add(2 * time.Minute), PullRequest: 13},
+				// an unknown pull request continues the session
+				{Repository: api, SHA: "a4", Author: "mfojtik", Date: start.Add(3 * time.Minute)},
+			},
+			expected: [][]string{{"a1", "a2"}, {"a3", "a4"}},
+		},
+		{
+			name: "merge commits and unknown authors",
+			changes: []RawChange{
+				commit(api, "a1", "", 0),
+				commit(api, "a2", "", time.Minute),
+				{Repository: api, SHA: "m1", Author: "mfojtik", Date: start.Add(2 * time.Minute), Merge: true},
+				commit(api, "a3", "mfojtik", 3*time.Minute),
+			},
+			expected: [][]string{{"a1"}, {"a2"}, {"m1"}, {"a3"}},
+		},
+	}
+	for _, test := range tests {
+		var changes []Change
+		for _, raw := range test.changes {
+			changes = append(changes, newChange(raw))
+		}
+		var sessions [][]string
+		for _, c := range collapseSessions(changes, defaultSessionGap) {
+			if c.raw.Session == nil {
+				sessions = append(sessions, []string{c.raw.SHA})
+				continue
+			}
+			var shas []string
+			for _, s := range c.raw.Session.Commits {
+				shas = append(shas, s.SHA)
+			}
+			if last := shas[len(shas)-1]; c.raw.SHA != last {
+				t.Errorf("%s: expected the session in place of its newest commit %s, got %s", test.name, last, c.raw.SHA)
+			}
+			sessions = append(sessions, shas)
+		}
+		if !reflect.DeepEqual(sessions, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, sessions)
+		}
+	}
+}
+
+func TestFormatSession(t *testing.T) {
+	start := time.Date(2021, 8, 20, 10, 0, 0, 0, time.UTC)
+	var changes []Change
+	for i, subject := range []string{"Add the field", "Validate the field", "Document the field"} {
+		changes = append(changes, newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: strings.Repeat(string(rune('a'+i)), 40), URL: "https://github.com/openshift/api/commit/" + subject, Author: "mfojtik", Message: subject + "\n\nBody", Date: start.Add(time.Duration(i) * 20 * time.Minute)}))
+	}
+	collapsed := collapseSessions(changes, defaultSessionGap)
+	if len(collapsed) != 1 {
+		t.Fatalf("expected a single session, got %d changes", len(collapsed))
+	}
+	if message := collapsed[0].Message; message != "3 commits by mfojtik over 40m:\nAdd the field\n...\nDocument the field" {
+		t.Errorf("unexpected message %q", message)
+	}
+
+	var out bytes.Buffer
+	if err := writeHTMLReport(&out, Report{Changes: collapsed}); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, expected := range []string{"<summary>3 commits</summary>", ">bbbbbbb</a> Validate the field</li>"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected %q in:\n%s", expected, page)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// sinceDateLayouts are the absolute -since forms, dates without a time start at midnight of the -timezone
+var sinceDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// sinceDatePattern matches values meant as dates, they fail instead of being looked up as payloads
+var sinceDatePattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}([T ]|$)`)
+
+// sinceValue is the parsed -since: either a duration, or the absolute start of the window given as a date or
+// resolved from a payload.
+type sinceValue struct {
+	Duration time.Duration
+	// Start is the absolute window start, zero for durations
+	Start time.Time
+	// Payload is the pullspec or tag the Start is the creation time of
+	Payload string
+}
+
+// parseSince reads -since as, in this order, a duration, a RFC3339 or YYYY-MM-DD date in the location or a payload
+// pullspec or tag whose creation time (see getPayloadCreated) starts the window. Values that are both a duration and
+// a tag name (eg. "4d") are durations.
+func parseSince(value string, location *time.Location, payloadCreated func(string) (time.Time, error)) (sinceValue, error) {
+	if d, err := str2duration.ParseDuration(value); err == nil {
+		return sinceValue{Duration: d}, nil
+	}
+	for _, layout := range sinceDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return sinceValue{Start: t}, nil
+		}
+	}
+	if sinceDatePattern.MatchString(value) {
+		return sinceValue{}, fmt.Errorf(":-( I am unable to parse -since date %q, use YYYY-MM-DD or RFC3339 (eg. '2024-03-03T10:00:00+01:00')", value)
+	}
+	created, err := payloadCreated(value)
+	if err != nil {
+		return sinceValue{}, fmt.Errorf(":-( I am unable to parse -since %q as a duration or a date, nor to find when such payload was created: %v", value, err)
+	}
+	return sinceValue{Start: created, Payload: value}, nil
+}
+
+// describe explains how the -since value was read, for the log of the window start.
+func (s sinceValue) describe(value string) string {
+	switch {
+	case s.Start.IsZero():
+		return fmt.Sprintf("-since %s read as a duration, use -previous-payload %s for a payload of that name", value, value)
+	case len(s.Payload) > 0:
+		return fmt.Sprintf("-since %s, when the payload was created", value)
+	default:
+		return fmt.Sprintf("-since %s", value)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	var lookedUp []string
+	payloadCreated := func(payload string) (time.Time, error) {
+		lookedUp = append(lookedUp, payload)
+		if payload == "4.16.0-rc.2" || payload == "4d" {
+			return created, nil
+		}
+		return time.Time{}, errors.New("payload not found")
+	}
+	tests := []struct {
+		value    string
+		expected sinceValue
+		err      string
+	}{
+		{value: "36h", expected: sinceValue{Duration: 36 * time.Hour}},
+		// a tag literally named like a duration is still a duration
+		{value: "4d", expected: sinceValue{Duration: 4 * 24 * time.Hour}},
+		{value: "2024-03-03", expected: sinceValue{Start: time.Date(2024, 3, 3, 0, 0, 0, 0, prague)}},
+		{value: "2024-03-03T10:00:00Z", expected: sinceValue{Start: time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC)}},
+		{value: "4.16.0-rc.2", expected: sinceValue{Start: created, Payload: "4.16.0-rc.2"}},
+		{value: "2024-02-30", err: `unable to parse -since date "2024-02-30", use YYYY-MM-DD or RFC3339`},
+		{value: "2024-03-03T25:00:00Z", err: `unable to parse -since date "2024-03-03T25:00:00Z"`},
+		{value: "4.99.0-rc.0", err: `unable to parse -since "4.99.0-rc.0" as a duration or a date, nor to find when such payload was created: payload not found`},
+	}
+	for _, test := range tests {
+		since, err := parseSince(test.value, prague, payloadCreated)
+		switch {
+		case len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.value, test.err, err)
+		case len(test.err) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.value, err)
+		case len(test.err) == 0 && (since.Duration != test.expected.Duration || !since.Start.Equal(test.expected.Start) || since.Payload != test.expected.Payload):
+			t.Errorf("%s: expected %+v, got %+v", test.value, test.expected, since)
+		}
+	}
+	// only the values that are neither durations nor dates are looked up as payloads
+	if strings.Join(lookedUp, ",") != "4.16.0-rc.2,4.99.0-rc.0" {
+		t.Errorf("unexpected payload lookups %v", lookedUp)
+	}
+
+	for value, expected := range map[string]string{
+		"4d":          "-since 4d read as a duration, use -previous-payload 4d for a payload of that name",
+		"2024-03-03":  "-since 2024-03-03",
+		"4.16.0-rc.2": "-since 4.16.0-rc.2, when the payload was created",
+	} {
+		since, err := parseSince(value, prague, payloadCreated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := since.describe(value); actual != expected {
+			t.Errorf("%s: expected %q, got %q", value, expected, actual)
+		}
+	}
+}
+
+func TestCollectSinceDate(t *testing.T) {
+	start := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	var out scenarioOutput
+	output := captureLog(t, func() {
+		var err error
+		if out, _, err = runScenario(t, "normal", "-since", start.Format(time.RFC3339)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if out.Metadata.Window == nil || !out.Metadata.Window.Since.Equal(start) {
+		t.Errorf("expected the window to start at %s, got %+v", start, out.Metadata.Window)
+	}
+	if !strings.Contains(output, "Listing changes since "+formatTime(start)+" (-since "+start.Format(time.RFC3339)+")") {
+		t.Errorf("expected the resolved start logged, got:\n%s", output)
+	}
+
+	// CI payloads record their creation time in their name
+	payload := "4.9.0-0.nightly-" + start.Format("2006-01-02-150405")
+	out, _, err := runScenario(t, "normal", "-since", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := out.Metadata.Window; w == nil || !w.Since.Equal(start) || w.PreviousPayload != payload {
+		t.Errorf("expected the window to start when %s was created, got %+v", payload, w)
+	}
+}
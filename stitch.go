@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// alternateDefaultBranch returns the other name of the default branch, repositories renaming master to main keep
+// the history before the rename on the old branch. ok is false for other branches.
+func alternateDefaultBranch(branch string) (string, bool) {
+	switch branch {
+	case "master":
+		return "main", true
+	case "main":
+		return "master", true
+	}
+	return "", false
+}
+
+// shallowHistory is whether the branch has commits in the window, but none in its first half, as a branch created by
+// a rename of the default branch during the window. Quiet repositories without commits are not checked.
+func shallowHistory(commits []*github.RepositoryCommit, options ProcessOptions) bool {
+	if len(commits) == 0 {
+		return false
+	}
+	since := windowStart(time.Now(), options.Since, options.ClockSkew, options.TrustServerTime)
+	half := since.Add(options.Since / 2)
+	for _, c := range commits {
+		if commitDate(c).Before(half) {
+			return false
+		}
+	}
+	return true
+}
+
+// stitchRenamedBranch adds the commits of the alternate default branch (see alternateDefaultBranch) in the window
+// when the listed history of the branch is shallow and the alternate branch has a commit in the window that is not
+// in the branch, ie. the default branch was renamed during the window (see -branch-stitching). Returns the
+// commits merged by SHA, newest first, and the stitched branch, empty when the history was not stitched.
+func stitchRenamedBranch(ctx context.Context, client *github.Client, organization, name string, options ProcessOptions, limit *commitLimit, commits []*github.RepositoryCommit) ([]*github.RepositoryCommit, string, error) {
+	alternate, ok := alternateDefaultBranch(options.BranchName)
+	if !ok || !options.BranchStitching || len(options.GitMirrorDir) > 0 || !shallowHistory(commits, options) {
+		return commits, "", nil
+	}
+	branch, _, err := client.Repositories.GetBranch(withCategory(ctx, categoryBranches), organization, name, alternate)
+	if isNotFound(err) {
+		return commits, "", nil
+	}
+	if err != nil {
+		logVerbose("[%s/%s] unable to check the %s branch, not stitching its history: %v", organization, name, alternate, err)
+		return commits, "", nil
+	}
+	since := windowStart(time.Now(), options.Since, options.ClockSkew, options.TrustServerTime)
+	if commitDate(branch.GetCommit()).Before(since) {
+		return commits, "", nil
+	}
+	listed := map[string]bool{}
+	for _, c := range commits {
+		listed[c.GetSHA()] = true
+	}
+	if listed[branch.GetCommit().GetSHA()] {
+		return commits, "", nil
+	}
+
+	older, err := listAllCommits(ctx, client, organization, name, github.CommitsListOptions{SHA: alternate, Since: since}, nil, limit)
+	if err != nil && !isTruncated(err) {
+		return commits, "", err
+	}
+	stitched := append([]*github.RepositoryCommit{}, commits...)
+	for _, c := range older {
+		if !listed[c.GetSHA()] {
+			listed[c.GetSHA()] = true
+			stitched = append(stitched, c)
+		}
+	}
+	sort.SliceStable(stitched, func(i, j int) bool { return commitDate(stitched[i]).After(commitDate(stitched[j])) })
+	log.Printf("[%s/%s] the %s history in the window is shallow, stitched %d commits of the %s branch (renamed default branch)", organization, name, options.BranchName, len(stitched)-len(commits), alternate)
+	return stitched, alternate, err
+}
+
+// repositoryStitches returns the branches stitched to the history of repositories, nil when none was stitched.
+func repositoryStitches(changes []Change) map[string]string {
+	var stitches map[string]string
+	for _, c := range changes {
+		if len(c.raw.StitchedBranch) == 0 {
+			continue
+		}
+		if stitches == nil {
+			stitches = map[string]string{}
+		}
+		stitches[c.raw.Repository] = c.raw.StitchedBranch
+	}
+	return stitches
+}
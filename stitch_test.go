@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCommit is a commit of the Github API merged at the time.
+func fakeCommit(sha string, merged time.Time) map[string]interface{} {
+	author := map[string]interface{}{"name": "The Octocat", "email": "octocat@nowhere.com", "date": merged.UTC().Format(time.RFC3339)}
+	return map[string]interface{}{
+		"sha":      sha,
+		"html_url": "https://github.com/openshift/oc/commit/" + sha,
+		"commit":   map[string]interface{}{"author": author, "committer": author, "message": "Change " + sha[:7]},
+		"author":   map[string]interface{}{"login": "octocat", "type": "User"},
+		"parents":  []map[string]interface{}{{"sha": fmt.Sprintf("%040x", 0)}},
+	}
+}
+
+func fakeBody(t *testing.T, value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// renamedBranchScenario is openshift/oc whose master branch was renamed to main 3 hours ago: main has a single
+// commit, the older ones of the window are on master.
+func renamedBranchScenario(t *testing.T) fakeScenario {
+	now := time.Now()
+	head := fakeCommit(fmt.Sprintf("%040x", 0xb0a0), now.Add(-time.Hour))
+	renamed := fakeCommit(fmt.Sprintf("%040x", 0xb0a1), now.Add(-3*time.Hour))
+	older := fakeCommit(fmt.Sprintf("%040x", 0xb0a2), now.Add(-20*time.Hour))
+	return fakeScenario{
+		Payload: []fakePayloadTag{{Tag: "cli", Repository: "openshift/oc", Commit: head["sha"].(string)}},
+		Routes: []fakeRoute{
+			{Method: http.MethodGet, Path: "/repos/openshift/oc", Fixture: "repos-openshift-oc.json"},
+			{Method: http.MethodGet, Path: "/repos/openshift/oc/branches/main", Body: fakeBody(t, map[string]interface{}{"name": "main", "commit": head})},
+			{Method: http.MethodGet, Path: "/repos/openshift/oc/branches/master", Body: fakeBody(t, map[string]interface{}{"name": "master", "commit": renamed})},
+			{Method: http.MethodGet, Path: "/repos/openshift/oc/commits", Query: map[string]string{"sha": "main", "page": "1"}, Body: fakeBody(t, []interface{}{head})},
+			{Method: http.MethodGet, Path: "/repos/openshift/oc/commits", Query: map[string]string{"sha": "master", "page": "1"}, Body: fakeBody(t, []interface{}{renamed, older})},
+		},
+	}
+}
+
+func TestCollectBranchStitching(t *testing.T) {
+	var (
+		out    scenarioOutput
+		github *fakeGithub
+	)
+	output := captureLog(t, func() {
+		var err error
+		if out, github, err = runFakeScenario(t, renamedBranchScenario(t), "-branch", "main", "-branch-stitching"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(output, "[openshift/oc] the main history in the window is shallow, stitched 2 commits of the master branch") {
+		t.Errorf("expected the stitching logged, got:\n%s", output)
+	}
+	if len(out.Changes) != 3 {
+		t.Fatalf("expected the commits of both branches, got %d changes", len(out.Changes))
+	}
+	for _, c := range out.Changes {
+		if c.StitchedBranch != "master" {
+			t.Errorf("expected %s to be stitched with master, got %q", c.SHA, c.StitchedBranch)
+		}
+	}
+	if out.Metadata.Window == nil || out.Metadata.Window.Stitched["https://github.com/openshift/oc"] != "master" {
+		t.Errorf("expected the stitched repository in the window, got %+v", out.Metadata.Window)
+	}
+	if n := github.countRequests("/repos/openshift/oc/branches/master"); n != 1 {
+		t.Errorf("expected the master branch to be checked once, got %d", n)
+	}
+}
+
+func TestCollectBranchStitchingIsOptIn(t *testing.T) {
+	out, github, err := runFakeScenario(t, renamedBranchScenario(t), "-branch", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Changes) != 1 || len(out.Changes[0].StitchedBranch) > 0 {
+		t.Errorf("expected only the commit of main, got %+v", out.Changes)
+	}
+	if n := github.countRequests("/repos/openshift/oc/branches/master"); n > 0 {
+		t.Errorf("the master branch was checked without -branch-stitching")
+	}
+}
+
+func TestCollectBranchStitchingNotWithFirstParent(t *testing.T) {
+	if _, _, err := runFakeScenario(t, renamedBranchScenario(t), "-branch", "main", "-branch-stitching", "-first-parent"); err == nil || !strings.Contains(err.Error(), "-first-parent is not available with") {
+		t.Errorf("expected -branch-stitching with -first-parent to fail, got %v", err)
+	}
+}
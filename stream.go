@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/github"
+	"github.com/xxjwxc/gowp/workpool"
+)
+
+// RepositoryResult is the result of processing a single repository.
+type RepositoryResult struct {
+	Repository string
+	Changes    []Change
+	// Err is set when the repository could not be processed
+	Err *RepositoryError
+	// Truncated results have only some of the commits, SkippedCommits is the estimated number of the others
+	Truncated      bool
+	SkippedCommits int
+}
+
+func newRepositoryResult(repository string, changes []Change, err *RepositoryError) RepositoryResult {
+	result := RepositoryResult{Repository: repository, Changes: changes, Err: err}
+	if err != nil && err.Kind == ErrorKindTruncated {
+		result.Truncated, result.SkippedCommits = true, skippedCommits(err.Err)
+	}
+	return result
+}
+
+// ChangeStream sends the result of each repository as soon as it is processed (or loaded from a resumed run).
+type ChangeStream struct {
+	results chan RepositoryResult
+	done    chan struct{}
+	err     error
+	stream  bool
+	// strings interns the repeated strings of the changes of all repositories
+	strings *interner
+}
+
+// Results is closed once all repositories are processed, each repository has exactly one result. When the context
+// is canceled, repositories not processed yet have no result and the channel is closed once the running ones
+// complete.
+func (s *ChangeStream) Results() <-chan RepositoryResult {
+	return s.results
+}
+
+// Wait waits until the results are closed and returns the error that stopped the processing (eg. the canceled
+// context), errors of single repositories are in their results.
+func (s *ChangeStream) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Err returns the error that stopped the processing once the results are closed, nil while they are not.
+func (s *ChangeStream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// collect drains the results into the changes, sorted by time unless the stream was started with
+// ProcessOptions.Stream, and the errors of the repositories. onResult, when set, is called with each result as it
+// is received.
+func (s *ChangeStream) collect(onResult func(RepositoryResult)) ([]Change, []RepositoryError, error) {
+	var changes []Change
+	var errs []RepositoryError
+	for result := range s.Results() {
+		if onResult != nil {
+			onResult(result)
+		}
+		changes = append(changes, result.Changes...)
+		if result.Err != nil {
+			errs = append(errs, *result.Err)
+		}
+	}
+	if err := s.Wait(); err != nil {
+		return nil, nil, err
+	}
+	if !s.stream {
+		sortChanges(changes)
+	}
+	return changes, errs, nil
+}
+
+// CollectChangesStream processes the repositories in the background, the same way as the collect command, and
+// sends the result of each repository as soon as it is processed. The results are buffered, so a slow consumer
+// does not hold up the processing. It fails right away when a repository is not a Github repository URL.
+func CollectChangesStream(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) (*ChangeStream, error) {
+	for _, repository := range repositories {
+		if _, _, ok := parseRepositoryOrgName(repository); !ok {
+			return nil, fmt.Errorf("unable to parse repository organization or name: %q", repository)
+		}
+	}
+	s := &ChangeStream{
+		results: make(chan RepositoryResult, len(repositories)),
+		done:    make(chan struct{}),
+		stream:  options.Stream,
+		strings: newInterner(),
+	}
+	go func() {
+		defer close(s.done)
+		defer close(s.results)
+		s.err = s.process(ctx, client, options, repositories)
+	}()
+	return s, nil
+}
+
+func (s *ChangeStream) process(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) error {
+	wp := workpool.New(options.Concurrency)
+	var tasks []workpool.TaskHandler
+	var taskRepositories []string
+
+	state := newRunState(client, options)
+	processCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	breaker := &authBreaker{limit: options.AuthFailureLimit}
+	canceled := func(repository string) RepositoryResult {
+		return RepositoryResult{Repository: repository, Err: &RepositoryError{Repository: repository, Kind: ErrorKindCanceled, Err: ErrCanceled}}
+	}
+
+	resumed := 0
+	for i := range repositories {
+		repository := repositories[i]
+		if change, repositoryErr, ok := options.Resume.Get(repository); ok {
+			resumed++
+			s.strings.internChanges(change)
+			s.results <- newRepositoryResult(repository, change, repositoryErr)
+			continue
+		}
+		taskRepositories = append(taskRepositories, repository)
+		tasks = append(tasks, func() error {
+			organization, name, _ := parseRepositoryOrgName(repository)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case breaker.Tripped():
+				s.results <- canceled(repository)
+				return nil
+			}
+			repositoryCtx, span := startSpan(processCtx, spanRepository, map[string]interface{}{"repository": repository})
+			change, err := processRepositorySafely(repositoryCtx, client, options, state, repository, organization, name)
+			span.End()
+			if breaker.Record(err) {
+				log.Printf("More than %d repositories in a row failed to authenticate, canceling the remaining ones", options.AuthFailureLimit)
+				cancel()
+			}
+
+			// repositories interrupted by the breaker or the context are not recorded for resume, so they are
+			// processed again
+			if errors.Is(err, context.Canceled) {
+				switch {
+				case ctx.Err() != nil:
+					return nil
+				case breaker.Tripped():
+					s.results <- canceled(repository)
+					return nil
+				}
+			}
+			var repositoryErr *RepositoryError
+			if err != nil {
+				log.Printf("[%s] %v", repository, err)
+				repositoryErr = &RepositoryError{
+					Repository: repository,
+					Kind:       classifyRepositoryError(organization, err),
+					Err:        err,
+				}
+			}
+			if err := options.Resume.Record(repository, change, repositoryErr); err != nil {
+				log.Printf("[%s] unable to record the result for resume: %v", repository, err)
+			}
+			s.strings.internChanges(change)
+			s.results <- newRepositoryResult(repository, change, repositoryErr)
+			return nil
+		})
+	}
+	if resumed > 0 {
+		log.Printf("resuming: %d/%d repos loaded from previous run", resumed, len(repositories))
+	}
+
+	// schedule all tasks, the work pool will take care of queuing
+	scheduled := 0
+	for ; scheduled < len(tasks) && !breaker.Tripped() && ctx.Err() == nil; scheduled++ {
+		wp.Do(tasks[scheduled])
+	}
+	if err := wp.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, repository := range taskRepositories[scheduled:] {
+		s.results <- canceled(repository)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeStreamGithub serves a commit of every openshift repository, listing the commits of openshift/slow waits until
+// release is closed (or the request is canceled). It returns the maximum number of listings in progress at once.
+func fakeStreamGithub(t *testing.T, release <-chan struct{}) (*github.Client, func() int) {
+	var lock sync.Mutex
+	inProgress, maxInProgress := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/repos/"), "/")
+		switch {
+		case len(parts) == 2:
+			fmt.Fprintf(w, `{"name": %q, "fork": false}`, parts[1])
+		case len(parts) == 3 && parts[2] == "commits":
+			lock.Lock()
+			inProgress++
+			if inProgress > maxInProgress {
+				maxInProgress = inProgress
+			}
+			lock.Unlock()
+			defer func() {
+				lock.Lock()
+				inProgress--
+				lock.Unlock()
+			}()
+			if parts[1] == "slow" {
+				select {
+				case <-release:
+				case <-req.Context().Done():
+					return
+				}
+			} else {
+				time.Sleep(20 * time.Millisecond)
+			}
+			fmt.Fprintf(w, `[{"sha": "%[1]s1", "commit": {"message": "Change of %[1]s", "committer": {"date": %[2]q}}}]`, parts[1], time.Now().Add(-time.Hour).Format(time.RFC3339))
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return maxInProgress
+	}
+}
+
+// collectEntryPoints process the repositories through the batch and the streaming API, which must behave the same.
+var collectEntryPoints = map[string]func(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) ([]Change, []RepositoryError, error){
+	"processRepositories": processRepositories,
+	"CollectChangesStream": func(ctx context.Context, client *github.Client, options ProcessOptions, repositories []string) ([]Change, []RepositoryError, error) {
+		stream, err := CollectChangesStream(ctx, client, options, repositories)
+		if err != nil {
+			return nil, nil, err
+		}
+		var changes []Change
+		var errs []RepositoryError
+		for result := range stream.Results() {
+			changes = append(changes, result.Changes...)
+			if result.Err != nil {
+				errs = append(errs, *result.Err)
+			}
+		}
+		if err := stream.Wait(); err != nil {
+			return nil, nil, err
+		}
+		sortChanges(changes)
+		return changes, errs, stream.Err()
+	},
+}
+
+func TestCollectEntryPoints(t *testing.T) {
+	var repositories []string
+	for i := 0; i < 6; i++ {
+		repositories = append(repositories, fmt.Sprintf("https://github.com/openshift/repository-%d", i))
+	}
+	messages := func(changes []Change) []string {
+		var messages []string
+		for _, c := range changes {
+			messages = append(messages, c.raw.Message)
+		}
+		// the changes have the same time, their order is not stable
+		sort.Strings(messages)
+		return messages
+	}
+	results := map[string][]string{}
+
+	for name, process := range collectEntryPoints {
+		client, maxInProgress := fakeStreamGithub(t, nil)
+		var changes []Change
+		var errs []RepositoryError
+		var err error
+		captureLog(t, func() {
+			changes, errs, err = process(context.Background(), client, ProcessOptions{Concurrency: 2, Since: 24 * time.Hour, BranchName: "master"}, repositories)
+		})
+		if err != nil || len(errs) != 0 || len(changes) != len(repositories) {
+			t.Errorf("%s: expected a change of each repository, got %v %v: %v", name, messages(changes), errs, err)
+		}
+		if n := maxInProgress(); n != 2 {
+			t.Errorf("%s: expected 2 repositories processed at once, got %d", name, n)
+		}
+		results[name] = messages(changes)
+
+		// the breaker cancels the same repositories
+		captureLog(t, func() {
+			options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", AuthFailureLimit: 2}
+			changes, errs, err = process(context.Background(), fakeRevokedGithub(t, http.StatusUnauthorized, nil, "Bad credentials"), options, append([]string{"https://github.com/openshift/api"}, repositories...))
+		})
+		kinds := map[string]int{}
+		for _, e := range errs {
+			kinds[e.Kind]++
+		}
+		if err != nil || len(changes) != 1 || !reflect.DeepEqual(kinds, map[string]int{ErrorKindUnauthorized: 3, ErrorKindCanceled: 3}) {
+			t.Errorf("%s: expected 3 unauthorized and 3 canceled repositories, got %d changes, %v: %v", name, len(changes), kinds, err)
+		}
+
+		// resumed repositories are not listed again
+		jobsClient, listings := fakeJobsGithub(t)
+		options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", Cache: NewCache()}
+		if options.Resume, err = loadResumeState(filepath.Join(t.TempDir(), "cache.json"), resumeKey(options, "1d"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := options.Resume.Record("https://github.com/openshift/origin", []Change{newChange(RawChange{Repository: "https://github.com/openshift/origin", SHA: "b", Message: "Fix the test"})}, nil); err != nil {
+			t.Fatal(err)
+		}
+		captureLog(t, func() {
+			changes, _, err = process(context.Background(), jobsClient, options, []string{"https://github.com/openshift/api", "https://github.com/openshift/origin"})
+		})
+		if err != nil || len(changes) != 2 || listings() != 1 {
+			t.Errorf("%s: expected the resumed and the listed change with a single listing, got %d changes and %d listings: %v", name, len(changes), listings(), err)
+		}
+
+		if _, _, err := process(context.Background(), client, ProcessOptions{Concurrency: 1}, []string{"openshift/api"}); err == nil || !strings.Contains(err.Error(), `unable to parse repository organization or name: "openshift/api"`) {
+			t.Errorf("%s: expected an invalid repository to fail, got %v", name, err)
+		}
+	}
+	if !reflect.DeepEqual(results["processRepositories"], results["CollectChangesStream"]) {
+		t.Errorf("expected the same changes, got %v and %v", results["processRepositories"], results["CollectChangesStream"])
+	}
+}
+
+func TestCollectChangesStream(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := fakeStreamGithub(t, release)
+	options := ProcessOptions{Concurrency: 2, Since: 24 * time.Hour, BranchName: "master"}
+	stream, err := CollectChangesStream(context.Background(), client, options, []string{"https://github.com/openshift/slow", "https://github.com/openshift/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the result of openshift/api is sent while openshift/slow is still processed
+	select {
+	case result := <-stream.Results():
+		if result.Repository != "https://github.com/openshift/api" || len(result.Changes) != 1 || result.Err != nil {
+			t.Errorf("unexpected result %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the result of openshift/api before openshift/slow completes")
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("expected no error while the repositories are processed, got %v", err)
+	}
+	close(release)
+	result, ok := <-stream.Results()
+	if !ok || result.Repository != "https://github.com/openshift/slow" || len(result.Changes) != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if _, ok := <-stream.Results(); ok {
+		t.Errorf("expected the results to be closed")
+	}
+	if err := stream.Wait(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCollectChangesStreamCanceled(t *testing.T) {
+	client, _ := fakeStreamGithub(t, make(chan struct{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	options := ProcessOptions{Concurrency: 1, Since: 24 * time.Hour, BranchName: "master", AuthFailureLimit: defaultAuthFailureLimit}
+	stream, err := CollectChangesStream(ctx, client, options, []string{"https://github.com/openshift/slow", "https://github.com/openshift/api", "https://github.com/openshift/oc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []RepositoryResult
+	captureLog(t, func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		// the interrupted and the remaining repositories have no result
+		for result := range stream.Results() {
+			results = append(results, result)
+		}
+	})
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+	if err := stream.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled context, got %v", err)
+	}
+	if err := stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled context, got %v", err)
+	}
+}
+
+func TestServePartialChanges(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := fakeStreamGithub(t, release)
+	o := &serveOptions{queryOptions: queryOptions{since: "1d", branch: "master", noBranchCheck: true}}
+	if err := o.validate(); err != nil {
+		t.Fatal(err)
+	}
+	c := &collection{}
+	o.publishProgress(c)
+	serve := func() string {
+		recorder := httptest.NewRecorder()
+		c.serveChanges(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("expected the changes to be served, got %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+	if body := serve(); !strings.Contains(body, "Collecting, 0/0 repositories processed") {
+		t.Errorf("expected the collection in progress, got:\n%s", body)
+	}
+
+	done := make(chan *queryResult)
+	shared := &sharedOptions{concurrency: 2, skipTokenCheck: true}
+	go captureLog(t, func() {
+		result, err := o.collect(context.Background(), client, shared, []string{"https://github.com/openshift/slow", "https://github.com/openshift/api"}, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		c.lock.RLock()
+		processed := c.processed
+		c.lock.RUnlock()
+		if processed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected openshift/api to be processed")
+		}
+	}
+	if body := serve(); !strings.Contains(body, "Collecting, 1/2 repositories processed") || !strings.Contains(body, "Change of api") || strings.Contains(body, "Change of slow") {
+		t.Errorf("expected the changes of openshift/api, got:\n%s", body)
+	}
+
+	close(release)
+	result := <-done
+	c.set(o.apply(result.Changes), result.Errors, 0)
+	if body := serve(); !strings.Contains(body, "Collected ") || !strings.Contains(body, "Change of slow") || strings.Contains(body, "Collecting") {
+		t.Errorf("expected the collected changes, got:\n%s", body)
+	}
+}
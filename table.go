@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/kataras/tablewriter"
+	"github.com/mattn/go-runewidth"
+)
+
+// tableRowCharLimit is the length of cells tableprinter wraps between words (its RowCharLimit)
+const tableRowCharLimit = 60
+
+// tableStream writes a table row by row in the layout of tableprinter: columns padded by a space on both sides and
+// separated by a space, upper case headers over a dashed line. The widths of all rows are measured first, so the
+// rows are never held at once.
+type tableStream struct {
+	w       *bufio.Writer
+	headers []string
+	widths  []int
+	// wrapped is the column whose cells are wrapped by the caller (see wrapMessage) instead of like tableprinter
+	// does, -1 when there is none
+	wrapped int
+}
+
+// newTableStream returns the table of the headers with the number of rows, tableprinter shows the number in the
+// first header of tables of more than 3 rows.
+func newTableStream(w *bufio.Writer, headers []string, rows int) *tableStream {
+	headers = append([]string{}, headers...)
+	if rows > 3 {
+		headers[0] = fmt.Sprintf("%s (%d) ", headers[0], rows)
+	}
+	t := &tableStream{w: w, headers: headers, widths: make([]int, len(headers)), wrapped: -1}
+	t.measure(headers)
+	return t
+}
+
+// measure widens the columns to the cells of the row.
+func (t *tableStream) measure(row []string) {
+	for i, cell := range row {
+		t.measureCell(i, cell)
+	}
+}
+
+// measureCell widens the column to the cell.
+func (t *tableStream) measureCell(column int, cell string) {
+	if width := textWidth(t.cell(column, cell)); width > t.widths[column] {
+		t.widths[column] = width
+	}
+}
+
+// writeHeader writes the headers and the dashed line under them.
+func (t *tableStream) writeHeader() {
+	t.w.WriteString(" ")
+	for i, header := range t.headers {
+		fmt.Fprintf(t.w, " %s  ", tablewriter.PadRight(tablewriter.Title(header), " ", t.widths[i]))
+	}
+	t.w.WriteString("\n ")
+	for _, width := range t.widths {
+		t.w.WriteString(strings.Repeat("-", width+2) + " ")
+	}
+	t.w.WriteString("\n")
+}
+
+// writeRow writes the row, its cells of several lines make it as high as the highest one.
+func (t *tableStream) writeRow(row []string) {
+	lines := make([][]string, len(row))
+	height := 0
+	for i, cell := range row {
+		lines[i] = strings.Split(t.cell(i, cell), "\n")
+		if len(lines[i]) > height {
+			height = len(lines[i])
+		}
+	}
+	for line := 0; line < height; line++ {
+		for i := range row {
+			cell := "  "
+			if line < len(lines[i]) {
+				cell = lines[i][line]
+			}
+			t.w.WriteString("  ")
+			t.w.WriteString(cell)
+			if padding := t.widths[i] - runewidth.StringWidth(cell); padding > 0 {
+				t.w.WriteString(strings.Repeat(" ", padding))
+			}
+			t.w.WriteString(" ")
+		}
+		t.w.WriteString(" \n")
+	}
+}
+
+// cell returns the cell of the column as it is rendered.
+func (t *tableStream) cell(column int, cell string) string {
+	if column == t.wrapped {
+		return cell
+	}
+	return tableCell(cell)
+}
+
+// flush writes the buffered rows.
+func (t *tableStream) flush() error {
+	return t.w.Flush()
+}
+
+// textWidth returns the number of terminal cells of the widest line of the text, wide characters (eg. CJK) take 2.
+func textWidth(text string) int {
+	width := 0
+	for _, line := range strings.Split(text, "\n") {
+		if w := runewidth.StringWidth(line); w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// tableCell wraps cells longer than tableRowCharLimit between words like tableprinter does, cells of several lines
+// are kept (without a trailing line break).
+func tableCell(cell string) string {
+	if len(cell) <= tableRowCharLimit {
+		return cell
+	}
+	if strings.Contains(cell, "\n") {
+		if strings.HasSuffix(cell, "\n") {
+			// tableprinter drops the character before the trailing line break too
+			cell = cell[0 : len(cell)-2]
+			if len(cell) > tableRowCharLimit {
+				return tableCell(cell)
+			}
+		}
+		return cell
+	}
+	words := strings.Fields(strings.TrimSpace(cell))
+	if len(words) == 0 {
+		return cell
+	}
+	cell = words[0]
+	remaining := tableRowCharLimit - len(cell)
+	for _, word := range words[1:] {
+		if c := len(word) + 1; c <= remaining {
+			cell += " " + word
+			remaining -= c + 1
+			continue
+		}
+		cell += "\n" + word
+		remaining = tableRowCharLimit - len(word)
+	}
+	return cell
+}
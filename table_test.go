@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lensesio/tableprinter"
+)
+
+func TestTableStreamMatchesTableprinter(t *testing.T) {
+	tables := []struct {
+		name    string
+		headers []string
+		rows    [][]string
+	}{
+		{
+			name:    "single row",
+			headers: []string{"Repository", "Commit", "Message"},
+			rows:    [][]string{{"openshift/api", "553c207", "Bump the API"}},
+		},
+		{
+			name:    "counted rows of several lines",
+			headers: []string{"Repository", "Commit", "Pull Request", "Message", "Approved-by"},
+			rows: [][]string{
+				{"openshift/api", "553c207", "", "Bump the API\n\n* a list item\n  continued", "deads2k"},
+				{"openshift/oc", "7629413", "#42", "Fix the build", ""},
+				{"openshift/installer", "7fd1a60", "#1024", "Revert \"Add the thing\"\n\nThis reverts commit 7629413.", ""},
+				{"openshift/router", "0000001", "", "修复路由器的问题", ""},
+				{"openshift/router", "0000002", "", "", ""},
+			},
+		},
+		{
+			name:    "cells over the character limit",
+			headers: []string{"Repository", "URL", "Message"},
+			rows: [][]string{
+				{"openshift/cluster-kube-apiserver-operator", "https://github.com/openshift/cluster-kube-apiserver-operator/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "a message of more than sixty characters, wrapped between its words by tableprinter"},
+				{"openshift/api", "https://github.com/openshift/api/commit/553c207\n(history stitched with master)", "a message of several lines\nwith a trailing line break of more than sixty characters in all\n"},
+			},
+		},
+	}
+	for _, table := range tables {
+		var expected bytes.Buffer
+		rows := make([][]string, len(table.rows))
+		for i, row := range table.rows {
+			rows[i] = append([]string{}, row...)
+		}
+		tableprinter.New(&expected).Render(append([]string{}, table.headers...), rows, nil, true)
+
+		var actual bytes.Buffer
+		stream := newTableStream(bufio.NewWriter(&actual), table.headers, len(table.rows))
+		for _, row := range table.rows {
+			stream.measure(row)
+		}
+		stream.writeHeader()
+		for _, row := range table.rows {
+			stream.writeRow(row)
+		}
+		stream.flush()
+		if actual.String() != expected.String() {
+			t.Errorf("%s: expected\n%s\ngot\n%s", table.name, strings.ReplaceAll(expected.String(), " ", "."), strings.ReplaceAll(actual.String(), " ", "."))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const formatTemplate = "template"
+
+// exampleTemplates can be selected by -template, as a starting point for custom -template-file.
+var exampleTemplates = map[string]string{
+	"slack": `*{{ len .Changes }} changes merged{{ with .Payload }} for {{ . }}{{ end }}{{ with .Branch }} to {{ . }}{{ end }}*
+{{ if .Digest }}
+{{ range .Digest }}{{ .Rank }}. <{{ .URL }}|{{ shortSHA .SHA }}> *{{ .Repository }}* {{ .Subject }} _({{ .Reason }})_
+{{ end }}
+_The most notable of the {{ len .Changes }} changes, see the full report for all of them._
+{{ else }}{{ range .Repositories }}{{ if .Changes }}
+*{{ .Repository }}*
+{{ range .Changes }}• <{{ .URL }}|{{ shortSHA .SHA }}> {{ subject .Message }}{{ with .Author }} ({{ . }}){{ end }}
+{{ end }}{{ end }}{{ end }}{{ end }}{{ with .Errors }}
+:warning: {{ len . }} repositories could not be processed
+{{ end }}{{ range .Metadata.VolumeAlerts }}
+:rotating_light: *{{ .Repository }}* merged {{ .Commits }} changes (threshold {{ .Threshold }}){{ with .Authors }}, most by {{ . }}{{ end }}
+{{ end }}`,
+
+	"changelog": `# Changelog
+{{ range groupBy "repository" .Changes }}
+## {{ .Name }}
+{{ range .Changes }}
+* {{ markdown (subject .Message) }} ([{{ shortSHA .SHA }}]({{ .URL }}){{ with .PullRequest }}, #{{ . }}{{ end }})
+{{- end }}
+{{ end }}`,
+}
+
+// TemplateData is passed to -template-file templates.
+type TemplateData struct {
+	Metadata jsonMetadata
+	// Payload and Branch describe the query
+	Payload string
+	Branch  string
+	// Changes are all listed changes, Repositories has the same changes by repository
+	Changes      []RawChange
+	Repositories []TemplateRepository
+	Errors       []RawError
+	Rebuilt      []Rebuild
+	Regressions  []VersionRegression
+	// Digest are the most notable changes with -digest
+	Digest []DigestEntry
+}
+
+// TemplateRepository is a repository with its changes or the error processing it.
+type TemplateRepository struct {
+	Repository string
+	Changes    []RawChange
+	Error      *RawError
+}
+
+// TemplateGroup is a group of changes returned by the groupBy template function.
+type TemplateGroup struct {
+	Name    string
+	Changes []RawChange
+}
+
+// groupChanges groups changes by repository, owner, tier, author or merge commit (see -merge-commits collapse),
+// changes with more owners are in more groups.
+func groupChanges(field string, changes []RawChange) ([]TemplateGroup, error) {
+	groups := map[string][]RawChange{}
+	for _, c := range changes {
+		var names []string
+		switch field {
+		case "repository":
+			names = []string{c.Repository}
+		case "owner":
+			names = c.Owners
+		case "tier":
+			names = []string{c.Tier}
+		case "author":
+			names = []string{c.Author}
+		case "merge":
+			names = []string{c.MergedInto}
+			if c.Merge {
+				names = []string{c.SHA}
+			}
+		default:
+			return nil, fmt.Errorf("unknown group %q, expected 'repository', 'owner', 'tier', 'author' or 'merge'", field)
+		}
+		if len(names) == 0 || len(names[0]) == 0 {
+			names = []string{"unknown"}
+		}
+		for _, name := range names {
+			groups[name] = append(groups[name], c)
+		}
+	}
+	var result []TemplateGroup
+	for name, changes := range groups {
+		result = append(result, TemplateGroup{Name: name, Changes: changes})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`)
+
+var templateFuncs = template.FuncMap{
+	// humanize is replaced by the formatter of the report when it is rendered
+	"humanize": func(t time.Time) string { return formatterOrNow(nil).Ago(t) },
+	"time":     formatTime,
+	"shortSHA": shortSHA,
+	"subject":  commitSubject,
+	"markdown": markdownEscaper.Replace,
+	"groupBy":  groupChanges,
+	"join":     strings.Join,
+}
+
+// parseTemplate parses either the -template-file or the named example template.
+func parseTemplate(file, name string) (*template.Template, error) {
+	switch {
+	case len(file) > 0 && len(name) > 0:
+		return nil, fmt.Errorf("-template-file and -template are mutually exclusive")
+	case len(file) > 0:
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return template.New(file).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	case len(name) > 0:
+		content, ok := exampleTemplates[name]
+		if !ok {
+			var names []string
+			for n := range exampleTemplates {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown template %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(content)
+	default:
+		return nil, fmt.Errorf("-format %s requires either -template-file or -template", formatTemplate)
+	}
+}
+
+func newTemplateData(report Report) TemplateData {
+	data := TemplateData{
+		Metadata:    jsonMetadata{Created: time.Now(), Payload: report.Payload, Window: report.Window, Release: report.Release, APIRequests: report.APIRequests, APIDeprecations: report.APIDeprecations, VolumeAlerts: report.VolumeAlerts, SkippedTags: report.SkippedTags},
+		Payload:     report.Payload,
+		Branch:      report.Branch,
+		Changes:     []RawChange{},
+		Rebuilt:     report.Rebuilt,
+		Regressions: report.Regressions,
+		Digest:      report.Digest,
+	}
+	repositories := map[string]*TemplateRepository{}
+	repository := func(name string) *TemplateRepository {
+		if r, ok := repositories[name]; ok {
+			return r
+		}
+		repositories[name] = &TemplateRepository{Repository: name}
+		return repositories[name]
+	}
+	for _, c := range report.Changes {
+		data.Changes = append(data.Changes, c.raw)
+		r := repository(c.raw.Repository)
+		r.Changes = append(r.Changes, c.raw)
+	}
+	for _, e := range report.Errors {
+		raw := RawError{Repository: e.Repository, Kind: e.Kind, Message: e.Err.Error()}
+		data.Errors = append(data.Errors, raw)
+		if e.Kind == ErrorKindTruncated {
+			data.Metadata.Truncated = append(data.Metadata.Truncated, e.Repository)
+			data.Metadata.SkippedCommits += skippedCommits(e.Err)
+		}
+		repository(e.Repository).Error = &raw
+	}
+	for _, name := range report.Unchanged {
+		repository(name)
+	}
+	for _, r := range repositories {
+		data.Repositories = append(data.Repositories, *r)
+	}
+	sort.Slice(data.Repositories, func(i, j int) bool { return data.Repositories[i].Repository < data.Repositories[j].Repository })
+	return data
+}
+
+func writeTemplateReport(w io.Writer, report Report) error {
+	if report.Template == nil {
+		return fmt.Errorf("-format %s requires either -template-file or -template", formatTemplate)
+	}
+	// templates are shared by the jobs, each renders the relative times of its own collection
+	tmpl, err := report.Template.Clone()
+	if err != nil {
+		return err
+	}
+	tmpl.Funcs(template.FuncMap{"humanize": formatterOrNow(report.Durations).Ago})
+	if err := tmpl.Execute(w, newTemplateData(report)); err != nil {
+		// the error names the template position and the field that failed (eg. "at <.Foo>: can't evaluate field Foo")
+		return fmt.Errorf("unable to render the template: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func templateTestReport() Report {
+	return Report{
+		Changes: []Change{
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", URL: "https://github.com/openshift/api/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Validate *pods* [names]\n\nDetails", Author: "alice", PullRequest: 1012, Owners: []string{"apps"}}),
+			newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "d6cd1e2bd19e03a81132a23b2025920577f84e37", URL: "https://github.com/openshift/api/commit/d6cd1e2bd19e03a81132a23b2025920577f84e37", Message: "Bump the API", Owners: []string{"apps", "node"}}),
+			newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "276e9d4d8e1c3f1b4c6d3d6f0b9a7e1c2d3f4a5b", URL: "https://github.com/openshift/oc/commit/276e9d4d8e1c3f1b4c6d3d6f0b9a7e1c2d3f4a5b", Message: "Fix oc adm release info", Author: "bob", PullRequest: 880}),
+		},
+		Errors:       []RepositoryError{{Repository: "https://github.com/openshift/console", Kind: "not-found", Err: errors.New("404 Not Found")}},
+		Unchanged:    []string{"https://github.com/openshift/installer"},
+		Payload:      defaultPayload,
+		Branch:       "master",
+		Window:       &Window{Since: time.Date(2021, 8, 17, 8, 45, 12, 0, time.UTC)},
+		VolumeAlerts: []VolumeAlert{{Repository: "openshift/api", Commits: 24, Threshold: 20, Authors: "alice (20), bob (4)"}},
+	}
+}
+
+func TestExampleTemplates(t *testing.T) {
+	for name := range exampleTemplates {
+		tmpl, err := parseTemplate("", name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		report := templateTestReport()
+		report.Template = tmpl
+		var out bytes.Buffer
+		if err := writeReport(&out, formatTemplate, report); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		golden, err := ioutil.ReadFile(filepath.Join("testdata", "templates", name+".golden"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(golden) {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", name, golden, out.String())
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.tmpl")
+	if err := ioutil.WriteFile(broken, []byte("{{ range .Changes }}\n{{ .SHA }\n{{ end }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file, template, expected string
+	}{
+		{name: "parse error", file: broken, expected: broken + ":2: unexpected"},
+		{name: "unknown example", template: "email", expected: `unknown template "email", expected one of changelog, slack`},
+		{name: "both", file: broken, template: "slack", expected: "-template-file and -template are mutually exclusive"},
+		{name: "none", expected: "-format template requires either -template-file or -template"},
+		{name: "missing file", file: filepath.Join(dir, "missing.tmpl"), expected: "no such file or directory"},
+	}
+	for _, test := range tests {
+		_, err := parseTemplate(test.file, test.template)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestTemplateExecutionError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "report.tmpl")
+	if err := ioutil.WriteFile(file, []byte("{{ range .Changes }}{{ .Title }}{{ end }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := parseTemplate(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := templateTestReport()
+	report.Template = tmpl
+	err = writeReport(ioutil.Discard, formatTemplate, report)
+	if err == nil || !strings.Contains(err.Error(), "can't evaluate field Title") {
+		t.Errorf("expected the error to name the field, got %v", err)
+	}
+}
+
+func TestGroupChanges(t *testing.T) {
+	var changes []RawChange
+	for _, c := range templateTestReport().Changes {
+		changes = append(changes, c.raw)
+	}
+	groups, err := groupChanges("owner", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{}
+	for _, g := range groups {
+		sizes[g.Name] = len(g.Changes)
+	}
+	// a change with more owners is in each of their groups
+	if expected := map[string]int{"apps": 2, "node": 1, "unknown": 1}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected groups %v, got %v", expected, sizes)
+	}
+	if _, err := groupChanges("team", changes); err == nil {
+		t.Errorf("expected an unknown group to fail")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os"
+
+// terminalWidth returns 0, the width of terminals is only detected on Linux and macOS.
+func terminalWidth(f *os.File) int {
+	return 0
+}
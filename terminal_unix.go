@@ -0,0 +1,21 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the number of columns of the terminal, 0 when f is not a terminal.
+func terminalWidth(f *os.File) int {
+	var size struct {
+		rows, columns, x, y uint16
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0
+	}
+	return int(size.columns)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttle is a token bucket allowing bursts of up to burst requests, refilled so no more
+// than the given number of requests are issued per period on average.
+type throttle struct {
+	lock     sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+	waited   time.Duration
+}
+
+func newThrottle(requests int, period time.Duration, burst int) *throttle {
+	return &throttle{interval: period / time.Duration(requests), burst: float64(burst), tokens: float64(burst)}
+}
+
+// Wait blocks until the next request is allowed or the context is cancelled.
+func (t *throttle) Wait(ctx context.Context) error {
+	t.lock.Lock()
+	now := time.Now()
+	if !t.last.IsZero() {
+		t.tokens += float64(now.Sub(t.last)) / float64(t.interval)
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+	}
+	t.last = now
+	// the token is reserved right away, so concurrent callers queue up behind each other
+	t.tokens--
+	var wait time.Duration
+	if t.tokens < 0 {
+		wait = time.Duration(-t.tokens * float64(t.interval))
+	}
+	t.lock.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		addSpanWait(ctx, wait)
+		t.lock.Lock()
+		t.waited += wait
+		t.lock.Unlock()
+		return nil
+	case <-ctx.Done():
+		// give the reserved token back, so the callers queued behind don't wait for a request that never happens
+		t.lock.Lock()
+		t.tokens++
+		t.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Waited returns the total time callers spent waiting.
+func (t *throttle) Waited() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.waited
+}
+
+// searchRequestsPerMinute is the search API limit, which is much stricter than the limit of other APIs.
+const searchRequestsPerMinute = 30
+
+// throttlingTransport throttles all requests to stay under the Github abuse limits, search requests
+// are throttled by a separate, lower limit as well.
+type throttlingTransport struct {
+	base     http.RoundTripper
+	requests *throttle
+	search   *throttle
+}
+
+func newThrottlingTransport(base http.RoundTripper, requestsPerSecond int) *throttlingTransport {
+	t := &throttlingTransport{base: base, search: newThrottle(searchRequestsPerMinute, time.Minute, 1)}
+	if requestsPerSecond > 0 {
+		t.requests = newThrottle(requestsPerSecond, time.Second, requestsPerSecond*3/2)
+	}
+	return t
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.requests != nil {
+		if err := t.requests.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasPrefix(req.URL.Path, "/search/") || categoryFromContext(ctx) == categorySearch {
+		if err := t.search.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Waited returns the total time requests spent waiting for the throttles.
+func (t *throttlingTransport) Waited() time.Duration {
+	waited := t.search.Waited()
+	if t.requests != nil {
+		waited += t.requests.Waited()
+	}
+	return waited
+}
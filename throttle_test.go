@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// timingTransport records the time of each request sent by the fakeTransport.
+type timingTransport struct {
+	fakeTransport
+	sent []time.Time
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.Lock()
+	t.sent = append(t.sent, time.Now())
+	t.lock.Unlock()
+	return t.fakeTransport.RoundTrip(req)
+}
+
+func TestThrottleRateUnderConcurrency(t *testing.T) {
+	const (
+		rate     = 200
+		requests = 500
+		workers  = 50
+	)
+	base := &timingTransport{}
+	transport := newThrottlingTransport(base, rate)
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	queue := make(chan struct{}, requests)
+	for i := 0; i < requests; i++ {
+		queue <- struct{}{}
+	}
+	close(queue)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range queue {
+				resp, err := client.Get("https://api.github.com/repos/openshift/oc/commits")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// the burst of 300 requests is sent right away, the other 200 at 200 per second
+	if elapsed < 800*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the requests sent in about a second, took %s", elapsed)
+	}
+	sort.Slice(base.sent, func(i, j int) bool { return base.sent[i].Before(base.sent[j]) })
+	burst := rate * 3 / 2
+	for i := burst; i+rate/2 < len(base.sent); i++ {
+		// after the burst no more than the rate is sent in any half a second, with a little slack for the timers
+		if window := base.sent[i+rate/2].Sub(base.sent[i]); window < 400*time.Millisecond {
+			t.Fatalf("%d requests were sent within %s after the burst", rate/2+1, window)
+		}
+	}
+	if transport.Waited() == 0 {
+		t.Errorf("expected the time waited for the throttle")
+	}
+}
+
+func TestThrottleCancellation(t *testing.T) {
+	throttle := newThrottle(1, time.Hour, 1)
+	if err := throttle.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the next token is an hour away, the waiting callers return once their context is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- throttle.Wait(ctx)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the callers are still waiting after the cancellation")
+	}
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline exceeded, got %v", err)
+		}
+	}
+	// the tokens reserved by the canceled callers are given back
+	if throttle.tokens < -0.01 || throttle.Waited() != 0 {
+		t.Errorf("expected the reserved tokens back and no time waited, got %f tokens and %s", throttle.tokens, throttle.Waited())
+	}
+}
+
+func TestSearchThrottle(t *testing.T) {
+	transport := newThrottlingTransport(&fakeTransport{}, 0)
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("https://api.github.com/search/issues?q=sha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// the second search waits for the search limit, other requests are not throttled without -requests-per-second
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/search/issues?q=sha", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the second search throttled, got %v", err)
+	}
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		resp, err := client.Get("https://api.github.com/repos/openshift/oc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the other requests not throttled, took %s", elapsed)
+	}
+}
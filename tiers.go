@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tiers of payload images
+const (
+	tierCore   = "core"
+	tierExtras = "extras"
+	tierAll    = "all"
+)
+
+// releaseOperatorAnnotation marks images of operators managed by the cluster version operator
+const releaseOperatorAnnotation = "io.openshift.release.operator"
+
+// TierRule assigns the tier to payload tags with names matching the pattern (eg. "*-tests").
+type TierRule struct {
+	Pattern string `yaml:"pattern"`
+	Tier    string `yaml:"tier"`
+}
+
+// defaultTierRules classify auxiliary images (tests, artifacts, tooling) as extras, other images are core.
+var defaultTierRules = []TierRule{
+	{Pattern: "tests", Tier: tierExtras},
+	{Pattern: "*-tests", Tier: tierExtras},
+	{Pattern: "*-artifacts", Tier: tierExtras},
+	{Pattern: "*-installer", Tier: tierExtras},
+	{Pattern: "must-gather", Tier: tierExtras},
+	{Pattern: "tools", Tier: tierExtras},
+	{Pattern: "network-tools", Tier: tierExtras},
+	{Pattern: "ci-*", Tier: tierExtras},
+}
+
+func validateTier(tier string) error {
+	switch tier {
+	case tierCore, tierExtras, tierAll, "":
+		return nil
+	default:
+		return fmt.Errorf("unknown tier %q, use %s, %s or %s", tier, tierCore, tierExtras, tierAll)
+	}
+}
+
+// readTierRules reads rules from the YAML file, they take precedence over the default ones.
+func readTierRules(file string) ([]TierRule, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Rules []TierRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	for _, rule := range config.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %v", file, rule.Pattern, err)
+		}
+		if rule.Tier != tierCore && rule.Tier != tierExtras {
+			return nil, fmt.Errorf("%s: pattern %q has unknown tier %q", file, rule.Pattern, rule.Tier)
+		}
+	}
+	return append(config.Rules, defaultTierRules...), nil
+}
+
+// Tier classifies the tag, operators managed by the cluster version operator are always core.
+func (t Tag) Tier(rules []TierRule) string {
+	if t.Annotations[releaseOperatorAnnotation] == "true" {
+		return tierCore
+	}
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Pattern, t.Name); ok {
+			return rule.Tier
+		}
+	}
+	return tierCore
+}
+
+// RepositoryTiers returns the tier of each source repository, a repository is core when any of its images is.
+func (r *Release) RepositoryTiers(sourceAnnotations []string, rules []TierRule) map[string]string {
+	tiers := map[string]string{}
+	for _, t := range r.Refs.Spec.Tags {
+		repository, _, _, _ := t.Source(sourceAnnotations)
+		// tags skipped without a Github repository have no tier (see -show-skipped-tags)
+		if len(t.skipReason(sourceAnnotations)) > 0 || tiers[repository] == tierCore {
+			continue
+		}
+		tiers[repository] = t.Tier(rules)
+	}
+	return tiers
+}
+
+// tierFilter keeps only changes of repositories in the tier.
+type tierFilter struct {
+	tier string
+}
+
+func (f tierFilter) Name() string {
+	return "tier"
+}
+
+func (f tierFilter) Keep(c Change) (bool, string) {
+	if c.raw.Tier == f.tier {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%s tier", c.raw.Tier)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagTier(t *testing.T) {
+	tests := []struct {
+		tag         Tag
+		expected    string
+		description string
+	}{
+		{tag: Tag{Name: "cluster-kube-apiserver-operator"}, expected: tierCore},
+		{tag: Tag{Name: "machine-config-operator"}, expected: tierCore},
+		{tag: Tag{Name: "hyperkube"}, expected: tierCore},
+		{tag: Tag{Name: "tests"}, expected: tierExtras},
+		{tag: Tag{Name: "openstack-installer"}, expected: tierExtras},
+		{tag: Tag{Name: "baremetal-installer"}, expected: tierExtras},
+		{tag: Tag{Name: "cli-artifacts"}, expected: tierExtras},
+		{tag: Tag{Name: "installer-artifacts"}, expected: tierExtras},
+		{tag: Tag{Name: "must-gather"}, expected: tierExtras},
+		{tag: Tag{Name: "tools"}, expected: tierExtras},
+		{tag: Tag{Name: "network-tools"}, expected: tierExtras},
+		{tag: Tag{Name: "installer"}, expected: tierCore},
+		{tag: Tag{Name: "ovirt-csi-driver-operator-tests", Annotations: map[string]string{releaseOperatorAnnotation: "true"}}, expected: tierCore, description: "release operator"},
+	}
+	for _, test := range tests {
+		if tier := test.tag.Tier(defaultTierRules); tier != test.expected {
+			t.Errorf("%s %s: expected %s tier, got %s", test.tag.Name, test.description, test.expected, tier)
+		}
+	}
+}
+
+func TestReadTierRules(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.yaml")
+	if err := ioutil.WriteFile(rules, []byte("rules:\n- pattern: must-gather\n  tier: core\n- pattern: '*-operator-index'\n  tier: extras\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := readTierRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rules of the file are checked before the built-in ones
+	for name, expected := range map[string]string{"must-gather": tierCore, "redhat-operator-index": tierExtras, "tests": tierExtras, "console": tierCore} {
+		if tier := (Tag{Name: name}).Tier(parsed); tier != expected {
+			t.Errorf("%s: expected %s tier, got %s", name, expected, tier)
+		}
+	}
+
+	for content, expected := range map[string]string{
+		"rules:\n- pattern: tests\n  tier: optional\n":  `pattern "tests" has unknown tier "optional"`,
+		"rules:\n- pattern: '[tests'\n  tier: extras\n": `invalid pattern "[tests"`,
+	} {
+		if err := ioutil.WriteFile(rules, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTierRules(rules); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestRepositoryTiers(t *testing.T) {
+	release := readReleaseFixture(t, "release-info.json")
+	tiers := release.RepositoryTiers(defaultSourceAnnotations, defaultTierRules)
+	// openshift/oc builds both the core cli and the extras cli-artifacts images
+	expected := map[string]string{"https://github.com/openshift/oc": tierCore, "https://github.com/openshift/api": tierCore}
+	if !reflect.DeepEqual(tiers, expected) {
+		t.Errorf("expected %v, got %v", expected, tiers)
+	}
+}
+
+func TestTierOutput(t *testing.T) {
+	query := &queryOptions{tier: tierExtras, groupByTier: true, releaseInfoFile: filepath.Join("testdata", "release", "release-info.json"), tierRules: filepath.Join(t.TempDir(), "rules.yaml")}
+	if err := ioutil.WriteFile(query.tierRules, []byte("rules:\n- pattern: cluster-config-api\n  tier: extras\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := query.annotateTiers([]Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", URL: "https://github.com/openshift/oc/commit/a", Message: "Fix the login"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/api", URL: "https://github.com/openshift/api/commit/b", Message: "Bump the API"}),
+	}, defaultSourceAnnotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].raw.Tier != tierCore || changes[1].raw.Tier != tierExtras {
+		t.Fatalf("expected the tiers of the changes, got %+v", changes)
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTable, Report{Changes: changes, GroupByTier: true}); err != nil {
+		t.Fatal(err)
+	}
+	core, extras := strings.Index(out.String(), "Core payload images:"), strings.Index(out.String(), "Extra payload images")
+	if core < 0 || extras < core || !strings.Contains(out.String()[core:extras], "Fix the login") || !strings.Contains(out.String()[extras:], "Bump the API") {
+		t.Errorf("expected the changes in the sections of their tiers:\n%s", out.String())
+	}
+
+	if kept := query.apply(changes); len(kept) != 1 || kept[0].raw.Tier != tierExtras {
+		t.Errorf("expected only the extras change kept, got %+v", kept)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// displayLocation is the time zone absolute times are rendered in (except JSON, which keeps the offsets)
+var displayLocation = time.Local
+
+// showAbsoluteTime is set when -timezone is given, the changes then show absolute time next to the relative one
+var showAbsoluteTime bool
+
+// timezoneValue is the -timezone flag value, it fails on unknown zones already when the flags are parsed.
+type timezoneValue struct{}
+
+func (timezoneValue) String() string {
+	if displayLocation == nil {
+		return ""
+	}
+	return displayLocation.String()
+}
+
+func (timezoneValue) Set(value string) error {
+	location, err := time.LoadLocation(value)
+	if err != nil || value == "" {
+		return fmt.Errorf("unknown time zone %q, use an IANA zone name (eg. 'Europe/Prague', 'America/New_York', 'Asia/Shanghai') or 'UTC'", value)
+	}
+	displayLocation = location
+	showAbsoluteTime = true
+	return nil
+}
+
+// formatTime renders the absolute time in the display time zone.
+func formatTime(t time.Time) string {
+	return t.In(displayLocation).Format("2006-01-02 15:04 MST")
+}
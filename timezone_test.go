@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTimezone sets the -timezone flag, the previous time zone is restored when the test finishes.
+func setTimezone(t *testing.T, zone string) error {
+	location, absolute := displayLocation, showAbsoluteTime
+	t.Cleanup(func() {
+		displayLocation, showAbsoluteTime = location, absolute
+	})
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	(&sharedOptions{}).addFlags(fs)
+	return fs.Parse([]string{"-timezone", zone})
+}
+
+func TestTimezone(t *testing.T) {
+	raw := RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API", Date: time.Date(2021, 8, 18, 22, 30, 0, 0, time.UTC)}
+	tests := []struct {
+		zone     string
+		expected string
+	}{
+		{zone: "UTC", expected: "2021-08-18 22:30 UTC"},
+		{zone: "Asia/Shanghai", expected: "2021-08-19 06:30 CST"},
+	}
+	for _, test := range tests {
+		if err := setTimezone(t, test.zone); err != nil {
+			t.Fatal(err)
+		}
+		change := newChange(raw)
+		if !strings.HasSuffix(change.Time, "\n"+test.expected) {
+			t.Errorf("%s: expected the time rendered as %q, got %q", test.zone, test.expected, change.Time)
+		}
+		// JSON keeps the time with its offset
+		var out bytes.Buffer
+		if err := writeReport(&out, formatJSON, Report{Changes: []Change{change}}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), `"date": "2021-08-18T22:30:00Z"`) {
+			t.Errorf("%s: expected the RFC3339 date in JSON, got:\n%s", test.zone, out.String())
+		}
+	}
+
+	err := setTimezone(t, "Asia/Beijing")
+	if err == nil || !strings.Contains(err.Error(), `unknown time zone "Asia/Beijing", use an IANA zone name`) {
+		t.Errorf("expected the unknown time zone rejected when parsing the flags, got %v", err)
+	}
+}
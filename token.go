@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// readScopes are the classic token scopes that allow reading the payload repositories
+var readScopes = []string{"repo", "public_repo"}
+
+// dominantOrganization returns the organization most of the repositories belong to, ignoring private forks.
+func dominantOrganization(repositories []string) (string, string, bool) {
+	counts := map[string]int{}
+	first := map[string]string{}
+	var dominant string
+	for _, repository := range repositories {
+		organization, name, ok := parseRepositoryOrgName(repository)
+		if !ok || isPrivateForkOrganization(organization) {
+			continue
+		}
+		counts[organization]++
+		if _, ok := first[organization]; !ok {
+			first[organization] = name
+		}
+		if counts[organization] > counts[dominant] {
+			dominant = organization
+		}
+	}
+	return dominant, first[dominant], len(dominant) > 0
+}
+
+// ssoAuthorizationURL returns the URL to authorize the token from the X-GitHub-SSO header
+// (eg. "required; url=https://github.com/orgs/openshift/sso?authorization_request=...").
+func ssoAuthorizationURL(resp *github.Response) (string, bool) {
+	if resp == nil || resp.Response == nil {
+		return "", false
+	}
+	header := resp.Header.Get("X-GitHub-SSO")
+	if !strings.HasPrefix(header, "required") {
+		return "", false
+	}
+	if i := strings.Index(header, "url="); i >= 0 {
+		return header[i+len("url="):], true
+	}
+	return "", true
+}
+
+// checkToken verifies the token works and can read the payload repositories, so a misconfigured token
+// is reported before all repositories fail one by one.
+func checkToken(ctx context.Context, client *github.Client, repositories []string) error {
+	ctx = withCategory(ctx, categoryRepository)
+	user, resp, err := client.Users.Get(ctx, "")
+	if err != nil {
+		if resp != nil && resp.Response != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf(":-( Github rejected the token, it is invalid or expired (use -skip-token-check to bypass this check)")
+		}
+		return fmt.Errorf("unable to verify the Github token: %v", err)
+	}
+	// fine-grained tokens do not report scopes
+	if scopes := resp.Header.Get("X-OAuth-Scopes"); len(scopes) > 0 {
+		found := false
+		for _, scope := range strings.Split(scopes, ",") {
+			for _, s := range readScopes {
+				found = found || strings.TrimSpace(scope) == s
+			}
+		}
+		if !found {
+			log.Printf("WARNING: token of %s has scopes %q, it needs one of %s to read the repositories", user.GetLogin(), scopes, strings.Join(readScopes, ", "))
+		}
+	}
+
+	organization, name, ok := dominantOrganization(repositories)
+	if !ok {
+		return nil
+	}
+	_, resp, err = client.Repositories.Get(ctx, organization, name)
+	if err == nil {
+		return nil
+	}
+	if url, ok := ssoAuthorizationURL(resp); ok {
+		return fmt.Errorf(":-( token of %s is not authorized for SAML SSO of the %s organization, authorize it at %s", user.GetLogin(), organization, url)
+	}
+	if isIPAllowListed(err) {
+		return fmt.Errorf(":-( %s/%s can't be read from this IP address, %s", organization, name, errorKindHints[ErrorKindIPAllowList])
+	}
+	if resp != nil && resp.Response != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf(":-( token of %s can't read %s/%s, check the token scopes and its access to the %s organization", user.GetLogin(), organization, name, organization)
+	}
+	return fmt.Errorf("unable to verify access to %s/%s: %v", organization, name, err)
+}
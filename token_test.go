@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestCheckToken(t *testing.T) {
+	repositories := []string{"https://github.com/openshift-priv/api", "https://github.com/openshift/api", "https://github.com/openshift/oc", "https://github.com/operator-framework/operator-lifecycle-manager"}
+	tests := []struct {
+		name       string
+		user       func(w http.ResponseWriter)
+		repository func(w http.ResponseWriter)
+		expected   string
+	}{
+		{
+			name:       "valid",
+			user:       func(w http.ResponseWriter) { fmt.Fprint(w, `{"login": "mfojtik"}`) },
+			repository: func(w http.ResponseWriter) { fmt.Fprint(w, `{"name": "api"}`) },
+		},
+		{
+			name: "expired",
+			user: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message": "Bad credentials"}`)
+			},
+			expected: "Github rejected the token, it is invalid or expired",
+		},
+		{
+			name: "not authorized for SSO",
+			user: func(w http.ResponseWriter) { fmt.Fprint(w, `{"login": "mfojtik"}`) },
+			repository: func(w http.ResponseWriter) {
+				w.Header().Set("X-GitHub-SSO", "required; url=https://github.com/orgs/openshift/sso?authorization_request=42")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"message": "Resource protected by organization SAML enforcement."}`)
+			},
+			expected: "token of mfojtik is not authorized for SAML SSO of the openshift organization, authorize it at https://github.com/orgs/openshift/sso?authorization_request=42",
+		},
+		{
+			name: "no access",
+			user: func(w http.ResponseWriter) { fmt.Fprint(w, `{"login": "mfojtik"}`) },
+			repository: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "Not Found"}`)
+			},
+			expected: "token of mfojtik can't read openshift/api, check the token scopes",
+		},
+		{
+			name: "IP allow list",
+			user: func(w http.ResponseWriter) { fmt.Fprint(w, `{"login": "mfojtik"}`) },
+			repository: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"message": "Although you appear to have the correct authorization credentials, the `+"`openshift`"+` organization has an IP allow list enabled, and your IP address is not permitted to access this resource."}`)
+			},
+			expected: "openshift/api can't be read from this IP address, their organization only allows listed IP addresses",
+		},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch req.URL.Path {
+			case "/user":
+				w.Header().Set("X-OAuth-Scopes", "read:org")
+				test.user(w)
+			// the dominant organization of the repositories, private forks are ignored
+			case "/repos/openshift/api":
+				test.repository(w)
+			default:
+				t.Errorf("%s: unexpected request %s", test.name, req.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		client := github.NewClient(nil)
+		client.BaseURL, _ = url.Parse(server.URL + "/")
+
+		err := checkToken(context.Background(), client, repositories)
+		switch {
+		case len(test.expected) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case len(test.expected) > 0 && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+		server.Close()
+	}
+}
+
+func TestSkipTokenCheck(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	if err := (&sharedOptions{skipTokenCheck: true}).checkToken(context.Background(), client, nil); err != nil || requests > 0 {
+		t.Errorf("expected the check skipped, got %v after %d requests", err, requests)
+	}
+	// the token is checked once for all queries of the command
+	shared := &sharedOptions{}
+	for i := 0; i < 2; i++ {
+		if err := shared.checkToken(context.Background(), client, nil); err == nil {
+			t.Errorf("expected the expired token reported")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected a single check, got %d requests", requests)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// spanRepository is the name of the span covering the processing of a single repository
+const spanRepository = "repository"
+
+// Span is a timed operation, eg. listing commits of a repository.
+type Span struct {
+	Name       string
+	Start      time.Time
+	Duration   time.Duration
+	Attributes map[string]interface{}
+	// track groups the span with its parent when rendered
+	track int
+}
+
+// SpanRecorder receives finished spans. The default recorder drops them, so tracing costs nothing when disabled.
+type SpanRecorder interface {
+	Enabled() bool
+	Record(span Span)
+}
+
+type noopRecorder struct{}
+
+func (noopRecorder) Enabled() bool { return false }
+func (noopRecorder) Record(Span)   {}
+
+type recorderContextKey struct{}
+type spanContextKey struct{}
+
+// withRecorder records spans started from the returned context by the recorder.
+func withRecorder(ctx context.Context, recorder SpanRecorder) context.Context {
+	return context.WithValue(ctx, recorderContextKey{}, recorder)
+}
+
+func recorderFromContext(ctx context.Context) SpanRecorder {
+	if recorder, ok := ctx.Value(recorderContextKey{}).(SpanRecorder); ok {
+		return recorder
+	}
+	return noopRecorder{}
+}
+
+// activeSpan is a started span, nil when tracing is disabled.
+type activeSpan struct {
+	lock     sync.Mutex
+	span     Span
+	recorder SpanRecorder
+	clock    func() time.Time
+	parent   *activeSpan
+}
+
+var trackCounter struct {
+	sync.Mutex
+	next int
+}
+
+// startSpan starts a span which is a child of the span in the context, if any.
+func startSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, *activeSpan) {
+	recorder := recorderFromContext(ctx)
+	if !recorder.Enabled() {
+		return ctx, nil
+	}
+	clock := time.Now
+	if c, ok := recorder.(interface{ Now() time.Time }); ok {
+		clock = c.Now
+	}
+	s := &activeSpan{recorder: recorder, clock: clock, span: Span{Name: name, Start: clock(), Attributes: map[string]interface{}{}}}
+	for k, v := range attributes {
+		s.span.Attributes[k] = v
+	}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.parent = parent
+		s.span.track = parent.span.track
+	} else {
+		trackCounter.Lock()
+		trackCounter.next++
+		s.span.track = trackCounter.next
+		trackCounter.Unlock()
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func spanFromContext(ctx context.Context) *activeSpan {
+	s, _ := ctx.Value(spanContextKey{}).(*activeSpan)
+	return s
+}
+
+// Set sets the attribute of the span.
+func (s *activeSpan) Set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.span.Attributes[key] = value
+}
+
+// End finishes the span and passes it to the recorder.
+func (s *activeSpan) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.span.Duration = s.clock().Sub(s.span.Start)
+	span := s.span
+	s.lock.Unlock()
+	s.recorder.Record(span)
+}
+
+// addSpanCounter adds to the numeric attribute of the span in the context (eg. pages listed by the repository).
+func addSpanCounter(ctx context.Context, key string, n int) {
+	s := spanFromContext(ctx)
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, _ := s.span.Attributes[key].(int)
+	s.span.Attributes[key] = current + n
+}
+
+// addSpanWait adds to the time the span in the context, and its parents, spent waiting (eg. for a throttled API).
+func addSpanWait(ctx context.Context, wait time.Duration) {
+	for s := spanFromContext(ctx); s != nil; s = s.parent {
+		s.lock.Lock()
+		current, _ := s.span.Attributes["wait"].(time.Duration)
+		s.span.Attributes["wait"] = current + wait
+		s.lock.Unlock()
+	}
+}
+
+// traceRecorder keeps all spans in memory.
+type traceRecorder struct {
+	lock  sync.Mutex
+	spans []Span
+}
+
+func (r *traceRecorder) Enabled() bool { return true }
+
+func (r *traceRecorder) Record(span Span) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes the spans in the Chrome trace event format (viewable in about:tracing or Perfetto).
+func (r *traceRecorder) WriteChromeTrace(path string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	for _, s := range r.spans {
+		args := map[string]interface{}{}
+		for k, v := range s.Attributes {
+			if d, ok := v.(time.Duration); ok {
+				v = d.String()
+			}
+			args[k] = v
+		}
+		trace.TraceEvents = append(trace.TraceEvents, traceEvent{
+			Name:      s.Name,
+			Phase:     "X",
+			Timestamp: s.Start.UnixNano() / int64(time.Microsecond),
+			Duration:  int64(s.Duration / time.Microsecond),
+			PID:       1,
+			TID:       s.track,
+			Args:      args,
+		})
+	}
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// SlowRepository is a row of the slowest repositories table.
+type SlowRepository struct {
+	Repository string `header:"Repository"`
+	Duration   string `header:"Duration"`
+	Wait       string `header:"Waiting"`
+	Work       string `header:"Working"`
+	Pages      int    `header:"Pages"`
+	Commits    int    `header:"Commits"`
+	Retries    int    `header:"Retries"`
+}
+
+// slowestRepositories returns the repositories that took the longest, splitting the time to waiting and working.
+func (r *traceRecorder) slowestRepositories(n int) []SlowRepository {
+	r.lock.Lock()
+	var spans []Span
+	for _, s := range r.spans {
+		if s.Name == spanRepository {
+			spans = append(spans, s)
+		}
+	}
+	r.lock.Unlock()
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Duration > spans[j].Duration })
+	if len(spans) > n {
+		spans = spans[:n]
+	}
+	var rows []SlowRepository
+	for _, s := range spans {
+		wait, _ := s.Attributes["wait"].(time.Duration)
+		repository, _ := s.Attributes["repository"].(string)
+		pages, _ := s.Attributes["pages"].(int)
+		commits, _ := s.Attributes["commits"].(int)
+		retries, _ := s.Attributes["retries"].(int)
+		rows = append(rows, SlowRepository{
+			Repository: repository,
+			Duration:   s.Duration.Round(time.Millisecond).String(),
+			Wait:       wait.Round(time.Millisecond).String(),
+			Work:       (s.Duration - wait).Round(time.Millisecond).String(),
+			Pages:      pages,
+			Commits:    commits,
+			Retries:    retries,
+		})
+	}
+	return rows
+}
+
+func (r *traceRecorder) PrintSlowest(w io.Writer, n int) {
+	rows := r.slowestRepositories(n)
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nSlowest repositories:\n")
+	tableprinter.New(w).Print(rows)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClockRecorder is a traceRecorder whose spans are timed by a clock advanced by the test.
+type fakeClockRecorder struct {
+	traceRecorder
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (r *fakeClockRecorder) Now() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.now
+}
+
+func (r *fakeClockRecorder) advance(d time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.now = r.now.Add(d)
+}
+
+func TestSpanWaitAndWork(t *testing.T) {
+	recorder := &fakeClockRecorder{now: time.Date(2021, 8, 18, 10, 0, 0, 0, time.UTC)}
+	ctx := withRecorder(context.Background(), recorder)
+
+	for _, repository := range []struct {
+		name       string
+		wait, work time.Duration
+	}{
+		{name: "https://github.com/openshift/oc", wait: 3 * time.Second, work: 2 * time.Second},
+		{name: "https://github.com/openshift/api", wait: 0, work: time.Second},
+		{name: "https://github.com/openshift/origin", wait: 10 * time.Second, work: 500 * time.Millisecond},
+	} {
+		repositoryCtx, span := startSpan(ctx, spanRepository, map[string]interface{}{"repository": repository.name})
+		listCtx, list := startSpan(repositoryCtx, "list-commits", nil)
+		// the rate limit wait of the request is attributed to the listing and the repository
+		recorder.advance(repository.wait)
+		addSpanWait(listCtx, repository.wait)
+		recorder.advance(repository.work)
+		addSpanCounter(listCtx, "pages", 1)
+		addSpanCounter(repositoryCtx, "pages", 1)
+		list.End()
+		span.End()
+	}
+
+	rows := recorder.slowestRepositories(2)
+	expected := []SlowRepository{
+		{Repository: "https://github.com/openshift/origin", Duration: "10.5s", Wait: "10s", Work: "500ms", Pages: 1},
+		{Repository: "https://github.com/openshift/oc", Duration: "5s", Wait: "3s", Work: "2s", Pages: 1},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected the 2 slowest repositories, got %+v", rows)
+	}
+	for i := range rows {
+		if rows[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], rows[i])
+		}
+	}
+	// each listing ends before its repository, on the track of the repository
+	for i := 0; i+1 < len(recorder.spans); i += 2 {
+		if list, repository := recorder.spans[i], recorder.spans[i+1]; list.track != repository.track || (i > 0 && repository.track == recorder.spans[i-1].track) {
+			t.Errorf("expected the listing on the track of its repository only, got %+v and %+v", list, repository)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := recorder.WriteChromeTrace(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.TraceEvents) != 6 {
+		t.Fatalf("expected an event per span, got %d", len(trace.TraceEvents))
+	}
+	// the first span is the listing of openshift/oc
+	if event := trace.TraceEvents[0]; event.Name != "list-commits" || event.Duration != 5000000 || event.Args["wait"] != "3s" || event.Phase != "X" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestSpansDisabled(t *testing.T) {
+	ctx, span := startSpan(context.Background(), spanRepository, nil)
+	if span != nil || spanFromContext(ctx) != nil {
+		t.Fatalf("expected no span without a recorder")
+	}
+	// the helpers are no-ops
+	span.Set("commits", 1)
+	addSpanCounter(ctx, "pages", 1)
+	addSpanWait(ctx, time.Second)
+	span.End()
+}
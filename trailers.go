@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// trailerLine matches "Key: value" trailer lines, keys are tokens without spaces as in git (trailerKey matches the
+// keys of -columns). Unlike git the value can't be empty, so a body ending with "Changes:" and an indented list is
+// not taken for a trailer.
+var (
+	trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s*(\S.*)$`)
+	trailerKey  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+)
+
+// trailerBlock finds the trailers of the message following the git rules: the trailers are the last paragraph
+// after the subject, where "Key: value" lines can continue on lines starting with whitespace. The paragraph is a
+// trailer block when all its lines are trailers, or when it has a Signed-off-by and at least a quarter of its
+// lines are trailers, the other lines are then kept in the body. Returns the index of the first line of the block and
+// whether each of its lines is a trailer (or its continuation), start is -1 without trailers.
+func trailerBlock(lines []string) (start int, trailer []bool) {
+	end := len(lines)
+	for end > 0 && len(strings.TrimSpace(lines[end-1])) == 0 {
+		end--
+	}
+	start = end
+	for start > 1 && len(strings.TrimSpace(lines[start-1])) > 0 {
+		start--
+	}
+	// the subject is never a trailer
+	if start <= 1 || start == end {
+		return -1, nil
+	}
+	trailer = make([]bool, end-start)
+	trailers, others, signedOff := 0, 0, false
+	for i := start; i < end; i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		if match := trailerLine.FindStringSubmatch(line); match != nil {
+			trailer[i-start] = true
+			trailers++
+			signedOff = signedOff || strings.EqualFold(match[1], "Signed-off-by")
+			continue
+		}
+		// continuation lines belong to the trailer above
+		if i > start && trailer[i-start-1] && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			trailer[i-start] = true
+			continue
+		}
+		others++
+	}
+	if trailers == 0 || (others > 0 && !(signedOff && trailers*3 >= others)) {
+		return -1, nil
+	}
+	return start, trailer
+}
+
+// parseTrailers returns the trailers of the commit message by their canonical key (eg. "Upstream-Commit"), in the
+// order of the message, nil when it has none.
+func parseTrailers(message string) map[string][]string {
+	lines := strings.Split(message, "\n")
+	start, trailer := trailerBlock(lines)
+	if start < 0 {
+		return nil
+	}
+	trailers := map[string][]string{}
+	var key string
+	for i, isTrailer := range trailer {
+		line := strings.TrimRight(lines[start+i], " \t\r")
+		if !isTrailer {
+			key = ""
+			continue
+		}
+		if match := trailerLine.FindStringSubmatch(line); match != nil {
+			key = textproto.CanonicalMIMEHeaderKey(match[1])
+			trailers[key] = append(trailers[key], match[2])
+			continue
+		}
+		if values := trailers[key]; len(key) > 0 {
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+		}
+	}
+	return trailers
+}
+
+// stripTrailers removes the trailers from the message, the Co-authored-by ones are kept when coauthors is set.
+func stripTrailers(message string, coauthors bool) string {
+	lines := strings.Split(message, "\n")
+	start, trailer := trailerBlock(lines)
+	if start < 0 {
+		return message
+	}
+	kept := append([]string{}, lines[:start]...)
+	coauthor := false
+	for i, isTrailer := range trailer {
+		line := lines[start+i]
+		if match := trailerLine.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			coauthor = strings.EqualFold(match[1], "Co-authored-by")
+		}
+		if !isTrailer || (coauthors && coauthor) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// formatTrailer renders the values of the trailer key, one per line.
+func formatTrailer(trailers map[string][]string, key string) string {
+	return strings.Join(trailers[textproto.CanonicalMIMEHeaderKey(key)], "\n")
+}
+
+// parseColumns reads the -columns, only "trailer:KEY" columns are supported.
+func parseColumns(columns []string) ([]string, error) {
+	var keys []string
+	for _, column := range columns {
+		kind, key := column, ""
+		if i := strings.Index(column, ":"); i >= 0 {
+			kind, key = column[:i], column[i+1:]
+		}
+		if kind != "trailer" || !trailerKey.MatchString(key) {
+			return nil, fmt.Errorf("unknown column %q, use trailer:KEY (eg. 'trailer:Component')", column)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
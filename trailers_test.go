@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected map[string][]string
+		stripped string
+	}{
+		{
+			name:     "no trailers",
+			message:  "Bump the API\n\nThe fields of the cluster version.",
+			stripped: "Bump the API\n\nThe fields of the cluster version.",
+		},
+		{
+			name:     "only a subject",
+			message:  "Component: not a trailer",
+			stripped: "Component: not a trailer",
+		},
+		{
+			name:     "trailers",
+			message:  "Bump the API\n\nThe fields.\n\nUpstream-commit: abc1234\ncomponent: oc\nAcked-by: Jane Doe <jane@example.com>\nAcked-by: John Doe <john@example.com>\n",
+			expected: map[string][]string{"Upstream-Commit": {"abc1234"}, "Component": {"oc"}, "Acked-By": {"Jane Doe <jane@example.com>", "John Doe <john@example.com>"}},
+			stripped: "Bump the API\n\nThe fields.\n",
+		},
+		{
+			name:     "continuation lines",
+			message:  "Bump the API\n\nOCP-Version: 4.9\n  and 4.10\nComponent: oc",
+			expected: map[string][]string{"Ocp-Version": {"4.9 and 4.10"}, "Component": {"oc"}},
+			stripped: "Bump the API\n",
+		},
+		{
+			name:     "mixed paragraph without a signature",
+			message:  "Bump the API\n\nSee the enhancement.\nComponent: oc",
+			stripped: "Bump the API\n\nSee the enhancement.\nComponent: oc",
+		},
+		{
+			name:     "mixed paragraph with a signature",
+			message:  "Bump the API\n\n(cherry picked from commit abc1234)\nComponent: oc\nSigned-off-by: Jane Doe <jane@example.com>",
+			expected: map[string][]string{"Component": {"oc"}, "Signed-Off-By": {"Jane Doe <jane@example.com>"}},
+			stripped: "Bump the API\n\n(cherry picked from commit abc1234)",
+		},
+		{
+			name:     "mixed paragraph with a signature and too few trailers",
+			message:  "Bump the API\n\nOne\nTwo\nThree\nFour\nSigned-off-by: Jane Doe <jane@example.com>",
+			stripped: "Bump the API\n\nOne\nTwo\nThree\nFour\nSigned-off-by: Jane Doe <jane@example.com>",
+		},
+		{
+			name:     "trailers not in the last paragraph",
+			message:  "Bump the API\n\nComponent: oc\n\nThe fields.",
+			stripped: "Bump the API\n\nComponent: oc\n\nThe fields.",
+		},
+		{
+			name:     "empty values",
+			message:  "Bump the API\n\nChanges:\n  - add a field",
+			stripped: "Bump the API\n\nChanges:\n  - add a field",
+		},
+	}
+	for _, test := range tests {
+		if trailers := parseTrailers(test.message); !reflect.DeepEqual(trailers, test.expected) {
+			t.Errorf("%s: expected the trailers %v, got %v", test.name, test.expected, trailers)
+		}
+		if stripped := stripTrailers(test.message, false); stripped != test.stripped {
+			t.Errorf("%s: expected %q stripped, got %q", test.name, test.stripped, stripped)
+		}
+	}
+
+	message := "Bump the API\n\nComponent: oc\nCo-authored-by: Jane Doe <jane@example.com>"
+	if stripped := stripTrailers(message, true); stripped != "Bump the API\n\nCo-authored-by: Jane Doe <jane@example.com>" {
+		t.Errorf("expected the co-authors kept, got %q", stripped)
+	}
+}
+
+func TestTrailerColumns(t *testing.T) {
+	if _, err := parseColumns([]string{"trailer:Component", "author"}); err == nil || !strings.Contains(err.Error(), `unknown column "author"`) {
+		t.Errorf("expected an unknown column to fail, got %v", err)
+	}
+	if _, err := (&queryOptions{columns: commaSeparatedList{"trailer:Not a key"}}).processOptions(&sharedOptions{}); err == nil {
+		t.Errorf("expected an invalid trailer key to fail")
+	}
+	options, err := (&queryOptions{columns: commaSeparatedList{"trailer:component", "trailer:Acked-by"}}).processOptions(&sharedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(options.TrailerColumns, []string{"component", "Acked-by"}) {
+		t.Errorf("expected the trailer columns in the options, got %v", options.TrailerColumns)
+	}
+
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API\n\nComponent: config\nUpstream-commit: abc1234"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix the build"}),
+	}
+	var out bytes.Buffer
+	printChanges(&out, changes, MessageWrap{Width: 200}, options.TrailerColumns)
+	lines := strings.Split(out.String(), "\n")
+	// the column without values is omitted and the trailers are left out of the message
+	if !strings.Contains(lines[0], "COMPONENT") || strings.Contains(lines[0], "ACKED-BY") || !strings.Contains(out.String(), "config") || strings.Contains(out.String(), "abc1234") {
+		t.Errorf("expected only the component column, got\n%s", out.String())
+	}
+
+	data, err := json.Marshal(changes[0].raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"trailers":{"Component":["config"],"Upstream-Commit":["abc1234"]}`) {
+		t.Errorf("expected the trailers in JSON, got %s", data)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lensesio/tableprinter"
+)
+
+// trendRun is a single saved run, either raw data or a JSON report.
+type trendRun struct {
+	Source string
+	// Kind is either "raw data" or "JSON report"
+	Kind    string
+	Created time.Time
+	Changes []RawChange
+	// Repositories are all processed repositories, JSON reports only know those with changes
+	Repositories []string
+}
+
+// TrendRun summarizes a run compared to the previous one.
+type TrendRun struct {
+	Source      string    `json:"source"`
+	Created     time.Time `json:"created"`
+	Changes     int       `json:"changes"`
+	NewlyActive []string  `json:"newlyActive,omitempty"`
+	NewlyQuiet  []string  `json:"newlyQuiet,omitempty"`
+	NewAuthors  []string  `json:"newAuthors,omitempty"`
+}
+
+// TrendReport is the output of the trend command.
+type TrendReport struct {
+	Runs []TrendRun `json:"runs"`
+	// Repositories maps repositories to the number of changes in each run
+	Repositories map[string][]int `json:"repositories"`
+}
+
+// savedRun has the fields of both raw data and JSON report, so the file kind can be detected.
+type savedRun struct {
+	Version      int             `json:"version"`
+	Repositories []RawRepository `json:"repositories"`
+	Changes      []RawChange     `json:"changes"`
+	Metadata     struct {
+		Created time.Time `json:"created"`
+	} `json:"metadata"`
+}
+
+func readTrendRun(path string) (*trendRun, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved savedRun
+	if err := json.Unmarshal(in, &saved); err != nil {
+		return nil, err
+	}
+	run := &trendRun{Source: path, Created: saved.Metadata.Created}
+	switch {
+	case saved.Repositories != nil:
+		run.Kind = "raw data"
+		if saved.Version != rawDataVersion {
+			return nil, fmt.Errorf("unsupported raw data version %d (expected %d)", saved.Version, rawDataVersion)
+		}
+		for _, r := range saved.Repositories {
+			run.Repositories = append(run.Repositories, r.Repository)
+			run.Changes = append(run.Changes, r.Changes...)
+		}
+	case saved.Changes != nil:
+		run.Kind = "JSON report"
+		run.Changes = saved.Changes
+		seen := map[string]bool{}
+		for _, c := range saved.Changes {
+			if !seen[c.Repository] {
+				seen[c.Repository] = true
+				run.Repositories = append(run.Repositories, c.Repository)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("neither raw data nor JSON report")
+	}
+	// reports written before they recorded the time fall back to the file modification time
+	if run.Created.IsZero() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		run.Created = info.ModTime()
+	}
+	return run, nil
+}
+
+func newTrendReport(runs []*trendRun) TrendReport {
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Created.Before(runs[j].Created) })
+	report := TrendReport{Repositories: map[string][]int{}}
+	for _, run := range runs {
+		for _, r := range run.Repositories {
+			report.Repositories[r] = make([]int, len(runs))
+		}
+	}
+	authors := map[string]bool{}
+	for i, run := range runs {
+		result := TrendRun{Source: run.Source, Created: run.Created, Changes: len(run.Changes)}
+		var runAuthors []string
+		for _, c := range run.Changes {
+			report.Repositories[c.Repository][i]++
+			if len(c.Author) > 0 && !authors[c.Author] {
+				authors[c.Author] = true
+				runAuthors = append(runAuthors, c.Author)
+			}
+		}
+		if i > 0 {
+			result.NewAuthors = runAuthors
+			for repository, counts := range report.Repositories {
+				switch {
+				case counts[i] > 0 && counts[i-1] == 0:
+					result.NewlyActive = append(result.NewlyActive, repositoryName(repository))
+				case counts[i] == 0 && counts[i-1] > 0:
+					result.NewlyQuiet = append(result.NewlyQuiet, repositoryName(repository))
+				}
+			}
+			sort.Strings(result.NewAuthors)
+			sort.Strings(result.NewlyActive)
+			sort.Strings(result.NewlyQuiet)
+		}
+		report.Runs = append(report.Runs, result)
+	}
+	return report
+}
+
+// matrix returns the per repository counts as rows, with a header per run.
+func (r TrendReport) matrix() ([]string, [][]string) {
+	headers := []string{"Repository"}
+	for _, run := range r.Runs {
+		headers = append(headers, run.Created.In(displayLocation).Format("2006-01-02 15:04"))
+	}
+	var repositories []string
+	for repository := range r.Repositories {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+	var rows [][]string
+	for _, repository := range repositories {
+		row := []string{repositoryName(repository)}
+		for _, count := range r.Repositories[repository] {
+			row = append(row, fmt.Sprintf("%d", count))
+		}
+		rows = append(rows, row)
+	}
+	total := []string{"Total"}
+	for _, run := range r.Runs {
+		total = append(total, fmt.Sprintf("%d", run.Changes))
+	}
+	return headers, append(rows, total)
+}
+
+// TrendRunRow is a row of the per run changes table.
+type TrendRunRow struct {
+	Run         string `header:"Run"`
+	NewlyActive string `header:"Newly active"`
+	NewlyQuiet  string `header:"Newly quiet"`
+	NewAuthors  string `header:"New authors"`
+}
+
+func (r TrendReport) runRows() []TrendRunRow {
+	var rows []TrendRunRow
+	for _, run := range r.Runs[1:] {
+		rows = append(rows, TrendRunRow{
+			Run:         run.Created.In(displayLocation).Format("2006-01-02 15:04"),
+			NewlyActive: strings.Join(run.NewlyActive, "\n"),
+			NewlyQuiet:  strings.Join(run.NewlyQuiet, "\n"),
+			NewAuthors:  strings.Join(run.NewAuthors, "\n"),
+		})
+	}
+	return rows
+}
+
+func writeMarkdownTable(w io.Writer, headers []string, rows [][]string) {
+	fmt.Fprintf(w, "| %s |\n", strings.Join(headers, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(headers)))
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.Replace(strings.Replace(row[i], "|", "\\|", -1), "\n", "<br>", -1)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+}
+
+func writeTrendReport(w io.Writer, format string, report TrendReport) error {
+	switch format {
+	case formatTable:
+		headers, rows := report.matrix()
+		tableprinter.New(w).Render(headers, rows, nil, false)
+		fmt.Fprintf(w, "\nChanges compared to the previous run:\n")
+		tableprinter.New(w).Print(report.runRows())
+		return nil
+	case formatMarkdown:
+		headers, rows := report.matrix()
+		fmt.Fprintf(w, "## Changes per repository\n\n")
+		writeMarkdownTable(w, headers, rows)
+		fmt.Fprintf(w, "\n## Changes compared to the previous run\n\n")
+		var runRows [][]string
+		for _, r := range report.runRows() {
+			runRows = append(runRows, []string{r.Run, r.NewlyActive, r.NewlyQuiet, r.NewAuthors})
+		}
+		writeMarkdownTable(w, []string{"Run", "Newly active", "Newly quiet", "New authors"}, runRows)
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q, trend supports %s, %s and %s", format, formatTable, formatMarkdown, formatJSON)
+	}
+}
+
+func newTrendCommand() *command {
+	cmd := newCommand("trend", "Show how changes evolve across multiple saved runs", `
+The trend does not talk to Github, it reads files saved via 'collect -save-raw' or 'collect -format json'.
+Globs are expanded, at least two valid files are required.
+
+Examples:
+  # weekly trend of the daily runs
+  ocp-what-merged trend 'archive/2021-08-*.json'
+
+  # the same as markdown
+  ocp-what-merged trend -format markdown monday.json tuesday.json wednesday.json
+`)
+	shared := &sharedOptions{}
+	shared.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		err := runTrend(shared, args)
+		if err == errNotEnoughRuns {
+			cmd.flags.Usage()
+		}
+		return err
+	}
+	return cmd
+}
+
+var errNotEnoughRuns = errors.New("at least two valid saved runs are required")
+
+func runTrend(shared *sharedOptions, patterns []string) error {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+
+	var (
+		runs    []*trendRun
+		skipped []string
+	)
+	for _, path := range paths {
+		run, err := readTrendRun(path)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s (%v)", path, err))
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if len(skipped) > 0 {
+		log.Printf("WARNING: skipped %d incompatible files:\n  %s", len(skipped), strings.Join(skipped, "\n  "))
+	}
+	if len(runs) < 2 {
+		return errNotEnoughRuns
+	}
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeTrendReport(out, shared.format, newTrendReport(runs)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
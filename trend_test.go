@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestRun(t *testing.T, path string, run interface{}) {
+	t.Helper()
+	data, err := json.Marshal(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTrend(t *testing.T) {
+	dir := t.TempDir()
+	monday := time.Date(2021, 8, 16, 8, 0, 0, 0, time.UTC)
+	api, origin := "https://github.com/openshift/api", "https://github.com/openshift/origin"
+
+	// raw data knows the repositories without changes, JSON reports do not
+	writeTestRun(t, filepath.Join(dir, "1-tuesday.json"), jsonReport{
+		Metadata: jsonMetadata{Created: monday.Add(24 * time.Hour)},
+		Changes:  []RawChange{{Repository: origin, Author: "sttts"}, {Repository: origin, Author: "deads2k"}},
+	})
+	writeTestRun(t, filepath.Join(dir, "2-monday.json"), RawData{
+		Version:  rawDataVersion,
+		Metadata: RawMetadata{Created: monday},
+		Repositories: []RawRepository{
+			{Repository: api, Changes: []RawChange{{Repository: api, Author: "deads2k"}}},
+			{Repository: origin},
+		},
+	})
+	writeTestRun(t, filepath.Join(dir, "3-future.json"), RawData{Version: rawDataVersion + 1, Repositories: []RawRepository{}})
+	if err := ioutil.WriteFile(filepath.Join(dir, "4-broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "trend.out")
+	var err error
+	logged := captureLog(t, func() {
+		err = runTrend(&sharedOptions{format: formatJSON, output: output}, []string{filepath.Join(dir, "*.json")})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged, "skipped 2 incompatible files") || !strings.Contains(logged, "unsupported raw data version") {
+		t.Errorf("expected a warning about the skipped files, got %q", logged)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report TrendReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	// the runs are aligned by their time, not by the file names
+	expected := TrendReport{
+		Runs: []TrendRun{
+			{Source: filepath.Join(dir, "2-monday.json"), Created: monday, Changes: 1},
+			{Source: filepath.Join(dir, "1-tuesday.json"), Created: monday.Add(24 * time.Hour), Changes: 2, NewlyActive: []string{"openshift/origin"}, NewlyQuiet: []string{"openshift/api"}, NewAuthors: []string{"sttts"}},
+		},
+		Repositories: map[string][]int{api: {1, 0}, origin: {0, 2}},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	err = runTrend(&sharedOptions{format: formatJSON, output: output}, []string{filepath.Join(dir, "2-monday.json"), filepath.Join(dir, "3-future.json")})
+	if err != errNotEnoughRuns {
+		t.Errorf("expected an error with a single valid run, got %v", err)
+	}
+}
+
+func TestWriteTrendReportMarkdown(t *testing.T) {
+	report := TrendReport{
+		Runs: []TrendRun{
+			{Created: time.Date(2021, 8, 16, 8, 0, 0, 0, displayLocation), Changes: 1},
+			{Created: time.Date(2021, 8, 17, 8, 0, 0, 0, displayLocation), Changes: 2, NewlyActive: []string{"openshift/origin"}, NewAuthors: []string{"deads2k", "sttts"}},
+		},
+		Repositories: map[string][]int{"https://github.com/openshift/api": {1, 0}, "https://github.com/openshift/origin": {0, 2}},
+	}
+	var out bytes.Buffer
+	if err := writeTrendReport(&out, formatMarkdown, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"| Repository | 2021-08-16 08:00 | 2021-08-17 08:00 |",
+		"| openshift/api | 1 | 0 |",
+		"| Total | 1 | 2 |",
+		"| 2021-08-17 08:00 | openshift/origin |  | deads2k<br>sttts |",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in the output:\n%s", line, out.String())
+		}
+	}
+	if err := writeTrendReport(&out, formatJUnit, report); err == nil {
+		t.Errorf("expected the junit format to be rejected")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formatTriage renders the changes as GitHub Flavored Markdown task lists to claim and investigate after a regression
+const formatTriage = "triage"
+
+// triageItem is a change of the triage checklist.
+type triageItem struct {
+	raw RawChange
+	// lowRisk items are checked in advance (see lowRiskReason)
+	lowRisk bool
+	// notable items are ordered first, by the digest order (see digestReason)
+	notable        bool
+	reason, weight int
+}
+
+// lowRiskReason returns why the change is unlikely to cause a regression: it was committed by a bot or only
+// changes documentation (see -classify-paths), ok is false for the other changes.
+func lowRiskReason(raw RawChange) (string, bool) {
+	if isBot(raw.Author) {
+		return "bot", true
+	}
+	for _, class := range raw.PathClasses {
+		if class == "docs-only" {
+			return "docs only", true
+		}
+	}
+	return "", false
+}
+
+// triageOrder sorts the riskiest changes first: the notable ones by the digest order, then the others, then the
+// low-risk ones, the newest first within each.
+func triageOrder(changes []RawChange) []triageItem {
+	var items []triageItem
+	for _, c := range changes {
+		item := triageItem{raw: c}
+		_, item.lowRisk = lowRiskReason(c)
+		item.reason, item.weight, _, item.notable = digestReason(c)
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case a.lowRisk != b.lowRisk:
+			return b.lowRisk
+		case a.notable != b.notable:
+			return a.notable
+		case a.notable && a.reason != b.reason:
+			return a.reason < b.reason
+		case a.notable && a.weight != b.weight:
+			return a.weight > b.weight
+		}
+		return a.raw.Date.After(b.raw.Date)
+	})
+	return items
+}
+
+// triageWhen renders when the change merged relative to the payload (the cut) when known, eg. "3h before the
+// payload", otherwise relative to the run.
+func triageWhen(raw RawChange, durations Formatter) string {
+	if raw.PayloadOffset == nil {
+		return durations.Ago(raw.Date)
+	}
+	offset := time.Duration(*raw.PayloadOffset) * time.Second
+	if offset > 0 {
+		return durations.Duration(offset) + " after the payload"
+	}
+	return durations.Duration(offset) + " before the payload"
+}
+
+// triageLine renders "- [ ] openshift/api@abc1234 — subject (author, 3h before the payload)", the subject is
+// escaped so task list markers in it (eg. "- [ ]") don't nest.
+func triageLine(item triageItem, durations Formatter) string {
+	raw := item.raw
+	check := " "
+	if item.lowRisk {
+		check = "x"
+	}
+	details := []string{}
+	if len(raw.Author) > 0 {
+		details = append(details, markdownEscaper.Replace(raw.Author))
+	}
+	details = append(details, triageWhen(raw, durations))
+	if reason, ok := lowRiskReason(raw); ok {
+		details = append(details, "low risk: "+reason)
+	}
+	return fmt.Sprintf("- [%s] [%s@%s](%s) — %s (%s)", check, repositoryName(raw.Repository), shortSHA(raw.SHA), raw.URL, markdownEscaper.Replace(commitSubject(raw.Message)), strings.Join(details, ", "))
+}
+
+// writeTriageReport renders the changes of each repository as a task list, with the instructions and the query
+// in the header.
+func writeTriageReport(w io.Writer, report Report) error {
+	repositories := map[string][]RawChange{}
+	for _, c := range report.Changes {
+		repositories[c.raw.Repository] = append(repositories[c.raw.Repository], c.raw)
+	}
+	var names []string
+	for repository := range repositories {
+		names = append(names, repository)
+	}
+	sort.Strings(names)
+
+	durations := formatterOrNow(report.Durations)
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# Triage of %d changes", len(report.Changes))
+	if len(report.Payload) > 0 {
+		fmt.Fprintf(b, " in %s", report.Payload)
+	}
+	fmt.Fprintln(b)
+	fmt.Fprintln(b)
+	if len(report.Branch) > 0 {
+		fmt.Fprintf(b, "Changes merged to %s", report.Branch)
+		if report.Window != nil {
+			fmt.Fprintf(b, " since %s", formatTime(report.Window.Since))
+			if len(report.Window.PreviousPayload) > 0 {
+				fmt.Fprintf(b, " (%s)", report.Window.PreviousPayload)
+			}
+		}
+		fmt.Fprintln(b, ".")
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintln(b, "Claim a change by adding your name after it and check it once it is ruled out. The riskiest changes of each repository are listed first, changes checked in advance are low risk (bot commits, documentation only), uncheck them to investigate them.")
+	for _, repository := range names {
+		fmt.Fprintf(b, "\n## %s\n\n", repositoryName(repository))
+		for _, item := range triageOrder(repositories[repository]) {
+			fmt.Fprintln(b, triageLine(item, durations))
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintf(b, "\n> **Warning:** %s could not be processed (%s), its changes are missing.\n", repositoryName(e.Repository), e.Kind)
+	}
+	return b.Flush()
+}
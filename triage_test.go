@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriageReport(t *testing.T) {
+	start := time.Date(2021, 8, 18, 12, 0, 0, 0, time.UTC)
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	offset := int64(-3 * 3600)
+	change := func(repository, sha, author, message string, ago time.Duration) RawChange {
+		return RawChange{Repository: repository, SHA: sha, URL: repository + "/commit/" + sha, Author: author, Message: message, Date: start.Add(-ago)}
+	}
+	docs := change(api, "a1a1a1a1a1", "alice", "Document - [ ] items of the *checklist*\n\nDetails", time.Hour)
+	docs.PathClasses = []string{"docs-only"}
+	bump := change(api, "b2b2b2b2b2", "openshift-bot", "Bump dependencies", 2*time.Hour)
+	bump.PayloadOffset = &offset
+	cve := change(api, "c3c3c3c3c3", "bob", "Validate names (CVE-2021-1234)", 5*time.Hour)
+	var changes []Change
+	for _, raw := range []RawChange{
+		docs,
+		bump,
+		change(api, "d4d4d4d4d4", "alice", "Add the_field", 3*time.Hour),
+		cve,
+		change(api, "e5e5e5e5e5", "bob", `Revert "Add the field"`, 4*time.Hour),
+		change(oc, "f6f6f6f6f6", "carol", "Fix oc login | logout", 30*time.Minute),
+	} {
+		changes = append(changes, newChange(raw))
+	}
+	report := Report{
+		Changes:   changes,
+		Errors:    []RepositoryError{{Repository: "https://github.com/openshift/console", Kind: ErrorKindNotFound, Err: errors.New("404 Not Found")}},
+		Payload:   "4.9.0-0.nightly-2021-08-18-123456",
+		Branch:    "release-4.9",
+		Window:    &Window{Since: start.Add(-24 * time.Hour), PreviousPayload: "4.9.0-0.nightly-2021-08-17-123456"},
+		Durations: newFormatter(durationStyleCompact, start),
+	}
+	var out bytes.Buffer
+	if err := writeReport(&out, formatTriage, report); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "triage", "report.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(golden) {
+		t.Errorf("expected:\n%s\ngot:\n%s", golden, out.String())
+	}
+	// the task list marker of the subject is escaped, it does not nest a task in the item
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Count(line, "- [") > 1 {
+			t.Errorf("expected a single task per line, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/google/go-github/github"
+)
+
+// Verification is the Github verification of the commit signature, the reason is eg. "valid", "unsigned" or "unknown_key".
+type Verification struct {
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// commitVerification returns the verification returned with the commit, nil when the response doesn't have it.
+func commitVerification(c *github.RepositoryCommit) *Verification {
+	if c == nil || c.Commit == nil || c.Commit.Verification == nil {
+		return nil
+	}
+	return &Verification{
+		Verified: c.Commit.Verification.GetVerified(),
+		Reason:   c.Commit.Verification.GetReason(),
+	}
+}
+
+// showVerification fills the Verified column of the changes.
+func showVerification(changes []Change) {
+	for i := range changes {
+		changes[i].Verified = formatVerification(changes[i].raw.Verification)
+	}
+}
+
+func formatVerification(v *Verification) string {
+	switch {
+	case v == nil:
+		return "unknown"
+	case v.Verified:
+		return "yes"
+	case len(v.Reason) > 0:
+		return fmt.Sprintf("no (%s)", v.Reason)
+	default:
+		return "no"
+	}
+}
+
+// unverifiedFilter keeps only changes without a verified signature, including those with unknown verification.
+type unverifiedFilter struct{}
+
+func (unverifiedFilter) Name() string {
+	return "only-unverified"
+}
+
+func (unverifiedFilter) Keep(c Change) (bool, string) {
+	if c.raw.Verification != nil && c.raw.Verification.Verified {
+		return false, "signature is verified"
+	}
+	return true, ""
+}
+
+// printVerificationSummary prints the share of changes with verified signature in each repository.
+func printVerificationSummary(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	total, verified := map[string]int{}, map[string]int{}
+	for _, c := range changes {
+		total[c.raw.Repository]++
+		if c.raw.Verification != nil && c.raw.Verification.Verified {
+			verified[c.raw.Repository]++
+		}
+	}
+	var repositories []string
+	for repository := range total {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+	log.Printf("Verified signatures:")
+	for _, repository := range repositories {
+		log.Printf("  %s: %d%% (%d/%d)", repository, verified[repository]*100/total[repository], verified[repository], total[repository])
+	}
+}
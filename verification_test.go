@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeSignedGithub serves a verified commit, an unsigned one and one without the verification object.
+func fakeSignedGithub(t *testing.T) *github.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos/openshift/api":
+			fmt.Fprint(w, `{"name": "api", "fork": false}`)
+		case "/repos/openshift/api/branches/master":
+			fmt.Fprint(w, `{"name": "master"}`)
+		case "/repos/openshift/api/commits":
+			date := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			fmt.Fprintf(w, `[{"sha": "a1", "commit": {"message": "Signed", "committer": {"date": %[1]q}, "verification": {"verified": true, "reason": "valid"}}},
+				{"sha": "b2", "commit": {"message": "Unsigned", "committer": {"date": %[1]q}, "verification": {"verified": false, "reason": "unsigned"}}},
+				{"sha": "c3", "commit": {"message": "Unknown", "committer": {"date": %[1]q}}}]`, date)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestShowVerification(t *testing.T) {
+	query := &queryOptions{since: "1d", branch: "master", showVerification: true}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var result *queryResult
+	var out bytes.Buffer
+	output := captureLog(t, func() {
+		var err error
+		if result, err = query.collect(context.Background(), fakeSignedGithub(t), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := query.render(&out, formatJSON, result); err != nil {
+			t.Fatal(err)
+		}
+	})
+	verified := map[string]string{}
+	for _, c := range result.Changes {
+		verified[c.raw.Message] = c.Verified
+	}
+	if verified["Signed"] != "yes" || verified["Unsigned"] != "no (unsigned)" || verified["Unknown"] != "unknown" {
+		t.Errorf("unexpected Verified column %v", verified)
+	}
+	if !strings.Contains(output, "https://github.com/openshift/api: 33% (1/3)") {
+		t.Errorf("expected the share of verified changes, got:\n%s", output)
+	}
+
+	// the JSON output has the reason, the verification is left out when the response doesn't have it
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]*Verification{}
+	for _, c := range report.Changes {
+		reasons[c.Message] = c.Verification
+	}
+	if v := reasons["Unsigned"]; v == nil || v.Verified || v.Reason != "unsigned" {
+		t.Errorf("expected the unsigned reason, got %+v", v)
+	}
+	if reasons["Unknown"] != nil {
+		t.Errorf("expected no verification, got %+v", reasons["Unknown"])
+	}
+}
+
+func TestOnlyUnverified(t *testing.T) {
+	query := &queryOptions{since: "1d", branch: "master", onlyUnverified: true}
+	if err := query.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var table string
+	captureLog(t, func() {
+		var err error
+		if table, err = runTestQuery(t, fakeSignedGithub(t), query, []string{"https://github.com/openshift/api"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// the unknown verification is not a valid signature either, -only-unverified implies the column
+	if strings.Contains(table, "Signed") || !strings.Contains(table, "Unsigned") || !strings.Contains(table, "Unknown") || !strings.Contains(table, "VERIFIED") {
+		t.Errorf("expected only the unverified changes with the Verified column, got:\n%s", table)
+	}
+
+	// without the flags, nothing about the verification is shown
+	captureLog(t, func() {
+		var err error
+		if table, err = runTestQuery(t, fakeSignedGithub(t), &queryOptions{since: "1d", branch: "master"}, []string{"https://github.com/openshift/api"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if strings.Contains(table, "VERIFIED") {
+		t.Errorf("expected the Verified column to be hidden, got:\n%s", table)
+	}
+}
+
+func TestCommitVerification(t *testing.T) {
+	for _, c := range []*github.RepositoryCommit{nil, {}, {Commit: &github.Commit{}}} {
+		if v := commitVerification(c); v != nil {
+			t.Errorf("expected no verification of %+v, got %+v", c, v)
+		}
+	}
+	c := &github.RepositoryCommit{Commit: &github.Commit{Verification: &github.SignatureVerification{Verified: github.Bool(false), Reason: github.String("unknown_key")}}}
+	if v := commitVerification(c); v == nil || v.Verified || formatVerification(v) != "no (unknown_key)" {
+		t.Errorf("unexpected verification %+v", v)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// buildVersionsAnnotation lists versions of components in the image (eg. "kubernetes=1.22.1,kubernetes-tests=1.22.1")
+const buildVersionsAnnotation = "io.openshift.build.versions"
+
+// VersionRegression is a component whose version went backwards between two payloads.
+type VersionRegression struct {
+	Tag       string `header:"Image" json:"tag"`
+	Component string `header:"Component" json:"component"`
+	From      string `header:"From" json:"from"`
+	To        string `header:"To" json:"to"`
+}
+
+// parseBuildVersions parses the comma separated key=value pairs, malformed pairs are skipped.
+func parseBuildVersions(value string) map[string]string {
+	versions := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, version := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(key) == 0 || len(version) == 0 {
+			continue
+		}
+		versions[key] = version
+	}
+	return versions
+}
+
+// Versions returns the component versions of the image, nil when the image does not carry them.
+func (t Tag) Versions() map[string]string {
+	value, ok := t.Annotations[buildVersionsAnnotation]
+	if !ok {
+		return nil
+	}
+	return parseBuildVersions(value)
+}
+
+// TagVersions returns component versions of each image carrying them.
+func (r *Release) TagVersions() map[string]map[string]string {
+	result := map[string]map[string]string{}
+	for _, t := range r.Refs.Spec.Tags {
+		if versions := t.Versions(); len(versions) > 0 {
+			result[t.Name] = versions
+		}
+	}
+	return result
+}
+
+// RepositoryVersions returns component versions of all images built from each repository.
+func (r *Release) RepositoryVersions(sourceAnnotations []string) map[string]map[string]string {
+	result := map[string]map[string]string{}
+	for _, t := range r.Refs.Spec.Tags {
+		repository, _, _, ok := t.Source(sourceAnnotations)
+		versions := t.Versions()
+		if !ok || len(versions) == 0 {
+			continue
+		}
+		if result[repository] == nil {
+			result[repository] = map[string]string{}
+		}
+		for k, v := range versions {
+			result[repository][k] = v
+		}
+	}
+	return result
+}
+
+// versionFields splits the version for comparison, the build metadata (eg. "+build.1") and any description
+// following the version (eg. "49.84.202108041519-0 Red Hat Enterprise Linux CoreOS") are ignored.
+func versionFields(version string) []string {
+	if fields := strings.Fields(version); len(fields) > 0 {
+		version = fields[0]
+	}
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	version = strings.TrimPrefix(version, "v")
+	return strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '-' })
+}
+
+// compareVersions returns a negative number when a is older than b, zero when they are equal and a positive
+// number when a is newer. Numeric fields are compared as numbers, others as strings.
+func compareVersions(a, b string) int {
+	fa, fb := versionFields(a), versionFields(b)
+	for i := 0; i < len(fa) && i < len(fb); i++ {
+		na, errA := strconv.Atoi(fa[i])
+		nb, errB := strconv.Atoi(fb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return na - nb
+		case (errA != nil || errB != nil) && fa[i] != fb[i]:
+			return strings.Compare(fa[i], fb[i])
+		}
+	}
+	return len(fa) - len(fb)
+}
+
+// findVersionRegressions returns components of images in both payloads with older version in the to payload.
+func findVersionRegressions(from, to *Release) []VersionRegression {
+	fromVersions := from.TagVersions()
+	var regressions []VersionRegression
+	for tag, versions := range to.TagVersions() {
+		for component, version := range versions {
+			previous, ok := fromVersions[tag][component]
+			if ok && compareVersions(version, previous) < 0 {
+				regressions = append(regressions, VersionRegression{Tag: tag, Component: component, From: previous, To: version})
+			}
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		if regressions[i].Tag != regressions[j].Tag {
+			return regressions[i].Tag < regressions[j].Tag
+		}
+		return regressions[i].Component < regressions[j].Component
+	})
+	return regressions
+}
+
+func formatVersions(versions map[string]string) string {
+	var r []string
+	for k, v := range versions {
+		r = append(r, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(r)
+	return strings.Join(r, "\n")
+}
+
+// annotateVersions sets component versions of the repository images on the changes.
+func annotateVersions(changes []Change, versions map[string]map[string]string) []Change {
+	for i := range changes {
+		raw := changes[i].raw
+		raw.Versions = versions[raw.Repository]
+		changes[i] = newChange(raw)
+	}
+	return changes
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBuildVersions(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[string]string
+	}{
+		{value: "kubernetes=1.22.1", expected: map[string]string{"kubernetes": "1.22.1"}},
+		{value: "kubernetes=1.22.1, kubernetes-tests=1.22.1", expected: map[string]string{"kubernetes": "1.22.1", "kubernetes-tests": "1.22.1"}},
+		{value: "machine-os=49.84.202108041519-0 Red Hat Enterprise Linux CoreOS", expected: map[string]string{"machine-os": "49.84.202108041519-0 Red Hat Enterprise Linux CoreOS"}},
+		{value: "etcd=3.5.0+build.7", expected: map[string]string{"etcd": "3.5.0+build.7"}},
+		{value: "kubernetes,=1.0,etcd=,oc=4.9.0", expected: map[string]string{"oc": "4.9.0"}},
+		{value: "", expected: map[string]string{}},
+	}
+	for _, test := range tests {
+		if versions := parseBuildVersions(test.value); !reflect.DeepEqual(versions, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, versions)
+		}
+	}
+	if versions := (Tag{Name: "cli"}).Versions(); versions != nil {
+		t.Errorf("expected no versions without the annotation, got %v", versions)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "1.22.1", b: "1.22.1", expected: 0},
+		{a: "1.22.1", b: "1.22.0", expected: 1},
+		{a: "1.9.0", b: "1.22.0", expected: -1},
+		{a: "v1.22.1", b: "1.22.1", expected: 0},
+		{a: "3.5.0+build.7", b: "3.5.0+build.9", expected: 0},
+		{a: "49.84.202108041519-0 Red Hat Enterprise Linux CoreOS", b: "49.84.202108101520-0 Red Hat Enterprise Linux CoreOS", expected: -1},
+		{a: "1.22.1", b: "1.22", expected: 1},
+		{a: "1.22.0-rc.1", b: "1.22.0-beta.2", expected: 1},
+	}
+	for _, test := range tests {
+		result := compareVersions(test.a, test.b)
+		if (result < 0 && test.expected >= 0) || (result > 0 && test.expected <= 0) || (result == 0 && test.expected != 0) {
+			t.Errorf("%q vs %q: expected %d, got %d", test.a, test.b, test.expected, result)
+		}
+	}
+}
+
+func versionsTag(name, repository, versions string) Tag {
+	tag := payloadTag(name, repository, "a1", "quay.io/ocp@sha256:1")
+	if len(versions) > 0 {
+		tag.Annotations[buildVersionsAnnotation] = versions
+	}
+	return tag
+}
+
+func TestVersionRegressions(t *testing.T) {
+	from := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{
+		versionsTag("hyperkube", "https://github.com/openshift/kubernetes", "kubernetes=1.22.1,kubernetes-tests=1.22.1"),
+		versionsTag("machine-os-content", "https://github.com/openshift/os", "machine-os=49.84.202108101520-0 Red Hat Enterprise Linux CoreOS"),
+		versionsTag("etcd", "https://github.com/openshift/etcd", "etcd=3.5.0"),
+	}}}}
+	to := &Release{Refs: References{Spec: ReferencesSpec{Tags: []Tag{
+		versionsTag("hyperkube", "https://github.com/openshift/kubernetes", "kubernetes=1.22.0,kubernetes-tests=1.22.2"),
+		versionsTag("machine-os-content", "https://github.com/openshift/os", "machine-os=49.84.202108041519-0 Red Hat Enterprise Linux CoreOS"),
+		versionsTag("etcd", "https://github.com/openshift/etcd", ""),
+		versionsTag("cli", "https://github.com/openshift/oc", "oc=4.9.0"),
+	}}}}
+	expected := []VersionRegression{
+		{Tag: "hyperkube", Component: "kubernetes", From: "1.22.1", To: "1.22.0"},
+		{Tag: "machine-os-content", Component: "machine-os", From: "49.84.202108101520-0 Red Hat Enterprise Linux CoreOS", To: "49.84.202108041519-0 Red Hat Enterprise Linux CoreOS"},
+	}
+	regressions := findVersionRegressions(from, to)
+	if !reflect.DeepEqual(regressions, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, regressions)
+	}
+
+	changes := annotateVersions([]Change{newChange(RawChange{Repository: "https://github.com/openshift/kubernetes", Message: "Bump to 1.22.0"})}, to.RepositoryVersions(defaultSourceAnnotations))
+	if changes[0].Versions != "kubernetes-tests=1.22.2\nkubernetes=1.22.0" {
+		t.Errorf("expected the versions of the repository, got %q", changes[0].Versions)
+	}
+
+	query := &compareOptions{}
+	result := &queryResult{Changes: changes, Regressions: regressions, Versions: to.TagVersions()}
+	var out bytes.Buffer
+	if err := query.render(&out, formatTable, result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "WARNING: component versions went backwards:") || !strings.Contains(out.String(), "1.22.0") {
+		t.Errorf("expected the regressions first in the output:\n%s", out.String())
+	}
+	out.Reset()
+	if err := query.render(&out, formatJSON, result); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Regressions, expected) || report.Versions["cli"]["oc"] != "4.9.0" || report.Changes[0].Versions["kubernetes"] != "1.22.0" {
+		t.Errorf("expected the regressions and versions in the JSON output, got %+v", report)
+	}
+}
+
+func TestCompareVersionsRequirePayloads(t *testing.T) {
+	query := &compareOptions{fromBranch: "release-4.9", toBranch: "master", failOnVersionRegression: true}
+	if err := query.validate(); err == nil || !strings.Contains(err.Error(), "require -from/-to payloads") {
+		t.Errorf("expected the version flags to require payloads, got %v", err)
+	}
+}
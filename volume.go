@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultVolumeThreshold is the number of changes of a repository in the window above which -volume-alert warns
+	defaultVolumeThreshold = 20
+	// exitCodeVolumeAlert is returned by -fail-on-volume-alert when any repository exceeds its threshold
+	exitCodeVolumeAlert = 5
+	// maxVolumeAuthors is the number of top authors listed for each alert
+	maxVolumeAuthors = 3
+)
+
+// readVolumeThresholds reads the -volume-thresholds file, overriding the threshold of repositories (ORG/NAME):
+//
+//	thresholds:
+//	  openshift/origin: 60
+func readVolumeThresholds(file string) (map[string]int, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var document struct {
+		Thresholds map[string]int `yaml:"thresholds"`
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	thresholds := map[string]int{}
+	for repository, threshold := range document.Thresholds {
+		if threshold <= 0 {
+			return nil, fmt.Errorf("%s: threshold of %s must be positive, got %d", file, repository, threshold)
+		}
+		thresholds[repositoryName(strings.TrimSuffix(repository, "/"))] = threshold
+	}
+	return thresholds, nil
+}
+
+// AuthorCount is the number of changes of an author.
+type AuthorCount struct {
+	Author  string `json:"author"`
+	Commits int    `json:"commits"`
+}
+
+// repositoryVolume is the number of changes of a repository, by author.
+type repositoryVolume struct {
+	Commits int
+	Authors map[string]int
+}
+
+// repositoryVolumes counts the changes of each repository (ORG/NAME), bot changes are left out unless includeBots
+// is set.
+func repositoryVolumes(changes []Change, includeBots bool) map[string]*repositoryVolume {
+	volumes := map[string]*repositoryVolume{}
+	for _, c := range changes {
+		if !includeBots && isBot(c.raw.Author) {
+			continue
+		}
+		repository := repositoryName(c.raw.Repository)
+		v, ok := volumes[repository]
+		if !ok {
+			v = &repositoryVolume{Authors: map[string]int{}}
+			volumes[repository] = v
+		}
+		author := c.raw.Author
+		if len(author) == 0 {
+			author = unknownAuthor
+		}
+		v.Commits++
+		v.Authors[author]++
+	}
+	return volumes
+}
+
+// VolumeAlert is a repository with more changes in the window than its threshold.
+type VolumeAlert struct {
+	Repository string        `header:"Repository" json:"repository"`
+	Commits    int           `header:"Changes" json:"commits"`
+	Threshold  int           `header:"Threshold" json:"threshold"`
+	Authors    string        `header:"Top authors" json:"-"`
+	TopAuthors []AuthorCount `json:"topAuthors"`
+}
+
+// volumeAlerts returns the repositories whose volume exceeds their threshold (the default one unless overridden),
+// the most changes first, with their top authors.
+func volumeAlerts(volumes map[string]*repositoryVolume, threshold int, overrides map[string]int) []VolumeAlert {
+	alerts := []VolumeAlert{}
+	for repository, v := range volumes {
+		limit := threshold
+		if override, ok := overrides[repository]; ok {
+			limit = override
+		}
+		if v.Commits <= limit {
+			continue
+		}
+		alert := VolumeAlert{Repository: repository, Commits: v.Commits, Threshold: limit}
+		for author, commits := range v.Authors {
+			alert.TopAuthors = append(alert.TopAuthors, AuthorCount{Author: author, Commits: commits})
+		}
+		sort.Slice(alert.TopAuthors, func(i, j int) bool {
+			if alert.TopAuthors[i].Commits != alert.TopAuthors[j].Commits {
+				return alert.TopAuthors[i].Commits > alert.TopAuthors[j].Commits
+			}
+			return alert.TopAuthors[i].Author < alert.TopAuthors[j].Author
+		})
+		if len(alert.TopAuthors) > maxVolumeAuthors {
+			alert.TopAuthors = alert.TopAuthors[:maxVolumeAuthors]
+		}
+		var authors []string
+		for _, a := range alert.TopAuthors {
+			authors = append(authors, fmt.Sprintf("%s (%d)", a.Author, a.Commits))
+		}
+		alert.Authors = strings.Join(authors, ", ")
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Commits != alerts[j].Commits {
+			return alerts[i].Commits > alerts[j].Commits
+		}
+		return alerts[i].Repository < alerts[j].Repository
+	})
+	return alerts
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadVolumeThresholds(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "thresholds.yaml")
+	if err := ioutil.WriteFile(file, []byte("thresholds:\n  openshift/origin: 60\n  https://github.com/openshift/api/: 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	thresholds, err := readVolumeThresholds(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int{"openshift/origin": 60, "openshift/api": 5}; !reflect.DeepEqual(thresholds, expected) {
+		t.Errorf("expected %v, got %v", expected, thresholds)
+	}
+	if err := ioutil.WriteFile(file, []byte("thresholds:\n  openshift/origin: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readVolumeThresholds(file); err == nil || !strings.Contains(err.Error(), "threshold of openshift/origin must be positive") {
+		t.Errorf("expected a threshold that is not positive to fail, got %v", err)
+	}
+	if _, err := readVolumeThresholds(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected a missing file to fail")
+	}
+}
+
+func TestVolumeAlerts(t *testing.T) {
+	var changes []Change
+	add := func(repository, author string, count int) {
+		for i := 0; i < count; i++ {
+			changes = append(changes, newChange(RawChange{Repository: "https://github.com/openshift/" + repository, Author: author}))
+		}
+	}
+	add("api", "mfojtik", 3)
+	add("api", "deads2k", 2)
+	add("api", "soltysh", 1)
+	add("api", "sttts", 1)
+	add("api", "openshift-bot", 10)
+	add("oc", "", 4)
+	add("origin", "soltysh", 6)
+
+	volumes := repositoryVolumes(changes, false)
+	if volumes["openshift/api"].Commits != 7 || volumes["openshift/oc"].Authors[unknownAuthor] != 4 {
+		t.Errorf("expected the bot changes left out, got %+v %+v", volumes["openshift/api"], volumes["openshift/oc"])
+	}
+	alerts := volumeAlerts(volumes, 5, map[string]int{"openshift/origin": 10})
+	if len(alerts) != 1 || alerts[0].Repository != "openshift/api" || alerts[0].Threshold != 5 {
+		t.Fatalf("expected only openshift/api over its threshold, got %+v", alerts)
+	}
+	if alerts[0].Authors != "mfojtik (3), deads2k (2), soltysh (1)" {
+		t.Errorf("expected the top %d authors, got %q", maxVolumeAuthors, alerts[0].Authors)
+	}
+
+	// the bot changes count with -volume-alert-include-bots
+	alerts = volumeAlerts(repositoryVolumes(changes, true), 5, nil)
+	if len(alerts) != 2 || alerts[0].Repository != "openshift/api" || alerts[0].Commits != 17 || alerts[0].TopAuthors[0].Author != "openshift-bot" || alerts[1].Repository != "openshift/origin" {
+		t.Errorf("expected the most changes first, got %+v", alerts)
+	}
+	if alerts := volumeAlerts(repositoryVolumes(nil, false), 5, nil); alerts == nil || len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %#v", alerts)
+	}
+}
+
+func TestVolumeAlertQuery(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		query := &queryOptions{since: "1d", branch: "master", noBranchCheck: true, volumeAlert: true, volumeThreshold: 2, failOnVolumeAlert: fail}
+		if err := query.validate(); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		var result *queryResult
+		captureLog(t, func() {
+			var err error
+			if result, err = query.collect(context.Background(), fakeCappedGithub(t, map[string]int{"api": 3, "oc": 1}), &sharedOptions{concurrency: 1, skipTokenCheck: true}, []string{"https://github.com/openshift/api", "https://github.com/openshift/oc"}, NewCache()); err != nil {
+				t.Fatal(err)
+			}
+			if err := query.render(&out, formatTable, result); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if table := out.String(); !strings.Contains(table, "WARNING: 1 repositories merged more changes than their threshold") || !strings.Contains(table, "unknown author (3)") {
+			t.Errorf("expected the alert of openshift/api, got:\n%s", table)
+		}
+		exitErr, ok := result.Failed.(*exitError)
+		if failed := result.Failed != nil; failed != fail || fail && (!ok || exitErr.code != exitCodeVolumeAlert) {
+			t.Errorf("fail-on-volume-alert %v: unexpected result %v", fail, result.Failed)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeReport(&out, formatJSON, Report{VolumeAlerts: []VolumeAlert{{Repository: "openshift/api", Commits: 3, Threshold: 2, Authors: "mfojtik (3)", TopAuthors: []AuthorCount{{Author: "mfojtik", Commits: 3}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if report := out.String(); !strings.Contains(report, `"volumeAlerts": [`) || !strings.Contains(report, `"topAuthors": [`) || strings.Contains(report, "mfojtik (3)") {
+		t.Errorf("expected the alerts in the metadata, got:\n%s", report)
+	}
+}
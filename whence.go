@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/lensesio/tableprinter"
+	"github.com/xxjwxc/gowp/workpool"
+)
+
+// defaultMaxProbeRepos bounds the commit requests of a SHA not found in the local state
+const defaultMaxProbeRepos = 250
+
+// Statuses of a looked up SHA
+const (
+	whenceFound     = "found"
+	whenceNotFound  = "not found"
+	whenceAmbiguous = "ambiguous"
+	whenceError     = "error"
+)
+
+var hexSHA = regexp.MustCompile(`^[0-9a-f]+$`)
+
+type whenceOptions struct {
+	payload       string
+	raw           stringList
+	branches      commaSeparatedList
+	maxProbeRepos int
+}
+
+func (o *whenceOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.payload, "payload", defaultPayloadFlag(), "Payload whose repositories are searched, the commits are checked for being included in it")
+	fs.Var(&o.raw, "raw", "Raw data file saved via 'collect -save-raw' to search before asking Github (can be repeated)")
+	o.branches = commaSeparatedList{"master"}
+	fs.Var(&o.branches, "branches", "Comma separated list of branches to check for containing the commits")
+	fs.IntVar(&o.maxProbeRepos, "max-probe-repos", defaultMaxProbeRepos, "Ask Github for the commit in at most this number of payload repositories per SHA not found in the -raw files or the -cache (0 means no limit)")
+}
+
+// WhenceResult is where a looked up SHA comes from.
+type WhenceResult struct {
+	// SHA is the looked up SHA, Commit the full SHA it matched
+	SHA    string `json:"sha"`
+	Status string `json:"status"`
+	Commit string `json:"commit,omitempty"`
+
+	Repository  string     `json:"repository,omitempty"`
+	Subject     string     `json:"subject,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+	PullRequest int        `json:"pullRequest,omitempty"`
+	// Branches are the -branches containing the commit
+	Branches []string `json:"branches,omitempty"`
+	// InPayload is whether the payload was built from the commit or a descendant, nil when unknown or the repository is not in it
+	InPayload *bool `json:"inPayload,omitempty"`
+	// Source is the -raw file, "cache" or "github"
+	Source string `json:"source,omitempty"`
+	// Candidates are the commits (ORG/NAME@SHA) an ambiguous prefix matches
+	Candidates []string `json:"candidates,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// WhenceRow is a row of the whence table.
+type WhenceRow struct {
+	SHA         string `header:"SHA"`
+	Repository  string `header:"Repository"`
+	Subject     string `header:"Subject"`
+	Author      string `header:"Author"`
+	Date        string `header:"Date"`
+	PullRequest string `header:"PR"`
+	Branches    string `header:"Branches"`
+	InPayload   string `header:"In payload"`
+	Source      string `header:"Source"`
+}
+
+func newWhenceCommand() *command {
+	cmd := newCommand("whence", "Find the payload repository, pull request and branches of commit SHAs", `
+The commits are searched in the -raw files and the -cache first, then in the payload repositories one commit request
+per repository (up to -max-probe-repos), stopping at the first repository that has the commit.
+
+Examples:
+  # where does the commit from a stack trace come from, and is it in the payload
+  ocp-what-merged whence -payload quay.io/openshift-release-dev/ocp-release:4.9.0-x86_64 276e9d4
+
+  # search saved runs first and check release branches
+  ocp-what-merged whence -raw today.json -branches master,release-4.9 276e9d4 1469b05
+`)
+	shared := &sharedOptions{}
+	options := &whenceOptions{}
+	shared.addFlags(cmd.flags)
+	options.addFlags(cmd.flags)
+	cmd.run = func(ctx context.Context, args []string) error {
+		return runWhence(ctx, shared, options, args)
+	}
+	return cmd
+}
+
+// validateWhenceSHA accepts SHAs and their prefixes of at least minimumSHALength hex characters.
+func validateWhenceSHA(sha string) error {
+	if len(sha) < minimumSHALength || len(sha) > 40 || !hexSHA.MatchString(sha) {
+		return fmt.Errorf("commit SHA %q is not valid, %d to 40 lower case hex characters are required", sha, minimumSHALength)
+	}
+	return nil
+}
+
+// whenceLocal searches the SHA in the raw data and the cache, the result is ambiguous when the prefix matches
+// several commits. ok is false when the SHA is in neither.
+func whenceLocal(sha string, raw map[string]*RawData, cache *Cache) (WhenceResult, bool) {
+	matches := map[string]WhenceResult{}
+	var paths []string
+	for path := range raw {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, r := range raw[path].Repositories {
+			for _, c := range r.Changes {
+				if !strings.HasPrefix(c.SHA, sha) {
+					continue
+				}
+				key := repositoryName(c.Repository) + "@" + c.SHA
+				if _, ok := matches[key]; ok {
+					continue
+				}
+				date := c.Date
+				matches[key] = WhenceResult{SHA: sha, Status: whenceFound, Commit: c.SHA, Repository: c.Repository, Subject: commitSubject(c.Message), Author: c.Author, Date: &date, PullRequest: c.PullRequest, Source: path}
+			}
+		}
+	}
+	for repository, c := range cache.findCommits(sha) {
+		key := repository + "@" + c.GetSHA()
+		if _, ok := matches[key]; ok {
+			continue
+		}
+		date := commitDate(c)
+		matches[key] = WhenceResult{SHA: sha, Status: whenceFound, Commit: c.GetSHA(), Repository: "https://github.com/" + repository, Subject: commitSubject(c.GetCommit().GetMessage()), Author: commitAuthor(c), Date: &date, Source: "cache"}
+	}
+	switch len(matches) {
+	case 0:
+		return WhenceResult{}, false
+	case 1:
+		for _, result := range matches {
+			return result, true
+		}
+	}
+	result := WhenceResult{SHA: sha, Status: whenceAmbiguous}
+	for key := range matches {
+		result.Candidates = append(result.Candidates, key)
+	}
+	sort.Strings(result.Candidates)
+	return result, true
+}
+
+// probeCommit asks the repositories for the commit in parallel, stopping at the first one that has it as SHAs are
+// effectively unique. Repositories failing with other errors than a missing commit are returned as errors, an
+// ambiguous prefix is ambiguous within a repository only.
+func probeCommit(ctx context.Context, client *github.Client, repositories []string, sha string, concurrency int) (WhenceResult, []RepositoryError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		lock   sync.Mutex
+		result = WhenceResult{SHA: sha, Status: whenceNotFound}
+		errs   []RepositoryError
+	)
+	wp := workpool.New(concurrency)
+	for i := range repositories {
+		repository := repositories[i]
+		wp.Do(func() error {
+			organization, name, ok := parseRepositoryOrgName(repository)
+			if !ok || ctx.Err() != nil {
+				return nil
+			}
+			c, _, err := client.Repositories.GetCommit(withCategory(ctx, categoryCommitProbe), organization, name, sha)
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case ctx.Err() != nil:
+			case err == nil:
+				date := commitDate(c)
+				result = WhenceResult{SHA: sha, Status: whenceFound, Commit: c.GetSHA(), Repository: repository, Subject: commitSubject(c.GetCommit().GetMessage()), Author: commitAuthor(c), Date: &date, Source: "github"}
+				cancel()
+			// Github responds 422 to SHAs unknown to the repository, 404 to unknown repositories
+			case isNotFound(err) || responseStatus(err) == http.StatusUnprocessableEntity:
+			default:
+				errs = append(errs, RepositoryError{Repository: repository, Kind: classifyRepositoryError(organization, err), Err: err})
+			}
+			return nil
+		})
+	}
+	wp.Wait()
+	return result, errs
+}
+
+// commitContained is whether the ref (a branch or a commit) contains the commit, false when the ref is missing.
+func commitContained(ctx context.Context, client *github.Client, organization, name, commit, ref string) (bool, error) {
+	comparison, _, err := client.Repositories.CompareCommits(withCategory(ctx, categoryCompare), organization, name, commit, ref)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	status := comparison.GetStatus()
+	return status == "ahead" || status == "identical", nil
+}
+
+// whenceDetails adds the pull request, the branches containing the commit and whether the payload has it.
+func whenceDetails(ctx context.Context, client *github.Client, result *WhenceResult, branches []string, payloadCommits []PayloadCommit) {
+	organization, name, ok := parseRepositoryOrgName(result.Repository)
+	if !ok {
+		return
+	}
+	if result.PullRequest == 0 {
+		pull, err := getCommitPullRequest(ctx, client, organization, name, result.Commit, branches[0])
+		if err != nil {
+			log.Printf("[%s] unable to find pull request for %s: %v", result.Repository, result.Commit, err)
+		}
+		result.PullRequest = pull.GetNumber()
+	}
+	for _, branch := range branches {
+		contained, err := commitContained(ctx, client, organization, name, result.Commit, branch)
+		if err != nil {
+			log.Printf("[%s] unable to check whether %s contains %s: %v", result.Repository, branch, result.Commit, err)
+			continue
+		}
+		if contained {
+			result.Branches = append(result.Branches, branch)
+		}
+	}
+	// payloads built from several commits of the repository include it when any of them does (see -multi-sha)
+	for _, c := range payloadCommits {
+		contained, err := commitContained(ctx, client, organization, name, result.Commit, c.Commit)
+		if err != nil {
+			log.Printf("[%s] unable to check whether the payload commit %s contains %s: %v", result.Repository, shortSHA(c.Commit), result.Commit, err)
+			return
+		}
+		result.InPayload = &contained
+		if contained {
+			return
+		}
+	}
+}
+
+func (r WhenceResult) row() WhenceRow {
+	row := WhenceRow{SHA: r.SHA, Repository: repositoryName(r.Repository), Subject: r.Subject, Author: r.Author, Branches: strings.Join(r.Branches, ", "), Source: r.Source}
+	switch r.Status {
+	case whenceFound:
+		row.SHA = shortSHA(r.Commit)
+	case whenceAmbiguous:
+		row.Subject = "AMBIGUOUS: " + strings.Join(r.Candidates, ", ")
+	case whenceError:
+		row.Subject = "ERROR: " + r.Error
+	default:
+		row.Subject = "NOT FOUND"
+	}
+	if r.Date != nil {
+		row.Date = formatTime(*r.Date)
+	}
+	if r.PullRequest > 0 {
+		row.PullRequest = fmt.Sprintf("#%d", r.PullRequest)
+	}
+	if r.InPayload != nil {
+		row.InPayload = "no"
+		if *r.InPayload {
+			row.InPayload = "yes"
+		}
+	}
+	return row
+}
+
+func writeWhenceReport(w io.Writer, format string, results []WhenceResult) error {
+	switch format {
+	case formatTable:
+		var rows []WhenceRow
+		for _, r := range results {
+			rows = append(rows, r.row())
+		}
+		tableprinter.New(w).Print(rows)
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	default:
+		return fmt.Errorf("unknown output format %q, whence supports %s and %s", format, formatTable, formatJSON)
+	}
+}
+
+func runWhence(ctx context.Context, shared *sharedOptions, o *whenceOptions, shas []string) error {
+	if len(shas) == 0 {
+		return fmt.Errorf("at least one commit SHA must be given")
+	}
+	for _, sha := range shas {
+		if err := validateWhenceSHA(sha); err != nil {
+			return err
+		}
+	}
+	if len(o.branches) == 0 {
+		return fmt.Errorf("-branches must not be empty")
+	}
+	raw := map[string]*RawData{}
+	for _, path := range o.raw {
+		data, err := readRawData(path)
+		if err != nil {
+			return err
+		}
+		raw[path] = data
+	}
+	payload, err := resolvePayload(o.payload)
+	if err != nil {
+		return err
+	}
+	release, err := getReleaseInfo(payload)
+	if err != nil {
+		return err
+	}
+	repositories, _, _ := release.Repositories(shared.sourceAnnotations)
+	payloadCommits := release.RepositoryCommits(shared.sourceAnnotations)
+	cache, err := shared.loadCache()
+	if err != nil {
+		return err
+	}
+	client, err := shared.githubClient()
+	if err != nil {
+		return err
+	}
+	if err := shared.checkToken(ctx, client, repositories); err != nil {
+		return err
+	}
+
+	probed := repositories
+	if o.maxProbeRepos > 0 && len(probed) > o.maxProbeRepos {
+		log.Printf("WARNING: the payload has %d repositories, SHAs not found locally are searched in the first %d only (see -max-probe-repos)", len(probed), o.maxProbeRepos)
+		probed = probed[:o.maxProbeRepos]
+	}
+	var results []WhenceResult
+	failed := 0
+	for _, sha := range shas {
+		result, ok := whenceLocal(sha, raw, cache)
+		if !ok {
+			log.Printf("Searching %s in %d repositories ...", sha, len(probed))
+			var errs []RepositoryError
+			result, errs = probeCommit(ctx, client, probed, sha, shared.concurrency)
+			if result.Status == whenceNotFound && len(errs) > 0 {
+				// the commit may be in one of the failed repositories
+				printErrorSummary(errs)
+				result.Status, result.Error = whenceError, fmt.Sprintf("not found, but %d repositories could not be searched", len(errs))
+			}
+		}
+		if result.Status == whenceFound {
+			whenceDetails(ctx, client, &result, o.branches, payloadCommits[result.Repository])
+		} else {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	out, err := shared.openOutput()
+	if err != nil {
+		return err
+	}
+	if err := writeWhenceReport(out, shared.format, results); err != nil {
+		return err
+	}
+	shared.printAPIUsage()
+	if err := shared.finishHAR(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commits were not found", failed, len(shas))
+	}
+	return nil
+}
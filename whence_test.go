@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	whenceSHA     = "276e9d4d8e1c3f1b4c6d3d6f0b9a7e1c2d3f4a5b"
+	whenceUnknown = "1469b05"
+)
+
+// fakeWhenceGithub serves openshift/oc with the whenceSHA commit merged by pull request 880 and contained by master
+// only, openshift/api without it and openshift/console failing.
+func fakeWhenceGithub(t *testing.T) (*fakeGithub, *github.Client) {
+	missing := json.RawMessage(`{"message": "No commit found for SHA: 1469b05", "documentation_url": "https://docs.github.com/rest/commits/commits#get-a-commit"}`)
+	fake := newFakeGithub(t, []fakeRoute{
+		{Method: http.MethodGet, Path: "/repos/openshift/api/commits/" + whenceSHA[:7], Status: http.StatusUnprocessableEntity, Body: missing},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/commits/" + whenceSHA[:7], Body: fakeBody(t, fakeCommit(whenceSHA, time.Date(2021, 8, 17, 10, 0, 0, 0, time.UTC)))},
+		{Method: http.MethodGet, Path: "/repos/openshift/console/commits/" + whenceSHA[:7], Status: http.StatusBadGateway, Body: json.RawMessage(`{"message": "Server Error"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/api/commits/" + whenceUnknown, Status: http.StatusUnprocessableEntity, Body: missing},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/commits/" + whenceUnknown, Status: http.StatusUnprocessableEntity, Body: missing},
+		{Method: http.MethodGet, Path: "/repos/openshift/console/commits/" + whenceUnknown, Status: http.StatusBadGateway, Body: json.RawMessage(`{"message": "Server Error"}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/commits/" + whenceSHA + "/pulls", Body: json.RawMessage(`[{"number": 880, "base": {"ref": "master"}, "merged_at": "2021-08-17T10:00:00Z"}]`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/compare/" + whenceSHA + "...master", Body: json.RawMessage(`{"status": "ahead", "ahead_by": 3}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/compare/" + whenceSHA + "...release-4.9", Body: json.RawMessage(`{"status": "diverged", "ahead_by": 1, "behind_by": 2}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/compare/" + whenceSHA + "...cccccccc", Body: json.RawMessage(`{"status": "behind", "behind_by": 1}`)},
+		{Method: http.MethodGet, Path: "/repos/openshift/oc/compare/" + whenceSHA + "...dddddddd", Body: json.RawMessage(`{"status": "identical"}`)},
+	})
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(fake.URL + "/")
+	return fake, client
+}
+
+func TestValidateWhenceSHA(t *testing.T) {
+	for sha, valid := range map[string]bool{"276e9d4": true, whenceSHA: true, "276e9d": false, "276E9D4": false, "release-4.9": false, whenceSHA + "0": false} {
+		if err := validateWhenceSHA(sha); (err == nil) != valid {
+			t.Errorf("%s: expected valid %v, got %v", sha, valid, err)
+		}
+	}
+}
+
+func TestWhenceLocal(t *testing.T) {
+	api, oc := "https://github.com/openshift/api", "https://github.com/openshift/oc"
+	date := time.Date(2021, 8, 17, 10, 0, 0, 0, time.UTC)
+	raw := map[string]*RawData{
+		"today.json": newRawData(RawMetadata{}, []string{api, oc}, []Change{
+			newChange(RawChange{Repository: oc, SHA: whenceSHA, Message: "Fix oc adm release info\n\nDetails", Author: "bob", Date: date, PullRequest: 880}),
+			newChange(RawChange{Repository: api, SHA: "276e9d4aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Message: "Bump the API", Date: date}),
+		}, nil),
+	}
+	cache := NewCache()
+	cache.setCommits("openshift", "installer", "master", date, []*github.RepositoryCommit{{SHA: github.String("5f1e0c3b2a1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f"), Commit: &github.Commit{Message: github.String("Bump RHCOS")}}})
+
+	result, ok := whenceLocal(whenceSHA[:10], raw, cache)
+	if !ok || result.Status != whenceFound || result.Repository != oc || result.Subject != "Fix oc adm release info" || result.PullRequest != 880 || result.Source != "today.json" {
+		t.Errorf("expected the commit found in the raw data, got %+v", result)
+	}
+	result, ok = whenceLocal("5f1e0c3", raw, cache)
+	if !ok || result.Status != whenceFound || result.Repository != "https://github.com/openshift/installer" || result.Source != "cache" {
+		t.Errorf("expected the commit found in the cache, got %+v", result)
+	}
+	// the prefix matches commits of two repositories
+	result, ok = whenceLocal("276e9d4", raw, cache)
+	expected := []string{"openshift/api@276e9d4aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "openshift/oc@" + whenceSHA}
+	if !ok || result.Status != whenceAmbiguous || !reflect.DeepEqual(result.Candidates, expected) {
+		t.Errorf("expected an ambiguous prefix, got %+v", result)
+	}
+	if _, ok := whenceLocal(whenceUnknown, raw, cache); ok {
+		t.Errorf("expected %s not found locally", whenceUnknown)
+	}
+}
+
+func TestProbeCommit(t *testing.T) {
+	repositories := []string{"https://github.com/openshift/api", "https://github.com/openshift/oc", "https://github.com/openshift/console"}
+	fake, client := fakeWhenceGithub(t)
+
+	// the search stops at the first repository that has the commit
+	result, errs := probeCommit(context.Background(), client, repositories, whenceSHA[:7], 1)
+	if result.Status != whenceFound || result.Commit != whenceSHA || result.Repository != repositories[1] || result.Source != "github" || len(errs) > 0 {
+		t.Errorf("expected the commit found in openshift/oc, got %+v and %v", result, errs)
+	}
+	if n := fake.countRequests("/repos/openshift/console/commits/" + whenceSHA[:7]); n > 0 {
+		t.Errorf("expected the search to stop at openshift/oc, got %d requests to openshift/console", n)
+	}
+
+	// missing commits are not errors, failed repositories are
+	result, errs = probeCommit(context.Background(), client, repositories, whenceUnknown, 2)
+	if result.Status != whenceNotFound || len(errs) != 1 || errs[0].Repository != repositories[2] {
+		t.Errorf("expected the commit not found with openshift/console failing, got %+v and %v", result, errs)
+	}
+}
+
+func TestWhenceDetails(t *testing.T) {
+	_, client := fakeWhenceGithub(t)
+	result := WhenceResult{SHA: whenceSHA[:7], Status: whenceFound, Commit: whenceSHA, Repository: "https://github.com/openshift/oc"}
+	// the payload is built from two commits of openshift/oc, the second one contains the commit
+	whenceDetails(context.Background(), client, &result, []string{"master", "release-4.9"}, []PayloadCommit{{Commit: "cccccccc"}, {Commit: "dddddddd"}})
+	if result.PullRequest != 880 || !reflect.DeepEqual(result.Branches, []string{"master"}) || result.InPayload == nil || !*result.InPayload {
+		t.Errorf("expected the pull request, master and the payload, got %+v", result)
+	}
+
+	var out bytes.Buffer
+	results := []WhenceResult{
+		result,
+		{SHA: whenceUnknown, Status: whenceNotFound},
+		{SHA: "276e9d4", Status: whenceAmbiguous, Candidates: []string{"openshift/api@276e9d4a", "openshift/oc@276e9d4d"}},
+		{SHA: "5f1e0c3", Status: whenceError, Error: "not found, but 1 repositories could not be searched"},
+	}
+	if err := writeWhenceReport(&out, formatTable, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"276e9d4", "openshift/oc", "#880", "yes", "NOT FOUND", "AMBIGUOUS: openshift/api@276e9d4a, openshift/oc@276e9d4d", "ERROR: not found, but 1 repositories could not be searched"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+	if err := writeWhenceReport(&out, formatJUnit, results); err == nil {
+		t.Errorf("expected an unsupported format to fail")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	// defaultTableWidth is the width of tables not written to a terminal
+	defaultTableWidth = 120
+	// minMessageWidth is the narrowest the Message column is wrapped to, however many columns there are
+	minMessageWidth = 30
+	// defaultMaxWrappedLines is the default number of lines a wrapped message is shown with
+	defaultMaxWrappedLines = 10
+)
+
+// MessageWrap is how the table output wraps the Message column.
+type MessageWrap struct {
+	// Width is the width of the table, the width of the output is used when it is 0 (see outputWidth)
+	Width int
+	// MaxLines truncates messages wrapped into more lines (0 means no limit)
+	MaxLines int
+}
+
+// outputWidth returns the width tables written to w are rendered to: width when it is set, the width of the
+// terminal w is, COLUMNS or defaultTableWidth.
+func outputWidth(w io.Writer, width int) int {
+	if width > 0 {
+		return width
+	}
+	if n, ok := w.(nopCloser); ok {
+		w = n.Writer
+	}
+	if f, ok := w.(*os.File); ok {
+		if width := terminalWidth(f); width > 0 {
+			return width
+		}
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultTableWidth
+}
+
+// tableColumnsWidth returns the width of a table with the given column widths, the columns are padded with a space
+// on both sides and separated by a space.
+func tableColumnsWidth(widths []int) int {
+	total := 1
+	for _, w := range widths {
+		total += w + 3
+	}
+	return total
+}
+
+// messageWidth returns the width the column is wrapped to in a table of the width, given the widths of the other
+// columns.
+func messageWidth(width int, widths []int, column int) int {
+	others := append(append([]int{}, widths[:column]...), widths[column+1:]...)
+	available := width - tableColumnsWidth(append(others, 0))
+	if available < minMessageWidth {
+		return minMessageWidth
+	}
+	return available
+}
+
+// wrapMessage wraps each line of the message at width cells, keeping the indentation of the lines (eg. lists)
+// on their continuation lines. A message wrapped into more than max lines is truncated (max 0 means no limit).
+func wrapMessage(message string, width, max int) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		lines = append(lines, wrapLine(line, width)...)
+	}
+	if max > 0 && len(lines) > max {
+		lines = append(lines[:max-1], "...")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLine wraps the line between words. Words wider than the line are split between runes, except URLs, which
+// are kept whole on their own line.
+func wrapLine(line string, width int) []string {
+	if runewidth.StringWidth(line) <= width {
+		return []string{line}
+	}
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	if runewidth.StringWidth(indent) > width/2 {
+		indent = ""
+	}
+	var (
+		result  []string
+		current string
+	)
+	flush := func() {
+		if len(strings.TrimSpace(current)) > 0 {
+			result = append(result, current)
+		}
+		current = indent
+	}
+	current = indent
+	for _, word := range strings.Fields(line) {
+		separator := " "
+		if len(strings.TrimSpace(current)) == 0 {
+			separator = ""
+		}
+		if runewidth.StringWidth(current+separator+word) <= width {
+			current += separator + word
+			continue
+		}
+		flush()
+		if runewidth.StringWidth(indent+word) <= width || strings.Contains(word, "://") {
+			current += word
+			continue
+		}
+		for _, r := range word {
+			if runewidth.StringWidth(current)+runewidth.RuneWidth(r) > width {
+				flush()
+			}
+			current += string(r)
+		}
+	}
+	flush()
+	return result
+}
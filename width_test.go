@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		width    int
+		expected []string
+	}{
+		{name: "short", line: "Fix the build", width: 20, expected: []string{"Fix the build"}},
+		{name: "words", line: "Bump the API to the latest version", width: 12, expected: []string{"Bump the API", "to the", "latest", "version"}},
+		{name: "indented list", line: "  - drop the deprecated field", width: 14, expected: []string{"  - drop the", "  deprecated", "  field"}},
+		{name: "long word", line: "sha 0123456789abcdef", width: 8, expected: []string{"sha", "01234567", "89abcdef"}},
+		{name: "url", line: "See https://github.com/openshift/api/pull/1234 for details", width: 20, expected: []string{"See", "https://github.com/openshift/api/pull/1234", "for details"}},
+		// wide characters take 2 cells
+		{name: "cjk", line: "修复 构建 错误", width: 6, expected: []string{"修复", "构建", "错误"}},
+		{name: "cjk word", line: "修复构建错误", width: 6, expected: []string{"修复构", "建错误"}},
+	}
+	for _, test := range tests {
+		if lines := wrapLine(test.line, test.width); !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, lines)
+		}
+	}
+}
+
+func TestWrapMessage(t *testing.T) {
+	message := "Bump the API\n\n  * add the field\n  * drop the deprecated field"
+	if wrapped := wrapMessage(message, 20, 0); wrapped != "Bump the API\n\n  * add the field\n  * drop the\n  deprecated field" {
+		t.Errorf("unexpected wrapped message %q", wrapped)
+	}
+	if wrapped := wrapMessage(message, 20, 3); wrapped != "Bump the API\n\n..." {
+		t.Errorf("expected the message truncated to 3 lines, got %q", wrapped)
+	}
+}
+
+func TestOutputWidth(t *testing.T) {
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+	os.Unsetenv("COLUMNS")
+	var out bytes.Buffer
+	if width := outputWidth(&out, 0); width != defaultTableWidth {
+		t.Errorf("expected %d for an output that is not a terminal, got %d", defaultTableWidth, width)
+	}
+	os.Setenv("COLUMNS", "90")
+	if width := outputWidth(nopCloser{&out}, 0); width != 90 {
+		t.Errorf("expected COLUMNS, got %d", width)
+	}
+	if width := outputWidth(&out, 200); width != 200 {
+		t.Errorf("expected -width, got %d", width)
+	}
+	if width := messageWidth(80, []int{10, 60, 20}, 1); width != 80-tableColumnsWidth([]int{10, 20, 0}) {
+		t.Errorf("expected the width left by the other columns, got %d", width)
+	}
+	if width := messageWidth(40, []int{10, 60, 20}, 1); width != minMessageWidth {
+		t.Errorf("expected the minimum width, got %d", width)
+	}
+}
+
+func TestPrintChangesWrapsMessages(t *testing.T) {
+	changes := []Change{
+		newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: "Bump the API to the version of the release with the new fields of the cluster version"}),
+		newChange(RawChange{Repository: "https://github.com/openshift/oc", SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", Message: "Fix the build"}),
+	}
+	for _, width := range []int{80, 100, 160} {
+		var out bytes.Buffer
+		printChanges(&out, changes, MessageWrap{Width: width}, nil)
+		lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+		if width < 160 && len(lines) < 5 {
+			t.Errorf("%d: expected the long message to be wrapped, got\n%s", width, out.String())
+		}
+		if width == 160 && len(lines) != 4 {
+			t.Errorf("%d: expected the message on a single line, got\n%s", width, out.String())
+		}
+		for _, line := range lines {
+			if w := textWidth(line); w > width {
+				t.Errorf("%d: line wider than the table (%d): %q", width, w, line)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	long := newChange(RawChange{Repository: "https://github.com/openshift/api", SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Message: strings.Repeat("word ", 100)})
+	printChanges(&out, []Change{long}, MessageWrap{Width: 80, MaxLines: 3}, nil)
+	if lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n"); len(lines) != 5 || !strings.Contains(lines[4], "...") {
+		t.Errorf("expected the message truncated to 3 lines, got\n%s", out.String())
+	}
+}